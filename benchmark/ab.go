@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// pairedDiff accumulates the latency differences (B - A) of paired
+// requests.
+type pairedDiff struct {
+	runningMean
+	bFaster uint64
+}
+
+func (p *pairedDiff) add(d float64) {
+	p.runningMean.add(d)
+	if d < 0 {
+		p.bFaster++
+	}
+}
+
+func (p *pairedDiff) merge(o pairedDiff) {
+	p.runningMean.merge(o.runningMean)
+	p.bFaster += o.bFaster
+}
+
+// ABResult is the outcome of -table-a/-table-b.
+type ABResult struct {
+	RunID  string    `json:"run_id"`
+	TableA OpSummary `json:"table_a"`
+	TableB OpSummary `json:"table_b"`
+	// Pairs counts the pairs where both requests succeeded.
+	Pairs        uint64  `json:"pairs"`
+	BFasterShare float64 `json:"b_faster_share"`
+	// Latency is the paired t-test of the latency differences B - A in
+	// milliseconds. Both tables get the same number of requests, so there is
+	// no throughput to compare.
+	Latency Difference `json:"latency"`
+}
+
+// RunAB sends the same workload to -table-a and -table-b interleaved: every
+// session sends each request to both tables back to back, in random order,
+// so both see the same time of day, and the latency difference is tested
+// over these pairs.
+func (c *DynamoDBBenchmark) RunAB() error {
+	tables := [2]DynamoDBBenchmark{*c, *c}
+	tables[0].TableName, tables[1].TableName = c.TableA, c.TableB
+	if c.Reset {
+		for i := range tables {
+			if err := tables[i].resetItem(); err != nil {
+				return err
+			}
+		}
+	}
+	c.clock = NewClock()
+	if c.Rate > 0 {
+		c.limiter = NewRateLimiter(c.Rate)
+	}
+	c.health.SetReady()
+
+	stats := NewStats()
+	stats.Start()
+	if c.Duration > 0 {
+		c.deadline = time.Now().Add(c.Duration)
+	}
+	op := "GetItem"
+	if c.Action == "write" {
+		op = "UpdateItem"
+	}
+	names := [2]string{op + "[A]", op + "[B]"}
+	diffs := make([]pairedDiff, c.Connections)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= c.Connections; i++ {
+		wg.Add(1)
+		go func(id int, stats *WorkerStats) {
+			defer wg.Done()
+			defer stats.Finish()
+			time.Sleep(c.staggerDelay(id))
+
+			db, err := getDynamoDBClient(c.sessionClientOptions(id))
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			var send [2]func() error
+			for t := range tables {
+				if c.Action == "write" {
+					param := tables[t].updateItemInput()
+					send[t] = func() error { _, err := db.UpdateItem(param); return err }
+				} else {
+					param := tables[t].getItemInput()
+					send[t] = func() error { _, err := db.GetItem(param); return err }
+				}
+			}
+			rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+			for i := 1; c.moreCalls(id, i); i++ {
+				var latency [2]time.Duration
+				var failed bool
+				first := rnd.Intn(2)
+				for _, t := range []int{first, 1 - first} {
+					start := c.clock.Now()
+					err := retry(c.RetryNum, 2*time.Second, send[t])
+					latency[t] = time.Since(start)
+					stats.Record(names[t], start, latency[t], 1, err)
+					if err != nil {
+						failed = true
+						if !c.TUI {
+							fmt.Printf("Error: %v\n", err)
+						}
+					}
+				}
+				if !failed {
+					diffs[id-1].add(durationMs(latency[1]) - durationMs(latency[0]))
+				}
+			}
+		}(i, stats.Worker(i))
+	}
+	wg.Wait()
+	stats.Stop()
+
+	var total pairedDiff
+	for _, d := range diffs {
+		total.merge(d)
+	}
+	r := ABResult{RunID: c.RunID, Pairs: total.n, BFasterShare: ratio(total.bFaster, total.n)}
+	for _, s := range stats.Summary(c.Action).Operations {
+		switch s.Operation {
+		case names[0]:
+			r.TableA = s
+		case names[1]:
+			r.TableB = s
+		}
+	}
+	r.TableA.Operation, r.TableB.Operation = c.TableA, c.TableB
+	r.Latency = pairedTest("latency_ms", r.TableA.AverageMs, r.TableB.AverageMs, total.runningMean)
+	printAB(r)
+	return nil
+}
+
+func printAB(r ABResult) {
+	fmt.Println("-----------------------")
+	fmt.Println("DynamoDB Benchmark A/B Comparison")
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", r.RunID)
+	fmt.Printf("%-3s %-32s %10s %8s %12s %9s %9s %9s %9s\n", "", "table", "success", "errors", "requests/s", "avg_ms", "p50_ms", "p90_ms", "p99_ms")
+	for _, t := range []struct {
+		label string
+		s     OpSummary
+	}{{"A", r.TableA}, {"B", r.TableB}} {
+		fmt.Printf("%-3s %-32s %10d %8d %12.1f %9.3f %9.3f %9.3f %9.3f\n",
+			t.label, t.s.Operation, t.s.Success, t.s.Errors, t.s.RequestsPerSecond, t.s.AverageMs, t.s.P50Ms, t.s.P90Ms, t.s.P99Ms)
+	}
+	if r.Pairs < 2 {
+		fmt.Printf("[WARN] only %d successful pairs, too few to compare\n", r.Pairs)
+		return
+	}
+	fmt.Printf("Latency B - A in ms over %d pairs (paired t-test): %s\n", r.Pairs, r.Latency)
+	fmt.Printf("B was faster in %.1f%% of the pairs\n", r.BFasterShare*100)
+}
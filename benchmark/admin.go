@@ -0,0 +1,353 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/lambda"
+
+	"benchmark/internal/cli"
+	"benchmark/internal/table"
+)
+
+var adminUsageText = `auto_increment admin -a <action> -table <table> [options...]
+
+Create, copy, back up and tag the tables and items the benchmark runs against.
+
+Options:
+-a <action>          (Required) An action to execute
+                     Defaults to "create-table"; must be one of: create-table, create-item, delete-item, get-item,
+                     export, import, clone-table, enable-pitr, create-backup, ensure-tags,
+                     deploy-trigger, remove-trigger
+-table <table>       (Required) DynamoDB table name
+-id <id>             (Required for create-item, delete-item) id field value in the table
+-source-table <t>    (Required for clone-table) Table whose key schema, GSIs, LSIs, billing mode and
+                     stream settings are copied to the new table -table
+-source-region <r>   Region of the source table; Defaults to the region of the new table
+-source-profile <p>  AWS shared config profile for the source table (e.g. another account)
+-source-endpoint-url <url>
+                     Endpoint URL for the source table; Defaults to -endpoint-url
+-sse <type>          Server-side encryption of create-table: "aws-owned" (an AWS owned key, free),
+                     "aws-managed" (the AWS managed KMS key aws/dynamodb) or "customer-managed"
+                     (the KMS key -kms-key); Defaults to "aws-owned"
+-kms-key <key>       (Required for -sse customer-managed) ARN, ID or alias of the KMS key
+-sort-key <name>[:S|N]
+                     Sort key of the table created by create-table, numeric unless ":S" follows,
+                     e.g. "seq" for the ledger action of the benchmark or "sk:S" for sk-query;
+                     Defaults to none (partition key "id" only)
+-pre-split N         Create the table of create-table with N x 1000 WCU, which DynamoDB serves with
+                     at least N partitions, wait until it is ACTIVE and scale it down to 10 WCU.
+                     The table keeps its partitions, so early benchmark runs do not throttle on a
+                     single partition; Defaults to 0 (create with 10 RCU / 10 WCU)
+-lsi <name>:<attr>[:S|N|B],...
+                     Local secondary indexes of the table created by create-table, each sorted by
+                     the attribute attr (type S unless given) and projecting all attributes, e.g.
+                     "by_score:score:N" for the item-collection action of the benchmark. Needs
+                     -sort-key; at most 5. Note that the item collections of a table with local
+                     secondary indexes are limited to 10 GB
+-tags <k=v,...>      Tags of the table created by create-table and clone-table, e.g. cost
+                     allocation and cleanup tags: "team=db,owner=yoichi,expires=2024-12-31".
+                     (Required for ensure-tags) ensure-tags adds those the table is missing
+-zip <file>          (Required for deploy-trigger) Lambda deployment package deploy-trigger deploys as a
+                     function triggered by the stream of -table (enabled with new and old images if
+                     off), from the latest record on, e.g. the function deriving the items the
+                     pipeline action of the benchmark waits for. Redeploying updates its code
+-role <arn>          (Required for deploy-trigger) Execution role of the function, which must be
+                     allowed to read the stream and write the derived items
+-function <name>     Function of deploy-trigger and remove-trigger, which deletes the function and
+                     its event source mappings but leaves the stream on. Both only touch functions
+                     deploy-trigger created (tagged "dynamodb-benchmark"); Defaults to "<table>-pipeline"
+-runtime <runtime>   Runtime of the function of deploy-trigger; Defaults to "provided.al2023"
+-handler <handler>   Handler of the function of deploy-trigger; Defaults to "bootstrap"
+-batch-size N        Maximum number of stream records per invocation of deploy-trigger; Defaults to 100
+-backup-name <name>  Name of the backup of create-backup; Defaults to "<table>-<UTC timestamp>"
+-wait                Wait until the backup of create-backup is AVAILABLE
+-region <region>     AWS region of the table; Defaults to the shared config / environment
+-profile <profile>   AWS shared config profile; Defaults to the shared config / environment
+-file <file>         (Required for export, import) File to export items to or import items from
+-format <format>     File format of export and import: "json" (newline delimited DynamoDB JSON,
+                     lossless) or "csv" (header "<name>:<type>", sets/lists/maps as DynamoDB JSON)
+                     Defaults to "json"
+-parallel N          Number of parallel scan segments (export) or BatchWriteItem writers (import)
+                     Defaults to 4
+-endpoint-url <url>  DynamoDB Endpoint URL to send the API request to.
+                     Defaults to "", which mean the AWS SDK automatically determines the URL
+                     For example, give "http://localhost:8000" if it's local dynamodb with exposed port 8000
+-endpoint-scheme <s> Force "http" or "https" for the endpoint regardless of -endpoint-url
+                     Defaults to "", which keeps the scheme of the endpoint URL
+-insecure-skip-verify
+                     Skip TLS certificate verification (e.g. self-signed certificates)
+-ca-bundle <file>    PEM file with CA certificates to trust in addition to the system ones
+-config <file>       JSON file with option values, keyed by flag name (see the benchmark)
+-verbose             Verbose option
+-h                   help message
+
+Every option can also be set with an environment variable DDB_BENCH_<OPTION> or in the -config file
+(the options of the benchmark there are ignored), as for the benchmark.
+`
+
+// admin runs the admin subcommand, which prepares tables and items for the
+// benchmark.
+func admin(args []string) int {
+	fs := flag.NewFlagSet("admin", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Println(adminUsageText) }
+
+	var (
+		action             string
+		tableName          string
+		id                 string
+		endpointUrl        string
+		endpointScheme     string
+		insecureSkipVerify bool
+		caBundle           string
+		region             string
+		profile            string
+		sourceTable        string
+		sourceRegion       string
+		sourceProfile      string
+		sourceEndpointUrl  string
+		file               string
+		format             string
+		parallel           int
+		sse                string
+		kmsKey             string
+		tagSpec            string
+		backupName         string
+		wait               bool
+		sortKey            string
+		preSplit           int
+		lsiSpec            string
+		zip                string
+		role               string
+		function           string
+		runtime            string
+		handler            string
+		batchSize          int64
+		configFile         string
+		verbose            bool
+	)
+
+	fs.StringVar(&action, "a", "create-table", "(Required) An action to execute")
+	fs.StringVar(&tableName, "table", "", "(Required) DynamoDB table name")
+	fs.StringVar(&endpointUrl, "endpoint-url", "", "The URL to send the API request to")
+	fs.StringVar(&endpointScheme, "endpoint-scheme", "", "Force http or https for the endpoint")
+	fs.BoolVar(&insecureSkipVerify, "insecure-skip-verify", false, "Skip TLS certificate verification")
+	fs.StringVar(&caBundle, "ca-bundle", "", "PEM file with additional CA certificates to trust")
+	fs.StringVar(&id, "id", "", "(Required) id field value in the table")
+	fs.StringVar(&region, "region", "", "AWS region of the table")
+	fs.StringVar(&profile, "profile", "", "AWS shared config profile to use")
+	fs.StringVar(&sourceTable, "source-table", "", "Table to copy the schema from (clone-table)")
+	fs.StringVar(&sourceRegion, "source-region", "", "AWS region of the source table (clone-table)")
+	fs.StringVar(&sourceProfile, "source-profile", "", "AWS shared config profile for the source table (clone-table)")
+	fs.StringVar(&sourceEndpointUrl, "source-endpoint-url", "", "Endpoint URL for the source table (clone-table)")
+	fs.StringVar(&file, "file", "", "File to export items to or import items from")
+	fs.StringVar(&format, "format", "json", "File format of export and import: json or csv")
+	fs.IntVar(&parallel, "parallel", 4, "Number of parallel scan segments (export) or writers (import)")
+	fs.StringVar(&sse, "sse", "aws-owned", "Server-side encryption of create-table: aws-owned, aws-managed or customer-managed")
+	fs.StringVar(&kmsKey, "kms-key", "", "KMS key ARN, ID or alias for -sse customer-managed")
+	fs.StringVar(&sortKey, "sort-key", "", "Sort key of the created table (create-table): <name>[:S|N]")
+	fs.IntVar(&preSplit, "pre-split", 0, "Number of partitions to create the table with before scaling it down (create-table)")
+	fs.StringVar(&lsiSpec, "lsi", "", "Local secondary indexes of the created table (create-table): <name>:<attribute>[:S|N|B],...")
+	fs.StringVar(&tagSpec, "tags", "", "Tags of the created table (create-table, clone-table, ensure-tags): key=value,...")
+	fs.StringVar(&backupName, "backup-name", "", "Name of the backup (create-backup)")
+	fs.BoolVar(&wait, "wait", false, "Wait until the backup is available (create-backup)")
+	fs.StringVar(&zip, "zip", "", "Lambda deployment package of the stream trigger (deploy-trigger)")
+	fs.StringVar(&role, "role", "", "Execution role ARN of the stream trigger (deploy-trigger)")
+	fs.StringVar(&function, "function", "", "Function of the stream trigger (deploy-trigger, remove-trigger)")
+	fs.StringVar(&runtime, "runtime", "provided.al2023", "Runtime of the stream trigger (deploy-trigger)")
+	fs.StringVar(&handler, "handler", "bootstrap", "Handler of the stream trigger (deploy-trigger)")
+	fs.Int64Var(&batchSize, "batch-size", 100, "Maximum number of stream records per invocation (deploy-trigger)")
+	fs.StringVar(&configFile, "config", "", "JSON file with option values, overridden by environment variables and flags")
+	fs.BoolVar(&verbose, "verbose", false, "Verbose option")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if _, err := cli.ApplyEnvAndConfig(fs, configFile, true); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		return exitUsage
+	}
+
+	if action != "create-table" &&
+		action != "create-item" &&
+		action != "delete-item" &&
+		action != "get-item" &&
+		action != "export" &&
+		action != "import" &&
+		action != "clone-table" &&
+		action != "enable-pitr" &&
+		action != "create-backup" &&
+		action != "ensure-tags" &&
+		action != "deploy-trigger" &&
+		action != "remove-trigger" {
+		fmt.Println("[ERROR] Invalid Command Options (-a)! action value must: create-table, create-item, delete-item, get-item, export, import, clone-table, enable-pitr, create-backup, ensure-tags, deploy-trigger or remove-trigger")
+		return exitUsage
+	}
+	if tableName == "" ||
+		(action == "create-item" && id == "") ||
+		(action == "delete-item" && id == "") ||
+		(action == "get-item" && id == "") {
+		fmt.Println("[ERROR] Invalid Command Options! Minimum required options are \"-table\" and \"-id\"")
+		fmt.Println(adminUsageText)
+		return exitUsage
+	}
+
+	if (action == "export" || action == "import") && file == "" {
+		fmt.Println("[ERROR] Invalid Command Options! \"-file\" is required for export and import")
+		return exitUsage
+	}
+	if action == "clone-table" && sourceTable == "" {
+		fmt.Println("[ERROR] Invalid Command Options! \"-source-table\" is required for clone-table")
+		return exitUsage
+	}
+	if action == "deploy-trigger" && (zip == "" || role == "") {
+		fmt.Println("[ERROR] Invalid Command Options! \"-zip\" and \"-role\" are required for deploy-trigger")
+		return exitUsage
+	}
+	if (action == "deploy-trigger" || action == "remove-trigger") && endpointUrl != "" {
+		fmt.Println("[ERROR] Invalid Command Options (-endpoint-url)! the stream trigger needs a table in AWS")
+		return exitUsage
+	}
+	if batchSize <= 0 {
+		fmt.Println("[ERROR] Invalid Command Options (-batch-size)! value must be more than 0")
+		return exitUsage
+	}
+	if format != "json" && format != "csv" {
+		fmt.Println("[ERROR] Invalid Command Options (-format)! value must be either json or csv")
+		return exitUsage
+	}
+	if parallel <= 0 {
+		fmt.Println("[ERROR] Invalid Command Options (-parallel)! value must be more than 0")
+		return exitUsage
+	}
+
+	tags, err := ParseTags(tagSpec)
+	if err != nil {
+		fmt.Printf("[ERROR] Invalid Command Options! %v\n", err)
+		return exitUsage
+	}
+	if action == "ensure-tags" && len(tags) == 0 {
+		fmt.Println("[ERROR] Invalid Command Options! \"-tags\" is required for ensure-tags")
+		return exitUsage
+	}
+	sortKeyType := "N"
+	if i := strings.LastIndex(sortKey, ":"); i >= 0 {
+		sortKey, sortKeyType = sortKey[:i], sortKey[i+1:]
+		if sortKeyType != "S" && sortKeyType != "N" {
+			fmt.Println("[ERROR] Invalid Command Options (-sort-key)! the type must be either S or N")
+			return exitUsage
+		}
+	}
+	if sortKey == "id" {
+		fmt.Println("[ERROR] Invalid Command Options (-sort-key)! value must not be the partition key \"id\"")
+		return exitUsage
+	}
+	lsis, err := table.ParseLSIs(lsiSpec)
+	if err != nil {
+		fmt.Printf("[ERROR] Invalid Command Options! %v\n", err)
+		return exitUsage
+	}
+	if len(lsis) > 0 && sortKey == "" {
+		fmt.Println("[ERROR] Invalid Command Options (-lsi)! local secondary indexes need a table with -sort-key")
+		return exitUsage
+	}
+	if preSplit < 0 {
+		fmt.Println("[ERROR] Invalid Command Options (-pre-split)! value must not be negative")
+		return exitUsage
+	}
+	sseSpec, err := table.SSESpecification(sse, kmsKey)
+	if err != nil {
+		fmt.Printf("[ERROR] Invalid Command Options! %v\n", err)
+		return exitUsage
+	}
+
+	if endpointScheme != "" && endpointScheme != "http" && endpointScheme != "https" {
+		fmt.Println("[ERROR] Invalid Command Options (-endpoint-scheme)! value must be either http or https")
+		return exitUsage
+	}
+
+	clientOptions := ClientOptions{
+		EndpointUrl:        endpointUrl,
+		EndpointScheme:     endpointScheme,
+		InsecureSkipVerify: insecureSkipVerify,
+		CABundle:           caBundle,
+		Region:             region,
+		Profile:            profile,
+	}
+	db, err := getDynamoDBClient(clientOptions)
+	if err != nil {
+		fmt.Println(err.Error())
+		return exitFailure
+	}
+
+	switch action {
+	case "create-table":
+		err = table.Create(db, &tableName, sortKey, sortKeyType, sseSpec, tags, preSplit, lsis)
+		if err == nil && preSplit > 0 {
+			err = table.ScaleDownPreSplit(db, &tableName, preSplit, verbose)
+		}
+	case "create-item":
+		err = table.CreateItem(db, &tableName, &id)
+	case "delete-item":
+		err = table.DeleteItem(db, &tableName, &id)
+	case "get-item":
+		var item table.Item
+		if item, err = table.GetItem(db, &tableName, &id); err == nil {
+			fmt.Printf("Found item: id=%s, age=%d\n", item.Id, item.Age)
+		}
+	case "export":
+		err = ExportTable(db, &tableName, file, format, parallel, verbose)
+	case "import":
+		err = ImportTable(db, &tableName, file, format, parallel, verbose)
+	case "enable-pitr":
+		err = EnablePITR(db, &tableName)
+	case "create-backup":
+		err = CreateBackup(db, &tableName, backupName, wait, verbose)
+	case "ensure-tags":
+		err = EnsureTags(db, &tableName, tags, verbose)
+	case "deploy-trigger", "remove-trigger":
+		var fn *lambda.Lambda
+		fn, err = getLambdaClient(clientOptions)
+		if err != nil {
+			break
+		}
+		function = triggerFunction(function, tableName)
+		if action == "remove-trigger" {
+			err = RemoveTrigger(fn, &tableName, function, verbose)
+			break
+		}
+		err = DeployTrigger(db, fn, &tableName, TriggerOptions{
+			Function:  function,
+			Zip:       zip,
+			Role:      role,
+			Runtime:   runtime,
+			Handler:   handler,
+			BatchSize: batchSize,
+		}, verbose)
+	case "clone-table":
+		sourceOptions := clientOptions
+		if sourceRegion != "" {
+			sourceOptions.Region = sourceRegion
+		}
+		if sourceProfile != "" {
+			sourceOptions.Profile = sourceProfile
+		}
+		if sourceEndpointUrl != "" {
+			sourceOptions.EndpointUrl = sourceEndpointUrl
+		}
+		var source *dynamodb.DynamoDB
+		source, err = getDynamoDBClient(sourceOptions)
+		if err == nil {
+			err = CloneTable(source, db, &sourceTable, &tableName, tags, verbose)
+		}
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Assertion is one invariant on a numeric attribute of the target item,
+// checked after the run, e.g. "age==initial+successes".
+type Assertion struct {
+	Text      string
+	Attribute string
+	Op        string
+	// Terms are summed to get the expected value. Each is a signed integer
+	// literal or one of the variables "initial", "successes" and "errors".
+	Terms []assertionTerm
+}
+
+type assertionTerm struct {
+	sign     int64
+	variable string
+	value    int64
+}
+
+type AssertionResult struct {
+	Assertion string `json:"assertion"`
+	Passed    bool   `json:"passed"`
+	Actual    string `json:"actual"`
+	Expected  string `json:"expected"`
+}
+
+var (
+	assertionPattern = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)\s*(>=|<=|==|!=|>|<)\s*(.+?)\s*$`)
+	assertionTerms   = regexp.MustCompile(`\s*([+-]?)\s*([A-Za-z_][A-Za-z0-9_]*|[0-9]+)\s*`)
+	assertionVars    = map[string]bool{"initial": true, "successes": true, "errors": true}
+)
+
+// ParseAssertions parses a comma separated list of invariants. An empty
+// string means no assertions.
+func ParseAssertions(s string) ([]Assertion, error) {
+	var assertions []Assertion
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	for _, text := range strings.Split(s, ",") {
+		m := assertionPattern.FindStringSubmatch(text)
+		if m == nil {
+			return nil, fmt.Errorf("invalid assertion %q: must be <attribute><op><expression>", text)
+		}
+		a := Assertion{Text: strings.TrimSpace(text), Attribute: m[1], Op: m[2]}
+		rest := m[3]
+		for i := 0; rest != ""; i++ {
+			tm := assertionTerms.FindStringSubmatchIndex(rest)
+			if tm == nil || tm[0] != 0 || (i > 0 && tm[2] == tm[3]) {
+				return nil, fmt.Errorf("invalid assertion %q: cannot parse %q", a.Text, rest)
+			}
+			term := assertionTerm{sign: 1, variable: rest[tm[4]:tm[5]]}
+			if rest[tm[2]:tm[3]] == "-" {
+				term.sign = -1
+			}
+			if v, err := strconv.ParseInt(term.variable, 10, 64); err == nil {
+				term.value, term.variable = v, ""
+			} else if !assertionVars[term.variable] {
+				return nil, fmt.Errorf("invalid assertion %q: unknown variable %q (use initial, successes or errors)", a.Text, term.variable)
+			}
+			a.Terms = append(a.Terms, term)
+			rest = rest[tm[1]:]
+		}
+		assertions = append(assertions, a)
+	}
+	return assertions, nil
+}
+
+func (a Assertion) usesInitial() bool {
+	for _, t := range a.Terms {
+		if t.variable == "initial" {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Assertion) compare(actual int64, expected int64) bool {
+	switch a.Op {
+	case ">=":
+		return actual >= expected
+	case "<=":
+		return actual <= expected
+	case "==":
+		return actual == expected
+	case "!=":
+		return actual != expected
+	case ">":
+		return actual > expected
+	case "<":
+		return actual < expected
+	}
+	return false
+}
+
+func numberAttribute(item map[string]*dynamodb.AttributeValue, name string) (int64, error) {
+	av, ok := item[name]
+	if !ok || av.N == nil {
+		return 0, fmt.Errorf("attribute %q is missing or not a number", name)
+	}
+	return strconv.ParseInt(*av.N, 10, 64)
+}
+
+// Check evaluates the assertion against the item read back after the run.
+// initial is the item before the run and may be nil if no assertion uses it.
+func (a Assertion) Check(item map[string]*dynamodb.AttributeValue, initial map[string]*dynamodb.AttributeValue, sum Summary) AssertionResult {
+	r := AssertionResult{Assertion: a.Text}
+	actual, err := numberAttribute(item, a.Attribute)
+	if err != nil {
+		r.Actual = err.Error()
+		return r
+	}
+	r.Actual = strconv.FormatInt(actual, 10)
+
+	var expected int64
+	for _, t := range a.Terms {
+		v := t.value
+		switch t.variable {
+		case "initial":
+			v, err = numberAttribute(initial, a.Attribute)
+			if err != nil {
+				r.Expected = "initial " + err.Error()
+				return r
+			}
+		case "successes":
+			v = int64(sum.Success)
+		case "errors":
+			v = int64(sum.Errors)
+		}
+		expected += t.sign * v
+	}
+	r.Expected = a.Op + " " + strconv.FormatInt(expected, 10)
+	r.Passed = a.compare(actual, expected)
+	return r
+}
+
+// readItem reads the target item with a strongly consistent read.
+func (c *DynamoDBBenchmark) readItem() (map[string]*dynamodb.AttributeValue, error) {
+	db, err := getDynamoDBClient(c.clientOptions())
+	if err != nil {
+		return nil, err
+	}
+	param := c.getItemInput()
+	param.ConsistentRead = aws.Bool(true)
+	out, err := db.GetItem(param)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read item %q: %v", c.Id, err)
+	}
+	if out.Item == nil {
+		return nil, fmt.Errorf("item %q does not exist", c.Id)
+	}
+	return out.Item, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// backpressureLagWarning is the lag behind the -rate schedule above which the
+// summary warns that the run did not send the load it was meant to.
+const backpressureLagWarning = time.Second
+
+// BackpressurePoint is one sample of the load generator's queues.
+type BackpressurePoint struct {
+	OffsetSec float64 `json:"offset_sec"`
+	// InFlight counts the calls sent and not returned yet, Blocked the
+	// sessions waiting for a free slot of -pipeline-depth.
+	InFlight int64 `json:"in_flight"`
+	Blocked  int64 `json:"blocked_sessions"`
+	// BehindRequests is how many requests the sessions trail the -rate
+	// schedule, LagMs the same as time.
+	BehindRequests float64 `json:"behind_requests"`
+	LagMs          float64 `json:"lag_ms"`
+}
+
+// BackpressureSummary tells whether the load generator kept up with its
+// intended schedule. Series is only written to -backpressure-report.
+type BackpressureSummary struct {
+	Samples           int                 `json:"samples"`
+	MaxInFlight       int64               `json:"max_in_flight"`
+	MaxBlocked        int64               `json:"max_blocked_sessions"`
+	BlockedSamples    int                 `json:"blocked_samples"`
+	MaxBehindRequests float64             `json:"max_behind_requests"`
+	MaxLagMs          float64             `json:"max_lag_ms"`
+	LaggingSamples    int                 `json:"lagging_samples"`
+	Warning           string              `json:"warning,omitempty"`
+	Series            []BackpressurePoint `json:"-"`
+}
+
+func (s *BackpressureSummary) String() string {
+	return fmt.Sprintf("max in flight %d, sessions waiting for a pipeline slot up to %d (%d of %d samples), behind the -rate schedule up to %.0f requests (%.0f ms, %d of %d samples behind by more than %v)",
+		s.MaxInFlight, s.MaxBlocked, s.BlockedSamples, s.Samples, s.MaxBehindRequests, s.MaxLagMs, s.LaggingSamples, s.Samples, backpressureLagWarning)
+}
+
+// Backpressure samples the calls in flight, the sessions blocked on
+// -pipeline-depth and the lag behind the schedule of the rate limiter at a
+// fixed interval, at the start and at the stop, so a generator which falls
+// behind its intended load shows up. The most calls in flight and sessions
+// blocked are tracked exactly, also for runs shorter than the interval. A
+// nil *Backpressure records nothing.
+type Backpressure struct {
+	limiter     *RateLimiter
+	interval    time.Duration
+	inFlight    int64
+	blocked     int64
+	maxInFlight int64
+	maxBlocked  int64
+	stop        chan struct{}
+	done        chan struct{}
+
+	mu     sync.Mutex
+	start  time.Time
+	series []BackpressurePoint
+}
+
+func NewBackpressure(limiter *RateLimiter, interval time.Duration) *Backpressure {
+	return &Backpressure{
+		limiter:  limiter,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// InFlight adds delta to the calls in flight.
+func (b *Backpressure) InFlight(delta int64) {
+	if b != nil {
+		storeMax(&b.maxInFlight, atomic.AddInt64(&b.inFlight, delta))
+	}
+}
+
+// Blocked adds delta to the sessions waiting for a pipeline slot.
+func (b *Backpressure) Blocked(delta int64) {
+	if b != nil {
+		storeMax(&b.maxBlocked, atomic.AddInt64(&b.blocked, delta))
+	}
+}
+
+// storeMax raises *max to n.
+func storeMax(max *int64, n int64) {
+	for {
+		old := atomic.LoadInt64(max)
+		if n <= old || atomic.CompareAndSwapInt64(max, old, n) {
+			return
+		}
+	}
+}
+
+func (b *Backpressure) Start() {
+	if b == nil {
+		return
+	}
+	b.start = time.Now()
+	b.sample(b.start)
+	go func() {
+		defer close(b.done)
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				b.sample(now)
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (b *Backpressure) sample(now time.Time) {
+	p := BackpressurePoint{
+		OffsetSec:      now.Sub(b.start).Seconds(),
+		InFlight:       atomic.LoadInt64(&b.inFlight),
+		Blocked:        atomic.LoadInt64(&b.blocked),
+		BehindRequests: b.limiter.Behind(now),
+	}
+	if rate := b.limiter.Rate(); rate > 0 {
+		p.LagMs = p.BehindRequests / rate * 1000
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.series = append(b.series, p)
+}
+
+// Stop ends the sampling and returns the summary, with a warning if the
+// sessions fell more than backpressureLagWarning behind the schedule.
+func (b *Backpressure) Stop() *BackpressureSummary {
+	if b == nil {
+		return nil
+	}
+	close(b.stop)
+	<-b.done
+	b.sample(time.Now())
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sum := &BackpressureSummary{
+		Samples:     len(b.series),
+		MaxInFlight: atomic.LoadInt64(&b.maxInFlight),
+		MaxBlocked:  atomic.LoadInt64(&b.maxBlocked),
+		Series:      b.series,
+	}
+	for _, p := range b.series {
+		if p.InFlight > sum.MaxInFlight {
+			sum.MaxInFlight = p.InFlight
+		}
+		if p.Blocked > sum.MaxBlocked {
+			sum.MaxBlocked = p.Blocked
+		}
+		if p.Blocked > 0 {
+			sum.BlockedSamples++
+		}
+		if p.BehindRequests > sum.MaxBehindRequests {
+			sum.MaxBehindRequests = p.BehindRequests
+		}
+		if p.LagMs > sum.MaxLagMs {
+			sum.MaxLagMs = p.LagMs
+		}
+		if p.LagMs > durationMs(backpressureLagWarning) {
+			sum.LaggingSamples++
+		}
+	}
+	if sum.LaggingSamples > 0 {
+		sum.Warning = fmt.Sprintf("the sessions fell up to %.1fs behind the -rate schedule; the run sent less than the intended load, interpret its throughput and latencies with caution (more sessions or -pipeline-depth keep up)",
+			sum.MaxLagMs/1000)
+	}
+	return sum
+}
+
+// WriteCSV writes the samples to path.
+func (s *BackpressureSummary) WriteCSV(path string, runID string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create backpressure report: %v", err)
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"offset_sec", "in_flight", "blocked_sessions", "behind_requests", "lag_ms", "run_id"})
+	for _, p := range s.Series {
+		w.Write([]string{
+			strconv.FormatFloat(p.OffsetSec, 'f', 3, 64),
+			strconv.FormatInt(p.InFlight, 10),
+			strconv.FormatInt(p.Blocked, 10),
+			strconv.FormatFloat(p.BehindRequests, 'f', 1, 64),
+			strconv.FormatFloat(p.LagMs, 'f', 3, 64),
+			runID,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write backpressure report: %v", err)
+	}
+	return f.Close()
+}
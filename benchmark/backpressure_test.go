@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// A run shorter than the sampling interval still has its samples at the
+// start and the stop, and the most calls it had in flight.
+func TestBackpressureShortRun(t *testing.T) {
+	b := NewBackpressure(nil, time.Hour)
+	b.Start()
+	for i := 0; i < 8; i++ {
+		b.InFlight(1)
+	}
+	b.Blocked(1)
+	b.Blocked(-1)
+	for i := 0; i < 8; i++ {
+		b.InFlight(-1)
+	}
+	sum := b.Stop()
+	if sum.Samples != 2 || sum.MaxInFlight != 8 || sum.MaxBlocked != 1 {
+		t.Errorf("%d samples, max in flight %d, max blocked %d; want 2, 8 and 1", sum.Samples, sum.MaxInFlight, sum.MaxBlocked)
+	}
+}
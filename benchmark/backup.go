@@ -0,0 +1,39 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var backupNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// backupMonitor creates an on-demand backup of the table -backup-at into the
+// run, named "<table>-bench-<run id>", and follows it until it is available.
+func (c *DynamoDBBenchmark) backupMonitor(db *dynamodb.DynamoDB, timeline *Timeline) *EventMonitor {
+	name := backupNameInvalid.ReplaceAllString(c.TableName+"-bench-"+c.RunID, "_")
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	begin := func() (string, string, error) {
+		out, err := db.CreateBackup(&dynamodb.CreateBackupInput{
+			TableName:  aws.String(c.TableName),
+			BackupName: aws.String(name),
+		})
+		if err != nil {
+			return "", "", err
+		}
+		c.resources.Track(Resource{Kind: resourceBackup, Table: c.TableName, Name: aws.StringValue(out.BackupDetails.BackupArn), RoleChain: c.clientOptions().RoleChain})
+		return aws.StringValue(out.BackupDetails.BackupArn), aws.StringValue(out.BackupDetails.BackupStatus), nil
+	}
+	poll := func(arn string) (string, bool, error) {
+		out, err := db.DescribeBackup(&dynamodb.DescribeBackupInput{BackupArn: aws.String(arn)})
+		if err != nil {
+			return "", false, err
+		}
+		status := aws.StringValue(out.BackupDescription.BackupDetails.BackupStatus)
+		return status, status != dynamodb.BackupStatusCreating, nil
+	}
+	return NewEventMonitor("Backup", c.BackupAt, timeline, c.Verbose, begin, poll)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	maxBatchWriteItems = 25
+	maxBatchGetItems   = 100
+)
+
+var (
+	defaultBatchWriteSizes = []int{1, 2, 5, 10, 15, 20, 25}
+	defaultBatchGetSizes   = []int{1, 5, 10, 25, 50, 75, 100}
+)
+
+// BatchSweepLevel is the outcome of the batches sent with one batch size.
+type BatchSweepLevel struct {
+	BatchSize int    `json:"batch_size"`
+	Requests  uint64 `json:"requests"`
+	Errors    uint64 `json:"errors"`
+	Items     uint64 `json:"items"`
+	// Unprocessed counts the items DynamoDB returned as unprocessed on their
+	// first submission.
+	Unprocessed uint64 `json:"unprocessed"`
+	// UnprocessedRate is the fraction of the items sent that DynamoDB
+	// returned as unprocessed on their first submission.
+	UnprocessedRate float64 `json:"unprocessed_rate"`
+	// Attempts counts the items processed at the 1st, 2nd and 3rd or later
+	// submission.
+	Attempts [3]uint64 `json:"attempts"`
+	// Failed counts the items still unprocessed after -unprocessed-retries
+	// resubmissions or when a resubmission failed.
+	Failed uint64 `json:"failed"`
+	// ItemsPerSecond counts the processed items only.
+	ItemsPerSecond float64 `json:"items_per_sec"`
+	AverageMs      float64 `json:"average_ms"`
+	P99Ms          float64 `json:"p99_ms"`
+}
+
+// parseBatchSizes parses a comma separated list of batch sizes. An empty
+// string means the default sizes of op.
+func parseBatchSizes(s string, op string) ([]int, error) {
+	if strings.TrimSpace(s) == "" {
+		if op == "read" {
+			return defaultBatchGetSizes, nil
+		}
+		return defaultBatchWriteSizes, nil
+	}
+	max := maxBatchWriteItems
+	if op == "read" {
+		max = maxBatchGetItems
+	}
+	var sizes []int
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < 1 || n > max {
+			return nil, fmt.Errorf("invalid batch size %q: must be between 1 and %d for %s", f, max, op)
+		}
+		sizes = append(sizes, n)
+	}
+	return sizes, nil
+}
+
+// batchWriteInput puts size distinct items picked at random from the
+// -batch-keys items "<id>-1", "<id>-2", ...
+func (c *DynamoDBBenchmark) batchWriteInput(size int, rnd *rand.Rand) *dynamodb.BatchWriteItemInput {
+	var requests []*dynamodb.WriteRequest
+	for _, k := range rnd.Perm(c.BatchKeys)[:size] {
+		requests = append(requests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{
+				Item: map[string]*dynamodb.AttributeValue{
+					"id": {
+						S: aws.String(c.sweepKey(k + 1)),
+					},
+					"age": {
+						N: aws.String(strconv.Itoa(c.SeedAge)),
+					},
+				},
+			},
+		})
+	}
+	return &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{c.TableName: requests},
+	}
+}
+
+// batchGetInput reads size distinct items picked at random from the
+// -batch-keys items.
+func (c *DynamoDBBenchmark) batchGetInput(size int, rnd *rand.Rand) *dynamodb.BatchGetItemInput {
+	var keys []map[string]*dynamodb.AttributeValue
+	for _, k := range rnd.Perm(c.BatchKeys)[:size] {
+		keys = append(keys, map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(c.sweepKey(k + 1)),
+			},
+		})
+	}
+	return &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{c.TableName: {Keys: keys}},
+	}
+}
+
+// batchResult is the outcome of one batch including the resubmissions of its
+// unprocessed items.
+type batchResult struct {
+	unprocessed int
+	attempts    [3]int
+	failed      int
+}
+
+// unprocessedBackoff returns the randomized exponential delay before the n-th
+// (1-based) resubmission of unprocessed items.
+func (c *DynamoDBBenchmark) unprocessedBackoff(n int, rnd *rand.Rand) time.Duration {
+	if c.UnprocessedBackoff == 0 {
+		return 0
+	}
+	d := c.UnprocessedBackoff << uint(n-1)
+	if d <= 0 || d > 10*time.Second {
+		d = 10 * time.Second
+	}
+	return d/2 + time.Duration(rnd.Int63n(int64(d/2)+1))
+}
+
+// sendBatch sends one batch of size items and resubmits the unprocessed items
+// with backoff up to -unprocessed-retries times.
+func (c *DynamoDBBenchmark) sendBatch(db *dynamodb.DynamoDB, size int, rnd *rand.Rand) (batchResult, error) {
+	var r batchResult
+	var write *dynamodb.BatchWriteItemInput
+	var get *dynamodb.BatchGetItemInput
+	if c.BatchOp == "read" {
+		get = c.batchGetInput(size, rnd)
+	} else {
+		write = c.batchWriteInput(size, rnd)
+	}
+	pending := size
+	for n := 0; ; n++ {
+		if n > 0 {
+			time.Sleep(c.unprocessedBackoff(n, rnd))
+		}
+		left := 0
+		if get != nil {
+			out, err := db.BatchGetItem(get)
+			if err != nil {
+				r.failed = pending
+				return r, err
+			}
+			if u := out.UnprocessedKeys[c.TableName]; u != nil && len(u.Keys) > 0 {
+				left = len(u.Keys)
+				get = &dynamodb.BatchGetItemInput{RequestItems: out.UnprocessedKeys}
+			}
+		} else {
+			out, err := db.BatchWriteItem(write)
+			if err != nil {
+				r.failed = pending
+				return r, err
+			}
+			if u := out.UnprocessedItems[c.TableName]; len(u) > 0 {
+				left = len(u)
+				write = &dynamodb.BatchWriteItemInput{RequestItems: out.UnprocessedItems}
+			}
+		}
+		if n == 0 {
+			r.unprocessed = left
+		}
+		i := n
+		if i > 2 {
+			i = 2
+		}
+		r.attempts[i] += pending - left
+		pending = left
+		if pending == 0 {
+			return r, nil
+		}
+		if n >= c.UnprocessedRetries {
+			r.failed = pending
+			return r, nil
+		}
+	}
+}
+
+// RunBatchSweep runs BatchWriteItem or BatchGetItem once per batch size, each
+// for -n calls per session (or -duration), at the constant item rate -rate,
+// i.e. -rate/size requests per second, and prints latency, unprocessed items
+// and effective throughput of every size in one table. Unprocessed items are
+// resubmitted with backoff up to -unprocessed-retries times; the latency of a
+// batch includes its resubmissions.
+func (c *DynamoDBBenchmark) RunBatchSweep() error {
+	sizes, err := parseBatchSizes(c.BatchSizes, c.BatchOp)
+	if err != nil {
+		return err
+	}
+	c.clock = NewClock()
+	c.health.SetReady()
+	if c.BatchOp == "write" {
+		c.trackResource(Resource{Kind: resourceItems, Table: c.TableName, Name: c.Id, Count: c.BatchKeys})
+	}
+
+	var levels []BatchSweepLevel
+	for _, size := range sizes {
+		if c.Verbose {
+			fmt.Printf("[Verbose] Sweep level: %d items per batch\n", size)
+		}
+		c.limiter = NewRateLimiter(c.Rate / float64(size))
+		levels = append(levels, c.runBatchSweepLevel(size))
+		if !c.breaker.Allow() {
+			break
+		}
+	}
+	printBatchSweep(c.RunID, c.BatchOp, c.Rate, c.UnprocessedRetries, levels)
+	return nil
+}
+
+func (c *DynamoDBBenchmark) runBatchSweepLevel(size int) BatchSweepLevel {
+	stats := NewStats()
+	stats.Start()
+	if c.Duration > 0 {
+		c.deadline = time.Now().Add(c.Duration)
+	}
+	var mu sync.Mutex
+	level := BatchSweepLevel{BatchSize: size}
+	var sent uint64
+
+	var wg sync.WaitGroup
+	for i := 1; i <= c.Connections; i++ {
+		wg.Add(1)
+		go func(id int, stats *WorkerStats) {
+			defer wg.Done()
+			time.Sleep(c.staggerDelay(id))
+
+			db, err := getDynamoDBClient(c.sessionClientOptions(id))
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+			op := "BatchWriteItem"
+			if c.BatchOp == "read" {
+				op = "BatchGetItem"
+			}
+			for i := 1; c.moreCalls(id, i); i++ {
+				start := c.clock.Now()
+				r, err := c.sendBatch(db, size, rnd)
+				stats.Record(op, start, time.Since(start), size-r.failed, err)
+				atomic.AddUint64(&sent, uint64(size))
+				mu.Lock()
+				level.Unprocessed += uint64(r.unprocessed)
+				level.Failed += uint64(r.failed)
+				for a, n := range r.attempts {
+					level.Attempts[a] += uint64(n)
+				}
+				mu.Unlock()
+				if err != nil && c.Verbose {
+					fmt.Printf("Error: %v\n", err)
+				}
+			}
+		}(i, stats.Worker(i))
+	}
+	wg.Wait()
+	stats.Stop()
+
+	sum := stats.Summary(c.Action)
+	for _, op := range sum.Operations {
+		level.Requests = op.Success + op.Errors
+		level.Errors = op.Errors
+		level.Items = op.Items
+		level.ItemsPerSecond = op.ItemsPerSecond
+		level.AverageMs = op.AverageMs
+		level.P99Ms = op.P99Ms
+	}
+	if sent > 0 {
+		level.UnprocessedRate = float64(level.Unprocessed) / float64(sent)
+	}
+	return level
+}
+
+func printBatchSweep(runID string, op string, rate float64, retries int, levels []BatchSweepLevel) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Summary - batch-sweep (%s, %.1f items/sec, %d retries of unprocessed items)\n", op, rate, retries)
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", runID)
+	fmt.Printf("%10s %10s %8s %10s %12s %17s %10s %10s %10s %8s %10s %12s %10s\n",
+		"batch_size", "requests", "errors", "items", "unprocessed", "unprocessed_rate",
+		"attempt_1", "attempt_2", "attempt_3+", "failed", "items/sec", "average_ms", "p99_ms")
+	for _, l := range levels {
+		fmt.Printf("%10d %10d %8d %10d %12d %16.2f%% %10d %10d %10d %8d %10.2f %12.3f %10.3f\n",
+			l.BatchSize, l.Requests, l.Errors, l.Items, l.Unprocessed, l.UnprocessedRate*100,
+			l.Attempts[0], l.Attempts[1], l.Attempts[2], l.Failed, l.ItemsPerSecond, l.AverageMs, l.P99Ms)
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DynamoDBBenchmark is a benchmark run: the options of the command line (see
+// usageText) and the state the run shares between its sessions. Copies of it
+// run the pools, levels and steps of the sweeps and comparisons.
+type DynamoDBBenchmark struct {
+	Action                 string
+	TableName              string
+	RunID                  string
+	Id                     string
+	Condition              int
+	UpdateTemplate         string
+	UpdateValueSize        int
+	ReturnValues           string
+	Projection             string
+	ExpressionNames        string
+	ConsumedCapacity       bool
+	ItemCollectionMetrics  bool
+	PartitionEstimate      bool
+	TxItems                int
+	Mix                    string
+	SweepMaxKeys           int
+	Sessions               int
+	ReadRatio              float64
+	KeySkew                string
+	SessionSize            int
+	SessionTTL             time.Duration
+	Partitions             int
+	TimeSeriesBatch        int
+	TimeSeriesQuery        string
+	TimeSeriesQueryRatio   float64
+	TimeSeriesPrefill      int
+	SKQuery                string
+	SKItems                int
+	PipelineTable          string
+	DerivedKey             string
+	PipelinePoll           time.Duration
+	PipelineTimeout        time.Duration
+	Limit                  int
+	Collections            int
+	ItemSize               int
+	LSI                    string
+	LSIReadRatio           float64
+	CheckoutItems          int
+	CheckoutProducts       int
+	ProductSkew            string
+	DuplicateRatio         float64
+	Leases                 int
+	LeaseDuration          time.Duration
+	LeaseHold              time.Duration
+	BatchOp                string
+	BatchSizes             string
+	BatchKeys              int
+	ObjectSizes            string
+	ChunkSize              int
+	Storage                string
+	OverflowBucket         string
+	UnprocessedRetries     int
+	UnprocessedBackoff     time.Duration
+	Reset                  bool
+	SeedAge                int
+	SeedStock              int
+	ReserveQty             int
+	Assert                 string
+	SLO                    string
+	EndpointUrl            string
+	EndpointScheme         string
+	FakeFaults             string
+	RoleARNs               string
+	Pools                  string
+	VictimPool             string
+	RoleExternalID         string
+	InsecureSkipVerify     bool
+	CABundle               string
+	EndpointDiscovery      bool
+	ProxyURL               string
+	ProxySplit             bool
+	FIPS                   bool
+	DualStack              bool
+	SigningRegion          string
+	ConnStats              bool
+	LatencyBreakdown       bool
+	Connections            int
+	Stagger                time.Duration
+	PipelineDepth          int
+	BackpressureReport     string
+	Rate                   float64
+	ControlAddr            string
+	ThinkTime              time.Duration
+	ThinkTimeDist          string
+	NumCalls               int
+	TotalCalls             int
+	Duration               time.Duration
+	CheckpointInterval     time.Duration
+	CheckpointFile         string
+	StreamResults          time.Duration
+	RequestLog             string
+	ContentionReport       string
+	ContentionBucket       time.Duration
+	Timeline               string
+	TimelineBucket         time.Duration
+	BackupAt               time.Duration
+	AddIndex               string
+	AddIndexAt             time.Duration
+	StepAt                 time.Duration
+	StepRate               float64
+	ShiftHotkey            time.Duration
+	CacheTTL               time.Duration
+	CacheSize              int
+	OptimisticLock         string
+	VersionAttribute       string
+	PayloadFile            string
+	Compress               string
+	CompressLevel          int
+	Keys                   int
+	IdFile                 string
+	HistoryFile            string
+	HistoryFormat          string
+	CheckLinearizability   bool
+	LinearizabilityTimeout time.Duration
+	SkewReference          string
+	AbortOnErrorRate       float64
+	ErrorRateWindow        time.Duration
+	ErrorRateMinSamples    int
+	ErrorRatePause         time.Duration
+	RetryNum               int
+	DryRun                 bool
+	DryRunRequests         int
+	CompatCheck            bool
+	Check                  bool
+	Calibrate              bool
+	CalibrateStep          time.Duration
+	CalibrationFile        string
+	ConcurrencySweep       string
+	ConcurrencyStep        time.Duration
+	BurstIdle              string
+	BurstStep              time.Duration
+	ProbeCeiling           float64
+	ProbeStart             float64
+	ProbeFactor            float64
+	ProbeStep              time.Duration
+	ProbeThrottleRatio     float64
+	IUnderstandCosts       bool
+	Shards                 string
+	ShardSuffix            string
+	ShardStep              time.Duration
+	Compare                string
+	ComparePrices          string
+	ComparePause           time.Duration
+	TableA                 string
+	TableB                 string
+	ErrorSamples           int
+	SLABuckets             string
+	Timezone               string
+	Verbose                bool
+	TUI                    bool
+	K8sFriendly            bool
+	ResultsDir             string
+	ResultsHistory         string
+	RepeatEvery            time.Duration
+	RepeatCount            int
+	ResultsS3URI           string
+	Sinks                  string
+	HealthAddr             string
+	Cleanup                bool
+
+	deadline   time.Time
+	clock      *Clock
+	breaker    *CircuitBreaker
+	limiter    *RateLimiter
+	control    *Controller
+	history    *History
+	contention *ContentionTracker
+	conns      *ConnStats
+	proxies    *ProxyStats
+	breakdown  *LatencyBreakdown
+	// backpressure follows the lag behind -rate and the calls in flight of
+	// -pipeline-depth.
+	backpressure *Backpressure
+	throttles    *ThrottleCounter
+	timeline     *Timeline
+	// isolation is the timeline of the pool of -victim-pool alone.
+	isolation *Timeline
+	// poolStart is the "start" of the pool the sessions belong to.
+	poolStart time.Duration
+	// shiftStart is when the first hot key of -shift-hotkey became hot.
+	shiftStart time.Time
+	// sessionStats counts the lookups of the session action.
+	sessionStats *SessionStats
+	// series hands out the timestamps of the timeseries action.
+	series *TimeSeries
+	// itemCollections hands out the sort keys of the item-collection action.
+	itemCollections *ItemCollections
+	// pipeline records the lags of the pipeline action.
+	pipeline *PipelineStats
+	// cache is the read-through cache of -cache-ttl.
+	cache *ReadCache
+	// compression compresses the payloads of -payload-file.
+	compression *Compression
+	// lock makes the updates conditional writes of -optimistic-lock.
+	lock *OptimisticLock
+	// collectionSizes follows the item collection sizes DynamoDB returns
+	// with -item-collection-metrics.
+	collectionSizes *CollectionSizes
+	// partitions estimates the partitions of the table with
+	// -partition-estimate.
+	partitions *PartitionEstimator
+	// keyFile is the key population of -id-file.
+	keyFile *KeyFile
+	// shards spreads the item over -shards items.
+	shards *Shards
+	// resultStream is the stdout of -stream-results; everything else is
+	// printed to stderr.
+	resultStream *os.File
+	resources    *ResourceTracker
+	health       *HealthServer
+	// stopped is shared by the copies of the benchmark, e.g. of -pools.
+	stopped *int32
+	// calls counts the calls the sessions started, for the progress bar.
+	calls *uint64
+	stub  bool
+}
+
+func retry(attempts int, sleep time.Duration, f func() error) (err error) {
+	for i := 0; ; i++ {
+		err = f()
+		if err == nil {
+			return
+		}
+
+		if i >= (attempts - 1) {
+			break
+		}
+
+		time.Sleep(sleep)
+		fmt.Printf("retrying after error:%s\n", err)
+	}
+	return fmt.Errorf("after %d attempts, last error: %s", attempts, err)
+}
+
+// clientOptions returns the client options of the first session, which
+// also seeds, checks and reads back the item.
+func (c *DynamoDBBenchmark) clientOptions() ClientOptions {
+	return c.sessionClientOptions(1)
+}
+
+// exit deletes the resources of the run with -cleanup, then exits with code.
+func (c *DynamoDBBenchmark) exit(code int) {
+	if c.Cleanup {
+		if err := c.resources.Cleanup(c.Verbose); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			if code == exitOK {
+				code = exitFailure
+			}
+		}
+	}
+	exit(code)
+}
+
+// trackResource records r as created with every -role-arns entry, since the
+// sessions reach the table in every account.
+func (c *DynamoDBBenchmark) trackResource(r Resource) {
+	chains := c.roleChains()
+	if len(chains) == 0 {
+		c.resources.Track(r)
+		return
+	}
+	for _, chain := range chains {
+		r.RoleChain = chain
+		c.resources.Track(r)
+	}
+}
+
+// sessionClientOptions returns the client options of session id, which
+// assumes the roles of the ((id-1) mod N)-th entry of -role-arns.
+func (c *DynamoDBBenchmark) sessionClientOptions(id int) ClientOptions {
+	opts := ClientOptions{
+		EndpointUrl:        c.EndpointUrl,
+		EndpointScheme:     c.EndpointScheme,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		CABundle:           c.CABundle,
+		ProxyURL:           c.ProxyURL,
+		Direct:             c.sessionDirect(id),
+		Proxies:            c.proxies.Worker(id),
+		EndpointDiscovery:  c.EndpointDiscovery,
+		FIPS:               c.FIPS,
+		DualStack:          c.DualStack,
+		SigningRegion:      c.SigningRegion,
+		RunID:              c.RunID,
+		Stub:               c.stub,
+		RoleExternalID:     c.RoleExternalID,
+		Throttles:          c.throttles,
+		Timeline:           c.timeline,
+		Isolation:          c.isolation,
+		Partitions:         c.partitions,
+	}
+	if chains := c.roleChains(); len(chains) > 0 {
+		opts.RoleChain = chains[(id-1)%len(chains)]
+	}
+	return opts
+}
+
+// roleSummaries breaks the results down by -role-arns entry.
+func (c *DynamoDBBenchmark) roleSummaries(stats *Stats) []RoleSummary {
+	chains := c.roleChains()
+	if len(chains) == 0 {
+		return nil
+	}
+	label := func(id int) string {
+		return strings.Join(chains[(id-1)%len(chains)], ">")
+	}
+	groups := stats.GroupSummaries(c.Action, label)
+	var roles []RoleSummary
+	for i := 1; i <= len(chains) && i <= c.Connections; i++ {
+		sum := groups[label(i)]
+		r := RoleSummary{
+			Role:              label(i),
+			Sessions:          (c.Connections-i)/len(chains) + 1,
+			Success:           sum.Success,
+			Errors:            sum.Errors,
+			RequestsPerSecond: sum.RequestsPerSecond,
+			AverageMs:         sum.AverageMs,
+		}
+		for _, op := range sum.Operations {
+			if op.P99Ms > r.P99Ms {
+				r.P99Ms = op.P99Ms
+			}
+		}
+		roles = append(roles, r)
+	}
+	return roles
+}
+
+// roleChains parses -role-arns: comma separated entries of one or more role
+// ARNs joined by ">".
+func (c *DynamoDBBenchmark) roleChains() [][]string {
+	var chains [][]string
+	for _, entry := range strings.Split(c.RoleARNs, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		var chain []string
+		for _, arn := range strings.Split(entry, ">") {
+			chain = append(chain, strings.TrimSpace(arn))
+		}
+		chains = append(chains, chain)
+	}
+	return chains
+}
+
+// moreCalls reports whether session id should issue its i-th call, either
+// until its share of the calls is done (see sessionCalls) or until the
+// -duration deadline passes. It blocks
+// while the circuit breaker pauses the run and stops when it aborts it, and
+// waits the think time and for the rate limiter between calls. All sessions
+// stop after a termination signal in -k8s-friendly mode.
+func (c *DynamoDBBenchmark) moreCalls(id int, i int) bool {
+	if c.Duration == 0 && i > c.sessionCalls(id) {
+		return false
+	}
+	if i > 1 {
+		time.Sleep(c.thinkTime())
+	}
+	if !c.breaker.Allow() || atomic.LoadInt32(c.stopped) != 0 {
+		return false
+	}
+	c.control.Wait()
+	c.limiter.Wait()
+	if c.Duration > 0 && !time.Now().Before(c.deadline) {
+		return false
+	}
+	atomic.AddUint64(c.calls, 1)
+	return true
+}
+
+// sessionCalls is the number of calls of session id: -n, or its share of
+// -total-calls, the first sessions taking one more call each for the
+// remainder.
+func (c *DynamoDBBenchmark) sessionCalls(id int) int {
+	if c.TotalCalls == 0 {
+		return c.NumCalls
+	}
+	n := c.TotalCalls / c.Connections
+	if id <= c.TotalCalls%c.Connections {
+		n++
+	}
+	return n
+}
+
+// thinkTime returns how long a session idles before its next operation.
+func (c *DynamoDBBenchmark) thinkTime() time.Duration {
+	if c.ThinkTimeDist == "exp" {
+		return time.Duration(rand.ExpFloat64() * float64(c.ThinkTime))
+	}
+	return c.ThinkTime
+}
+
+// staggerDelay returns how long the session with the given id (1-based)
+// waits before sending its first request.
+func (c *DynamoDBBenchmark) staggerDelay(id int) time.Duration {
+	if c.Stagger <= 0 || c.Connections <= 1 {
+		return 0
+	}
+	return c.Stagger * time.Duration(id-1) / time.Duration(c.Connections)
+}
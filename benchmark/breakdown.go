@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+
+	"benchmark/internal/metrics"
+)
+
+// latencyPhases are the parts of a request measured by -latency-breakdown, in
+// the order the SDK runs them. DynamoDB does not report its processing time,
+// so "network" is the whole round trip including the time on the server.
+var latencyPhases = []string{"marshal", "sign", "network", "unmarshal"}
+
+// PhaseSummary is the latency of one phase of the requests of an operation.
+type PhaseSummary struct {
+	Operation string  `json:"operation"`
+	Phase     string  `json:"phase"`
+	Count     uint64  `json:"count"`
+	AverageMs float64 `json:"average_ms"`
+	P50Ms     float64 `json:"p50_ms"`
+	P90Ms     float64 `json:"p90_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+}
+
+type phaseStats struct {
+	count uint64
+	total time.Duration
+	hist  *metrics.Histogram
+}
+
+func (p *phaseStats) record(d time.Duration) {
+	p.count++
+	p.total += d
+	p.hist.Record(d)
+}
+
+func (p *phaseStats) merge(other *phaseStats) {
+	p.count += other.count
+	p.total += other.total
+	p.hist.Merge(other.hist)
+}
+
+// LatencyBreakdown collects the phase latencies of every session of a run.
+// A nil *LatencyBreakdown records nothing.
+type LatencyBreakdown struct {
+	mu      sync.Mutex
+	workers []*WorkerBreakdown
+}
+
+func NewLatencyBreakdown() *LatencyBreakdown {
+	return &LatencyBreakdown{}
+}
+
+// Worker returns a new recorder for one session, or nil on a nil
+// *LatencyBreakdown.
+func (b *LatencyBreakdown) Worker() *WorkerBreakdown {
+	if b == nil {
+		return nil
+	}
+	w := &WorkerBreakdown{phases: map[[2]string]*phaseStats{}}
+	b.mu.Lock()
+	b.workers = append(b.workers, w)
+	b.mu.Unlock()
+	return w
+}
+
+// WorkerBreakdown records the phase latencies of the requests of one
+// session. The handlers run on the goroutine sending the request, and a
+// session sends one request at a time, so only Summary needs the lock.
+type WorkerBreakdown struct {
+	mu     sync.Mutex
+	phases map[[2]string]*phaseStats
+	// start of the phase in progress
+	start time.Time
+}
+
+func (w *WorkerBreakdown) record(op, phase string, d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := [2]string{op, phase}
+	p, ok := w.phases[key]
+	if !ok {
+		p = &phaseStats{hist: metrics.NewHistogram()}
+		w.phases[key] = p
+	}
+	p.record(d)
+}
+
+// AddHandlers times the SDK handler lists of a session: Validate through
+// Build (marshal), Sign, Send (network) and Unmarshal or UnmarshalError.
+// Sign, Send and Unmarshal run again for every retry of the SDK.
+func (w *WorkerBreakdown) AddHandlers(h *request.Handlers) {
+	begin := func(r *request.Request) { w.start = time.Now() }
+	end := func(phase string) func(r *request.Request) {
+		return func(r *request.Request) {
+			w.record(r.Operation.Name, phase, time.Since(w.start))
+		}
+	}
+	h.Validate.PushFrontNamed(request.NamedHandler{Name: "dynamodb-benchmark.MarshalStart", Fn: begin})
+	h.Build.PushBackNamed(request.NamedHandler{Name: "dynamodb-benchmark.MarshalEnd", Fn: end("marshal")})
+	h.Sign.PushFrontNamed(request.NamedHandler{Name: "dynamodb-benchmark.SignStart", Fn: begin})
+	h.Sign.PushBackNamed(request.NamedHandler{Name: "dynamodb-benchmark.SignEnd", Fn: end("sign")})
+	h.Send.PushFrontNamed(request.NamedHandler{Name: "dynamodb-benchmark.SendStart", Fn: begin})
+	h.Send.PushBackNamed(request.NamedHandler{Name: "dynamodb-benchmark.SendEnd", Fn: end("network")})
+	for _, l := range []*request.HandlerList{&h.Unmarshal, &h.UnmarshalError} {
+		l.PushFrontNamed(request.NamedHandler{Name: "dynamodb-benchmark.UnmarshalStart", Fn: begin})
+		l.PushBackNamed(request.NamedHandler{Name: "dynamodb-benchmark.UnmarshalEnd", Fn: end("unmarshal")})
+	}
+}
+
+// Summary merges the sessions into one entry per operation and phase. It
+// returns nil on a nil *LatencyBreakdown.
+func (b *LatencyBreakdown) Summary() []PhaseSummary {
+	if b == nil {
+		return nil
+	}
+	merged := map[[2]string]*phaseStats{}
+	b.mu.Lock()
+	for _, w := range b.workers {
+		w.mu.Lock()
+		for key, p := range w.phases {
+			m, ok := merged[key]
+			if !ok {
+				m = &phaseStats{hist: metrics.NewHistogram()}
+				merged[key] = m
+			}
+			m.merge(p)
+		}
+		w.mu.Unlock()
+	}
+	b.mu.Unlock()
+
+	order := map[string]int{}
+	for i, phase := range latencyPhases {
+		order[phase] = i
+	}
+	keys := make([][2]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return order[keys[i][1]] < order[keys[j][1]]
+	})
+	phases := make([]PhaseSummary, 0, len(keys))
+	for _, key := range keys {
+		p := merged[key]
+		phases = append(phases, PhaseSummary{
+			Operation: key[0],
+			Phase:     key[1],
+			Count:     p.count,
+			AverageMs: averageMs(p.total, p.count),
+			P50Ms:     durationMs(p.hist.Percentile(50)),
+			P90Ms:     durationMs(p.hist.Percentile(90)),
+			P99Ms:     durationMs(p.hist.Percentile(99)),
+		})
+	}
+	return phases
+}
+
+func (p PhaseSummary) String() string {
+	return fmt.Sprintf("[%s %s] count: %d, average (ms): %.3f, p50 (ms): %.3f, p90 (ms): %.3f, p99 (ms): %.3f",
+		p.Operation, p.Phase, p.Count, p.AverageMs, p.P50Ms, p.P90Ms, p.P99Ms)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type breakerBucket struct {
+	second int64
+	total  int
+	errors int
+}
+
+// CircuitBreaker watches the error rate over a sliding window of one-second
+// buckets and, once it exceeds the threshold, either aborts the run or
+// pauses all workers for a cool-down period. A nil *CircuitBreaker never
+// trips, so callers do not need to check whether it is enabled.
+type CircuitBreaker struct {
+	mu          sync.Mutex
+	threshold   float64
+	minSamples  int
+	pause       time.Duration
+	buckets     []breakerBucket
+	pausedUntil time.Time
+	trips       []string
+	aborted     chan struct{}
+}
+
+// NewCircuitBreaker returns a breaker that trips when more than threshold
+// (0-1) of at least minSamples requests within window failed. With pause 0
+// it aborts the run, otherwise it pauses the workers for that long.
+func NewCircuitBreaker(threshold float64, window time.Duration, minSamples int, pause time.Duration) *CircuitBreaker {
+	seconds := int(window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &CircuitBreaker{
+		threshold:  threshold,
+		minSamples: minSamples,
+		pause:      pause,
+		buckets:    make([]breakerBucket, seconds),
+		aborted:    make(chan struct{}),
+	}
+}
+
+// Record adds the outcome of one operation.
+func (b *CircuitBreaker) Record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.isAborted() || time.Now().Before(b.pausedUntil) {
+		return
+	}
+	now := time.Now().Unix()
+	bucket := &b.buckets[now%int64(len(b.buckets))]
+	if bucket.second != now {
+		*bucket = breakerBucket{second: now}
+	}
+	bucket.total++
+	if err != nil {
+		bucket.errors++
+	}
+
+	total, errors := 0, 0
+	oldest := now - int64(len(b.buckets))
+	for _, bk := range b.buckets {
+		if bk.second > oldest {
+			total += bk.total
+			errors += bk.errors
+		}
+	}
+	if total < b.minSamples {
+		return
+	}
+	rate := float64(errors) / float64(total)
+	if rate <= b.threshold {
+		return
+	}
+
+	reason := fmt.Sprintf("error rate %.1f%% (%d/%d) over the last %ds exceeded %.1f%%",
+		rate*100, errors, total, len(b.buckets), b.threshold*100)
+	if b.pause > 0 {
+		b.pausedUntil = time.Now().Add(b.pause)
+		for i := range b.buckets {
+			b.buckets[i] = breakerBucket{}
+		}
+		reason += fmt.Sprintf("; paused for %v", b.pause)
+		fmt.Printf("[WARN] Circuit breaker tripped: %s\n", reason)
+	} else {
+		close(b.aborted)
+		reason += "; run aborted"
+		fmt.Printf("[ERROR] Circuit breaker tripped: %s\n", reason)
+	}
+	b.trips = append(b.trips, fmt.Sprintf("%s: %s", formatTime(time.Now(), time.RFC3339), reason))
+}
+
+func (b *CircuitBreaker) isAborted() bool {
+	select {
+	case <-b.aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Allow blocks while the breaker is pausing the run and reports whether the
+// worker may send its next request.
+func (b *CircuitBreaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	wait := time.Until(b.pausedUntil)
+	b.mu.Unlock()
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-b.aborted:
+		}
+	}
+	return !b.isAborted()
+}
+
+// Trips returns the reasons the breaker tripped, in order.
+func (b *CircuitBreaker) Trips() []string {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.trips...)
+}
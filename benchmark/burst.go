@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// burstBucket is the width of the timeline buckets a -burst-idle step is
+// split at its first throttle with.
+const burstBucket = 100 * time.Millisecond
+
+// BurstLevel is the outcome of one step of load after an idle period of
+// -burst-idle.
+type BurstLevel struct {
+	IdleSec   float64 `json:"idle_sec"`
+	Requests  uint64  `json:"requests"`
+	Errors    uint64  `json:"errors"`
+	Throttles uint64  `json:"throttles"`
+	// SustainedSec is the time from the start of the step to the first
+	// throttled attempt, -1 if the step was never throttled.
+	SustainedSec float64 `json:"sustained_sec"`
+	// BurstRequests were sent before the first throttle, at
+	// BurstRequestsPerSec; ThrottledRequestsPerSec is the rate after it.
+	BurstRequests           uint64  `json:"burst_requests"`
+	BurstRequestsPerSec     float64 `json:"burst_requests_per_sec"`
+	ThrottledRequestsPerSec float64 `json:"throttled_requests_per_sec"`
+	// ExcessUnits is the capacity BurstRequests consumed beyond the
+	// provisioned capacity of the table, at one unit per request: an
+	// estimate of the burst capacity accumulated while idle. Not set for
+	// on-demand tables.
+	ExcessUnits float64 `json:"excess_units,omitempty"`
+	P99Ms       float64 `json:"p99_ms"`
+}
+
+// parseBurstIdle parses -burst-idle: comma separated idle durations, e.g.
+// "0s,1m,2m,5m".
+func parseBurstIdle(spec string) ([]time.Duration, error) {
+	var idles []time.Duration
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		d, err := time.ParseDuration(entry)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("%q is not a duration of 0 or more", entry)
+		}
+		idles = append(idles, d)
+	}
+	if len(idles) == 0 {
+		return nil, fmt.Errorf("no idle durations")
+	}
+	return idles, nil
+}
+
+// RunBurstSweep idles for every duration of -burst-idle, so that the table
+// accumulates burst capacity, then runs the read or write workload as a
+// step of -burst-step, and prints how long every step was sustained before
+// DynamoDB throttled it, i.e. the burst capacity vs idle time curve.
+func (c *DynamoDBBenchmark) RunBurstSweep() error {
+	idles, err := parseBurstIdle(c.BurstIdle)
+	if err != nil {
+		return err
+	}
+	db, err := getDynamoDBClient(c.clientOptions())
+	if err != nil {
+		return err
+	}
+	desc, mode, _, _, err := billing(db, c.TableName)
+	if err != nil {
+		return fmt.Errorf("failed to describe table %s: %v", c.TableName, err)
+	}
+	var provisioned int64
+	if mode == "provisioned" && desc.ProvisionedThroughput != nil {
+		provisioned = aws.Int64Value(desc.ProvisionedThroughput.WriteCapacityUnits)
+		if c.Action == "read" {
+			provisioned = aws.Int64Value(desc.ProvisionedThroughput.ReadCapacityUnits)
+		}
+	}
+	if c.Reset {
+		if err := c.resetItem(); err != nil {
+			return err
+		}
+	}
+	c.health.SetReady()
+
+	var results []BurstLevel
+	for _, idle := range idles {
+		if c.Verbose {
+			fmt.Printf("[Verbose] Burst sweep: idle for %s\n", idle)
+		}
+		for end := time.Now().Add(idle); time.Now().Before(end); time.Sleep(100 * time.Millisecond) {
+			if atomic.LoadInt32(c.stopped) != 0 {
+				break
+			}
+		}
+		if atomic.LoadInt32(c.stopped) != 0 {
+			break
+		}
+		results = append(results, c.burstLevel(idle, provisioned))
+	}
+	printBurstSweep(c.RunID, c.Action, c.BurstStep, mode, provisioned, results)
+	return nil
+}
+
+// burstLevel runs one step of the workload after idle with a fresh copy of
+// the benchmark and splits it at its first throttle.
+func (c *DynamoDBBenchmark) burstLevel(idle time.Duration, provisioned int64) BurstLevel {
+	step := c.sweepStep(c.BurstStep)
+	step.timeline = NewTimeline(time.Now(), burstBucket)
+	level, _ := step.runLevel(c.Connections)
+	b := BurstLevel{
+		IdleSec:      idle.Seconds(),
+		Requests:     level.Requests,
+		Errors:       level.Errors,
+		Throttles:    level.Throttles,
+		SustainedSec: -1,
+		P99Ms:        level.P99Ms,
+	}
+	onset := step.throttles.Onset()
+	if onset < 0 {
+		b.BurstRequests = level.Requests
+		b.BurstRequestsPerSec = level.RequestsPerSecond
+		return b
+	}
+	onset = onset.Truncate(burstBucket)
+	b.SustainedSec = onset.Seconds()
+	before, after := step.timeline.Window(0, onset), step.timeline.Window(onset, -1)
+	b.BurstRequests = before.Requests
+	b.BurstRequestsPerSec = before.RequestsPerSecond
+	b.ThrottledRequestsPerSec = after.RequestsPerSecond
+	if provisioned > 0 {
+		if excess := float64(b.BurstRequests) - float64(provisioned)*b.SustainedSec; excess > 0 {
+			b.ExcessUnits = excess
+		}
+	}
+	return b
+}
+
+func printBurstSweep(runID string, action string, step time.Duration, mode string, provisioned int64, levels []BurstLevel) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Burst Sweep - %s (%s per step)\n", action, step)
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", runID)
+	if mode == "provisioned" {
+		fmt.Printf("Table: provisioned, %d capacity units for %s\n", provisioned, action)
+	} else {
+		fmt.Printf("Table: %s, no excess capacity estimate\n", mode)
+	}
+	fmt.Printf("%10s %10s %8s %10s %12s %15s %12s %16s %13s %9s\n",
+		"idle", "requests", "errors", "throttles", "sustained_s", "burst_requests", "burst_req/s", "throttled_req/s", "excess_units", "p99_ms")
+	var maxSustained float64
+	for _, l := range levels {
+		sustained := "-"
+		if l.SustainedSec >= 0 {
+			sustained = fmt.Sprintf("%.1f", l.SustainedSec)
+		}
+		fmt.Printf("%10s %10d %8d %10d %12s %15d %12.1f %16.1f %13.0f %9.3f\n",
+			time.Duration(l.IdleSec*float64(time.Second)), l.Requests, l.Errors, l.Throttles, sustained,
+			l.BurstRequests, l.BurstRequestsPerSec, l.ThrottledRequestsPerSec, l.ExcessUnits, l.P99Ms)
+		if l.SustainedSec > maxSustained {
+			maxSustained = l.SustainedSec
+		}
+	}
+	fmt.Println()
+	fmt.Println("Burst sustained (s) before the first throttle by idle time (- never throttled)")
+	for _, l := range levels {
+		if l.SustainedSec < 0 {
+			fmt.Printf("%8s | -\n", time.Duration(l.IdleSec*float64(time.Second)))
+			continue
+		}
+		fmt.Printf("%8s | %s %.1f\n", time.Duration(l.IdleSec*float64(time.Second)), bar(l.SustainedSec, maxSustained, concurrencyChartWidth), l.SustainedSec)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// cacheHitOp is the operation the reads served by -cache-ttl are recorded
+// as; the reads which miss it stay "GetItem".
+const cacheHitOp = "GetItem[cache hit]"
+
+// CacheSummary is the outcome of the read-through cache of -cache-ttl: how
+// many reads it served and what they would have cost DynamoDB.
+type CacheSummary struct {
+	TTLSec    float64 `json:"ttl_sec"`
+	Size      int     `json:"size"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	HitRate   float64 `json:"hit_rate"`
+	Expired   uint64  `json:"expired"`
+	Evicted   uint64  `json:"evicted"`
+	Entries   int     `json:"entries"`
+	ReadUnits float64 `json:"read_units"`
+	// ReadUnitsSaved is the read capacity the hits would have consumed,
+	// at the average of the misses.
+	ReadUnitsSaved float64 `json:"read_units_saved"`
+	HitAverageMs   float64 `json:"hit_average_ms"`
+	MissAverageMs  float64 `json:"miss_average_ms"`
+	// AverageMs is the average latency of all reads, hits and misses, and
+	// LatencySaved its reduction from MissAverageMs, the average without
+	// the cache.
+	AverageMs    float64 `json:"average_ms"`
+	LatencySaved float64 `json:"latency_saved"`
+}
+
+func (s *CacheSummary) String() string {
+	return fmt.Sprintf("TTL %s, size %d: hits %d, misses %d, hit rate %.2f%%, expired %d, evicted %d; read units %.1f, saved %.1f; average (ms) hit %.3f, miss %.3f, all %.3f (%.2f%% lower)",
+		time.Duration(s.TTLSec*float64(time.Second)), s.Size, s.Hits, s.Misses, 100*s.HitRate, s.Expired, s.Evicted,
+		s.ReadUnits, s.ReadUnitsSaved, s.HitAverageMs, s.MissAverageMs, s.AverageMs, 100*s.LatencySaved)
+}
+
+type cacheEntry struct {
+	key     string
+	item    map[string]*dynamodb.AttributeValue
+	expires time.Time
+}
+
+// ReadCache is an in-process read-through cache of the items read, shared by
+// all sessions like the cache of one application instance: up to size items,
+// each for ttl after it was read, the least recently used evicted first. A
+// nil *ReadCache caches nothing.
+type ReadCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+
+	hits, misses     uint64
+	expired, evicted uint64
+	// reads and units are the successful reads of the misses and the read
+	// units they consumed.
+	reads uint64
+	units float64
+}
+
+func NewReadCache(ttl time.Duration, size int) *ReadCache {
+	return &ReadCache{ttl: ttl, size: size, entries: map[string]*list.Element{}, lru: list.New()}
+}
+
+// cacheKey is the key of the cache entry of the item of key.
+func cacheKey(key map[string]*dynamodb.AttributeValue) string {
+	return string(wireJSON(key))
+}
+
+// Get returns the cached item of key and counts the hit or the miss.
+func (rc *ReadCache) Get(key string) (map[string]*dynamodb.AttributeValue, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	e, ok := rc.entries[key]
+	if ok && time.Now().After(e.Value.(*cacheEntry).expires) {
+		rc.lru.Remove(e)
+		delete(rc.entries, key)
+		rc.expired++
+		ok = false
+	}
+	if !ok {
+		rc.misses++
+		return nil, false
+	}
+	rc.hits++
+	rc.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).item, true
+}
+
+// Put caches the item read on a miss, along with the read units the read
+// consumed: the ConsumedCapacity returned, or with it not asked for the
+// eventually consistent read of an item of its size.
+func (rc *ReadCache) Put(key string, out *dynamodb.GetItemOutput) {
+	units := math.Ceil(float64(len(wireJSON(out.Item)))/4096) / 2
+	if out.ConsumedCapacity != nil {
+		units = aws.Float64Value(out.ConsumedCapacity.CapacityUnits)
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.reads++
+	rc.units += units
+	entry := &cacheEntry{key: key, item: out.Item, expires: time.Now().Add(rc.ttl)}
+	if e, ok := rc.entries[key]; ok {
+		e.Value = entry
+		rc.lru.MoveToFront(e)
+		return
+	}
+	rc.entries[key] = rc.lru.PushFront(entry)
+	if rc.lru.Len() > rc.size {
+		oldest := rc.lru.Back()
+		rc.lru.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cacheEntry).key)
+		rc.evicted++
+	}
+}
+
+// Summary returns the outcome of the cache, with the latencies of the hits
+// and misses taken from ops.
+func (rc *ReadCache) Summary(ops []OpSummary) *CacheSummary {
+	if rc == nil {
+		return nil
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	s := &CacheSummary{
+		TTLSec:    rc.ttl.Seconds(),
+		Size:      rc.size,
+		Hits:      rc.hits,
+		Misses:    rc.misses,
+		HitRate:   ratio(rc.hits, rc.hits+rc.misses),
+		Expired:   rc.expired,
+		Evicted:   rc.evicted,
+		Entries:   rc.lru.Len(),
+		ReadUnits: rc.units,
+	}
+	if rc.reads > 0 {
+		s.ReadUnitsSaved = rc.units / float64(rc.reads) * float64(rc.hits)
+	}
+	var hits, misses uint64
+	for _, op := range ops {
+		switch op.Operation {
+		case cacheHitOp:
+			s.HitAverageMs, hits = op.AverageMs, op.Success
+		case "GetItem":
+			s.MissAverageMs, misses = op.AverageMs, op.Success
+		}
+	}
+	if hits+misses > 0 {
+		s.AverageMs = (s.HitAverageMs*float64(hits) + s.MissAverageMs*float64(misses)) / float64(hits+misses)
+	}
+	if s.MissAverageMs > 0 {
+		s.LatencySaved = 1 - s.AverageMs/s.MissAverageMs
+	}
+	return s
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// calibrationHeadroom is the fraction of the calibrated ceiling above
+	// which a run is likely limited by the host rather than by DynamoDB.
+	calibrationHeadroom = 0.7
+	// calibrationMaxSessions bounds the ramp of -calibrate.
+	calibrationMaxSessions = 1024
+)
+
+// CalibrationLevel is the throughput reached with one number of sessions.
+type CalibrationLevel struct {
+	Sessions          int     `json:"sessions"`
+	RequestsPerSecond float64 `json:"requests_per_sec"`
+	P99Ms             float64 `json:"p99_ms"`
+	CPUUtilization    float64 `json:"cpu_utilization"`
+}
+
+// Calibration is the highest request rate this host generated for an action.
+type Calibration struct {
+	Host                 string             `json:"host"`
+	Action               string             `json:"action"`
+	Endpoint             string             `json:"endpoint"`
+	GOMAXPROCS           int                `json:"gomaxprocs"`
+	Time                 time.Time          `json:"time"`
+	MaxRequestsPerSecond float64            `json:"max_requests_per_sec"`
+	Sessions             int                `json:"sessions"`
+	Levels               []CalibrationLevel `json:"levels"`
+}
+
+// calibrationFile returns -calibration-file or the default file in the user
+// cache directory.
+func (c *DynamoDBBenchmark) calibrationFile() string {
+	if c.CalibrationFile != "" {
+		return c.CalibrationFile
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "dynamodb-benchmark", "calibration.json")
+}
+
+// loadCalibrations reads the calibrations by action. A missing file is not an
+// error.
+func loadCalibrations(path string) (map[string]Calibration, error) {
+	cals := map[string]Calibration{}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cals, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &cals); err != nil {
+		return nil, fmt.Errorf("invalid calibration file %s: %v", path, err)
+	}
+	return cals, nil
+}
+
+func saveCalibration(path string, cal Calibration) error {
+	cals, err := loadCalibrations(path)
+	if err != nil {
+		return err
+	}
+	cals[cal.Action] = cal
+	b, err := json.MarshalIndent(cals, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// hostCalibration returns the calibration of the action made on this host,
+// if any. Errors only produce a verbose message since the calibration is
+// advisory.
+func (c *DynamoDBBenchmark) hostCalibration() *Calibration {
+	cals, err := loadCalibrations(c.calibrationFile())
+	if err != nil {
+		if c.Verbose {
+			fmt.Printf("[Verbose] Ignoring calibration: %v\n", err)
+		}
+		return nil
+	}
+	cal, ok := cals[c.Action]
+	host, _ := os.Hostname()
+	if !ok || cal.Host != host || cal.MaxRequestsPerSecond <= 0 {
+		return nil
+	}
+	return &cal
+}
+
+// warnRate warns when the request rate is close to the calibrated ceiling of
+// the host, i.e. the client and not DynamoDB may limit the run.
+func warnRate(cal *Calibration, what string, rate float64) {
+	if cal == nil || rate <= calibrationHeadroom*cal.MaxRequestsPerSecond {
+		return
+	}
+	fmt.Printf("[WARN] %s %.1f requests/sec is %.0f%% of the %.1f requests/sec this host generated in its calibration (%s); the load generator may be saturated and latencies overstated\n",
+		what, rate, rate/cal.MaxRequestsPerSecond*100, cal.MaxRequestsPerSecond, formatTime(cal.Time, time.RFC3339))
+}
+
+// stubResponse answers UpdateItem and GetItem with a canned item so that
+// -calibrate measures the client only.
+func stubResponse(id string) http.HandlerFunc {
+	item := fmt.Sprintf(`{"id":{"S":%q},"age":{"N":"1"}}`, id)
+	update := []byte(`{"Attributes":` + item + `}`)
+	get := []byte(`{"Item":` + item + `}`)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if strings.HasSuffix(r.Header.Get("X-Amz-Target"), ".GetItem") {
+			w.Write(get)
+			return
+		}
+		w.Write(update)
+	}
+}
+
+// RunCalibrate ramps the configured read or write workload against an
+// in-process stub endpoint (or -endpoint-url, e.g. DynamoDB Local), doubling
+// the sessions every -calibrate-step until the throughput stops growing, and
+// stores the highest rate in the calibration file. Runs then warn when their
+// rate exceeds 70% of it. The stub shares the host with the client, so the
+// ceiling is rather on the low side.
+func (c *DynamoDBBenchmark) RunCalibrate() error {
+	endpoint := c.EndpointUrl
+	stub := endpoint == ""
+	if stub {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return fmt.Errorf("failed to start the stub endpoint: %v", err)
+		}
+		server := &http.Server{Handler: stubResponse(c.Id)}
+		go server.Serve(l)
+		defer server.Close()
+		endpoint = "http://" + l.Addr().String()
+	}
+	c.health.SetReady()
+
+	host, _ := os.Hostname()
+	cal := Calibration{
+		Host:       host,
+		Action:     c.Action,
+		Endpoint:   c.EndpointUrl,
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Time:       time.Now().UTC(),
+	}
+	if stub {
+		cal.Endpoint = "stub"
+	}
+	flat := 0
+	for sessions := 1; sessions <= calibrationMaxSessions && flat < 2; sessions *= 2 {
+		level := c.calibrationLevel(endpoint, stub, sessions)
+		if c.Verbose {
+			fmt.Printf("[Verbose] Calibration: %d sessions, %.1f requests/sec\n", sessions, level.RequestsPerSecond)
+		}
+		cal.Levels = append(cal.Levels, level)
+		// Stop after two doublings that gained less than 5%.
+		if level.RequestsPerSecond > cal.MaxRequestsPerSecond*1.05 {
+			flat = 0
+		} else {
+			flat++
+		}
+		if level.RequestsPerSecond > cal.MaxRequestsPerSecond {
+			cal.MaxRequestsPerSecond = level.RequestsPerSecond
+			cal.Sessions = sessions
+		}
+	}
+
+	path := c.calibrationFile()
+	if err := saveCalibration(path, cal); err != nil {
+		return fmt.Errorf("failed to save calibration: %v", err)
+	}
+	printCalibration(cal, path)
+	return nil
+}
+
+// calibrationLevel runs the workload with the given number of sessions for
+// -calibrate-step without rate limit, history or any other extra.
+func (c *DynamoDBBenchmark) calibrationLevel(endpoint string, stub bool, sessions int) CalibrationLevel {
+	step := *c
+	step.EndpointUrl = endpoint
+	step.stub = stub
+	step.Connections = sessions
+	step.Duration = c.CalibrateStep
+	step.Stagger = 0
+	step.ThinkTime = 0
+	step.Verbose = false
+	step.clock = NewClock()
+	step.breaker = nil
+	step.limiter = nil
+	step.control = nil
+	step.history = nil
+	step.contention = nil
+
+	stats := NewStats()
+	monitor := NewRuntimeMonitor(time.Second)
+	stats.Start()
+	monitor.Start()
+	step.deadline = time.Now().Add(step.Duration)
+	var wg sync.WaitGroup
+	for i := 1; i <= sessions; i++ {
+		wg.Add(1)
+		if c.Action == "read" {
+			go step.startReadWorker(i, &wg, stats.Worker(i))
+		} else {
+			go step.startWriteWorker(i, &wg, stats.Worker(i))
+		}
+	}
+	wg.Wait()
+	stats.Stop()
+	rt := monitor.Stop()
+
+	sum := stats.Summary(c.Action)
+	level := CalibrationLevel{
+		Sessions:          sessions,
+		RequestsPerSecond: perSecond(sum.Success, sum.DurationSec),
+		CPUUtilization:    rt.CPUUtilization,
+	}
+	for _, op := range sum.Operations {
+		level.P99Ms = op.P99Ms
+	}
+	return level
+}
+
+func printCalibration(cal Calibration, path string) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Calibration - %s (endpoint %s, %d cores)\n", cal.Action, cal.Endpoint, cal.GOMAXPROCS)
+	fmt.Println("-----------------------")
+	fmt.Printf("%10s %18s %10s %10s\n", "sessions", "requests/sec", "p99_ms", "cpu")
+	for _, l := range cal.Levels {
+		fmt.Printf("%10d %18.1f %10.3f %9.0f%%\n", l.Sessions, l.RequestsPerSecond, l.P99Ms, l.CPUUtilization*100)
+	}
+	fmt.Printf("Ceiling: %.1f requests/sec with %d sessions; runs warn above %.1f requests/sec\n",
+		cal.MaxRequestsPerSecond, cal.Sessions, calibrationHeadroom*cal.MaxRequestsPerSecond)
+	fmt.Printf("Saved to %s\n", path)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// CapacitySummary is the capacity consumed by the successful requests of an
+// operation, as reported by ReturnConsumedCapacity INDEXES. TableUnits is
+// the consumption of the base table alone; every global and local secondary
+// index an update touches adds its own to TotalUnits.
+type CapacitySummary struct {
+	Responses       uint64             `json:"responses"`
+	TotalUnits      float64            `json:"total_units"`
+	TableUnits      float64            `json:"table_units"`
+	IndexUnits      map[string]float64 `json:"index_units,omitempty"`
+	UnitsPerRequest float64            `json:"units_per_request"`
+	// BaseRatio is TableUnits/TotalUnits, and Amplification its inverse:
+	// the true cost of a write relative to the base table alone.
+	BaseRatio     float64 `json:"base_ratio"`
+	Amplification float64 `json:"amplification"`
+}
+
+// capacityStats accumulates ConsumedCapacity of successful requests.
+type capacityStats struct {
+	responses uint64
+	total     float64
+	table     float64
+	indexes   map[string]float64
+}
+
+func (s *capacityStats) record(cc *dynamodb.ConsumedCapacity) {
+	s.responses++
+	s.total += aws.Float64Value(cc.CapacityUnits)
+	if cc.Table != nil {
+		s.table += aws.Float64Value(cc.Table.CapacityUnits)
+	} else {
+		// TOTAL instead of INDEXES, or a table without indexes
+		s.table += aws.Float64Value(cc.CapacityUnits)
+	}
+	if s.indexes == nil {
+		s.indexes = map[string]float64{}
+	}
+	for _, indexes := range []map[string]*dynamodb.Capacity{cc.GlobalSecondaryIndexes, cc.LocalSecondaryIndexes} {
+		for name, c := range indexes {
+			s.indexes[name] += aws.Float64Value(c.CapacityUnits)
+		}
+	}
+}
+
+func (s *capacityStats) merge(other *capacityStats) {
+	if other == nil {
+		return
+	}
+	s.responses += other.responses
+	s.total += other.total
+	s.table += other.table
+	for name, units := range other.indexes {
+		if s.indexes == nil {
+			s.indexes = map[string]float64{}
+		}
+		s.indexes[name] += units
+	}
+}
+
+// summary returns nil when no capacity was reported.
+func (s *capacityStats) summary() *CapacitySummary {
+	if s == nil || s.responses == 0 {
+		return nil
+	}
+	sum := &CapacitySummary{
+		Responses:  s.responses,
+		TotalUnits: s.total,
+		TableUnits: s.table,
+	}
+	if len(s.indexes) > 0 {
+		sum.IndexUnits = map[string]float64{}
+		for name, units := range s.indexes {
+			sum.IndexUnits[name] = units
+		}
+	}
+	sum.finish()
+	return sum
+}
+
+// finish computes the derived ratios from the totals.
+func (c *CapacitySummary) finish() {
+	c.UnitsPerRequest = 0
+	c.BaseRatio = 0
+	c.Amplification = 0
+	if c.Responses > 0 {
+		c.UnitsPerRequest = c.TotalUnits / float64(c.Responses)
+	}
+	if c.TotalUnits > 0 {
+		c.BaseRatio = c.TableUnits / c.TotalUnits
+	}
+	if c.TableUnits > 0 {
+		c.Amplification = c.TotalUnits / c.TableUnits
+	}
+}
+
+// add merges the summary of another process into c.
+func (c *CapacitySummary) add(other *CapacitySummary) {
+	c.Responses += other.Responses
+	c.TotalUnits += other.TotalUnits
+	c.TableUnits += other.TableUnits
+	for name, units := range other.IndexUnits {
+		if c.IndexUnits == nil {
+			c.IndexUnits = map[string]float64{}
+		}
+		c.IndexUnits[name] += units
+	}
+	c.finish()
+}
+
+func (c *CapacitySummary) String() string {
+	s := fmt.Sprintf("total %.1f (%.2f per request), table %.1f", c.TotalUnits, c.UnitsPerRequest, c.TableUnits)
+	if len(c.IndexUnits) > 0 {
+		names := make([]string, 0, len(c.IndexUnits))
+		for name := range c.IndexUnits {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		indexes := make([]string, len(names))
+		for i, name := range names {
+			indexes[i] = fmt.Sprintf("%s %.1f", name, c.IndexUnits[name])
+		}
+		s += ", indexes: " + strings.Join(indexes, ", ")
+	}
+	return s + fmt.Sprintf("; base/total %.2f, amplification %.2fx", c.BaseRatio, c.Amplification)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"benchmark/internal/awsclient"
+)
+
+type CheckResult struct {
+	Name   string
+	Passed bool
+	Detail string
+	// Hint tells how to fix a failed check.
+	Hint string
+}
+
+// RunCheck validates the environment the configured workload needs:
+// credentials, the table being ACTIVE, its key schema and the seed item.
+// Every check runs even if an earlier one fails, unless it depends on it.
+func (c *DynamoDBBenchmark) RunCheck() ([]CheckResult, error) {
+	var results []CheckResult
+	add := func(r CheckResult) {
+		results = append(results, r)
+	}
+
+	opts := c.clientOptions().aws()
+	sess, err := awsclient.NewSession(opts)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := opts.Config()
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.RoleChain) > 0 {
+		cfg.WithCredentials(opts.AssumeRoles(sess))
+	}
+	db := opts.NewDynamoDB(sess, cfg)
+
+	// Every session must be able to assume its roles.
+	for i, chain := range c.roleChains() {
+		r := CheckResult{Name: "Assume role " + strings.Join(chain, " > "), Hint: "check the trust policy of the role and -role-external-id"}
+		out, err := sts.New(sess, &aws.Config{Credentials: c.sessionClientOptions(i + 1).aws().AssumeRoles(sess)}).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		if err != nil {
+			r.Detail = err.Error()
+		} else {
+			r.Passed = true
+			r.Detail = aws.StringValue(out.Arn)
+		}
+		add(r)
+	}
+
+	if len(c.roleChains()) == 0 {
+		creds := CheckResult{Name: "Credentials", Hint: "check AWS_PROFILE / AWS_ACCESS_KEY_ID or your shared config"}
+		if c.EndpointUrl == fakeEndpoint {
+			creds.Passed = true
+			creds.Detail = "not needed by the fake endpoint"
+		} else if c.EndpointUrl != "" {
+			// Local and compatible endpoints accept any credentials, so only
+			// check that the SDK can resolve some.
+			if v, err := sess.Config.Credentials.Get(); err != nil {
+				creds.Detail = err.Error()
+			} else {
+				creds.Passed = true
+				creds.Detail = "resolved from " + v.ProviderName
+			}
+		} else {
+			out, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+			if err != nil {
+				creds.Detail = err.Error()
+			} else {
+				creds.Passed = true
+				creds.Detail = aws.StringValue(out.Arn)
+			}
+		}
+		add(creds)
+	}
+
+	table := CheckResult{Name: "Table exists and is ACTIVE", Hint: "create it with: go run . admin -a create-table -table " + c.TableName}
+	desc, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(c.TableName)})
+	if err != nil {
+		table.Detail = err.Error()
+		add(table)
+		return results, nil
+	}
+	status := aws.StringValue(desc.Table.TableStatus)
+	table.Passed = status == dynamodb.TableStatusActive
+	table.Detail = "status " + status
+	if !table.Passed {
+		table.Hint = "wait until the table is ACTIVE"
+	}
+	add(table)
+
+	add(c.checkKeySchema(desc.Table))
+
+	// The sweeps create their items as they go.
+	if c.Action == "tx-sweep" || c.Action == "batch-sweep" {
+		return results, nil
+	}
+
+	seed := CheckResult{Name: "Seed item exists", Hint: "create it with: go run . admin -a create-item -table " + c.TableName + " -id " + c.Id}
+	out, err := db.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(c.TableName),
+		Key:            map[string]*dynamodb.AttributeValue{"id": {S: aws.String(c.Id)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	switch {
+	case err != nil:
+		seed.Detail = err.Error()
+	case out.Item == nil:
+		seed.Detail = fmt.Sprintf("no item with id %q", c.Id)
+	default:
+		seed.Passed = true
+		seed.Detail = fmt.Sprintf("id %q found", c.Id)
+	}
+	add(seed)
+
+	if seed.Passed && c.Action == "write" {
+		add(c.checkAge(out.Item))
+	}
+	return results, nil
+}
+
+// checkKeySchema verifies the table is keyed by the string attribute "id"
+// only, which is what the single-key workloads address.
+func (c *DynamoDBBenchmark) checkKeySchema(t *dynamodb.TableDescription) CheckResult {
+	r := CheckResult{Name: "Key schema matches workload", Hint: "the workload needs a table with the partition key \"id\" (S) and no sort key"}
+	types := map[string]string{}
+	for _, def := range t.AttributeDefinitions {
+		types[aws.StringValue(def.AttributeName)] = aws.StringValue(def.AttributeType)
+	}
+	var schema string
+	hashOK, hasRange := false, false
+	for _, k := range t.KeySchema {
+		name := aws.StringValue(k.AttributeName)
+		schema += fmt.Sprintf("%s %s (%s) ", aws.StringValue(k.KeyType), name, types[name])
+		switch aws.StringValue(k.KeyType) {
+		case dynamodb.KeyTypeHash:
+			hashOK = name == "id" && types[name] == dynamodb.ScalarAttributeTypeS
+		case dynamodb.KeyTypeRange:
+			hasRange = true
+		}
+	}
+	r.Passed = hashOK && !hasRange
+	r.Detail = strings.TrimSpace(schema)
+	return r
+}
+
+// checkAge verifies the write workload can update the seed item: "age" must
+// be a number and, with -condition, still below the maximum.
+func (c *DynamoDBBenchmark) checkAge(item map[string]*dynamodb.AttributeValue) CheckResult {
+	r := CheckResult{Name: "Seed item can be updated", Hint: "reset the item with: go run . admin -a create-item -table " + c.TableName + " -id " + c.Id}
+	age, ok := item["age"]
+	if !ok || age.N == nil {
+		r.Detail = "attribute \"age\" is missing or not a number"
+		return r
+	}
+	r.Detail = "age " + *age.N
+	if c.Condition > 0 {
+		v, err := strconv.ParseFloat(*age.N, 64)
+		if err != nil || v >= float64(c.Condition) {
+			r.Detail += fmt.Sprintf(" is not below -condition %d, every update will fail", c.Condition)
+			return r
+		}
+	}
+	r.Passed = true
+	return r
+}
+
+// printCheckResults prints the results and reports whether all checks passed.
+func printCheckResults(results []CheckResult) bool {
+	fmt.Println("-----------------------")
+	fmt.Println("DynamoDB Benchmark Pre-flight Check")
+	fmt.Println("-----------------------")
+	ok := true
+	for _, r := range results {
+		status := "PASS"
+		if !r.Passed {
+			status = "FAIL"
+			ok = false
+		}
+		fmt.Printf("[%s] %s: %s\n", status, r.Name, r.Detail)
+		if !r.Passed && r.Hint != "" {
+			fmt.Printf("       hint: %s\n", r.Hint)
+		}
+	}
+	return ok
+}
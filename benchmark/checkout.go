@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// checkoutTrackEvery is how many orders are placed between two updates of
+// the run file of -cleanup (see ResourceTracker).
+const checkoutTrackEvery = 1000
+
+func (c *DynamoDBBenchmark) productKey(k int) string {
+	return c.Id + "-product-" + strconv.Itoa(k)
+}
+
+// orderPrefix is the key prefix of the orders of the run, "<prefix>-<n>".
+func (c *DynamoDBBenchmark) orderPrefix() string {
+	return c.Id + "-order-" + c.RunID
+}
+
+// pickProducts returns CheckoutItems distinct products. Under a steep skew
+// the same products come up again and again, so after a while the rest is
+// filled with the most popular products not picked yet.
+func (c *DynamoDBBenchmark) pickProducts(pick func() int) []int {
+	picked := map[int]bool{}
+	var products []int
+	for tries := 0; len(products) < c.CheckoutItems && tries < 100*c.CheckoutItems; tries++ {
+		if k := pick(); !picked[k] {
+			picked[k] = true
+			products = append(products, k)
+		}
+	}
+	for k := 1; len(products) < c.CheckoutItems; k++ {
+		if !picked[k] {
+			picked[k] = true
+			products = append(products, k)
+		}
+	}
+	return products
+}
+
+// checkoutInput takes -reserve-qty of every product from its stock on the
+// condition that enough is left, and puts the order.
+func (c *DynamoDBBenchmark) checkoutInput(products []int, order string) *dynamodb.TransactWriteItemsInput {
+	qty := &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(c.ReserveQty))}
+	input := &dynamodb.TransactWriteItemsInput{}
+	var lines []*dynamodb.AttributeValue
+	for _, k := range products {
+		input.TransactItems = append(input.TransactItems, &dynamodb.TransactWriteItem{
+			Update: &dynamodb.Update{
+				TableName: &c.TableName,
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {S: aws.String(c.productKey(k))},
+				},
+				UpdateExpression:          aws.String("set stock = stock - :qty"),
+				ConditionExpression:       aws.String("stock >= :qty"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":qty": qty},
+			},
+		})
+		lines = append(lines, &dynamodb.AttributeValue{S: aws.String(c.productKey(k))})
+	}
+	input.TransactItems = append(input.TransactItems, &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName: &c.TableName,
+			Item: map[string]*dynamodb.AttributeValue{
+				"id":       {S: aws.String(order)},
+				"products": {L: lines},
+				"qty":      qty,
+				"run_id":   {S: aws.String(c.RunID)},
+				"created":  {S: aws.String(time.Now().UTC().Format(time.RFC3339Nano))},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		},
+	})
+	return input
+}
+
+// seedProducts (re)creates the products with -seed-stock in stock.
+func (c *DynamoDBBenchmark) seedProducts() error {
+	db, err := getDynamoDBClient(c.clientOptions())
+	if err != nil {
+		return err
+	}
+	c.trackResource(Resource{Kind: resourceItems, Table: c.TableName, Name: c.Id + "-product", Count: c.CheckoutProducts})
+	err = c.putItems(db, c.CheckoutProducts, func(k int) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{
+			"id":    {S: aws.String(c.productKey(k))},
+			"stock": {N: aws.String(strconv.Itoa(c.SeedStock))},
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to seed the products: %v", err)
+	}
+	if c.Verbose {
+		fmt.Printf("[Verbose] Seeded %d products with stock %d\n", c.CheckoutProducts, c.SeedStock)
+	}
+	return nil
+}
+
+// CheckoutResult is the outcome of the checkout action.
+type CheckoutResult struct {
+	RunID      string  `json:"run_id"`
+	Requests   uint64  `json:"requests"`
+	Orders     uint64  `json:"orders"`
+	Conflicts  uint64  `json:"conflicts"`
+	OutOfStock uint64  `json:"out_of_stock"`
+	Throttles  uint64  `json:"throttles"`
+	Other      uint64  `json:"other_errors"`
+	OrdersPerS float64 `json:"orders_per_sec"`
+	AverageMs  float64 `json:"average_ms"`
+	P50Ms      float64 `json:"p50_ms"`
+	P99Ms      float64 `json:"p99_ms"`
+	// Hottest are the products picked most often.
+	Hottest []ProductStats `json:"hottest_products"`
+}
+
+// ProductStats counts the checkouts of one product and why they failed.
+type ProductStats struct {
+	Key        string `json:"key"`
+	Picked     uint64 `json:"picked"`
+	Conflicts  uint64 `json:"conflicts"`
+	OutOfStock uint64 `json:"out_of_stock"`
+}
+
+type checkoutCounters struct {
+	mu       sync.Mutex
+	products map[int]*ProductStats
+}
+
+// record counts the products of one transaction and, from the cancellation
+// reasons, which of them conflicted or were out of stock.
+func (cc *checkoutCounters) record(c *DynamoDBBenchmark, products []int, err error) {
+	var reasons []*dynamodb.CancellationReason
+	if tce, ok := err.(*dynamodb.TransactionCanceledException); ok {
+		reasons = tce.CancellationReasons
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	for i, k := range products {
+		p, ok := cc.products[k]
+		if !ok {
+			p = &ProductStats{Key: c.productKey(k)}
+			cc.products[k] = p
+		}
+		p.Picked++
+		if i >= len(reasons) {
+			continue
+		}
+		switch aws.StringValue(reasons[i].Code) {
+		case "TransactionConflict":
+			p.Conflicts++
+		case "ConditionalCheckFailed":
+			p.OutOfStock++
+		}
+	}
+}
+
+// isOutOfStock tells whether a checkout was cancelled because a product
+// condition failed.
+func isOutOfStock(err error) bool {
+	tce, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok {
+		return false
+	}
+	// The last item is the order, whose condition only fails on a
+	// duplicate order id.
+	for _, r := range tce.CancellationReasons[:len(tce.CancellationReasons)-1] {
+		if aws.StringValue(r.Code) == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+	return false
+}
+
+// RunCheckout places orders of -checkout-items products each, picked from
+// -checkout-products products by -product-skew, for -n calls per session (or
+// -duration). Every order is one transaction which takes -reserve-qty of
+// each product from its stock and puts the order item. Transactions are not
+// retried, every attempt is a sample.
+func (c *DynamoDBBenchmark) RunCheckout() error {
+	skew, err := parseKeySkew(c.ProductSkew)
+	if err != nil {
+		return err
+	}
+	c.clock = NewClock()
+	c.limiter = NewRateLimiter(c.Rate)
+	if c.Reset {
+		if err := c.seedProducts(); err != nil {
+			return err
+		}
+	}
+	c.health.SetReady()
+
+	stats := NewStats()
+	stats.Start()
+	if c.Duration > 0 {
+		c.deadline = time.Now().Add(c.Duration)
+	}
+	counters := &checkoutCounters{products: map[int]*ProductStats{}}
+	var orders, conflicts, outOfStock, throttles uint64
+	var sequence int64
+	track := func(n int64) {
+		c.trackResource(Resource{Kind: resourceItems, Table: c.TableName, Name: c.orderPrefix(), Count: int(n)})
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i <= c.Connections; i++ {
+		wg.Add(1)
+		go func(id int, stats *WorkerStats) {
+			defer wg.Done()
+			time.Sleep(c.staggerDelay(id))
+
+			db, err := getDynamoDBClient(c.sessionClientOptions(id))
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+			pick := skew.picker(rnd, c.CheckoutProducts)
+			for i := 1; c.moreCalls(id, i); i++ {
+				products := c.pickProducts(pick)
+				n := atomic.AddInt64(&sequence, 1)
+				if n%checkoutTrackEvery == 1 {
+					track(n + checkoutTrackEvery - 1)
+				}
+				param := c.checkoutInput(products, c.orderPrefix()+"-"+strconv.FormatInt(n, 10))
+				start := c.clock.Now()
+				_, err := db.TransactWriteItems(param)
+				stats.Record("TransactWriteItems", start, time.Since(start), len(param.TransactItems), err)
+				counters.record(c, products, err)
+				switch {
+				case err == nil:
+					atomic.AddUint64(&orders, 1)
+				case isConflict(err):
+					atomic.AddUint64(&conflicts, 1)
+				case isOutOfStock(err):
+					atomic.AddUint64(&outOfStock, 1)
+				case isThrottle(err):
+					atomic.AddUint64(&throttles, 1)
+				default:
+					if c.Verbose {
+						fmt.Printf("Error: %v\n", err)
+					}
+				}
+			}
+		}(i, stats.Worker(i))
+	}
+	wg.Wait()
+	stats.Stop()
+	// Only the orders placed need cleaning up, but their numbers are not
+	// contiguous; cover all of them.
+	track(atomic.LoadInt64(&sequence))
+
+	summary := stats.Summary(c.Action)
+	result := CheckoutResult{
+		RunID:      c.RunID,
+		Orders:     orders,
+		Conflicts:  conflicts,
+		OutOfStock: outOfStock,
+		Throttles:  throttles,
+	}
+	for _, op := range summary.Operations {
+		result.Requests = op.Success + op.Errors
+		result.OrdersPerS = perSecond(orders, op.DurationSec)
+		result.AverageMs = op.AverageMs
+		result.P50Ms = op.P50Ms
+		result.P99Ms = op.P99Ms
+	}
+	result.Other = result.Requests - orders - conflicts - outOfStock - throttles
+	for _, p := range counters.products {
+		result.Hottest = append(result.Hottest, *p)
+	}
+	sort.Slice(result.Hottest, func(i, j int) bool {
+		if result.Hottest[i].Picked != result.Hottest[j].Picked {
+			return result.Hottest[i].Picked > result.Hottest[j].Picked
+		}
+		return result.Hottest[i].Key < result.Hottest[j].Key
+	})
+	if len(result.Hottest) > 5 {
+		result.Hottest = result.Hottest[:5]
+	}
+	printCheckout(c, result)
+	return nil
+}
+
+func printCheckout(c *DynamoDBBenchmark, r CheckoutResult) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Summary - checkout (%d of %d products per order, skew %s)\n",
+		c.CheckoutItems, c.CheckoutProducts, c.ProductSkew)
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", r.RunID)
+	fmt.Printf("Checkouts: %d, orders: %d (%.2f%%), conflicts: %d (%.2f%%), out of stock: %d (%.2f%%), throttles: %d, other errors: %d\n",
+		r.Requests, r.Orders, ratio(r.Orders, r.Requests)*100, r.Conflicts, ratio(r.Conflicts, r.Requests)*100,
+		r.OutOfStock, ratio(r.OutOfStock, r.Requests)*100, r.Throttles, r.Other)
+	fmt.Printf("Orders/sec: %.2f, average (ms): %.3f, p50 (ms): %.3f, p99 (ms): %.3f\n", r.OrdersPerS, r.AverageMs, r.P50Ms, r.P99Ms)
+	fmt.Printf("%-40s %10s %10s %12s\n", "hottest products", "picked", "conflicts", "out_of_stock")
+	for _, p := range r.Hottest {
+		fmt.Printf("%-40s %10d %10d %12d\n", p.Key, p.Picked, p.Conflicts, p.OutOfStock)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Checkpoint is one line of the checkpoint file: the statistics of the
+// interval since the previous checkpoint and the running totals.
+type Checkpoint struct {
+	RunID    string    `json:"run_id"`
+	Time     time.Time `json:"time"`
+	Seq      int       `json:"seq"`
+	Final    bool      `json:"final"`
+	Interval Summary   `json:"interval"`
+	Total    Summary   `json:"total"`
+}
+
+// Checkpointer periodically appends interval statistics to a newline
+// delimited JSON file so that long soak runs keep their results even if the
+// process dies before printing the summary. With -stream-results it writes
+// them to stdout instead.
+type Checkpointer struct {
+	action   string
+	runID    string
+	interval time.Duration
+	stats    *Stats
+	clock    *Clock
+	file     *os.File
+	// stream is set when file is the stdout of -stream-results, which is
+	// neither synced nor closed.
+	stream  bool
+	seq     int
+	verbose bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewCheckpointer(path string, interval time.Duration, action string, runID string, stats *Stats, clock *Clock, verbose bool) (*Checkpointer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint file: %v", err)
+	}
+	return &Checkpointer{
+		action:   action,
+		runID:    runID,
+		interval: interval,
+		stats:    stats,
+		clock:    clock,
+		file:     f,
+		verbose:  verbose,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// NewResultStream returns a Checkpointer writing the statistics of every
+// interval to out, the stdout of -stream-results.
+func NewResultStream(out *os.File, interval time.Duration, action string, runID string, stats *Stats, clock *Clock) *Checkpointer {
+	return &Checkpointer{
+		action:   action,
+		runID:    runID,
+		interval: interval,
+		stats:    stats,
+		clock:    clock,
+		file:     out,
+		stream:   true,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (cp *Checkpointer) write(final bool) {
+	cp.seq++
+	record := Checkpoint{
+		RunID:    cp.runID,
+		Time:     cp.clock.Now().In(outputLocation),
+		Seq:      cp.seq,
+		Final:    final,
+		Interval: cp.stats.IntervalSummary(cp.action),
+		Total:    cp.stats.Summary(cp.action),
+	}
+	b, err := json.Marshal(record)
+	if err == nil {
+		_, err = cp.file.Write(append(b, '\n'))
+	}
+	if err == nil && !cp.stream {
+		// Make sure the checkpoint survives a crash right after it.
+		err = cp.file.Sync()
+	}
+	if err != nil {
+		fmt.Printf("Error: failed to write checkpoint: %v\n", err)
+		return
+	}
+	if cp.verbose {
+		fmt.Printf("[Verbose] Checkpoint %d: %d sent, %d errors, %.2f requests/sec in the last %.0f sec\n",
+			record.Seq, record.Interval.Success, record.Interval.Errors, record.Interval.RequestsPerSecond, record.Interval.DurationSec)
+	}
+}
+
+// Start writes a checkpoint every interval until Stop is called.
+func (cp *Checkpointer) Start() {
+	go func() {
+		defer close(cp.done)
+		ticker := time.NewTicker(cp.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cp.write(false)
+			case <-cp.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop writes the final, possibly partial, interval and closes the file.
+func (cp *Checkpointer) Stop() error {
+	close(cp.stop)
+	<-cp.done
+	cp.write(true)
+	if cp.stream {
+		return nil
+	}
+	return cp.file.Close()
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// chunkSortKey is the numeric sort key of the chunks of an object.
+const chunkSortKey = "seq"
+
+// chunkTrackEvery is how many objects are handed out between two updates of
+// the run file of -cleanup (see ResourceTracker).
+const chunkTrackEvery = 100
+
+// maxChunkSize is the largest -chunk-size, leaving room in the 400 KB item
+// for the key and the other attributes of a chunk.
+const maxChunkSize = 390000
+
+// parseObjectSizes parses -object-sizes: comma separated sizes in bytes with
+// an optional KB or MB suffix (1024 based), e.g. "100KB,1MB,4MB".
+func parseObjectSizes(spec string) ([]int, error) {
+	var sizes []int
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.ToUpper(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		unit := 1
+		if strings.HasSuffix(entry, "KB") {
+			entry, unit = strings.TrimSuffix(entry, "KB"), 1024
+		} else if strings.HasSuffix(entry, "MB") {
+			entry, unit = strings.TrimSuffix(entry, "MB"), 1024*1024
+		}
+		n, err := strconv.Atoi(entry)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%q is not a size of 1 byte or more", entry)
+		}
+		sizes = append(sizes, n*unit)
+	}
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("no object sizes")
+	}
+	return sizes, nil
+}
+
+// formatBytes formats n with the largest unit of parseObjectSizes it is a
+// multiple of.
+func formatBytes(n int) string {
+	switch {
+	case n%(1024*1024) == 0:
+		return strconv.Itoa(n/(1024*1024)) + "MB"
+	case n%1024 == 0:
+		return strconv.Itoa(n/1024) + "KB"
+	}
+	return strconv.Itoa(n)
+}
+
+// chunkPrefix is the partition key prefix of the objects of chunk-sweep,
+// "<prefix>-<n>".
+func (c *DynamoDBBenchmark) chunkPrefix() string {
+	return c.Id + "-chunk-" + c.RunID
+}
+
+// chunkItems splits object into the items of -chunk-size bytes stored under
+// the partition key key, "seq" = 1, 2, ..., each with the number of chunks
+// and the size of the object so that a reader can tell it got all of them.
+func (c *DynamoDBBenchmark) chunkItems(key string, object []byte) []map[string]*dynamodb.AttributeValue {
+	n := (len(object) + c.ChunkSize - 1) / c.ChunkSize
+	items := make([]map[string]*dynamodb.AttributeValue, 0, n)
+	for i := 0; i < n; i++ {
+		end := (i + 1) * c.ChunkSize
+		if end > len(object) {
+			end = len(object)
+		}
+		items = append(items, map[string]*dynamodb.AttributeValue{
+			"id":         {S: aws.String(key)},
+			chunkSortKey: {N: aws.String(strconv.Itoa(i + 1))},
+			"data":       {B: object[i*c.ChunkSize : end]},
+			"chunks":     {N: aws.String(strconv.Itoa(n))},
+			"size":       {N: aws.String(strconv.Itoa(len(object)))},
+		})
+	}
+	return items
+}
+
+// putChunks writes the chunks with BatchWriteItem, maxBatchWriteItems at a
+// time, resubmitting the unprocessed ones up to -unprocessed-retries times.
+func (c *DynamoDBBenchmark) putChunks(db *dynamodb.DynamoDB, items []map[string]*dynamodb.AttributeValue, rnd *rand.Rand) error {
+	for start := 0; start < len(items); start += maxBatchWriteItems {
+		end := start + maxBatchWriteItems
+		if end > len(items) {
+			end = len(items)
+		}
+		var requests []*dynamodb.WriteRequest
+		for _, item := range items[start:end] {
+			requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item}})
+		}
+		input := &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{c.TableName: requests}}
+		for n := 0; ; n++ {
+			if n > 0 {
+				time.Sleep(c.unprocessedBackoff(n, rnd))
+			}
+			out, err := db.BatchWriteItem(input)
+			if err != nil {
+				return err
+			}
+			left := out.UnprocessedItems[c.TableName]
+			if len(left) == 0 {
+				break
+			}
+			if n >= c.UnprocessedRetries {
+				return fmt.Errorf("%d chunks still unprocessed after %d resubmissions", len(left), n)
+			}
+			input = &dynamodb.BatchWriteItemInput{RequestItems: out.UnprocessedItems}
+		}
+	}
+	return nil
+}
+
+// getObject reads the chunks of the object key with a consistent Query,
+// following LastEvaluatedKey, and reassembles it. It returns the object and
+// the number of pages read.
+func (c *DynamoDBBenchmark) getObject(db *dynamodb.DynamoDB, key string) ([]byte, int, error) {
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(c.TableName),
+		KeyConditionExpression:    aws.String("id = :id"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":id": {S: aws.String(key)}},
+		ConsistentRead:            aws.Bool(true),
+	}
+	var chunks []map[string]*dynamodb.AttributeValue
+	pages := 0
+	for {
+		out, err := db.Query(input)
+		if err != nil {
+			return nil, pages, err
+		}
+		pages++
+		chunks = append(chunks, out.Items...)
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+	if len(chunks) == 0 {
+		return nil, pages, fmt.Errorf("no chunks of object %s", key)
+	}
+	n, _ := strconv.Atoi(aws.StringValue(chunks[0]["chunks"].N))
+	size, _ := strconv.Atoi(aws.StringValue(chunks[0]["size"].N))
+	if len(chunks) != n {
+		return nil, pages, fmt.Errorf("object %s: %d of %d chunks", key, len(chunks), n)
+	}
+	object := make([]byte, 0, size)
+	for i, chunk := range chunks {
+		// The chunks come in the order of the sort key.
+		if seq := aws.StringValue(chunk[chunkSortKey].N); seq != strconv.Itoa(i+1) {
+			return nil, pages, fmt.Errorf("object %s: chunk %s where %d was expected", key, seq, i+1)
+		}
+		object = append(object, chunk["data"].B...)
+	}
+	if len(object) != size {
+		return nil, pages, fmt.Errorf("object %s: %d of %d bytes", key, len(object), size)
+	}
+	return object, pages, nil
+}
+
+// ChunkSweepLevel is the outcome of the objects of one size and storage.
+type ChunkSweepLevel struct {
+	ObjectBytes int    `json:"object_bytes"`
+	Storage     string `json:"storage"`
+	Chunks      int    `json:"chunks"`
+	Writes      uint64 `json:"writes"`
+	WriteErrors uint64 `json:"write_errors"`
+	Reads       uint64 `json:"reads"`
+	ReadErrors  uint64 `json:"read_errors"`
+	// Corrupt counts the objects read back complete but different from
+	// those written.
+	Corrupt      uint64  `json:"corrupt"`
+	PagesPerRead float64 `json:"pages_per_read"`
+	// WriteMBPerSec and ReadMBPerSec are the object bytes written and read
+	// back successfully per second spent writing and reading: the summed
+	// latency of the operation over the sessions, since every session
+	// alternates a write and a read for the whole level.
+	WriteMBPerSec  float64 `json:"write_mb_per_sec"`
+	ReadMBPerSec   float64 `json:"read_mb_per_sec"`
+	WriteAverageMs float64 `json:"write_average_ms"`
+	WriteP99Ms     float64 `json:"write_p99_ms"`
+	// Reassembly is the latency of reading all chunks of an object and
+	// putting it back together, or with -storage s3 of reading the pointer
+	// item and then the object.
+	ReassemblyAverageMs float64 `json:"reassembly_average_ms"`
+	ReassemblyP50Ms     float64 `json:"reassembly_p50_ms"`
+	ReassemblyP99Ms     float64 `json:"reassembly_p99_ms"`
+	// With -storage s3, the average latencies of the parts of a write and a
+	// read: the S3 request and the one of the pointer item.
+	S3PutAverageMs      float64 `json:"s3_put_average_ms,omitempty"`
+	PointerPutAverageMs float64 `json:"pointer_put_average_ms,omitempty"`
+	PointerGetAverageMs float64 `json:"pointer_get_average_ms,omitempty"`
+	S3GetAverageMs      float64 `json:"s3_get_average_ms,omitempty"`
+}
+
+// RunChunkSweep writes objects of every size of -object-sizes, larger than
+// the 400 KB item limit, as chunks of -chunk-size under one partition key
+// each, -n objects per session (or -duration) per size, at -rate objects
+// per second, reads every object back with a Query and reassembles it, and
+// prints the throughput and the reassembly latency of every size in one
+// table. With -storage s3 every size is also stored the other way, the
+// object in S3 and a pointer item in the table, for comparison.
+func (c *DynamoDBBenchmark) RunChunkSweep() error {
+	sizes, err := parseObjectSizes(c.ObjectSizes)
+	if err != nil {
+		return err
+	}
+	storages, err := parseStorages(c.Storage)
+	if err != nil {
+		return err
+	}
+	db, err := getDynamoDBClient(c.clientOptions())
+	if err != nil {
+		return err
+	}
+	if err := c.checkSortKeyTable(db, "chunk-sweep", chunkSortKey, dynamodb.ScalarAttributeTypeN); err != nil {
+		return err
+	}
+	c.clock = NewClock()
+	c.limiter = NewRateLimiter(c.Rate)
+	var store overflowStore
+	for _, s := range storages {
+		if s == "s3" && store == nil {
+			if store, err = c.newOverflowStore(); err != nil {
+				return err
+			}
+		}
+	}
+	c.health.SetReady()
+
+	var seq int64
+	var levels []ChunkSweepLevel
+sweep:
+	for _, size := range sizes {
+		for _, storage := range storages {
+			if c.Verbose {
+				fmt.Printf("[Verbose] Sweep level: objects of %s in %s\n", formatBytes(size), storage)
+			}
+			levels = append(levels, c.runChunkSweepLevel(size, storage, store, &seq))
+			if !c.breaker.Allow() || atomic.LoadInt32(c.stopped) != 0 {
+				break sweep
+			}
+		}
+	}
+	printChunkSweep(c.RunID, c.ChunkSize, c.Rate, levels)
+	return nil
+}
+
+func (c *DynamoDBBenchmark) runChunkSweepLevel(size int, storage string, store overflowStore, seq *int64) ChunkSweepLevel {
+	stats := NewStats()
+	stats.Start()
+	if c.Duration > 0 {
+		c.deadline = time.Now().Add(c.Duration)
+	}
+	var mu sync.Mutex
+	level := ChunkSweepLevel{ObjectBytes: size, Storage: storage, Chunks: (size + c.ChunkSize - 1) / c.ChunkSize}
+	if storage == "s3" {
+		level.Chunks = 0
+	}
+	var pages uint64
+
+	var wg sync.WaitGroup
+	for i := 1; i <= c.Connections; i++ {
+		wg.Add(1)
+		go func(id int, stats *WorkerStats) {
+			defer wg.Done()
+			time.Sleep(c.staggerDelay(id))
+
+			db, err := getDynamoDBClient(c.sessionClientOptions(id))
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+			object := make([]byte, size)
+			rnd.Read(object)
+			for i := 1; c.moreCalls(id, i); i++ {
+				n := atomic.AddInt64(seq, 1)
+				if n%chunkTrackEvery == 1 {
+					c.trackResource(Resource{Kind: resourcePartitions, Table: c.TableName, Name: c.chunkPrefix(), Count: int(n + chunkTrackEvery - 1), SortKey: chunkSortKey})
+				}
+				key := c.chunkPrefix() + "-" + strconv.FormatInt(n, 10)
+				if storage == "s3" {
+					c.overflowObject(db, store, key, object, stats, &mu, &level)
+					continue
+				}
+				items := c.chunkItems(key, object)
+
+				start := c.clock.Now()
+				err := c.putChunks(db, items, rnd)
+				stats.Record("PutObject", start, time.Since(start), len(items), err)
+				if err != nil {
+					if c.Verbose {
+						fmt.Printf("Error: %v\n", err)
+					}
+					continue
+				}
+
+				start = c.clock.Now()
+				read, p, err := c.getObject(db, key)
+				stats.Record("GetObject", start, time.Since(start), len(items), err)
+				atomic.AddUint64(&pages, uint64(p))
+				if err == nil && !bytes.Equal(read, object) {
+					mu.Lock()
+					level.Corrupt++
+					mu.Unlock()
+				}
+				if err != nil && c.Verbose {
+					fmt.Printf("Error: %v\n", err)
+				}
+			}
+		}(i, stats.Worker(i))
+	}
+	wg.Wait()
+	stats.Stop()
+
+	sum := stats.Summary(c.Action)
+	for _, op := range sum.Operations {
+		var mbPerSec float64
+		if active := op.AverageMs * float64(op.Success+op.Errors) / 1000 / float64(c.Connections); active > 0 {
+			mbPerSec = float64(op.Success) * float64(size) / (1024 * 1024) / active
+		}
+		switch op.Operation {
+		case "PutObject":
+			level.Writes = op.Success
+			level.WriteErrors = op.Errors
+			level.WriteMBPerSec = mbPerSec
+			level.WriteAverageMs = op.AverageMs
+			level.WriteP99Ms = op.P99Ms
+		case "GetObject":
+			level.Reads = op.Success
+			level.ReadErrors = op.Errors
+			level.ReadMBPerSec = mbPerSec
+			level.ReassemblyAverageMs = op.AverageMs
+			level.ReassemblyP50Ms = op.P50Ms
+			level.ReassemblyP99Ms = op.P99Ms
+		case "S3:PutObject":
+			level.S3PutAverageMs = op.AverageMs
+		case "PutItem[pointer]":
+			level.PointerPutAverageMs = op.AverageMs
+		case "GetItem[pointer]":
+			level.PointerGetAverageMs = op.AverageMs
+		case "S3:GetObject":
+			level.S3GetAverageMs = op.AverageMs
+		}
+	}
+	level.PagesPerRead = ratio(pages, level.Reads+level.ReadErrors)
+	return level
+}
+
+// overflowObject writes object to S3 with its pointer item and reads it
+// back, recording the whole write and read as "PutObject" and "GetObject"
+// like the chunks and every request on its own.
+func (c *DynamoDBBenchmark) overflowObject(db *dynamodb.DynamoDB, store overflowStore, key string, object []byte, stats *WorkerStats, mu *sync.Mutex, level *ChunkSweepLevel) {
+	start := c.clock.Now()
+	upload, pointer, err := c.putOverflow(db, store, key, object)
+	stats.Record("PutObject", start, upload+pointer, 1, err)
+	if pointer > 0 {
+		stats.Record("S3:PutObject", start, upload, 1, nil)
+		stats.Record("PutItem[pointer]", start.Add(upload), pointer, 1, err)
+	} else {
+		stats.Record("S3:PutObject", start, upload, 1, err)
+	}
+	if err != nil {
+		if c.Verbose {
+			fmt.Printf("Error: %v\n", err)
+		}
+		return
+	}
+
+	start = c.clock.Now()
+	read, pointer, download, err := c.getOverflow(db, store, key)
+	stats.Record("GetObject", start, pointer+download, 1, err)
+	if download > 0 {
+		stats.Record("GetItem[pointer]", start, pointer, 1, nil)
+		stats.Record("S3:GetObject", start.Add(pointer), download, 1, err)
+	} else {
+		stats.Record("GetItem[pointer]", start, pointer, 1, err)
+	}
+	if err == nil && !bytes.Equal(read, object) {
+		mu.Lock()
+		level.Corrupt++
+		mu.Unlock()
+	}
+	if err != nil && c.Verbose {
+		fmt.Printf("Error: %v\n", err)
+	}
+}
+
+func printChunkSweep(runID string, chunkSize int, rate float64, levels []ChunkSweepLevel) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Summary - chunk-sweep (chunks of %d bytes, %.1f objects/sec)\n", chunkSize, rate)
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", runID)
+	fmt.Printf("%8s %7s %7s %8s %10s %8s %10s %8s %11s %8s %11s %14s %13s %15s %14s %14s\n",
+		"object", "storage", "chunks", "writes", "write_errs", "reads", "read_errs", "corrupt", "pages/read",
+		"write_MB/s", "read_MB/s", "write_avg_ms", "write_p99_ms", "reassembly_avg", "reassembly_p50", "reassembly_p99")
+	for _, l := range levels {
+		chunks := "-"
+		if l.Storage != "s3" {
+			chunks = strconv.Itoa(l.Chunks)
+		}
+		fmt.Printf("%8s %7s %7s %8d %10d %8d %10d %8d %11.2f %8.2f %11.2f %14.3f %13.3f %15.3f %14.3f %14.3f\n",
+			formatBytes(l.ObjectBytes), l.Storage, chunks, l.Writes, l.WriteErrors, l.Reads, l.ReadErrors, l.Corrupt, l.PagesPerRead,
+			l.WriteMBPerSec, l.ReadMBPerSec, l.WriteAverageMs, l.WriteP99Ms, l.ReassemblyAverageMs, l.ReassemblyP50Ms, l.ReassemblyP99Ms)
+	}
+	for _, l := range levels {
+		if l.Storage == "s3" {
+			fmt.Printf("s3 %s: write = S3 PutObject %.3f ms + PutItem[pointer] %.3f ms, read = GetItem[pointer] %.3f ms + S3 GetObject %.3f ms (averages)\n",
+				formatBytes(l.ObjectBytes), l.S3PutAverageMs, l.PointerPutAverageMs, l.PointerGetAverageMs, l.S3GetAverageMs)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// claimTrackEvery is how many keys are handed out between two updates of
+// the run file of -cleanup (see ResourceTracker).
+const claimTrackEvery = 1000
+
+// claimPrefix is the key prefix of the claims of the run, "<prefix>-<n>".
+func (c *DynamoDBBenchmark) claimPrefix() string {
+	return c.Id + "-claim-" + c.RunID
+}
+
+// OutcomeLatency is the latency of the requests with one outcome, e.g.
+// "PutItem[conflict]" of claim.
+type OutcomeLatency struct {
+	Outcome   string  `json:"outcome"`
+	Requests  uint64  `json:"requests"`
+	AverageMs float64 `json:"average_ms"`
+	P50Ms     float64 `json:"p50_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+}
+
+// outcomeLatencies lists the operations of sum as outcomes.
+func outcomeLatencies(sum Summary) []OutcomeLatency {
+	var outcomes []OutcomeLatency
+	for _, op := range sum.Operations {
+		outcomes = append(outcomes, OutcomeLatency{
+			Outcome:   op.Operation,
+			Requests:  op.Success + op.Errors,
+			AverageMs: op.AverageMs,
+			P50Ms:     op.P50Ms,
+			P99Ms:     op.P99Ms,
+		})
+	}
+	return outcomes
+}
+
+func printOutcomeLatencies(outcomes []OutcomeLatency) {
+	fmt.Printf("%-24s %10s %12s %10s %10s\n", "outcome", "requests", "average_ms", "p50_ms", "p99_ms")
+	for _, o := range outcomes {
+		fmt.Printf("%-24s %10d %12.3f %10.3f %10.3f\n", o.Outcome, o.Requests, o.AverageMs, o.P50Ms, o.P99Ms)
+	}
+}
+
+// ClaimResult is the outcome of the claim action.
+type ClaimResult struct {
+	RunID      string  `json:"run_id"`
+	Requests   uint64  `json:"requests"`
+	Claimed    uint64  `json:"claimed"`
+	Conflicts  uint64  `json:"conflicts"`
+	Errors     uint64  `json:"errors"`
+	ClaimRatio float64 `json:"claim_ratio"`
+	ClaimsPerS float64 `json:"claims_per_sec"`
+	// Fresh counts the attempts on keys not tried before, of which
+	// FreshRejected failed the condition: a duplicate got there first, or an
+	// attempt retried by the SDK after a lost response had been written.
+	Fresh         uint64 `json:"fresh"`
+	FreshRejected uint64 `json:"fresh_rejected"`
+	// Duplicates counts the attempts on keys tried before, of which
+	// DuplicatesClaimed succeeded because the earlier claim had not been
+	// written yet.
+	Duplicates        uint64           `json:"duplicates"`
+	DuplicatesClaimed uint64           `json:"duplicates_claimed"`
+	Outcomes          []OutcomeLatency `json:"outcomes"`
+}
+
+// RunClaim models a distributed lock or unique registration, -n calls per
+// session (or -duration): each call is a PutItem of a key
+// "<id>-claim-<run id>-<n>" on the condition attribute_not_exists(id). For
+// -duplicate-ratio of the calls the key is one handed out before, otherwise
+// the next one. The summary compares the claims won with the condition
+// failures, and their latencies.
+func (c *DynamoDBBenchmark) RunClaim() error {
+	c.clock = NewClock()
+	c.limiter = NewRateLimiter(c.Rate)
+	c.health.SetReady()
+
+	stats := NewStats()
+	stats.Start()
+	if c.Duration > 0 {
+		c.deadline = time.Now().Add(c.Duration)
+	}
+	var claimed, conflicts, errors uint64
+	var fresh, freshRejected, duplicates, duplicatesClaimed uint64
+	var sequence int64
+	track := func(n int64) {
+		c.trackResource(Resource{Kind: resourceItems, Table: c.TableName, Name: c.claimPrefix(), Count: int(n)})
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i <= c.Connections; i++ {
+		wg.Add(1)
+		go func(id int, stats *WorkerStats) {
+			defer wg.Done()
+			time.Sleep(c.staggerDelay(id))
+
+			db, err := getDynamoDBClient(c.sessionClientOptions(id))
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+			for i := 1; c.moreCalls(id, i); i++ {
+				var n int64
+				duplicate := false
+				if handedOut := atomic.LoadInt64(&sequence); handedOut > 0 && rnd.Float64() < c.DuplicateRatio {
+					n, duplicate = 1+rnd.Int63n(handedOut), true
+				} else {
+					n = atomic.AddInt64(&sequence, 1)
+					if n%claimTrackEvery == 1 {
+						track(n + claimTrackEvery - 1)
+					}
+				}
+				start := c.clock.Now()
+				_, err := db.PutItem(&dynamodb.PutItemInput{
+					TableName: aws.String(c.TableName),
+					Item: map[string]*dynamodb.AttributeValue{
+						"id":      {S: aws.String(c.claimPrefix() + "-" + strconv.FormatInt(n, 10))},
+						"owner":   {N: aws.String(strconv.Itoa(id))},
+						"run_id":  {S: aws.String(c.RunID)},
+						"claimed": {S: aws.String(time.Now().UTC().Format(time.RFC3339Nano))},
+					},
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				})
+				elapsed := time.Since(start)
+				if duplicate {
+					atomic.AddUint64(&duplicates, 1)
+				} else {
+					atomic.AddUint64(&fresh, 1)
+				}
+				switch {
+				case err == nil:
+					stats.Record("PutItem[claimed]", start, elapsed, 1, nil)
+					atomic.AddUint64(&claimed, 1)
+					if duplicate {
+						atomic.AddUint64(&duplicatesClaimed, 1)
+					}
+				case isConditionalCheckFailed(err):
+					stats.Record("PutItem[conflict]", start, elapsed, 1, nil)
+					atomic.AddUint64(&conflicts, 1)
+					if !duplicate {
+						atomic.AddUint64(&freshRejected, 1)
+					}
+				default:
+					stats.Record("PutItem", start, elapsed, 1, err)
+					atomic.AddUint64(&errors, 1)
+					if c.Verbose {
+						fmt.Printf("Error: %v\n", err)
+					}
+				}
+			}
+		}(i, stats.Worker(i))
+	}
+	wg.Wait()
+	stats.Stop()
+	track(atomic.LoadInt64(&sequence))
+
+	result := ClaimResult{
+		RunID:             c.RunID,
+		Requests:          claimed + conflicts + errors,
+		Claimed:           claimed,
+		Conflicts:         conflicts,
+		Errors:            errors,
+		Fresh:             fresh,
+		FreshRejected:     freshRejected,
+		Duplicates:        duplicates,
+		DuplicatesClaimed: duplicatesClaimed,
+	}
+	result.ClaimRatio = ratio(claimed, claimed+conflicts)
+	summary := stats.Summary(c.Action)
+	result.ClaimsPerS = perSecond(claimed, summary.DurationSec)
+	result.Outcomes = outcomeLatencies(summary)
+	printClaim(c, result)
+	return nil
+}
+
+func printClaim(c *DynamoDBBenchmark, r ClaimResult) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Summary - claim (duplicate ratio %g)\n", c.DuplicateRatio)
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", r.RunID)
+	fmt.Printf("Claims: %d, claimed: %d, conditional failures: %d, claimed/(claimed+failed): %.2f%%, errors: %d\n",
+		r.Requests, r.Claimed, r.Conflicts, r.ClaimRatio*100, r.Errors)
+	fmt.Printf("New keys: %d, rejected: %d (a duplicate got there first, or a retried attempt had been written)\n", r.Fresh, r.FreshRejected)
+	fmt.Printf("Duplicate keys: %d, claimed: %d (the earlier claim was not written yet)\n", r.Duplicates, r.DuplicatesClaimed)
+	fmt.Printf("Claims/sec: %.2f\n", r.ClaimsPerS)
+	printOutcomeLatencies(r.Outcomes)
+}
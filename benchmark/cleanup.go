@@ -0,0 +1,489 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"benchmark/internal/cli"
+)
+
+var cleanupUsageText = `auto_increment cleanup -run-id <id> [-dry-run] [-verbose]
+auto_increment cleanup -list [-timezone <tz>]
+
+Delete what a run created in DynamoDB: the item of -reset, the items of tx-sweep and batch-sweep
+("<id>-1", "<id>-2", ...), the products and orders of checkout, the events of ledger, the keys of claim, the items of lease, the points of timeseries, the items of item-collection, the chunks and S3 objects of chunk-sweep, the index of -add-index-at, the backup of -backup-at and the scratch
+table of -compat-check. Every run that creates one of them records it in
+~/.dynamodb_benchmark/runs/<run id>.json, together with the endpoint it used; the file is removed
+once everything is deleted. Use -cleanup to clean up at the end of the run instead.
+Containers of tools/start-local.sh are not tracked; stop them with tools/stop-local.sh.
+
+-run-id <id>         (Required) Run whose resources to delete
+-list                List the runs with resources left
+-timezone <tz>       Time zone of the creation times of -list; Defaults to "UTC"
+-dry-run             Print what would be deleted without deleting it
+-verbose             Print every deleted resource
+-config <file>       JSON file with option values, keyed by flag name (see the benchmark)
+
+Every option can also be set with an environment variable DDB_BENCH_<OPTION> or in the -config file
+(the options of the benchmark there are ignored), as for the benchmark.
+`
+
+// Kinds of the resources a run creates.
+const (
+	resourceItem   = "item"
+	resourceItems  = "items"
+	resourceStream = "stream"
+	// resourcePartitions are all items of the partitions "<name>-1" through
+	// "<name>-<count>" of a table with the numeric sort key SortKey.
+	resourcePartitions = "partitions"
+	resourceIndex      = "index"
+	resourceBackup     = "backup"
+	resourceTable      = "table"
+	// resourceS3Objects are all objects under the S3 URI prefix Name, e.g.
+	// those of -storage s3 of chunk-sweep.
+	resourceS3Objects = "s3-objects"
+)
+
+// Resource is something a run created in DynamoDB.
+type Resource struct {
+	Kind  string `json:"kind"`
+	Table string `json:"table"`
+	// Name is the item id, the key prefix of items, the index name, the
+	// backup ARN or the table name.
+	Name string `json:"name"`
+	// Count of items: "<name>-1" through "<name>-<count>", or of the events
+	// of a stream: sort keys 1 through count under the partition key name.
+	Count   int    `json:"count,omitempty"`
+	SortKey string `json:"sort_key,omitempty"`
+	// RoleChain is assumed to reach the resource (see -role-arns).
+	RoleChain []string `json:"role_chain,omitempty"`
+}
+
+func (r Resource) key() string {
+	return strings.Join(append([]string{r.Kind, r.Table, r.Name}, r.RoleChain...), "\x00")
+}
+
+func (r Resource) String() string {
+	switch r.Kind {
+	case resourceItems:
+		return fmt.Sprintf("items %s-1 ... %s-%d of table %s", r.Name, r.Name, r.Count, r.Table)
+	case resourcePartitions:
+		return fmt.Sprintf("partitions %s-1 ... %s-%d of table %s", r.Name, r.Name, r.Count, r.Table)
+	case resourceStream:
+		return fmt.Sprintf("stream %s (%s 1 ... %d) of table %s", r.Name, ledgerSortKey, r.Count, r.Table)
+	case resourceTable, resourceBackup:
+		return fmt.Sprintf("%s %s", r.Kind, r.Name)
+	case resourceS3Objects:
+		return fmt.Sprintf("objects %s*", r.Name)
+	}
+	return fmt.Sprintf("%s %s of table %s", r.Kind, r.Name, r.Table)
+}
+
+// RunManifest lists the resources of a run with the endpoint to reach them.
+type RunManifest struct {
+	RunID              string     `json:"run_id"`
+	Created            time.Time  `json:"created"`
+	EndpointUrl        string     `json:"endpoint_url,omitempty"`
+	EndpointScheme     string     `json:"endpoint_scheme,omitempty"`
+	InsecureSkipVerify bool       `json:"insecure_skip_verify,omitempty"`
+	CABundle           string     `json:"ca_bundle,omitempty"`
+	ProxyURL           string     `json:"proxy_url,omitempty"`
+	FIPS               bool       `json:"fips,omitempty"`
+	DualStack          bool       `json:"dual_stack,omitempty"`
+	SigningRegion      string     `json:"signing_region,omitempty"`
+	RoleExternalID     string     `json:"role_external_id,omitempty"`
+	Resources          []Resource `json:"resources"`
+}
+
+func (m *RunManifest) clientOptions(roleChain []string) ClientOptions {
+	return ClientOptions{
+		EndpointUrl:        m.EndpointUrl,
+		EndpointScheme:     m.EndpointScheme,
+		InsecureSkipVerify: m.InsecureSkipVerify,
+		CABundle:           m.CABundle,
+		ProxyURL:           m.ProxyURL,
+		FIPS:               m.FIPS,
+		DualStack:          m.DualStack,
+		SigningRegion:      m.SigningRegion,
+		RunID:              m.RunID,
+		RoleChain:          roleChain,
+		RoleExternalID:     m.RoleExternalID,
+	}
+}
+
+func manifestDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the home directory: %v", err)
+	}
+	return filepath.Join(home, ".dynamodb_benchmark", "runs"), nil
+}
+
+func manifestPath(runID string) (string, error) {
+	dir, err := manifestDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, backupNameInvalid.ReplaceAllString(runID, "_")+".json"), nil
+}
+
+func loadManifest(runID string) (*RunManifest, error) {
+	path, err := manifestPath(runID)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no resources recorded for run %q (see \"cleanup -list\")", runID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m RunManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("invalid run file %s: %v", path, err)
+	}
+	return &m, nil
+}
+
+// save writes the manifest, or removes its file once nothing is left.
+func (m *RunManifest) save() error {
+	path, err := manifestPath(m.RunID)
+	if err != nil {
+		return err
+	}
+	if len(m.Resources) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// ResourceTracker records the resources of a run as they are created, in
+// the run file unless the run uses the in-process fake, so that they can be
+// deleted even if the run is killed. A nil *ResourceTracker records nothing.
+type ResourceTracker struct {
+	mu       sync.Mutex
+	manifest RunManifest
+	persist  bool
+}
+
+func NewResourceTracker(runID string, opts ClientOptions) *ResourceTracker {
+	return &ResourceTracker{
+		manifest: RunManifest{
+			RunID:              runID,
+			Created:            time.Now().UTC(),
+			EndpointUrl:        opts.EndpointUrl,
+			EndpointScheme:     opts.EndpointScheme,
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+			CABundle:           opts.CABundle,
+			ProxyURL:           opts.ProxyURL,
+			FIPS:               opts.FIPS,
+			DualStack:          opts.DualStack,
+			SigningRegion:      opts.SigningRegion,
+			RoleExternalID:     opts.RoleExternalID,
+		},
+		persist: opts.EndpointUrl != fakeEndpoint,
+	}
+}
+
+// Track records r. Items of the same prefix are recorded once with the
+// highest count.
+func (t *ResourceTracker) Track(r Resource) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	found := false
+	for i := range t.manifest.Resources {
+		known := &t.manifest.Resources[i]
+		if known.key() != r.key() {
+			continue
+		}
+		if r.Count <= known.Count {
+			return
+		}
+		known.Count = r.Count
+		found = true
+		break
+	}
+	if !found {
+		t.manifest.Resources = append(t.manifest.Resources, r)
+	}
+	if !t.persist {
+		return
+	}
+	if err := t.manifest.save(); err != nil {
+		fmt.Printf("[WARN] failed to record the resources of the run: %v\n", err)
+	}
+}
+
+// Untrack forgets r, e.g. after the run deleted it itself.
+func (t *ResourceTracker) Untrack(r Resource) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var kept []Resource
+	for _, known := range t.manifest.Resources {
+		if known.key() != r.key() {
+			kept = append(kept, known)
+		}
+	}
+	if len(kept) == len(t.manifest.Resources) {
+		return
+	}
+	t.manifest.Resources = kept
+	if !t.persist {
+		return
+	}
+	if err := t.manifest.save(); err != nil {
+		fmt.Printf("[WARN] failed to record the resources of the run: %v\n", err)
+	}
+}
+
+// Cleanup deletes the resources recorded so far (see cleanupManifest).
+func (t *ResourceTracker) Cleanup(verbose bool) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.manifest.Resources) == 0 {
+		return nil
+	}
+	return cleanupManifest(&t.manifest, t.persist, false, verbose)
+}
+
+// cleanupManifest deletes the resources of m: indexes and backups first,
+// then items and tables. Resources which are already gone count as deleted.
+// Those that fail stay in m (and its file, with persist) for another try.
+func cleanupManifest(m *RunManifest, persist bool, dryRun bool, verbose bool) error {
+	order := map[string]int{resourceIndex: 0, resourceBackup: 1, resourceItem: 2, resourceItems: 3, resourceStream: 3, resourcePartitions: 3, resourceS3Objects: 3, resourceTable: 4}
+	resources := append([]Resource(nil), m.Resources...)
+	sort.SliceStable(resources, func(i, j int) bool { return order[resources[i].Kind] < order[resources[j].Kind] })
+
+	var left []Resource
+	var failed []string
+	for _, r := range resources {
+		if dryRun {
+			fmt.Printf("Would delete %s\n", r)
+			continue
+		}
+		db, err := getDynamoDBClient(m.clientOptions(r.RoleChain))
+		if err == nil {
+			err = deleteResource(db, r)
+		}
+		if err != nil {
+			left = append(left, r)
+			failed = append(failed, fmt.Sprintf("%s: %v", r, err))
+			continue
+		}
+		if verbose {
+			fmt.Printf("[Verbose] Deleted %s\n", r)
+		}
+	}
+	if dryRun {
+		return nil
+	}
+	fmt.Printf("Cleanup of run %s: deleted %d of %d resources\n", m.RunID, len(resources)-len(left), len(resources))
+	m.Resources = left
+	if persist {
+		if err := m.save(); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete %d resources (run \"cleanup -run-id %s\" to try again):\n  - %s",
+			len(failed), m.RunID, strings.Join(failed, "\n  - "))
+	}
+	return nil
+}
+
+func deleteResource(db *dynamodb.DynamoDB, r Resource) error {
+	var err error
+	switch r.Kind {
+	case resourceItem:
+		err = deleteItems(db, r.Table, []map[string]*dynamodb.AttributeValue{idKey(r.Name)})
+	case resourceItems:
+		keys := make([]map[string]*dynamodb.AttributeValue, 0, r.Count)
+		for k := 1; k <= r.Count; k++ {
+			keys = append(keys, idKey(r.Name+"-"+strconv.Itoa(k)))
+		}
+		err = deleteItems(db, r.Table, keys)
+	case resourceStream:
+		keys := make([]map[string]*dynamodb.AttributeValue, 0, r.Count)
+		for seq := 1; seq <= r.Count; seq++ {
+			keys = append(keys, ledgerKey(r.Name, seq))
+		}
+		err = deleteItems(db, r.Table, keys)
+	case resourcePartitions:
+		for k := 1; k <= r.Count && err == nil; k++ {
+			err = deletePartition(db, r.Table, r.Name+"-"+strconv.Itoa(k), r.SortKey)
+		}
+	case resourceIndex:
+		_, err = db.UpdateTable(&dynamodb.UpdateTableInput{
+			TableName: aws.String(r.Table),
+			GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{
+				{Delete: &dynamodb.DeleteGlobalSecondaryIndexAction{IndexName: aws.String(r.Name)}},
+			},
+		})
+	case resourceBackup:
+		_, err = db.DeleteBackup(&dynamodb.DeleteBackupInput{BackupArn: aws.String(r.Name)})
+	case resourceTable:
+		_, err = db.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(r.Name)})
+	case resourceS3Objects:
+		err = deleteS3Objects(r.Name)
+	default:
+		return fmt.Errorf("unknown kind of resource %q", r.Kind)
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case dynamodb.ErrCodeResourceNotFoundException, dynamodb.ErrCodeBackupNotFoundException:
+			return nil
+		}
+	}
+	return err
+}
+
+// deletePartition deletes all items with the partition key id.
+func deletePartition(db *dynamodb.DynamoDB, table string, id string, sortKey string) error {
+	var keys []map[string]*dynamodb.AttributeValue
+	err := db.QueryPages(&dynamodb.QueryInput{
+		TableName:                 aws.String(table),
+		KeyConditionExpression:    aws.String("#id = :id"),
+		ProjectionExpression:      aws.String("#id, #sk"),
+		ExpressionAttributeNames:  map[string]*string{"#id": aws.String("id"), "#sk": aws.String(sortKey)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":id": {S: aws.String(id)}},
+	}, func(out *dynamodb.QueryOutput, last bool) bool {
+		keys = append(keys, out.Items...)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return deleteItems(db, table, keys)
+}
+
+func idKey(id string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}}
+}
+
+// deleteItems deletes the items with keys, 25 per BatchWriteItem, and
+// resubmits unprocessed items with backoff.
+func deleteItems(db *dynamodb.DynamoDB, table string, keys []map[string]*dynamodb.AttributeValue) error {
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > 25 {
+			n = 25
+		}
+		var requests []*dynamodb.WriteRequest
+		for _, key := range keys[:n] {
+			requests = append(requests, &dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{Key: key},
+			})
+		}
+		keys = keys[n:]
+		input := &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{table: requests}}
+		for attempt := 0; ; attempt++ {
+			out, err := db.BatchWriteItem(input)
+			if err != nil {
+				return err
+			}
+			if len(out.UnprocessedItems[table]) == 0 {
+				break
+			}
+			if attempt >= 10 {
+				return fmt.Errorf("%d items still unprocessed after %d attempts", len(out.UnprocessedItems[table]), attempt+1)
+			}
+			time.Sleep(time.Duration(50<<uint(attempt)) * time.Millisecond)
+			input = &dynamodb.BatchWriteItemInput{RequestItems: out.UnprocessedItems}
+		}
+	}
+	return nil
+}
+
+// cleanup runs the cleanup subcommand and returns the exit status.
+func cleanup(args []string) int {
+	fs := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Println(cleanupUsageText) }
+	runID := fs.String("run-id", "", "Run whose resources to delete")
+	list := fs.Bool("list", false, "List the runs with resources left")
+	dryRun := fs.Bool("dry-run", false, "Print what would be deleted")
+	verbose := fs.Bool("verbose", false, "Verbose option")
+	timezone := fs.String("timezone", "UTC", "Time zone of the creation times of -list")
+	configFile := fs.String("config", "", "JSON file with option values, overridden by environment variables and flags")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	sources, err := cli.ApplyEnvAndConfig(fs, *configFile, true)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		return exitUsage
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		fmt.Printf("[ERROR] %s: %s\n", sources.Of("timezone"), err.Error())
+		return exitUsage
+	}
+	outputLocation = loc
+	if *list {
+		dir, err := manifestDir()
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			return exitFailure
+		}
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		sort.Strings(files)
+		for _, f := range files {
+			m, err := loadManifest(strings.TrimSuffix(filepath.Base(f), ".json"))
+			if err != nil {
+				fmt.Printf("[WARN] %s\n", err.Error())
+				continue
+			}
+			fmt.Printf("%-30s %s, %d resources\n", m.RunID, formatTime(m.Created, time.RFC3339), len(m.Resources))
+		}
+		return exitOK
+	}
+	if *runID == "" {
+		fmt.Println("[ERROR] -run-id or -list is required")
+		fmt.Println("Run with cleanup -h to see the usage")
+		return exitUsage
+	}
+	m, err := loadManifest(*runID)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		return exitFailure
+	}
+	if err := cleanupManifest(m, true, *dryRun, *verbose); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/lambda"
+
+	"benchmark/internal/awsclient"
+)
+
+// ClientOptions controls how the DynamoDB client reaches its endpoint and
+// which counters of the run it feeds (see awsclient.Options).
+type ClientOptions struct {
+	EndpointUrl string
+	// EndpointScheme forces "http" or "https" regardless of the scheme of
+	// EndpointUrl (or the SDK default endpoint). Empty keeps it as is.
+	EndpointScheme     string
+	InsecureSkipVerify bool
+	CABundle           string
+	// Region and Profile override the shared config, e.g. to reach a table
+	// in another region or account.
+	Region  string
+	Profile string
+	// ProxyURL routes the requests through this proxy instead of the one
+	// of HTTP_PROXY / HTTPS_PROXY / NO_PROXY; Direct bypasses any proxy.
+	ProxyURL string
+	Direct   bool
+	// Proxies, if not nil, counts the requests routed through a proxy.
+	Proxies *WorkerProxyStats
+	// EndpointDiscovery enables the endpoint discovery of the SDK.
+	EndpointDiscovery bool
+	// FIPS and DualStack make the SDK resolve the FIPS or dual-stack (IPv4
+	// and IPv6) variant of the regional endpoint.
+	FIPS      bool
+	DualStack bool
+	// SigningRegion, if not empty, signs the requests for this region
+	// instead of the one the endpoint resolved to.
+	SigningRegion string
+	// RunID is appended to the User-Agent of every request so CloudTrail
+	// entries can be attributed to the benchmark run.
+	RunID string
+	// Stub uses fixed credentials and region, which the in-process stub
+	// endpoint of -calibrate accepts, so no AWS configuration is needed.
+	Stub bool
+	// RoleChain is assumed in order, each role with the credentials of the
+	// previous one and the first with the default credentials.
+	RoleChain      []string
+	RoleExternalID string
+	// ConnStats, if not nil, traces the connections of every HTTP request.
+	ConnStats *WorkerConnStats
+	// Throttles and Timeline, if not nil, count the throttled attempts.
+	Throttles *ThrottleCounter
+	Timeline  *Timeline
+	Isolation *Timeline
+	// Partitions, if not nil, counts the throttled attempts per window.
+	Partitions *PartitionEstimator
+	// Attempts, if not nil, counts the attempts of every request.
+	Attempts *AttemptCounter
+	// Breakdown, if not nil, times the phases of every request.
+	Breakdown *WorkerBreakdown
+}
+
+// aws returns the options of the AWS clients, with the counters of o as
+// their instruments.
+func (o ClientOptions) aws() awsclient.Options {
+	opts := awsclient.Options{
+		EndpointUrl:        o.EndpointUrl,
+		EndpointScheme:     o.EndpointScheme,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		CABundle:           o.CABundle,
+		Region:             o.Region,
+		Profile:            o.Profile,
+		ProxyURL:           o.ProxyURL,
+		Direct:             o.Direct,
+		EndpointDiscovery:  o.EndpointDiscovery,
+		FIPS:               o.FIPS,
+		DualStack:          o.DualStack,
+		SigningRegion:      o.SigningRegion,
+		RunID:              o.RunID,
+		Stub:               o.Stub,
+		RoleChain:          o.RoleChain,
+		RoleExternalID:     o.RoleExternalID,
+	}
+	if o.EndpointUrl == fakeEndpoint {
+		opts.EndpointUrl = "http://fake.invalid"
+		opts.Transport = fakeTransport{fakeDB}
+	}
+	if o.Proxies != nil {
+		opts.Proxies = o.Proxies
+	}
+	if o.ConnStats != nil {
+		opts.Instruments = append(opts.Instruments, sendHandler(o.ConnStats.handler()))
+	}
+	if o.Attempts != nil {
+		opts.Instruments = append(opts.Instruments, sendHandler(o.Attempts.handler()))
+	}
+	if o.Throttles != nil {
+		opts.Instruments = append(opts.Instruments, retryHandler(o.Throttles.handler()))
+	}
+	if o.Timeline != nil {
+		opts.Instruments = append(opts.Instruments, retryHandler(o.Timeline.handler()))
+	}
+	if o.Isolation != nil {
+		opts.Instruments = append(opts.Instruments, retryHandler(o.Isolation.handler()))
+	}
+	if o.Partitions != nil {
+		opts.Instruments = append(opts.Instruments, retryHandler(o.Partitions.handler()))
+	}
+	if o.Breakdown != nil {
+		opts.ClientInstruments = append(opts.ClientInstruments, o.Breakdown)
+	}
+	return opts
+}
+
+// sendHandler runs h first of the Send handlers, i.e. once per attempt.
+func sendHandler(h request.NamedHandler) awsclient.Instrument {
+	return awsclient.InstrumentFunc(func(handlers *request.Handlers) {
+		handlers.Send.PushFrontNamed(h)
+	})
+}
+
+// retryHandler runs h first of the Retry handlers, i.e. after every failed
+// attempt.
+func retryHandler(h request.NamedHandler) awsclient.Instrument {
+	return awsclient.InstrumentFunc(func(handlers *request.Handlers) {
+		handlers.Retry.PushFrontNamed(h)
+	})
+}
+
+func newSession(opts ClientOptions) (*session.Session, error) {
+	return awsclient.NewSession(opts.aws())
+}
+
+func getDynamoDBClient(opts ClientOptions) (*dynamodb.DynamoDB, error) {
+	return awsclient.DynamoDB(opts.aws())
+}
+
+// getLambdaClient returns a Lambda client in the region and with the
+// credentials of opts; the DynamoDB endpoint options do not apply to it.
+func getLambdaClient(opts ClientOptions) (*lambda.Lambda, error) {
+	return awsclient.Lambda(opts.aws())
+}
+
+// newRunID returns a sortable, unique enough identifier for a run.
+func newRunID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
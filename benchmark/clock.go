@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Clock hands out timestamps derived from a single wall-clock anchor plus
+// the monotonic time elapsed since then. NTP steps or manual clock changes
+// during a run therefore cannot make timestamps go backwards, and all
+// timestamps of a run are consistent with the measured latencies.
+type Clock struct {
+	anchor time.Time
+	skew   *SkewEstimate
+}
+
+func NewClock() *Clock {
+	return &Clock{anchor: time.Now()}
+}
+
+func (c *Clock) Now() time.Time {
+	return c.anchor.Add(time.Since(c.anchor))
+}
+
+// SetSkew records the estimated offset of the local clock to a reference.
+func (c *Clock) SetSkew(skew *SkewEstimate) {
+	c.skew = skew
+}
+
+// Reference converts a local timestamp into the reference clock's time base,
+// which is what timestamps produced on other hosts must be compared with.
+func (c *Clock) Reference(t time.Time) time.Time {
+	if c.skew == nil {
+		return t
+	}
+	return t.Add(c.skew.Offset)
+}
+
+// SkewEstimate is the estimated offset of a reference clock relative to the
+// local clock: reference time = local time + Offset, give or take
+// Uncertainty.
+type SkewEstimate struct {
+	Reference   string        `json:"reference"`
+	Offset      time.Duration `json:"offset_ns"`
+	Uncertainty time.Duration `json:"uncertainty_ns"`
+	RoundTrip   time.Duration `json:"round_trip_ns"`
+}
+
+func (s *SkewEstimate) String() string {
+	return fmt.Sprintf("%.1f ms (+/- %.1f ms) vs %s", durationMs(s.Offset), durationMs(s.Uncertainty), s.Reference)
+}
+
+// EstimateSkew runs a ping exchange against reference, an HTTP server such
+// as the coordinator or the DynamoDB endpoint itself, and estimates the clock
+// offset from the Date response header of the fastest round trip, assuming
+// the server stamped it halfway through. Date has a resolution of one second,
+// which is included in the uncertainty.
+func EstimateSkew(reference string, probes int) (*SkewEstimate, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	var best *SkewEstimate
+	var lastErr error
+	for i := 0; i < probes; i++ {
+		sent := time.Now()
+		resp, err := client.Head(reference)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		rtt := time.Since(sent)
+		resp.Body.Close()
+		date, err := http.ParseTime(resp.Header.Get("Date"))
+		if err != nil {
+			lastErr = fmt.Errorf("no usable Date header in response from %s", reference)
+			continue
+		}
+		// The server clock was somewhere in [date, date+1s) when it answered.
+		serverTime := date.Add(500 * time.Millisecond)
+		localTime := sent.Add(rtt / 2)
+		estimate := &SkewEstimate{
+			Reference:   reference,
+			Offset:      serverTime.Sub(localTime),
+			Uncertainty: 500*time.Millisecond + rtt/2,
+			RoundTrip:   rtt,
+		}
+		if best == nil || rtt < best.RoundTrip {
+			best = estimate
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("failed to estimate clock skew: %v", lastErr)
+	}
+	return best, nil
+}
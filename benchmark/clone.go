@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// cloneThroughput copies provisioned capacity, which DescribeTable also
+// reports (as zero) for on-demand tables.
+func cloneThroughput(d *dynamodb.ProvisionedThroughputDescription) *dynamodb.ProvisionedThroughput {
+	if d == nil {
+		return nil
+	}
+	return &dynamodb.ProvisionedThroughput{
+		ReadCapacityUnits:  d.ReadCapacityUnits,
+		WriteCapacityUnits: d.WriteCapacityUnits,
+	}
+}
+
+// CloneTableInput builds a CreateTableInput with the key schema, indexes,
+// billing mode and stream settings of an existing table. Encryption settings
+// are not copied since KMS keys do not cross regions and accounts.
+func CloneTableInput(src *dynamodb.TableDescription, tableName *string) *dynamodb.CreateTableInput {
+	billingMode := dynamodb.BillingModeProvisioned
+	if src.BillingModeSummary != nil && src.BillingModeSummary.BillingMode != nil {
+		billingMode = *src.BillingModeSummary.BillingMode
+	}
+	provisioned := billingMode == dynamodb.BillingModeProvisioned
+
+	input := &dynamodb.CreateTableInput{
+		TableName:            tableName,
+		AttributeDefinitions: src.AttributeDefinitions,
+		KeySchema:            src.KeySchema,
+		BillingMode:          aws.String(billingMode),
+	}
+	if provisioned {
+		input.ProvisionedThroughput = cloneThroughput(src.ProvisionedThroughput)
+	}
+	for _, gsi := range src.GlobalSecondaryIndexes {
+		index := &dynamodb.GlobalSecondaryIndex{
+			IndexName:  gsi.IndexName,
+			KeySchema:  gsi.KeySchema,
+			Projection: gsi.Projection,
+		}
+		if provisioned {
+			index.ProvisionedThroughput = cloneThroughput(gsi.ProvisionedThroughput)
+		}
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, index)
+	}
+	for _, lsi := range src.LocalSecondaryIndexes {
+		input.LocalSecondaryIndexes = append(input.LocalSecondaryIndexes, &dynamodb.LocalSecondaryIndex{
+			IndexName:  lsi.IndexName,
+			KeySchema:  lsi.KeySchema,
+			Projection: lsi.Projection,
+		})
+	}
+	if src.StreamSpecification != nil && aws.BoolValue(src.StreamSpecification.StreamEnabled) {
+		input.StreamSpecification = src.StreamSpecification
+	}
+	return input
+}
+
+// CloneTable creates tableName with the schema of sourceTable, which is
+// described through source (possibly another region or account), and tags,
+// and waits until the new table is ACTIVE.
+func CloneTable(source dynamodbiface.DynamoDBAPI, db dynamodbiface.DynamoDBAPI, sourceTable *string, tableName *string, tags []*dynamodb.Tag, verbose bool) error {
+	out, err := source.DescribeTable(&dynamodb.DescribeTableInput{TableName: sourceTable})
+	if err != nil {
+		return fmt.Errorf("failed to describe source table %s: %v", *sourceTable, err)
+	}
+	input := CloneTableInput(out.Table, tableName)
+	input.Tags = tags
+	if verbose {
+		fmt.Printf("[Verbose] CreateTable input: %s\n", input)
+	}
+	if _, err := db.CreateTable(input); err != nil {
+		return err
+	}
+	if err := db.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: tableName}); err != nil {
+		return err
+	}
+	fmt.Printf("Cloned table %s from %s (%d GSIs, %d LSIs, billing mode %s)\n",
+		*tableName, *sourceTable, len(input.GlobalSecondaryIndexes), len(input.LocalSecondaryIndexes), *input.BillingMode)
+	return nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	// collectionSortKey is the numeric sort key of the item-collection
+	// table, 1, 2, ... per collection.
+	collectionSortKey = "seq"
+	// collectionLSIRange is the range of the random LSI sort key values.
+	collectionLSIRange = 1000000
+	// collectionQueryLimit is the Limit of the LSI queries.
+	collectionQueryLimit = 100
+)
+
+// errItemCollectionFull is recorded for the writes DynamoDB rejected because
+// their item collection reached the 10 GB limit of tables with local
+// secondary indexes. They are not retried.
+var errItemCollectionFull = errors.New(dynamodb.ErrCodeItemCollectionSizeLimitExceededException + ": the item collection reached its size limit")
+
+func isItemCollectionFull(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeItemCollectionSizeLimitExceededException
+}
+
+// collectionPrefix is the key prefix of the item collections of the run,
+// "<prefix>-<k>".
+func (c *DynamoDBBenchmark) collectionPrefix() string {
+	return c.Id + "-ic-" + c.RunID
+}
+
+// CollectionLSI is the local secondary index of -lsi and its numeric (N) or
+// zero padded string (S) sort key.
+type CollectionLSI struct {
+	Name          string
+	Attribute     string
+	AttributeType string
+}
+
+// parseCollectionLSI parses "<name>:<attribute>[:S|N]" like -add-index.
+func parseCollectionLSI(s string) (*CollectionLSI, error) {
+	if s == "" {
+		return nil, nil
+	}
+	spec, err := parseIndexSpec(s)
+	if err != nil {
+		return nil, err
+	}
+	if spec.AttributeType == dynamodb.ScalarAttributeTypeB {
+		return nil, fmt.Errorf("the sort key of the index must be S or N, got B")
+	}
+	return &CollectionLSI{Name: spec.Name, Attribute: spec.Attribute, AttributeType: spec.AttributeType}, nil
+}
+
+// value is the attribute of the LSI sort key v.
+func (l *CollectionLSI) value(v int) *dynamodb.AttributeValue {
+	if l.AttributeType == dynamodb.ScalarAttributeTypeS {
+		return &dynamodb.AttributeValue{S: aws.String(fmt.Sprintf("%07d", v))}
+	}
+	return &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(v))}
+}
+
+// ItemCollectionSummary is the outcome of the item-collection action.
+type ItemCollectionSummary struct {
+	Collections  int     `json:"collections"`
+	Items        uint64  `json:"items"`
+	BytesWritten uint64  `json:"bytes_written"`
+	ItemsPerSec  float64 `json:"items_per_sec"`
+	// LimitExceeded counts the writes rejected because the collection reached
+	// the 10 GB limit; FirstLimitSec is the time from the start of the run to
+	// the first of them, -1 if there was none.
+	LimitExceeded uint64  `json:"limit_exceeded"`
+	FirstLimitSec float64 `json:"first_limit_sec"`
+}
+
+func (s *ItemCollectionSummary) String() string {
+	limit := "not reached"
+	if s.FirstLimitSec >= 0 {
+		limit = fmt.Sprintf("reached after %.1f sec, %d writes rejected", s.FirstLimitSec, s.LimitExceeded)
+	}
+	return fmt.Sprintf("%d items (%.2f/sec, %.1f MB) into %d collections, 10 GB limit %s",
+		s.Items, s.ItemsPerSec, float64(s.BytesWritten)/1e6, s.Collections, limit)
+}
+
+// ItemCollections hands out the sort keys of the collections and counts the
+// writes to them; their sizes are followed by CollectionSizes. A nil
+// *ItemCollections counts nothing.
+type ItemCollections struct {
+	start    time.Time
+	seq      []int64
+	items    uint64
+	bytes    uint64
+	exceeded uint64
+	// first is the offset of the first rejected write from start in
+	// nanoseconds plus one, 0 while there was none.
+	first int64
+}
+
+func NewItemCollections(collections int) *ItemCollections {
+	return &ItemCollections{start: time.Now(), seq: make([]int64, collections)}
+}
+
+func (ic *ItemCollections) next(k int) int64 {
+	return atomic.AddInt64(&ic.seq[k-1], 1)
+}
+
+// written counts an item of size bytes.
+func (ic *ItemCollections) written(size int) {
+	if ic == nil {
+		return
+	}
+	atomic.AddUint64(&ic.items, 1)
+	atomic.AddUint64(&ic.bytes, uint64(size))
+}
+
+func (ic *ItemCollections) full() {
+	if ic == nil {
+		return
+	}
+	atomic.AddUint64(&ic.exceeded, 1)
+	atomic.CompareAndSwapInt64(&ic.first, 0, int64(time.Since(ic.start))+1)
+}
+
+// Summary sums up the writes of a run of the given duration.
+func (ic *ItemCollections) Summary(seconds float64) *ItemCollectionSummary {
+	if ic == nil {
+		return nil
+	}
+	sum := &ItemCollectionSummary{
+		Collections:   len(ic.seq),
+		Items:         atomic.LoadUint64(&ic.items),
+		BytesWritten:  atomic.LoadUint64(&ic.bytes),
+		LimitExceeded: atomic.LoadUint64(&ic.exceeded),
+		FirstLimitSec: -1,
+	}
+	sum.ItemsPerSec = perSecond(sum.Items, seconds)
+	if first := atomic.LoadInt64(&ic.first); first > 0 {
+		sum.FirstLimitSec = time.Duration(first - 1).Seconds()
+	}
+	return sum
+}
+
+// checkCollectionTable verifies the table is keyed by "id" and "seq" and,
+// with -lsi, has that local secondary index. On the fake endpoint the table
+// is created so.
+func (c *DynamoDBBenchmark) checkCollectionTable(db *dynamodb.DynamoDB, lsi *CollectionLSI) error {
+	if c.EndpointUrl == fakeEndpoint {
+		in := c.sortKeyTableInput(collectionSortKey, dynamodb.ScalarAttributeTypeN)
+		if lsi != nil {
+			in.AttributeDefinitions = append(in.AttributeDefinitions, &dynamodb.AttributeDefinition{
+				AttributeName: aws.String(lsi.Attribute), AttributeType: aws.String(lsi.AttributeType),
+			})
+			in.LocalSecondaryIndexes = []*dynamodb.LocalSecondaryIndex{{
+				IndexName: aws.String(lsi.Name),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{AttributeName: aws.String("id"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+					{AttributeName: aws.String(lsi.Attribute), KeyType: aws.String(dynamodb.KeyTypeRange)},
+				},
+				Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+			}}
+		}
+		_, err := db.CreateTable(in)
+		return err
+	}
+	if err := c.checkSortKeyTable(db, "item-collection", collectionSortKey, dynamodb.ScalarAttributeTypeN); err != nil {
+		return err
+	}
+	if lsi == nil {
+		return nil
+	}
+	out, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(c.TableName)})
+	if err != nil {
+		return err
+	}
+	for _, idx := range out.Table.LocalSecondaryIndexes {
+		if aws.StringValue(idx.IndexName) == lsi.Name {
+			return nil
+		}
+	}
+	return fmt.Errorf("table %s has no local secondary index %q; create one with: go run . admin -a create-table -table %s -sort-key %s -lsi %s",
+		c.TableName, lsi.Name, c.TableName, collectionSortKey, c.LSI)
+}
+
+// collectionItem is the next item of collection k, with -item-size bytes of
+// "data" and, with -lsi, a random LSI sort key.
+func (c *DynamoDBBenchmark) collectionItem(k int, lsi *CollectionLSI, rnd *rand.Rand) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		"id":              {S: aws.String(c.collectionPrefix() + "-" + strconv.Itoa(k))},
+		collectionSortKey: {N: aws.String(strconv.FormatInt(c.itemCollections.next(k), 10))},
+		"data":            {S: aws.String(strings.Repeat("x", c.ItemSize))},
+		"run_id":          {S: aws.String(c.RunID)},
+	}
+	if lsi != nil {
+		item[lsi.Attribute] = lsi.value(rnd.Intn(collectionLSIRange))
+	}
+	return item
+}
+
+// queryCollectionLSI reads up to collectionQueryLimit items of collection k
+// from a random point of the LSI sort key on and returns their number.
+func (c *DynamoDBBenchmark) queryCollectionLSI(db *dynamodb.DynamoDB, lsi *CollectionLSI, k int, rnd *rand.Rand) (int, error) {
+	out, err := db.Query(&dynamodb.QueryInput{
+		TableName:                aws.String(c.TableName),
+		IndexName:                aws.String(lsi.Name),
+		KeyConditionExpression:   aws.String("#id = :id AND #lsi >= :from"),
+		ExpressionAttributeNames: map[string]*string{"#id": aws.String("id"), "#lsi": aws.String(lsi.Attribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id":   {S: aws.String(c.collectionPrefix() + "-" + strconv.Itoa(k))},
+			":from": lsi.value(rnd.Intn(collectionLSIRange)),
+		},
+		Limit: aws.Int64(collectionQueryLimit),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(out.Items), nil
+}
+
+// startCollectionWorker grows the item collections picked by -key-skew out
+// of -collections with PutItems; with -lsi, -lsi-read-ratio of the calls
+// query the index instead.
+func (c *DynamoDBBenchmark) startCollectionWorker(id int, wg *sync.WaitGroup, stats *WorkerStats) {
+	defer wg.Done()
+	defer stats.Finish()
+
+	time.Sleep(c.staggerDelay(id))
+
+	opts := c.sessionClientOptions(id)
+	opts.ConnStats = c.conns.Worker(id)
+	opts.Breakdown = c.breakdown.Worker()
+	opts.Attempts = stats.Attempts()
+	db, err := getDynamoDBClient(opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	skew, _ := parseKeySkew(c.KeySkew)
+	pick := skew.picker(rnd, c.Collections)
+	lsi, _ := parseCollectionLSI(c.LSI)
+	for i := 1; c.moreCalls(id, i); i++ {
+		k := pick()
+		if lsi != nil && rnd.Float64() < c.LSIReadRatio {
+			var n int
+			start := c.clock.Now()
+			err := retry(c.RetryNum, 2*time.Second, func() (err error) {
+				n, err = c.queryCollectionLSI(db, lsi, k, rnd)
+				return err
+			})
+			stats.Record("Query[LSI]", start, time.Since(start), n, err)
+			if err != nil && !c.TUI {
+				fmt.Printf("Error: %v\n", err)
+			}
+			continue
+		}
+		in := &dynamodb.PutItemInput{
+			TableName:                   aws.String(c.TableName),
+			Item:                        c.collectionItem(k, lsi, rnd),
+			ReturnItemCollectionMetrics: aws.String(dynamodb.ReturnItemCollectionMetricsSize),
+		}
+		var out *dynamodb.PutItemOutput
+		full := false
+		start := c.clock.Now()
+		err := retry(c.RetryNum, 2*time.Second, func() (err error) {
+			out, err = db.PutItem(in)
+			if isItemCollectionFull(err) {
+				full = true
+				return nil
+			}
+			return err
+		})
+		if full {
+			err = errItemCollectionFull
+			c.itemCollections.full()
+		}
+		stats.Record("PutItem", start, time.Since(start), 1, err)
+		if err == nil {
+			c.itemCollections.written(c.ItemSize)
+			c.collectionSizes.Record(out.ItemCollectionMetrics)
+		} else if !c.TUI {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	// itemCollectionLimitGB is the size limit of the item collections of
+	// tables with local secondary indexes.
+	itemCollectionLimitGB = 10.0
+	// collectionSizeWarnShare is the share of the limit above which the
+	// summary warns about a collection.
+	collectionSizeWarnShare = 0.8
+	// collectionSizeWarnHours is the projected time to the limit below which
+	// the summary warns about a collection.
+	collectionSizeWarnHours = 24.0
+	// collectionSizesShown is the number of largest collections the summary
+	// lists.
+	collectionSizesShown = 5
+)
+
+// CollectionGrowth is how one item collection grew during the run, by the
+// upper bounds of the size estimates DynamoDB returned with the writes.
+type CollectionGrowth struct {
+	Key     string  `json:"key"`
+	Writes  uint64  `json:"writes"`
+	FirstGB float64 `json:"first_gb"`
+	LastGB  float64 `json:"last_gb"`
+	// GBPerHour is the growth between the first and the last estimate;
+	// HoursToLimit extrapolates it to the 10 GB limit, -1 if the collection
+	// did not grow.
+	GBPerHour    float64 `json:"gb_per_hour"`
+	HoursToLimit float64 `json:"hours_to_limit"`
+}
+
+// CollectionSizesSummary lists the largest item collections written.
+type CollectionSizesSummary struct {
+	Collections int                `json:"collections"`
+	Largest     []CollectionGrowth `json:"largest"`
+}
+
+func (s *CollectionSizesSummary) Print() {
+	fmt.Printf("Item collection sizes (upper bounds of the ItemCollectionMetrics estimates, %d collections written):\n", s.Collections)
+	for _, g := range s.Largest {
+		limit := "not growing"
+		if g.HoursToLimit >= 0 {
+			limit = fmt.Sprintf("+%.3f GB/hour, %.0f GB in %.1f hours", g.GBPerHour, itemCollectionLimitGB, g.HoursToLimit)
+		}
+		fmt.Printf("  %s: %.3f -> %.3f GB over %d writes (%s)\n", g.Key, g.FirstGB, g.LastGB, g.Writes, limit)
+		if g.LastGB >= collectionSizeWarnShare*itemCollectionLimitGB {
+			fmt.Printf("[WARN] item collection %s is at %.3f GB of the %.0f GB limit; writes to it will fail once it is reached\n", g.Key, g.LastGB, itemCollectionLimitGB)
+		} else if g.HoursToLimit >= 0 && g.HoursToLimit < collectionSizeWarnHours {
+			fmt.Printf("[WARN] item collection %s would reach the %.0f GB limit in %.1f hours at this write rate\n", g.Key, itemCollectionLimitGB, g.HoursToLimit)
+		}
+	}
+}
+
+type collectionSize struct {
+	writes          uint64
+	firstGB, lastGB float64
+	first, last     time.Time
+}
+
+// CollectionSizes follows the size estimates of the item collections
+// written, returned with ReturnItemCollectionMetrics SIZE. DynamoDB only
+// returns them for tables with local secondary indexes. A nil
+// *CollectionSizes records nothing.
+type CollectionSizes struct {
+	mu    sync.Mutex
+	sizes map[string]*collectionSize
+}
+
+func NewCollectionSizes() *CollectionSizes {
+	return &CollectionSizes{sizes: map[string]*collectionSize{}}
+}
+
+// collectionKey is the partition key value of the collection.
+func collectionKey(key map[string]*dynamodb.AttributeValue) string {
+	for _, v := range key {
+		switch {
+		case v.S != nil:
+			return *v.S
+		case v.N != nil:
+			return *v.N
+		case v.B != nil:
+			return fmt.Sprintf("%x", v.B)
+		}
+	}
+	return ""
+}
+
+// Record adds the estimate returned with a write.
+func (cs *CollectionSizes) Record(m *dynamodb.ItemCollectionMetrics) {
+	if cs == nil || m == nil || len(m.SizeEstimateRangeGB) == 0 {
+		return
+	}
+	gb := aws.Float64Value(m.SizeEstimateRangeGB[len(m.SizeEstimateRangeGB)-1])
+	key := collectionKey(m.ItemCollectionKey)
+	now := time.Now()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	s, ok := cs.sizes[key]
+	if !ok {
+		s = &collectionSize{firstGB: gb, first: now}
+		cs.sizes[key] = s
+	}
+	s.writes++
+	s.lastGB, s.last = gb, now
+}
+
+// RecordBatch adds the estimates returned with a BatchWriteItem.
+func (cs *CollectionSizes) RecordBatch(metrics map[string][]*dynamodb.ItemCollectionMetrics) {
+	for _, table := range metrics {
+		for _, m := range table {
+			cs.Record(m)
+		}
+	}
+}
+
+// Summary lists the collectionSizesShown largest collections.
+func (cs *CollectionSizes) Summary() *CollectionSizesSummary {
+	if cs == nil {
+		return nil
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if len(cs.sizes) == 0 {
+		return nil
+	}
+	sum := &CollectionSizesSummary{Collections: len(cs.sizes)}
+	for key, s := range cs.sizes {
+		g := CollectionGrowth{Key: key, Writes: s.writes, FirstGB: s.firstGB, LastGB: s.lastGB, HoursToLimit: -1}
+		if hours := s.last.Sub(s.first).Hours(); hours > 0 && s.lastGB > s.firstGB {
+			g.GBPerHour = (s.lastGB - s.firstGB) / hours
+			g.HoursToLimit = (itemCollectionLimitGB - s.lastGB) / g.GBPerHour
+			if g.HoursToLimit < 0 {
+				g.HoursToLimit = 0
+			}
+		}
+		sum.Largest = append(sum.Largest, g)
+	}
+	sort.Slice(sum.Largest, func(i, j int) bool {
+		if sum.Largest[i].LastGB != sum.Largest[j].LastGB {
+			return sum.Largest[i].LastGB > sum.Largest[j].LastGB
+		}
+		return sum.Largest[i].Key < sum.Largest[j].Key
+	})
+	if len(sum.Largest) > collectionSizesShown {
+		sum.Largest = sum.Largest[:collectionSizesShown]
+	}
+	return sum
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// defaultComparePrices are the us-east-1 prices in USD: on-demand per
+// million read/write request units, provisioned per capacity unit-hour.
+const defaultComparePrices = "rru=0.125,wru=0.625,rcu-hour=0.00013,wcu-hour=0.00065"
+
+// ComparePhase is one run of the -compare workload: a table, optionally
+// switched to another billing mode before the run.
+type ComparePhase struct {
+	Table string
+	// Billing is "", "on-demand" or "provisioned"; "" keeps the table as is.
+	Billing       string
+	ReadCapacity  int64
+	WriteCapacity int64
+}
+
+// CompareResult is the outcome of one phase.
+type CompareResult struct {
+	Table         string `json:"table"`
+	BillingMode   string `json:"billing_mode"`
+	ReadCapacity  int64  `json:"read_capacity,omitempty"`
+	WriteCapacity int64  `json:"write_capacity,omitempty"`
+	Requests      uint64 `json:"requests"`
+	Success       uint64 `json:"success"`
+	Errors        uint64 `json:"errors"`
+	// Throttles counts throttled attempts, including those the SDK retried
+	// successfully; ThrottleOnsetSec is the time from the start of the phase
+	// to the first one, -1 if there was none.
+	Throttles         uint64  `json:"throttles"`
+	ThrottleRate      float64 `json:"throttle_rate"`
+	ThrottleOnsetSec  float64 `json:"throttle_onset_sec"`
+	DurationSec       float64 `json:"duration_sec"`
+	RequestsPerSecond float64 `json:"requests_per_sec"`
+	AverageMs         float64 `json:"average_ms"`
+	P50Ms             float64 `json:"p50_ms"`
+	P99Ms             float64 `json:"p99_ms"`
+	CapacityUnits     float64 `json:"capacity_units"`
+	CostUSD           float64 `json:"cost_usd"`
+	CostPerMillionUSD float64 `json:"cost_per_million_usd"`
+	// Throughput and Latency are the differences to the first phase of the
+	// throughput and average latency of the compareInterval intervals; nil
+	// for the first phase.
+	Throughput *Difference `json:"throughput_diff,omitempty"`
+	Latency    *Difference `json:"latency_diff,omitempty"`
+
+	intervalThroughput runningMean
+	intervalLatency    runningMean
+}
+
+// compareInterval is the length of the intervals whose throughput and
+// average latency the phases are compared by.
+const compareInterval = time.Second
+
+// parseComparePhases parses comma separated "<table>[@<billing>]" entries,
+// with billing "on-demand" or "provisioned:<rcu>/<wcu>". An empty table is
+// -table.
+func parseComparePhases(spec string, table string) ([]ComparePhase, error) {
+	var phases []ComparePhase
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		p := ComparePhase{Table: entry}
+		if i := strings.Index(entry, "@"); i >= 0 {
+			p.Table = entry[:i]
+			billing := entry[i+1:]
+			switch {
+			case billing == "on-demand":
+				p.Billing = billing
+			case strings.HasPrefix(billing, "provisioned:"):
+				units := strings.SplitN(strings.TrimPrefix(billing, "provisioned:"), "/", 2)
+				if len(units) != 2 {
+					return nil, fmt.Errorf("%q: provisioned capacity must be provisioned:<rcu>/<wcu>", entry)
+				}
+				rcu, err1 := strconv.ParseInt(units[0], 10, 64)
+				wcu, err2 := strconv.ParseInt(units[1], 10, 64)
+				if err1 != nil || err2 != nil || rcu <= 0 || wcu <= 0 {
+					return nil, fmt.Errorf("%q: capacity units must be more than 0", entry)
+				}
+				p.Billing, p.ReadCapacity, p.WriteCapacity = "provisioned", rcu, wcu
+			default:
+				return nil, fmt.Errorf("%q: billing must be on-demand or provisioned:<rcu>/<wcu>", entry)
+			}
+		}
+		if p.Table == "" {
+			p.Table = table
+		}
+		if p.Table == "" {
+			return nil, fmt.Errorf("%q: no table name and no -table", entry)
+		}
+		phases = append(phases, p)
+	}
+	if len(phases) < 2 {
+		return nil, fmt.Errorf("at least two phases are needed to compare")
+	}
+	return phases, nil
+}
+
+// parseComparePrices parses "rru=,wru=,rcu-hour=,wcu-hour=" overrides of
+// defaultComparePrices.
+func parseComparePrices(spec string) (map[string]float64, error) {
+	prices := map[string]float64{}
+	for _, s := range []string{defaultComparePrices, spec} {
+		for _, field := range strings.Split(s, ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid price %q: expected <unit>=<usd>", field)
+			}
+			if _, ok := prices[kv[0]]; !ok && s == spec {
+				return nil, fmt.Errorf("unknown price %q: must be one of rru, wru, rcu-hour, wcu-hour", kv[0])
+			}
+			v, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("invalid price %q", field)
+			}
+			prices[kv[0]] = v
+		}
+	}
+	return prices, nil
+}
+
+// ThrottleCounter counts the throttled attempts of a phase, seen by the
+// Retry handlers of the SDK before it retries them. A nil *ThrottleCounter
+// counts nothing.
+type ThrottleCounter struct {
+	start time.Time
+	count uint64
+	// first is the offset of the first throttle from start in nanoseconds
+	// plus one, 0 while there was none.
+	first int64
+}
+
+func NewThrottleCounter() *ThrottleCounter {
+	return &ThrottleCounter{start: time.Now()}
+}
+
+func (t *ThrottleCounter) handler() request.NamedHandler {
+	return request.NamedHandler{Name: "dynamodb-benchmark.ThrottleCounter", Fn: func(r *request.Request) {
+		if !isThrottle(r.Error) {
+			return
+		}
+		atomic.AddUint64(&t.count, 1)
+		atomic.CompareAndSwapInt64(&t.first, 0, int64(time.Since(t.start))+1)
+	}}
+}
+
+// Onset returns the time to the first throttle, or -1 if there was none.
+func (t *ThrottleCounter) Onset() time.Duration {
+	first := atomic.LoadInt64(&t.first)
+	if first == 0 {
+		return -1
+	}
+	return time.Duration(first - 1)
+}
+
+// billing returns the billing mode and the provisioned read and write
+// capacity of table, including its global secondary indexes.
+func billing(db *dynamodb.DynamoDB, table string) (*dynamodb.TableDescription, string, int64, int64, error) {
+	out, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+	desc := out.Table
+	mode := dynamodb.BillingModeProvisioned
+	if desc.BillingModeSummary != nil && aws.StringValue(desc.BillingModeSummary.BillingMode) != "" {
+		mode = aws.StringValue(desc.BillingModeSummary.BillingMode)
+	}
+	if mode == dynamodb.BillingModePayPerRequest {
+		return desc, "on-demand", 0, 0, nil
+	}
+	var rcu, wcu int64
+	if pt := desc.ProvisionedThroughput; pt != nil {
+		rcu += aws.Int64Value(pt.ReadCapacityUnits)
+		wcu += aws.Int64Value(pt.WriteCapacityUnits)
+	}
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		if pt := gsi.ProvisionedThroughput; pt != nil {
+			rcu += aws.Int64Value(pt.ReadCapacityUnits)
+			wcu += aws.Int64Value(pt.WriteCapacityUnits)
+		}
+	}
+	return desc, "provisioned", rcu, wcu, nil
+}
+
+// reconfigure switches the table of p to its billing mode, giving every
+// global secondary index the capacity of the table, and waits until the
+// table and its indexes are active again. Note that DynamoDB limits how
+// often the billing mode of a table can be changed.
+func (c *DynamoDBBenchmark) reconfigure(db *dynamodb.DynamoDB, p ComparePhase) error {
+	desc, mode, _, _, err := billing(db, p.Table)
+	if err != nil {
+		return err
+	}
+	in := &dynamodb.UpdateTableInput{TableName: aws.String(p.Table)}
+	switch {
+	case p.Billing == "on-demand" && mode == "on-demand":
+		return nil
+	case p.Billing == "on-demand":
+		in.BillingMode = aws.String(dynamodb.BillingModePayPerRequest)
+	default:
+		// UpdateTable fails when nothing changes.
+		if cur := desc.ProvisionedThroughput; mode == "provisioned" && cur != nil &&
+			aws.Int64Value(cur.ReadCapacityUnits) == p.ReadCapacity && aws.Int64Value(cur.WriteCapacityUnits) == p.WriteCapacity {
+			return nil
+		}
+		pt := &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(p.ReadCapacity),
+			WriteCapacityUnits: aws.Int64(p.WriteCapacity),
+		}
+		in.BillingMode = aws.String(dynamodb.BillingModeProvisioned)
+		in.ProvisionedThroughput = pt
+		for _, gsi := range desc.GlobalSecondaryIndexes {
+			in.GlobalSecondaryIndexUpdates = append(in.GlobalSecondaryIndexUpdates, &dynamodb.GlobalSecondaryIndexUpdate{
+				Update: &dynamodb.UpdateGlobalSecondaryIndexAction{IndexName: gsi.IndexName, ProvisionedThroughput: pt},
+			})
+		}
+	}
+	if c.Verbose {
+		fmt.Printf("[Verbose] Switching table %s to %s\n", p.Table, p.Billing)
+	}
+	if _, err := db.UpdateTable(in); err != nil {
+		return fmt.Errorf("failed to switch table %s to %s: %v", p.Table, p.Billing, err)
+	}
+	for {
+		out, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(p.Table)})
+		if err != nil {
+			return err
+		}
+		active := aws.StringValue(out.Table.TableStatus) == dynamodb.TableStatusActive
+		for _, gsi := range out.Table.GlobalSecondaryIndexes {
+			active = active && aws.StringValue(gsi.IndexStatus) == dynamodb.IndexStatusActive
+		}
+		if active {
+			return nil
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// RunCompare runs the same workload once per -compare phase, e.g. against a
+// provisioned and an on-demand table, and prints throttling, latency and the
+// estimated cost of every phase side by side.
+func (c *DynamoDBBenchmark) RunCompare() error {
+	phases, err := parseComparePhases(c.Compare, c.TableName)
+	if err != nil {
+		return err
+	}
+	prices, err := parseComparePrices(c.ComparePrices)
+	if err != nil {
+		return err
+	}
+	c.clock = NewClock()
+	db, err := getDynamoDBClient(c.clientOptions())
+	if err != nil {
+		return err
+	}
+	c.health.SetReady()
+
+	var results []CompareResult
+	for i, p := range phases {
+		if i > 0 && c.ComparePause > 0 {
+			time.Sleep(c.ComparePause)
+		}
+		if p.Billing != "" {
+			if err := c.reconfigure(db, p); err != nil {
+				return err
+			}
+		}
+		_, mode, rcu, wcu, err := billing(db, p.Table)
+		if err != nil {
+			return fmt.Errorf("failed to describe table %s: %v", p.Table, err)
+		}
+		if c.Verbose {
+			fmt.Printf("[Verbose] Compare phase %d: table %s (%s)\n", i+1, p.Table, mode)
+		}
+		r, err := c.comparePhase(p.Table)
+		if err != nil {
+			return err
+		}
+		r.BillingMode, r.ReadCapacity, r.WriteCapacity = mode, rcu, wcu
+		if mode == "on-demand" {
+			price := prices["rru"]
+			if c.Action == "write" {
+				price = prices["wru"]
+			}
+			r.CostUSD = r.CapacityUnits * price / 1e6
+		} else {
+			hours := r.DurationSec / 3600
+			r.CostUSD = (float64(rcu)*prices["rcu-hour"] + float64(wcu)*prices["wcu-hour"]) * hours
+		}
+		if r.Success > 0 {
+			r.CostPerMillionUSD = r.CostUSD / float64(r.Success) * 1e6
+		}
+		if len(results) > 0 {
+			throughput := welchTest("requests_per_sec", results[0].intervalThroughput, r.intervalThroughput)
+			latency := welchTest("average_ms", results[0].intervalLatency, r.intervalLatency)
+			r.Throughput, r.Latency = &throughput, &latency
+		}
+		results = append(results, r)
+	}
+	printCompare(c.RunID, c.Action, results)
+	return nil
+}
+
+// comparePhase runs the workload against table with a fresh copy of the
+// benchmark.
+func (c *DynamoDBBenchmark) comparePhase(table string) (CompareResult, error) {
+	step := *c
+	step.TableName = table
+	step.ConsumedCapacity = true
+	step.clock = NewClock()
+	step.breaker = nil
+	step.limiter = nil
+	step.control = nil
+	step.history = nil
+	step.contention = nil
+	step.conns = nil
+	step.breakdown = nil
+	if c.Rate > 0 {
+		step.limiter = NewRateLimiter(c.Rate)
+	}
+	if c.Reset {
+		if err := step.resetItem(); err != nil {
+			return CompareResult{}, err
+		}
+	}
+
+	stats := NewStats()
+	stats.Start()
+	step.throttles = NewThrottleCounter()
+	if c.Duration > 0 {
+		step.deadline = time.Now().Add(c.Duration)
+	}
+	var wg sync.WaitGroup
+	for i := 1; i <= c.Connections; i++ {
+		wg.Add(1)
+		if c.Action == "read" {
+			go step.startReadWorker(i, &wg, stats.Worker(i))
+		} else {
+			go step.startWriteWorker(i, &wg, stats.Worker(i))
+		}
+	}
+	// Sample the full intervals only; the last, partial one would skew the
+	// throughput.
+	var throughput, latency runningMean
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(compareInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				sum := stats.IntervalSummary(c.Action)
+				throughput.add(sum.RequestsPerSecond)
+				if sum.Success > 0 {
+					latency.add(sum.AverageMs)
+				}
+			}
+		}
+	}()
+	wg.Wait()
+	close(done)
+	<-sampled
+	stats.Stop()
+
+	sum := stats.Summary(c.Action)
+	r := CompareResult{
+		Table:             table,
+		Success:           sum.Success,
+		Errors:            sum.Errors,
+		Requests:          sum.Success + sum.Errors,
+		Throttles:         atomic.LoadUint64(&step.throttles.count),
+		ThrottleOnsetSec:  -1,
+		DurationSec:       sum.DurationSec,
+		RequestsPerSecond: sum.RequestsPerSecond,
+		AverageMs:         sum.AverageMs,
+
+		intervalThroughput: throughput,
+		intervalLatency:    latency,
+	}
+	if onset := step.throttles.Onset(); onset >= 0 {
+		r.ThrottleOnsetSec = onset.Seconds()
+	}
+	r.ThrottleRate = ratio(r.Throttles, r.Requests+r.Throttles)
+	for _, op := range sum.Operations {
+		r.P50Ms = op.P50Ms
+		r.P99Ms = op.P99Ms
+		if op.Capacity != nil {
+			r.CapacityUnits = op.Capacity.TotalUnits
+		}
+	}
+	return r, nil
+}
+
+func printCompare(runID string, action string, results []CompareResult) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Comparison - %s\n", action)
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", runID)
+	fmt.Printf("%-24s %-24s %10s %8s %10s %9s %9s %12s %9s %9s %10s %10s %12s\n",
+		"table", "billing", "requests", "errors", "throttles", "throttle", "onset_s", "requests/s",
+		"p50_ms", "p99_ms", "units", "cost_usd", "usd/million")
+	for _, r := range results {
+		mode := r.BillingMode
+		if mode == "provisioned" {
+			mode = fmt.Sprintf("provisioned %d/%d", r.ReadCapacity, r.WriteCapacity)
+		}
+		onset := "-"
+		if r.ThrottleOnsetSec >= 0 {
+			onset = fmt.Sprintf("%.1f", r.ThrottleOnsetSec)
+		}
+		fmt.Printf("%-24s %-24s %10d %8d %10d %8.2f%% %9s %12.1f %9.3f %9.3f %10.1f %10.6f %12.4f\n",
+			r.Table, mode, r.Requests, r.Errors, r.Throttles, r.ThrottleRate*100, onset, r.RequestsPerSecond,
+			r.P50Ms, r.P99Ms, r.CapacityUnits, r.CostUSD, r.CostPerMillionUSD)
+	}
+	for i, r := range results[1:] {
+		fmt.Printf("Phase %d (%s) - phase 1 (%s) over %s intervals (Welch's t-test):\n", i+2, r.Table, results[0].Table, compareInterval)
+		fmt.Printf("  requests/s: %s\n", r.Throughput)
+		fmt.Printf("  avg_ms:     %s\n", r.Latency)
+	}
+	fmt.Println("Costs are estimates: on-demand from the consumed request units, provisioned from the")
+	fmt.Println("provisioned capacity (table and global secondary indexes) over the duration of the phase")
+}
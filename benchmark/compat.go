@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	compatOK      = "OK"
+	compatFail    = "FAIL"
+	compatSkipped = "SKIPPED"
+)
+
+type CompatResult struct {
+	Feature string
+	Status  string
+	Latency time.Duration
+	Err     error
+}
+
+type compatCheck struct {
+	feature string
+	// requires lists the features that must have passed for this check to
+	// make sense, e.g. nothing works without the scratch table.
+	requires []string
+	run      func() error
+}
+
+func compatKey(id string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"id": {S: aws.String(id)},
+	}
+}
+
+// expectConditionalFailure turns the expected ConditionalCheckFailedException
+// into success and anything else, including no error, into a failure.
+func expectConditionalFailure(err error) error {
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	if err == nil {
+		return fmt.Errorf("expected %s but the update succeeded", dynamodb.ErrCodeConditionalCheckFailedException)
+	}
+	return err
+}
+
+// RunCompatCheck runs a small battery of operations the benchmark relies on
+// against a scratch table and reports which of them the endpoint supports.
+// It is meant for DynamoDB-compatible endpoints such as ScyllaDB Alternator
+// or LocalStack.
+func (c *DynamoDBBenchmark) RunCompatCheck() ([]CompatResult, error) {
+	db, err := getDynamoDBClient(c.clientOptions())
+	if err != nil {
+		return nil, err
+	}
+	table := aws.String(fmt.Sprintf("%s-compat-%d", c.TableName, time.Now().Unix()))
+	one := &dynamodb.AttributeValue{N: aws.String("1")}
+	scratch := Resource{Kind: resourceTable, Name: *table}
+
+	checks := []compatCheck{
+		{"CreateTable", nil, func() error {
+			_, err := db.CreateTable(&dynamodb.CreateTableInput{
+				TableName: table,
+				AttributeDefinitions: []*dynamodb.AttributeDefinition{
+					{AttributeName: aws.String("id"), AttributeType: aws.String("S")},
+				},
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{AttributeName: aws.String("id"), KeyType: aws.String("HASH")},
+				},
+				ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(5),
+					WriteCapacityUnits: aws.Int64(5),
+				},
+			})
+			if err != nil {
+				return err
+			}
+			c.resources.Track(scratch)
+			return db.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: table})
+		}},
+		{"PutItem", []string{"CreateTable"}, func() error {
+			_, err := db.PutItem(&dynamodb.PutItemInput{
+				TableName: table,
+				Item: map[string]*dynamodb.AttributeValue{
+					"id":  {S: aws.String("compat-1")},
+					"age": one,
+				},
+			})
+			return err
+		}},
+		{"GetItem (consistent read)", []string{"PutItem"}, func() error {
+			out, err := db.GetItem(&dynamodb.GetItemInput{
+				TableName:      table,
+				Key:            compatKey("compat-1"),
+				ConsistentRead: aws.Bool(true),
+			})
+			if err == nil && out.Item == nil {
+				return fmt.Errorf("item written by PutItem was not found")
+			}
+			return err
+		}},
+		{"UpdateItem (increment)", []string{"PutItem"}, func() error {
+			_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+				TableName:                 table,
+				Key:                       compatKey("compat-1"),
+				UpdateExpression:          aws.String("set age = age + :inc"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":inc": one},
+				ReturnValues:              aws.String("ALL_NEW"),
+			})
+			return err
+		}},
+		{"UpdateItem (condition passes)", []string{"PutItem"}, func() error {
+			_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+				TableName:           table,
+				Key:                 compatKey("compat-1"),
+				UpdateExpression:    aws.String("set age = age + :inc"),
+				ConditionExpression: aws.String("age < :max"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":inc": one,
+					":max": {N: aws.String("1000")},
+				},
+			})
+			return err
+		}},
+		{"UpdateItem (condition fails)", []string{"PutItem"}, func() error {
+			_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+				TableName:           table,
+				Key:                 compatKey("compat-1"),
+				UpdateExpression:    aws.String("set age = age + :inc"),
+				ConditionExpression: aws.String("age < :max"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":inc": one,
+					":max": {N: aws.String("0")},
+				},
+			})
+			return expectConditionalFailure(err)
+		}},
+		{"TransactWriteItems", []string{"PutItem"}, func() error {
+			_, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+				TransactItems: []*dynamodb.TransactWriteItem{
+					{
+						Update: &dynamodb.Update{
+							TableName:                 table,
+							Key:                       compatKey("compat-1"),
+							UpdateExpression:          aws.String("set age = age + :inc"),
+							ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":inc": one},
+						},
+					},
+					{
+						Put: &dynamodb.Put{
+							TableName: table,
+							Item: map[string]*dynamodb.AttributeValue{
+								"id":  {S: aws.String("compat-2")},
+								"age": one,
+							},
+						},
+					},
+				},
+			})
+			return err
+		}},
+		{"TransactGetItems", []string{"PutItem"}, func() error {
+			_, err := db.TransactGetItems(&dynamodb.TransactGetItemsInput{
+				TransactItems: []*dynamodb.TransactGetItem{
+					{Get: &dynamodb.Get{TableName: table, Key: compatKey("compat-1")}},
+				},
+			})
+			return err
+		}},
+		{"BatchWriteItem", []string{"CreateTable"}, func() error {
+			var requests []*dynamodb.WriteRequest
+			for i := 3; i <= 5; i++ {
+				requests = append(requests, &dynamodb.WriteRequest{
+					PutRequest: &dynamodb.PutRequest{
+						Item: map[string]*dynamodb.AttributeValue{
+							"id":  {S: aws.String(fmt.Sprintf("compat-%d", i))},
+							"age": one,
+						},
+					},
+				})
+			}
+			_, err := db.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]*dynamodb.WriteRequest{*table: requests},
+			})
+			return err
+		}},
+		{"BatchGetItem", []string{"BatchWriteItem"}, func() error {
+			var keys []map[string]*dynamodb.AttributeValue
+			for i := 3; i <= 5; i++ {
+				keys = append(keys, compatKey(fmt.Sprintf("compat-%d", i)))
+			}
+			_, err := db.BatchGetItem(&dynamodb.BatchGetItemInput{
+				RequestItems: map[string]*dynamodb.KeysAndAttributes{*table: {Keys: keys}},
+			})
+			return err
+		}},
+		{"Query", []string{"PutItem"}, func() error {
+			_, err := db.Query(&dynamodb.QueryInput{
+				TableName:                 table,
+				KeyConditionExpression:    aws.String("id = :id"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":id": {S: aws.String("compat-1")}},
+			})
+			return err
+		}},
+		{"Scan", []string{"CreateTable"}, func() error {
+			_, err := db.Scan(&dynamodb.ScanInput{TableName: table, Limit: aws.Int64(10)})
+			return err
+		}},
+		{"DeleteItem", []string{"PutItem"}, func() error {
+			_, err := db.DeleteItem(&dynamodb.DeleteItemInput{TableName: table, Key: compatKey("compat-1")})
+			return err
+		}},
+		{"DeleteTable", []string{"CreateTable"}, func() error {
+			_, err := db.DeleteTable(&dynamodb.DeleteTableInput{TableName: table})
+			if err == nil {
+				c.resources.Untrack(scratch)
+			}
+			return err
+		}},
+	}
+
+	passed := map[string]bool{}
+	var results []CompatResult
+	for _, check := range checks {
+		result := CompatResult{Feature: check.feature, Status: compatSkipped}
+		runnable := true
+		for _, req := range check.requires {
+			if !passed[req] {
+				runnable = false
+				result.Err = fmt.Errorf("requires %s", req)
+				break
+			}
+		}
+		if runnable {
+			start := time.Now()
+			err := check.run()
+			result.Latency = time.Since(start)
+			result.Err = err
+			if err == nil {
+				result.Status = compatOK
+				passed[check.feature] = true
+			} else {
+				result.Status = compatFail
+			}
+		}
+		if c.Verbose {
+			fmt.Printf("[Verbose] %s: %s (%v)\n", result.Feature, result.Status, result.Latency)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func printCompatResults(endpoint string, results []CompatResult) {
+	if endpoint == "" {
+		endpoint = "(AWS SDK default)"
+	}
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Compatibility Check - %s\n", endpoint)
+	fmt.Println("-----------------------")
+	supported := 0
+	for _, r := range results {
+		line := fmt.Sprintf("%-32s %-8s", r.Feature, r.Status)
+		if r.Status != compatSkipped {
+			line += fmt.Sprintf(" %8.1f ms", durationMs(r.Latency))
+		}
+		if r.Err != nil {
+			line += fmt.Sprintf("  %v", r.Err)
+		}
+		fmt.Println(line)
+		if r.Status == compatOK {
+			supported++
+		}
+	}
+	fmt.Printf("Supported: %d/%d\n", supported, len(results))
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/klauspost/compress/zstd"
+)
+
+// payloadAttribute is the attribute -update payload writes the sample of
+// -payload-file to, and the read action decompresses.
+const payloadAttribute = "payload"
+
+// compressionAlgorithms are the values of -compress.
+var compressionAlgorithms = []string{"none", "gzip", "zstd"}
+
+// compressionProfileTime is how long each algorithm compresses and
+// decompresses the sample for the profile of -payload-file.
+const compressionProfileTime = 200 * time.Millisecond
+
+// checkCompressionLevel checks -compress-level for the algorithm, 0 being
+// the default level of the algorithm.
+func checkCompressionLevel(algorithm string, level int) error {
+	switch algorithm {
+	case "none":
+		if level != 0 {
+			return fmt.Errorf("-compress-level needs -compress gzip or zstd")
+		}
+	case "gzip":
+		if level < 0 || level > gzip.BestCompression {
+			return fmt.Errorf("-compress-level of gzip must be between 1 and 9, or 0 for the default (got %d)", level)
+		}
+	case "zstd":
+		if level < 0 || level > 22 {
+			return fmt.Errorf("-compress-level of zstd must be between 1 and 22, or 0 for the default (got %d)", level)
+		}
+	default:
+		return fmt.Errorf("-compress must be one of: none, gzip, zstd (got %q)", algorithm)
+	}
+	return nil
+}
+
+// codec compresses and decompresses payloads with one algorithm. Both are
+// safe for concurrent use; compress cannot fail at a level
+// checkCompressionLevel accepts.
+type codec struct {
+	compress   func([]byte) []byte
+	decompress func([]byte) ([]byte, error)
+}
+
+func newCodec(algorithm string, level int) (*codec, error) {
+	switch algorithm {
+	case "gzip":
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return &codec{
+			compress: func(b []byte) []byte {
+				var buf bytes.Buffer
+				w, _ := gzip.NewWriterLevel(&buf, level)
+				w.Write(b)
+				w.Close()
+				return buf.Bytes()
+			},
+			decompress: func(b []byte) ([]byte, error) {
+				r, err := gzip.NewReader(bytes.NewReader(b))
+				if err != nil {
+					return nil, err
+				}
+				return io.ReadAll(r)
+			},
+		}, nil
+	case "zstd":
+		opts := []zstd.EOption{}
+		if level > 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		enc, err := zstd.NewWriter(nil, opts...)
+		if err != nil {
+			return nil, err
+		}
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		return &codec{
+			compress: func(b []byte) []byte {
+				return enc.EncodeAll(b, nil)
+			},
+			decompress: func(b []byte) ([]byte, error) {
+				return dec.DecodeAll(b, nil)
+			},
+		}, nil
+	}
+	return &codec{
+		compress:   func(b []byte) []byte { return b },
+		decompress: func(b []byte) ([]byte, error) { return b, nil },
+	}, nil
+}
+
+// payloadUnits estimates the write units and the eventually consistent read
+// units of the item "id" = id, "age", payloadAttribute = a value of size
+// bytes: the lengths of the attribute names and values, the number taking
+// at most 21 bytes.
+func payloadUnits(id string, size int) (float64, float64) {
+	n := len("id") + len(id) + len("age") + 21 + len(payloadAttribute) + size
+	return math.Ceil(float64(n) / 1024), math.Ceil(float64(n)/4096) / 2
+}
+
+// CompressionProfile is how one algorithm did on the sample of -payload-file
+// before the run.
+type CompressionProfile struct {
+	Algorithm    string  `json:"algorithm"`
+	Bytes        int     `json:"bytes"`
+	Ratio        float64 `json:"ratio"`
+	CompressMs   float64 `json:"compress_ms"`
+	DecompressMs float64 `json:"decompress_ms"`
+	WriteUnits   float64 `json:"write_units"`
+	ReadUnits    float64 `json:"read_units"`
+}
+
+func (p CompressionProfile) String() string {
+	return fmt.Sprintf("%s: %d bytes (x%.2f), compress (ms): %.3f, decompress (ms): %.3f, per item %.0f WCU / %.1f RCU",
+		p.Algorithm, p.Bytes, p.Ratio, p.CompressMs, p.DecompressMs, p.WriteUnits, p.ReadUnits)
+}
+
+// profileCompression compresses and decompresses sample with every algorithm
+// at level (the default level of the algorithms level does not apply to)
+// for compressionProfileTime each.
+func profileCompression(sample []byte, id string, level int) ([]CompressionProfile, error) {
+	var profiles []CompressionProfile
+	for _, algorithm := range compressionAlgorithms {
+		l := level
+		if checkCompressionLevel(algorithm, l) != nil {
+			l = 0
+		}
+		cd, err := newCodec(algorithm, l)
+		if err != nil {
+			return nil, err
+		}
+		var out []byte
+		n, start := 0, time.Now()
+		for ; n == 0 || time.Since(start) < compressionProfileTime; n++ {
+			out = cd.compress(sample)
+		}
+		compress := time.Since(start) / time.Duration(n)
+		n, start = 0, time.Now()
+		for ; n == 0 || time.Since(start) < compressionProfileTime; n++ {
+			if _, err := cd.decompress(out); err != nil {
+				return nil, fmt.Errorf("%s: %v", algorithm, err)
+			}
+		}
+		decompress := time.Since(start) / time.Duration(n)
+		wcu, rcu := payloadUnits(id, len(out))
+		profiles = append(profiles, CompressionProfile{
+			Algorithm:    algorithm,
+			Bytes:        len(out),
+			Ratio:        float64(len(sample)) / float64(len(out)),
+			CompressMs:   durationMs(compress),
+			DecompressMs: durationMs(decompress),
+			WriteUnits:   wcu,
+			ReadUnits:    rcu,
+		})
+	}
+	return profiles, nil
+}
+
+// CompressionSummary is the outcome of -compress: the size of the payloads,
+// the time spent compressing and decompressing them, and the capacity units
+// they consumed against what the uncompressed payloads would have.
+type CompressionSummary struct {
+	Algorithm   string `json:"algorithm"`
+	Level       int    `json:"level,omitempty"`
+	SampleBytes int    `json:"sample_bytes"`
+	// Profile compares all algorithms on the sample before the run.
+	Profile []CompressionProfile `json:"profile"`
+
+	Writes      uint64  `json:"writes"`
+	StoredBytes int     `json:"stored_bytes"`
+	Ratio       float64 `json:"ratio"`
+	// CompressAverageMs and CompressCPUSec are the time spent in the
+	// compression of the payloads, per write and in total.
+	CompressAverageMs float64 `json:"compress_average_ms"`
+	CompressCPUSec    float64 `json:"compress_cpu_sec"`
+	// WriteUnits is the estimate of the write units the writes consumed,
+	// WriteUnitsUncompressed of those they would have, and WriteUnitsSaved
+	// the share saved.
+	WriteUnits             float64 `json:"write_units"`
+	WriteUnitsUncompressed float64 `json:"write_units_uncompressed"`
+	WriteUnitsSaved        float64 `json:"write_units_saved"`
+
+	Reads uint64 `json:"reads"`
+	// Missing counts the reads of items without a binary payload to
+	// decompress, e.g. written without -compress.
+	Missing             uint64  `json:"missing"`
+	DecodeErrors        uint64  `json:"decode_errors"`
+	DecompressAverageMs float64 `json:"decompress_average_ms"`
+	DecompressCPUSec    float64 `json:"decompress_cpu_sec"`
+	// ReadUnits are those of eventually consistent reads.
+	ReadUnits             float64 `json:"read_units"`
+	ReadUnitsUncompressed float64 `json:"read_units_uncompressed"`
+	ReadUnitsSaved        float64 `json:"read_units_saved"`
+}
+
+func (s *CompressionSummary) Print() {
+	level := ""
+	if s.Level > 0 {
+		level = fmt.Sprintf(" level %d", s.Level)
+	}
+	fmt.Printf("Compression: %s%s, sample %d bytes\n", s.Algorithm, level, s.SampleBytes)
+	for _, p := range s.Profile {
+		fmt.Printf("  [profile] %s\n", p)
+	}
+	if s.Writes > 0 {
+		fmt.Printf("  writes %d: stored %d bytes (x%.2f), compress average (ms): %.3f, CPU %.3fs; write units %.0f vs %.0f uncompressed (%.2f%% saved)\n",
+			s.Writes, s.StoredBytes, s.Ratio, s.CompressAverageMs, s.CompressCPUSec, s.WriteUnits, s.WriteUnitsUncompressed, 100*s.WriteUnitsSaved)
+	}
+	if s.Reads > 0 {
+		fmt.Printf("  reads %d (missing %d, decode errors %d): decompress average (ms): %.3f, CPU %.3fs; read units %.1f vs %.1f uncompressed (%.2f%% saved)\n",
+			s.Reads, s.Missing, s.DecodeErrors, s.DecompressAverageMs, s.DecompressCPUSec, s.ReadUnits, s.ReadUnitsUncompressed, 100*s.ReadUnitsSaved)
+	}
+}
+
+// Compression compresses the payloads of -update payload and decompresses
+// those the read action reads with -compress, and records the cost. A nil
+// *Compression does nothing.
+type Compression struct {
+	algorithm string
+	level     int
+	id        string
+	sample    []byte
+	codec     *codec
+	profile   []CompressionProfile
+
+	mu           sync.Mutex
+	writes       uint64
+	stored       int
+	compressTime time.Duration
+	writeUnits   float64
+	writeRaw     float64
+
+	reads          uint64
+	missing        uint64
+	decodeErrors   uint64
+	decompressTime time.Duration
+	readUnits      float64
+	readRaw        float64
+}
+
+// newCompression reads the sample of -payload-file and profiles the
+// algorithms on it.
+func (c *DynamoDBBenchmark) newCompression() (*Compression, error) {
+	sample, err := os.ReadFile(c.PayloadFile)
+	if err != nil {
+		return nil, err
+	}
+	cd, err := newCodec(c.Compress, c.CompressLevel)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := profileCompression(sample, c.Id, c.CompressLevel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to profile the compression of %s: %v", c.PayloadFile, err)
+	}
+	return &Compression{
+		algorithm: c.Compress,
+		level:     c.CompressLevel,
+		id:        c.Id,
+		sample:    sample,
+		codec:     cd,
+		profile:   profile,
+	}, nil
+}
+
+// Payload compresses the sample for one write and returns the value to
+// write: binary if compressed, the sample as a string otherwise.
+func (cp *Compression) Payload() *dynamodb.AttributeValue {
+	start := time.Now()
+	out := cp.codec.compress(cp.sample)
+	elapsed := time.Since(start)
+	wcu, _ := payloadUnits(cp.id, len(out))
+	raw, _ := payloadUnits(cp.id, len(cp.sample))
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.writes++
+	cp.stored = len(out)
+	cp.compressTime += elapsed
+	cp.writeUnits += wcu
+	cp.writeRaw += raw
+	if cp.algorithm == "none" {
+		return &dynamodb.AttributeValue{S: aws.String(string(out))}
+	}
+	return &dynamodb.AttributeValue{B: out}
+}
+
+// Read decompresses the payload of an item read.
+func (cp *Compression) Read(item map[string]*dynamodb.AttributeValue) error {
+	if cp == nil || len(item) == 0 {
+		return nil
+	}
+	v := item[payloadAttribute]
+	if cp.algorithm == "none" {
+		if v == nil || v.S == nil {
+			cp.count(func() { cp.missing++ })
+			return nil
+		}
+		_, rcu := payloadUnits(cp.id, len(*v.S))
+		cp.count(func() { cp.readUnits += rcu; cp.readRaw += rcu })
+		return nil
+	}
+	if v == nil || v.B == nil {
+		cp.count(func() { cp.missing++ })
+		return nil
+	}
+	start := time.Now()
+	out, err := cp.codec.decompress(v.B)
+	elapsed := time.Since(start)
+	if err != nil {
+		cp.count(func() { cp.decodeErrors++ })
+		return fmt.Errorf("failed to decompress the %s payload: %v", cp.algorithm, err)
+	}
+	_, rcu := payloadUnits(cp.id, len(v.B))
+	_, raw := payloadUnits(cp.id, len(out))
+	cp.count(func() {
+		cp.decompressTime += elapsed
+		cp.readUnits += rcu
+		cp.readRaw += raw
+	})
+	return nil
+}
+
+// count counts one read with f under the lock.
+func (cp *Compression) count(f func()) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.reads++
+	f()
+}
+
+func (cp *Compression) Summary() *CompressionSummary {
+	if cp == nil {
+		return nil
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	s := &CompressionSummary{
+		Algorithm:              cp.algorithm,
+		Level:                  cp.level,
+		SampleBytes:            len(cp.sample),
+		Profile:                cp.profile,
+		Writes:                 cp.writes,
+		StoredBytes:            cp.stored,
+		CompressAverageMs:      averageMs(cp.compressTime, cp.writes),
+		CompressCPUSec:         cp.compressTime.Seconds(),
+		WriteUnits:             cp.writeUnits,
+		WriteUnitsUncompressed: cp.writeRaw,
+		Reads:                  cp.reads,
+		Missing:                cp.missing,
+		DecodeErrors:           cp.decodeErrors,
+		DecompressAverageMs:    averageMs(cp.decompressTime, cp.reads-cp.missing-cp.decodeErrors),
+		DecompressCPUSec:       cp.decompressTime.Seconds(),
+		ReadUnits:              cp.readUnits,
+		ReadUnitsUncompressed:  cp.readRaw,
+	}
+	if cp.stored > 0 {
+		s.Ratio = float64(len(cp.sample)) / float64(cp.stored)
+	}
+	if cp.writeRaw > 0 {
+		s.WriteUnitsSaved = 1 - cp.writeUnits/cp.writeRaw
+	}
+	if cp.readRaw > 0 {
+		s.ReadUnitsSaved = 1 - cp.readUnits/cp.readRaw
+	}
+	return s
+}
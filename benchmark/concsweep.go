@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// concurrencyChartWidth is the length of the longest bar of the charts of
+// -concurrency-sweep.
+const concurrencyChartWidth = 40
+
+// ConcurrencyLevel is the outcome of the workload with one number of
+// sessions.
+type ConcurrencyLevel struct {
+	Connections       int     `json:"connections"`
+	Requests          uint64  `json:"requests"`
+	Errors            uint64  `json:"errors"`
+	Throttles         uint64  `json:"throttles"`
+	RequestsPerSecond float64 `json:"requests_per_sec"`
+	AverageMs         float64 `json:"average_ms"`
+	P50Ms             float64 `json:"p50_ms"`
+	P90Ms             float64 `json:"p90_ms"`
+	P99Ms             float64 `json:"p99_ms"`
+}
+
+// parseConcurrencyLevels parses -concurrency-sweep: comma separated numbers
+// of sessions, where "<from>..<to>" doubles from from up to and including
+// to, e.g. "1..256" or "1,5,10,20..160".
+func parseConcurrencyLevels(spec string) ([]int, error) {
+	return parseLevels(spec, "sessions")
+}
+
+// parseLevels parses a list of increasing levels like -concurrency-sweep,
+// what is the thing being counted for the errors.
+func parseLevels(spec string, what string) ([]int, error) {
+	var levels []int
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		bounds := strings.SplitN(entry, "..", 2)
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil || from < 1 {
+			return nil, fmt.Errorf("%q: the number of %s must be more than 0", entry, what)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.Atoi(bounds[1]); err != nil || to < from {
+				return nil, fmt.Errorf("%q: must be <from>..<to> with to at least from", entry)
+			}
+		}
+		for n := from; n < to; n *= 2 {
+			levels = append(levels, n)
+		}
+		levels = append(levels, to)
+	}
+	for i := 1; i < len(levels); i++ {
+		if levels[i] <= levels[i-1] {
+			return nil, fmt.Errorf("the numbers of %s must increase, got %d after %d", what, levels[i], levels[i-1])
+		}
+	}
+	return levels, nil
+}
+
+// RunConcurrencySweep runs the read or write workload for -concurrency-step
+// with every number of sessions of -concurrency-sweep and prints throughput
+// and latency per level as a table and as charts, i.e. the latency vs
+// concurrency curve.
+func (c *DynamoDBBenchmark) RunConcurrencySweep() error {
+	levels, err := parseConcurrencyLevels(c.ConcurrencySweep)
+	if err != nil {
+		return err
+	}
+	if c.Reset {
+		if err := c.resetItem(); err != nil {
+			return err
+		}
+	}
+	c.health.SetReady()
+
+	var results []ConcurrencyLevel
+	for _, n := range levels {
+		if c.Verbose {
+			fmt.Printf("[Verbose] Concurrency sweep: %d sessions\n", n)
+		}
+		results = append(results, c.concurrencyLevel(n))
+		if atomic.LoadInt32(c.stopped) != 0 {
+			break
+		}
+	}
+	printConcurrencySweep(c.RunID, c.Action, c.ConcurrencyStep, results)
+	return nil
+}
+
+// concurrencyLevel runs the workload with the given number of sessions with
+// a fresh copy of the benchmark.
+func (c *DynamoDBBenchmark) concurrencyLevel(sessions int) ConcurrencyLevel {
+	step := c.sweepStep(c.ConcurrencyStep)
+	level, _ := step.runLevel(sessions)
+	return level
+}
+
+// sweepStep is a copy of the benchmark for one level of a sweep, running
+// for the given duration without the components which follow a whole run.
+func (c *DynamoDBBenchmark) sweepStep(duration time.Duration) *DynamoDBBenchmark {
+	step := *c
+	step.Duration = duration
+	step.clock = NewClock()
+	step.breaker = nil
+	step.limiter = nil
+	step.control = nil
+	step.history = nil
+	step.contention = nil
+	step.conns = nil
+	step.breakdown = nil
+	if c.Rate > 0 {
+		step.limiter = NewRateLimiter(c.Rate)
+	}
+	return &step
+}
+
+// runLevel runs the read or write workload of a sweepStep with the given
+// number of sessions and returns its outcome and summary.
+func (c *DynamoDBBenchmark) runLevel(sessions int) (ConcurrencyLevel, Summary) {
+	c.Connections = sessions
+	stats := NewStats()
+	stats.SetTimeline(c.timeline)
+	stats.Start()
+	c.throttles = NewThrottleCounter()
+	c.deadline = time.Now().Add(c.Duration)
+	var wg sync.WaitGroup
+	for i := 1; i <= sessions; i++ {
+		wg.Add(1)
+		if c.Action == "read" && c.shards != nil {
+			go c.startShardReadWorker(i, &wg, stats.Worker(i))
+		} else if c.Action == "read" {
+			go c.startReadWorker(i, &wg, stats.Worker(i))
+		} else {
+			go c.startWriteWorker(i, &wg, stats.Worker(i))
+		}
+	}
+	wg.Wait()
+	stats.Stop()
+
+	sum := stats.Summary(c.Action)
+	level := ConcurrencyLevel{
+		Connections:       sessions,
+		Requests:          sum.Success + sum.Errors,
+		Errors:            sum.Errors,
+		Throttles:         atomic.LoadUint64(&c.throttles.count),
+		RequestsPerSecond: sum.RequestsPerSecond,
+		AverageMs:         sum.AverageMs,
+	}
+	for _, op := range sum.Operations {
+		level.P50Ms = op.P50Ms
+		level.P90Ms = op.P90Ms
+		level.P99Ms = op.P99Ms
+	}
+	return level, sum
+}
+
+// bar is a horizontal bar of value, in eighths of a character, on a scale
+// where max fills width, padded to width.
+func bar(value, max float64, width int) string {
+	eighths := 0
+	if max > 0 {
+		eighths = int(value / max * float64(width*8))
+	}
+	b := strings.Repeat("█", eighths/8)
+	cells := eighths / 8
+	if rest := eighths % 8; rest > 0 {
+		b += string(rune('█' + 8 - rest))
+		cells++
+	}
+	return b + strings.Repeat(" ", width-cells)
+}
+
+func printConcurrencySweep(runID string, action string, step time.Duration, levels []ConcurrencyLevel) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Concurrency Sweep - %s (%s per level)\n", action, step)
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", runID)
+	fmt.Printf("%12s %10s %8s %10s %12s %10s %9s %9s %9s\n",
+		"connections", "requests", "errors", "throttles", "requests/s", "avg_ms", "p50_ms", "p90_ms", "p99_ms")
+	var maxRate, maxP99 float64
+	for _, l := range levels {
+		fmt.Printf("%12d %10d %8d %10d %12.1f %10.3f %9.3f %9.3f %9.3f\n",
+			l.Connections, l.Requests, l.Errors, l.Throttles, l.RequestsPerSecond, l.AverageMs, l.P50Ms, l.P90Ms, l.P99Ms)
+		if l.RequestsPerSecond > maxRate {
+			maxRate = l.RequestsPerSecond
+		}
+		if l.P99Ms > maxP99 {
+			maxP99 = l.P99Ms
+		}
+	}
+	fmt.Println()
+	fmt.Println("Throughput (requests/s) by connections")
+	for _, l := range levels {
+		fmt.Printf("%8d | %s %.1f\n", l.Connections, bar(l.RequestsPerSecond, maxRate, concurrencyChartWidth), l.RequestsPerSecond)
+	}
+	fmt.Println()
+	fmt.Println("p99 latency (ms) by connections")
+	for _, l := range levels {
+		fmt.Printf("%8d | %s %.3f\n", l.Connections, bar(l.P99Ms, maxP99, concurrencyChartWidth), l.P99Ms)
+	}
+}
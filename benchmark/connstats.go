@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+
+	"benchmark/internal/metrics"
+)
+
+// ConnSummary describes the connections behind the requests of the run, to
+// tell connection churn (DNS lookups, new TCP and TLS connections) apart from
+// slow responses of DynamoDB itself.
+type ConnSummary struct {
+	// Attempts counts HTTP requests, i.e. SDK retries count separately.
+	Attempts        uint64  `json:"attempts"`
+	NewConns        uint64  `json:"new_connections"`
+	ReusedConns     uint64  `json:"reused_connections"`
+	ReuseRate       float64 `json:"reuse_rate"`
+	IdleReused      uint64  `json:"idle_reused_connections"`
+	RemoteAddrs     int     `json:"remote_addresses"`
+	DNSLookups      uint64  `json:"dns_lookups"`
+	DNSAvgMs        float64 `json:"dns_average_ms"`
+	ConnectAvgMs    float64 `json:"connect_average_ms"`
+	TLSHandshakes   uint64  `json:"tls_handshakes"`
+	TLSAvgMs        float64 `json:"tls_handshake_average_ms"`
+	TTFBP50Ms       float64 `json:"ttfb_p50_ms"`
+	TTFBP99Ms       float64 `json:"ttfb_p99_ms"`
+	TTFBNewP99Ms    float64 `json:"ttfb_new_connection_p99_ms"`
+	TTFBReusedP99Ms float64 `json:"ttfb_reused_connection_p99_ms"`
+	// Workers lists the sessions that opened more than one connection.
+	Workers []WorkerConnSummary `json:"workers,omitempty"`
+}
+
+// WorkerConnSummary is the connection usage of one session.
+type WorkerConnSummary struct {
+	Worker      int     `json:"worker"`
+	Attempts    uint64  `json:"attempts"`
+	NewConns    uint64  `json:"new_connections"`
+	ReusedConns uint64  `json:"reused_connections"`
+	DNSLookups  uint64  `json:"dns_lookups"`
+	TTFBP99Ms   float64 `json:"ttfb_p99_ms"`
+}
+
+// ConnStats collects the connection statistics of every session of a run.
+// A nil *ConnStats records nothing.
+type ConnStats struct {
+	mu      sync.Mutex
+	workers map[int]*WorkerConnStats
+}
+
+func NewConnStats() *ConnStats {
+	return &ConnStats{workers: map[int]*WorkerConnStats{}}
+}
+
+// Worker returns the statistics of session id. It returns nil, which records
+// nothing, on a nil *ConnStats.
+func (s *ConnStats) Worker(id int) *WorkerConnStats {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workers[id]
+	if !ok {
+		w = &WorkerConnStats{
+			remoteAddrs: map[string]bool{},
+			ttfb:        metrics.NewHistogram(),
+			ttfbNew:     metrics.NewHistogram(),
+			ttfbReused:  metrics.NewHistogram(),
+		}
+		s.workers[id] = w
+	}
+	return w
+}
+
+// WorkerConnStats is the connection statistics of one session. The SDK
+// client of a session sends one request at a time, but the trace callbacks
+// of a request may run on the transport's goroutines, hence the lock.
+type WorkerConnStats struct {
+	mu          sync.Mutex
+	attempts    uint64
+	newConns    uint64
+	reusedConns uint64
+	idleReused  uint64
+	remoteAddrs map[string]bool
+	dnsLookups  uint64
+	dnsTime     time.Duration
+	connects    uint64
+	connectTime time.Duration
+	tlsCount    uint64
+	tlsTime     time.Duration
+	ttfb        *metrics.Histogram
+	ttfbNew     *metrics.Histogram
+	ttfbReused  *metrics.Histogram
+}
+
+// handler returns the SDK send handler which traces every HTTP request.
+func (w *WorkerConnStats) handler() request.NamedHandler {
+	return request.NamedHandler{Name: "dynamodb-benchmark.ConnStats", Fn: func(r *request.Request) {
+		trace := w.trace()
+		r.HTTPRequest = r.HTTPRequest.WithContext(httptrace.WithClientTrace(r.HTTPRequest.Context(), trace))
+	}}
+}
+
+// trace returns the httptrace hooks of one HTTP request.
+func (w *WorkerConnStats) trace() *httptrace.ClientTrace {
+	start := time.Now()
+	var dnsStart, connectStart, tlsStart time.Time
+	reused := false
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			w.mu.Lock()
+			w.dnsLookups++
+			w.dnsTime += time.Since(dnsStart)
+			w.mu.Unlock()
+		},
+		ConnectStart: func(string, string) { connectStart = time.Now() },
+		ConnectDone: func(_, _ string, err error) {
+			if err != nil {
+				return
+			}
+			w.mu.Lock()
+			w.connects++
+			w.connectTime += time.Since(connectStart)
+			w.mu.Unlock()
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err != nil {
+				return
+			}
+			w.mu.Lock()
+			w.tlsCount++
+			w.tlsTime += time.Since(tlsStart)
+			w.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused = info.Reused
+			w.mu.Lock()
+			w.attempts++
+			if info.Reused {
+				w.reusedConns++
+				if info.WasIdle {
+					w.idleReused++
+				}
+			} else {
+				w.newConns++
+			}
+			if info.Conn != nil {
+				w.remoteAddrs[info.Conn.RemoteAddr().String()] = true
+			}
+			w.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			d := time.Since(start)
+			w.mu.Lock()
+			w.ttfb.Record(d)
+			if reused {
+				w.ttfbReused.Record(d)
+			} else {
+				w.ttfbNew.Record(d)
+			}
+			w.mu.Unlock()
+		},
+	}
+}
+
+// Summary aggregates the statistics of all sessions. It returns nil on a nil
+// *ConnStats.
+func (s *ConnStats) Summary() *ConnSummary {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sum ConnSummary
+	var dnsTime, connectTime, tlsTime time.Duration
+	var connects uint64
+	addrs := map[string]bool{}
+	ttfb, ttfbNew, ttfbReused := metrics.NewHistogram(), metrics.NewHistogram(), metrics.NewHistogram()
+	ids := make([]int, 0, len(s.workers))
+	for id := range s.workers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		w := s.workers[id]
+		w.mu.Lock()
+		sum.Attempts += w.attempts
+		sum.NewConns += w.newConns
+		sum.ReusedConns += w.reusedConns
+		sum.IdleReused += w.idleReused
+		sum.DNSLookups += w.dnsLookups
+		sum.TLSHandshakes += w.tlsCount
+		dnsTime += w.dnsTime
+		connectTime += w.connectTime
+		connects += w.connects
+		tlsTime += w.tlsTime
+		for addr := range w.remoteAddrs {
+			addrs[addr] = true
+		}
+		ttfb.Merge(w.ttfb)
+		ttfbNew.Merge(w.ttfbNew)
+		ttfbReused.Merge(w.ttfbReused)
+		if w.newConns > 1 {
+			sum.Workers = append(sum.Workers, WorkerConnSummary{
+				Worker:      id,
+				Attempts:    w.attempts,
+				NewConns:    w.newConns,
+				ReusedConns: w.reusedConns,
+				DNSLookups:  w.dnsLookups,
+				TTFBP99Ms:   durationMs(w.ttfb.Percentile(99)),
+			})
+		}
+		w.mu.Unlock()
+	}
+	sum.ReuseRate = ratio(sum.ReusedConns, sum.Attempts)
+	sum.RemoteAddrs = len(addrs)
+	sum.DNSAvgMs = averageMs(dnsTime, sum.DNSLookups)
+	sum.ConnectAvgMs = averageMs(connectTime, connects)
+	sum.TLSAvgMs = averageMs(tlsTime, sum.TLSHandshakes)
+	sum.TTFBP50Ms = durationMs(ttfb.Percentile(50))
+	sum.TTFBP99Ms = durationMs(ttfb.Percentile(99))
+	sum.TTFBNewP99Ms = durationMs(ttfbNew.Percentile(99))
+	sum.TTFBReusedP99Ms = durationMs(ttfbReused.Percentile(99))
+	return &sum
+}
+
+func (c *ConnSummary) String() string {
+	if c.Attempts == 0 {
+		// e.g. the fake:// endpoint, which does not use the network
+		return "no HTTP connections traced"
+	}
+	return fmt.Sprintf("attempts %d, new %d, reused %d (%.2f%%, %d idle), remote addresses %d, "+
+		"DNS lookups %d (avg %.3f ms), connect avg %.3f ms, TLS handshakes %d (avg %.3f ms), "+
+		"time to first byte p50 %.3f ms, p99 %.3f ms (new connections %.3f ms, reused %.3f ms)",
+		c.Attempts, c.NewConns, c.ReusedConns, c.ReuseRate*100, c.IdleReused, c.RemoteAddrs,
+		c.DNSLookups, c.DNSAvgMs, c.ConnectAvgMs, c.TLSHandshakes, c.TLSAvgMs,
+		c.TTFBP50Ms, c.TTFBP99Ms, c.TTFBNewP99Ms, c.TTFBReusedP99Ms)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"benchmark/internal/metrics"
+)
+
+// ContentionPoint is one time bucket of the contention series.
+type ContentionPoint struct {
+	OffsetSec float64 `json:"offset_sec"`
+	Requests  uint64  `json:"requests"`
+	// Conflicts counts ConditionalCheckFailedException responses.
+	Conflicts uint64 `json:"conflicts"`
+	// Throttles counts responses rejected for lack of capacity after the
+	// retries of the SDK.
+	Throttles    uint64  `json:"throttles"`
+	ConflictRate float64 `json:"conflict_rate"`
+	ThrottleRate float64 `json:"throttle_rate"`
+	// Interleaved is the average number of updates by other sessions between
+	// two successful updates of the same session, i.e. how far "age" moved
+	// beyond the session's own increment.
+	Interleaved float64 `json:"interleaved"`
+	AverageMs   float64 `json:"average_ms"`
+	P99Ms       float64 `json:"p99_ms"`
+}
+
+// ContentionSummary sums up the series and tells which cause dominates.
+type ContentionSummary struct {
+	Requests     uint64  `json:"requests"`
+	Conflicts    uint64  `json:"conflicts"`
+	Throttles    uint64  `json:"throttles"`
+	ConflictRate float64 `json:"conflict_rate"`
+	ThrottleRate float64 `json:"throttle_rate"`
+	Interleaved  float64 `json:"interleaved"`
+	// Diagnosis is "capacity throttling", "hot item contention" or "none".
+	Diagnosis string `json:"diagnosis"`
+}
+
+type contentionBucket struct {
+	requests     uint64
+	conflicts    uint64
+	throttles    uint64
+	interleaved  uint64
+	deltas       uint64
+	totalLatency time.Duration
+	latency      *metrics.Histogram
+}
+
+// ContentionTracker buckets every update attempt of the write workload by
+// time to correlate conflicts and the movement of "age" with latency. A nil
+// *ContentionTracker records nothing.
+type ContentionTracker struct {
+	mu      sync.Mutex
+	start   time.Time
+	width   time.Duration
+	buckets []*contentionBucket
+	lastAge map[int]int64
+}
+
+func NewContentionTracker(start time.Time, width time.Duration) *ContentionTracker {
+	return &ContentionTracker{
+		start:   start,
+		width:   width,
+		lastAge: map[int]int64{},
+	}
+}
+
+func isThrottle(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case dynamodb.ErrCodeProvisionedThroughputExceededException,
+			dynamodb.ErrCodeRequestLimitExceeded,
+			"ThrottlingException":
+			return true
+		}
+	}
+	return false
+}
+
+func isConditionalCheckFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
+
+// Record adds one request attempt of worker. age is the value returned by a
+// successful update.
+func (t *ContentionTracker) Record(worker int, start time.Time, latency time.Duration, age *int64, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := int(start.Sub(t.start) / t.width)
+	if i < 0 {
+		i = 0
+	}
+	for len(t.buckets) <= i {
+		t.buckets = append(t.buckets, &contentionBucket{latency: metrics.NewHistogram()})
+	}
+	b := t.buckets[i]
+	b.requests++
+	b.totalLatency += latency
+	b.latency.Record(latency)
+	switch {
+	case isConditionalCheckFailed(err):
+		b.conflicts++
+	case isThrottle(err):
+		b.throttles++
+	case err == nil && age != nil:
+		if last, ok := t.lastAge[worker]; ok && *age > last {
+			b.interleaved += uint64(*age - last - 1)
+			b.deltas++
+		}
+		t.lastAge[worker] = *age
+	}
+}
+
+func ratio(n uint64, d uint64) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// Series returns the buckets in time order.
+func (t *ContentionTracker) Series() []ContentionPoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	series := make([]ContentionPoint, 0, len(t.buckets))
+	for i, b := range t.buckets {
+		series = append(series, ContentionPoint{
+			OffsetSec:    (time.Duration(i) * t.width).Seconds(),
+			Requests:     b.requests,
+			Conflicts:    b.conflicts,
+			Throttles:    b.throttles,
+			ConflictRate: ratio(b.conflicts, b.requests),
+			ThrottleRate: ratio(b.throttles, b.requests),
+			Interleaved:  ratio(b.interleaved, b.deltas),
+			AverageMs:    averageMs(b.totalLatency, b.requests),
+			P99Ms:        durationMs(b.latency.Percentile(99)),
+		})
+	}
+	return series
+}
+
+// Summary totals the series. Throttling dominates when more attempts were
+// throttled than conflicted; otherwise conflicts or other sessions' updates
+// landing in between mean the item itself is contended.
+func (t *ContentionTracker) Summary() *ContentionSummary {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sum := &ContentionSummary{Diagnosis: "none"}
+	var interleaved, deltas uint64
+	for _, b := range t.buckets {
+		sum.Requests += b.requests
+		sum.Conflicts += b.conflicts
+		sum.Throttles += b.throttles
+		interleaved += b.interleaved
+		deltas += b.deltas
+	}
+	sum.ConflictRate = ratio(sum.Conflicts, sum.Requests)
+	sum.ThrottleRate = ratio(sum.Throttles, sum.Requests)
+	sum.Interleaved = ratio(interleaved, deltas)
+	switch {
+	case sum.Throttles > 0 && sum.Throttles >= sum.Conflicts:
+		sum.Diagnosis = "capacity throttling"
+	case sum.Conflicts > 0 || sum.Interleaved >= 1:
+		sum.Diagnosis = "hot item contention"
+	}
+	return sum
+}
+
+// WriteCSV writes the series to path.
+func (t *ContentionTracker) WriteCSV(path string, runID string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create contention report: %v", err)
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"offset_sec", "requests", "conflicts", "throttles", "conflict_rate", "throttle_rate", "interleaved", "average_ms", "p99_ms", "run_id"})
+	for _, p := range t.Series() {
+		w.Write([]string{
+			strconv.FormatFloat(p.OffsetSec, 'f', 3, 64),
+			strconv.FormatUint(p.Requests, 10),
+			strconv.FormatUint(p.Conflicts, 10),
+			strconv.FormatUint(p.Throttles, 10),
+			strconv.FormatFloat(p.ConflictRate, 'f', 4, 64),
+			strconv.FormatFloat(p.ThrottleRate, 'f', 4, 64),
+			strconv.FormatFloat(p.Interleaved, 'f', 2, 64),
+			strconv.FormatFloat(p.AverageMs, 'f', 3, 64),
+			strconv.FormatFloat(p.P99Ms, 'f', 3, 64),
+			runID,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write contention report: %v", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// ControlStatus is the response of every control endpoint.
+type ControlStatus struct {
+	RunID  string  `json:"run_id"`
+	Paused bool    `json:"paused"`
+	Rate   float64 `json:"rate"`
+	// Summary holds the running totals, only returned by /metrics.
+	Summary *Summary `json:"summary,omitempty"`
+}
+
+// Controller serves a small HTTP API to change the load of a running
+// benchmark without restarting it:
+//
+//	GET  /status             paused state and target rate
+//	GET  /metrics            the above plus the running summary
+//	POST /rate?value=<r>     set the target rate (requests/sec, 0 = unlimited)
+//	POST /pause, /resume     stop and restart sending requests
+//
+// A nil *Controller never pauses.
+type Controller struct {
+	mu      sync.Mutex
+	paused  bool
+	resume  chan struct{}
+	limiter *RateLimiter
+	stats   *Stats
+	action  string
+	runID   string
+	server  *http.Server
+}
+
+// NewController starts listening on addr right away so that a busy port is
+// reported before the run starts.
+func NewController(addr string, action string, runID string, limiter *RateLimiter, stats *Stats) (*Controller, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start control server: %v", err)
+	}
+	ctl := &Controller{
+		limiter: limiter,
+		stats:   stats,
+		action:  action,
+		runID:   runID,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", ctl.handleStatus)
+	mux.HandleFunc("/metrics", ctl.handleMetrics)
+	mux.HandleFunc("/rate", ctl.handleRate)
+	mux.HandleFunc("/pause", ctl.handlePause)
+	mux.HandleFunc("/resume", ctl.handleResume)
+	ctl.server = &http.Server{Handler: mux}
+	go ctl.server.Serve(ln)
+	return ctl, nil
+}
+
+// Wait blocks while the run is paused.
+func (ctl *Controller) Wait() {
+	if ctl == nil {
+		return
+	}
+	ctl.mu.Lock()
+	resume := ctl.resume
+	paused := ctl.paused
+	ctl.mu.Unlock()
+	if paused {
+		<-resume
+	}
+}
+
+func (ctl *Controller) Pause() {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if !ctl.paused {
+		ctl.paused = true
+		ctl.resume = make(chan struct{})
+	}
+}
+
+func (ctl *Controller) Resume() {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if ctl.paused {
+		ctl.paused = false
+		close(ctl.resume)
+	}
+}
+
+// Stop shuts the server down and releases paused workers.
+func (ctl *Controller) Stop() {
+	if ctl == nil {
+		return
+	}
+	ctl.Resume()
+	ctl.server.Close()
+}
+
+func (ctl *Controller) status(withSummary bool) ControlStatus {
+	ctl.mu.Lock()
+	st := ControlStatus{RunID: ctl.runID, Paused: ctl.paused, Rate: ctl.limiter.Rate()}
+	ctl.mu.Unlock()
+	if withSummary {
+		sum := ctl.stats.Summary(ctl.action)
+		sum.RunID = ctl.runID
+		st.Summary = &sum
+	}
+	return st
+}
+
+func (ctl *Controller) reply(w http.ResponseWriter, withSummary bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ctl.status(withSummary))
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func (ctl *Controller) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if allowMethod(w, r, http.MethodGet) {
+		ctl.reply(w, false)
+	}
+}
+
+func (ctl *Controller) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if allowMethod(w, r, http.MethodGet) {
+		ctl.reply(w, true)
+	}
+}
+
+func (ctl *Controller) handleRate(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	rate, err := strconv.ParseFloat(r.URL.Query().Get("value"), 64)
+	if err != nil || rate < 0 {
+		http.Error(w, "value must be a non-negative number of requests per second", http.StatusBadRequest)
+		return
+	}
+	ctl.limiter.SetRate(rate)
+	fmt.Printf("Control: rate set to %v requests/sec\n", rate)
+	ctl.reply(w, false)
+}
+
+func (ctl *Controller) handlePause(w http.ResponseWriter, r *http.Request) {
+	if allowMethod(w, r, http.MethodPost) {
+		ctl.Pause()
+		fmt.Println("Control: paused")
+		ctl.reply(w, false)
+	}
+}
+
+func (ctl *Controller) handleResume(w http.ResponseWriter, r *http.Request) {
+	if allowMethod(w, r, http.MethodPost) {
+		ctl.Resume()
+		fmt.Println("Control: resumed")
+		ctl.reply(w, false)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type DryRunRequest struct {
+	Seq                       int                `json:"seq"`
+	Worker                    int                `json:"worker"`
+	Call                      int                `json:"call"`
+	Operation                 string             `json:"operation"`
+	Key                       json.RawMessage    `json:"key"`
+	UpdateExpression          string             `json:"update_expression,omitempty"`
+	ConditionExpression       string             `json:"condition_expression,omitempty"`
+	ExpressionAttributeNames  map[string]*string `json:"expression_attribute_names,omitempty"`
+	ExpressionAttributeValues json.RawMessage    `json:"expression_attribute_values,omitempty"`
+	ReturnValues              string             `json:"return_values,omitempty"`
+	ProjectionExpression      string             `json:"projection_expression,omitempty"`
+	ReturnConsumedCapacity    string             `json:"return_consumed_capacity,omitempty"`
+	PayloadBytes              int                `json:"payload_bytes"`
+}
+
+type DryRunPhase struct {
+	Name        string `json:"name"`
+	Connections int    `json:"connections"`
+	NumCalls    int    `json:"num_calls"`
+	Requests    int    `json:"requests"`
+}
+
+type DryRunPlan struct {
+	RunID         string        `json:"run_id"`
+	Action        string        `json:"action"`
+	TableName     string        `json:"table"`
+	Endpoint      string        `json:"endpoint"`
+	TotalRequests int           `json:"total_requests"`
+	Duration      string        `json:"duration,omitempty"`
+	MaxAttempts   int           `json:"max_attempts"`
+	Rate          string        `json:"rate"`
+	Phases        []DryRunPhase `json:"phases"`
+}
+
+type DryRunOutput struct {
+	Requests []DryRunRequest `json:"requests"`
+	Plan     DryRunPlan      `json:"plan"`
+}
+
+func attributeValuesJSON(av map[string]*dynamodb.AttributeValue) json.RawMessage {
+	if len(av) == 0 {
+		return nil
+	}
+	values := map[string]json.RawMessage{}
+	for name, v := range av {
+		values[name] = wireJSON(v)
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (c *DynamoDBBenchmark) dryRunRequest(seq int, worker int, call int) DryRunRequest {
+	req := DryRunRequest{
+		Seq:    seq,
+		Worker: worker,
+		Call:   call,
+	}
+	if c.Action == "read" {
+		param := c.getItemInput()
+		req.Operation = "GetItem"
+		req.Key = attributeValuesJSON(param.Key)
+		req.ProjectionExpression = aws.StringValue(param.ProjectionExpression)
+		req.ExpressionAttributeNames = param.ExpressionAttributeNames
+		req.ReturnConsumedCapacity = aws.StringValue(param.ReturnConsumedCapacity)
+		req.PayloadBytes = len(wireJSON(param))
+	} else {
+		param := c.writeInput(worker, call)
+		req.Operation = "UpdateItem"
+		req.Key = attributeValuesJSON(param.Key)
+		req.UpdateExpression = aws.StringValue(param.UpdateExpression)
+		req.ConditionExpression = aws.StringValue(param.ConditionExpression)
+		req.ExpressionAttributeNames = param.ExpressionAttributeNames
+		req.ExpressionAttributeValues = attributeValuesJSON(param.ExpressionAttributeValues)
+		req.ReturnValues = aws.StringValue(param.ReturnValues)
+		req.ReturnConsumedCapacity = aws.StringValue(param.ReturnConsumedCapacity)
+		req.PayloadBytes = len(wireJSON(param))
+	}
+	return req
+}
+
+// RunDryRun prints the first DryRunRequests requests in the order the workers
+// would issue them, followed by the planned workload, without calling DynamoDB.
+func (c *DynamoDBBenchmark) RunDryRun() error {
+	if c.PayloadFile != "" {
+		var err error
+		if c.compression, err = c.newCompression(); err != nil {
+			return err
+		}
+	}
+	total := c.Connections * c.NumCalls
+	if c.TotalCalls > 0 {
+		total = c.TotalCalls
+	}
+	out := DryRunOutput{
+		Requests: []DryRunRequest{},
+		Plan: DryRunPlan{
+			RunID:         c.RunID,
+			Action:        c.Action,
+			TableName:     c.TableName,
+			Endpoint:      c.EndpointUrl,
+			TotalRequests: total,
+			MaxAttempts:   total * c.RetryNum,
+			Rate:          "unlimited",
+			Phases: []DryRunPhase{
+				{
+					Name:        c.Action,
+					Connections: c.Connections,
+					NumCalls:    c.sessionCalls(1),
+					Requests:    total,
+				},
+			},
+		},
+	}
+	if c.Duration > 0 {
+		// The number of requests of a timed run is only known afterwards.
+		out.Plan.TotalRequests = 0
+		out.Plan.MaxAttempts = 0
+		out.Plan.Phases[0].NumCalls = 0
+		out.Plan.Phases[0].Requests = 0
+		out.Plan.Duration = c.Duration.String()
+	}
+	if c.Rate > 0 {
+		out.Plan.Rate = fmt.Sprintf("%v requests/sec", c.Rate)
+	}
+	if out.Plan.Endpoint == "" {
+		variant := ""
+		if c.FIPS {
+			variant += ", FIPS"
+		}
+		if c.DualStack {
+			variant += ", dual-stack"
+		}
+		out.Plan.Endpoint = "(AWS SDK default" + variant + ")"
+	}
+	if c.SigningRegion != "" {
+		out.Plan.Endpoint += " signed for " + c.SigningRegion
+	}
+
+	seq := 1
+	for call := 1; c.Duration > 0 || call <= c.sessionCalls(1); call++ {
+		if seq > c.DryRunRequests {
+			break
+		}
+		for worker := 1; worker <= c.Connections && seq <= c.DryRunRequests; worker++ {
+			if c.Duration == 0 && call > c.sessionCalls(worker) {
+				break
+			}
+			out.Requests = append(out.Requests, c.dryRunRequest(seq, worker, call))
+			seq++
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return fmt.Errorf("failed to encode dry-run output: %v", err)
+	}
+	return nil
+}
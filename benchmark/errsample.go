@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// errorSamplesMaxDistinct bounds the distinct messages kept; the errors
+	// with further messages are only counted.
+	errorSamplesMaxDistinct = 100
+	// errorMessageMaxLen truncates long messages, e.g. with an item in them.
+	errorMessageMaxLen = 300
+)
+
+// requestIDPattern matches the request id the SDK appends to the message of
+// every failed request, which would make every error distinct.
+var requestIDPattern = regexp.MustCompile(`,?\s*request id: [\w-]*`)
+
+// errorMessage is the message of err without request id, on one line.
+func errorMessage(err error) string {
+	msg := strings.Join(strings.Fields(requestIDPattern.ReplaceAllString(err.Error(), "")), " ")
+	if len(msg) > errorMessageMaxLen {
+		msg = msg[:errorMessageMaxLen] + "..."
+	}
+	return msg
+}
+
+// ErrorSample is one distinct error message and how often it occurred.
+type ErrorSample struct {
+	Operation string `json:"operation"`
+	Message   string `json:"message"`
+	Count     uint64 `json:"count"`
+	// FirstSec and LastSec are the offsets into the run of its first and
+	// last occurrence.
+	FirstSec float64 `json:"first_sec"`
+	LastSec  float64 `json:"last_sec"`
+}
+
+func (s ErrorSample) String() string {
+	return fmt.Sprintf("%dx %s: %s (first at %.1fs, last at %.1fs)", s.Count, s.Operation, s.Message, s.FirstSec, s.LastSec)
+}
+
+// ErrorSampleSummary is the sample of the error messages of a run.
+type ErrorSampleSummary struct {
+	Errors   uint64 `json:"errors"`
+	Distinct int    `json:"distinct"`
+	// Unsampled counts the errors whose message came after the first
+	// errorSamplesMaxDistinct distinct ones.
+	Unsampled uint64 `json:"unsampled,omitempty"`
+	// First are the first -error-samples distinct messages of the run, Last
+	// the ones which occurred last and are not among First.
+	First []ErrorSample `json:"first"`
+	Last  []ErrorSample `json:"last,omitempty"`
+}
+
+func (s *ErrorSampleSummary) Print() {
+	fmt.Printf("Error messages (%d errors, %d distinct messages):\n", s.Errors, s.Distinct)
+	for _, e := range s.First {
+		fmt.Printf("  %s\n", e)
+	}
+	if len(s.Last) > 0 {
+		fmt.Println("  latest:")
+		for _, e := range s.Last {
+			fmt.Printf("  %s\n", e)
+		}
+	}
+	if s.Unsampled > 0 {
+		fmt.Printf("  %d errors with further messages were only counted\n", s.Unsampled)
+	}
+}
+
+type errorEntry struct {
+	sample      ErrorSample
+	first, last time.Time
+	order       int
+}
+
+// ErrorSamples collects a bounded sample of the distinct error messages of a
+// run with their counts. A nil *ErrorSamples records nothing.
+type ErrorSamples struct {
+	mu        sync.Mutex
+	start     time.Time
+	n         int
+	entries   map[string]*errorEntry
+	errors    uint64
+	unsampled uint64
+}
+
+// NewErrorSamples keeps n messages of each kind for the summary.
+func NewErrorSamples(start time.Time, n int) *ErrorSamples {
+	return &ErrorSamples{start: start, n: n, entries: map[string]*errorEntry{}}
+}
+
+// Record adds the error of op, if any, which started at start.
+func (s *ErrorSamples) Record(op string, start time.Time, err error) {
+	if s == nil || err == nil {
+		return
+	}
+	msg := errorMessage(err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors++
+	e, ok := s.entries[msg]
+	if !ok {
+		if len(s.entries) >= errorSamplesMaxDistinct {
+			s.unsampled++
+			return
+		}
+		e = &errorEntry{sample: ErrorSample{Operation: op, Message: msg}, first: start, order: len(s.entries)}
+		s.entries[msg] = e
+	}
+	e.sample.Count++
+	if start.After(e.last) {
+		e.last = start
+	}
+}
+
+func (s *ErrorSamples) Summary() *ErrorSampleSummary {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.errors == 0 {
+		return nil
+	}
+	var entries []*errorEntry
+	for _, e := range s.entries {
+		e.sample.FirstSec = e.first.Sub(s.start).Seconds()
+		e.sample.LastSec = e.last.Sub(s.start).Seconds()
+		entries = append(entries, e)
+	}
+	sum := &ErrorSampleSummary{Errors: s.errors, Distinct: len(entries), Unsampled: s.unsampled}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].order < entries[j].order })
+	for i := 0; i < len(entries) && i < s.n; i++ {
+		sum.First = append(sum.First, entries[i].sample)
+	}
+	if len(entries) > s.n {
+		rest := entries[s.n:]
+		sort.Slice(rest, func(i, j int) bool { return rest[i].last.After(rest[j].last) })
+		for i := 0; i < len(rest) && i < s.n; i++ {
+			sum.Last = append(sum.Last, rest[i].sample)
+		}
+	}
+	return sum
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// eventPollInterval is how often the status of an event is checked.
+const eventPollInterval = 5 * time.Second
+
+// EventSummary compares the foreground traffic before, during and after an
+// operation started during the run, e.g. a backup or an index backfill.
+type EventSummary struct {
+	Event string `json:"event"`
+	// Resource is what the operation created, e.g. the backup ARN.
+	Resource string `json:"resource,omitempty"`
+	// Status is the last known status, e.g. "AVAILABLE", or the error that
+	// kept the operation from starting.
+	Status   string  `json:"status"`
+	StartSec float64 `json:"start_sec"`
+	// FinishSec is when the operation was seen done, -1 if it was not before
+	// the end of the run.
+	FinishSec float64      `json:"finish_sec"`
+	Before    WindowStats  `json:"before"`
+	During    *WindowStats `json:"during,omitempty"`
+	After     *WindowStats `json:"after,omitempty"`
+}
+
+// EventMonitor starts an operation some time into the run, polls it until
+// it is done and annotates the timeline with its start and finish. A nil
+// *EventMonitor does nothing.
+type EventMonitor struct {
+	event    string
+	at       time.Duration
+	timeline *Timeline
+	verbose  bool
+	// begin starts the operation and returns what it created and its
+	// status; poll returns the status and whether the operation is done.
+	begin func() (resource string, status string, err error)
+	poll  func(resource string) (status string, done bool, err error)
+	stop  chan struct{}
+	done  chan struct{}
+
+	resource string
+	status   string
+	start    time.Time
+	finish   time.Time
+}
+
+func NewEventMonitor(event string, at time.Duration, timeline *Timeline, verbose bool,
+	begin func() (string, string, error), poll func(string) (string, bool, error)) *EventMonitor {
+	return &EventMonitor{
+		event:    event,
+		at:       at,
+		timeline: timeline,
+		verbose:  verbose,
+		begin:    begin,
+		poll:     poll,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start waits for the start offset in the background, then starts the
+// operation and follows it.
+func (m *EventMonitor) Start() {
+	if m == nil {
+		return
+	}
+	go func() {
+		defer close(m.done)
+		select {
+		case <-time.After(m.at):
+		case <-m.stop:
+			m.status = "not started before the end of the run"
+			return
+		}
+		m.start = time.Now()
+		resource, status, err := m.begin()
+		if err != nil {
+			m.status = err.Error()
+			m.start = time.Time{}
+			m.timeline.Annotate(time.Now(), m.event+" failed")
+			return
+		}
+		m.resource, m.status = resource, status
+		m.timeline.Annotate(m.start, m.event+" started "+resource)
+		if m.verbose {
+			fmt.Printf("[Verbose] %s started: %s\n", m.event, resource)
+		}
+		ticker := time.NewTicker(eventPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-m.stop:
+				return
+			}
+			status, done, err := m.poll(resource)
+			if err != nil {
+				fmt.Printf("[WARN] failed to check %s %s: %v\n", m.event, resource, err)
+				continue
+			}
+			m.status = status
+			if done {
+				break
+			}
+		}
+		m.finish = time.Now()
+		m.timeline.Annotate(m.finish, m.event+" "+m.status)
+		if m.verbose {
+			fmt.Printf("[Verbose] %s %s %s after %.1f sec\n", m.event, resource, m.status, m.finish.Sub(m.start).Seconds())
+		}
+	}()
+}
+
+// Stop stops following the operation, which DynamoDB keeps working on, and
+// compares the traffic in the windows before, during and after it.
+func (m *EventMonitor) Stop() *EventSummary {
+	if m == nil {
+		return nil
+	}
+	close(m.stop)
+	<-m.done
+	sum := &EventSummary{Event: m.event, Resource: m.resource, Status: m.status, FinishSec: -1}
+	if m.start.IsZero() {
+		sum.Before = m.timeline.Window(0, -1)
+		return sum
+	}
+	start := m.timeline.Offset(m.start)
+	sum.StartSec = start.Seconds()
+	sum.Before = m.timeline.Window(0, start)
+	if m.finish.IsZero() {
+		during := m.timeline.Window(start, -1)
+		sum.During = &during
+		return sum
+	}
+	finish := m.timeline.Offset(m.finish)
+	sum.FinishSec = finish.Seconds()
+	during := m.timeline.Window(start, finish)
+	after := m.timeline.Window(finish, -1)
+	sum.During, sum.After = &during, &after
+	return sum
+}
+
+func (e *EventSummary) String() string {
+	switch {
+	case e.Resource == "":
+		return e.Status
+	case e.FinishSec < 0:
+		return fmt.Sprintf("%s started at %.1f sec, still %s at the end of the run", e.Resource, e.StartSec, e.Status)
+	}
+	return fmt.Sprintf("%s started at %.1f sec, %s at %.1f sec (%.1f sec)", e.Resource, e.StartSec, e.Status, e.FinishSec, e.FinishSec-e.StartSec)
+}
+
+// Print prints the summary and its windows.
+func (e *EventSummary) Print() {
+	fmt.Printf("%s: %s\n", e.Event, e)
+	windows := []struct {
+		name string
+		w    *WindowStats
+	}{{"before", &e.Before}, {"during", e.During}, {"after", e.After}}
+	for _, w := range windows {
+		if w.w == nil {
+			continue
+		}
+		fmt.Printf("[%s %s] requests: %d, errors: %d, throttles: %d, requests/sec: %.2f, average (ms): %.3f, p50 (ms): %.3f, p99 (ms): %.3f\n",
+			e.Event, w.name, w.w.Requests, w.w.Errors, w.w.Throttles, w.w.RequestsPerSecond, w.w.AverageMs, w.w.P50Ms, w.w.P99Ms)
+	}
+}
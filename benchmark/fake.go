@@ -0,0 +1,964 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// fakeEndpoint is the -endpoint-url that selects the in-process fake.
+const fakeEndpoint = "fake://"
+
+const maxItemBytes = 400 * 1024
+
+// itemBytes is the size of item by the rules DynamoDB limits items by: the
+// lengths of the attribute names and values, binary values counting their
+// raw bytes (not their base64 on the wire), numbers about a byte per two
+// digits and documents 3 bytes plus their elements.
+func itemBytes(item map[string]*dynamodb.AttributeValue) int {
+	n := 0
+	for name, v := range item {
+		n += len(name) + valueBytes(v)
+	}
+	return n
+}
+
+func valueBytes(v *dynamodb.AttributeValue) int {
+	switch {
+	case v == nil:
+		return 0
+	case v.S != nil:
+		return len(*v.S)
+	case v.B != nil:
+		return len(v.B)
+	case v.N != nil:
+		return len(*v.N)/2 + 1
+	case v.BOOL != nil, v.NULL != nil:
+		return 1
+	case v.M != nil:
+		return 3 + itemBytes(v.M)
+	case v.L != nil:
+		n := 3
+		for _, e := range v.L {
+			n += 1 + valueBytes(e)
+		}
+		return n
+	}
+	n := 0
+	for _, s := range v.SS {
+		n += len(*s)
+	}
+	for _, b := range v.BS {
+		n += len(b)
+	}
+	for _, s := range v.NS {
+		n += len(*s)/2 + 1
+	}
+	return n
+}
+
+// FakeDynamoDB is an in-process, map-backed DynamoDB for developing
+// workloads and the metrics pipeline without AWS or Docker. It speaks the
+// JSON protocol of GetItem, PutItem, UpdateItem, DeleteItem,
+// TransactWriteItems, BatchWriteItem, BatchGetItem, Query (the key condition
+// is evaluated like a condition on every item of the table), Scan (in the
+// order of the keys, without filters or segments) and the table operations
+// (UpdateTable only changes the billing mode and throughput it reports and
+// adds global secondary indexes, which backfill for fakeBackfillDuration and
+// cannot be queried), CreateBackup, DescribeBackup and DeleteBackup (backups
+// take fakeBackupDuration and hold no data),
+// with the expressions of fakeexpr.go. Every table exists as soon as it is
+// used and is keyed by the attribute "id", unless it was created with
+// another key schema. Requests are applied one at a time,
+// so transactions never conflict and nothing is throttled unless such faults
+// are injected with SetFaults.
+type FakeDynamoDB struct {
+	mu     sync.Mutex
+	tables map[string]map[string]map[string]*dynamodb.AttributeValue
+	// billing holds the last UpdateTable of a table; tables are on-demand
+	// until then.
+	billing map[string]*dynamodb.UpdateTableInput
+	backups map[string]*dynamodb.BackupDetails
+	// indexes holds the global secondary indexes of a table with the time
+	// they were created.
+	indexes map[string][]fakeIndex
+	// schemas holds the CreateTable of the tables created with a key schema.
+	schemas map[string]*dynamodb.CreateTableInput
+	faults  *FakeFaults
+}
+
+type fakeIndex struct {
+	create  *dynamodb.CreateGlobalSecondaryIndexAction
+	created time.Time
+}
+
+// fakeBackupDuration is how long a backup of the fake stays CREATING.
+const fakeBackupDuration = 3 * time.Second
+
+// fakeBackfillDuration is how long a new index of the fake stays CREATING.
+const fakeBackfillDuration = 3 * time.Second
+
+// fakeDB is shared by all clients of the process.
+var fakeDB = NewFakeDynamoDB()
+
+func NewFakeDynamoDB() *FakeDynamoDB {
+	return &FakeDynamoDB{
+		tables:  map[string]map[string]map[string]*dynamodb.AttributeValue{},
+		billing: map[string]*dynamodb.UpdateTableInput{},
+		backups: map[string]*dynamodb.BackupDetails{},
+		indexes: map[string][]fakeIndex{},
+		schemas: map[string]*dynamodb.CreateTableInput{},
+	}
+}
+
+type fakeError struct {
+	code    string
+	msg     string
+	reasons []*dynamodb.CancellationReason
+}
+
+// SetFaults injects faults into the requests sent from now on; nil turns
+// injection off.
+func (f *FakeDynamoDB) SetFaults(faults *FakeFaults) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = faults
+}
+
+func (e *fakeError) Error() string {
+	return e.code + ": " + e.msg
+}
+
+func conditionFailed() *fakeError {
+	return &fakeError{code: dynamodb.ErrCodeConditionalCheckFailedException, msg: "The conditional request failed"}
+}
+
+// fakeTransport hands the requests of the SDK to the fake directly.
+type fakeTransport struct {
+	db *FakeDynamoDB
+}
+
+// RoundTrip also injects the faults set with SetFaults.
+func (t fakeTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	op := fakeOperation(r)
+	var body []byte
+	if r.Body != nil {
+		b, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+	t.db.mu.Lock()
+	faults := t.db.faults
+	t.db.mu.Unlock()
+	plan := faults.plan(op, body)
+	if plan.delay > 0 {
+		timer := time.NewTimer(plan.delay)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return nil, r.Context().Err()
+		}
+	}
+	rec := httptest.NewRecorder()
+	if plan.err != nil {
+		if plan.err.code == "TransactionCanceledException" {
+			plan.err.reasons = conflictReasons(body)
+		}
+		writeFakeResponse(rec, nil, plan.err)
+	} else {
+		t.db.respond(rec, op, body)
+	}
+	if plan.reset {
+		return nil, errors.New("read tcp 127.0.0.1->fake.invalid: read: connection reset by peer (injected)")
+	}
+	resp := rec.Result()
+	resp.Request = r
+	return resp, nil
+}
+
+// conflictReasons marks the first item of a transaction as conflicting.
+func conflictReasons(body []byte) []*dynamodb.CancellationReason {
+	in := &dynamodb.TransactWriteItemsInput{}
+	decode(body, in)
+	reasons := make([]*dynamodb.CancellationReason, len(in.TransactItems))
+	for i := range reasons {
+		reasons[i] = &dynamodb.CancellationReason{Code: aws.String("None")}
+	}
+	if len(reasons) > 0 {
+		reasons[0].Code = aws.String("TransactionConflict")
+	}
+	return reasons
+}
+
+func fakeOperation(r *http.Request) string {
+	op := r.Header.Get("X-Amz-Target")
+	return op[strings.LastIndex(op, ".")+1:]
+}
+
+func (f *FakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeFakeResponse(w, nil, err)
+		return
+	}
+	f.respond(w, fakeOperation(r), body)
+}
+
+func (f *FakeDynamoDB) respond(w http.ResponseWriter, op string, body []byte) {
+	out, err := f.call(op, body)
+	writeFakeResponse(w, out, err)
+}
+
+func writeFakeResponse(w http.ResponseWriter, out interface{}, err error) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	if err != nil {
+		fe, ok := err.(*fakeError)
+		if !ok {
+			fe = &fakeError{code: "SerializationException", msg: err.Error()}
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(wireJSON(&struct {
+			Type                *string                        `locationName:"__type" type:"string"`
+			Message             *string                        `type:"string"`
+			CancellationReasons []*dynamodb.CancellationReason `type:"list"`
+		}{aws.String("com.amazonaws.dynamodb.v20120810#" + fe.code), aws.String(fe.msg), fe.reasons}))
+		return
+	}
+	w.Write(wireJSON(out))
+}
+
+func decode(body []byte, in interface{}) error {
+	if err := decodeWire(body, in); err != nil {
+		return &fakeError{code: "SerializationException", msg: err.Error()}
+	}
+	return nil
+}
+
+func (f *FakeDynamoDB) call(op string, body []byte) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch op {
+	case "GetItem":
+		in := &dynamodb.GetItemInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		return f.getItem(in)
+	case "PutItem":
+		in := &dynamodb.PutItemInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		w, err := f.planPut(aws.StringValue(in.TableName), in.Item, aws.StringValue(in.ConditionExpression), in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+		if err != nil {
+			return nil, err
+		}
+		f.apply(w)
+		out := &dynamodb.PutItemOutput{}
+		if aws.StringValue(in.ReturnValues) == dynamodb.ReturnValueAllOld {
+			out.Attributes = w.old
+		}
+		if aws.StringValue(in.ReturnItemCollectionMetrics) == dynamodb.ReturnItemCollectionMetricsSize {
+			out.ItemCollectionMetrics = f.collectionMetrics(aws.StringValue(in.TableName), in.Item)
+		}
+		return out, nil
+	case "UpdateItem":
+		in := &dynamodb.UpdateItemInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		return f.updateItem(in)
+	case "DeleteItem":
+		in := &dynamodb.DeleteItemInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		w, err := f.planDelete(aws.StringValue(in.TableName), in.Key, aws.StringValue(in.ConditionExpression), in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+		if err != nil {
+			return nil, err
+		}
+		f.apply(w)
+		out := &dynamodb.DeleteItemOutput{}
+		if aws.StringValue(in.ReturnValues) == dynamodb.ReturnValueAllOld {
+			out.Attributes = w.old
+		}
+		return out, nil
+	case "TransactWriteItems":
+		in := &dynamodb.TransactWriteItemsInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		return f.transactWriteItems(in)
+	case "BatchWriteItem":
+		in := &dynamodb.BatchWriteItemInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		return f.batchWriteItem(in)
+	case "BatchGetItem":
+		in := &dynamodb.BatchGetItemInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		return f.batchGetItem(in)
+	case "UpdateTable":
+		in := &dynamodb.UpdateTableInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		name := aws.StringValue(in.TableName)
+		if in.BillingMode != nil || in.ProvisionedThroughput != nil {
+			f.billing[name] = in
+		}
+		for _, u := range in.GlobalSecondaryIndexUpdates {
+			if u.Delete != nil {
+				var kept []fakeIndex
+				for _, idx := range f.indexes[name] {
+					if aws.StringValue(idx.create.IndexName) != aws.StringValue(u.Delete.IndexName) {
+						kept = append(kept, idx)
+					}
+				}
+				if len(kept) == len(f.indexes[name]) {
+					return nil, &fakeError{code: dynamodb.ErrCodeResourceNotFoundException, msg: "Requested resource not found"}
+				}
+				f.indexes[name] = kept
+			}
+			if u.Create == nil {
+				continue
+			}
+			for _, idx := range f.indexes[name] {
+				if aws.StringValue(idx.create.IndexName) == aws.StringValue(u.Create.IndexName) {
+					return nil, &fakeError{code: "ValidationException", msg: "Attempting to create an index which already exists"}
+				}
+			}
+			f.indexes[name] = append(f.indexes[name], fakeIndex{create: u.Create, created: time.Now()})
+		}
+		return &dynamodb.UpdateTableOutput{TableDescription: f.describe(name)}, nil
+	case "CreateBackup":
+		in := &dynamodb.CreateBackupInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		details := &dynamodb.BackupDetails{
+			BackupArn:              aws.String(fmt.Sprintf("arn:aws:dynamodb:us-east-1:000000000000:table/%s/backup/%d", aws.StringValue(in.TableName), now.UnixNano())),
+			BackupName:             in.BackupName,
+			BackupCreationDateTime: aws.Time(now),
+			BackupStatus:           aws.String(dynamodb.BackupStatusCreating),
+			BackupType:             aws.String(dynamodb.BackupTypeUser),
+		}
+		f.backups[*details.BackupArn] = details
+		return &dynamodb.CreateBackupOutput{BackupDetails: details}, nil
+	case "DescribeBackup":
+		in := &dynamodb.DescribeBackupInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		details, ok := f.backups[aws.StringValue(in.BackupArn)]
+		if !ok {
+			return nil, &fakeError{code: "BackupNotFoundException", msg: "Backup not found"}
+		}
+		if time.Since(*details.BackupCreationDateTime) >= fakeBackupDuration {
+			details.BackupStatus = aws.String(dynamodb.BackupStatusAvailable)
+		}
+		return &dynamodb.DescribeBackupOutput{BackupDescription: &dynamodb.BackupDescription{BackupDetails: details}}, nil
+	case "DeleteBackup":
+		in := &dynamodb.DeleteBackupInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		details, ok := f.backups[aws.StringValue(in.BackupArn)]
+		if !ok {
+			return nil, &fakeError{code: "BackupNotFoundException", msg: "Backup not found"}
+		}
+		delete(f.backups, aws.StringValue(in.BackupArn))
+		return &dynamodb.DeleteBackupOutput{BackupDescription: &dynamodb.BackupDescription{BackupDetails: details}}, nil
+	case "Query":
+		in := &dynamodb.QueryInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		return f.query(in)
+	case "Scan":
+		in := &dynamodb.ScanInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		return f.scan(in)
+	case "DescribeTable", "CreateTable", "DeleteTable":
+		in := &dynamodb.CreateTableInput{}
+		if err := decode(body, in); err != nil {
+			return nil, err
+		}
+		name := aws.StringValue(in.TableName)
+		switch op {
+		case "CreateTable":
+			if len(in.KeySchema) > 0 {
+				f.schemas[name] = in
+			}
+		case "DeleteTable":
+			delete(f.tables, name)
+			delete(f.billing, name)
+			delete(f.indexes, name)
+			delete(f.schemas, name)
+		}
+		desc := f.describe(name)
+		switch op {
+		case "CreateTable":
+			return &dynamodb.CreateTableOutput{TableDescription: desc}, nil
+		case "DeleteTable":
+			return &dynamodb.DeleteTableOutput{TableDescription: desc}, nil
+		}
+		return &dynamodb.DescribeTableOutput{Table: desc}, nil
+	}
+	return nil, &fakeError{code: "UnknownOperationException", msg: fmt.Sprintf("%s is not supported by the fake endpoint", op)}
+}
+
+func (f *FakeDynamoDB) table(name string) map[string]map[string]*dynamodb.AttributeValue {
+	t, ok := f.tables[name]
+	if !ok {
+		t = map[string]map[string]*dynamodb.AttributeValue{}
+		f.tables[name] = t
+	}
+	return t
+}
+
+func (f *FakeDynamoDB) describe(name string) *dynamodb.TableDescription {
+	mode := dynamodb.BillingModePayPerRequest
+	var throughput *dynamodb.ProvisionedThroughputDescription
+	if b, ok := f.billing[name]; ok && aws.StringValue(b.BillingMode) != dynamodb.BillingModePayPerRequest {
+		mode = dynamodb.BillingModeProvisioned
+		if pt := b.ProvisionedThroughput; pt != nil {
+			throughput = &dynamodb.ProvisionedThroughputDescription{
+				ReadCapacityUnits:  pt.ReadCapacityUnits,
+				WriteCapacityUnits: pt.WriteCapacityUnits,
+			}
+		}
+	}
+	var indexes []*dynamodb.GlobalSecondaryIndexDescription
+	for _, idx := range f.indexes[name] {
+		status, backfilling := dynamodb.IndexStatusActive, false
+		if time.Since(idx.created) < fakeBackfillDuration {
+			status, backfilling = dynamodb.IndexStatusCreating, true
+		}
+		gsi := &dynamodb.GlobalSecondaryIndexDescription{
+			IndexName:   idx.create.IndexName,
+			IndexStatus: aws.String(status),
+			Backfilling: aws.Bool(backfilling),
+			KeySchema:   idx.create.KeySchema,
+			Projection:  idx.create.Projection,
+		}
+		if pt := idx.create.ProvisionedThroughput; pt != nil {
+			gsi.ProvisionedThroughput = &dynamodb.ProvisionedThroughputDescription{
+				ReadCapacityUnits:  pt.ReadCapacityUnits,
+				WriteCapacityUnits: pt.WriteCapacityUnits,
+			}
+		}
+		indexes = append(indexes, gsi)
+	}
+	schema := f.schema(name)
+	var local []*dynamodb.LocalSecondaryIndexDescription
+	for _, lsi := range schema.LocalSecondaryIndexes {
+		local = append(local, &dynamodb.LocalSecondaryIndexDescription{IndexName: lsi.IndexName, KeySchema: lsi.KeySchema, Projection: lsi.Projection})
+	}
+	return &dynamodb.TableDescription{
+		LocalSecondaryIndexes:  local,
+		BillingModeSummary:     &dynamodb.BillingModeSummary{BillingMode: aws.String(mode)},
+		GlobalSecondaryIndexes: indexes,
+		ProvisionedThroughput:  throughput,
+		TableName:              aws.String(name),
+		TableStatus:            aws.String(dynamodb.TableStatusActive),
+		ItemCount:              aws.Int64(int64(len(f.tables[name]))),
+		KeySchema:              schema.KeySchema,
+		AttributeDefinitions:   schema.AttributeDefinitions,
+	}
+}
+
+// schema returns the key schema of the table, "id" (S) unless it was created
+// with another one.
+func (f *FakeDynamoDB) schema(name string) *dynamodb.CreateTableInput {
+	if in, ok := f.schemas[name]; ok {
+		return in
+	}
+	return &dynamodb.CreateTableInput{
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("id"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+		},
+	}
+}
+
+// collectionMetrics estimates the size of the item collection of the item,
+// in the whole GB ranges DynamoDB returns, for tables with local secondary
+// indexes.
+func (f *FakeDynamoDB) collectionMetrics(table string, item map[string]*dynamodb.AttributeValue) *dynamodb.ItemCollectionMetrics {
+	schema := f.schema(table)
+	if len(schema.LocalSecondaryIndexes) == 0 {
+		return nil
+	}
+	var hash string
+	for _, k := range schema.KeySchema {
+		if aws.StringValue(k.KeyType) == dynamodb.KeyTypeHash {
+			hash = aws.StringValue(k.AttributeName)
+		}
+	}
+	size := 0
+	for _, other := range f.table(table) {
+		if other[hash].String() == item[hash].String() {
+			size += len(wireJSON(other))
+		}
+	}
+	gb := math.Floor(float64(size) / (1 << 30))
+	return &dynamodb.ItemCollectionMetrics{
+		ItemCollectionKey:   map[string]*dynamodb.AttributeValue{hash: item[hash]},
+		SizeEstimateRangeGB: []*float64{aws.Float64(gb), aws.Float64(gb + 1)},
+	}
+}
+
+// itemKey returns the key attributes of the item (or key) joined into the
+// key of the table map.
+func (f *FakeDynamoDB) itemKey(table string, key map[string]*dynamodb.AttributeValue) (string, error) {
+	var parts []string
+	for _, k := range f.schema(table).KeySchema {
+		v, ok := key[aws.StringValue(k.AttributeName)]
+		switch {
+		case ok && v.S != nil && *v.S != "":
+			parts = append(parts, *v.S)
+		case ok && v.N != nil:
+			n, ok := parseNumber(v)
+			if !ok {
+				return "", validationError("The provided key element does not match the schema")
+			}
+			parts = append(parts, formatNumber(n))
+		default:
+			return "", validationError("The provided key element does not match the schema")
+		}
+	}
+	return strings.Join(parts, "\x00"), nil
+}
+
+// fakeWrite is the planned change of one item; new is nil for a delete.
+type fakeWrite struct {
+	table string
+	key   string
+	old   map[string]*dynamodb.AttributeValue
+	new   map[string]*dynamodb.AttributeValue
+}
+
+func (f *FakeDynamoDB) apply(w *fakeWrite) {
+	if w.new == nil {
+		delete(f.table(w.table), w.key)
+		return
+	}
+	f.table(w.table)[w.key] = w.new
+}
+
+// check plans a write to the item with key and evaluates the condition on
+// its current state.
+func (f *FakeDynamoDB) check(table string, key map[string]*dynamodb.AttributeValue, cond string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (*fakeWrite, error) {
+	k, err := f.itemKey(table, key)
+	if err != nil {
+		return nil, err
+	}
+	w := &fakeWrite{table: table, key: k, old: f.table(table)[k]}
+	c, err := parseCondition(cond, names, values)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := c(w.old)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return w, conditionFailed()
+	}
+	return w, nil
+}
+
+func (f *FakeDynamoDB) planPut(table string, item map[string]*dynamodb.AttributeValue, cond string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (*fakeWrite, error) {
+	w, err := f.check(table, item, cond, names, values)
+	if err != nil {
+		return w, err
+	}
+	if itemBytes(item) > maxItemBytes {
+		return nil, validationError("Item size has exceeded the maximum allowed size")
+	}
+	w.new = cloneItem(item)
+	return w, nil
+}
+
+func (f *FakeDynamoDB) planDelete(table string, key map[string]*dynamodb.AttributeValue, cond string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (*fakeWrite, error) {
+	return f.check(table, key, cond, names, values)
+}
+
+// planUpdate applies the update expression to a copy of the item. All
+// operands are evaluated on the item before the update, like DynamoDB does.
+func (f *FakeDynamoDB) planUpdate(table string, key map[string]*dynamodb.AttributeValue, update string, cond string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (*fakeWrite, []updateAction, error) {
+	actions, err := parseUpdate(update, names, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := f.check(table, key, cond, names, values)
+	if err != nil {
+		return w, nil, err
+	}
+	w.new = cloneItem(w.old)
+	if w.new == nil {
+		w.new = cloneItem(key)
+	}
+	old := w.old
+	if old == nil {
+		old = key
+	}
+	for _, a := range actions {
+		if _, isKey := key[a.path[0].name]; isKey {
+			return nil, nil, validationError("Cannot update attribute %s. This attribute is part of the key", a.path[0].name)
+		}
+		if a.remove {
+			removePath(w.new, a.path)
+			continue
+		}
+		v, err := a.value(old)
+		if err != nil {
+			return nil, nil, err
+		}
+		if v == nil {
+			return nil, nil, validationError("The provided expression refers to an attribute that does not exist in the item")
+		}
+		if err := setPath(w.new, a.path, cloneValue(v)); err != nil {
+			return nil, nil, err
+		}
+	}
+	if itemBytes(w.new) > maxItemBytes {
+		return nil, nil, validationError("Item size has exceeded the maximum allowed size")
+	}
+	return w, actions, nil
+}
+
+func (f *FakeDynamoDB) updateItem(in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	w, actions, err := f.planUpdate(aws.StringValue(in.TableName), in.Key, aws.StringValue(in.UpdateExpression),
+		aws.StringValue(in.ConditionExpression), in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	f.apply(w)
+	out := &dynamodb.UpdateItemOutput{}
+	// UPDATED_* return the whole top-level attributes an action touched.
+	updated := func(item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+		attrs := map[string]*dynamodb.AttributeValue{}
+		for _, a := range actions {
+			if v, ok := item[a.path[0].name]; ok {
+				attrs[a.path[0].name] = v
+			}
+		}
+		return attrs
+	}
+	switch aws.StringValue(in.ReturnValues) {
+	case dynamodb.ReturnValueAllOld:
+		out.Attributes = w.old
+	case dynamodb.ReturnValueAllNew:
+		out.Attributes = w.new
+	case dynamodb.ReturnValueUpdatedOld:
+		out.Attributes = updated(w.old)
+	case dynamodb.ReturnValueUpdatedNew:
+		out.Attributes = updated(w.new)
+	}
+	size := len(wireJSON(w.new))
+	if n := len(wireJSON(w.old)); n > size {
+		size = n
+	}
+	out.ConsumedCapacity = consumedCapacity(w.table, in.ReturnConsumedCapacity, float64((size+1023)/1024))
+	return out, nil
+}
+
+// consumedCapacity reports units for ReturnConsumedCapacity mode. The fake has
+// no secondary indexes, so INDEXES only adds the base table.
+func consumedCapacity(table string, mode *string, units float64) *dynamodb.ConsumedCapacity {
+	switch aws.StringValue(mode) {
+	case dynamodb.ReturnConsumedCapacityTotal:
+		return &dynamodb.ConsumedCapacity{TableName: aws.String(table), CapacityUnits: aws.Float64(units)}
+	case dynamodb.ReturnConsumedCapacityIndexes:
+		return &dynamodb.ConsumedCapacity{
+			TableName:     aws.String(table),
+			CapacityUnits: aws.Float64(units),
+			Table:         &dynamodb.Capacity{CapacityUnits: aws.Float64(units)},
+		}
+	}
+	return nil
+}
+
+func project(item map[string]*dynamodb.AttributeValue, projection *string, names map[string]*string) (map[string]*dynamodb.AttributeValue, error) {
+	if item == nil || aws.StringValue(projection) == "" {
+		return item, nil
+	}
+	attrs, err := parseProjection(*projection, names)
+	if err != nil {
+		return nil, err
+	}
+	projected := map[string]*dynamodb.AttributeValue{}
+	for name := range attrs {
+		if v, ok := item[name]; ok {
+			projected[name] = v
+		}
+	}
+	return projected, nil
+}
+
+func (f *FakeDynamoDB) getItem(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	k, err := f.itemKey(aws.StringValue(in.TableName), in.Key)
+	if err != nil {
+		return nil, err
+	}
+	item, err := project(f.table(aws.StringValue(in.TableName))[k], in.ProjectionExpression, in.ExpressionAttributeNames)
+	if err != nil {
+		return nil, err
+	}
+	// Eventually consistent reads cost half a unit per started 4KB.
+	units := float64((len(wireJSON(f.table(aws.StringValue(in.TableName))[k]))+4095)/4096) / 2
+	if units == 0 {
+		units = 0.5
+	}
+	if aws.BoolValue(in.ConsistentRead) {
+		units *= 2
+	}
+	return &dynamodb.GetItemOutput{Item: item, ConsumedCapacity: consumedCapacity(aws.StringValue(in.TableName), in.ReturnConsumedCapacity, units)}, nil
+}
+
+// transactWriteItems checks the conditions of all actions before applying
+// any of them and cancels the transaction with the reason of every action if
+// one fails.
+func (f *FakeDynamoDB) transactWriteItems(in *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	var writes []*fakeWrite
+	reasons := make([]*dynamodb.CancellationReason, len(in.TransactItems))
+	cancelled := false
+	seen := map[string]bool{}
+	for i, ti := range in.TransactItems {
+		var w *fakeWrite
+		var err error
+		switch {
+		case ti.Update != nil:
+			u := ti.Update
+			w, _, err = f.planUpdate(aws.StringValue(u.TableName), u.Key, aws.StringValue(u.UpdateExpression),
+				aws.StringValue(u.ConditionExpression), u.ExpressionAttributeNames, u.ExpressionAttributeValues)
+		case ti.Put != nil:
+			p := ti.Put
+			w, err = f.planPut(aws.StringValue(p.TableName), p.Item, aws.StringValue(p.ConditionExpression), p.ExpressionAttributeNames, p.ExpressionAttributeValues)
+		case ti.Delete != nil:
+			d := ti.Delete
+			w, err = f.planDelete(aws.StringValue(d.TableName), d.Key, aws.StringValue(d.ConditionExpression), d.ExpressionAttributeNames, d.ExpressionAttributeValues)
+		case ti.ConditionCheck != nil:
+			cc := ti.ConditionCheck
+			w, err = f.check(aws.StringValue(cc.TableName), cc.Key, aws.StringValue(cc.ConditionExpression), cc.ExpressionAttributeNames, cc.ExpressionAttributeValues)
+			if w != nil {
+				w = &fakeWrite{table: w.table, key: w.key, old: w.old, new: w.old}
+			}
+		default:
+			err = validationError("TransactItems can only contain one of Check, Put, Update or Delete")
+		}
+		reasons[i] = &dynamodb.CancellationReason{Code: aws.String("None")}
+		if fe, ok := err.(*fakeError); ok && fe.code == dynamodb.ErrCodeConditionalCheckFailedException {
+			reasons[i] = &dynamodb.CancellationReason{Code: aws.String("ConditionalCheckFailed"), Message: aws.String(fe.msg)}
+			cancelled = true
+		} else if err != nil {
+			return nil, err
+		}
+		if seen[w.table+"\x00"+w.key] {
+			return nil, validationError("Transaction request cannot include multiple operations on one item")
+		}
+		seen[w.table+"\x00"+w.key] = true
+		writes = append(writes, w)
+	}
+	if cancelled {
+		var codes []string
+		for _, r := range reasons {
+			codes = append(codes, aws.StringValue(r.Code))
+		}
+		return nil, &fakeError{
+			code:    "TransactionCanceledException",
+			msg:     "Transaction cancelled, please refer cancellation reasons for specific reasons [" + strings.Join(codes, ", ") + "]",
+			reasons: reasons,
+		}
+	}
+	for _, w := range writes {
+		f.apply(w)
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (f *FakeDynamoDB) batchWriteItem(in *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	for table, requests := range in.RequestItems {
+		for _, r := range requests {
+			var w *fakeWrite
+			var err error
+			switch {
+			case r.PutRequest != nil:
+				w, err = f.planPut(table, r.PutRequest.Item, "", nil, nil)
+			case r.DeleteRequest != nil:
+				w, err = f.planDelete(table, r.DeleteRequest.Key, "", nil, nil)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if w != nil {
+				f.apply(w)
+			}
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]*dynamodb.WriteRequest{}}, nil
+}
+
+func (f *FakeDynamoDB) batchGetItem(in *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	out := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]*dynamodb.AttributeValue{},
+		UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{},
+	}
+	for table, ka := range in.RequestItems {
+		for _, key := range ka.Keys {
+			k, err := f.itemKey(table, key)
+			if err != nil {
+				return nil, err
+			}
+			item, err := project(f.table(table)[k], ka.ProjectionExpression, ka.ExpressionAttributeNames)
+			if err != nil {
+				return nil, err
+			}
+			if item != nil {
+				out.Responses[table] = append(out.Responses[table], item)
+			}
+		}
+	}
+	return out, nil
+}
+
+// query returns the items of the table matching the key condition, in the
+// order of the sort key, a page of at most Limit items at a time.
+func (f *FakeDynamoDB) query(in *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	table := aws.StringValue(in.TableName)
+	match, err := parseCondition(aws.StringValue(in.KeyConditionExpression), in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	schema := f.schema(table)
+	keySchema := schema.KeySchema
+	for _, lsi := range schema.LocalSecondaryIndexes {
+		if aws.StringValue(lsi.IndexName) == aws.StringValue(in.IndexName) {
+			keySchema = lsi.KeySchema
+		}
+	}
+	var sortKey string
+	for _, k := range keySchema {
+		if aws.StringValue(k.KeyType) == dynamodb.KeyTypeRange {
+			sortKey = aws.StringValue(k.AttributeName)
+		}
+	}
+	var items []map[string]*dynamodb.AttributeValue
+	for _, item := range f.table(table) {
+		if sortKey != "" && item[sortKey] == nil {
+			// Items without the sort key of a local secondary index are not
+			// in the index.
+			continue
+		}
+		ok, err := match(item)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			items = append(items, item)
+		}
+	}
+	if sortKey != "" {
+		forward := in.ScanIndexForward == nil || *in.ScanIndexForward
+		sort.Slice(items, func(i, j int) bool {
+			c, _ := compareValues(items[i][sortKey], items[j][sortKey])
+			return (c < 0) == forward && c != 0
+		})
+	}
+	out := &dynamodb.QueryOutput{}
+	out.Items, out.LastEvaluatedKey, err = f.page(table, items, in.ExclusiveStartKey, in.Limit, in.ProjectionExpression, in.ExpressionAttributeNames)
+	if err != nil {
+		return nil, err
+	}
+	out.Count = aws.Int64(int64(len(out.Items)))
+	out.ScannedCount = out.Count
+	return out, nil
+}
+
+// scan returns the items of the table in the order of their keys.
+func (f *FakeDynamoDB) scan(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	table := aws.StringValue(in.TableName)
+	keys := map[string]map[string]*dynamodb.AttributeValue{}
+	var sorted []string
+	for _, item := range f.table(table) {
+		k, err := f.itemKey(table, item)
+		if err != nil {
+			return nil, err
+		}
+		keys[k] = item
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	var items []map[string]*dynamodb.AttributeValue
+	for _, k := range sorted {
+		items = append(items, keys[k])
+	}
+	out := &dynamodb.ScanOutput{}
+	var err error
+	out.Items, out.LastEvaluatedKey, err = f.page(table, items, in.ExclusiveStartKey, in.Limit, in.ProjectionExpression, in.ExpressionAttributeNames)
+	if err != nil {
+		return nil, err
+	}
+	out.Count = aws.Int64(int64(len(out.Items)))
+	out.ScannedCount = out.Count
+	return out, nil
+}
+
+// page returns the projected items after start, at most limit of them, and
+// the key to continue from if there are more.
+func (f *FakeDynamoDB) page(table string, items []map[string]*dynamodb.AttributeValue, start map[string]*dynamodb.AttributeValue, limit *int64, projection *string, names map[string]*string) ([]map[string]*dynamodb.AttributeValue, map[string]*dynamodb.AttributeValue, error) {
+	if start != nil {
+		startKey, err := f.itemKey(table, start)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, item := range items {
+			if k, _ := f.itemKey(table, item); k == startKey {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+	var lastKey map[string]*dynamodb.AttributeValue
+	if n := int(aws.Int64Value(limit)); n > 0 && len(items) > n {
+		items = items[:n]
+		last := items[n-1]
+		lastKey = map[string]*dynamodb.AttributeValue{}
+		for _, k := range f.schema(table).KeySchema {
+			lastKey[aws.StringValue(k.AttributeName)] = last[aws.StringValue(k.AttributeName)]
+		}
+	}
+	var projected []map[string]*dynamodb.AttributeValue
+	for _, item := range items {
+		p, err := project(item, projection, names)
+		if err != nil {
+			return nil, nil, err
+		}
+		projected = append(projected, p)
+	}
+	return projected, lastKey, nil
+}
@@ -0,0 +1,686 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// This file evaluates the subset of the DynamoDB expression language the
+// fake endpoint supports:
+//
+//	update:     SET path = value [, ...]  REMOVE path [, ...]
+//	value:      operand [+|- operand]
+//	operand:    path | :value | if_not_exists(path, value) | list_append(value, value) | size(path)
+//	condition:  [NOT] comparison | operand BETWEEN operand AND operand |
+//	            attribute_exists(path) | attribute_not_exists(path) |
+//	            begins_with(path, operand) | (condition), joined by AND and OR
+//	projection: path [, ...] (only the top-level attributes are projected)
+//
+// Paths are attribute names or #names followed by .name and [index].
+
+type pathElem struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+type valueFn func(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error)
+
+type condFn func(item map[string]*dynamodb.AttributeValue) (bool, error)
+
+type updateAction struct {
+	path   []pathElem
+	value  valueFn
+	remove bool
+}
+
+func validationError(format string, args ...interface{}) error {
+	return &fakeError{code: "ValidationException", msg: fmt.Sprintf(format, args...)}
+}
+
+type exprParser struct {
+	toks   []string
+	pos    int
+	names  map[string]*string
+	values map[string]*dynamodb.AttributeValue
+}
+
+func tokenize(expr string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(expr); {
+		ch := expr[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '#' || ch == ':' || ch == '_' || isAlnum(ch):
+			j := i + 1
+			for j < len(expr) && (expr[j] == '_' || isAlnum(expr[j])) {
+				j++
+			}
+			toks = append(toks, expr[i:j])
+			i = j
+		case ch == '<' && i+1 < len(expr) && (expr[i+1] == '>' || expr[i+1] == '='),
+			ch == '>' && i+1 < len(expr) && expr[i+1] == '=':
+			toks = append(toks, expr[i:i+2])
+			i += 2
+		case strings.IndexByte("().,[]=<>+-", ch) >= 0:
+			toks = append(toks, expr[i:i+1])
+			i++
+		default:
+			return nil, validationError("Invalid expression: syntax error; token: %q", string(ch))
+		}
+	}
+	return toks, nil
+}
+
+func isAlnum(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
+
+func newExprParser(expr string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (*exprParser, error) {
+	toks, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &exprParser{toks: toks, names: names, values: values}, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *exprParser) expect(tok string) error {
+	if t := p.next(); t != tok {
+		return validationError("Invalid expression: expected %q, got %q", tok, t)
+	}
+	return nil
+}
+
+func (p *exprParser) keyword(kw string) bool {
+	return strings.EqualFold(p.peek(), kw)
+}
+
+func (p *exprParser) name(tok string) (string, error) {
+	if strings.HasPrefix(tok, "#") {
+		n, ok := p.names[tok]
+		if !ok || n == nil {
+			return "", validationError("An expression attribute name used in the document path is not defined; attribute name: %s", tok)
+		}
+		return *n, nil
+	}
+	if tok == "" || tok[0] == ':' || !(tok[0] == '_' || isAlnum(tok[0])) {
+		return "", validationError("Invalid expression: expected an attribute name, got %q", tok)
+	}
+	return tok, nil
+}
+
+func (p *exprParser) parsePath() ([]pathElem, error) {
+	n, err := p.name(p.next())
+	if err != nil {
+		return nil, err
+	}
+	path := []pathElem{{name: n}}
+	for {
+		switch p.peek() {
+		case ".":
+			p.next()
+			n, err := p.name(p.next())
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, pathElem{name: n})
+		case "[":
+			p.next()
+			i, err := strconv.Atoi(p.next())
+			if err != nil || i < 0 {
+				return nil, validationError("Invalid expression: list index must be a non-negative integer")
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			path = append(path, pathElem{index: i, isIndex: true})
+		default:
+			return path, nil
+		}
+	}
+}
+
+func (p *exprParser) parseValue() (valueFn, error) {
+	a, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.peek(); op == "+" || op == "-" {
+		p.next()
+		b, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return func(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+			x, err := a(item)
+			if err != nil {
+				return nil, err
+			}
+			y, err := b(item)
+			if err != nil {
+				return nil, err
+			}
+			return arithmetic(op, x, y)
+		}, nil
+	}
+	return a, nil
+}
+
+func (p *exprParser) parseOperand() (valueFn, error) {
+	tok := p.peek()
+	if strings.HasPrefix(tok, ":") {
+		p.next()
+		v, ok := p.values[tok]
+		if !ok {
+			return nil, validationError("An expression attribute value used in expression is not defined; attribute value: %s", tok)
+		}
+		return func(map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) { return v, nil }, nil
+	}
+	if p.pos+1 < len(p.toks) && p.toks[p.pos+1] == "(" {
+		fn := p.next()
+		p.next()
+		var f valueFn
+		switch fn {
+		case "if_not_exists":
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			def, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			f = func(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+				if v := getPath(item, path); v != nil {
+					return v, nil
+				}
+				return def(item)
+			}
+		case "list_append":
+			a, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			b, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			f = func(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+				x, err := a(item)
+				if err != nil {
+					return nil, err
+				}
+				y, err := b(item)
+				if err != nil {
+					return nil, err
+				}
+				if x == nil || y == nil || x.L == nil || y.L == nil {
+					return nil, validationError("An operand in the update expression has an incorrect data type")
+				}
+				l := append(append([]*dynamodb.AttributeValue{}, x.L...), y.L...)
+				return &dynamodb.AttributeValue{L: l}, nil
+			}
+		case "size":
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			f = func(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+				v := getPath(item, path)
+				if v == nil {
+					return nil, nil
+				}
+				n := len(wireJSON(v))
+				switch {
+				case v.S != nil:
+					n = len(*v.S)
+				case v.B != nil:
+					n = len(v.B)
+				case v.L != nil:
+					n = len(v.L)
+				case v.M != nil:
+					n = len(v.M)
+				}
+				s := strconv.Itoa(n)
+				return &dynamodb.AttributeValue{N: &s}, nil
+			}
+		default:
+			return nil, validationError("Invalid expression: unsupported function %q", fn)
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return func(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+		return getPath(item, path), nil
+	}, nil
+}
+
+// parseUpdate parses an update expression.
+func parseUpdate(expr string, names map[string]*string, values map[string]*dynamodb.AttributeValue) ([]updateAction, error) {
+	p, err := newExprParser(expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+	var actions []updateAction
+	for p.peek() != "" {
+		clause := strings.ToUpper(p.next())
+		if clause != "SET" && clause != "REMOVE" {
+			return nil, validationError("Invalid UpdateExpression: unsupported clause %q", clause)
+		}
+		for {
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			a := updateAction{path: path, remove: clause == "REMOVE"}
+			if !a.remove {
+				if err := p.expect("="); err != nil {
+					return nil, err
+				}
+				if a.value, err = p.parseValue(); err != nil {
+					return nil, err
+				}
+			}
+			actions = append(actions, a)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+	}
+	if len(actions) == 0 {
+		return nil, validationError("Invalid UpdateExpression: The expression can not be empty")
+	}
+	return actions, nil
+}
+
+// parseCondition parses a condition expression. An empty expression is
+// always true.
+func parseCondition(expr string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (condFn, error) {
+	if strings.TrimSpace(expr) == "" {
+		return func(map[string]*dynamodb.AttributeValue) (bool, error) { return true, nil }, nil
+	}
+	p, err := newExprParser(expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != "" {
+		return nil, validationError("Invalid ConditionExpression: unexpected token %q", t)
+	}
+	return c, nil
+}
+
+func (p *exprParser) parseOr() (condFn, error) {
+	a, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		p.next()
+		b, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x := a
+		a = func(item map[string]*dynamodb.AttributeValue) (bool, error) {
+			if ok, err := x(item); ok || err != nil {
+				return ok, err
+			}
+			return b(item)
+		}
+	}
+	return a, nil
+}
+
+func (p *exprParser) parseAnd() (condFn, error) {
+	a, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		p.next()
+		b, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		x := a
+		a = func(item map[string]*dynamodb.AttributeValue) (bool, error) {
+			if ok, err := x(item); !ok || err != nil {
+				return ok, err
+			}
+			return b(item)
+		}
+	}
+	return a, nil
+}
+
+func (p *exprParser) parseNot() (condFn, error) {
+	if p.keyword("NOT") {
+		p.next()
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(item map[string]*dynamodb.AttributeValue) (bool, error) {
+			ok, err := c(item)
+			return !ok, err
+		}, nil
+	}
+	if p.peek() == "(" {
+		p.next()
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	}
+	if p.pos+1 < len(p.toks) && p.toks[p.pos+1] == "(" {
+		switch fn := p.peek(); fn {
+		case "attribute_exists", "attribute_not_exists", "begins_with":
+			p.next()
+			p.next()
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			var prefix valueFn
+			if fn == "begins_with" {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+				if prefix, err = p.parseOperand(); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return func(item map[string]*dynamodb.AttributeValue) (bool, error) {
+				v := getPath(item, path)
+				switch fn {
+				case "attribute_exists":
+					return v != nil, nil
+				case "attribute_not_exists":
+					return v == nil, nil
+				}
+				pre, err := prefix(item)
+				if err != nil || v == nil || v.S == nil || pre == nil || pre.S == nil {
+					return false, err
+				}
+				return strings.HasPrefix(*v.S, *pre.S), nil
+			}, nil
+		}
+	}
+	a, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.keyword("BETWEEN") {
+		p.next()
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, validationError("Invalid ConditionExpression: BETWEEN needs AND")
+		}
+		p.next()
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return func(item map[string]*dynamodb.AttributeValue) (bool, error) {
+			var v [3]*dynamodb.AttributeValue
+			for i, f := range []valueFn{a, low, high} {
+				x, err := f(item)
+				if err != nil || x == nil {
+					return false, err
+				}
+				v[i] = x
+			}
+			c1, ok1 := compareValues(v[1], v[0])
+			c2, ok2 := compareValues(v[0], v[2])
+			return ok1 && ok2 && c1 <= 0 && c2 <= 0, nil
+		}, nil
+	}
+	op := p.next()
+	switch op {
+	case "=", "<>", "<", "<=", ">", ">=":
+	default:
+		return nil, validationError("Invalid ConditionExpression: unsupported comparator %q", op)
+	}
+	b, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return func(item map[string]*dynamodb.AttributeValue) (bool, error) {
+		x, err := a(item)
+		if err != nil {
+			return false, err
+		}
+		y, err := b(item)
+		if err != nil {
+			return false, err
+		}
+		// Comparisons with a missing attribute are false.
+		if x == nil || y == nil {
+			return false, nil
+		}
+		if op == "=" || op == "<>" {
+			eq := bytes.Equal(wireJSON(x), wireJSON(y))
+			if c, ok := compareValues(x, y); ok {
+				eq = c == 0
+			}
+			return eq == (op == "="), nil
+		}
+		c, ok := compareValues(x, y)
+		if !ok {
+			return false, nil
+		}
+		switch op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	}, nil
+}
+
+// parseProjection returns the top-level attribute names of a projection
+// expression.
+func parseProjection(expr string, names map[string]*string) (map[string]bool, error) {
+	p, err := newExprParser(expr, names, nil)
+	if err != nil {
+		return nil, err
+	}
+	attrs := map[string]bool{}
+	for {
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		attrs[path[0].name] = true
+		if p.peek() == "" {
+			return attrs, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func parseNumber(v *dynamodb.AttributeValue) (*big.Rat, bool) {
+	if v == nil || v.N == nil {
+		return nil, false
+	}
+	return new(big.Rat).SetString(*v.N)
+}
+
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	return strings.TrimRight(r.FloatString(38), "0")
+}
+
+// compareValues orders two numbers, strings or binaries.
+func compareValues(a *dynamodb.AttributeValue, b *dynamodb.AttributeValue) (int, bool) {
+	if x, ok := parseNumber(a); ok {
+		if y, ok := parseNumber(b); ok {
+			return x.Cmp(y), true
+		}
+		return 0, false
+	}
+	if a.S != nil && b.S != nil {
+		return strings.Compare(*a.S, *b.S), true
+	}
+	if a.B != nil && b.B != nil {
+		return bytes.Compare(a.B, b.B), true
+	}
+	return 0, false
+}
+
+func arithmetic(op string, a *dynamodb.AttributeValue, b *dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	if a == nil || b == nil {
+		return nil, validationError("The provided expression refers to an attribute that does not exist in the item")
+	}
+	x, ok1 := parseNumber(a)
+	y, ok2 := parseNumber(b)
+	if !ok1 || !ok2 {
+		return nil, validationError("An operand in the update expression has an incorrect data type")
+	}
+	r := new(big.Rat)
+	if op == "+" {
+		r.Add(x, y)
+	} else {
+		r.Sub(x, y)
+	}
+	s := formatNumber(r)
+	return &dynamodb.AttributeValue{N: &s}, nil
+}
+
+func getPath(item map[string]*dynamodb.AttributeValue, path []pathElem) *dynamodb.AttributeValue {
+	v := item[path[0].name]
+	for _, e := range path[1:] {
+		switch {
+		case v == nil:
+			return nil
+		case e.isIndex:
+			if e.index >= len(v.L) {
+				return nil
+			}
+			v = v.L[e.index]
+		default:
+			v = v.M[e.name]
+		}
+	}
+	return v
+}
+
+// setPath sets the value at path. The parent of a nested path must exist; a
+// list index past the end appends to the list.
+func setPath(item map[string]*dynamodb.AttributeValue, path []pathElem, v *dynamodb.AttributeValue) error {
+	if len(path) == 1 {
+		item[path[0].name] = v
+		return nil
+	}
+	parent := getPath(item, path[:len(path)-1])
+	last := path[len(path)-1]
+	switch {
+	case parent == nil:
+	case last.isIndex && parent.L != nil:
+		if last.index >= len(parent.L) {
+			parent.L = append(parent.L, v)
+		} else {
+			parent.L[last.index] = v
+		}
+		return nil
+	case !last.isIndex && parent.M != nil:
+		parent.M[last.name] = v
+		return nil
+	}
+	return validationError("The document path provided in the update expression is invalid for update")
+}
+
+func removePath(item map[string]*dynamodb.AttributeValue, path []pathElem) {
+	if len(path) == 1 {
+		delete(item, path[0].name)
+		return
+	}
+	parent := getPath(item, path[:len(path)-1])
+	if parent == nil {
+		return
+	}
+	last := path[len(path)-1]
+	if !last.isIndex {
+		delete(parent.M, last.name)
+	} else if last.index < len(parent.L) {
+		parent.L = append(parent.L[:last.index:last.index], parent.L[last.index+1:]...)
+	}
+}
+
+func cloneValue(v *dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	if v.L != nil {
+		c.L = make([]*dynamodb.AttributeValue, len(v.L))
+		for i, e := range v.L {
+			c.L[i] = cloneValue(e)
+		}
+	}
+	if v.M != nil {
+		c.M = cloneItem(v.M)
+	}
+	return &c
+}
+
+func cloneItem(item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	if item == nil {
+		return nil
+	}
+	c := make(map[string]*dynamodb.AttributeValue, len(item))
+	for k, v := range item {
+		c[k] = cloneValue(v)
+	}
+	return c
+}
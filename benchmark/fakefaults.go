@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeFaults injects failures into the requests to the fake endpoint so the
+// retries, backoff and the circuit breaker of the benchmark can be exercised
+// offline. Decisions come from one random source seeded with Seed, so a run
+// with a single session fails the same requests every time.
+type FakeFaults struct {
+	// Latency is the distribution of the delay added to every request.
+	Latency     string
+	latency     func(rnd *rand.Rand) time.Duration
+	Throttle    float64
+	Conditional float64
+	Conflict    float64
+	Reset       float64
+	Seed        int64
+	// Ops, if not empty, are the only operations the faults apply to.
+	Ops []string
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// ParseFakeFaults parses a comma separated list of faults:
+//
+//	latency=fixed:<d> | uniform:<min>-<max> | exp:<mean>
+//	throttle=<p>     ProvisionedThroughputExceededException, retried by the SDK
+//	conditional=<p>  ConditionalCheckFailedException for requests with a condition
+//	conflict=<p>     TransactionCanceledException (TransactionConflict) for transactions
+//	reset=<p>        connection reset after the request was applied
+//	ops=<op>+<op>    only fail these operations, e.g. GetItem+Query
+//	seed=<n>         seed of the random source; Defaults to 1
+func ParseFakeFaults(spec string) (*FakeFaults, error) {
+	f := &FakeFaults{Seed: 1}
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid fault %q: expected <fault>=<value>", field)
+		}
+		name, value := kv[0], kv[1]
+		var err error
+		switch name {
+		case "latency":
+			f.Latency = value
+			f.latency, err = parseLatencyDist(value)
+		case "throttle":
+			f.Throttle, err = parseProbability(value)
+		case "conditional":
+			f.Conditional, err = parseProbability(value)
+		case "conflict":
+			f.Conflict, err = parseProbability(value)
+		case "reset":
+			f.Reset, err = parseProbability(value)
+		case "seed":
+			f.Seed, err = strconv.ParseInt(value, 10, 64)
+		case "ops":
+			f.Ops = strings.Split(value, "+")
+		default:
+			return nil, fmt.Errorf("unknown fault %q: must be one of latency, throttle, conditional, conflict, reset, ops, seed", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid fault %q: %v", field, err)
+		}
+	}
+	f.rnd = rand.New(rand.NewSource(f.Seed))
+	return f, nil
+}
+
+func parseProbability(s string) (float64, error) {
+	p, err := strconv.ParseFloat(s, 64)
+	if err != nil || p < 0 || p > 1 {
+		return 0, fmt.Errorf("probability must be between 0 and 1")
+	}
+	return p, nil
+}
+
+func parseLatencyDist(s string) (func(rnd *rand.Rand) time.Duration, error) {
+	kv := strings.SplitN(s, ":", 2)
+	if len(kv) != 2 {
+		return nil, fmt.Errorf("latency must be fixed:<d>, uniform:<min>-<max> or exp:<mean>")
+	}
+	switch kv[0] {
+	case "fixed", "exp":
+		d, err := time.ParseDuration(kv[1])
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid duration %q", kv[1])
+		}
+		if kv[0] == "exp" {
+			return func(rnd *rand.Rand) time.Duration { return time.Duration(rnd.ExpFloat64() * float64(d)) }, nil
+		}
+		return func(*rand.Rand) time.Duration { return d }, nil
+	case "uniform":
+		bounds := strings.SplitN(kv[1], "-", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("uniform latency must be <min>-<max>")
+		}
+		min, err1 := time.ParseDuration(bounds[0])
+		max, err2 := time.ParseDuration(bounds[1])
+		if err1 != nil || err2 != nil || min < 0 || max < min {
+			return nil, fmt.Errorf("invalid uniform latency %q", kv[1])
+		}
+		return func(rnd *rand.Rand) time.Duration {
+			return min + time.Duration(rnd.Int63n(int64(max-min)+1))
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown latency distribution %q", kv[0])
+}
+
+// fakeFaultPlan is what happens to one request.
+type fakeFaultPlan struct {
+	delay time.Duration
+	err   *fakeError
+	reset bool
+}
+
+// plan decides the faults of a request of op with body. A nil *FakeFaults
+// injects nothing.
+func (f *FakeFaults) plan(op string, body []byte) fakeFaultPlan {
+	var p fakeFaultPlan
+	if f == nil {
+		return p
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.latency != nil {
+		p.delay = f.latency(f.rnd)
+	}
+	// Draw every probability so the sequence of decisions does not depend
+	// on the outcome of earlier ones.
+	throttle := f.rnd.Float64() < f.Throttle
+	conditional := f.rnd.Float64() < f.Conditional
+	conflict := f.rnd.Float64() < f.Conflict
+	p.reset = f.rnd.Float64() < f.Reset
+	switch {
+	case throttle:
+		p.err = &fakeError{code: "ProvisionedThroughputExceededException", msg: "The level of configured provisioned throughput for the table was exceeded (injected)"}
+	case conditional && op != "TransactWriteItems" && bytes.Contains(body, []byte(`"ConditionExpression"`)):
+		p.err = conditionFailed()
+	case conflict && op == "TransactWriteItems":
+		p.err = &fakeError{
+			code: "TransactionCanceledException",
+			msg:  "Transaction cancelled, please refer cancellation reasons for specific reasons [TransactionConflict] (injected)",
+		}
+	}
+	if p.err != nil {
+		p.reset = false
+	}
+	if !f.applies(op) {
+		return fakeFaultPlan{}
+	}
+	return p
+}
+
+// applies tells whether the faults apply to op, see Ops.
+func (f *FakeFaults) applies(op string) bool {
+	if len(f.Ops) == 0 {
+		return true
+	}
+	for _, o := range f.Ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
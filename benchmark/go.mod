@@ -2,6 +2,10 @@ module benchmark
 
 go 1.17
 
-require github.com/aws/aws-sdk-go v1.43.5
+require (
+	github.com/anishathalye/porcupine v1.3.1
+	github.com/aws/aws-sdk-go v1.43.5
+	github.com/klauspost/compress v1.15.0
+)
 
 require github.com/jmespath/go-jmespath v0.4.0 // indirect
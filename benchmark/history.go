@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// HistoryEvent is one entry of a Jepsen-style operation history. Every
+// request attempt is an "invoke" followed by its completion: "ok", "fail"
+// when the request definitely did not take effect, or "info" when the outcome
+// is unknown (e.g. a timeout), after which the worker continues as a new
+// process as Jepsen requires.
+type HistoryEvent struct {
+	Index   int    `json:"index"`
+	Time    int64  `json:"time"`
+	Process int    `json:"process"`
+	Type    string `json:"type"`
+	F       string `json:"f"`
+	Value   *int64 `json:"value"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (e HistoryEvent) edn() string {
+	value := "nil"
+	if e.Value != nil {
+		value = strconv.FormatInt(*e.Value, 10)
+	}
+	s := fmt.Sprintf("{:index %d, :time %d, :process %d, :type :%s, :f :%s, :value %s",
+		e.Index, e.Time, e.Process, e.Type, e.F, value)
+	if e.Error != "" {
+		s += ", :error " + strconv.Quote(e.Error)
+	}
+	return s + "}"
+}
+
+// History writes the events of the run to a file, one per line, as JSON or
+// EDN, and/or keeps them in memory for the linearizability check. Times are
+// nanoseconds since the history was opened. A nil *History records nothing.
+type History struct {
+	mu     sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	format string
+	clock  *Clock
+	start  time.Time
+	index  int
+	events []HistoryEvent
+	keep   bool
+	err    error
+}
+
+// NewHistory records to path unless it is empty and keeps the events in
+// memory if keep is set.
+func NewHistory(path string, format string, clock *Clock, keep bool) (*History, error) {
+	h := &History{
+		format: format,
+		clock:  clock,
+		start:  clock.Now(),
+		keep:   keep,
+	}
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create history file: %v", err)
+		}
+		h.file = f
+		h.w = bufio.NewWriter(f)
+	}
+	return h, nil
+}
+
+func (h *History) add(e HistoryEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e.Index = h.index
+	e.Time = int64(h.clock.Now().Sub(h.start))
+	h.index++
+	if h.keep {
+		h.events = append(h.events, e)
+	}
+	if h.file == nil || h.err != nil {
+		return
+	}
+	var line []byte
+	if h.format == "edn" {
+		line = []byte(e.edn())
+	} else {
+		line, h.err = json.Marshal(e)
+	}
+	h.w.Write(line)
+	h.err = h.w.WriteByte('\n')
+}
+
+// Invoke records the start of an operation by process.
+func (h *History) Invoke(process int, f string) {
+	if h == nil {
+		return
+	}
+	h.add(HistoryEvent{Process: process, Type: "invoke", F: f})
+}
+
+// Complete records the outcome of the operation process invoked last and
+// returns the process to use for the next operation, which changes after an
+// indeterminate outcome.
+func (h *History) Complete(process int, f string, value *int64, err error, processes int) int {
+	if h == nil {
+		return process
+	}
+	e := HistoryEvent{Process: process, Type: historyType(err), F: f}
+	if err == nil {
+		e.Value = value
+	} else {
+		e.Error = err.Error()
+	}
+	h.add(e)
+	if e.Type == "info" {
+		return process + processes
+	}
+	return process
+}
+
+// Events returns the events kept in memory.
+func (h *History) Events() []HistoryEvent {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]HistoryEvent(nil), h.events...)
+}
+
+func (h *History) Close() error {
+	if h == nil || h.file == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.w.Flush(); err != nil && h.err == nil {
+		h.err = err
+	}
+	if err := h.file.Close(); err != nil && h.err == nil {
+		h.err = err
+	}
+	return h.err
+}
+
+// historyType classifies the outcome of a request. DynamoDB rejects requests
+// with a 4xx status (conditional check failures, throttling, validation)
+// without applying them; anything else may or may not have taken effect.
+func historyType(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() >= 400 && reqErr.StatusCode() < 500 {
+		return "fail"
+	}
+	return "info"
+}
+
+// ageValue returns the "age" attribute of an item, or nil if it has none.
+func ageValue(item map[string]*dynamodb.AttributeValue) *int64 {
+	av, ok := item["age"]
+	if !ok || av.N == nil {
+		return nil
+	}
+	v, err := strconv.ParseInt(*av.N, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
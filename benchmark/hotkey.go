@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// HotKeyShift is the traffic on one hot key of -shift-hotkey, from the
+// shift to it until the next one.
+type HotKeyShift struct {
+	Key       string  `json:"key"`
+	AtSec     float64 `json:"at_sec"`
+	Requests  uint64  `json:"requests"`
+	Throttles uint64  `json:"throttles"`
+	// FirstThrottleSec is the time from the shift to the first bucket with
+	// throttled attempts.
+	FirstThrottleSec *float64 `json:"first_throttle_sec,omitempty"`
+	// ThrottlingStoppedSec is the time from the shift to the end of the last
+	// bucket with throttled attempts, i.e. how long adaptive capacity took to
+	// absorb the new hot key. Not set if the key was never throttled or still
+	// was in the last bucket before the next shift.
+	ThrottlingStoppedSec *float64 `json:"throttling_stopped_sec,omitempty"`
+	FirstRequestsPerSec  float64  `json:"first_requests_per_sec"`
+	LastRequestsPerSec   float64  `json:"last_requests_per_sec"`
+}
+
+func (s HotKeyShift) String() string {
+	throttling := "no throttling"
+	switch {
+	case s.ThrottlingStoppedSec != nil:
+		throttling = fmt.Sprintf("first throttle after %.1fs, throttling stopped after %.1fs", *s.FirstThrottleSec, *s.ThrottlingStoppedSec)
+	case s.FirstThrottleSec != nil:
+		throttling = fmt.Sprintf("first throttle after %.1fs, still throttled at the end", *s.FirstThrottleSec)
+	}
+	return fmt.Sprintf("[Hot key %s] at %.1fs: requests %d, throttled attempts %d, %s, requests/sec %.2f -> %.2f",
+		s.Key, s.AtSec, s.Requests, s.Throttles, throttling, s.FirstRequestsPerSec, s.LastRequestsPerSec)
+}
+
+// hotKeyCount is the number of hot keys a run with -shift-hotkey goes
+// through.
+func (c *DynamoDBBenchmark) hotKeyCount() int {
+	return int((c.Duration + c.ShiftHotkey - 1) / c.ShiftHotkey)
+}
+
+func (c *DynamoDBBenchmark) hotKey(n int) string {
+	return c.Id + "-hot-" + strconv.Itoa(n)
+}
+
+// targetKey is the key of the item the sessions read or write now: -id, or
+// with -shift-hotkey the hot key of the current period.
+func (c *DynamoDBBenchmark) targetKey() map[string]*dynamodb.AttributeValue {
+	id := c.Id
+	if c.ShiftHotkey > 0 {
+		n := int(time.Since(c.shiftStart)/c.ShiftHotkey) + 1
+		if n > c.hotKeyCount() {
+			n = c.hotKeyCount()
+		}
+		id = c.hotKey(n)
+	}
+	return map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}}
+}
+
+// keyPicker returns the key of the item a session reads or writes next when
+// it changes between calls: targetKey with -shift-hotkey, a key of -id-file,
+// or with -keys one of "<id>-1" ... "<id>-<keys>" picked by -key-skew. It is
+// nil when every call goes to -id.
+func (c *DynamoDBBenchmark) keyPicker(rnd *rand.Rand) func() map[string]*dynamodb.AttributeValue {
+	if c.ShiftHotkey > 0 {
+		return c.targetKey
+	}
+	if c.keyFile != nil {
+		skew, _ := parseKeySkew(c.KeySkew)
+		return c.keyFile.picker(rnd, skew)
+	}
+	if c.Keys <= 1 {
+		return nil
+	}
+	skew, _ := parseKeySkew(c.KeySkew)
+	pick := skew.picker(rnd, c.Keys)
+	return func() map[string]*dynamodb.AttributeValue {
+		return idKey(c.Id + "-" + strconv.Itoa(pick()))
+	}
+}
+
+// hotKeyShifts marks the shifts in the timeline and sums up the buckets of
+// every hot key. A bucket belongs to the hot key of its middle.
+func (c *DynamoDBBenchmark) hotKeyShifts(tl *Timeline) []HotKeyShift {
+	base := tl.Offset(c.shiftStart)
+	shifts := make([]HotKeyShift, c.hotKeyCount())
+	for n := range shifts {
+		at := time.Duration(n) * c.ShiftHotkey
+		tl.Annotate(c.shiftStart.Add(at), "Hot key "+c.hotKey(n+1))
+		shifts[n] = HotKeyShift{Key: c.hotKey(n + 1), AtSec: (base + at).Seconds()}
+	}
+	last := make([]*TimelinePoint, len(shifts))
+	series := tl.Series()
+	for i := range series {
+		p := &series[i]
+		middle := time.Duration(p.OffsetSec*float64(time.Second)) + tl.width/2
+		n := int((middle - base) / c.ShiftHotkey)
+		if n < 0 {
+			n = 0
+		}
+		if n >= len(shifts) {
+			n = len(shifts) - 1
+		}
+		s := &shifts[n]
+		if last[n] == nil {
+			s.FirstRequestsPerSec = p.RequestsPerSec
+		}
+		last[n] = p
+		s.Requests += p.Requests
+		s.Throttles += p.Throttles
+		if p.Throttles == 0 {
+			continue
+		}
+		if s.FirstThrottleSec == nil {
+			// The bucket may start a little before the shift.
+			first := p.OffsetSec - s.AtSec
+			if first < 0 {
+				first = 0
+			}
+			s.FirstThrottleSec = aws.Float64(first)
+		}
+		s.ThrottlingStoppedSec = aws.Float64(p.OffsetSec + tl.width.Seconds() - s.AtSec)
+	}
+	for n, p := range last {
+		if p == nil {
+			return shifts[:n]
+		}
+		shifts[n].LastRequestsPerSec = p.RequestsPerSec
+		if p.Throttles > 0 {
+			shifts[n].ThrottlingStoppedSec = nil
+		}
+	}
+	return shifts
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// IndexSpec is the global secondary index of -add-index.
+type IndexSpec struct {
+	Name          string
+	Attribute     string
+	AttributeType string
+}
+
+// parseIndexSpec parses "<name>:<attribute>[:S|N|B]"; the attribute type
+// defaults to S.
+func parseIndexSpec(s string) (IndexSpec, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return IndexSpec{}, fmt.Errorf("want <name>:<attribute>[:S|N|B], got %q", s)
+	}
+	if len(parts[0]) < 3 || len(parts[0]) > 255 {
+		return IndexSpec{}, fmt.Errorf("index name %q must be 3 to 255 characters long", parts[0])
+	}
+	spec := IndexSpec{Name: parts[0], Attribute: parts[1], AttributeType: dynamodb.ScalarAttributeTypeS}
+	if len(parts) == 3 {
+		switch t := strings.ToUpper(parts[2]); t {
+		case dynamodb.ScalarAttributeTypeS, dynamodb.ScalarAttributeTypeN, dynamodb.ScalarAttributeTypeB:
+			spec.AttributeType = t
+		default:
+			return IndexSpec{}, fmt.Errorf("unknown attribute type %q, want S, N or B", parts[2])
+		}
+	}
+	return spec, nil
+}
+
+// addIndexMonitor adds the global secondary index of -add-index to the table
+// -add-index-at into the run and follows the backfill until the index is
+// ACTIVE. The index projects all attributes and gets the throughput of the
+// table if the table is provisioned. The index is not deleted.
+func (c *DynamoDBBenchmark) addIndexMonitor(db *dynamodb.DynamoDB, timeline *Timeline) *EventMonitor {
+	spec, _ := parseIndexSpec(c.AddIndex)
+	begin := func() (string, string, error) {
+		desc, mode, _, _, err := billing(db, c.TableName)
+		if err != nil {
+			return "", "", err
+		}
+		create := &dynamodb.CreateGlobalSecondaryIndexAction{
+			IndexName: aws.String(spec.Name),
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{AttributeName: aws.String(spec.Attribute), KeyType: aws.String(dynamodb.KeyTypeHash)},
+			},
+			Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+		}
+		if mode == "provisioned" && desc.ProvisionedThroughput != nil {
+			create.ProvisionedThroughput = &dynamodb.ProvisionedThroughput{
+				ReadCapacityUnits:  desc.ProvisionedThroughput.ReadCapacityUnits,
+				WriteCapacityUnits: desc.ProvisionedThroughput.WriteCapacityUnits,
+			}
+		}
+		_, err = db.UpdateTable(&dynamodb.UpdateTableInput{
+			TableName: aws.String(c.TableName),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				{AttributeName: aws.String(spec.Attribute), AttributeType: aws.String(spec.AttributeType)},
+			},
+			GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{{Create: create}},
+		})
+		if err != nil {
+			return "", "", err
+		}
+		c.resources.Track(Resource{Kind: resourceIndex, Table: c.TableName, Name: spec.Name, RoleChain: c.clientOptions().RoleChain})
+		return spec.Name, dynamodb.IndexStatusCreating, nil
+	}
+	poll := func(name string) (string, bool, error) {
+		out, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(c.TableName)})
+		if err != nil {
+			return "", false, err
+		}
+		for _, gsi := range out.Table.GlobalSecondaryIndexes {
+			if aws.StringValue(gsi.IndexName) != name {
+				continue
+			}
+			status := aws.StringValue(gsi.IndexStatus)
+			if aws.BoolValue(gsi.Backfilling) {
+				status += " (backfilling)"
+			}
+			return status, aws.StringValue(gsi.IndexStatus) == dynamodb.IndexStatusActive, nil
+		}
+		return "", false, fmt.Errorf("index %s of table %s not found", name, c.TableName)
+	}
+	return NewEventMonitor("Index", c.AddIndexAt, timeline, c.Verbose, begin, poll)
+}
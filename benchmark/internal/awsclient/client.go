@@ -0,0 +1,298 @@
+// Package awsclient builds the AWS sessions and clients of the benchmark out
+// of its endpoint, TLS, proxy, region and role options. The counters and
+// tracers of the benchmark plug in as Instruments and a ProxyCounter.
+package awsclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// Instrument adds the handlers of a counter or tracer to the handler lists
+// of a session or client.
+type Instrument interface {
+	AddHandlers(h *request.Handlers)
+}
+
+// InstrumentFunc is an Instrument of a function.
+type InstrumentFunc func(h *request.Handlers)
+
+func (f InstrumentFunc) AddHandlers(h *request.Handlers) {
+	f(h)
+}
+
+// ProxyCounter wraps the Proxy function of the transport, e.g. to count the
+// requests it routes through a proxy.
+type ProxyCounter interface {
+	WrapProxy(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error)
+}
+
+// Options controls how the clients reach their endpoint.
+type Options struct {
+	EndpointUrl string
+	// EndpointScheme forces "http" or "https" regardless of the scheme of
+	// EndpointUrl (or the SDK default endpoint). Empty keeps it as is.
+	EndpointScheme     string
+	InsecureSkipVerify bool
+	CABundle           string
+	// Region and Profile override the shared config, e.g. to reach a table
+	// in another region or account.
+	Region  string
+	Profile string
+	// ProxyURL routes the requests through this proxy instead of the one
+	// of HTTP_PROXY / HTTPS_PROXY / NO_PROXY; Direct bypasses any proxy.
+	ProxyURL string
+	Direct   bool
+	// Proxies, if not nil, wraps the Proxy function of the transport.
+	Proxies ProxyCounter
+	// Transport, if not nil, sends the requests of the DynamoDB client to
+	// EndpointUrl instead of the network, e.g. to an in-process fake, with
+	// the credentials and region of Stub.
+	Transport http.RoundTripper
+	// EndpointDiscovery enables the endpoint discovery of the SDK.
+	EndpointDiscovery bool
+	// FIPS and DualStack make the SDK resolve the FIPS or dual-stack (IPv4
+	// and IPv6) variant of the regional endpoint.
+	FIPS      bool
+	DualStack bool
+	// SigningRegion, if not empty, signs the requests for this region
+	// instead of the one the endpoint resolved to.
+	SigningRegion string
+	// RunID is appended to the User-Agent of every request so CloudTrail
+	// entries can be attributed to the benchmark run.
+	RunID string
+	// Stub uses fixed credentials and region, which the in-process stub
+	// endpoints accept, so no AWS configuration is needed.
+	Stub bool
+	// RoleChain is assumed in order, each role with the credentials of the
+	// previous one and the first with the default credentials.
+	RoleChain      []string
+	RoleExternalID string
+	// Instruments are added in order to the handlers of the session.
+	Instruments []Instrument
+	// ClientInstruments are added in order to the handlers of the DynamoDB
+	// client of DynamoDB, after the protocol and signing handlers.
+	ClientInstruments []Instrument
+}
+
+// ParseProxyURL parses -proxy-url, an HTTP, HTTPS or SOCKS5 proxy.
+func ParseProxyURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("the scheme must be http, https or socks5 (got %q)", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("no host in %q", s)
+	}
+	return u, nil
+}
+
+var roleSessionNameInvalid = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// AssumeRoles returns the credentials of the last role of RoleChain.
+func (o Options) AssumeRoles(sess *session.Session) *credentials.Credentials {
+	name := "dynamodb-benchmark-" + roleSessionNameInvalid.ReplaceAllString(o.RunID, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	var creds *credentials.Credentials
+	for _, arn := range o.RoleChain {
+		client := sts.New(sess, &aws.Config{Credentials: creds})
+		creds = stscreds.NewCredentialsWithClient(client, arn, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = name
+			if o.RoleExternalID != "" {
+				p.ExternalID = aws.String(o.RoleExternalID)
+			}
+		})
+	}
+	return creds
+}
+
+func (o Options) endpoint() (string, error) {
+	if o.EndpointUrl == "" || o.EndpointScheme == "" {
+		return o.EndpointUrl, nil
+	}
+	u, err := url.Parse(o.EndpointUrl)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = o.EndpointScheme
+	return u.String(), nil
+}
+
+// HTTPClient returns the client of the TLS and proxy options.
+func (o Options) HTTPClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.CABundle != "" {
+		pem, err := os.ReadFile(o.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA bundle %s", o.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if o.ProxyURL != "" {
+		u, err := ParseProxyURL(o.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	if o.Direct {
+		transport.Proxy = nil
+	}
+	if o.Proxies != nil {
+		transport.Proxy = o.Proxies.WrapProxy(transport.Proxy)
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// Config returns the config of the DynamoDB client.
+func (o Options) Config() (*aws.Config, error) {
+	cfg := aws.NewConfig()
+	if o.Transport != nil {
+		return cfg.WithEndpoint(o.EndpointUrl).
+			WithHTTPClient(&http.Client{Transport: o.Transport}).
+			WithCredentials(credentials.NewStaticCredentials("stub", "stub", "")).
+			WithRegion("us-east-1"), nil
+	}
+	if o.Region != "" {
+		cfg.WithRegion(o.Region)
+	}
+	endpoint, err := o.endpoint()
+	if err != nil {
+		return nil, err
+	}
+	if endpoint != "" {
+		cfg.WithEndpoint(endpoint)
+	}
+	if o.EndpointScheme == "http" {
+		cfg.WithDisableSSL(true)
+	}
+	if o.EndpointDiscovery {
+		cfg.WithEndpointDiscovery(true)
+	}
+	if o.FIPS {
+		cfg.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+	}
+	if o.DualStack {
+		cfg.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+	}
+	if o.Stub {
+		cfg.WithCredentials(credentials.NewStaticCredentials("stub", "stub", "")).WithRegion("us-east-1")
+	}
+	if o.InsecureSkipVerify || o.CABundle != "" || o.ProxyURL != "" || o.Direct || o.Proxies != nil {
+		client, err := o.HTTPClient()
+		if err != nil {
+			return nil, err
+		}
+		cfg.WithHTTPClient(client)
+	}
+	return cfg, nil
+}
+
+// NewSession returns the session of the shared config of Profile with the
+// handlers of RunID and Instruments.
+func NewSession(o Options) (*session.Session, error) {
+	var cfg aws.Config
+	if o.ProxyURL != "" && o.Transport == nil {
+		// The roles of RoleChain are assumed through the proxy, too.
+		client, err := Options{ProxyURL: o.ProxyURL}.HTTPClient()
+		if err != nil {
+			return nil, err
+		}
+		cfg.HTTPClient = client
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            cfg,
+		SharedConfigState: session.SharedConfigEnable,
+		Profile:           o.Profile,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if o.RunID != "" {
+		sess.Handlers.Build.PushBack(request.MakeAddToUserAgentHandler("dynamodb-benchmark", o.RunID))
+	}
+	for _, i := range o.Instruments {
+		i.AddHandlers(&sess.Handlers)
+	}
+	return sess, nil
+}
+
+// DynamoDB returns the DynamoDB client of o.
+func DynamoDB(o Options) (*dynamodb.DynamoDB, error) {
+	cfg, err := o.Config()
+	if err != nil {
+		return nil, err
+	}
+	sess, err := NewSession(o)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.RoleChain) > 0 {
+		cfg.WithCredentials(o.AssumeRoles(sess))
+	}
+	db := o.NewDynamoDB(sess, cfg)
+	// After New, which adds the protocol and signing handlers to the client.
+	for _, i := range o.ClientInstruments {
+		i.AddHandlers(&db.Handlers)
+	}
+	return db, nil
+}
+
+// Lambda returns a Lambda client in the region and with the credentials of
+// o; the DynamoDB endpoint options do not apply to it.
+func Lambda(o Options) (*lambda.Lambda, error) {
+	sess, err := NewSession(Options{Profile: o.Profile, ProxyURL: o.ProxyURL})
+	if err != nil {
+		return nil, err
+	}
+	cfg := aws.NewConfig()
+	if o.Region != "" {
+		cfg.WithRegion(o.Region)
+	}
+	if len(o.RoleChain) > 0 {
+		cfg.WithCredentials(o.AssumeRoles(sess))
+	}
+	return lambda.New(sess, cfg), nil
+}
+
+// NewDynamoDB returns the client of sess and cfg signing for SigningRegion.
+func (o Options) NewDynamoDB(sess *session.Session, cfg *aws.Config) *dynamodb.DynamoDB {
+	db := dynamodb.New(sess, cfg)
+	if o.SigningRegion != "" {
+		db.ClientInfo.SigningRegion = o.SigningRegion
+	}
+	return db
+}
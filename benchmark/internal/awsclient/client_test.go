@@ -0,0 +1,94 @@
+package awsclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// roundTripper answers every request with an empty object.
+type roundTripper func(r *http.Request)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	f(r)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/x-amz-json-1.0"}},
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		Request:    r,
+	}, nil
+}
+
+// proxyCounter counts the requests of the transport.
+type proxyCounter struct{ n int }
+
+func (p *proxyCounter) WrapProxy(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(r *http.Request) (*url.URL, error) {
+		p.n++
+		return nil, nil
+	}
+}
+
+func TestDynamoDBInstruments(t *testing.T) {
+	var order []string
+	instrument := func(name string) Instrument {
+		return InstrumentFunc(func(h *request.Handlers) {
+			h.Send.PushFront(func(r *request.Request) { order = append(order, name) })
+		})
+	}
+	var userAgent string
+	db, err := DynamoDB(Options{
+		EndpointUrl: "http://stub.invalid",
+		Transport: roundTripper(func(r *http.Request) {
+			userAgent = r.Header.Get("User-Agent")
+		}),
+		RunID:             "run-1",
+		Instruments:       []Instrument{instrument("session 1"), instrument("session 2")},
+		ClientInstruments: []Instrument{instrument("client")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetItem(&dynamodb.GetItemInput{TableName: aws.String("tbl"), Key: map[string]*dynamodb.AttributeValue{"id": {S: aws.String("x")}}}); err != nil {
+		t.Fatal(err)
+	}
+	// PushFront runs the last added first.
+	if got := strings.Join(order, ", "); got != "client, session 2, session 1" {
+		t.Errorf("handlers ran in the order %s", got)
+	}
+	if !strings.Contains(userAgent, "dynamodb-benchmark/run-1") {
+		t.Errorf("User-Agent %q; want one with the run ID", userAgent)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	proxies := &proxyCounter{}
+	cfg, err := Options{EndpointUrl: "https://localhost:8000", EndpointScheme: "http", Region: "ap-northeast-1", Proxies: proxies}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.StringValue(cfg.Endpoint); got != "http://localhost:8000" {
+		t.Errorf("endpoint %s; want http://localhost:8000", got)
+	}
+	if !aws.BoolValue(cfg.DisableSSL) || aws.StringValue(cfg.Region) != "ap-northeast-1" {
+		t.Errorf("DisableSSL %v, region %s", aws.BoolValue(cfg.DisableSSL), aws.StringValue(cfg.Region))
+	}
+	proxy := cfg.HTTPClient.Transport.(*http.Transport).Proxy
+	if proxy == nil {
+		t.Fatal("no Proxy function of the ProxyCounter")
+	}
+	proxy(&http.Request{URL: &url.URL{Scheme: "http", Host: "localhost:8000"}})
+	if proxies.n != 1 {
+		t.Errorf("%d requests counted; want 1", proxies.n)
+	}
+
+	if _, err := (Options{ProxyURL: "ftp://proxy"}).Config(); err == nil {
+		t.Error("no error for a proxy of scheme ftp")
+	}
+}
@@ -0,0 +1,156 @@
+// Package cli reads the options of the benchmark and its subcommands which
+// were not given as flags from their DDB_BENCH_* environment variables or a
+// JSON config file.
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const envPrefix = "DDB_BENCH_"
+
+// flagAliases gives the single letter flags descriptive names for
+// environment variables and config files.
+var flagAliases = map[string]string{
+	"a": "action",
+	"c": "connections",
+	"n": "num-calls",
+	"r": "retry-num",
+}
+
+func longFlagName(name string) string {
+	if alias, ok := flagAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// envName returns the environment variable of a flag, e.g. DDB_BENCH_TABLE
+// for -table and DDB_BENCH_CONNECTIONS for -c.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(longFlagName(name), "-", "_"))
+}
+
+// readConfig reads a JSON object of flag names (or their long aliases) to
+// values, e.g. {"table": "t1", "connections": 10, "duration": "1h"}. An
+// object value becomes comma separated "<key>=<value>" entries and an array
+// its JSON. Options fs does not have are an error, unless subcommand is set:
+// the subcommands share the config file of the benchmark and take only the
+// options they have.
+func readConfig(fs *flag.FlagSet, path string, subcommand bool) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	raw := map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	names := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		names[f.Name] = f.Name
+		names[longFlagName(f.Name)] = f.Name
+	})
+	values := map[string]string{}
+	for key, v := range raw {
+		name, ok := names[key]
+		if !ok && subcommand {
+			continue
+		} else if !ok {
+			return nil, fmt.Errorf("config file %s: unknown option %q", path, key)
+		}
+		switch v := v.(type) {
+		case string:
+			values[name] = v
+		case json.Number, bool:
+			values[name] = fmt.Sprint(v)
+		case map[string]interface{}:
+			// e.g. {"read": 50, "write": 10} for -pools "read=50,write=10".
+			var entries []string
+			for k, x := range v {
+				entries = append(entries, fmt.Sprintf("%s=%v", k, x))
+			}
+			sort.Strings(entries)
+			values[name] = strings.Join(entries, ",")
+		case []interface{}:
+			// e.g. the named pools of -pools, passed on as JSON.
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("config file %s: option %q: %v", path, key, err)
+			}
+			values[name] = string(b)
+		default:
+			return nil, fmt.Errorf("config file %s: option %q must be a string, number, boolean, object or array", path, key)
+		}
+	}
+	return values, nil
+}
+
+// Sources maps the flags set from the environment or the config file to
+// where their value came from.
+type Sources map[string]string
+
+// Of returns where the value of the flag name came from, for the messages of
+// the values which are invalid: its environment variable, the config file or
+// else the flag itself.
+func (s Sources) Of(name string) string {
+	if source, ok := s[name]; ok {
+		return source
+	}
+	return "-" + name
+}
+
+// ApplyEnvAndConfig fills every flag that was not given on the command line
+// from its DDB_BENCH_* environment variable or else from the config file, so
+// the precedence is flag > environment > config file > default. subcommand
+// is set for the flags of the subcommands (see readConfig).
+func ApplyEnvAndConfig(fs *flag.FlagSet, configPath string, subcommand bool) (Sources, error) {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if !set["config"] {
+		if v, ok := os.LookupEnv(envName("config")); ok {
+			configPath = v
+		}
+	}
+	config := map[string]string{}
+	if configPath != "" {
+		var err error
+		if config, err = readConfig(fs, configPath, subcommand); err != nil {
+			return nil, err
+		}
+	}
+
+	sources := Sources{}
+	var errs []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || f.Name == "config" {
+			return
+		}
+		if v, ok := os.LookupEnv(envName(f.Name)); ok {
+			sources[f.Name] = fmt.Sprintf("%s=%q", envName(f.Name), v)
+			if err := fs.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", sources[f.Name], err))
+			}
+		} else if v, ok := config[f.Name]; ok {
+			sources[f.Name] = fmt.Sprintf("config file %s: %q", configPath, longFlagName(f.Name))
+			if err := fs.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", sources[f.Name], err))
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return sources, nil
+}
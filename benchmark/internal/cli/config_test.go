@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnvAndConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bench.json")
+	if err := os.WriteFile(path, []byte(`{"timezone": "Asia/Tokyo", "run-id": "r1", "connections": 10}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DDB_BENCH_RUN_ID", "r2")
+
+	// A subcommand takes its options out of the config file of the benchmark.
+	fs := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	timezone := fs.String("timezone", "UTC", "")
+	runID := fs.String("run-id", "", "")
+	list := fs.Bool("list", false, "")
+	if err := fs.Parse([]string{"-list"}); err != nil {
+		t.Fatal(err)
+	}
+	sources, err := ApplyEnvAndConfig(fs, path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *timezone != "Asia/Tokyo" || *runID != "r2" || !*list {
+		t.Errorf("-timezone %q, -run-id %q, -list %v; want Asia/Tokyo, r2 and true", *timezone, *runID, *list)
+	}
+	for name, want := range map[string]string{
+		"timezone": `config file ` + path + `: "timezone"`,
+		"run-id":   `DDB_BENCH_RUN_ID="r2"`,
+		"list":     "-list",
+	} {
+		if got := sources.Of(name); got != want {
+			t.Errorf("source of %s %s; want %s", name, got, want)
+		}
+	}
+
+	// The benchmark itself rejects the options it does not have.
+	fs = flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.String("timezone", "UTC", "")
+	fs.String("run-id", "", "")
+	if _, err := ApplyEnvAndConfig(fs, path, false); err == nil || !strings.Contains(err.Error(), `"connections"`) {
+		t.Errorf("error %v; want one of the unknown option \"connections\"", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Package metrics holds the latency histograms of the benchmark.
+package metrics
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	// histogramSubBits sets the precision: every power of two is split into
+	// 2^histogramSubBits linear sub-buckets, i.e. ~1.6% relative error.
+	histogramSubBits  = 6
+	histogramSubCount = 1 << histogramSubBits
+	// Latencies are recorded in microseconds up to 2^histogramMaxBits us
+	// (about 76 minutes); larger values are clamped.
+	histogramMaxBits = 32
+	histogramBuckets = (histogramMaxBits - histogramSubBits + 1) * histogramSubCount
+)
+
+// Histogram is a fixed-size log-linear latency histogram in the spirit of
+// HdrHistogram. It takes the same amount of memory no matter how many values
+// are recorded, and histograms can be merged without losing precision. It is
+// not safe for concurrent use.
+type Histogram struct {
+	counts [histogramBuckets]uint64
+	total  uint64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+func histogramIndex(us uint64) int {
+	if us < histogramSubCount {
+		return int(us)
+	}
+	if us >= 1<<histogramMaxBits {
+		us = 1<<histogramMaxBits - 1
+	}
+	exp := bits.Len64(us) - 1 - histogramSubBits
+	sub := int(us>>uint(exp)) - histogramSubCount
+	return (exp+1)*histogramSubCount + sub
+}
+
+// histogramValue returns the upper bound (in microseconds) of the values
+// stored in bucket i.
+func histogramValue(i int) uint64 {
+	if i < histogramSubCount {
+		return uint64(i)
+	}
+	exp := i/histogramSubCount - 1
+	sub := uint64(i%histogramSubCount + histogramSubCount)
+	return (sub+1)<<uint(exp) - 1
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	us := d.Microseconds()
+	if us < 0 {
+		us = 0
+	}
+	h.counts[histogramIndex(uint64(us))]++
+	h.total++
+}
+
+func (h *Histogram) Merge(other *Histogram) {
+	for i, n := range other.counts {
+		h.counts[i] += n
+	}
+	h.total += other.total
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.total
+}
+
+// Percentile returns the latency below which p percent (0-100) of the
+// recorded values fall, or 0 when nothing was recorded. The rank is the
+// nearest rank, rounded up, so a high percentile of few values is their
+// maximum rather than a value below the tail.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	// The epsilon keeps e.g. 99.9% of 1000 at rank 999 despite the binary
+	// representation of 99.9.
+	rank := uint64(math.Ceil(p*float64(h.total)/100 - 1e-9))
+	if rank == 0 {
+		rank = 1
+	}
+	if rank > h.total {
+		rank = h.total
+	}
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			return time.Duration(histogramValue(i)) * time.Microsecond
+		}
+	}
+	return 0
+}
+
+// Buckets returns the non-empty buckets as (bucket, count) pairs, a compact
+// form to ship a histogram to another process.
+func (h *Histogram) Buckets() [][2]uint64 {
+	var buckets [][2]uint64
+	for i, n := range h.counts {
+		if n > 0 {
+			buckets = append(buckets, [2]uint64{uint64(i), n})
+		}
+	}
+	return buckets
+}
+
+// FromBuckets restores a histogram from Buckets. Out of range
+// buckets are ignored.
+func FromBuckets(buckets [][2]uint64) *Histogram {
+	h := NewHistogram()
+	for _, b := range buckets {
+		if b[0] < histogramBuckets {
+			h.counts[b[0]] += b[1]
+			h.total += b[1]
+		}
+	}
+	return h
+}
+
+// UpperBound returns the upper bound of the bucket d is counted in, which
+// Percentile reports for it.
+func UpperBound(d time.Duration) time.Duration {
+	return time.Duration(histogramValue(histogramIndex(uint64(d.Microseconds())))) * time.Microsecond
+}
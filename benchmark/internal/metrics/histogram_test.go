@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramPercentile(t *testing.T) {
+	for _, n := range []int{1, 10, 40, 1000} {
+		h := NewHistogram()
+		for i := 1; i <= n; i++ {
+			h.Record(time.Duration(i) * time.Millisecond)
+		}
+		// The value a histogram reports for the i-th smallest of 1..n ms.
+		value := func(i int) time.Duration {
+			return UpperBound(time.Duration(i) * time.Millisecond)
+		}
+		for _, c := range []struct {
+			p    float64
+			rank int
+		}{
+			{0, 1},
+			{50, (n + 1) / 2},
+			{99, (99*n + 99) / 100},
+			{99.9, (999*n + 999) / 1000},
+			{100, n},
+		} {
+			if got, want := h.Percentile(c.p), value(c.rank); got != want {
+				t.Errorf("n=%d: p%v = %v, want %v (rank %d)", n, c.p, got, want, c.rank)
+			}
+		}
+		if got, want := h.Percentile(100), value(n); got != want {
+			t.Errorf("n=%d: p100 = %v, want the maximum %v", n, got, want)
+		}
+	}
+}
+
+func TestHistogramPercentileEmpty(t *testing.T) {
+	if got := NewHistogram().Percentile(99); got != 0 {
+		t.Errorf("p99 of no values = %v, want 0", got)
+	}
+}
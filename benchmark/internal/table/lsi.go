@@ -0,0 +1,74 @@
+package table
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// LSISpec is a local secondary index of -lsi: the partition key "id" of the
+// table with another sort key.
+type LSISpec struct {
+	Name          string
+	Attribute     string
+	AttributeType string
+}
+
+// ParseLSIs parses comma separated "<name>:<attribute>[:S|N|B]" entries; the
+// attribute type defaults to S.
+func ParseLSIs(spec string) ([]LSISpec, error) {
+	var lsis []LSISpec
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("-lsi entries must be <name>:<attribute>[:S|N|B] (got %q)", entry)
+		}
+		lsi := LSISpec{Name: parts[0], Attribute: parts[1], AttributeType: dynamodb.ScalarAttributeTypeS}
+		if len(parts) == 3 {
+			lsi.AttributeType = strings.ToUpper(parts[2])
+			if lsi.AttributeType != dynamodb.ScalarAttributeTypeS && lsi.AttributeType != dynamodb.ScalarAttributeTypeN && lsi.AttributeType != dynamodb.ScalarAttributeTypeB {
+				return nil, fmt.Errorf("-lsi attribute type must be S, N or B (got %q)", parts[2])
+			}
+		}
+		if lsi.Attribute == "id" {
+			return nil, fmt.Errorf("-lsi %q: the sort key of an index must not be the partition key \"id\"", entry)
+		}
+		lsis = append(lsis, lsi)
+	}
+	if len(lsis) > 5 {
+		return nil, fmt.Errorf("-lsi: a table can have at most 5 local secondary indexes (got %d)", len(lsis))
+	}
+	return lsis, nil
+}
+
+// localSecondaryIndexes adds the indexes, projecting all attributes, and
+// the definitions of their sort keys to the CreateTableInput.
+func localSecondaryIndexes(input *dynamodb.CreateTableInput, lsis []LSISpec) {
+	defined := map[string]bool{}
+	for _, def := range input.AttributeDefinitions {
+		defined[aws.StringValue(def.AttributeName)] = true
+	}
+	for _, lsi := range lsis {
+		if !defined[lsi.Attribute] {
+			input.AttributeDefinitions = append(input.AttributeDefinitions, &dynamodb.AttributeDefinition{
+				AttributeName: aws.String(lsi.Attribute),
+				AttributeType: aws.String(lsi.AttributeType),
+			})
+			defined[lsi.Attribute] = true
+		}
+		input.LocalSecondaryIndexes = append(input.LocalSecondaryIndexes, &dynamodb.LocalSecondaryIndex{
+			IndexName: aws.String(lsi.Name),
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{AttributeName: aws.String("id"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+				{AttributeName: aws.String(lsi.Attribute), KeyType: aws.String(dynamodb.KeyTypeRange)},
+			},
+			Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package table
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+const (
+	// partitionWriteCapacity is the write capacity one partition serves, so
+	// a table created with n times it starts with at least n partitions.
+	partitionWriteCapacity = 1000
+	// defaultCapacity is the read and write capacity Create gives a table,
+	// and the capacity a pre-split table is scaled down to.
+	defaultCapacity = 10
+)
+
+// preSplitThroughput is the capacity to create a table with so that it
+// starts with the given number of partitions; 0 partitions is the default
+// capacity.
+func preSplitThroughput(partitions int) *dynamodb.ProvisionedThroughput {
+	wcu := int64(defaultCapacity)
+	if partitions > 0 {
+		wcu = int64(partitions) * partitionWriteCapacity
+	}
+	return &dynamodb.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(defaultCapacity),
+		WriteCapacityUnits: aws.Int64(wcu),
+	}
+}
+
+// ScaleDownPreSplit waits until the table created with -pre-split is ACTIVE,
+// by which DynamoDB has split it into the partitions of its capacity, and
+// scales it down to the default capacity. The table keeps its partitions, so
+// a benchmark does not start on a single partition and throttle until
+// DynamoDB splits it under load. Note that DynamoDB limits how often the
+// capacity of a table can be decreased per day.
+func ScaleDownPreSplit(db dynamodbiface.DynamoDBAPI, tableName *string, partitions int, verbose bool) error {
+	start := time.Now()
+	if err := WaitActive(db, tableName, verbose); err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Printf("[Verbose] Table %s is ACTIVE with %d WCU after %.1f sec\n", *tableName, partitions*partitionWriteCapacity, time.Since(start).Seconds())
+	}
+	_, err := db.UpdateTable(&dynamodb.UpdateTableInput{
+		TableName:             tableName,
+		ProvisionedThroughput: preSplitThroughput(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scale table %s down: %v", *tableName, err)
+	}
+	if err := WaitActive(db, tableName, verbose); err != nil {
+		return err
+	}
+	fmt.Printf("Created table %s pre-split into at least %d partitions (%d WCU), scaled down to %d RCU / %d WCU after %.1f sec\n",
+		*tableName, partitions, partitions*partitionWriteCapacity, defaultCapacity, defaultCapacity, time.Since(start).Seconds())
+	return nil
+}
+
+// WaitActive polls the table until it is ACTIVE.
+func WaitActive(db dynamodbiface.DynamoDBAPI, tableName *string, verbose bool) error {
+	for {
+		out, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: tableName})
+		if err != nil {
+			return err
+		}
+		status := aws.StringValue(out.Table.TableStatus)
+		if status == dynamodb.TableStatusActive {
+			return nil
+		}
+		if verbose {
+			fmt.Printf("[Verbose] Table %s: %s\n", *tableName, status)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,148 @@
+// Package table creates the tables and items the benchmark runs against, for
+// the admin subcommand and the sessions of the benchmark alike.
+package table
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// Item is the item of the read and write actions, keyed by "id".
+type Item struct {
+	Id  string `json:"id"`
+	Age int64  `json:"age"`
+}
+
+// SSESpecification returns the SSESpecification of -sse and -kms-key, nil
+// for the AWS owned key DynamoDB uses by default.
+func SSESpecification(sse string, kmsKey string) (*dynamodb.SSESpecification, error) {
+	switch sse {
+	case "aws-owned":
+		if kmsKey != "" {
+			return nil, errors.New("-kms-key requires -sse customer-managed")
+		}
+		return nil, nil
+	case "aws-managed":
+		if kmsKey != "" {
+			return nil, errors.New("-kms-key requires -sse customer-managed")
+		}
+		return &dynamodb.SSESpecification{
+			Enabled: aws.Bool(true),
+			SSEType: aws.String(dynamodb.SSETypeKms),
+		}, nil
+	case "customer-managed":
+		if kmsKey == "" {
+			return nil, errors.New("-sse customer-managed requires -kms-key")
+		}
+		return &dynamodb.SSESpecification{
+			Enabled:        aws.Bool(true),
+			SSEType:        aws.String(dynamodb.SSETypeKms),
+			KMSMasterKeyId: aws.String(kmsKey),
+		}, nil
+	}
+	return nil, fmt.Errorf("-sse must be aws-owned, aws-managed or customer-managed (got %q)", sse)
+}
+
+// Create creates the table keyed by "id" (S) and sortKey, if any, of type
+// sortKeyType.
+func Create(db dynamodbiface.DynamoDBAPI, tableName *string, sortKey string, sortKeyType string, sse *dynamodb.SSESpecification, tags []*dynamodb.Tag, preSplit int, lsis []LSISpec) error {
+
+	attributeDefinitions := []*dynamodb.AttributeDefinition{
+		{
+			AttributeName: aws.String("id"),
+			AttributeType: aws.String("S"),
+		},
+	}
+
+	keySchema := []*dynamodb.KeySchemaElement{
+		{
+			AttributeName: aws.String("id"),
+			KeyType:       aws.String("HASH"),
+		},
+	}
+
+	if sortKey != "" {
+		attributeDefinitions = append(attributeDefinitions, &dynamodb.AttributeDefinition{
+			AttributeName: aws.String(sortKey),
+			AttributeType: aws.String(sortKeyType),
+		})
+		keySchema = append(keySchema, &dynamodb.KeySchemaElement{
+			AttributeName: aws.String(sortKey),
+			KeyType:       aws.String("RANGE"),
+		})
+	}
+
+	input := &dynamodb.CreateTableInput{
+		AttributeDefinitions:  attributeDefinitions,
+		KeySchema:             keySchema,
+		ProvisionedThroughput: preSplitThroughput(preSplit),
+		SSESpecification:      sse,
+		TableName:             tableName,
+		Tags:                  tags,
+	}
+	localSecondaryIndexes(input, lsis)
+	_, err := db.CreateTable(input)
+	return err
+}
+
+// CreateItem puts the Item id with age 1.
+func CreateItem(db dynamodbiface.DynamoDBAPI, tableName *string, id *string) error {
+
+	item := Item{
+		Id:  *id,
+		Age: 1,
+	}
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("Got error marshalling map: %v", err)
+	}
+	// Create item in table
+	param := &dynamodb.PutItemInput{
+		TableName: tableName,
+		Item:      av,
+	}
+
+	_, err = db.PutItem(param)
+	return err
+}
+
+func DeleteItem(db dynamodbiface.DynamoDBAPI, tableName *string, id *string) error {
+	param := &dynamodb.DeleteItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(*id),
+			},
+		},
+		TableName: tableName,
+	}
+	_, err := db.DeleteItem(param)
+	return err
+}
+
+// GetItem reads the Item id.
+func GetItem(db dynamodbiface.DynamoDBAPI, tableName *string, id *string) (Item, error) {
+	item := Item{}
+	result, err := db.GetItem(&dynamodb.GetItemInput{
+		TableName: tableName,
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(*id),
+			},
+		},
+	})
+	if err != nil {
+		return item, err
+	}
+	if result.Item == nil {
+		return item, errors.New("Could not find '" + *id + "'")
+	}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &item); err != nil {
+		return item, fmt.Errorf("Failed to unmarshal Record, %v", err)
+	}
+	return item, nil
+}
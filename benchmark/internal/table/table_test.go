@@ -0,0 +1,50 @@
+package table
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// getItemAPI answers GetItem with out and err.
+type getItemAPI struct {
+	dynamodbiface.DynamoDBAPI
+	out *dynamodb.GetItemOutput
+	err error
+}
+
+func (g getItemAPI) GetItem(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return g.out, g.err
+}
+
+func TestGetItem(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		api  getItemAPI
+		want Item
+		ok   bool
+	}{
+		{"found", getItemAPI{out: &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String("x")}, "age": {N: aws.String("3")},
+		}}}, Item{Id: "x", Age: 3}, true},
+		{"missing", getItemAPI{out: &dynamodb.GetItemOutput{}}, Item{}, false},
+		// Like the SDK on a failure, no output at all.
+		{"failed", getItemAPI{err: errors.New("throttled")}, Item{}, false},
+		{"not an item", getItemAPI{out: &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String("x")}, "age": {S: aws.String("old")},
+		}}}, Item{}, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			item, err := GetItem(c.api, aws.String("t"), aws.String("x"))
+			if (err == nil) != c.ok {
+				t.Fatalf("error %v", err)
+			}
+			if c.ok && item != c.want {
+				t.Errorf("item %+v; want %+v", item, c.want)
+			}
+		})
+	}
+}
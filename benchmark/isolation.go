@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// IsolationPoint is the latency of the victim pool of -victim-pool in one
+// time bucket.
+type IsolationPoint struct {
+	OffsetSec float64 `json:"offset_sec"`
+	Requests  uint64  `json:"requests"`
+	Errors    uint64  `json:"errors"`
+	Throttles uint64  `json:"throttles"`
+	AverageMs float64 `json:"average_ms"`
+	P50Ms     float64 `json:"p50_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+	// P99Ratio is P99Ms relative to the p99 of the baseline, 0 without a
+	// baseline.
+	P99Ratio float64 `json:"p99_ratio,omitempty"`
+	// Neighbors tells whether the other pools were running in the bucket.
+	Neighbors bool `json:"neighbors"`
+}
+
+func (p IsolationPoint) String() string {
+	s := fmt.Sprintf("requests %d, errors %d, throttled attempts %d, average (ms): %.3f, p50 (ms): %.3f, p99 (ms): %.3f",
+		p.Requests, p.Errors, p.Throttles, p.AverageMs, p.P50Ms, p.P99Ms)
+	if p.P99Ratio > 0 {
+		s += fmt.Sprintf(" (x%.2f of baseline)", p.P99Ratio)
+	}
+	if !p.Neighbors {
+		s += ", alone"
+	}
+	return s
+}
+
+// IsolationSummary is how the latency of the victim pool changed over the run
+// with the other pools, its noisy neighbors, sharing the table.
+type IsolationSummary struct {
+	VictimPool string `json:"victim_pool"`
+	// NeighborsStartSec is when the first of the other pools started, 0 if
+	// they started with the victim.
+	NeighborsStartSec float64 `json:"neighbors_start_sec"`
+	// Baseline is the victim alone, before NeighborsStartSec.
+	Baseline *WindowStats `json:"baseline,omitempty"`
+	// Shared is the victim from NeighborsStartSec on.
+	Shared WindowStats `json:"shared"`
+	// P99Degradation is the p99 of Shared relative to that of Baseline,
+	// and WorstP99Ratio the highest P99Ratio of a bucket.
+	P99Degradation float64          `json:"p99_degradation,omitempty"`
+	WorstP99Ratio  float64          `json:"worst_p99_ratio,omitempty"`
+	Buckets        []IsolationPoint `json:"buckets"`
+}
+
+func (s *IsolationSummary) Print() {
+	fmt.Printf("Isolation of pool %q:\n", s.VictimPool)
+	if s.Baseline != nil {
+		fmt.Printf("  alone (before %.1fs): requests/sec %.2f, errors %d, throttled attempts %d, average (ms): %.3f, p50 (ms): %.3f, p99 (ms): %.3f\n",
+			s.NeighborsStartSec, s.Baseline.RequestsPerSecond, s.Baseline.Errors, s.Baseline.Throttles, s.Baseline.AverageMs, s.Baseline.P50Ms, s.Baseline.P99Ms)
+	}
+	fmt.Printf("  shared (from %.1fs): requests/sec %.2f, errors %d, throttled attempts %d, average (ms): %.3f, p50 (ms): %.3f, p99 (ms): %.3f\n",
+		s.NeighborsStartSec, s.Shared.RequestsPerSecond, s.Shared.Errors, s.Shared.Throttles, s.Shared.AverageMs, s.Shared.P50Ms, s.Shared.P99Ms)
+	if s.Baseline != nil {
+		fmt.Printf("  p99 degradation: x%.2f overall, x%.2f in the worst bucket\n", s.P99Degradation, s.WorstP99Ratio)
+	}
+	for _, p := range s.Buckets {
+		fmt.Printf("  [%s %.1fs] %s\n", s.VictimPool, p.OffsetSec, p)
+	}
+}
+
+// neighborsStart is when the first pool other than -victim-pool starts.
+func (c *DynamoDBBenchmark) neighborsStart() time.Duration {
+	pools, _ := parsePools(c.Pools)
+	first := time.Duration(-1)
+	for _, p := range pools {
+		if p.Name == c.VictimPool {
+			continue
+		}
+		start, _ := time.ParseDuration(p.Options["start"])
+		if first < 0 || start < first {
+			first = start
+		}
+	}
+	if first < 0 {
+		return 0
+	}
+	return first
+}
+
+// isolationSummary compares the latency of the victim pool recorded in tl
+// alone and with its neighbors, bucket by bucket.
+func (c *DynamoDBBenchmark) isolationSummary(tl *Timeline) *IsolationSummary {
+	if tl == nil {
+		return nil
+	}
+	start := c.neighborsStart()
+	s := &IsolationSummary{
+		VictimPool:        c.VictimPool,
+		NeighborsStartSec: start.Seconds(),
+		Shared:            tl.Window(start, -1),
+	}
+	if start > 0 {
+		baseline := tl.Window(0, start)
+		s.Baseline = &baseline
+		if baseline.P99Ms > 0 {
+			s.P99Degradation = s.Shared.P99Ms / baseline.P99Ms
+		}
+	}
+	for _, b := range tl.Series() {
+		p := IsolationPoint{
+			OffsetSec: b.OffsetSec,
+			Requests:  b.Requests,
+			Errors:    b.Errors,
+			Throttles: b.Throttles,
+			AverageMs: b.AverageMs,
+			P50Ms:     b.P50Ms,
+			P99Ms:     b.P99Ms,
+			Neighbors: b.OffsetSec >= start.Seconds(),
+		}
+		if s.Baseline != nil && s.Baseline.P99Ms > 0 {
+			p.P99Ratio = p.P99Ms / s.Baseline.P99Ms
+			if p.Neighbors && p.P99Ratio > s.WorstP99Ratio {
+				s.WorstP99Ratio = p.P99Ratio
+			}
+		}
+		s.Buckets = append(s.Buckets, p)
+	}
+	return s
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Exit codes of the benchmark, documented for Kubernetes Jobs.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// summaryMarker starts the line the summary is sent to the JSON logger with,
+// so that it is written in order with the lines printed before it.
+const summaryMarker = "\x00summary "
+
+// LogEntry is one line of the structured log written by -k8s-friendly.
+type LogEntry struct {
+	Time    string   `json:"time"`
+	Level   string   `json:"level"`
+	RunID   string   `json:"run_id,omitempty"`
+	Msg     string   `json:"msg"`
+	Summary *Summary `json:"summary,omitempty"`
+}
+
+// JSONLogger turns everything the benchmark prints into one JSON object per
+// line. It replaces os.Stdout with a pipe and converts the lines read from it,
+// taking the level from the "[ERROR]", "[WARN]" and "[Verbose]" prefixes.
+// Indented lines keep the level of the line before them.
+// A nil *JSONLogger does nothing.
+type JSONLogger struct {
+	runID string
+	out   *os.File
+	pipe  *os.File
+	done  chan struct{}
+}
+
+func NewJSONLogger(runID string) (*JSONLogger, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log pipe: %v", err)
+	}
+	l := &JSONLogger{
+		runID: runID,
+		out:   os.Stdout,
+		pipe:  w,
+		done:  make(chan struct{}),
+	}
+	os.Stdout = w
+	go l.copy(r)
+	return l, nil
+}
+
+func (l *JSONLogger) copy(r *os.File) {
+	defer close(l.done)
+	defer r.Close()
+	enc := json.NewEncoder(l.out)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	level := "info"
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.Trim(line, "-") == "" {
+			continue
+		}
+		entry := LogEntry{
+			Time:  formatTime(time.Now(), time.RFC3339Nano),
+			Level: "info",
+			RunID: l.runID,
+		}
+		if strings.HasPrefix(line, summaryMarker) {
+			var sum Summary
+			if err := json.Unmarshal([]byte(line[len(summaryMarker):]), &sum); err == nil {
+				entry.Msg = "summary"
+				entry.Summary = &sum
+				enc.Encode(entry)
+				continue
+			}
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "- ") {
+			// Continuation of a multi-line message, e.g. validation errors.
+			entry.Level, entry.Msg = level, strings.TrimSpace(line)
+		} else {
+			entry.Level, entry.Msg = logLevel(line)
+			level = entry.Level
+		}
+		enc.Encode(entry)
+	}
+}
+
+// logLevel splits the level prefix off a printed line.
+func logLevel(line string) (string, string) {
+	for prefix, level := range map[string]string{
+		"[ERROR]":   "error",
+		"Error:":    "error",
+		"[WARN]":    "warn",
+		"[Verbose]": "debug",
+	} {
+		if strings.HasPrefix(line, prefix) {
+			return level, strings.TrimSpace(line[len(prefix):])
+		}
+	}
+	return "info", line
+}
+
+// Summary writes the summary as a single log entry.
+func (l *JSONLogger) Summary(sum Summary) {
+	b, err := json.Marshal(sum)
+	if err != nil {
+		fmt.Printf("[ERROR] failed to encode summary: %v\n", err)
+		return
+	}
+	fmt.Println(summaryMarker + string(b))
+}
+
+// Close writes out the remaining lines and restores os.Stdout.
+func (l *JSONLogger) Close() {
+	if l == nil {
+		return
+	}
+	os.Stdout = l.out
+	l.pipe.Close()
+	<-l.done
+}
+
+// logger is set by -k8s-friendly; exit flushes it before exiting.
+var logger *JSONLogger
+
+func exit(code int) {
+	logger.Close()
+	os.Exit(code)
+}
+
+// HealthServer serves the Kubernetes probes: /healthz answers 200 as long as
+// the process runs, /readyz answers 503 until the sessions have started.
+type HealthServer struct {
+	ready  int32
+	server *http.Server
+}
+
+func NewHealthServer(addr string) (*HealthServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start health server: %v", err)
+	}
+	h := &HealthServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&h.ready) == 0 {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	h.server = &http.Server{Handler: mux}
+	go h.server.Serve(ln)
+	return h, nil
+}
+
+// SetReady marks the benchmark as ready. Safe to call on a nil *HealthServer.
+func (h *HealthServer) SetReady() {
+	if h == nil {
+		return
+	}
+	atomic.StoreInt32(&h.ready, 1)
+}
+
+func (h *HealthServer) Stop() {
+	if h == nil {
+		return
+	}
+	h.server.Close()
+}
+
+// stopOnSignal makes all sessions stop after their current request when the
+// pod is terminated, so that the summary and results are still written.
+func (c *DynamoDBBenchmark) stopOnSignal() func() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		if s, ok := <-sig; ok {
+			fmt.Printf("[WARN] received %v, stopping all sessions\n", s)
+			atomic.StoreInt32(c.stopped, 1)
+		}
+	}()
+	return func() {
+		signal.Stop(sig)
+		close(sig)
+	}
+}
+
+// writeResults writes the summary to <dir>/<run id>.json, e.g. a volume
+// mounted into the pod, through a temporary file so that a reader never sees
+// a partial file.
+func writeResults(dir string, sum Summary) (string, error) {
+	b, err := json.MarshalIndent(sum, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create results directory: %v", err)
+	}
+	path := filepath.Join(dir, sum.RunID+".json")
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("failed to write results: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("failed to write results: %v", err)
+	}
+	return path, nil
+}
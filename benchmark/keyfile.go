@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// KeyFile is the key population of -id-file, e.g. exported from production.
+type KeyFile struct {
+	keys []string
+	// cumulative holds the running sum of the weights, nil when no line has
+	// a weight and -key-skew picks the keys.
+	cumulative []float64
+}
+
+// parseKeyLine splits a line of -id-file into its key and weight: "<key>",
+// or "<key>,<weight>" / "<key><tab><weight>". A key with a comma whose last
+// part is not a number keeps it.
+func parseKeyLine(line string) (key string, weight float64, weighted bool, err error) {
+	i := strings.LastIndexAny(line, ",\t")
+	if i < 0 {
+		return line, 1, false, nil
+	}
+	w, perr := strconv.ParseFloat(strings.TrimSpace(line[i+1:]), 64)
+	if perr != nil {
+		return line, 1, false, nil
+	}
+	if w < 0 {
+		return "", 0, false, fmt.Errorf("negative weight %g", w)
+	}
+	return strings.TrimSpace(line[:i]), w, true, nil
+}
+
+// loadKeyFile reads -id-file: one key per line, optionally with a weight;
+// blank lines and lines starting with "#" are skipped. Keys without a weight
+// weigh 1 if any other has one.
+func loadKeyFile(path string) (*KeyFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	kf := &KeyFile{}
+	var weights []float64
+	anyWeight := false
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, weight, weighted, err := parseKeyLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if key == "" {
+			return nil, fmt.Errorf("line %d: empty key", n)
+		}
+		kf.keys = append(kf.keys, key)
+		weights = append(weights, weight)
+		anyWeight = anyWeight || weighted
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(kf.keys) == 0 {
+		return nil, fmt.Errorf("no keys in %s", path)
+	}
+	if anyWeight {
+		var sum float64
+		for _, w := range weights {
+			sum += w
+			kf.cumulative = append(kf.cumulative, sum)
+		}
+		if sum == 0 {
+			return nil, fmt.Errorf("all weights in %s are 0", path)
+		}
+	}
+	return kf, nil
+}
+
+// Weighted tells whether the keys are drawn by their weights.
+func (kf *KeyFile) Weighted() bool {
+	return kf.cumulative != nil
+}
+
+// picker returns a function drawing keys by their weights, or else by skew
+// where the first key is the most popular.
+func (kf *KeyFile) picker(rnd *rand.Rand, skew KeySkew) func() map[string]*dynamodb.AttributeValue {
+	if kf.cumulative == nil {
+		pick := skew.picker(rnd, len(kf.keys))
+		return func() map[string]*dynamodb.AttributeValue {
+			return idKey(kf.keys[pick()-1])
+		}
+	}
+	total := kf.cumulative[len(kf.cumulative)-1]
+	return func() map[string]*dynamodb.AttributeValue {
+		x := rnd.Float64() * total
+		i := sort.Search(len(kf.cumulative), func(i int) bool { return kf.cumulative[i] > x })
+		if i == len(kf.keys) {
+			i--
+		}
+		return idKey(kf.keys[i])
+	}
+}
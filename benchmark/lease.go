@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func (c *DynamoDBBenchmark) leaseKey(k int) string {
+	return c.Id + "-lease-" + strconv.Itoa(k)
+}
+
+// leaseNames spells out the lease attributes, "owner" being a reserved word.
+var leaseNames = map[string]*string{
+	"#owner":   aws.String("owner"),
+	"#expires": aws.String("lease_expires_ms"),
+}
+
+// acquireInput takes the lease for -lease-duration on the condition that
+// nobody holds it or its holder's lease expired.
+func (c *DynamoDBBenchmark) acquireInput(k int, owner string, now time.Time) *dynamodb.UpdateItemInput {
+	ms := now.UnixNano() / int64(time.Millisecond)
+	return &dynamodb.UpdateItemInput{
+		TableName:                aws.String(c.TableName),
+		Key:                      idKey(c.leaseKey(k)),
+		UpdateExpression:         aws.String("SET #owner = :owner, #expires = :expires"),
+		ConditionExpression:      aws.String("attribute_not_exists(#owner) OR #expires < :now"),
+		ExpressionAttributeNames: leaseNames,
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner":   {S: aws.String(owner)},
+			":expires": {N: aws.String(strconv.FormatInt(ms+int64(c.LeaseDuration/time.Millisecond), 10))},
+			":now":     {N: aws.String(strconv.FormatInt(ms, 10))},
+		},
+	}
+}
+
+// releaseInput gives the lease up on the condition that owner still holds
+// it.
+func (c *DynamoDBBenchmark) releaseInput(k int, owner string) *dynamodb.UpdateItemInput {
+	return &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(c.TableName),
+		Key:                       idKey(c.leaseKey(k)),
+		UpdateExpression:          aws.String("REMOVE #owner, #expires"),
+		ConditionExpression:       aws.String("#owner = :owner"),
+		ExpressionAttributeNames:  leaseNames,
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":owner": {S: aws.String(owner)}},
+	}
+}
+
+// LeaseWorker is how one session fared.
+type LeaseWorker struct {
+	Session   int    `json:"session"`
+	Attempts  uint64 `json:"attempts"`
+	Acquired  uint64 `json:"acquired"`
+	Contended uint64 `json:"contended"`
+	// Lost counts the leases which had expired and been taken over by
+	// another session before the release.
+	Lost uint64 `json:"lost"`
+	wait runningMean
+	max  time.Duration
+}
+
+// LeaseResult is the outcome of the lease action.
+type LeaseResult struct {
+	RunID     string  `json:"run_id"`
+	Leases    int     `json:"leases"`
+	Attempts  uint64  `json:"attempts"`
+	Acquired  uint64  `json:"acquired"`
+	Contended uint64  `json:"contended"`
+	Lost      uint64  `json:"lost"`
+	Errors    uint64  `json:"errors"`
+	PerSecond float64 `json:"acquired_per_sec"`
+	// AverageWaitMs and MaxWaitMs are the time from the first attempt on a
+	// lease to its acquisition, over the contended attempts in between.
+	AverageWaitMs float64 `json:"average_wait_ms"`
+	MaxWaitMs     float64 `json:"max_wait_ms"`
+	// Fairness is Jain's index of the acquisitions per session, 1 when all
+	// sessions acquired as often and 1/sessions when one got them all.
+	Fairness float64          `json:"fairness"`
+	Workers  []LeaseWorker    `json:"workers"`
+	Outcomes []OutcomeLatency `json:"outcomes"`
+}
+
+// jainIndex is (sum x)^2 / (n * sum x^2), 1 if all x are 0.
+func jainIndex(xs []float64) float64 {
+	var sum, squares float64
+	for _, x := range xs {
+		sum += x
+		squares += x * x
+	}
+	if squares == 0 {
+		return 1
+	}
+	return sum * sum / (float64(len(xs)) * squares)
+}
+
+// RunLease models the lock client pattern, -n attempts per session (or
+// -duration): every session picks one of -leases lease items and tries to
+// acquire it with a conditional update which writes its name and an expiry
+// -lease-duration ahead, on the condition that nobody holds it or the lease
+// expired. A session which got the lease holds it for -lease-hold and
+// releases it on the condition that it still holds it; one which did not
+// tries the same lease again after -think-time. The summary reports the
+// acquisition latency, the contention and how fairly the sessions got
+// leases.
+func (c *DynamoDBBenchmark) RunLease() error {
+	c.clock = NewClock()
+	c.limiter = NewRateLimiter(c.Rate)
+	c.trackResource(Resource{Kind: resourceItems, Table: c.TableName, Name: c.Id + "-lease", Count: c.Leases})
+	c.health.SetReady()
+
+	stats := NewStats()
+	stats.Start()
+	if c.Duration > 0 {
+		c.deadline = time.Now().Add(c.Duration)
+	}
+	workers := make([]LeaseWorker, c.Connections)
+	var errors uint64
+
+	var wg sync.WaitGroup
+	for i := 1; i <= c.Connections; i++ {
+		wg.Add(1)
+		go func(id int, stats *WorkerStats) {
+			defer wg.Done()
+			time.Sleep(c.staggerDelay(id))
+
+			w := &workers[id-1]
+			w.Session = id
+			db, err := getDynamoDBClient(c.sessionClientOptions(id))
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			owner := c.RunID + "-" + strconv.Itoa(id)
+			rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+			k := 1 + rnd.Intn(c.Leases)
+			var waiting time.Time
+			for i := 1; c.moreCalls(id, i); i++ {
+				if waiting.IsZero() {
+					waiting = time.Now()
+				}
+				w.Attempts++
+				start := c.clock.Now()
+				_, err := db.UpdateItem(c.acquireInput(k, owner, time.Now()))
+				elapsed := time.Since(start)
+				if isConditionalCheckFailed(err) {
+					stats.Record("UpdateItem[contended]", start, elapsed, 1, nil)
+					w.Contended++
+					continue
+				}
+				stats.Record("UpdateItem[acquire]", start, elapsed, 1, err)
+				if err != nil {
+					atomic.AddUint64(&errors, 1)
+					if c.Verbose {
+						fmt.Printf("Error: %v\n", err)
+					}
+					continue
+				}
+				w.Acquired++
+				wait := time.Since(waiting)
+				w.wait.add(float64(wait) / float64(time.Millisecond))
+				if wait > w.max {
+					w.max = wait
+				}
+				waiting = time.Time{}
+
+				time.Sleep(c.LeaseHold)
+				start = c.clock.Now()
+				_, err = db.UpdateItem(c.releaseInput(k, owner))
+				elapsed = time.Since(start)
+				if isConditionalCheckFailed(err) {
+					stats.Record("UpdateItem[release-lost]", start, elapsed, 1, nil)
+					w.Lost++
+				} else {
+					stats.Record("UpdateItem[release]", start, elapsed, 1, err)
+					if err != nil && c.Verbose {
+						fmt.Printf("Error: %v\n", err)
+					}
+				}
+				k = 1 + rnd.Intn(c.Leases)
+			}
+		}(i, stats.Worker(i))
+	}
+	wg.Wait()
+	stats.Stop()
+
+	result := LeaseResult{RunID: c.RunID, Leases: c.Leases, Errors: errors, Workers: workers}
+	var wait runningMean
+	var max time.Duration
+	acquired := make([]float64, len(workers))
+	for i, w := range workers {
+		result.Attempts += w.Attempts
+		result.Acquired += w.Acquired
+		result.Contended += w.Contended
+		result.Lost += w.Lost
+		wait.merge(w.wait)
+		if w.max > max {
+			max = w.max
+		}
+		acquired[i] = float64(w.Acquired)
+	}
+	result.AverageWaitMs = wait.mean
+	result.MaxWaitMs = float64(max) / float64(time.Millisecond)
+	result.Fairness = jainIndex(acquired)
+	summary := stats.Summary(c.Action)
+	result.PerSecond = perSecond(result.Acquired, summary.DurationSec)
+	result.Outcomes = outcomeLatencies(summary)
+	printLease(c, result)
+	return nil
+}
+
+func printLease(c *DynamoDBBenchmark, r LeaseResult) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Summary - lease (%d leases, %s duration, %s hold)\n", r.Leases, c.LeaseDuration, c.LeaseHold)
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", r.RunID)
+	fmt.Printf("Attempts: %d, acquired: %d (%.2f%%), contended: %d (%.2f%%), errors: %d\n",
+		r.Attempts, r.Acquired, ratio(r.Acquired, r.Attempts)*100, r.Contended, ratio(r.Contended, r.Attempts)*100, r.Errors)
+	fmt.Printf("Acquired/sec: %.2f, wait until acquired (ms): average %.3f, max %.3f\n", r.PerSecond, r.AverageWaitMs, r.MaxWaitMs)
+	fmt.Printf("Fairness (Jain's index of the acquisitions per session): %.3f\n", r.Fairness)
+	printOutcomeLatencies(r.Outcomes)
+	fmt.Printf("%8s %10s %10s %10s %6s\n", "session", "attempts", "acquired", "contended", "lost")
+	for _, w := range r.Workers {
+		fmt.Printf("%8d %10d %10d %10d %6d\n", w.Session, w.Attempts, w.Acquired, w.Contended, w.Lost)
+	}
+	if r.Lost > 0 {
+		fmt.Printf("[WARN] %d leases expired and were taken over before their release; -lease-hold %s is not well below -lease-duration %s\n", r.Lost, c.LeaseHold, c.LeaseDuration)
+	}
+}
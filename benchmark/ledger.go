@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ledgerSortKey is the numeric sort key of the ledger table.
+const ledgerSortKey = "seq"
+
+// ledgerTrackEvery is how many events a session appends between two updates
+// of the run file of -cleanup (see ResourceTracker).
+const ledgerTrackEvery = 1000
+
+// ledgerMaxGaps is how many missing events of a stream are listed.
+const ledgerMaxGaps = 10
+
+func ledgerKey(stream string, seq int) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"id":          {S: aws.String(stream)},
+		ledgerSortKey: {N: aws.String(strconv.Itoa(seq))},
+	}
+}
+
+// ledgerStream is the partition key of the events appended by a session.
+func (c *DynamoDBBenchmark) ledgerStream(id int) string {
+	return c.Id + "-ledger-" + c.RunID + "-" + strconv.Itoa(id)
+}
+
+// LedgerStream is the outcome of the events one session appended.
+type LedgerStream struct {
+	Key string `json:"key"`
+	// Acknowledged is the last sequence number the session saw written.
+	Acknowledged int `json:"acknowledged"`
+	Found        int `json:"found"`
+	// Missing are the first ledgerMaxGaps acknowledged events not found.
+	Missing    []int `json:"missing,omitempty"`
+	Gaps       int   `json:"gaps"`
+	Unexpected int   `json:"unexpected"`
+}
+
+// LedgerResult is the outcome of the ledger action.
+type LedgerResult struct {
+	RunID      string         `json:"run_id"`
+	Requests   uint64         `json:"requests"`
+	Appended   uint64         `json:"appended"`
+	Duplicates uint64         `json:"duplicates"`
+	Errors     uint64         `json:"errors"`
+	EventsPerS float64        `json:"events_per_sec"`
+	AverageMs  float64        `json:"average_ms"`
+	P50Ms      float64        `json:"p50_ms"`
+	P99Ms      float64        `json:"p99_ms"`
+	Streams    []LedgerStream `json:"streams"`
+}
+
+// RunLedger appends immutable events to one stream per session, -n calls
+// per session (or -duration): each event is put under the partition key
+// "<id>-ledger-<run id>-<session>" with the next sequence number as the sort
+// key, on the condition that it does not exist yet. The sequence number only
+// advances once the event is acknowledged; a failed append is tried again
+// with the same number, and a condition failure means an earlier attempt
+// (e.g. one retried by the SDK after a lost response) was written. At the end
+// every stream is read back and checked to be contiguous.
+func (c *DynamoDBBenchmark) RunLedger() error {
+	db, err := getDynamoDBClient(c.clientOptions())
+	if err != nil {
+		return err
+	}
+	if err := c.checkSortKeyTable(db, "ledger", ledgerSortKey, dynamodb.ScalarAttributeTypeN); err != nil {
+		return err
+	}
+	c.clock = NewClock()
+	c.limiter = NewRateLimiter(c.Rate)
+	c.health.SetReady()
+
+	stats := NewStats()
+	stats.Start()
+	if c.Duration > 0 {
+		c.deadline = time.Now().Add(c.Duration)
+	}
+	streams := make([]LedgerStream, c.Connections)
+	var appended, duplicates, errors uint64
+
+	var wg sync.WaitGroup
+	for i := 1; i <= c.Connections; i++ {
+		wg.Add(1)
+		go func(id int, stats *WorkerStats) {
+			defer wg.Done()
+			time.Sleep(c.staggerDelay(id))
+
+			stream := c.ledgerStream(id)
+			streams[id-1].Key = stream
+			db, err := getDynamoDBClient(c.sessionClientOptions(id))
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			seq := 1
+			for i := 1; c.moreCalls(id, i); i++ {
+				if seq%ledgerTrackEvery == 1 {
+					c.trackResource(Resource{Kind: resourceStream, Table: c.TableName, Name: stream, Count: seq + ledgerTrackEvery - 1})
+				}
+				item := ledgerKey(stream, seq)
+				item["run_id"] = &dynamodb.AttributeValue{S: aws.String(c.RunID)}
+				item["session"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(id))}
+				item["created"] = &dynamodb.AttributeValue{S: aws.String(time.Now().UTC().Format(time.RFC3339Nano))}
+				start := c.clock.Now()
+				_, err := db.PutItem(&dynamodb.PutItemInput{
+					TableName:           aws.String(c.TableName),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				})
+				stats.Record("PutItem", start, time.Since(start), 1, err)
+				if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+					atomic.AddUint64(&duplicates, 1)
+					err = nil
+				} else if err == nil {
+					atomic.AddUint64(&appended, 1)
+				}
+				if err != nil {
+					atomic.AddUint64(&errors, 1)
+					if c.Verbose {
+						fmt.Printf("Error: %v\n", err)
+					}
+					continue
+				}
+				seq++
+			}
+			streams[id-1].Acknowledged = seq - 1
+			// The last failed append, if any, may have been written too.
+			c.trackResource(Resource{Kind: resourceStream, Table: c.TableName, Name: stream, Count: seq})
+		}(i, stats.Worker(i))
+	}
+	wg.Wait()
+	stats.Stop()
+
+	result := LedgerResult{RunID: c.RunID, Appended: appended, Duplicates: duplicates, Errors: errors}
+	for _, op := range stats.Summary(c.Action).Operations {
+		result.Requests = op.Success + op.Errors
+		result.EventsPerS = perSecond(appended+duplicates, op.DurationSec)
+		result.AverageMs = op.AverageMs
+		result.P50Ms = op.P50Ms
+		result.P99Ms = op.P99Ms
+	}
+	gaps := 0
+	for i := range streams {
+		if err := c.verifyStream(db, &streams[i]); err != nil {
+			return err
+		}
+		gaps += streams[i].Gaps
+	}
+	result.Streams = streams
+	printLedger(result)
+	if gaps > 0 {
+		return fmt.Errorf("ledger verification found %d acknowledged events missing", gaps)
+	}
+	return nil
+}
+
+// verifyStream reads the events of the stream back with consistent reads
+// and counts the acknowledged ones missing and those never acknowledged.
+func (c *DynamoDBBenchmark) verifyStream(db *dynamodb.DynamoDB, s *LedgerStream) error {
+	if s.Key == "" {
+		return nil
+	}
+	found := map[int]bool{}
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(c.TableName),
+		KeyConditionExpression:    aws.String("#id = :stream"),
+		ProjectionExpression:      aws.String("#seq"),
+		ExpressionAttributeNames:  map[string]*string{"#id": aws.String("id"), "#seq": aws.String(ledgerSortKey)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":stream": {S: aws.String(s.Key)}},
+		ConsistentRead:            aws.Bool(true),
+	}
+	err := db.QueryPages(input, func(out *dynamodb.QueryOutput, last bool) bool {
+		for _, item := range out.Items {
+			if v, ok := item[ledgerSortKey]; ok && v.N != nil {
+				if seq, err := strconv.Atoi(*v.N); err == nil {
+					found[seq] = true
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read back stream %s: %v", s.Key, err)
+	}
+	s.Found = len(found)
+	for seq := 1; seq <= s.Acknowledged; seq++ {
+		if !found[seq] {
+			s.Gaps++
+			if len(s.Missing) < ledgerMaxGaps {
+				s.Missing = append(s.Missing, seq)
+			}
+		}
+	}
+	s.Unexpected = s.Found - (s.Acknowledged - s.Gaps)
+	return nil
+}
+
+func printLedger(r LedgerResult) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Summary - ledger (%d streams)\n", len(r.Streams))
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", r.RunID)
+	fmt.Printf("Appends: %d, appended: %d, already written by an earlier attempt: %d, errors: %d\n",
+		r.Requests, r.Appended, r.Duplicates, r.Errors)
+	fmt.Printf("Events/sec: %.2f, average (ms): %.3f, p50 (ms): %.3f, p99 (ms): %.3f\n", r.EventsPerS, r.AverageMs, r.P50Ms, r.P99Ms)
+	fmt.Printf("%-50s %12s %10s %6s %10s\n", "stream", "acknowledged", "found", "gaps", "unexpected")
+	for _, s := range r.Streams {
+		fmt.Printf("%-50s %12d %10d %6d %10d\n", s.Key, s.Acknowledged, s.Found, s.Gaps, s.Unexpected)
+		if len(s.Missing) > 0 {
+			var missing []string
+			for _, seq := range s.Missing {
+				missing = append(missing, strconv.Itoa(seq))
+			}
+			more := ""
+			if s.Gaps > len(s.Missing) {
+				more = fmt.Sprintf(" and %d more", s.Gaps-len(s.Missing))
+			}
+			fmt.Printf("[WARN] %s is missing %s %s%s\n", s.Key, ledgerSortKey, strings.Join(missing, ", "), more)
+		}
+	}
+}
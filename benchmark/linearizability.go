@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// LinearizabilityResult is the outcome of checking the recorded history of
+// a run against a sequential counter.
+type LinearizabilityResult struct {
+	// Result is "ok", "illegal" or "unknown" (the checker timed out).
+	Result     string `json:"result"`
+	Operations int    `json:"operations"`
+	// Counterexample lists the operations around the shortest prefix of
+	// the history that is not linearizable, in invocation order.
+	Counterexample []string `json:"counterexample,omitempty"`
+}
+
+// counterInput is the input of an operation on the counter model.
+type counterInput struct {
+	f       string
+	process int
+}
+
+// counterModel is the sequential specification of the target item: "incr"
+// adds one to age and returns the new value, "read" returns it. An unknown
+// output (nil) is consistent with any state, which is how operations with an
+// indeterminate outcome are modelled.
+func counterModel(initial int64) porcupine.Model {
+	return porcupine.Model{
+		Init: func() interface{} {
+			return initial
+		},
+		Step: func(state interface{}, input interface{}, output interface{}) (bool, interface{}) {
+			st := state.(int64)
+			out := output.(*int64)
+			if input.(counterInput).f == "incr" {
+				return out == nil || *out == st+1, st + 1
+			}
+			return out == nil || *out == st, st
+		},
+		DescribeOperation: func(input interface{}, output interface{}) string {
+			return describeCounterOp(input.(counterInput), output.(*int64))
+		},
+	}
+}
+
+func describeCounterOp(in counterInput, out *int64) string {
+	value := "?"
+	if out != nil {
+		value = fmt.Sprint(*out)
+	}
+	return fmt.Sprintf("process %d %s -> %s", in.process, in.f, value)
+}
+
+// historyOperations pairs the first n events into operations. Failed
+// operations did not take effect and are dropped. Operations that are still
+// pending after n events or ended with "info" may have taken effect at any
+// time after their invocation, so they never return and have an unknown
+// output.
+func historyOperations(events []HistoryEvent, n int) []porcupine.Operation {
+	var ops []porcupine.Operation
+	pending := map[int]int{}
+	for _, e := range events[:n] {
+		if e.Type == "invoke" {
+			pending[e.Process] = len(ops)
+			ops = append(ops, porcupine.Operation{
+				ClientId: e.Process,
+				Input:    counterInput{f: e.F, process: e.Process},
+				Call:     e.Time,
+				Output:   (*int64)(nil),
+				Return:   math.MaxInt64,
+			})
+			continue
+		}
+		i, ok := pending[e.Process]
+		if !ok {
+			continue
+		}
+		delete(pending, e.Process)
+		switch e.Type {
+		case "ok":
+			ops[i].Output = e.Value
+			ops[i].Return = e.Time
+		case "fail":
+			ops[i].Input = nil
+		}
+	}
+	kept := ops[:0]
+	for _, op := range ops {
+		if op.Input != nil {
+			kept = append(kept, op)
+		}
+	}
+	return kept
+}
+
+// CheckLinearizability checks the history against the counter model
+// starting at initial. If it is not linearizable, the shortest failing
+// prefix is searched (linearizability is prefix-closed when pending
+// operations are kept open) and its last operations are reported.
+func CheckLinearizability(events []HistoryEvent, initial int64, timeout time.Duration) LinearizabilityResult {
+	model := counterModel(initial)
+	ops := historyOperations(events, len(events))
+	result := LinearizabilityResult{Operations: len(ops)}
+
+	switch porcupine.CheckOperationsTimeout(model, ops, timeout) {
+	case porcupine.Ok:
+		result.Result = "ok"
+		return result
+	case porcupine.Unknown:
+		result.Result = "unknown"
+		return result
+	}
+	result.Result = "illegal"
+
+	// The smallest n such that the first n events are not linearizable.
+	n := sort.Search(len(events), func(n int) bool {
+		return porcupine.CheckOperationsTimeout(model, historyOperations(events, n+1), timeout) == porcupine.Illegal
+	}) + 1
+	if n > len(events) {
+		return result
+	}
+	prefix := historyOperations(events, n)
+	sort.Slice(prefix, func(i, j int) bool { return prefix[i].Call < prefix[j].Call })
+
+	// The operation completed by the last event is the one that cannot be
+	// linearized; show it with everything concurrent to it and a few of the
+	// operations before that.
+	last := events[n-1]
+	var from int64 = math.MaxInt64
+	for _, op := range prefix {
+		if op.Input.(counterInput).process == last.Process && op.Call <= last.Time && op.Return >= last.Time {
+			from = op.Call
+		}
+	}
+	start := 0
+	for i, op := range prefix {
+		if op.Return >= from {
+			start = i
+			break
+		}
+	}
+	if start -= 5; start < 0 {
+		start = 0
+	}
+	for _, op := range prefix[start:] {
+		in := op.Input.(counterInput)
+		if in.f == "read" && op.Return == math.MaxInt64 {
+			// Pending reads cannot contribute to the violation.
+			continue
+		}
+		line := describeCounterOp(in, op.Output.(*int64))
+		if op.Return == math.MaxInt64 {
+			line += fmt.Sprintf(" [%.6fs, pending]", float64(op.Call)/1e9)
+		} else {
+			line += fmt.Sprintf(" [%.6fs, %.6fs]", float64(op.Call)/1e9, float64(op.Return)/1e9)
+		}
+		result.Counterexample = append(result.Counterexample, line)
+	}
+	return result
+}
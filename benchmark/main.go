@@ -4,259 +4,748 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"strconv"
-	"sync"
-	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"benchmark/internal/cli"
 )
 
-func usage() {
-	fmt.Println(usageText)
-	os.Exit(0)
-}
-
-var usageText = `auto_increment [options...]
-
-Options:
--a <action>          (Required) An action to execute
-                     Defaults to "read"; Must be either "read" or "write"
--table <table>       (Required) DynamoDB table name
--id <id>             (Required) id field value in the table
--condition <max-age> Conditinal check value of max age on updating "age" field in the table
-                     Defaults to 0 (No Conditional Check); Must be more than 0
--c connections       Number of parallel simultaneous DynamoDB session
-                     Defaults to 1; Must be more than 0
--n num-calls         Run for exactly this number of calls by each DynamoDB session
-                     Defaults to 1; Must be more than 0
--r retry-num         Number fo Retry in each message send
-                     Default to 1; Must be more than 0
--endpoint-url <url>  DynamoDB Endpoint URL to send the API request to.
-                     Defaults to "", which mean the AWS SDK automatically determines the URL
-                     For example, give "http://localhost:8000" if it's local dynamodb with exposed port 8000
--verbose             Verbose option
--h                   help message
-`
-
-type DynamoDBBenchmark struct {
-	Action      string
-	TableName   string
-	Id          string
-	Condition   int
-	EndpointUrl string
-	Connections int
-	NumCalls    int
-	RetryNum    int
-	Verbose     bool
-}
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "orchestrate" {
+		exit(orchestrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "cleanup" {
+		exit(cleanup(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "results" {
+		exit(results(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		exit(admin(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "preset" {
+		args, code := preset(os.Args[2:])
+		if args == nil {
+			exit(code)
+		}
+		os.Args = append([]string{os.Args[0]}, args...)
+	}
 
-type Item struct {
-	Id  string `json:"id"`
-	Age int64  `json:"age"`
-}
+	var (
+		action                 string
+		tableName              string
+		runID                  string
+		id                     string
+		condition              int
+		updateTemplate         string
+		updateValueSize        int
+		returnValues           string
+		projection             string
+		expressionNames        string
+		consumedCapacity       bool
+		itemCollectionMetrics  bool
+		partitionEstimate      bool
+		reset                  bool
+		seedAge                int
+		seedStock              int
+		reserveQty             int
+		assert                 string
+		slo                    string
+		endpointUrl            string
+		endpointScheme         string
+		fakeFaults             string
+		roleARNs               string
+		pools                  string
+		victimPool             string
+		roleExternalID         string
+		insecureSkipVerify     bool
+		caBundle               string
+		endpointDiscovery      bool
+		proxyURL               string
+		proxySplit             bool
+		fips                   bool
+		dualStack              bool
+		signingRegion          string
+		connStats              bool
+		latencyBreakdown       bool
+		connections            int
+		stagger                time.Duration
+		pipelineDepth          int
+		backpressureReport     string
+		rate                   float64
+		controlAddr            string
+		thinkTime              time.Duration
+		thinkTimeDist          string
+		txItems                int
+		mix                    string
+		sweepMaxKeys           int
+		sessions               int
+		readRatio              float64
+		keySkew                string
+		sessionSize            int
+		sessionTTL             time.Duration
+		partitions             int
+		timeSeriesBatch        int
+		timeSeriesQuery        string
+		timeSeriesQueryRatio   float64
+		timeSeriesPrefill      int
+		skQuery                string
+		skItems                int
+		pipelineTable          string
+		derivedKey             string
+		pipelinePoll           time.Duration
+		pipelineTimeout        time.Duration
+		limit                  int
+		collections            int
+		itemSize               int
+		lsi                    string
+		lsiReadRatio           float64
+		checkoutItems          int
+		checkoutProducts       int
+		productSkew            string
+		duplicateRatio         float64
+		leases                 int
+		leaseDuration          time.Duration
+		leaseHold              time.Duration
+		batchOp                string
+		batchSizes             string
+		batchKeys              int
+		objectSizes            string
+		chunkSize              int
+		storage                string
+		overflowBucket         string
+		unprocessedRetries     int
+		unprocessedBackoff     time.Duration
+		numCalls               int
+		totalCalls             int
+		duration               time.Duration
+		checkpointInterval     time.Duration
+		checkpointFile         string
+		streamResults          time.Duration
+		requestLog             string
+		contentionReport       string
+		contentionBucket       time.Duration
+		timeline               string
+		timelineBucket         time.Duration
+		backupAt               time.Duration
+		addIndex               string
+		addIndexAt             time.Duration
+		stepAt                 time.Duration
+		stepRate               float64
+		shiftHotkey            time.Duration
+		cacheTTL               time.Duration
+		cacheSize              int
+		optimisticLock         string
+		versionAttribute       string
+		payloadFile            string
+		compress               string
+		compressLevel          int
+		keys                   int
+		idFile                 string
+		historyFile            string
+		historyFormat          string
+		checkLinearizability   bool
+		linearizabilityTimeout time.Duration
+		skewReference          string
+		abortOnErrorRate       float64
+		errorRateWindow        time.Duration
+		errorRateMinSamples    int
+		errorRatePause         time.Duration
+		retryNum               int
+		dryRun                 bool
+		dryRunRequests         int
+		compatCheck            bool
+		check                  bool
+		calibrate              bool
+		calibrateStep          time.Duration
+		calibrationFile        string
+		concurrencySweep       string
+		concurrencyStep        time.Duration
+		burstIdle              string
+		burstStep              time.Duration
+		probeCeiling           float64
+		probeStart             float64
+		probeFactor            float64
+		probeStep              time.Duration
+		probeThrottleRatio     float64
+		iUnderstandCosts       bool
+		shards                 string
+		shardSuffix            string
+		shardStep              time.Duration
+		compare                string
+		comparePrices          string
+		comparePause           time.Duration
+		tableA                 string
+		tableB                 string
+		errorSamples           int
+		slaBuckets             string
+		timezone               string
+		verbose                bool
+		tui                    bool
+		configFile             string
+		k8sFriendly            bool
+		resultsDir             string
+		resultsHistory         string
+		repeatEvery            time.Duration
+		repeatCount            int
+		resultsS3URI           string
+		sinks                  string
+		healthAddr             string
+		cleanupRun             bool
+	)
 
-func retry(attempts int, sleep time.Duration, f func() error) (err error) {
-	for i := 0; ; i++ {
-		err = f()
-		if err == nil {
-			return
+	flag.StringVar(&action, "a", "read", "(Required) read or write")
+	flag.StringVar(&tableName, "table", "", "(Required) DynamoDB table name")
+	flag.StringVar(&runID, "run-id", "", "Identifier of the run added to the User-Agent and all outputs (generated if empty)")
+	flag.StringVar(&endpointUrl, "endpoint-url", "", "The URL to send the API request to")
+	flag.StringVar(&endpointScheme, "endpoint-scheme", "", "Force http or https for the endpoint")
+	flag.StringVar(&pools, "pools", "", "Connections per operation instead of -c, e.g. read=50,write=10,scan=2")
+	flag.StringVar(&victimPool, "victim-pool", "", "Named pool of -pools whose latency over time shows the impact of the other pools")
+	flag.StringVar(&roleARNs, "role-arns", "", "Comma separated IAM role ARNs (or chains arn1>arn2) to distribute the sessions over")
+	flag.StringVar(&roleExternalID, "role-external-id", "", "External ID passed when assuming the roles of -role-arns")
+	flag.StringVar(&fakeFaults, "fake-faults", "", "Faults to inject into the requests to the fake:// endpoint, e.g. latency=exp:5ms,throttle=0.05")
+	flag.BoolVar(&insecureSkipVerify, "insecure-skip-verify", false, "Skip TLS certificate verification")
+	flag.StringVar(&caBundle, "ca-bundle", "", "PEM file with additional CA certificates to trust")
+	flag.BoolVar(&endpointDiscovery, "endpoint-discovery", false, "Look up the DynamoDB endpoint with endpoint discovery")
+	flag.StringVar(&proxyURL, "proxy-url", "", "HTTP, HTTPS or SOCKS5 proxy to send the requests through instead of the one of HTTP(S)_PROXY")
+	flag.BoolVar(&proxySplit, "proxy-split", false, "Send only the odd sessions through the proxy and compare their latency with the direct ones")
+	flag.BoolVar(&fips, "fips", false, "Use the FIPS endpoint of the region")
+	flag.BoolVar(&dualStack, "dual-stack", false, "Use the dual-stack (IPv4 and IPv6) endpoint of the region")
+	flag.StringVar(&signingRegion, "signing-region", "", "Region to sign the requests for instead of the region of the endpoint")
+	flag.BoolVar(&connStats, "conn-stats", false, "Show connection statistics (new/reused connections, DNS, TLS, time to first byte) in the summary")
+	flag.BoolVar(&latencyBreakdown, "latency-breakdown", false, "Show the marshal, sign, network and unmarshal latency percentiles per operation in the summary")
+	flag.StringVar(&id, "id", "", "(Required) id field value in the table")
+	flag.IntVar(&condition, "condition", 0, "Conditinal check value of max age on updating age field")
+	flag.StringVar(&updateTemplate, "update", "incr", "Update expression template of the write action: incr, list-append, map-set or nested-remove")
+	flag.IntVar(&updateValueSize, "update-value-size", 32, "Size in bytes of the string values written by the document update templates")
+	flag.StringVar(&returnValues, "return-values", "", "ReturnValues of the write action (NONE, ALL_OLD, UPDATED_OLD, ALL_NEW or UPDATED_NEW)")
+	flag.StringVar(&projection, "projection", "", "ProjectionExpression of the read action")
+	flag.StringVar(&expressionNames, "expression-names", "", "Placeholders of -projection for attribute names: #placeholder=name,...")
+	flag.BoolVar(&consumedCapacity, "consumed-capacity", false, "Show the consumed capacity units per operation, base table and index")
+	flag.BoolVar(&itemCollectionMetrics, "item-collection-metrics", false, "Show the growth of the item collections written, for tables with LSIs")
+	flag.BoolVar(&partitionEstimate, "partition-estimate", false, "Estimate the partitions of the table from the observed throughput")
+	flag.BoolVar(&reset, "reset", false, "(Re)create the item with age -seed-age before the run")
+	flag.IntVar(&seedAge, "seed-age", 1, "Initial age of the item created by -reset")
+	flag.IntVar(&seedStock, "seed-stock", 1000, "Initial stock of the item created by -reset for -update reserve")
+	flag.IntVar(&reserveQty, "reserve-qty", 1, "Quantity each update of -update reserve reserves")
+	flag.StringVar(&slo, "slo", "", "Comma separated success criteria checked after the run, e.g. p99<20ms,error_rate<0.1%,throughput>=5000")
+	flag.StringVar(&assert, "assert", "", "Comma separated invariants on the item to check after the run, e.g. age==initial+successes")
+	flag.IntVar(&connections, "c", 1, "Number of parallel simultaneous DynamoDB session")
+	flag.DurationVar(&stagger, "stagger", 0, "Spread the start of the DynamoDB sessions evenly over this interval")
+	flag.IntVar(&pipelineDepth, "pipeline-depth", 1, "Number of calls each read or write session keeps in flight at a time")
+	flag.StringVar(&backpressureReport, "backpressure-report", "", "CSV file to write the calls in flight and the lag behind the -rate schedule to every second")
+	flag.Float64Var(&rate, "rate", 0, "Limit all DynamoDB sessions together to this many requests per second")
+	flag.StringVar(&controlAddr, "control-addr", "", "Address (e.g. localhost:8080) of the HTTP API to change the load during the run")
+	flag.DurationVar(&thinkTime, "think-time", 0, "Idle time between successive operations of each DynamoDB session")
+	flag.StringVar(&thinkTimeDist, "think-time-dist", "fixed", "Distribution of the think time: fixed or exp")
+	flag.IntVar(&txItems, "tx-items", 2, "Number of items updated by each transaction of the tx-sweep action")
+	flag.StringVar(&mix, "mix", "", "Weighted operations of the mix action, e.g. get:70,update:20,query:5,tx-write:5")
+	flag.IntVar(&sweepMaxKeys, "sweep-max-keys", 16, "Largest number of distinct keys of the tx-sweep action")
+	flag.IntVar(&sessions, "sessions", 10000, "Number of active sessions of the session action")
+	flag.Float64Var(&readRatio, "read-ratio", 0.95, "Share of the calls of the session action which are lookups")
+	flag.StringVar(&keySkew, "key-skew", "uniform", "How the session, timeseries, read and write actions pick keys: uniform or zipf:<s>")
+	flag.IntVar(&sessionSize, "session-size", 512, "Bytes of data in each item of the session action")
+	flag.IntVar(&partitions, "partitions", 100, "Number of partitions of the timeseries and sk-query actions")
+	flag.IntVar(&timeSeriesBatch, "ts-batch", 1, "Points written by each call of the timeseries action")
+	flag.StringVar(&timeSeriesQuery, "ts-query", "", "Query pattern of the timeseries action: latest:<n> or range:<duration>")
+	flag.Float64Var(&timeSeriesQueryRatio, "ts-query-ratio", 0.5, "Share of the calls of the timeseries action which are queries")
+	flag.IntVar(&timeSeriesPrefill, "ts-prefill", 0, "Points written to each partition of the timeseries action before the run")
+	flag.StringVar(&skQuery, "sk-query", "begins_with:10", "Sort key conditions of the sk-query action: begins_with:<n>, between:<n> and >=, comma separated")
+	flag.IntVar(&skItems, "sk-items", 1000, "Items of each partition of the sk-query action")
+	flag.StringVar(&pipelineTable, "pipeline-table", "", "Table the pipeline action waits for the items derived from its writes in")
+	flag.StringVar(&derivedKey, "derived-key", "id={id}", "Key of the derived item of each write of the pipeline action, e.g. pk=view#{id},sk=summary")
+	flag.DurationVar(&pipelinePoll, "pipeline-poll", 20*time.Millisecond, "Interval between the reads of the pipeline action waiting for a derived item")
+	flag.DurationVar(&pipelineTimeout, "pipeline-timeout", 30*time.Second, "Time the pipeline action waits for a derived item after its write")
+	flag.IntVar(&limit, "limit", 0, "Page size (Limit) of the Query and Scan calls; 0 for the default of each action")
+	flag.IntVar(&collections, "collections", 1, "Number of item collections of the item-collection action")
+	flag.IntVar(&itemSize, "item-size", 1024, "Bytes of data in each item of the item-collection action")
+	flag.StringVar(&lsi, "lsi", "", "Local secondary index <name>:<attribute>[:S|N] the item-collection action writes and queries")
+	flag.Float64Var(&lsiReadRatio, "lsi-read-ratio", 0.5, "Share of the calls of the item-collection action which query -lsi")
+	flag.DurationVar(&sessionTTL, "session-ttl", 30*time.Minute, "Time to live of the sessions written by the session action")
+	flag.IntVar(&checkoutItems, "checkout-items", 3, "Number of products in each order of the checkout action")
+	flag.IntVar(&checkoutProducts, "checkout-products", 100, "Number of distinct products of the checkout action")
+	flag.StringVar(&productSkew, "product-skew", "uniform", "How the checkout action picks products: uniform or zipf:<s>")
+	flag.Float64Var(&duplicateRatio, "duplicate-ratio", 0.1, "Share of the calls of the claim action which retry a key tried before")
+	flag.IntVar(&leases, "leases", 1, "Number of lease items of the lease action")
+	flag.DurationVar(&leaseDuration, "lease-duration", 10*time.Second, "How long a lease of the lease action lasts unless released")
+	flag.DurationVar(&leaseHold, "lease-hold", 100*time.Millisecond, "How long the lease action holds a lease before releasing it")
+	flag.StringVar(&batchOp, "batch-op", "write", "Operation of the batch-sweep action: write or read")
+	flag.StringVar(&batchSizes, "batch-sizes", "", "Comma separated batch sizes of the batch-sweep action")
+	flag.IntVar(&batchKeys, "batch-keys", 1000, "Number of distinct items of the batch-sweep action")
+	flag.StringVar(&objectSizes, "object-sizes", "100KB,1MB,4MB", "Comma separated object sizes of the chunk-sweep action, e.g. 100KB,1MB,4MB")
+	flag.IntVar(&chunkSize, "chunk-size", 350*1024, "Bytes of each chunk item of the chunk-sweep action")
+	flag.StringVar(&storage, "storage", "chunks", "Comma separated storages of the objects of the chunk-sweep action: chunks and/or s3")
+	flag.StringVar(&overflowBucket, "overflow-bucket", "", "S3 URI (s3://bucket/prefix) of the objects of the chunk-sweep action with -storage s3")
+	flag.IntVar(&unprocessedRetries, "unprocessed-retries", 5, "Resubmissions of the unprocessed items of a batch of the batch-sweep action")
+	flag.DurationVar(&unprocessedBackoff, "unprocessed-backoff", 50*time.Millisecond, "Base delay of the exponential backoff between resubmissions of unprocessed items")
+	flag.IntVar(&numCalls, "n", 1, "Run for exactly this number of calls by each DynamoDB session")
+	flag.IntVar(&totalCalls, "total-calls", 0, "Run for exactly this number of calls in total, divided over the sessions")
+	flag.DurationVar(&duration, "duration", 0, "Run each DynamoDB session for this duration instead of -n calls")
+	flag.DurationVar(&checkpointInterval, "checkpoint-interval", 5*time.Minute, "Interval of writing statistics to the checkpoint file")
+	flag.DurationVar(&streamResults, "stream-results", 0, "Write the statistics of every interval of this length to stdout as newline delimited JSON")
+	flag.StringVar(&checkpointFile, "checkpoint-file", "", "File to append interval statistics to as newline delimited JSON")
+	flag.StringVar(&requestLog, "request-log", "", "CSV file to additionally write every raw latency sample to")
+	flag.StringVar(&contentionReport, "contention-report", "", "CSV file to write the conflict/throttle rate and latency per time bucket to (write action)")
+	flag.DurationVar(&contentionBucket, "contention-bucket", time.Second, "Width of the time buckets of the contention report")
+	flag.StringVar(&timeline, "timeline", "", "CSV file to write the latency timeline with the events of the run to")
+	flag.DurationVar(&timelineBucket, "timeline-bucket", time.Second, "Width of the time buckets of the timeline")
+	flag.DurationVar(&backupAt, "backup-at", 0, "Create an on-demand backup of the table this long into the run and compare the latency around it")
+	flag.StringVar(&addIndex, "add-index", "", "Global secondary index to add with -add-index-at: <name>:<attribute>[:S|N|B]")
+	flag.DurationVar(&addIndexAt, "add-index-at", 0, "Add the -add-index index this long into the run and compare the latency around its backfill")
+	flag.DurationVar(&stepAt, "step-at", 0, "Raise the load from -rate to -step-rate this long into the run and measure how auto scaling reacts")
+	flag.Float64Var(&stepRate, "step-rate", 0, "Requests per second of the load step of -step-at")
+	flag.IntVar(&keys, "keys", 1, "Number of items the read and write actions spread over")
+	flag.StringVar(&idFile, "id-file", "", "File of the keys (one per line, optionally with a weight) the read and write actions spread over")
+	flag.DurationVar(&shiftHotkey, "shift-hotkey", 0, "Move the hot key every this long and report how quickly throttling stops")
+	flag.DurationVar(&cacheTTL, "cache-ttl", 0, "Serve the reads of the read action from an in-process read-through cache keeping items this long")
+	flag.IntVar(&cacheSize, "cache-size", 10000, "Items the -cache-ttl cache holds before it evicts the least recently used")
+	flag.StringVar(&optimisticLock, "optimistic-lock", "", "Make the updates conditional writes on -version-attribute, expecting the version of a GetItem before every write (read) or of a local cache updated by the writes (cache)")
+	flag.StringVar(&versionAttribute, "version-attribute", "version", "Numeric version attribute of -optimistic-lock")
+	flag.StringVar(&payloadFile, "payload-file", "", "Sample payload (e.g. a large JSON document) -update payload writes and the read action reads")
+	flag.StringVar(&compress, "compress", "none", "Compression of the -payload-file payload: none, gzip or zstd")
+	flag.IntVar(&compressLevel, "compress-level", 0, "Level of -compress; 0 for the default of the algorithm")
+	flag.StringVar(&historyFile, "record-history", "", "File to record the operation history (invoke/ok/fail/info) to for consistency checkers")
+	flag.StringVar(&historyFormat, "history-format", "json", "Format of the history file: json or edn")
+	flag.BoolVar(&checkLinearizability, "check-linearizability", false, "Check the operation history of the run for linearizability with Porcupine")
+	flag.DurationVar(&linearizabilityTimeout, "linearizability-timeout", time.Minute, "Give up the linearizability check after this long")
+	flag.StringVar(&skewReference, "skew-reference", "", "HTTP URL of a reference clock (coordinator or endpoint) to estimate clock skew against")
+	flag.Float64Var(&abortOnErrorRate, "abort-on-error-rate", 0, "Stop the run when the error rate (0-1) over the sliding window exceeds this value")
+	flag.DurationVar(&errorRateWindow, "error-rate-window", 30*time.Second, "Sliding window of the circuit breaker")
+	flag.IntVar(&errorRateMinSamples, "error-rate-min-samples", 20, "Minimum number of requests in the window before the circuit breaker can trip")
+	flag.DurationVar(&errorRatePause, "error-rate-pause", 0, "Pause for this long instead of aborting when the circuit breaker trips")
+	flag.IntVar(&retryNum, "r", 1, "Number fo Retry in each message send")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the generated requests without calling DynamoDB")
+	flag.IntVar(&dryRunRequests, "dry-run-requests", 10, "Number of generated requests to print in dry-run mode")
+	flag.BoolVar(&compatCheck, "compat-check", false, "Check which DynamoDB features the endpoint supports")
+	flag.BoolVar(&check, "check", false, "Pre-flight check of credentials, table, key schema and seed item")
+	flag.BoolVar(&calibrate, "calibrate", false, "Measure the maximum request rate this host can generate and save it to the calibration file")
+	flag.DurationVar(&calibrateStep, "calibrate-step", 5*time.Second, "Duration of each calibration level")
+	flag.StringVar(&calibrationFile, "calibration-file", "", "Calibration file (defaults to <user cache dir>/dynamodb-benchmark/calibration.json)")
+	flag.StringVar(&concurrencySweep, "concurrency-sweep", "", "Comma separated numbers of sessions (<from>..<to> doubles) to run the workload with and chart")
+	flag.DurationVar(&concurrencyStep, "concurrency-step", 30*time.Second, "Duration of each level of -concurrency-sweep")
+	flag.StringVar(&burstIdle, "burst-idle", "", "Comma separated idle durations before each step of load, to chart how long bursts are sustained before throttling")
+	flag.DurationVar(&burstStep, "burst-step", time.Minute, "Duration of each step of load of -burst-idle")
+	flag.Float64Var(&probeCeiling, "probe-ceiling", 0, "Probe the practical throughput limit, ramping the rate up to this safety ceiling (requests/sec) until throttled")
+	flag.Float64Var(&probeStart, "probe-start", 100, "Rate (requests/sec) of the first step of -probe-ceiling")
+	flag.Float64Var(&probeFactor, "probe-factor", 1.5, "Factor the rate of -probe-ceiling grows by every step")
+	flag.DurationVar(&probeStep, "probe-step", 30*time.Second, "Duration of each step of -probe-ceiling")
+	flag.Float64Var(&probeThrottleRatio, "probe-throttle-ratio", 0.01, "Share of throttled attempts of a step of -probe-ceiling at which it stops")
+	flag.BoolVar(&iUnderstandCosts, "i-understand-costs", false, "Confirm that -probe-ceiling may consume a lot of (billed) capacity")
+	flag.StringVar(&shards, "shards", "", "Number of shards (or a list to sweep) to spread the item of read and write over")
+	flag.StringVar(&shardSuffix, "shard-suffix", "random", "How writes pick a shard: random or calculated")
+	flag.DurationVar(&shardStep, "shard-step", 30*time.Second, "Duration of each level of a -shards list")
+	flag.StringVar(&compare, "compare", "", "Comma separated phases <table>[@on-demand|@provisioned:<rcu>/<wcu>] to run the workload against and compare")
+	flag.StringVar(&comparePrices, "compare-prices", "", "Prices of the -compare cost estimate, e.g. rru=0.125,wru=0.625,rcu-hour=0.00013,wcu-hour=0.00065")
+	flag.DurationVar(&comparePause, "compare-pause", 0, "Idle time between the phases of -compare")
+	flag.StringVar(&tableA, "table-a", "", "Table A of an A/B comparison with -table-b")
+	flag.StringVar(&tableB, "table-b", "", "Table B of an A/B comparison with -table-a")
+	flag.StringVar(&configFile, "config", "", "JSON file with option values, overridden by environment variables and flags")
+	flag.BoolVar(&tui, "tui", false, "Show a live dashboard in the terminal during the run")
+	flag.BoolVar(&k8sFriendly, "k8s-friendly", false, "Run as a Kubernetes Job: JSON logs, health endpoints and graceful stop on SIGTERM")
+	flag.StringVar(&resultsHistory, "results-history", "", "File to append the summary of every run to as one line of JSON")
+	flag.DurationVar(&repeatEvery, "repeat-every", 0, "Start the workload again every this long, e.g. 1h")
+	flag.IntVar(&repeatCount, "repeat-count", 0, "Number of runs of -repeat-every; 0 repeats until stopped")
+	flag.StringVar(&resultsDir, "results-dir", "", "Directory (e.g. a mounted volume) to write the summary to as <run-id>.json")
+	flag.StringVar(&sinks, "sinks", "console", "Where the summary goes, comma separated: console, json:<dir>, jsonl:<file>, csv:<file>, prometheus:<file|url>, cloudwatch:<namespace>, s3:<uri>")
+	flag.StringVar(&resultsS3URI, "results-s3-uri", "", "S3 URI (s3://bucket/prefix) to upload the summary and output files to under <run-id>/")
+	flag.BoolVar(&cleanupRun, "cleanup", false, "Delete the items, indexes and backups the run created at its end")
+	flag.StringVar(&healthAddr, "health-addr", "", "Address of the /healthz and /readyz endpoints (defaults to :8081 with -k8s-friendly)")
+	flag.IntVar(&errorSamples, "error-samples", 5, "Number of distinct error messages shown in the summary, 0 for none")
+	flag.StringVar(&slaBuckets, "sla-buckets", "5ms,10ms,25ms,50ms,100ms", "Latency thresholds the summary counts the requests under, e.g. 5ms,10ms,25ms; empty for none")
+	flag.StringVar(&timezone, "timezone", "UTC", "Time zone of the timestamps of the output: UTC, Local or an IANA name")
+	flag.BoolVar(&verbose, "verbose", false, "Verbose option")
+	flag.Usage = usage
+	flag.Parse()
+	sources, err := cli.ApplyEnvAndConfig(flag.CommandLine, configFile, false)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		fmt.Println("Run with -h to see the available options")
+		exit(exitUsage)
+	}
+	if runID == "" {
+		runID = newRunID()
+	}
+	if outputLocation, err = time.LoadLocation(timezone); err != nil {
+		fmt.Printf("[ERROR] %s: %s\n", sources.Of("timezone"), err.Error())
+		fmt.Println("Run with -h to see the available options")
+		exit(exitUsage)
+	}
+	if slaThresholds, err = parseSLABuckets(slaBuckets); err != nil {
+		fmt.Printf("[ERROR] %s: %s\n", sources.Of("sla-buckets"), err.Error())
+		fmt.Println("Run with -h to see the available options")
+		exit(exitUsage)
+	}
+	resultStream := os.Stdout
+	if streamResults > 0 {
+		// Keep stdout for the snapshots, so that it can be piped into jq.
+		os.Stdout = os.Stderr
+	}
+	if k8sFriendly {
+		l, err := NewJSONLogger(runID)
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			os.Exit(exitFailure)
 		}
-
-		if i >= (attempts - 1) {
-			break
+		logger = l
+		defer logger.Close()
+		if healthAddr == "" {
+			healthAddr = ":8081"
 		}
+	}
 
-		time.Sleep(sleep)
-		fmt.Printf("retrying after error:%s\n", err)
+	s := DynamoDBBenchmark{
+		stopped:                new(int32),
+		calls:                  new(uint64),
+		Action:                 action,
+		TableName:              tableName,
+		RunID:                  runID,
+		Id:                     id,
+		Condition:              condition,
+		UpdateTemplate:         updateTemplate,
+		UpdateValueSize:        updateValueSize,
+		ReturnValues:           returnValues,
+		Projection:             projection,
+		ExpressionNames:        expressionNames,
+		ConsumedCapacity:       consumedCapacity,
+		ItemCollectionMetrics:  itemCollectionMetrics,
+		PartitionEstimate:      partitionEstimate,
+		Reset:                  reset,
+		SeedAge:                seedAge,
+		SeedStock:              seedStock,
+		ReserveQty:             reserveQty,
+		Assert:                 assert,
+		SLO:                    slo,
+		EndpointUrl:            endpointUrl,
+		EndpointScheme:         endpointScheme,
+		FakeFaults:             fakeFaults,
+		RoleARNs:               roleARNs,
+		Pools:                  pools,
+		VictimPool:             victimPool,
+		RoleExternalID:         roleExternalID,
+		InsecureSkipVerify:     insecureSkipVerify,
+		CABundle:               caBundle,
+		EndpointDiscovery:      endpointDiscovery,
+		ProxyURL:               proxyURL,
+		ProxySplit:             proxySplit,
+		FIPS:                   fips,
+		DualStack:              dualStack,
+		SigningRegion:          signingRegion,
+		ConnStats:              connStats,
+		LatencyBreakdown:       latencyBreakdown,
+		Connections:            connections,
+		Stagger:                stagger,
+		PipelineDepth:          pipelineDepth,
+		BackpressureReport:     backpressureReport,
+		Rate:                   rate,
+		ControlAddr:            controlAddr,
+		ThinkTime:              thinkTime,
+		ThinkTimeDist:          thinkTimeDist,
+		TxItems:                txItems,
+		Mix:                    mix,
+		SweepMaxKeys:           sweepMaxKeys,
+		Sessions:               sessions,
+		ReadRatio:              readRatio,
+		KeySkew:                keySkew,
+		SessionSize:            sessionSize,
+		SessionTTL:             sessionTTL,
+		Partitions:             partitions,
+		TimeSeriesBatch:        timeSeriesBatch,
+		TimeSeriesQuery:        timeSeriesQuery,
+		TimeSeriesQueryRatio:   timeSeriesQueryRatio,
+		TimeSeriesPrefill:      timeSeriesPrefill,
+		SKQuery:                skQuery,
+		SKItems:                skItems,
+		PipelineTable:          pipelineTable,
+		DerivedKey:             derivedKey,
+		PipelinePoll:           pipelinePoll,
+		PipelineTimeout:        pipelineTimeout,
+		Limit:                  limit,
+		Collections:            collections,
+		ItemSize:               itemSize,
+		LSI:                    lsi,
+		LSIReadRatio:           lsiReadRatio,
+		CheckoutItems:          checkoutItems,
+		CheckoutProducts:       checkoutProducts,
+		ProductSkew:            productSkew,
+		DuplicateRatio:         duplicateRatio,
+		Leases:                 leases,
+		LeaseDuration:          leaseDuration,
+		LeaseHold:              leaseHold,
+		BatchOp:                batchOp,
+		BatchSizes:             batchSizes,
+		BatchKeys:              batchKeys,
+		ObjectSizes:            objectSizes,
+		ChunkSize:              chunkSize,
+		Storage:                storage,
+		OverflowBucket:         overflowBucket,
+		UnprocessedRetries:     unprocessedRetries,
+		UnprocessedBackoff:     unprocessedBackoff,
+		NumCalls:               numCalls,
+		TotalCalls:             totalCalls,
+		Duration:               duration,
+		CheckpointInterval:     checkpointInterval,
+		CheckpointFile:         checkpointFile,
+		StreamResults:          streamResults,
+		resultStream:           resultStream,
+		RequestLog:             requestLog,
+		ContentionReport:       contentionReport,
+		ContentionBucket:       contentionBucket,
+		Timeline:               timeline,
+		TimelineBucket:         timelineBucket,
+		BackupAt:               backupAt,
+		AddIndex:               addIndex,
+		AddIndexAt:             addIndexAt,
+		StepAt:                 stepAt,
+		StepRate:               stepRate,
+		ShiftHotkey:            shiftHotkey,
+		CacheTTL:               cacheTTL,
+		CacheSize:              cacheSize,
+		OptimisticLock:         optimisticLock,
+		VersionAttribute:       versionAttribute,
+		PayloadFile:            payloadFile,
+		Compress:               compress,
+		CompressLevel:          compressLevel,
+		Keys:                   keys,
+		IdFile:                 idFile,
+		HistoryFile:            historyFile,
+		HistoryFormat:          historyFormat,
+		CheckLinearizability:   checkLinearizability,
+		LinearizabilityTimeout: linearizabilityTimeout,
+		SkewReference:          skewReference,
+		AbortOnErrorRate:       abortOnErrorRate,
+		ErrorRateWindow:        errorRateWindow,
+		ErrorRateMinSamples:    errorRateMinSamples,
+		ErrorRatePause:         errorRatePause,
+		RetryNum:               retryNum,
+		DryRun:                 dryRun,
+		DryRunRequests:         dryRunRequests,
+		CompatCheck:            compatCheck,
+		Check:                  check,
+		Calibrate:              calibrate,
+		CalibrateStep:          calibrateStep,
+		CalibrationFile:        calibrationFile,
+		ConcurrencySweep:       concurrencySweep,
+		ConcurrencyStep:        concurrencyStep,
+		BurstIdle:              burstIdle,
+		BurstStep:              burstStep,
+		ProbeCeiling:           probeCeiling,
+		ProbeStart:             probeStart,
+		ProbeFactor:            probeFactor,
+		ProbeStep:              probeStep,
+		ProbeThrottleRatio:     probeThrottleRatio,
+		IUnderstandCosts:       iUnderstandCosts,
+		Shards:                 shards,
+		ShardSuffix:            shardSuffix,
+		ShardStep:              shardStep,
+		Compare:                compare,
+		ComparePrices:          comparePrices,
+		ComparePause:           comparePause,
+		TableA:                 tableA,
+		TableB:                 tableB,
+		ErrorSamples:           errorSamples,
+		SLABuckets:             slaBuckets,
+		Timezone:               timezone,
+		Verbose:                verbose,
+		TUI:                    tui,
+		K8sFriendly:            k8sFriendly,
+		ResultsDir:             resultsDir,
+		ResultsHistory:         resultsHistory,
+		RepeatEvery:            repeatEvery,
+		RepeatCount:            repeatCount,
+		ResultsS3URI:           resultsS3URI,
+		Sinks:                  sinks,
+		HealthAddr:             healthAddr,
+		Cleanup:                cleanupRun,
 	}
-	return fmt.Errorf("after %d attempts, last error: %s", attempts, err)
-}
 
-func getDynamoDBClient(endpointUrl string) *dynamodb.DynamoDB {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+	if p, err := parsePools(s.Pools); err == nil && len(p) > 0 {
+		s.Connections = poolConnections(p)
+	}
+	if err := s.Validate(); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		fmt.Println("Run with -h to see the available options")
+		exit(exitUsage)
+	}
 
-	if endpointUrl != "" {
-		return dynamodb.New(sess, &aws.Config{Endpoint: aws.String(endpointUrl)})
-	} else {
-		return dynamodb.New(sess)
+	if s.HealthAddr != "" {
+		health, err := NewHealthServer(s.HealthAddr)
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			exit(exitFailure)
+		}
+		s.health = health
+		defer health.Stop()
 	}
-}
 
-func (c *DynamoDBBenchmark) Run() {
-	successCount := uint32(0)
-	errorCount := uint32(0)
-	startTime := time.Now()
+	if s.FakeFaults != "" {
+		faults, _ := ParseFakeFaults(s.FakeFaults)
+		fakeDB.SetFaults(faults)
+	}
 
-	var wg sync.WaitGroup
-	for i := 1; i <= c.Connections; i++ {
-		wg.Add(1)
-		if c.Action == "read" {
-			go c.startReadWorker(i, &wg, &successCount, &errorCount)
-		} else {
-			go c.startWriteWorker(i, &wg, &successCount, &errorCount)
+	if s.IdFile != "" {
+		s.keyFile, _ = loadKeyFile(s.IdFile)
+		if s.Verbose {
+			fmt.Printf("[Verbose] Loaded %d keys from %s (weighted: %v)\n", len(s.keyFile.keys), s.IdFile, s.keyFile.Weighted())
 		}
 	}
-	wg.Wait()
 
-	duration := time.Since(startTime).Seconds()
-	duration_ms := time.Since(startTime).Milliseconds()
-	average_ms := duration_ms / (int64(successCount) + int64(errorCount))
+	s.resources = NewResourceTracker(s.RunID, s.clientOptions())
 
-	fmt.Println("-----------------------")
-	fmt.Printf("DynamoDB Benchmark Summary - %s\n", c.Action)
-	fmt.Println("-----------------------")
-	fmt.Printf("Sent messages: %v\n", successCount)
-	fmt.Printf("Errors: %v\n", errorCount)
-	fmt.Printf("Duration (sec): %v\n", duration)
-	fmt.Printf("Average (ms): %v\n", average_ms)
-}
+	if dryRun {
+		if err := s.RunDryRun(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
+	}
 
-func (c *DynamoDBBenchmark) startWriteWorker(id int, wg *sync.WaitGroup, successCount *uint32, errorCount *uint32) {
-	defer wg.Done()
+	if check {
+		results, err := s.RunCheck()
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		if !printCheckResults(results) {
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
+	}
 
-	db := getDynamoDBClient(c.EndpointUrl)
+	if compatCheck {
+		results, err := s.RunCompatCheck()
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		printCompatResults(s.EndpointUrl, results)
+		s.exit(exitOK)
+	}
 
-	param := &dynamodb.UpdateItemInput{
-		TableName: &c.TableName,
-		Key: map[string]*dynamodb.AttributeValue{
-			"id": {
-				S: aws.String(c.Id),
-			},
-		},
-		UpdateExpression: aws.String("set age = age + :age_increment_value"),
-		ReturnValues:     aws.String("ALL_NEW"),
-	}
-	if c.Condition > 0 {
-		param.ConditionExpression = aws.String("age < :age_max_value")
-		param.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
-			":age_increment_value": {
-				N: aws.String("1"),
-			},
-			":age_max_value": {
-				N: aws.String(strconv.Itoa(c.Condition)),
-			},
+	if calibrate {
+		if err := s.RunCalibrate(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
 		}
-	} else {
-		param.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
-			":age_increment_value": {
-				N: aws.String("1"),
-			},
+		s.exit(exitOK)
+	}
+
+	if s.ConcurrencySweep != "" {
+		if err := s.RunConcurrencySweep(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
 		}
+		s.exit(exitOK)
 	}
-	for i := 1; i <= c.NumCalls; i++ {
-		err := retry(c.RetryNum, 2*time.Second, func() (err error) {
-			dresp, derr := db.UpdateItem(param)
-			if c.Verbose {
-				item := Item{}
-				derr := dynamodbattribute.UnmarshalMap(dresp.Attributes, &item)
-				if derr != nil {
-					fmt.Printf("Got error unmarshalling: %s", derr)
-					return derr
-				}
-				fmt.Printf("[Verbose] DynamoDB UpdateImte Response: id %s age %d\n", item.Id, item.Age)
-			}
-			return derr
-		})
 
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			atomic.AddUint32(errorCount, 1)
-			continue
+	if s.BurstIdle != "" {
+		if err := s.RunBurstSweep(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
 		}
+		s.exit(exitOK)
+	}
 
-		atomic.AddUint32(successCount, 1)
+	if s.ProbeCeiling > 0 {
+		if err := s.RunProbeLimits(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
 	}
-}
 
-func (c *DynamoDBBenchmark) startReadWorker(id int, wg *sync.WaitGroup, successCount *uint32, errorCount *uint32) {
-	defer wg.Done()
+	if levels, _ := parseShardLevels(s.Shards); len(levels) > 1 {
+		if err := s.RunShardSweep(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
+	}
 
-	db := getDynamoDBClient(c.EndpointUrl)
+	if s.Compare != "" {
+		if err := s.RunCompare(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
+	}
 
-	param := &dynamodb.GetItemInput{
-		TableName: &c.TableName,
-		Key: map[string]*dynamodb.AttributeValue{
-			"id": {
-				S: aws.String(c.Id),
-			},
-		},
-	}
-	for i := 1; i <= c.NumCalls; i++ {
-		err := retry(c.RetryNum, 2*time.Second, func() (err error) {
-			dresp, derr := db.GetItem(param)
-			if c.Verbose {
-				item := Item{}
-				derr := dynamodbattribute.UnmarshalMap(dresp.Item, &item)
-				if derr != nil {
-					fmt.Printf("Got error unmarshalling: %s", derr)
-					return derr
-				}
-				fmt.Printf("[Verbose] DynamoDB GetImte Response: id %s age %d\n", item.Id, item.Age)
-			}
-			return derr
-		})
+	if s.TableA != "" {
+		if err := s.RunAB(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
+	}
 
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			atomic.AddUint32(errorCount, 1)
-			continue
+	if s.Action == "tx-sweep" {
+		if err := s.RunTxSweep(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
 		}
+		s.exit(exitOK)
+	}
 
-		atomic.AddUint32(successCount, 1)
+	if s.Action == "batch-sweep" {
+		if err := s.RunBatchSweep(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
 	}
-}
 
-func main() {
+	if s.Action == "chunk-sweep" {
+		if err := s.RunChunkSweep(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
+	}
 
-	var (
-		action      string
-		tableName   string
-		id          string
-		condition   int
-		endpointUrl string
-		connections int
-		numCalls    int
-		retryNum    int
-		verbose     bool
-	)
+	if s.Action == "checkout" {
+		if err := s.RunCheckout(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
+	}
 
-	flag.StringVar(&action, "a", "read", "(Required) read or write")
-	flag.StringVar(&tableName, "table", "", "(Required) DynamoDB table name")
-	flag.StringVar(&endpointUrl, "endpoint-url", "", "The URL to send the API request to")
-	flag.StringVar(&id, "id", "", "(Required) id field value in the table")
-	flag.IntVar(&condition, "condition", 0, "Conditinal check value of max age on updating age field")
-	flag.IntVar(&connections, "c", 1, "Number of parallel simultaneous DynamoDB session")
-	flag.IntVar(&numCalls, "n", 1, "Run for exactly this number of calls by each DynamoDB session")
-	flag.IntVar(&retryNum, "r", 1, "Number fo Retry in each message send")
-	flag.BoolVar(&verbose, "verbose", false, "Verbose option")
-	flag.Usage = usage
-	flag.Parse()
+	if s.Action == "ledger" {
+		if err := s.RunLedger(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
+	}
 
-	if action != "read" && action != "write" {
-		fmt.Println("[ERROR] Invalid Command Options (-a)! action value must either read or write")
+	if s.Action == "claim" {
+		if err := s.RunClaim(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
 	}
-	if tableName == "" || id == "" {
-		fmt.Println("[ERROR] Invalid Command Options! Minimum required options are \"-table\" and \"-id\"")
-		usage()
+
+	if s.Action == "lease" {
+		if err := s.RunLease(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
 	}
 
-	s := DynamoDBBenchmark{
-		Action:      action,
-		TableName:   tableName,
-		Id:          id,
-		Condition:   condition,
-		EndpointUrl: endpointUrl,
-		Connections: connections,
-		NumCalls:    numCalls,
-		RetryNum:    retryNum,
-		Verbose:     verbose,
+	if s.RepeatEvery > 0 {
+		if err := s.RunRepeatedly(); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			s.exit(exitFailure)
+		}
+		s.exit(exitOK)
 	}
 
-	s.Run()
+	if err := s.Run(); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		s.exit(exitFailure)
+	}
+	s.exit(exitOK)
 }
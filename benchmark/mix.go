@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// mixOperations maps the operations of -mix to the API calls they are
+// recorded as.
+var mixOperations = map[string]string{
+	"get":      "GetItem",
+	"put":      "PutItem",
+	"update":   "UpdateItem",
+	"query":    "Query",
+	"scan":     "Scan",
+	"tx-get":   "TransactGetItems",
+	"tx-write": "TransactWriteItems",
+}
+
+func mixOperationNames() []string {
+	var names []string
+	for name := range mixOperations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MixOperation is one entry of -mix.
+type MixOperation struct {
+	Name   string
+	Weight float64
+}
+
+// parseMix parses -mix: comma separated "<operation>:<weight>", e.g.
+// "get:70,update:20,query:5,tx-write:5". "=" is accepted in place of ":" so
+// that the mix can be an object in the config file. The weights are relative
+// and need not sum up to 100.
+func parseMix(spec string) ([]MixOperation, error) {
+	var mix []MixOperation
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		i := strings.IndexAny(entry, ":=")
+		if i < 0 {
+			return nil, fmt.Errorf("%q is not <operation>:<weight>", entry)
+		}
+		name := strings.TrimSpace(entry[:i])
+		if _, ok := mixOperations[name]; !ok {
+			return nil, fmt.Errorf("unknown operation %q; must be one of %s", name, strings.Join(mixOperationNames(), ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("operation %q is given twice", name)
+		}
+		seen[name] = true
+		w, err := strconv.ParseFloat(strings.TrimSpace(entry[i+1:]), 64)
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("operation %q needs a weight more than 0, got %q", name, entry[i+1:])
+		}
+		mix = append(mix, MixOperation{Name: name, Weight: w})
+	}
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("no operations")
+	}
+	return mix, nil
+}
+
+// mixUses tells whether the mix has one of the operations.
+func mixUses(mix []MixOperation, names ...string) bool {
+	for _, op := range mix {
+		for _, name := range names {
+			if op.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MixShare compares the share of the calls of one -mix operation with its
+// weight.
+type MixShare struct {
+	Operation   string  `json:"operation"`
+	Requests    uint64  `json:"requests"`
+	TargetShare float64 `json:"target_share"`
+	Share       float64 `json:"share"`
+}
+
+func (s MixShare) String() string {
+	return fmt.Sprintf("[mix %s] requests: %d, share: %.2f%% (target %.2f%%)",
+		s.Operation, s.Requests, s.Share*100, s.TargetShare*100)
+}
+
+// mixShares returns the shares of the operations of -mix in sum, in the
+// order of -mix.
+func (c *DynamoDBBenchmark) mixShares(sum Summary) []MixShare {
+	if c.Action != "mix" {
+		return nil
+	}
+	mix, _ := parseMix(c.Mix)
+	requests := map[string]uint64{}
+	for _, op := range sum.Operations {
+		requests[op.Operation] = op.Success + op.Errors
+	}
+	var weights float64
+	for _, op := range mix {
+		weights += op.Weight
+	}
+	var shares []MixShare
+	for _, op := range mix {
+		s := MixShare{
+			Operation:   op.Name,
+			Requests:    requests[mixOperations[op.Name]],
+			TargetShare: op.Weight / weights,
+		}
+		if total := sum.Success + sum.Errors; total > 0 {
+			s.Share = float64(s.Requests) / float64(total)
+		}
+		shares = append(shares, s)
+	}
+	return shares
+}
+
+// mixKeys returns n distinct keys for the transactions of -mix: drawn from
+// next with -keys or -id-file (fewer if it keeps returning the same ones),
+// otherwise "<id>-1" ... "<id>-<n>".
+func mixKeys(c *DynamoDBBenchmark, n int, next func() map[string]*dynamodb.AttributeValue) []map[string]*dynamodb.AttributeValue {
+	var keys []map[string]*dynamodb.AttributeValue
+	if next == nil {
+		for k := 1; k <= n; k++ {
+			keys = append(keys, idKey(c.sweepKey(k)))
+		}
+		return keys
+	}
+	seen := map[string]bool{}
+	for tries := 0; len(keys) < n && tries < 10*n; tries++ {
+		key := next()
+		if id := aws.StringValue(key["id"].S); !seen[id] {
+			seen[id] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// startMixWorker draws each call from the operations of -mix by their
+// weights. Every operation takes its own options: get and query -projection,
+// update -condition and -update-template, put the attributes of -reset, the
+// transactions -tx-items; all but scan go to the item picked by -keys or
+// -id-file, or -id.
+func (c *DynamoDBBenchmark) startMixWorker(id int, wg *sync.WaitGroup, stats *WorkerStats) {
+	c.runWorker(id, wg, stats, c.newMixOperation)
+}
+
+// mixOperation sends the calls of a mix session.
+type mixOperation struct {
+	c          *DynamoDBBenchmark
+	id         int
+	db         *dynamodb.DynamoDB
+	stats      *WorkerStats
+	mix        []MixOperation
+	cumulative []float64
+	rnd        *rand.Rand
+	next       func() map[string]*dynamodb.AttributeValue
+	// scan continues where the previous scan of the session stopped.
+	scan *dynamodb.ScanInput
+}
+
+func (c *DynamoDBBenchmark) newMixOperation(id int, db *dynamodb.DynamoDB, stats *WorkerStats) Operation {
+	mix, _ := parseMix(c.Mix)
+	cumulative := make([]float64, len(mix))
+	var total float64
+	for i, op := range mix {
+		total += op.Weight
+		cumulative[i] = total
+	}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	return &mixOperation{
+		c:          c,
+		id:         id,
+		db:         db,
+		stats:      stats,
+		mix:        mix,
+		cumulative: cumulative,
+		rnd:        rnd,
+		next:       c.keyPicker(rnd),
+		scan:       &dynamodb.ScanInput{TableName: aws.String(c.TableName), Limit: aws.Int64(c.scanLimit())},
+	}
+}
+
+func (o *mixOperation) Build(i int) *Call {
+	c := o.c
+	x := o.rnd.Float64() * o.cumulative[len(o.cumulative)-1]
+	n := sort.Search(len(o.cumulative), func(i int) bool { return o.cumulative[i] > x })
+	if n == len(o.mix) {
+		n--
+	}
+	key := idKey(c.Id)
+	if o.next != nil {
+		key = o.next()
+	}
+	call := &Call{Op: mixOperations[o.mix[n].Name], Items: 1}
+	switch o.mix[n].Name {
+	case "get":
+		param := c.getItemInput()
+		param.Key = key
+		call.Request = param
+	case "put":
+		param := c.seedItemInput()
+		for name, v := range key {
+			param.Item[name] = v
+		}
+		if c.ConsumedCapacity {
+			param.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityIndexes)
+		}
+		call.Request = param
+	case "update":
+		param := c.updateItemInput()
+		if c.UpdateTemplate != "incr" {
+			param = c.writeInput(o.id, i)
+		}
+		param.Key = key
+		call.Request = param
+	case "query":
+		get := c.getItemInput()
+		call.Request = &dynamodb.QueryInput{
+			TableName:                 aws.String(c.TableName),
+			KeyConditionExpression:    aws.String("id = :id"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":id": key["id"]},
+			ProjectionExpression:      get.ProjectionExpression,
+			ExpressionAttributeNames:  get.ExpressionAttributeNames,
+			ReturnConsumedCapacity:    get.ReturnConsumedCapacity,
+		}
+		if c.Limit > 0 {
+			call.Request.(*dynamodb.QueryInput).Limit = aws.Int64(int64(c.Limit))
+		}
+	case "scan":
+		if c.ConsumedCapacity {
+			o.scan.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityIndexes)
+		}
+		call.Request = o.scan
+	case "tx-get":
+		param := &dynamodb.TransactGetItemsInput{}
+		for _, k := range mixKeys(c, c.TxItems, o.next) {
+			param.TransactItems = append(param.TransactItems, &dynamodb.TransactGetItem{
+				Get: &dynamodb.Get{TableName: aws.String(c.TableName), Key: k},
+			})
+		}
+		call.Items = len(param.TransactItems)
+		call.Request = param
+	case "tx-write":
+		param := &dynamodb.TransactWriteItemsInput{}
+		for _, k := range mixKeys(c, c.TxItems, o.next) {
+			param.TransactItems = append(param.TransactItems, &dynamodb.TransactWriteItem{
+				Update: &dynamodb.Update{
+					TableName:        aws.String(c.TableName),
+					Key:              k,
+					UpdateExpression: aws.String("set age = if_not_exists(age, :zero) + :age_increment_value"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":zero":                {N: aws.String("0")},
+						":age_increment_value": {N: aws.String("1")},
+					},
+				},
+			})
+		}
+		call.Items = len(param.TransactItems)
+		call.Request = param
+	}
+	return call
+}
+
+func (o *mixOperation) Execute(call *Call) (err error) {
+	ctx := call.Context()
+	switch param := call.Request.(type) {
+	case *dynamodb.GetItemInput:
+		var out *dynamodb.GetItemOutput
+		if out, err = o.db.GetItemWithContext(ctx, param); err == nil {
+			o.stats.RecordCapacity(call.Op, out.ConsumedCapacity)
+		}
+	case *dynamodb.PutItemInput:
+		var out *dynamodb.PutItemOutput
+		if out, err = o.db.PutItemWithContext(ctx, param); err == nil {
+			o.stats.RecordCapacity(call.Op, out.ConsumedCapacity)
+		}
+	case *dynamodb.UpdateItemInput:
+		var out *dynamodb.UpdateItemOutput
+		if out, err = o.c.lock.UpdateItem(ctx, o.db, param); err == nil {
+			o.stats.RecordCapacity(call.Op, out.ConsumedCapacity)
+		}
+	case *dynamodb.QueryInput:
+		var out *dynamodb.QueryOutput
+		if out, err = o.db.QueryWithContext(ctx, param); err == nil {
+			call.Items = len(out.Items)
+			o.stats.RecordCapacity(call.Op, out.ConsumedCapacity)
+		}
+	case *dynamodb.ScanInput:
+		var out *dynamodb.ScanOutput
+		if out, err = o.db.ScanWithContext(ctx, param); err == nil {
+			call.Items = len(out.Items)
+			param.ExclusiveStartKey = out.LastEvaluatedKey
+			o.stats.RecordCapacity(call.Op, out.ConsumedCapacity)
+		}
+	case *dynamodb.TransactGetItemsInput:
+		_, err = o.db.TransactGetItemsWithContext(ctx, param)
+	case *dynamodb.TransactWriteItemsInput:
+		_, err = o.db.TransactWriteItemsWithContext(ctx, param)
+	}
+	return err
+}
+
+func (o *mixOperation) Observe(call *Call, err error) {}
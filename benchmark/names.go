@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// plainName matches the attribute names of an expression which are not
+	// placeholders, i.e. not preceded by '#' or ':' and not list indexes.
+	plainName       = regexp.MustCompile(`(^|[^#:A-Za-z0-9_])([A-Za-z_][A-Za-z0-9_]*)`)
+	namePlaceholder = regexp.MustCompile(`#[A-Za-z0-9_]+`)
+)
+
+// parseExpressionNames parses -expression-names "#placeholder=name,...".
+// Names may contain any character but "," and "=", e.g. dots or dashes,
+// which an expression cannot spell out.
+func parseExpressionNames(spec string) (map[string]string, error) {
+	names := map[string]string{}
+	if spec == "" {
+		return names, nil
+	}
+	for _, kv := range strings.Split(spec, ",") {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("want #placeholder=name, got %q", kv)
+		}
+		placeholder, name := strings.TrimSpace(kv[:i]), strings.TrimSpace(kv[i+1:])
+		if !namePlaceholder.MatchString(placeholder) || namePlaceholder.FindString(placeholder) != placeholder {
+			return nil, fmt.Errorf("placeholder %q must be # followed by letters, digits or _", placeholder)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("placeholder %s has no attribute name", placeholder)
+		}
+		if _, ok := names[placeholder]; ok {
+			return nil, fmt.Errorf("placeholder %s is given more than once", placeholder)
+		}
+		names[placeholder] = name
+	}
+	return names, nil
+}
+
+// aliasExpression rewrites every plain attribute name of the projection or
+// path expression expr to a placeholder "#<name>", so that reserved words
+// such as status, name or size can be used as they are, and returns the
+// ExpressionAttributeNames the expression uses: those of the rewritten names
+// and the placeholders of defined (from -expression-names) that expr
+// contains. It fails on placeholders that are not defined.
+func aliasExpression(expr string, defined map[string]string) (string, map[string]string, error) {
+	used := map[string]string{}
+	for _, p := range namePlaceholder.FindAllString(expr, -1) {
+		name, ok := defined[p]
+		if !ok {
+			return "", nil, fmt.Errorf("placeholder %s of %q is not defined by -expression-names", p, expr)
+		}
+		used[p] = name
+	}
+	aliased := plainName.ReplaceAllStringFunc(expr, func(m string) string {
+		sub := plainName.FindStringSubmatch(m)
+		prefix, name := sub[1], sub[2]
+		placeholder := "#" + name
+		for taken(used, placeholder, name) || taken(defined, placeholder, name) {
+			placeholder += "_"
+		}
+		used[placeholder] = name
+		return prefix + placeholder
+	})
+	return aliased, used, nil
+}
+
+// taken tells whether placeholder stands for another name than name.
+func taken(names map[string]string, placeholder string, name string) bool {
+	other, ok := names[placeholder]
+	return ok && other != name
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Call is one call of an Operation on its way through runWorker.
+type Call struct {
+	// Op is the API call it is recorded as, e.g. "GetItem".
+	Op string
+	// Request is whatever Execute sends, e.g. a *dynamodb.GetItemInput.
+	Request interface{}
+	// Items is the number of items the call reads or writes; Execute may
+	// set it from the response.
+	Items int
+
+	// attempts counts the attempts of the call, which Execute sends with
+	// Context.
+	attempts *AttemptCounter
+}
+
+// Context is the context Execute sends the requests of the call with, so
+// that runCall knows their attempts even with other calls in flight.
+func (call *Call) Context() aws.Context {
+	if call.attempts == nil {
+		return aws.BackgroundContext()
+	}
+	return withAttempts(aws.BackgroundContext(), call.attempts)
+}
+
+// Operation is what the sessions of an action send. runWorker takes care of
+// the rest: the stagger, the client, the pacing of -rate and -think-time,
+// the retries of -r, the metrics, the errors and -pipeline-depth. A new
+// operation only builds, sends and looks at its calls.
+type Operation interface {
+	// Build returns the i-th call of the session.
+	Build(i int) *Call
+	// Execute sends the call once, with call.Context(); runWorker retries
+	// it on errors.
+	Execute(call *Call) error
+	// Observe sees the outcome of the call after its retries, before it
+	// is recorded.
+	Observe(call *Call, err error)
+}
+
+// newOperation returns the Operation of session id, sending its calls through
+// db and recording their capacity and payloads in stats.
+type newOperation func(id int, db *dynamodb.DynamoDB, stats *WorkerStats) Operation
+
+// runWorker runs session id of an action: the calls of the Operation of
+// newOp, one after the other or -pipeline-depth at a time.
+func (c *DynamoDBBenchmark) runWorker(id int, wg *sync.WaitGroup, stats *WorkerStats, newOp newOperation) {
+	defer wg.Done()
+	defer stats.Finish()
+
+	time.Sleep(c.staggerDelay(id) + c.poolStart)
+
+	opts := c.sessionClientOptions(id)
+	opts.ConnStats = c.conns.Worker(id)
+	opts.Breakdown = c.breakdown.Worker()
+	opts.Attempts = stats.Attempts()
+	db, err := getDynamoDBClient(opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	op := newOp(id, db, stats)
+	// With -pipeline-depth, up to that many calls are in flight at a time,
+	// each in a goroutine of its own; the next call is sent as soon as one
+	// of them returns.
+	inflight := make(chan struct{}, c.pipelineDepth())
+	var calls sync.WaitGroup
+	for i := 1; c.moreCalls(id, i); i++ {
+		call := op.Build(i)
+		if cap(inflight) == 1 {
+			c.runCall(op, call, stats)
+			continue
+		}
+		c.backpressure.Blocked(1)
+		inflight <- struct{}{}
+		c.backpressure.Blocked(-1)
+		c.backpressure.InFlight(1)
+		calls.Add(1)
+		go func() {
+			defer calls.Done()
+			c.runCall(op, call, stats)
+			c.backpressure.InFlight(-1)
+			<-inflight
+		}()
+	}
+	calls.Wait()
+}
+
+// runCall sends call with its retries and records the outcome.
+func (c *DynamoDBBenchmark) runCall(op Operation, call *Call, stats *WorkerStats) {
+	call.attempts = &AttemptCounter{}
+	start := c.clock.Now()
+	err := retry(c.RetryNum, 2*time.Second, func() error {
+		return op.Execute(call)
+	})
+	op.Observe(call, err)
+	stats.RecordCall(call.Op, start, time.Since(start), call.Items, err, call.attempts)
+
+	if err != nil && !c.TUI {
+		fmt.Printf("Error: %v\n", err)
+	}
+}
+
+// pipelineDepth is the number of calls a session keeps in flight.
+func (c *DynamoDBBenchmark) pipelineDepth() int {
+	if c.PipelineDepth < 1 {
+		return 1
+	}
+	return c.PipelineDepth
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// optimisticLockModes are the values of -optimistic-lock: where the expected
+// version of the conditional write comes from.
+//
+//	read   a consistent GetItem of the version before every write
+//	cache  the version the last successful write of the process left in a
+//	       local cache; the item is read only on a miss or a conflict
+var optimisticLockModes = []string{"read", "cache"}
+
+// optimisticLockAttempts is how many times a write is tried with a fresh
+// version before its conflict is returned.
+const optimisticLockAttempts = 10
+
+// OptimisticLockSummary is the outcome of -optimistic-lock: how often the
+// expected version was stale and what reading it cost.
+type OptimisticLockSummary struct {
+	Mode      string `json:"mode"`
+	Attribute string `json:"attribute"`
+	Writes    uint64 `json:"writes"`
+	Attempts  uint64 `json:"attempts"`
+	// Conflicts are the attempts rejected because the item had another
+	// version, ConflictRate their share of Attempts and GaveUp the writes
+	// still in conflict after optimisticLockAttempts attempts.
+	Conflicts    uint64  `json:"conflicts"`
+	ConflictRate float64 `json:"conflict_rate"`
+	GaveUp       uint64  `json:"gave_up"`
+	// VersionReads are the consistent GetItem calls of the version, before
+	// the writes of -optimistic-lock read, on a miss of the cache and after
+	// every conflict.
+	VersionReads  uint64  `json:"version_reads"`
+	ReadsPerWrite float64 `json:"reads_per_write"`
+	ReadUnits     float64 `json:"read_units"`
+	ReadAverageMs float64 `json:"read_average_ms"`
+}
+
+func (s *OptimisticLockSummary) String() string {
+	return fmt.Sprintf("%s version %q: writes %d in %d attempts, conflicts %d (%.2f%%), gave up %d; version reads %d (%.2f per write, %.1f read units, average %.3f ms)",
+		s.Mode, s.Attribute, s.Writes, s.Attempts, s.Conflicts, 100*s.ConflictRate, s.GaveUp,
+		s.VersionReads, s.ReadsPerWrite, s.ReadUnits, s.ReadAverageMs)
+}
+
+// OptimisticLock makes every UpdateItem of the write action and of the
+// updates of mix a conditional write on the version attribute, which it
+// increments, as optimistic locking does. The versions cached by
+// -optimistic-lock cache are shared by all sessions like the cache of one
+// application instance. A nil *OptimisticLock writes unconditionally.
+type OptimisticLock struct {
+	mode      string
+	attribute string
+
+	mu        sync.Mutex
+	versions  map[string]int64
+	writes    uint64
+	attempts  uint64
+	conflicts uint64
+	gaveUp    uint64
+	reads     uint64
+	readUnits float64
+	readTime  time.Duration
+}
+
+func NewOptimisticLock(mode string, attribute string) *OptimisticLock {
+	return &OptimisticLock{mode: mode, attribute: attribute, versions: map[string]int64{}}
+}
+
+// cached returns the version of the item of key the cache holds.
+func (l *OptimisticLock) cached(key string) (int64, bool) {
+	if l.mode != "cache" {
+		return 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	version, ok := l.versions[key]
+	return version, ok
+}
+
+func (l *OptimisticLock) store(key string, version int64) {
+	if l.mode != "cache" {
+		return
+	}
+	l.mu.Lock()
+	l.versions[key] = version
+	l.mu.Unlock()
+}
+
+// read returns the current version of the item of key, 0 if it has none.
+func (l *OptimisticLock) read(ctx aws.Context, db *dynamodb.DynamoDB, table *string, key map[string]*dynamodb.AttributeValue) (int64, error) {
+	start := time.Now()
+	out, err := db.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:                table,
+		Key:                      key,
+		ConsistentRead:           aws.Bool(true),
+		ProjectionExpression:     aws.String("#lock_version"),
+		ExpressionAttributeNames: map[string]*string{"#lock_version": aws.String(l.attribute)},
+		ReturnConsumedCapacity:   aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	})
+	elapsed := time.Since(start)
+	l.mu.Lock()
+	l.reads++
+	l.readTime += elapsed
+	if err == nil && out.ConsumedCapacity != nil {
+		l.readUnits += aws.Float64Value(out.ConsumedCapacity.CapacityUnits)
+	}
+	l.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	v, ok := out.Item[l.attribute]
+	if !ok || v.N == nil {
+		return 0, nil
+	}
+	return strconv.ParseInt(aws.StringValue(v.N), 10, 64)
+}
+
+// input returns a copy of param which sets the version to version+1 on the
+// condition that it is version, on top of the condition of param.
+func (l *OptimisticLock) input(param *dynamodb.UpdateItemInput, version int64) *dynamodb.UpdateItemInput {
+	in := *param
+	in.ExpressionAttributeNames = map[string]*string{"#lock_version": aws.String(l.attribute)}
+	for k, v := range param.ExpressionAttributeNames {
+		in.ExpressionAttributeNames[k] = v
+	}
+	in.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":lock_next": {N: aws.String(strconv.FormatInt(version+1, 10))}}
+	for k, v := range param.ExpressionAttributeValues {
+		in.ExpressionAttributeValues[k] = v
+	}
+	// Every update expression of the benchmark starts with its SET clause.
+	in.UpdateExpression = aws.String("set #lock_version = :lock_next, " + strings.TrimPrefix(aws.StringValue(param.UpdateExpression), "set "))
+	condition := "attribute_not_exists(#lock_version)"
+	if version > 0 {
+		condition = "#lock_version = :lock_expected"
+		in.ExpressionAttributeValues[":lock_expected"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(version, 10))}
+	}
+	if param.ConditionExpression != nil {
+		condition = "(" + aws.StringValue(param.ConditionExpression) + ") AND " + condition
+	}
+	in.ConditionExpression = aws.String(condition)
+	return &in
+}
+
+// UpdateItem sends param as a conditional write on the expected version,
+// reading the item again and retrying after a conflict. A conditional check
+// failure with the expected version still current is one of the condition of
+// param, e.g. -condition, and is returned as is.
+func (l *OptimisticLock) UpdateItem(ctx aws.Context, db *dynamodb.DynamoDB, param *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	if l == nil {
+		return db.UpdateItemWithContext(ctx, param)
+	}
+	key := cacheKey(param.Key)
+	version, known := l.cached(key)
+	for attempt := 1; ; attempt++ {
+		if !known {
+			var err error
+			if version, err = l.read(ctx, db, param.TableName, param.Key); err != nil {
+				// Like the SDK, never a nil output, which the callers read.
+				return &dynamodb.UpdateItemOutput{}, err
+			}
+		}
+		out, err := db.UpdateItemWithContext(ctx, l.input(param, version))
+		l.mu.Lock()
+		l.attempts++
+		if err == nil {
+			l.writes++
+		}
+		l.mu.Unlock()
+		if err == nil {
+			l.store(key, version+1)
+			return out, nil
+		}
+		if !isConditionalCheckFailed(err) {
+			return out, err
+		}
+		current, rerr := l.read(ctx, db, param.TableName, param.Key)
+		if rerr != nil {
+			return out, err
+		}
+		if current == version {
+			return out, err
+		}
+		l.store(key, current)
+		l.mu.Lock()
+		l.conflicts++
+		if attempt == optimisticLockAttempts {
+			l.gaveUp++
+		}
+		l.mu.Unlock()
+		if attempt == optimisticLockAttempts {
+			return out, err
+		}
+		version, known = current, true
+	}
+}
+
+func (l *OptimisticLock) Summary() *OptimisticLockSummary {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := &OptimisticLockSummary{
+		Mode:          l.mode,
+		Attribute:     l.attribute,
+		Writes:        l.writes,
+		Attempts:      l.attempts,
+		Conflicts:     l.conflicts,
+		ConflictRate:  ratio(l.conflicts, l.attempts),
+		GaveUp:        l.gaveUp,
+		VersionReads:  l.reads,
+		ReadsPerWrite: ratio(l.reads, l.writes),
+		ReadUnits:     l.readUnits,
+	}
+	if l.reads > 0 {
+		s.ReadAverageMs = float64(l.readTime) / float64(l.reads) / float64(time.Millisecond)
+	}
+	return s
+}
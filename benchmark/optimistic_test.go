@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// fakeClient returns a client of the fake endpoint which does not retry, so
+// the injected faults reach the caller at once.
+func fakeClient(t *testing.T) *dynamodb.DynamoDB {
+	t.Helper()
+	db, err := getDynamoDBClient(ClientOptions{EndpointUrl: fakeEndpoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Retryer = client.DefaultRetryer{NumMaxRetries: 0}
+	return db
+}
+
+func setFakeFaults(t *testing.T, spec string) {
+	t.Helper()
+	faults, err := ParseFakeFaults(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeDB.SetFaults(faults)
+	t.Cleanup(func() { fakeDB.SetFaults(nil) })
+}
+
+// A failed read of the version must not crash the write session, which reads
+// the output of every call.
+func TestOptimisticLockVersionReadFails(t *testing.T) {
+	for _, mode := range optimisticLockModes {
+		t.Run(mode, func(t *testing.T) {
+			c := &DynamoDBBenchmark{TableName: "optimistic-" + mode, Id: "lock", Action: "write", UpdateTemplate: "incr", RetryNum: 1}
+			c.clock = NewClock()
+			c.lock = NewOptimisticLock(mode, "version")
+			db := fakeClient(t)
+			setFakeFaults(t, "throttle=1,ops=GetItem")
+
+			stats := NewStats()
+			op := c.newWriteOperation(1, db, stats.Worker(1))
+			if err := op.Execute(op.Build(1)); err == nil {
+				t.Fatal("the write succeeded without the version")
+			}
+			if s := c.lock.Summary(); s.Writes != 0 || s.VersionReads != 1 {
+				t.Errorf("writes %d, version reads %d; want 0 and 1", s.Writes, s.VersionReads)
+			}
+		})
+	}
+}
+
+func TestOptimisticLockWrites(t *testing.T) {
+	for _, mode := range optimisticLockModes {
+		t.Run(mode, func(t *testing.T) {
+			c := &DynamoDBBenchmark{TableName: "optimistic-writes-" + mode, Id: "lock", Action: "write", UpdateTemplate: "incr", RetryNum: 1}
+			c.clock = NewClock()
+			c.lock = NewOptimisticLock(mode, "version")
+			db := fakeClient(t)
+			if _, err := db.PutItem(c.seedItemInput()); err != nil {
+				t.Fatal(err)
+			}
+
+			stats := NewStats()
+			op := c.newWriteOperation(1, db, stats.Worker(1))
+			for i := 1; i <= 3; i++ {
+				if err := op.Execute(op.Build(i)); err != nil {
+					t.Fatalf("write %d: %v", i, err)
+				}
+			}
+			want := uint64(3)
+			if mode == "cache" {
+				want = 1
+			}
+			if s := c.lock.Summary(); s.Writes != 3 || s.Conflicts != 0 || s.VersionReads != want {
+				t.Errorf("writes %d, conflicts %d, version reads %d; want 3, 0 and %d", s.Writes, s.Conflicts, s.VersionReads, want)
+			}
+		})
+	}
+}
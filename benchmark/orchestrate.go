@@ -0,0 +1,563 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"benchmark/internal/cli"
+	"benchmark/internal/metrics"
+)
+
+var orchestrateUsageText = `auto_increment orchestrate [options...] -- <benchmark options...>
+
+Launch -jobs Kubernetes Jobs running the benchmark with the given options, all with the same
+run ID and -k8s-friendly, wait for them to complete, collect the summary each one logs and merge
+them into one report. The latency percentiles of the report are exact (the jobs ship their
+histograms); throughput is the sum of the throughput of the jobs.
+
+Options:
+-jobs N              Number of Jobs to launch; Defaults to 2; Must be more than 0
+-image <image>       (Required) Container image whose entrypoint is the benchmark binary
+-namespace <ns>      Namespace of the Jobs; Defaults to "default"
+-api-server <url>    Kubernetes API server, e.g. "http://localhost:8001" for kubectl proxy
+                     Defaults to the in-cluster API server (KUBERNETES_SERVICE_HOST)
+-token-file <file>   Bearer token to authenticate with
+                     Defaults to the service account token when running in a cluster
+-ca-file <file>      CA certificate of the API server
+                     Defaults to the service account CA when running in a cluster
+-service-account <s> Service account of the benchmark pods (e.g. one with DynamoDB access
+                     through IRSA); Defaults to "" (the namespace default)
+-run-id <id>         Run ID shared by all Jobs; Defaults to a generated one
+-timeout <d>         Give up waiting for the Jobs after this long; Defaults to "1h"
+-poll-interval <d>   Interval of checking the status of the Jobs; Defaults to "5s"
+-keep-jobs           Do not delete the Jobs after collecting their results
+-results-dir <dir>   Also write the merged summary to "<dir>/<run-id>.json"
+-config <file>       JSON file with option values, keyed by flag name (see the benchmark)
+-h                   help message
+
+Every option can also be set with an environment variable DDB_BENCH_<OPTION> or in the -config file
+(the options of the benchmark there are ignored), as for the benchmark.
+
+The exit status is non-zero if any Job failed or did not report a summary.
+`
+
+// OrchestrateOptions configures the "orchestrate" subcommand.
+type OrchestrateOptions struct {
+	Jobs           int
+	Image          string
+	Namespace      string
+	APIServer      string
+	TokenFile      string
+	CAFile         string
+	ServiceAccount string
+	RunID          string
+	Timeout        time.Duration
+	PollInterval   time.Duration
+	KeepJobs       bool
+	ResultsDir     string
+	Args           []string
+}
+
+// JobResult is the outcome of one benchmark Job.
+type JobResult struct {
+	Name    string
+	Status  string
+	Summary *Summary
+	Error   string
+}
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	runIDLabel        = "dynamodb-benchmark/run-id"
+)
+
+// kubeClient is the small part of the Kubernetes REST API the orchestrator
+// needs, so that no client library is required.
+type kubeClient struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+func newKubeClient(o OrchestrateOptions) (*kubeClient, error) {
+	server, tokenFile, caFile := o.APIServer, o.TokenFile, o.CAFile
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("not running in a cluster, give the API server with -api-server")
+		}
+		server = "https://" + host + ":" + port
+		if tokenFile == "" {
+			tokenFile = serviceAccountDir + "/token"
+		}
+		if caFile == "" {
+			caFile = serviceAccountDir + "/ca.crt"
+		}
+	}
+	k := &kubeClient{server: strings.TrimSuffix(server, "/"), http: &http.Client{Timeout: 30 * time.Second}}
+	if tokenFile != "" {
+		b, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token: %v", err)
+		}
+		k.token = strings.TrimSpace(string(b))
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		k.http.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	return k, nil
+}
+
+// do sends a request with body encoded as JSON and decodes the response into
+// out unless it is nil.
+func (k *kubeClient) do(method string, path string, body interface{}, out interface{}) error {
+	b, err := k.raw(method, path, body)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+func (k *kubeClient) raw(method string, path string, body interface{}) ([]byte, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, k.server+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if k.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.token)
+	}
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(b, &status) == nil && status.Message != "" {
+			return nil, fmt.Errorf("%s %s: %s (%d)", method, path, status.Message, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("%s %s: status %d", method, path, resp.StatusCode)
+	}
+	return b, nil
+}
+
+var dnsLabelInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// jobName returns a valid Job name for the i-th Job of the run.
+func jobName(runID string, i int) string {
+	id := strings.Trim(dnsLabelInvalid.ReplaceAllString(strings.ToLower(runID), "-"), "-")
+	suffix := fmt.Sprintf("-%d", i)
+	name := "ddb-bench-" + id
+	if len(name)+len(suffix) > 63 {
+		name = strings.TrimRight(name[:63-len(suffix)], "-")
+	}
+	return name + suffix
+}
+
+// jobManifest is the batch/v1 Job running the benchmark once without retries.
+func (o OrchestrateOptions) jobManifest(name string) map[string]interface{} {
+	labels := map[string]string{
+		"app.kubernetes.io/name": "dynamodb-benchmark",
+		runIDLabel:               jobLabelValue(o.RunID),
+	}
+	args := append(append([]string{}, o.Args...), "-k8s-friendly", "-run-id", o.RunID)
+	pod := map[string]interface{}{
+		"restartPolicy": "Never",
+		"containers": []interface{}{
+			map[string]interface{}{
+				"name":  "benchmark",
+				"image": o.Image,
+				"args":  args,
+				"ports": []interface{}{map[string]interface{}{"name": "health", "containerPort": 8081}},
+				"livenessProbe": map[string]interface{}{
+					"httpGet":       map[string]interface{}{"path": "/healthz", "port": "health"},
+					"periodSeconds": 10,
+				},
+			},
+		},
+	}
+	if o.ServiceAccount != "" {
+		pod["serviceAccountName"] = o.ServiceAccount
+	}
+	return map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]interface{}{"name": name, "labels": labels},
+		"spec": map[string]interface{}{
+			"backoffLimit": 0,
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": labels},
+				"spec":     pod,
+			},
+		},
+	}
+}
+
+var labelValueInvalid = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func jobLabelValue(runID string) string {
+	v := labelValueInvalid.ReplaceAllString(runID, "_")
+	if len(v) > 63 {
+		v = v[:63]
+	}
+	return strings.Trim(v, "._-")
+}
+
+// RunOrchestrate launches the Jobs, waits for them and merges their results.
+func RunOrchestrate(o OrchestrateOptions) ([]JobResult, *Summary, error) {
+	k, err := newKubeClient(o)
+	if err != nil {
+		return nil, nil, err
+	}
+	jobsPath := "/apis/batch/v1/namespaces/" + url.PathEscape(o.Namespace) + "/jobs"
+
+	var results []JobResult
+	if !o.KeepJobs {
+		defer func() {
+			for _, r := range results {
+				path := jobsPath + "/" + r.Name + "?propagationPolicy=Background"
+				if err := k.do("DELETE", path, nil, nil); err != nil {
+					fmt.Printf("[WARN] failed to delete job %s: %v\n", r.Name, err)
+				}
+			}
+		}()
+	}
+	for i := 1; i <= o.Jobs; i++ {
+		name := jobName(o.RunID, i)
+		if err := k.do("POST", jobsPath, o.jobManifest(name), nil); err != nil {
+			return nil, nil, fmt.Errorf("failed to create job %s: %v", name, err)
+		}
+		fmt.Printf("Created job %s\n", name)
+		results = append(results, JobResult{Name: name, Status: "Running"})
+	}
+
+	deadline := time.Now().Add(o.Timeout)
+	for running := len(results); running > 0; {
+		if time.Now().After(deadline) {
+			for i := range results {
+				if results[i].Status == "Running" {
+					results[i].Status = "Timeout"
+				}
+			}
+			break
+		}
+		time.Sleep(o.PollInterval)
+		running = 0
+		for i := range results {
+			if results[i].Status != "Running" {
+				continue
+			}
+			var job struct {
+				Status struct {
+					Succeeded int `json:"succeeded"`
+					Failed    int `json:"failed"`
+				} `json:"status"`
+			}
+			if err := k.do("GET", jobsPath+"/"+results[i].Name, nil, &job); err != nil {
+				fmt.Printf("[WARN] %v\n", err)
+				running++
+				continue
+			}
+			switch {
+			case job.Status.Succeeded > 0:
+				results[i].Status = "Succeeded"
+			case job.Status.Failed > 0:
+				results[i].Status = "Failed"
+			default:
+				running++
+				continue
+			}
+			fmt.Printf("Job %s %s\n", results[i].Name, strings.ToLower(results[i].Status))
+		}
+	}
+
+	var summaries []Summary
+	for i := range results {
+		sum, err := k.jobSummary(o.Namespace, results[i].Name)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Summary = sum
+		summaries = append(summaries, *sum)
+	}
+	if len(summaries) == 0 {
+		return results, nil, nil
+	}
+	merged := MergeSummaries(summaries)
+	merged.RunID = o.RunID
+	return results, &merged, nil
+}
+
+// jobSummary reads the summary the pod of the Job logged in -k8s-friendly
+// mode.
+func (k *kubeClient) jobSummary(namespace string, job string) (*Summary, error) {
+	podsPath := "/api/v1/namespaces/" + url.PathEscape(namespace) + "/pods"
+	var pods struct {
+		Items []struct {
+			Metadata struct {
+				Name              string    `json:"name"`
+				CreationTimestamp time.Time `json:"creationTimestamp"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	if err := k.do("GET", podsPath+"?labelSelector="+url.QueryEscape("job-name="+job), nil, &pods); err != nil {
+		return nil, err
+	}
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("no pod found")
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Metadata.CreationTimestamp.After(pods.Items[j].Metadata.CreationTimestamp)
+	})
+	log, err := k.raw("GET", podsPath+"/"+pods.Items[0].Metadata.Name+"/log", nil)
+	if err != nil {
+		return nil, err
+	}
+	var found *Summary
+	scanner := bufio.NewScanner(bytes.NewReader(log))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry LogEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Summary != nil {
+			found = entry.Summary
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no summary in the log of pod %s", pods.Items[0].Metadata.Name)
+	}
+	return found, nil
+}
+
+// MergeSummaries combines the summaries of benchmarks that ran side by side.
+// Counts and throughput add up, the duration is the longest one and the
+// latency percentiles are computed from the merged histograms.
+func MergeSummaries(summaries []Summary) Summary {
+	merged := Summary{SchemaVersion: resultsSchemaVersion, Action: summaries[0].Action, Operations: []OpSummary{}}
+	ops := map[string]*OpSummary{}
+	var names []string
+	var totalLatencyMs float64
+	for _, sum := range summaries {
+		merged.Success += sum.Success
+		merged.Errors += sum.Errors
+		merged.Items += sum.Items
+		merged.RequestsPerSecond += sum.RequestsPerSecond
+		merged.ItemsPerSecond += sum.ItemsPerSecond
+		if sum.DurationSec > merged.DurationSec {
+			merged.DurationSec = sum.DurationSec
+		}
+		merged.SLABuckets = addSLABuckets(merged.SLABuckets, sum.SLABuckets, merged.Success+merged.Errors)
+		merged.CircuitBreaker = append(merged.CircuitBreaker, sum.CircuitBreaker...)
+		merged.Assertions = append(merged.Assertions, sum.Assertions...)
+		for _, op := range sum.Operations {
+			m, ok := ops[op.Operation]
+			if !ok {
+				m = &OpSummary{Operation: op.Operation, MinMs: op.MinMs, latency: metrics.NewHistogram()}
+				ops[op.Operation] = m
+				names = append(names, op.Operation)
+			}
+			samples := float64(op.Success + op.Errors)
+			totalLatencyMs += op.AverageMs * samples
+			m.AverageMs += op.AverageMs * samples
+			m.Success += op.Success
+			m.Errors += op.Errors
+			m.Items += op.Items
+			m.RequestsPerSecond += op.RequestsPerSecond
+			m.ItemsPerSecond += op.ItemsPerSecond
+			if op.DurationSec > m.DurationSec {
+				m.DurationSec = op.DurationSec
+			}
+			if op.MinMs < m.MinMs {
+				m.MinMs = op.MinMs
+			}
+			if op.MaxMs > m.MaxMs {
+				m.MaxMs = op.MaxMs
+			}
+			m.latency.Merge(metrics.FromBuckets(op.Histogram))
+			m.AvgRequestBytes += op.AvgRequestBytes * float64(op.Payloads)
+			m.AvgResponseBytes += op.AvgResponseBytes * float64(op.Payloads)
+			m.Payloads += op.Payloads
+			if op.Capacity != nil {
+				if m.Capacity == nil {
+					m.Capacity = &CapacitySummary{}
+				}
+				m.Capacity.add(op.Capacity)
+			}
+			if op.Retries != nil {
+				if m.Retries == nil {
+					m.Retries = &RetrySummary{}
+				}
+				m.Retries.add(op.Retries, m.Success+m.Errors)
+			}
+			m.SLABuckets = addSLABuckets(m.SLABuckets, op.SLABuckets, m.Success+m.Errors)
+			if op.FirstPage != nil {
+				if m.FirstPage == nil {
+					m.FirstPage = &FirstPageSummary{}
+				}
+				m.FirstPage.add(op.FirstPage)
+			}
+		}
+	}
+	if n := merged.Success + merged.Errors; n > 0 {
+		merged.AverageMs = totalLatencyMs / float64(n)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := ops[name]
+		if n := m.Success + m.Errors; n > 0 {
+			m.AverageMs /= float64(n)
+		}
+		if m.Payloads > 0 {
+			m.AvgRequestBytes /= float64(m.Payloads)
+			m.AvgResponseBytes /= float64(m.Payloads)
+		}
+		m.P50Ms = durationMs(m.latency.Percentile(50))
+		m.P90Ms = durationMs(m.latency.Percentile(90))
+		m.P99Ms = durationMs(m.latency.Percentile(99))
+		m.P999Ms = durationMs(m.latency.Percentile(99.9))
+		merged.Operations = append(merged.Operations, *m)
+	}
+	return merged
+}
+
+// printJobResults prints the outcome of every Job and reports whether all of
+// them succeeded with a summary.
+func printJobResults(results []JobResult) bool {
+	fmt.Println("-----------------------")
+	fmt.Println("DynamoDB Benchmark Jobs")
+	fmt.Println("-----------------------")
+	ok := true
+	for _, r := range results {
+		if r.Status != "Succeeded" || r.Summary == nil {
+			ok = false
+		}
+		if r.Summary == nil {
+			fmt.Printf("%s: %s, no summary: %s\n", r.Name, r.Status, r.Error)
+			continue
+		}
+		fmt.Printf("%s: %s, success: %d, errors: %d, requests/sec: %.2f\n",
+			r.Name, r.Status, r.Summary.Success, r.Summary.Errors, r.Summary.RequestsPerSecond)
+	}
+	return ok
+}
+
+// orchestrate runs the "orchestrate" subcommand and returns the exit status.
+func orchestrate(args []string) int {
+	fs := flag.NewFlagSet("orchestrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Println(orchestrateUsageText)
+	}
+	var o OrchestrateOptions
+	fs.IntVar(&o.Jobs, "jobs", 2, "Number of Kubernetes Jobs to launch")
+	fs.StringVar(&o.Image, "image", "", "(Required) Container image whose entrypoint is the benchmark")
+	fs.StringVar(&o.Namespace, "namespace", "default", "Namespace of the Jobs")
+	fs.StringVar(&o.APIServer, "api-server", "", "Kubernetes API server URL (defaults to the in-cluster one)")
+	fs.StringVar(&o.TokenFile, "token-file", "", "Bearer token file to authenticate with")
+	fs.StringVar(&o.CAFile, "ca-file", "", "CA certificate of the API server")
+	fs.StringVar(&o.ServiceAccount, "service-account", "", "Service account of the benchmark pods")
+	fs.StringVar(&o.RunID, "run-id", "", "Run ID shared by all Jobs (generated if empty)")
+	fs.DurationVar(&o.Timeout, "timeout", time.Hour, "Give up waiting for the Jobs after this long")
+	fs.DurationVar(&o.PollInterval, "poll-interval", 5*time.Second, "Interval of checking the status of the Jobs")
+	fs.BoolVar(&o.KeepJobs, "keep-jobs", false, "Do not delete the Jobs after collecting their results")
+	fs.StringVar(&o.ResultsDir, "results-dir", "", "Directory to write the merged summary to as <run-id>.json")
+	configFile := fs.String("config", "", "JSON file with option values, overridden by environment variables and flags")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if _, err := cli.ApplyEnvAndConfig(fs, *configFile, true); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		fmt.Println("Run with orchestrate -h to see the available options")
+		return exitUsage
+	}
+	o.Args = fs.Args()
+	if o.RunID == "" {
+		o.RunID = newRunID()
+	}
+
+	var problems []string
+	if o.Jobs <= 0 {
+		problems = append(problems, fmt.Sprintf("-jobs must be more than 0 (got %d)", o.Jobs))
+	}
+	if o.Image == "" {
+		problems = append(problems, "-image is required")
+	}
+	if o.Timeout <= 0 || o.PollInterval <= 0 {
+		problems = append(problems, "-timeout and -poll-interval must be more than 0")
+	}
+	if len(o.Args) == 0 {
+		problems = append(problems, "benchmark options are required after \"--\", e.g. -- -a read -table <table> -id <id> -duration 10m")
+	}
+	if len(problems) > 0 {
+		fmt.Printf("[ERROR] %s\n", (&ValidationError{Problems: problems}).Error())
+		fmt.Println("Run with orchestrate -h to see the available options")
+		return exitUsage
+	}
+
+	results, merged, err := RunOrchestrate(o)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		return exitFailure
+	}
+	ok := printJobResults(results)
+	if merged == nil {
+		fmt.Println("[ERROR] no job reported a summary")
+		return exitFailure
+	}
+	merged.Print()
+	if o.ResultsDir != "" {
+		path, err := writeResults(o.ResultsDir, *merged)
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			return exitFailure
+		}
+		fmt.Printf("Results written to %s\n", path)
+	}
+	if !ok {
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// chunkStorages are the values of -storage: objects chunked into items of
+// the table, or put to S3 with a pointer item in the table.
+var chunkStorages = []string{"chunks", "s3"}
+
+// overflowPointerSeq is the sort key of the pointer item of an object of
+// -storage s3, under the partition key the chunks would have.
+const overflowPointerSeq = "0"
+
+// parseStorages parses -storage, e.g. "chunks,s3".
+func parseStorages(spec string) ([]string, error) {
+	var storages []string
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		found := false
+		for _, known := range chunkStorages {
+			found = found || s == known
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown storage %q; must be chunks or s3", s)
+		}
+		storages = append(storages, s)
+	}
+	if len(storages) == 0 {
+		return nil, fmt.Errorf("no storage")
+	}
+	return storages, nil
+}
+
+// overflowStore holds the objects of -storage s3.
+type overflowStore interface {
+	put(key string, object []byte) error
+	get(key string) ([]byte, error)
+}
+
+// s3Store puts the objects under the prefix of -overflow-bucket.
+type s3Store struct {
+	client *s3.S3
+	bucket string
+}
+
+func (s *s3Store) put(key string, object []byte) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(object),
+		ContentType: aws.String("application/octet-stream"),
+	})
+	return err
+}
+
+func (s *s3Store) get(key string) ([]byte, error) {
+	out, err := s.client.GetObject(&s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// memoryStore keeps the objects in memory in place of S3 with the fake
+// endpoint.
+type memoryStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *memoryStore) put(key string, object []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = append([]byte(nil), object...)
+	return nil
+}
+
+func (s *memoryStore) get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("NoSuchKey: %s", key)
+	}
+	return object, nil
+}
+
+// newOverflowStore returns the store of -overflow-bucket, with the default
+// credentials and region like the s3 sink, and records its objects for
+// -cleanup.
+func (c *DynamoDBBenchmark) newOverflowStore() (overflowStore, error) {
+	if c.EndpointUrl == fakeEndpoint {
+		return &memoryStore{objects: map[string][]byte{}}, nil
+	}
+	bucket, _, err := parseS3URI(c.OverflowBucket)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := newSession(ClientOptions{RunID: c.RunID})
+	if err != nil {
+		return nil, err
+	}
+	c.trackResource(Resource{Kind: resourceS3Objects, Name: "s3://" + bucket + "/" + c.overflowKey(c.chunkPrefix()+"-")})
+	return &s3Store{client: s3.New(sess), bucket: bucket}, nil
+}
+
+// overflowKey is the S3 key of the object key under the prefix of
+// -overflow-bucket.
+func (c *DynamoDBBenchmark) overflowKey(key string) string {
+	_, prefix, _ := parseS3URI(c.OverflowBucket)
+	return path.Join(prefix, key)
+}
+
+// putOverflow puts object to the store and then its pointer item, returning
+// how long each took.
+func (c *DynamoDBBenchmark) putOverflow(db *dynamodb.DynamoDB, store overflowStore, key string, object []byte) (time.Duration, time.Duration, error) {
+	start := time.Now()
+	if err := store.put(c.overflowKey(key), object); err != nil {
+		return time.Since(start), 0, err
+	}
+	uploaded := time.Now()
+	_, err := db.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(c.TableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id":         {S: aws.String(key)},
+			chunkSortKey: {N: aws.String(overflowPointerSeq)},
+			"s3_key":     {S: aws.String(c.overflowKey(key))},
+			"size":       {N: aws.String(strconv.Itoa(len(object)))},
+		},
+	})
+	return uploaded.Sub(start), time.Since(uploaded), err
+}
+
+// getOverflow reads the pointer item of key with a consistent GetItem and
+// then the object it points to, returning the object and how long each
+// took.
+func (c *DynamoDBBenchmark) getOverflow(db *dynamodb.DynamoDB, store overflowStore, key string) ([]byte, time.Duration, time.Duration, error) {
+	start := time.Now()
+	out, err := db.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(c.TableName),
+		Key:            map[string]*dynamodb.AttributeValue{"id": {S: aws.String(key)}, chunkSortKey: {N: aws.String(overflowPointerSeq)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	pointer := time.Since(start)
+	if err != nil {
+		return nil, pointer, 0, err
+	}
+	if len(out.Item) == 0 || out.Item["s3_key"] == nil {
+		return nil, pointer, 0, fmt.Errorf("no pointer item of object %s", key)
+	}
+	fetched := time.Now()
+	object, err := store.get(aws.StringValue(out.Item["s3_key"].S))
+	if err != nil {
+		return nil, pointer, time.Since(fetched), err
+	}
+	size, _ := strconv.Atoi(aws.StringValue(out.Item["size"].N))
+	if len(object) != size {
+		return nil, pointer, time.Since(fetched), fmt.Errorf("object %s: %d of %d bytes", key, len(object), size)
+	}
+	return object, pointer, time.Since(fetched), nil
+}
+
+// deleteS3Objects deletes all objects under the S3 URI prefix uri.
+func deleteS3Objects(uri string) error {
+	bucket, prefix, err := parseS3URI(uri)
+	if err != nil {
+		return err
+	}
+	sess, err := newSession(ClientOptions{})
+	if err != nil {
+		return err
+	}
+	client := s3.New(sess)
+	var derr error
+	err = client.ListObjectsV2Pages(&s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)},
+		func(page *s3.ListObjectsV2Output, last bool) bool {
+			if len(page.Contents) == 0 {
+				return true
+			}
+			var objects []*s3.ObjectIdentifier
+			for _, o := range page.Contents {
+				objects = append(objects, &s3.ObjectIdentifier{Key: o.Key})
+			}
+			_, derr = client.DeleteObjects(&s3.DeleteObjectsInput{
+				Bucket: aws.String(bucket),
+				Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+			})
+			return derr == nil
+		})
+	if err != nil {
+		return err
+	}
+	return derr
+}
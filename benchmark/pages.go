@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"benchmark/internal/metrics"
+)
+
+// scanLimit is the Limit of the Scan calls: -limit, or scanPageSize.
+func (c *DynamoDBBenchmark) scanLimit() int64 {
+	if c.Limit > 0 {
+		return int64(c.Limit)
+	}
+	return scanPageSize
+}
+
+// FirstPageSummary compares the time to the first page of the paginated
+// calls of an operation, all a paginated API endpoint waits for before it
+// renders, with the time to the full result of the operation's latency.
+type FirstPageSummary struct {
+	Calls        uint64  `json:"calls"`
+	PagesPerCall float64 `json:"pages_per_call"`
+	AverageMs    float64 `json:"average_ms"`
+	P50Ms        float64 `json:"p50_ms"`
+	P90Ms        float64 `json:"p90_ms"`
+	P99Ms        float64 `json:"p99_ms"`
+}
+
+func (s *FirstPageSummary) String() string {
+	return fmt.Sprintf("calls: %d, pages per call: %.2f, average (ms): %.3f, p50 (ms): %.3f, p90 (ms): %.3f, p99 (ms): %.3f",
+		s.Calls, s.PagesPerCall, s.AverageMs, s.P50Ms, s.P90Ms, s.P99Ms)
+}
+
+// add merges other into s, for MergeSummaries. The percentiles are the
+// highest of both, an upper bound.
+func (s *FirstPageSummary) add(other *FirstPageSummary) {
+	calls := s.Calls + other.Calls
+	if calls == 0 {
+		return
+	}
+	s.PagesPerCall = (s.PagesPerCall*float64(s.Calls) + other.PagesPerCall*float64(other.Calls)) / float64(calls)
+	s.AverageMs = (s.AverageMs*float64(s.Calls) + other.AverageMs*float64(other.Calls)) / float64(calls)
+	s.Calls = calls
+	if other.P50Ms > s.P50Ms {
+		s.P50Ms = other.P50Ms
+	}
+	if other.P90Ms > s.P90Ms {
+		s.P90Ms = other.P90Ms
+	}
+	if other.P99Ms > s.P99Ms {
+		s.P99Ms = other.P99Ms
+	}
+}
+
+// firstPageStats accumulates the time to the first page of the successful
+// paginated calls of an operation.
+type firstPageStats struct {
+	calls   uint64
+	pages   uint64
+	total   time.Duration
+	latency *metrics.Histogram
+}
+
+func (s *firstPageStats) record(latency time.Duration, pages int) {
+	if s.latency == nil {
+		s.latency = metrics.NewHistogram()
+	}
+	s.calls++
+	s.pages += uint64(pages)
+	s.total += latency
+	s.latency.Record(latency)
+}
+
+func (s *firstPageStats) merge(other *firstPageStats) {
+	if other == nil || other.calls == 0 {
+		return
+	}
+	if s.latency == nil {
+		s.latency = metrics.NewHistogram()
+	}
+	s.calls += other.calls
+	s.pages += other.pages
+	s.total += other.total
+	s.latency.Merge(other.latency)
+}
+
+// summary returns nil when no paginated call succeeded.
+func (s *firstPageStats) summary() *FirstPageSummary {
+	if s == nil || s.calls == 0 {
+		return nil
+	}
+	return &FirstPageSummary{
+		Calls:        s.calls,
+		PagesPerCall: ratio(s.pages, s.calls),
+		AverageMs:    averageMs(s.total, s.calls),
+		P50Ms:        durationMs(s.latency.Percentile(50)),
+		P90Ms:        durationMs(s.latency.Percentile(90)),
+		P99Ms:        durationMs(s.latency.Percentile(99)),
+	}
+}
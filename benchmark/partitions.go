@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	// partitionReadUnits and partitionWriteUnits are the documented
+	// throughput one partition serves per second.
+	partitionReadUnits  = 3000
+	partitionWriteUnits = 1000
+	// partitionWindow is the width of the windows the throughput is
+	// estimated over.
+	partitionWindow = 10 * time.Second
+)
+
+// estimatedUnits is the capacity an operation which touched items probably
+// consumed when DynamoDB did not report it: 1 WCU per item written
+// (TransactWriteItems 2), 0.5 RCU per item read eventually consistent and
+// per Query or Scan page, i.e. items of at most 1 KB and 4 KB.
+func estimatedUnits(op string, items int) (read, write float64) {
+	if i := strings.Index(op, "["); i >= 0 {
+		op = op[:i]
+	}
+	switch op {
+	case "PutItem", "UpdateItem", "DeleteItem", "BatchWriteItem":
+		return 0, float64(items)
+	case "TransactWriteItems":
+		return 0, 2 * float64(items)
+	case "GetItem", "BatchGetItem":
+		return 0.5 * float64(items), 0
+	case "Query", "Scan":
+		return 0.5, 0
+	}
+	return 0, 0
+}
+
+type partitionBucket struct {
+	estimatedRead, estimatedWrite float64
+	// measuredRead and measuredWrite add up the consumed capacity DynamoDB
+	// reported with -consumed-capacity, which replaces the estimate.
+	measuredRead, measuredWrite float64
+	measured                    bool
+	throttles                   uint64
+}
+
+// PartitionWindow is the throughput of one window and the number of
+// partitions it takes at least.
+type PartitionWindow struct {
+	OffsetSec        float64 `json:"offset_sec"`
+	ReadUnitsPerSec  float64 `json:"read_units_per_sec"`
+	WriteUnitsPerSec float64 `json:"write_units_per_sec"`
+	Throttles        uint64  `json:"throttles"`
+	// Partitions is the estimate up to the window: partitions split but do
+	// not merge during a run, so it never decreases.
+	Partitions int `json:"partitions"`
+}
+
+// PartitionSummary estimates the partitions of the table from the observed
+// throughput.
+type PartitionSummary struct {
+	// Measured tells whether the units are the consumed capacity DynamoDB
+	// reported rather than estimated per item.
+	Measured  bool    `json:"measured"`
+	WindowSec float64 `json:"window_sec"`
+	First     int     `json:"first"`
+	Last      int     `json:"last"`
+	// FirstThrottleSec is the start of the first window with a throttle, -1
+	// if there was none; BeforeThrottle is the estimate from the windows
+	// before it.
+	FirstThrottleSec float64           `json:"first_throttle_sec"`
+	BeforeThrottle   int               `json:"before_throttle"`
+	Windows          []PartitionWindow `json:"windows"`
+}
+
+func (s *PartitionSummary) Print() {
+	units := "units estimated per item"
+	if s.Measured {
+		units = "consumed capacity"
+	}
+	fmt.Printf("Partitions (at least, from %d RCU / %d WCU per partition and the %s per %.0fs): %d at the start, %d at the end\n",
+		partitionReadUnits, partitionWriteUnits, units, s.WindowSec, s.First, s.Last)
+	for i, w := range s.Windows {
+		if i == 0 || w.Partitions != s.Windows[i-1].Partitions {
+			fmt.Printf("  at %.0fs: %d partitions (%.1f RCU/s, %.1f WCU/s)\n", w.OffsetSec, w.Partitions, w.ReadUnitsPerSec, w.WriteUnitsPerSec)
+		}
+	}
+	if s.FirstThrottleSec >= 0 {
+		fmt.Printf("  first throttle at %.0fs, after throughput needing %d partitions; a hot key throttles on one partition whatever the number\n",
+			s.FirstThrottleSec, s.BeforeThrottle)
+	}
+}
+
+// PartitionEstimator sums the read and write units per window of the run,
+// from which it estimates how many partitions back the table. A nil
+// *PartitionEstimator records nothing.
+type PartitionEstimator struct {
+	mu      sync.Mutex
+	start   time.Time
+	buckets []*partitionBucket
+}
+
+func NewPartitionEstimator(start time.Time) *PartitionEstimator {
+	return &PartitionEstimator{start: start}
+}
+
+// bucket returns the bucket of t. The caller holds the lock.
+func (pe *PartitionEstimator) bucket(t time.Time) *partitionBucket {
+	i := int(t.Sub(pe.start) / partitionWindow)
+	if i < 0 {
+		i = 0
+	}
+	for len(pe.buckets) <= i {
+		pe.buckets = append(pe.buckets, &partitionBucket{})
+	}
+	return pe.buckets[i]
+}
+
+// Record adds the estimated units of an operation which started at start.
+func (pe *PartitionEstimator) Record(op string, start time.Time, items int, err error) {
+	if pe == nil || err != nil {
+		return
+	}
+	read, write := estimatedUnits(op, items)
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	b := pe.bucket(start)
+	b.estimatedRead += read
+	b.estimatedWrite += write
+}
+
+// RecordCapacity adds the capacity DynamoDB reported for an attempt.
+func (pe *PartitionEstimator) RecordCapacity(cc *dynamodb.ConsumedCapacity) {
+	if pe == nil {
+		return
+	}
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	b := pe.bucket(time.Now())
+	b.measured = true
+	b.measuredRead += aws.Float64Value(cc.ReadCapacityUnits)
+	b.measuredWrite += aws.Float64Value(cc.WriteCapacityUnits)
+	if cc.ReadCapacityUnits == nil && cc.WriteCapacityUnits == nil {
+		// Without INDEXES the total is all there is; attribute it by the
+		// kind of operation the estimate saw.
+		if b.estimatedWrite > 0 {
+			b.measuredWrite += aws.Float64Value(cc.CapacityUnits)
+		} else {
+			b.measuredRead += aws.Float64Value(cc.CapacityUnits)
+		}
+	}
+}
+
+// handler returns the SDK Retry handler which counts throttled attempts.
+func (pe *PartitionEstimator) handler() request.NamedHandler {
+	return request.NamedHandler{Name: "dynamodb-benchmark.PartitionEstimator", Fn: func(r *request.Request) {
+		if !isThrottle(r.Error) {
+			return
+		}
+		pe.mu.Lock()
+		defer pe.mu.Unlock()
+		pe.bucket(time.Now()).throttles++
+	}}
+}
+
+// partitionsFor is the number of partitions the read and write units per
+// second take at least, 1 for none.
+func partitionsFor(read, write float64) int {
+	n := int(math.Ceil(read/partitionReadUnits + write/partitionWriteUnits))
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// Summary estimates the partitions per window; the last window is only as
+// long as the run was.
+func (pe *PartitionEstimator) Summary(end time.Time) *PartitionSummary {
+	if pe == nil {
+		return nil
+	}
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	sum := &PartitionSummary{WindowSec: partitionWindow.Seconds(), FirstThrottleSec: -1, BeforeThrottle: 1}
+	partitions := 0
+	for i, b := range pe.buckets {
+		offset := time.Duration(i) * partitionWindow
+		width := partitionWindow
+		if rest := end.Sub(pe.start) - offset; rest < width {
+			width = rest
+		}
+		if width < time.Second {
+			break
+		}
+		read, write := b.estimatedRead, b.estimatedWrite
+		if b.measured {
+			read, write = b.measuredRead, b.measuredWrite
+			sum.Measured = true
+		}
+		w := PartitionWindow{
+			OffsetSec:        offset.Seconds(),
+			ReadUnitsPerSec:  read / width.Seconds(),
+			WriteUnitsPerSec: write / width.Seconds(),
+			Throttles:        b.throttles,
+		}
+		if n := partitionsFor(w.ReadUnitsPerSec, w.WriteUnitsPerSec); n > partitions {
+			partitions = n
+		}
+		w.Partitions = partitions
+		if b.throttles > 0 && sum.FirstThrottleSec < 0 {
+			sum.FirstThrottleSec = w.OffsetSec
+			if i > 0 {
+				sum.BeforeThrottle = sum.Windows[i-1].Partitions
+			}
+		}
+		sum.Windows = append(sum.Windows, w)
+	}
+	if len(sum.Windows) == 0 {
+		return nil
+	}
+	sum.First = sum.Windows[0].Partitions
+	sum.Last = partitions
+	return sum
+}
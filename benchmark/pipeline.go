@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"benchmark/internal/metrics"
+)
+
+// pipelineTrackEvery is how many keys are handed out between two updates of
+// the run file of -cleanup (see ResourceTracker).
+const pipelineTrackEvery = 1000
+
+// pipelinePlaceholder matches the placeholders of -derived-key.
+var pipelinePlaceholder = regexp.MustCompile(`\{[^}]*\}`)
+
+// pipelinePrefix is the key prefix of the items the pipeline action writes,
+// "<prefix>-<n>".
+func (c *DynamoDBBenchmark) pipelinePrefix() string {
+	return c.Id + "-pipe-" + c.RunID
+}
+
+// DerivedKey is one attribute of the key of the item the pipeline is
+// expected to materialize for a write: its name and a template of its value.
+type DerivedKey struct {
+	Name     string
+	Template string
+}
+
+// parseDerivedKey parses -derived-key: comma separated
+// "<attribute>=<template>[:S|N]", where the template can use {id} (the key
+// written), {n} (its sequence number) and {session}, e.g.
+// "pk=view#{id},sk=summary".
+func parseDerivedKey(spec string) ([]DerivedKey, []string, error) {
+	var keys []DerivedKey
+	var types []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, nil, fmt.Errorf("%q is not <attribute>=<template>", entry)
+		}
+		template, typ := kv[1], dynamodb.ScalarAttributeTypeS
+		if i := strings.LastIndex(template, ":"); i >= 0 && (template[i+1:] == "S" || template[i+1:] == "N") {
+			template, typ = template[:i], template[i+1:]
+		}
+		for _, p := range pipelinePlaceholder.FindAllString(template, -1) {
+			if p != "{id}" && p != "{n}" && p != "{session}" {
+				return nil, nil, fmt.Errorf("%s: unknown placeholder %s; must be {id}, {n} or {session}", kv[0], p)
+			}
+		}
+		keys = append(keys, DerivedKey{Name: kv[0], Template: template})
+		types = append(types, typ)
+	}
+	if len(keys) == 0 || len(keys) > 2 {
+		return nil, nil, fmt.Errorf("needs the 1 or 2 attributes of the key")
+	}
+	return keys, types, nil
+}
+
+// derivedKey returns the key of the item expected in -pipeline-table for the
+// write of key id, the n-th of the run, by session.
+func derivedKey(keys []DerivedKey, types []string, id string, n int64, session int) map[string]*dynamodb.AttributeValue {
+	key := map[string]*dynamodb.AttributeValue{}
+	r := strings.NewReplacer("{id}", id, "{n}", strconv.FormatInt(n, 10), "{session}", strconv.Itoa(session))
+	for i, k := range keys {
+		v := r.Replace(k.Template)
+		if types[i] == dynamodb.ScalarAttributeTypeN {
+			key[k.Name] = &dynamodb.AttributeValue{N: aws.String(v)}
+		} else {
+			key[k.Name] = &dynamodb.AttributeValue{S: aws.String(v)}
+		}
+	}
+	return key
+}
+
+// PipelineSummary breaks the end-to-end latency of the pipeline action down
+// into the write to -table and the lag until the derived item could be read
+// from -pipeline-table.
+type PipelineSummary struct {
+	Items uint64 `json:"items"`
+	// TimedOut counts the writes whose derived item did not appear within
+	// -pipeline-timeout.
+	TimedOut     uint64  `json:"timed_out"`
+	PollsPerItem float64 `json:"polls_per_item"`
+	WriteP50Ms   float64 `json:"write_p50_ms"`
+	WriteP99Ms   float64 `json:"write_p99_ms"`
+	// Lag is from the acknowledgment of the write to the first read which
+	// found the derived item, at most -pipeline-poll late.
+	LagAverageMs float64 `json:"lag_average_ms"`
+	LagP50Ms     float64 `json:"lag_p50_ms"`
+	LagP90Ms     float64 `json:"lag_p90_ms"`
+	LagP99Ms     float64 `json:"lag_p99_ms"`
+	LagMaxMs     float64 `json:"lag_max_ms"`
+}
+
+func (s *PipelineSummary) String() string {
+	return fmt.Sprintf("items %d, timed out %d, polls per item %.2f, write p50 (ms): %.3f, p99 (ms): %.3f; lag average (ms): %.3f, p50 (ms): %.3f, p90 (ms): %.3f, p99 (ms): %.3f, max (ms): %.3f",
+		s.Items, s.TimedOut, s.PollsPerItem, s.WriteP50Ms, s.WriteP99Ms, s.LagAverageMs, s.LagP50Ms, s.LagP90Ms, s.LagP99Ms, s.LagMaxMs)
+}
+
+// PipelineStats hands out the sequence numbers of the items of the pipeline
+// action and records the writes and lags of all sessions. A nil
+// *PipelineStats records nothing.
+type PipelineStats struct {
+	// seq is the last sequence number handed out, first for the alignment
+	// of the atomic operations.
+	seq      int64
+	mu       sync.Mutex
+	items    uint64
+	timedOut uint64
+	polls    uint64
+	write    *metrics.Histogram
+	lag      *metrics.Histogram
+	lagTotal time.Duration
+	lagMax   time.Duration
+}
+
+func NewPipelineStats() *PipelineStats {
+	return &PipelineStats{write: metrics.NewHistogram(), lag: metrics.NewHistogram()}
+}
+
+// Next returns the sequence number of the next item.
+func (ps *PipelineStats) Next() int64 {
+	return atomic.AddInt64(&ps.seq, 1)
+}
+
+// Record adds one write which took write, then polls reads until the derived
+// item appeared after lag or, with found false, until the timeout.
+func (ps *PipelineStats) Record(write time.Duration, lag time.Duration, polls int, found bool) {
+	if ps == nil {
+		return
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.items++
+	ps.polls += uint64(polls)
+	ps.write.Record(write)
+	if !found {
+		ps.timedOut++
+		return
+	}
+	ps.lag.Record(lag)
+	ps.lagTotal += lag
+	if lag > ps.lagMax {
+		ps.lagMax = lag
+	}
+}
+
+func (ps *PipelineStats) Summary() *PipelineSummary {
+	if ps == nil {
+		return nil
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return &PipelineSummary{
+		Items:        ps.items,
+		TimedOut:     ps.timedOut,
+		PollsPerItem: ratio(ps.polls, ps.items),
+		WriteP50Ms:   durationMs(ps.write.Percentile(50)),
+		WriteP99Ms:   durationMs(ps.write.Percentile(99)),
+		LagAverageMs: averageMs(ps.lagTotal, ps.items-ps.timedOut),
+		LagP50Ms:     durationMs(ps.lag.Percentile(50)),
+		LagP90Ms:     durationMs(ps.lag.Percentile(90)),
+		LagP99Ms:     durationMs(ps.lag.Percentile(99)),
+		LagMaxMs:     durationMs(ps.lagMax),
+	}
+}
+
+// startPipelineWorker writes items to -table and waits for the items derived
+// from them to appear in -pipeline-table.
+func (c *DynamoDBBenchmark) startPipelineWorker(id int, wg *sync.WaitGroup, stats *WorkerStats) {
+	c.runWorker(id, wg, stats, c.newPipelineOperation)
+}
+
+// pipelineOperation sends the calls of a pipeline session: a PutItem of a
+// new item "<id>-pipe-<run id>-<n>", then consistent GetItem calls of the
+// -derived-key item in -pipeline-table every -pipeline-poll until it is
+// found, recorded together as "Pipeline", the end-to-end latency.
+type pipelineOperation struct {
+	c       *DynamoDBBenchmark
+	db      *dynamodb.DynamoDB
+	session int
+	keys    []DerivedKey
+	types   []string
+}
+
+// pipelineRequest is the Request of a pipeline call.
+type pipelineRequest struct {
+	put *dynamodb.PutItemInput
+	get *dynamodb.GetItemInput
+}
+
+func (c *DynamoDBBenchmark) newPipelineOperation(id int, db *dynamodb.DynamoDB, stats *WorkerStats) Operation {
+	keys, types, _ := parseDerivedKey(c.DerivedKey)
+	return &pipelineOperation{c: c, db: db, session: id, keys: keys, types: types}
+}
+
+func (o *pipelineOperation) Build(i int) *Call {
+	c := o.c
+	n := c.pipeline.Next()
+	if n%pipelineTrackEvery == 1 {
+		c.trackResource(Resource{Kind: resourceItems, Table: c.TableName, Name: c.pipelinePrefix(), Count: int(n + pipelineTrackEvery - 1)})
+	}
+	id := c.pipelinePrefix() + "-" + strconv.FormatInt(n, 10)
+	put := &dynamodb.PutItemInput{
+		TableName: aws.String(c.TableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id":         {S: aws.String(id)},
+			"age":        {N: aws.String(strconv.FormatInt(n, 10))},
+			"run_id":     {S: aws.String(c.RunID)},
+			"written_at": {S: aws.String(time.Now().UTC().Format(time.RFC3339Nano))},
+		},
+	}
+	get := &dynamodb.GetItemInput{
+		TableName:      aws.String(c.PipelineTable),
+		Key:            derivedKey(o.keys, o.types, id, n, o.session),
+		ConsistentRead: aws.Bool(true),
+	}
+	return &Call{Op: "Pipeline", Request: &pipelineRequest{put, get}, Items: 1}
+}
+
+func (o *pipelineOperation) Execute(call *Call) error {
+	c := o.c
+	req := call.Request.(*pipelineRequest)
+	start := time.Now()
+	ctx := call.Context()
+	if _, err := o.db.PutItemWithContext(ctx, req.put); err != nil {
+		return err
+	}
+	written := time.Now()
+	for polls := 1; ; polls++ {
+		// The polls are not retries of the write.
+		call.attempts.Poll()
+		out, err := o.db.GetItemWithContext(ctx, req.get)
+		if err != nil {
+			return err
+		}
+		if len(out.Item) > 0 {
+			c.pipeline.Record(written.Sub(start), time.Since(written), polls, true)
+			return nil
+		}
+		if time.Since(written) >= c.PipelineTimeout {
+			c.pipeline.Record(written.Sub(start), 0, polls, false)
+			return fmt.Errorf("no item %s in %s %s after the write", wireJSON(req.get.Key), c.PipelineTable, c.PipelineTimeout)
+		}
+		time.Sleep(c.PipelinePoll)
+	}
+}
+
+func (o *pipelineOperation) Observe(call *Call, err error) {}
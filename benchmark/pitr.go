@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// EnablePITR turns on point-in-time recovery of tableName.
+func EnablePITR(db dynamodbiface.DynamoDBAPI, tableName *string) error {
+	out, err := db.UpdateContinuousBackups(&dynamodb.UpdateContinuousBackupsInput{
+		TableName: tableName,
+		PointInTimeRecoverySpecification: &dynamodb.PointInTimeRecoverySpecification{
+			PointInTimeRecoveryEnabled: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	status := "ENABLED"
+	if d := out.ContinuousBackupsDescription; d != nil && d.PointInTimeRecoveryDescription != nil {
+		status = aws.StringValue(d.PointInTimeRecoveryDescription.PointInTimeRecoveryStatus)
+	}
+	fmt.Printf("Point-in-time recovery of table %s: %s\n", *tableName, status)
+	return nil
+}
+
+// CreateBackup takes an on-demand backup of tableName named backupName
+// (defaults to "<table>-<UTC timestamp>") and, with wait, polls it until it
+// is AVAILABLE.
+func CreateBackup(db dynamodbiface.DynamoDBAPI, tableName *string, backupName string, wait bool, verbose bool) error {
+	if backupName == "" {
+		backupName = *tableName + "-" + time.Now().UTC().Format("20060102T150405Z")
+	}
+	start := time.Now()
+	out, err := db.CreateBackup(&dynamodb.CreateBackupInput{
+		TableName:  tableName,
+		BackupName: aws.String(backupName),
+	})
+	if err != nil {
+		return err
+	}
+	details := out.BackupDetails
+	fmt.Printf("Started backup %s of table %s: %s\n", backupName, *tableName, aws.StringValue(details.BackupArn))
+	if !wait {
+		return nil
+	}
+	for aws.StringValue(details.BackupStatus) == dynamodb.BackupStatusCreating {
+		time.Sleep(5 * time.Second)
+		desc, err := db.DescribeBackup(&dynamodb.DescribeBackupInput{BackupArn: details.BackupArn})
+		if err != nil {
+			return err
+		}
+		details = desc.BackupDescription.BackupDetails
+		if verbose {
+			fmt.Printf("[Verbose] Backup %s: %s\n", backupName, aws.StringValue(details.BackupStatus))
+		}
+	}
+	fmt.Printf("Backup %s %s after %.1f sec (%d bytes)\n",
+		backupName, aws.StringValue(details.BackupStatus), time.Since(start).Seconds(), aws.Int64Value(details.BackupSizeBytes))
+	return nil
+}
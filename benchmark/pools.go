@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// poolActions are the operations a pool of -pools can run.
+var poolActions = []string{"read", "write", "scan"}
+
+// scanPageSize is the Limit of every Scan of a scan pool without -limit.
+const scanPageSize = 100
+
+// poolOptions are the options a named pool can set for its connections,
+// overriding those of the run.
+var poolOptions = map[string]func(c *DynamoDBBenchmark, v string) error{
+	"table":           func(c *DynamoDBBenchmark, v string) error { c.TableName = v; return nil },
+	"id":              func(c *DynamoDBBenchmark, v string) error { c.Id = v; return nil },
+	"rate":            func(c *DynamoDBBenchmark, v string) (err error) { c.Rate, err = strconv.ParseFloat(v, 64); return },
+	"keys":            func(c *DynamoDBBenchmark, v string) (err error) { c.Keys, err = strconv.Atoi(v); return },
+	"key-skew":        func(c *DynamoDBBenchmark, v string) error { c.KeySkew = v; return nil },
+	"think-time":      func(c *DynamoDBBenchmark, v string) (err error) { c.ThinkTime, err = time.ParseDuration(v); return },
+	"think-time-dist": func(c *DynamoDBBenchmark, v string) error { c.ThinkTimeDist = v; return nil },
+	"retry-num":       func(c *DynamoDBBenchmark, v string) (err error) { c.RetryNum, err = strconv.Atoi(v); return },
+	"endpoint-url":    func(c *DynamoDBBenchmark, v string) error { c.EndpointUrl = v; return nil },
+	"role-arns":       func(c *DynamoDBBenchmark, v string) error { c.RoleARNs = v; return nil },
+	"start": func(c *DynamoDBBenchmark, v string) (err error) {
+		if c.poolStart, err = time.ParseDuration(v); err == nil && c.poolStart < 0 {
+			err = fmt.Errorf("must not be negative")
+		}
+		return
+	},
+	"consumed-capacity": func(c *DynamoDBBenchmark, v string) (err error) {
+		c.ConsumedCapacity, err = strconv.ParseBool(v)
+		return
+	},
+}
+
+// Pool is a number of connections running one operation, with its own
+// options in Options (see poolOptions).
+type Pool struct {
+	Name        string
+	Action      string
+	Connections int
+	Options     map[string]string
+}
+
+// parsePools parses -pools: comma separated "<action>=<connections>"
+// entries, e.g. "read=50,write=10,scan=2", or a JSON array of named pools,
+// e.g. [{"name": "api", "action": "read", "connections": 50, "rate": 1000}].
+func parsePools(spec string) ([]Pool, error) {
+	if strings.HasPrefix(strings.TrimSpace(spec), "[") {
+		return parseNamedPools(spec)
+	}
+	var pools []Pool
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		action := strings.TrimSpace(kv[0])
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%q is not <action>=<connections>", entry)
+		}
+		known := false
+		for _, a := range poolActions {
+			known = known || a == action
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown pool action %q; must be one of %s", action, strings.Join(poolActions, ", "))
+		}
+		if seen[action] {
+			return nil, fmt.Errorf("pool %q is given twice", action)
+		}
+		seen[action] = true
+		n, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("pool %q needs a number of connections more than 0, got %q", action, kv[1])
+		}
+		pools = append(pools, Pool{Name: action, Action: action, Connections: n})
+	}
+	return pools, nil
+}
+
+func parseNamedPools(spec string) ([]Pool, error) {
+	var raw []map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(spec))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to parse the pools: %v", err)
+	}
+	var pools []Pool
+	seen := map[string]bool{}
+	for i, entry := range raw {
+		p := Pool{Options: map[string]string{}}
+		for key, v := range entry {
+			switch v.(type) {
+			case string, json.Number, bool:
+			default:
+				return nil, fmt.Errorf("pool %d: option %q must be a string, number or boolean", i+1, key)
+			}
+			value := fmt.Sprint(v)
+			switch key {
+			case "name":
+				p.Name = value
+			case "action":
+				p.Action = value
+			case "connections":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					return nil, fmt.Errorf("pool %d: connections must be more than 0, got %q", i+1, value)
+				}
+				p.Connections = n
+			default:
+				if _, ok := poolOptions[key]; !ok {
+					return nil, fmt.Errorf("pool %d: unknown option %q; a pool can set name, action, connections and %s", i+1, key, strings.Join(poolOptionNames(), ", "))
+				}
+				p.Options[key] = value
+			}
+		}
+		if p.Name == "" {
+			return nil, fmt.Errorf("pool %d needs a name", i+1)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("pool %q is given twice", p.Name)
+		}
+		seen[p.Name] = true
+		known := false
+		for _, a := range poolActions {
+			known = known || a == p.Action
+		}
+		if !known {
+			return nil, fmt.Errorf("pool %q: action must be one of %s, got %q", p.Name, strings.Join(poolActions, ", "), p.Action)
+		}
+		if p.Connections == 0 {
+			return nil, fmt.Errorf("pool %q needs connections", p.Name)
+		}
+		pools = append(pools, p)
+	}
+	return pools, nil
+}
+
+func poolOptionNames() []string {
+	var names []string
+	for name := range poolOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// poolBenchmark is the copy of the benchmark the connections of pool p run
+// with: its action and options, a rate limiter of its own if it sets -rate,
+// and everything else shared with the run.
+func (c *DynamoDBBenchmark) poolBenchmark(p Pool) (*DynamoDBBenchmark, error) {
+	pc := *c
+	pc.Pools = ""
+	if p.Name != c.VictimPool {
+		pc.isolation = nil
+	}
+	pc.VictimPool = ""
+	if p.Action != "scan" {
+		pc.Action = p.Action
+	}
+	for key, v := range p.Options {
+		if err := poolOptions[key](&pc, v); err != nil {
+			return nil, fmt.Errorf("pool %q: %s %q: %v", p.Name, key, v, err)
+		}
+	}
+	if _, ok := p.Options["rate"]; ok {
+		pc.limiter = nil
+		if pc.Rate > 0 {
+			pc.limiter = NewRateLimiter(pc.Rate)
+		}
+	}
+	return &pc, nil
+}
+
+// resetPools resets the items of every pool of -pools with its own table and
+// keys, as -reset does for the run.
+func (c *DynamoDBBenchmark) resetPools() error {
+	pools, _ := parsePools(c.Pools)
+	for _, p := range pools {
+		if p.Action == "scan" {
+			continue
+		}
+		pc, err := c.poolBenchmark(p)
+		if err != nil {
+			return err
+		}
+		if err := pc.resetItem(); err != nil {
+			return fmt.Errorf("pool %q: %v", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// poolWorkers returns the pool and the benchmark copy of every session, by
+// session id - 1.
+func (c *DynamoDBBenchmark) poolWorkers() ([]Pool, []*DynamoDBBenchmark, error) {
+	pools, _ := parsePools(c.Pools)
+	var byID []Pool
+	var runs []*DynamoDBBenchmark
+	for _, p := range pools {
+		pc, err := c.poolBenchmark(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := 0; i < p.Connections; i++ {
+			byID = append(byID, p)
+			runs = append(runs, pc)
+		}
+	}
+	return byID, runs, nil
+}
+
+// validatePools validates every named pool as if its options were given to
+// the run, returning the problems prefixed with the pool name.
+func (c *DynamoDBBenchmark) validatePools() []string {
+	pools, _ := parsePools(c.Pools)
+	var problems []string
+	for _, p := range pools {
+		if len(p.Options) == 0 {
+			continue
+		}
+		pc, err := c.poolBenchmark(p)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if verr, ok := pc.Validate().(*ValidationError); ok {
+			for _, problem := range verr.Problems {
+				problems = append(problems, fmt.Sprintf("pool %q: %s", p.Name, problem))
+			}
+		}
+	}
+	return problems
+}
+
+// poolConnections is the number of connections of all pools.
+func poolConnections(pools []Pool) int {
+	n := 0
+	for _, p := range pools {
+		n += p.Connections
+	}
+	return n
+}
+
+// poolName is the pool of worker id: the pools take the workers in the
+// order given.
+func (c *DynamoDBBenchmark) poolName(id int) string {
+	pools, _ := parsePools(c.Pools)
+	for _, p := range pools {
+		if id <= p.Connections {
+			return p.Name
+		}
+		id -= p.Connections
+	}
+	return ""
+}
+
+// PoolSummary is the outcome of the workers of one pool of -pools.
+type PoolSummary struct {
+	Pool              string  `json:"pool"`
+	Action            string  `json:"action"`
+	Connections       int     `json:"connections"`
+	Success           uint64  `json:"success"`
+	Errors            uint64  `json:"errors"`
+	RequestsPerSecond float64 `json:"requests_per_sec"`
+	AverageMs         float64 `json:"average_ms"`
+	P50Ms             float64 `json:"p50_ms"`
+	P99Ms             float64 `json:"p99_ms"`
+}
+
+// poolSummaries breaks the results down by -pools entry.
+func (c *DynamoDBBenchmark) poolSummaries(stats *Stats) []PoolSummary {
+	pools, _ := parsePools(c.Pools)
+	if len(pools) == 0 {
+		return nil
+	}
+	groups := stats.GroupSummaries(c.Action, c.poolName)
+	var sums []PoolSummary
+	for _, p := range pools {
+		sum := groups[p.Name]
+		s := PoolSummary{
+			Pool:              p.Name,
+			Action:            p.Action,
+			Connections:       p.Connections,
+			Success:           sum.Success,
+			Errors:            sum.Errors,
+			RequestsPerSecond: sum.RequestsPerSecond,
+			AverageMs:         sum.AverageMs,
+		}
+		for _, op := range sum.Operations {
+			if op.P50Ms > s.P50Ms {
+				s.P50Ms = op.P50Ms
+			}
+			if op.P99Ms > s.P99Ms {
+				s.P99Ms = op.P99Ms
+			}
+		}
+		sums = append(sums, s)
+	}
+	return sums
+}
+
+// startScanWorker scans the table a page of -limit items per call,
+// starting over at the end.
+func (c *DynamoDBBenchmark) startScanWorker(id int, wg *sync.WaitGroup, stats *WorkerStats) {
+	c.runWorker(id, wg, stats, c.newScanOperation)
+}
+
+// scanOperation sends the Scan calls of a scan session, each continuing
+// where the previous one stopped.
+type scanOperation struct {
+	db    *dynamodb.DynamoDB
+	stats *WorkerStats
+	param *dynamodb.ScanInput
+}
+
+func (c *DynamoDBBenchmark) newScanOperation(id int, db *dynamodb.DynamoDB, stats *WorkerStats) Operation {
+	param := &dynamodb.ScanInput{TableName: aws.String(c.TableName), Limit: aws.Int64(c.scanLimit())}
+	if c.ConsumedCapacity {
+		param.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityIndexes)
+	}
+	return &scanOperation{db: db, stats: stats, param: param}
+}
+
+func (o *scanOperation) Build(i int) *Call {
+	return &Call{Op: "Scan", Request: o.param}
+}
+
+func (o *scanOperation) Execute(call *Call) error {
+	out, err := o.db.ScanWithContext(call.Context(), o.param)
+	if err == nil {
+		o.stats.RecordCapacity("Scan", out.ConsumedCapacity)
+		call.Items = len(out.Items)
+		o.param.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+	return err
+}
+
+func (o *scanOperation) Observe(call *Call, err error) {}
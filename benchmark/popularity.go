@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// KeySkew picks keys numbered from 1: uniformly, or with a Zipf distribution
+// where key 1 is the most popular.
+type KeySkew struct {
+	Zipf float64
+}
+
+// parseKeySkew parses "uniform" or "zipf:<s>" with s > 1.
+func parseKeySkew(spec string) (KeySkew, error) {
+	if spec == "" || spec == "uniform" {
+		return KeySkew{}, nil
+	}
+	if strings.HasPrefix(spec, "zipf:") {
+		s, err := strconv.ParseFloat(strings.TrimPrefix(spec, "zipf:"), 64)
+		if err != nil || s <= 1 {
+			return KeySkew{}, fmt.Errorf("the zipf exponent must be a number more than 1, got %q", spec)
+		}
+		return KeySkew{Zipf: s}, nil
+	}
+	return KeySkew{}, fmt.Errorf("must be uniform or zipf:<s>, got %q", spec)
+}
+
+// picker returns a function returning key numbers from 1 to keys.
+func (s KeySkew) picker(rnd *rand.Rand, keys int) func() int {
+	if s.Zipf == 0 {
+		return func() int { return rnd.Intn(keys) + 1 }
+	}
+	z := rand.NewZipf(rnd, s.Zipf, 1, uint64(keys-1))
+	return func() int { return int(z.Uint64()) + 1 }
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var presetUsageText = `auto_increment preset save [-force] <name> -- <options...>
+auto_increment preset run <name> [options...]
+auto_increment preset list
+auto_increment preset show <name>
+auto_increment preset delete <name>
+
+Store benchmark options under a name in ~/.dynamodb_benchmark/presets/<name>.json and run them
+with one short command. Options given to "preset run" are appended to the stored ones and take
+precedence, e.g. "preset run checkout-stock-contended -duration 1m" for a shorter run.
+Names consist of letters, digits, ".", "_" and "-".
+
+Built-in presets (a saved preset of the same name takes precedence):
+  session-store  A web session store: 10000 active sessions of 512 bytes with a 30m TTL, 95%
+                 lookups and 5% refreshes, zipfian session popularity; add -table and -id, e.g.
+                 "preset run session-store -table sessions -id web -sessions 100000"
+`
+
+// builtinPresets ship with the benchmark; they need -table and -id.
+var builtinPresets = map[string][]string{
+	"session-store": {
+		"-a", "session", "-reset", "-sessions", "10000", "-session-size", "512", "-session-ttl", "30m",
+		"-read-ratio", "0.95", "-key-skew", "zipf:1.1", "-c", "20", "-duration", "5m",
+	},
+}
+
+var presetNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Preset is a named list of benchmark options.
+type Preset struct {
+	Name  string    `json:"name"`
+	Args  []string  `json:"args"`
+	Saved time.Time `json:"saved"`
+}
+
+func presetDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the home directory: %v", err)
+	}
+	return filepath.Join(home, ".dynamodb_benchmark", "presets"), nil
+}
+
+func presetPath(name string) (string, error) {
+	if !presetNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid preset name %q: use letters, digits, \".\", \"_\" and \"-\"", name)
+	}
+	dir, err := presetDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+func loadPreset(name string) (*Preset, error) {
+	path, err := presetPath(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if args, ok := builtinPresets[name]; ok {
+			return &Preset{Name: name, Args: args}, nil
+		}
+		return nil, fmt.Errorf("no preset %q (see \"preset list\")", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p Preset
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("invalid preset file %s: %v", path, err)
+	}
+	return &p, nil
+}
+
+func savePreset(p Preset, force bool) (string, error) {
+	path, err := presetPath(p.Name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil && !force {
+		return "", fmt.Errorf("preset %q already exists; use -force to overwrite it", p.Name)
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// quoteArgs joins args for display, quoting those a shell would split or
+// expand.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\"'<>|&;$*?()`") {
+			a = fmt.Sprintf("%q", a)
+		}
+		quoted[i] = a
+	}
+	return strings.Join(quoted, " ")
+}
+
+// preset runs a preset subcommand. For "preset run" it returns the options
+// to run the benchmark with; otherwise it returns nil and the exit status.
+func preset(args []string) ([]string, int) {
+	usageError := func(format string, a ...interface{}) ([]string, int) {
+		fmt.Printf("[ERROR] "+format+"\n", a...)
+		fmt.Println("Run with preset -h to see the usage")
+		return nil, exitUsage
+	}
+	fail := func(err error) ([]string, int) {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		return nil, exitFailure
+	}
+	if len(args) == 0 {
+		return usageError("a preset command is required: save, run, list, show or delete")
+	}
+	switch cmd, rest := args[0], args[1:]; cmd {
+	case "-h", "-help", "--help":
+		fmt.Println(presetUsageText)
+		return nil, exitOK
+	case "save":
+		force := len(rest) > 0 && (rest[0] == "-force" || rest[0] == "--force")
+		if force {
+			rest = rest[1:]
+		}
+		if len(rest) < 3 || rest[1] != "--" {
+			return usageError("usage: preset save [-force] <name> -- <options...>")
+		}
+		p := Preset{Name: rest[0], Args: rest[2:], Saved: time.Now().UTC()}
+		path, err := savePreset(p, force)
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Printf("Saved preset %s to %s\n", p.Name, path)
+		return nil, exitOK
+	case "run":
+		if len(rest) < 1 {
+			return usageError("usage: preset run <name> [options...]")
+		}
+		p, err := loadPreset(rest[0])
+		if err != nil {
+			return fail(err)
+		}
+		return append(append([]string{}, p.Args...), rest[1:]...), exitOK
+	case "show":
+		if len(rest) != 1 {
+			return usageError("usage: preset show <name>")
+		}
+		p, err := loadPreset(rest[0])
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Println(quoteArgs(p.Args))
+		return nil, exitOK
+	case "delete":
+		if len(rest) != 1 {
+			return usageError("usage: preset delete <name>")
+		}
+		path, err := presetPath(rest[0])
+		if err != nil {
+			return fail(err)
+		}
+		if err := os.Remove(path); err != nil {
+			if _, ok := builtinPresets[rest[0]]; ok && os.IsNotExist(err) {
+				return fail(fmt.Errorf("preset %q is built in and cannot be deleted", rest[0]))
+			}
+			if os.IsNotExist(err) {
+				return fail(fmt.Errorf("no preset %q (see \"preset list\")", rest[0]))
+			}
+			return fail(err)
+		}
+		fmt.Printf("Deleted preset %s\n", rest[0])
+		return nil, exitOK
+	case "list":
+		dir, err := presetDir()
+		if err != nil {
+			return fail(err)
+		}
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		sort.Strings(files)
+		saved := map[string]bool{}
+		for _, f := range files {
+			p, err := loadPreset(strings.TrimSuffix(filepath.Base(f), ".json"))
+			if err != nil {
+				fmt.Printf("[WARN] %s\n", err.Error())
+				continue
+			}
+			saved[p.Name] = true
+			fmt.Printf("%-30s %s\n", p.Name, quoteArgs(p.Args))
+		}
+		var builtins []string
+		for name := range builtinPresets {
+			if !saved[name] {
+				builtins = append(builtins, name)
+			}
+		}
+		sort.Strings(builtins)
+		for _, name := range builtins {
+			fmt.Printf("%-30s %s (built in)\n", name, quoteArgs(builtinPresets[name]))
+		}
+		return nil, exitOK
+	}
+	return usageError("unknown preset command %q: must be save, run, list, show or delete", args[0])
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// probeClientBound is the share of the target rate below which a step of
+// -probe-ceiling is limited by the sessions rather than by DynamoDB.
+const probeClientBound = 0.9
+
+// ProbeLevel is the outcome of one step of -probe-ceiling at a target rate.
+type ProbeLevel struct {
+	TargetRate        float64 `json:"target_rate"`
+	Requests          uint64  `json:"requests"`
+	Errors            uint64  `json:"errors"`
+	Throttles         uint64  `json:"throttles"`
+	RequestsPerSecond float64 `json:"requests_per_sec"`
+	// ThrottleRatio is the share of the attempts which were throttled.
+	ThrottleRatio float64 `json:"throttle_ratio"`
+	P99Ms         float64 `json:"p99_ms"`
+}
+
+// ServiceQuotas are the capacity quotas of the account and a table in the
+// region, from DescribeLimits, with the capacity of the table.
+type ServiceQuotas struct {
+	AccountMaxRead  int64
+	AccountMaxWrite int64
+	TableMaxRead    int64
+	TableMaxWrite   int64
+	Mode            string
+	// ProvisionedRead and ProvisionedWrite are the capacity of a
+	// provisioned table with its global secondary indexes, as of billing.
+	ProvisionedRead  int64
+	ProvisionedWrite int64
+	// Err is the failure of DescribeLimits, e.g. with DynamoDB Local.
+	Err error
+}
+
+// describeQuotas returns the quotas of the region and the billing of the
+// table; only a failure to describe the table is an error.
+func (c *DynamoDBBenchmark) describeQuotas(db *dynamodb.DynamoDB) (ServiceQuotas, error) {
+	var q ServiceQuotas
+	var err error
+	if _, q.Mode, q.ProvisionedRead, q.ProvisionedWrite, err = billing(db, c.TableName); err != nil {
+		return q, fmt.Errorf("failed to describe table %s: %v", c.TableName, err)
+	}
+	limits, err := db.DescribeLimits(&dynamodb.DescribeLimitsInput{})
+	if err != nil {
+		q.Err = err
+		return q, nil
+	}
+	q.AccountMaxRead = aws.Int64Value(limits.AccountMaxReadCapacityUnits)
+	q.AccountMaxWrite = aws.Int64Value(limits.AccountMaxWriteCapacityUnits)
+	q.TableMaxRead = aws.Int64Value(limits.TableMaxReadCapacityUnits)
+	q.TableMaxWrite = aws.Int64Value(limits.TableMaxWriteCapacityUnits)
+	return q, nil
+}
+
+// RunProbeLimits ramps the rate of the read or write workload from
+// -probe-start by -probe-factor every -probe-step, never above the safety
+// ceiling -probe-ceiling, until more than -probe-throttle-ratio of the
+// attempts of a step are throttled or the sessions cannot keep up, and
+// prints the highest rate sustained without throttling next to the quotas
+// of the account and the table.
+func (c *DynamoDBBenchmark) RunProbeLimits() error {
+	db, err := getDynamoDBClient(c.clientOptions())
+	if err != nil {
+		return err
+	}
+	quotas, err := c.describeQuotas(db)
+	if err != nil {
+		return err
+	}
+	if c.Reset {
+		if err := c.resetItem(); err != nil {
+			return err
+		}
+	}
+	c.health.SetReady()
+
+	var levels []ProbeLevel
+	stop := "safety ceiling reached"
+	for rate := c.ProbeStart; ; rate *= c.ProbeFactor {
+		if rate > c.ProbeCeiling {
+			rate = c.ProbeCeiling
+		}
+		if c.Verbose {
+			fmt.Printf("[Verbose] Probe: %.1f requests/sec\n", rate)
+		}
+		level := c.probeLevel(rate)
+		levels = append(levels, level)
+		if atomic.LoadInt32(c.stopped) != 0 {
+			stop = "stopped"
+			break
+		}
+		if level.ThrottleRatio > c.ProbeThrottleRatio {
+			stop = fmt.Sprintf("throttled (%.2f%% of the attempts)", 100*level.ThrottleRatio)
+			break
+		}
+		if level.RequestsPerSecond < probeClientBound*rate {
+			stop = fmt.Sprintf("client bound (%.1f of %.1f requests/sec, add sessions with -c)", level.RequestsPerSecond, rate)
+			break
+		}
+		if rate >= c.ProbeCeiling {
+			break
+		}
+	}
+	printProbeLimits(c.RunID, c.Action, c.ProbeStep, c.ProbeCeiling, c.ProbeThrottleRatio, quotas, levels, stop)
+	return nil
+}
+
+// probeLevel runs one step of the workload at rate with a fresh copy of the
+// benchmark.
+func (c *DynamoDBBenchmark) probeLevel(rate float64) ProbeLevel {
+	step := c.sweepStep(c.ProbeStep)
+	step.limiter = NewRateLimiter(rate)
+	level, _ := step.runLevel(c.Connections)
+	return ProbeLevel{
+		TargetRate:        rate,
+		Requests:          level.Requests,
+		Errors:            level.Errors,
+		Throttles:         level.Throttles,
+		RequestsPerSecond: level.RequestsPerSecond,
+		ThrottleRatio:     ratio(level.Throttles, level.Requests+level.Throttles),
+		P99Ms:             level.P99Ms,
+	}
+}
+
+func printProbeLimits(runID string, action string, step time.Duration, ceiling float64, maxRatio float64, q ServiceQuotas, levels []ProbeLevel, stop string) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Limit Probe - %s (%s per step, safety ceiling %.1f requests/sec)\n", action, step, ceiling)
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", runID)
+	if q.Mode == "provisioned" {
+		fmt.Printf("Table: provisioned, %d read and %d write capacity units\n", q.ProvisionedRead, q.ProvisionedWrite)
+	} else {
+		fmt.Printf("Table: %s\n", q.Mode)
+	}
+	if q.Err != nil {
+		fmt.Printf("Quotas: unknown (%s)\n", strings.SplitN(q.Err.Error(), "\n", 2)[0])
+	} else {
+		fmt.Printf("Quotas: account %d read / %d write capacity units, table %d read / %d write capacity units\n",
+			q.AccountMaxRead, q.AccountMaxWrite, q.TableMaxRead, q.TableMaxWrite)
+	}
+	fmt.Printf("%12s %10s %8s %10s %12s %10s %9s\n",
+		"target/s", "requests", "errors", "throttles", "requests/s", "throttled", "p99_ms")
+	var limit float64
+	for _, l := range levels {
+		fmt.Printf("%12.1f %10d %8d %10d %12.1f %9.2f%% %9.3f\n",
+			l.TargetRate, l.Requests, l.Errors, l.Throttles, l.RequestsPerSecond, 100*l.ThrottleRatio, l.P99Ms)
+		if l.ThrottleRatio <= maxRatio && l.RequestsPerSecond > limit {
+			limit = l.RequestsPerSecond
+		}
+	}
+	fmt.Printf("Stopped: %s\n", stop)
+	fmt.Printf("Practical limit: %.1f requests/sec without more than %.2f%% throttled\n", limit, 100*maxRatio)
+}
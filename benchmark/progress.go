@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	progressWidth    = 30
+	progressInterval = 500 * time.Millisecond
+)
+
+// stderrIsTerminal tells whether stderr is a terminal rather than a file or
+// pipe, which a progress bar would only clutter.
+func stderrIsTerminal() bool {
+	fi, err := os.Stderr.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Progress redraws a progress bar with the share of the calls started and
+// the estimated time remaining on one line of stderr.
+type Progress struct {
+	calls *uint64
+	total uint64
+	start time.Time
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewProgress follows calls, the counter of started calls, up to total.
+func NewProgress(calls *uint64, total int) *Progress {
+	return &Progress{
+		calls: calls,
+		total: uint64(total),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+func (p *Progress) Start() {
+	p.start = time.Now()
+	base := atomic.LoadUint64(p.calls)
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.draw(atomic.LoadUint64(p.calls) - base)
+			case <-p.stop:
+				p.draw(atomic.LoadUint64(p.calls) - base)
+				fmt.Fprintln(os.Stderr)
+				return
+			}
+		}
+	}()
+}
+
+// Stop draws the final state and ends the line.
+func (p *Progress) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+func (p *Progress) draw(calls uint64) {
+	if calls > p.total {
+		calls = p.total
+	}
+	share := float64(calls) / float64(p.total)
+	filled := int(share * progressWidth)
+	eta := "--"
+	if elapsed := time.Since(p.start); calls > 0 {
+		remaining := time.Duration(float64(elapsed) * float64(p.total-calls) / float64(calls))
+		eta = remaining.Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K[%s%s] %5.1f%% %d/%d calls, ETA %s",
+		strings.Repeat("#", filled), strings.Repeat(".", progressWidth-filled), share*100, calls, p.total, eta)
+}
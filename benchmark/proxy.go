@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"benchmark/internal/awsclient"
+)
+
+// envProxy returns the proxy of the standard environment variables the
+// transport honors without -proxy-url, "" if none is set.
+func envProxy() string {
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// proxyLabel describes the proxy of the run for the summary, with the
+// credentials of the URL masked.
+func (c *DynamoDBBenchmark) proxyLabel() string {
+	if c.ProxyURL != "" {
+		u, _ := awsclient.ParseProxyURL(c.ProxyURL)
+		return u.Redacted()
+	}
+	if u, err := url.Parse(envProxy()); err == nil && u.Host != "" {
+		return u.Redacted() + " (environment)"
+	}
+	return envProxy() + " (environment)"
+}
+
+// sessionDirect tells whether session id bypasses the proxy: with
+// -proxy-split the even sessions go direct.
+func (c *DynamoDBBenchmark) sessionDirect(id int) bool {
+	return c.ProxySplit && id%2 == 0
+}
+
+// ProxyGroup is the outcome of the proxied or the direct sessions of
+// -proxy-split.
+type ProxyGroup struct {
+	Sessions          int     `json:"sessions"`
+	Success           uint64  `json:"success"`
+	Errors            uint64  `json:"errors"`
+	RequestsPerSecond float64 `json:"requests_per_sec"`
+	AverageMs         float64 `json:"average_ms"`
+	P50Ms             float64 `json:"p50_ms"`
+	P99Ms             float64 `json:"p99_ms"`
+}
+
+// ProxySummary tells how many requests went through the proxy and, with
+// -proxy-split, how much latency it adds.
+type ProxySummary struct {
+	Proxy string `json:"proxy"`
+	// Proxied and Direct count HTTP requests, i.e. SDK retries count
+	// separately; requests to hosts in NO_PROXY go direct.
+	Proxied  uint64      `json:"proxied_requests"`
+	Direct   uint64      `json:"direct_requests"`
+	Via      *ProxyGroup `json:"via_proxy,omitempty"`
+	Bypassed *ProxyGroup `json:"direct,omitempty"`
+	// The taxes are the latencies of the proxied minus the direct sessions.
+	TaxAverageMs float64 `json:"tax_average_ms,omitempty"`
+	TaxP50Ms     float64 `json:"tax_p50_ms,omitempty"`
+	TaxP99Ms     float64 `json:"tax_p99_ms,omitempty"`
+}
+
+func (s *ProxySummary) Print() {
+	fmt.Printf("Proxy: %s, proxied requests: %d, direct requests: %d\n", s.Proxy, s.Proxied, s.Direct)
+	if s.Via == nil {
+		return
+	}
+	for _, g := range []struct {
+		name  string
+		group *ProxyGroup
+	}{{"via proxy", s.Via}, {"direct", s.Bypassed}} {
+		fmt.Printf("[%s] sessions: %d, success: %d, errors: %d, requests/sec: %.2f, average (ms): %.3f, p50 (ms): %.3f, p99 (ms): %.3f\n",
+			g.name, g.group.Sessions, g.group.Success, g.group.Errors, g.group.RequestsPerSecond, g.group.AverageMs, g.group.P50Ms, g.group.P99Ms)
+	}
+	fmt.Printf("Proxy latency tax (ms): average %+.3f, p50 %+.3f, p99 %+.3f\n", s.TaxAverageMs, s.TaxP50Ms, s.TaxP99Ms)
+}
+
+// ProxyStats counts per session the requests the transport routed through
+// a proxy. A nil *ProxyStats records nothing.
+type ProxyStats struct {
+	mu      sync.Mutex
+	workers map[int]*WorkerProxyStats
+}
+
+func NewProxyStats() *ProxyStats {
+	return &ProxyStats{workers: map[int]*WorkerProxyStats{}}
+}
+
+// Worker returns the counters of session id, nil on a nil *ProxyStats.
+func (s *ProxyStats) Worker(id int) *WorkerProxyStats {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workers[id]
+	if !ok {
+		w = &WorkerProxyStats{}
+		s.workers[id] = w
+	}
+	return w
+}
+
+// Proxied tells whether the last request of session id went through a
+// proxy, which flags the samples of the request log.
+func (s *ProxyStats) Proxied(id int) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	w := s.workers[id]
+	s.mu.Unlock()
+	return w != nil && atomic.LoadInt32(&w.last) != 0
+}
+
+// proxySummary adds the requests of all sessions up and, with -proxy-split,
+// compares the proxied with the direct sessions.
+func (c *DynamoDBBenchmark) proxySummary(stats *Stats) *ProxySummary {
+	s := c.proxies
+	if s == nil {
+		return nil
+	}
+	sum := &ProxySummary{Proxy: c.proxyLabel()}
+	s.mu.Lock()
+	for _, w := range s.workers {
+		sum.Proxied += atomic.LoadUint64(&w.proxied)
+		sum.Direct += atomic.LoadUint64(&w.direct)
+	}
+	s.mu.Unlock()
+	if !c.ProxySplit {
+		return sum
+	}
+	label := func(id int) string {
+		if c.sessionDirect(id) {
+			return "direct"
+		}
+		return "proxy"
+	}
+	groups := stats.GroupSummaries(c.Action, label)
+	group := func(name string, sessions int) *ProxyGroup {
+		g := groups[name]
+		pg := &ProxyGroup{
+			Sessions:          sessions,
+			Success:           g.Success,
+			Errors:            g.Errors,
+			RequestsPerSecond: g.RequestsPerSecond,
+			AverageMs:         g.AverageMs,
+		}
+		for _, op := range g.Operations {
+			if op.P50Ms > pg.P50Ms {
+				pg.P50Ms = op.P50Ms
+			}
+			if op.P99Ms > pg.P99Ms {
+				pg.P99Ms = op.P99Ms
+			}
+		}
+		return pg
+	}
+	sum.Via = group("proxy", (c.Connections+1)/2)
+	sum.Bypassed = group("direct", c.Connections/2)
+	sum.TaxAverageMs = sum.Via.AverageMs - sum.Bypassed.AverageMs
+	sum.TaxP50Ms = sum.Via.P50Ms - sum.Bypassed.P50Ms
+	sum.TaxP99Ms = sum.Via.P99Ms - sum.Bypassed.P99Ms
+	return sum
+}
+
+// WorkerProxyStats counts the requests of one session.
+type WorkerProxyStats struct {
+	proxied uint64
+	direct  uint64
+	last    int32
+}
+
+// WrapProxy returns the Proxy function of the transport which counts
+// whether proxy routed each request through a proxy.
+func (w *WorkerProxyStats) WrapProxy(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(r *http.Request) (*url.URL, error) {
+		var u *url.URL
+		var err error
+		if proxy != nil {
+			u, err = proxy(r)
+		}
+		if u != nil && err == nil {
+			atomic.AddUint64(&w.proxied, 1)
+			atomic.StoreInt32(&w.last, 1)
+		} else {
+			atomic.AddUint64(&w.direct, 1)
+			atomic.StoreInt32(&w.last, 0)
+		}
+		return u, err
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces requests of all workers evenly so that together they
+// send at most rate requests per second. A nil *RateLimiter or a rate of 0
+// does not limit.
+type RateLimiter struct {
+	mu       sync.Mutex
+	rate     float64
+	interval time.Duration
+	next     time.Time
+	// origin is the start of the schedule at the current rate and granted
+	// the requests let through since, for Behind.
+	origin  time.Time
+	granted uint64
+}
+
+func NewRateLimiter(rate float64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetRate(rate)
+	return l
+}
+
+// SetRate changes the rate, also while workers are waiting.
+func (l *RateLimiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+	l.origin = time.Time{}
+	l.granted = 0
+	l.interval = 0
+	if rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rate)
+	}
+}
+
+func (l *RateLimiter) Rate() float64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Wait blocks until the caller may send its next request.
+func (l *RateLimiter) Wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if l.interval == 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	if l.origin.IsZero() {
+		l.origin = now
+	}
+	l.granted++
+	// Do not let a slow period build up a burst of requests.
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	time.Sleep(wait)
+}
+
+// Behind returns how many requests the callers of Wait trail the schedule of
+// the rate at now, i.e. how far the generator fell behind it: 0 while it
+// keeps up or without a rate.
+func (l *RateLimiter) Behind(now time.Time) float64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.interval == 0 || l.origin.IsZero() {
+		return 0
+	}
+	behind := now.Sub(l.origin).Seconds()*l.rate - float64(l.granted)
+	if behind < 0 {
+		return 0
+	}
+	return behind
+}
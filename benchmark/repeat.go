@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// appendResultsHistory appends the summary as one line of JSON to the
+// -results-history file, so that repeated runs can be trended.
+func appendResultsHistory(path string, sum Summary) error {
+	b, err := json.Marshal(sum)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open results history: %v", err)
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write results history: %v", err)
+	}
+	return f.Close()
+}
+
+// RunRepeatedly starts the workload every -repeat-every, -repeat-count
+// times or until the process is stopped, each run with a fresh copy of the
+// benchmark and the run ID "<run id>-<n>". A failed run does not stop the
+// schedule; the error returned counts the failed runs.
+func (c *DynamoDBBenchmark) RunRepeatedly() error {
+	failed := 0
+	n := 1
+	for ; c.RepeatCount == 0 || n <= c.RepeatCount; n++ {
+		start := time.Now()
+		run := *c
+		run.RunID = fmt.Sprintf("%s-%d", c.RunID, n)
+		fmt.Printf("Run %d (%s) started at %s\n", n, run.RunID, formatTime(start, time.RFC3339))
+		if err := run.Run(); err != nil {
+			fmt.Printf("[ERROR] run %s: %s\n", run.RunID, err.Error())
+			failed++
+		}
+		if atomic.LoadInt32(c.stopped) != 0 || n == c.RepeatCount {
+			break
+		}
+		next := start.Add(c.RepeatEvery)
+		if wait := time.Until(next); wait > 0 {
+			fmt.Printf("Next run at %s\n", formatTime(next, time.RFC3339))
+			time.Sleep(wait)
+		} else {
+			fmt.Printf("[WARN] run %s took longer than -repeat-every %s; starting the next run now\n", run.RunID, c.RepeatEvery)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d runs failed", failed, n)
+	}
+	return nil
+}
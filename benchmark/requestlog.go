@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RequestLog writes every raw sample as a CSV line. It is only used when
+// -request-log is given since it grows with the number of requests.
+type RequestLog struct {
+	mu    sync.Mutex
+	file  *os.File
+	w     *csv.Writer
+	runID string
+	// proxied tells whether the last request of a worker went through a
+	// proxy.
+	proxied func(worker int) bool
+}
+
+func NewRequestLog(path string, runID string) (*RequestLog, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request log: %v", err)
+	}
+	l := &RequestLog{file: f, w: csv.NewWriter(f), runID: runID}
+	l.w.Write([]string{"timestamp", "worker", "operation", "latency_ms", "error", "run_id", "proxied"})
+	return l, nil
+}
+
+// SetProxied fills the proxied column with proxied, false if not set.
+func (l *RequestLog) SetProxied(proxied func(worker int) bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.proxied = proxied
+}
+
+func (l *RequestLog) Write(worker int, op string, start time.Time, latency time.Duration, err error) {
+	errText := ""
+	if err != nil {
+		errText = err.Error()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	proxied := l.proxied != nil && l.proxied(worker)
+	l.w.Write([]string{
+		formatTime(start, time.RFC3339Nano),
+		strconv.Itoa(worker),
+		op,
+		strconv.FormatFloat(durationMs(latency), 'f', 3, 64),
+		errText,
+		l.runID,
+		strconv.FormatBool(proxied),
+	})
+}
+
+func (l *RequestLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Flush()
+	if err := l.w.Error(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
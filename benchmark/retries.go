@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// retryBuckets is the length of the retries-per-success distribution: the
+// successes after 0 ... retryBuckets-2 retries, and after more.
+const retryBuckets = 6
+
+// AttemptCounter counts the HTTP attempts the client of one session sent,
+// SDK retries and the retries of -r included. A nil *AttemptCounter counts
+// nothing.
+type AttemptCounter struct {
+	n     uint64
+	polls uint64
+}
+
+// attemptsKey is the context key of the AttemptCounter of one call.
+type attemptsKey struct{}
+
+// withAttempts returns a context whose requests are counted by a rather
+// than by the counter of the session, so that the calls a session has in
+// flight at a time with -pipeline-depth each count their own attempts.
+func withAttempts(ctx aws.Context, a *AttemptCounter) aws.Context {
+	return context.WithValue(ctx, attemptsKey{}, a)
+}
+
+// handler returns the SDK Send handler which counts the attempts, to the
+// counter of the call in the request context if there is one.
+func (a *AttemptCounter) handler() request.NamedHandler {
+	return request.NamedHandler{Name: "dynamodb-benchmark.AttemptCounter", Fn: func(r *request.Request) {
+		counter := a
+		if call, ok := r.Context().Value(attemptsKey{}).(*AttemptCounter); ok && call != nil {
+			counter = call
+		}
+		atomic.AddUint64(&counter.n, 1)
+	}}
+}
+
+// Poll counts one call of the operation under way which is not a retry but
+// a step of it, like a GetItem of pipeline polling for the derived item.
+func (a *AttemptCounter) Poll() {
+	if a != nil {
+		atomic.AddUint64(&a.polls, 1)
+	}
+}
+
+// take returns the attempts and the polls since the last call, false on a
+// nil *AttemptCounter.
+func (a *AttemptCounter) take() (uint64, uint64, bool) {
+	if a == nil {
+		return 0, 0, false
+	}
+	return atomic.SwapUint64(&a.n, 0), atomic.SwapUint64(&a.polls, 0), true
+}
+
+// retryStats accumulates the attempts behind the logical operations of one
+// kind.
+type retryStats struct {
+	attempts  uint64
+	polls     uint64
+	successes [retryBuckets]uint64
+}
+
+func (r *retryStats) record(attempts uint64, polls uint64, err error) {
+	r.attempts += attempts
+	r.polls += polls
+	// The polls are counted with the attempts of the same call, but a poll
+	// the SDK rejected before sending it, e.g. an invalid key, is not an
+	// attempt and must not make the count underflow.
+	if err != nil || polls >= attempts {
+		return
+	}
+	retries := int(attempts - polls - 1)
+	if retries >= retryBuckets {
+		retries = retryBuckets - 1
+	}
+	r.successes[retries]++
+}
+
+func (r *retryStats) merge(other *retryStats) {
+	r.attempts += other.attempts
+	r.polls += other.polls
+	for i, n := range other.successes {
+		r.successes[i] += n
+	}
+}
+
+// summary returns the retries of operations logical operations, nil on a
+// nil *retryStats.
+func (r *retryStats) summary(operations uint64) *RetrySummary {
+	if r == nil {
+		return nil
+	}
+	sum := &RetrySummary{
+		Attempts:          r.attempts,
+		Polls:             r.polls,
+		RetriesPerSuccess: append([]uint64(nil), r.successes[:]...),
+	}
+	if r.attempts > operations+r.polls {
+		sum.Retries = r.attempts - operations - r.polls
+	}
+	sum.AttemptsPerOperation = ratio(r.attempts, operations)
+	return sum
+}
+
+// RetrySummary separates the API attempts from the logical operations, so a
+// success after retries, i.e. under capacity pressure, stands out from a
+// first-try success.
+type RetrySummary struct {
+	// Attempts counts the HTTP requests sent, Retries the ones beyond the
+	// first of each operation and its polls.
+	Attempts uint64 `json:"attempts"`
+	Retries  uint64 `json:"retries"`
+	// Polls counts the calls which are steps of an operation rather than
+	// retries, e.g. the GetItem calls of pipeline until the derived item
+	// appears.
+	Polls                uint64  `json:"polls,omitempty"`
+	AttemptsPerOperation float64 `json:"attempts_per_operation"`
+	// RetriesPerSuccess[i] counts the successes after i retries, the last
+	// one after that many or more.
+	RetriesPerSuccess []uint64 `json:"retries_per_success"`
+}
+
+// add merges other into r, for MergeSummaries; operations are the logical
+// operations of both.
+func (r *RetrySummary) add(other *RetrySummary, operations uint64) {
+	r.Attempts += other.Attempts
+	r.Retries += other.Retries
+	r.Polls += other.Polls
+	r.AttemptsPerOperation = ratio(r.Attempts, operations)
+	if r.RetriesPerSuccess == nil {
+		r.RetriesPerSuccess = make([]uint64, len(other.RetriesPerSuccess))
+	}
+	for i := range other.RetriesPerSuccess {
+		if i < len(r.RetriesPerSuccess) {
+			r.RetriesPerSuccess[i] += other.RetriesPerSuccess[i]
+		}
+	}
+}
+
+func (r *RetrySummary) String() string {
+	labels := make([]string, len(r.RetriesPerSuccess))
+	counts := make([]string, len(r.RetriesPerSuccess))
+	for i, n := range r.RetriesPerSuccess {
+		labels[i] = strconv.Itoa(i)
+		counts[i] = strconv.FormatUint(n, 10)
+	}
+	if len(labels) > 0 {
+		labels[len(labels)-1] += "+"
+	}
+	polls := ""
+	if r.Polls > 0 {
+		polls = fmt.Sprintf(", %d polls", r.Polls)
+	}
+	return fmt.Sprintf("%d (%.2f per operation, %d retries%s), successes after %s retries: %s",
+		r.Attempts, r.AttemptsPerOperation, r.Retries, polls, strings.Join(labels, "/"), strings.Join(counts, "/"))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// The polls of an operation, e.g. of pipeline, are not retries.
+func TestRetriesWithoutPolls(t *testing.T) {
+	s := NewStats()
+	s.Start()
+	w := s.Worker(1)
+	a := w.Attempts()
+	start := time.Now()
+
+	// A write and three polls, the second one throttled once.
+	a.n = 5
+	for i := 0; i < 3; i++ {
+		a.Poll()
+	}
+	w.Record("Pipeline", start, time.Millisecond, 1, nil)
+	// A write and a poll.
+	a.n = 2
+	a.Poll()
+	w.Record("Pipeline", start, time.Millisecond, 1, nil)
+	s.Stop()
+
+	r := s.Summary("pipeline").Operations[0].Retries
+	if r.Attempts != 7 || r.Polls != 4 || r.Retries != 1 {
+		t.Errorf("attempts %d, polls %d, retries %d; want 7, 4 and 1", r.Attempts, r.Polls, r.Retries)
+	}
+	if r.RetriesPerSuccess[0] != 1 || r.RetriesPerSuccess[1] != 1 {
+		t.Errorf("successes after 0/1 retries: %d/%d; want 1/1", r.RetriesPerSuccess[0], r.RetriesPerSuccess[1])
+	}
+}
+
+// The calls a session has in flight with -pipeline-depth each count their
+// own attempts, so the retries add up with the successes after retries.
+func TestRetriesPipelined(t *testing.T) {
+	c := &DynamoDBBenchmark{TableName: "retries-pipelined", Id: "pipelined", Action: "read", EndpointUrl: fakeEndpoint,
+		Connections: 1, NumCalls: 40, PipelineDepth: 8, RetryNum: 1}
+	c.clock = NewClock()
+	c.stopped, c.calls = new(int32), new(uint64)
+	setFakeFaults(t, "latency=fixed:5ms,throttle=0.1,seed=3")
+
+	stats := NewStats()
+	stats.Start()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	c.runWorker(1, &wg, stats.Worker(1), c.newReadOperation)
+	stats.Stop()
+
+	op := stats.Summary("read").Operations[0]
+	r := op.Retries
+	if op.Success+op.Errors != 40 || r == nil {
+		t.Fatalf("%d calls, retries %v; want 40 counted calls", op.Success+op.Errors, r)
+	}
+	if r.Attempts != op.Success+op.Errors+r.Retries {
+		t.Errorf("attempts %d; want the %d calls and their %d retries", r.Attempts, op.Success+op.Errors, r.Retries)
+	}
+	var successes, retried uint64
+	for i, n := range r.RetriesPerSuccess {
+		successes += n
+		retried += uint64(i) * n
+	}
+	if successes != op.Success {
+		t.Errorf("successes after retries add up to %d; want %d", successes, op.Success)
+	}
+	// The last bucket counts that many retries or more.
+	if retried > r.Retries || r.Retries == 0 {
+		t.Errorf("%d retries, but the successes took at least %d", r.Retries, retried)
+	}
+}
+
+// A call with more polls than attempts, e.g. polls rejected before they were
+// sent, must neither underflow nor count as a success after retries.
+func TestRetriesPollsWithoutAttempts(t *testing.T) {
+	var r retryStats
+	r.record(1, 2, nil)
+	sum := r.summary(1)
+	if sum.Retries != 0 || sum.Polls != 2 {
+		t.Errorf("retries %d, polls %d; want 0 and 2", sum.Retries, sum.Polls)
+	}
+	for i, n := range sum.RetriesPerSuccess {
+		if n != 0 {
+			t.Errorf("%d successes after %d retries; want none", n, i)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Run runs the read, write, session, timeseries, item-collection, mix, sk-query and pipeline
+// actions (and -pools): it sets up the instruments the options ask for,
+// starts -c sessions, waits for them and sends the summary to the sinks. The
+// other actions and modes have Run* functions of their own.
+func (c *DynamoDBBenchmark) Run() (err error) {
+	var result *Summary
+	// Registered first so that the sinks, e.g. s3, run after the output
+	// files are closed.
+	defer func() {
+		if result == nil {
+			return
+		}
+		if serr := writeSinks(c.resultSinks(), *result); serr != nil {
+			if err != nil {
+				fmt.Printf("[ERROR] %v\n", serr)
+				return
+			}
+			err = serr
+		}
+	}()
+
+	c.clock = NewClock()
+	if c.SkewReference != "" {
+		skew, err := EstimateSkew(c.SkewReference, 5)
+		if err != nil {
+			return err
+		}
+		c.clock.SetSkew(skew)
+		if c.Verbose {
+			fmt.Printf("[Verbose] Estimated clock skew: %s\n", skew)
+		}
+	}
+
+	if c.CacheTTL > 0 {
+		c.cache = NewReadCache(c.CacheTTL, c.CacheSize)
+	}
+	if c.PayloadFile != "" {
+		if c.compression, err = c.newCompression(); err != nil {
+			return err
+		}
+	}
+	if c.OptimisticLock != "" {
+		c.lock = NewOptimisticLock(c.OptimisticLock, c.VersionAttribute)
+	}
+	if c.ItemCollectionMetrics || c.Action == "item-collection" {
+		c.collectionSizes = NewCollectionSizes()
+	}
+	if c.Shards != "" {
+		levels, _ := parseShardLevels(c.Shards)
+		c.shards = NewShards(levels[0], c.ShardSuffix)
+	}
+	if c.Action == "session" {
+		c.sessionStats = NewSessionStats(c.Sessions)
+		c.trackResource(Resource{Kind: resourceItems, Table: c.TableName, Name: c.Id + "-session", Count: c.Sessions})
+		if c.Reset {
+			if err := c.seedSessions(); err != nil {
+				return err
+			}
+		}
+	} else if c.Action == "timeseries" {
+		db, err := getDynamoDBClient(c.clientOptions())
+		if err != nil {
+			return err
+		}
+		if err := c.checkSortKeyTable(db, "timeseries", timeSeriesSortKey, dynamodb.ScalarAttributeTypeN); err != nil {
+			return err
+		}
+		c.series = NewTimeSeries(c.Partitions)
+		c.trackResource(Resource{Kind: resourcePartitions, Table: c.TableName, Name: c.timeSeriesPartitions(), Count: c.Partitions, SortKey: timeSeriesSortKey})
+		if err := c.prefillTimeSeries(db); err != nil {
+			return err
+		}
+	} else if c.Action == "pipeline" {
+		c.pipeline = NewPipelineStats()
+	} else if c.Action == "sk-query" {
+		db, err := getDynamoDBClient(c.clientOptions())
+		if err != nil {
+			return err
+		}
+		if err := c.checkSortKeyTable(db, "sk-query", skQuerySortKey, dynamodb.ScalarAttributeTypeS); err != nil {
+			return err
+		}
+		if c.Reset {
+			c.trackResource(Resource{Kind: resourcePartitions, Table: c.TableName, Name: c.skQueryPartitions(), Count: c.Partitions, SortKey: skQuerySortKey})
+			if err := c.seedSKQuery(db); err != nil {
+				return err
+			}
+		}
+	} else if c.Action == "item-collection" {
+		db, err := getDynamoDBClient(c.clientOptions())
+		if err != nil {
+			return err
+		}
+		lsi, _ := parseCollectionLSI(c.LSI)
+		if err := c.checkCollectionTable(db, lsi); err != nil {
+			return err
+		}
+		c.itemCollections = NewItemCollections(c.Collections)
+		c.trackResource(Resource{Kind: resourcePartitions, Table: c.TableName, Name: c.collectionPrefix(), Count: c.Collections, SortKey: collectionSortKey})
+	} else if c.Reset && c.Pools != "" {
+		if err := c.resetPools(); err != nil {
+			return err
+		}
+	} else if c.Reset {
+		if err := c.resetItem(); err != nil {
+			return err
+		}
+	}
+
+	assertions, err := ParseAssertions(c.Assert)
+	if err != nil {
+		return err
+	}
+	var initial map[string]*dynamodb.AttributeValue
+	needInitial := c.CheckLinearizability
+	for _, a := range assertions {
+		needInitial = needInitial || a.usesInitial()
+	}
+	if needInitial {
+		if initial, err = c.readItem(); err != nil {
+			return err
+		}
+	}
+	var initialAge int64
+	if c.CheckLinearizability {
+		age := ageValue(initial)
+		if age == nil {
+			return fmt.Errorf("-check-linearizability needs a numeric \"age\" attribute on item %q", c.Id)
+		}
+		initialAge = *age
+	}
+
+	if c.Rate > 0 || c.ControlAddr != "" {
+		c.limiter = NewRateLimiter(c.Rate)
+	}
+	calibration := c.hostCalibration()
+	warnRate(calibration, "-rate", c.Rate)
+	if c.Rate > 0 || c.PipelineDepth > 1 || c.BackpressureReport != "" {
+		c.backpressure = NewBackpressure(c.limiter, time.Second)
+		c.backpressure.Start()
+	}
+
+	stats := NewStats()
+	if c.AbortOnErrorRate > 0 {
+		c.breaker = NewCircuitBreaker(c.AbortOnErrorRate, c.ErrorRateWindow, c.ErrorRateMinSamples, c.ErrorRatePause)
+		stats.SetCircuitBreaker(c.breaker)
+	}
+	stats.Start()
+	monitor := NewRuntimeMonitor(time.Second)
+	monitor.Start()
+	if c.Duration > 0 {
+		c.deadline = time.Now().Add(c.Duration)
+	}
+
+	if (c.ProxyURL != "" || envProxy() != "") && c.EndpointUrl != fakeEndpoint {
+		c.proxies = NewProxyStats()
+	}
+	if c.RequestLog != "" {
+		log, err := NewRequestLog(c.RequestLog, c.RunID)
+		if err != nil {
+			return err
+		}
+		log.SetProxied(c.proxies.Proxied)
+		defer func() {
+			if err := log.Close(); err != nil {
+				fmt.Printf("Error: failed to write request log: %v\n", err)
+			}
+		}()
+		stats.SetRequestLog(log)
+	}
+
+	if c.ContentionReport != "" {
+		c.contention = NewContentionTracker(c.clock.Now(), c.ContentionBucket)
+	}
+
+	if c.Timeline != "" || c.BackupAt > 0 || c.AddIndexAt > 0 || c.ShiftHotkey > 0 || c.StepAt > 0 {
+		c.timeline = NewTimeline(time.Now(), c.TimelineBucket)
+		stats.SetTimeline(c.timeline)
+	}
+	if c.VictimPool != "" {
+		c.isolation = NewTimeline(time.Now(), c.TimelineBucket)
+		stats.SetIsolation(c.isolation, func(id int) bool { return c.poolName(id) == c.VictimPool })
+	}
+	var errorSamples *ErrorSamples
+	if c.ErrorSamples > 0 {
+		errorSamples = NewErrorSamples(time.Now(), c.ErrorSamples)
+		stats.SetErrorSamples(errorSamples)
+	}
+	if c.PartitionEstimate {
+		c.partitions = NewPartitionEstimator(time.Now())
+		stats.SetPartitionEstimator(c.partitions)
+	}
+	c.shiftStart = time.Now()
+	var backup *EventMonitor
+	if c.BackupAt > 0 {
+		db, err := getDynamoDBClient(c.clientOptions())
+		if err != nil {
+			return err
+		}
+		backup = c.backupMonitor(db, c.timeline)
+		backup.Start()
+	}
+	var scaling *ScalingMonitor
+	if c.StepAt > 0 {
+		db, err := getDynamoDBClient(c.clientOptions())
+		if err != nil {
+			return err
+		}
+		scaling = c.scalingMonitor(db, c.timeline)
+		if err := scaling.Start(); err != nil {
+			return err
+		}
+	}
+	var indexBuild *EventMonitor
+	if c.AddIndexAt > 0 {
+		db, err := getDynamoDBClient(c.clientOptions())
+		if err != nil {
+			return err
+		}
+		indexBuild = c.addIndexMonitor(db, c.timeline)
+		indexBuild.Start()
+	}
+
+	if c.ConnStats {
+		c.conns = NewConnStats()
+	}
+	if c.LatencyBreakdown {
+		c.breakdown = NewLatencyBreakdown()
+	}
+
+	if c.HistoryFile != "" || c.CheckLinearizability {
+		history, err := NewHistory(c.HistoryFile, c.HistoryFormat, c.clock, c.CheckLinearizability)
+		if err != nil {
+			return err
+		}
+		c.history = history
+		defer func() {
+			if err := history.Close(); err != nil {
+				fmt.Printf("Error: failed to write history: %v\n", err)
+			}
+		}()
+	}
+
+	if c.ControlAddr != "" {
+		control, err := NewController(c.ControlAddr, c.Action, c.RunID, c.limiter, stats)
+		if err != nil {
+			return err
+		}
+		c.control = control
+		defer control.Stop()
+		if c.Verbose {
+			fmt.Printf("[Verbose] Control API listening on %s\n", c.ControlAddr)
+		}
+	}
+
+	var checkpointer *Checkpointer
+	if c.CheckpointFile != "" {
+		cp, err := NewCheckpointer(c.CheckpointFile, c.CheckpointInterval, c.Action, c.RunID, stats, c.clock, c.Verbose)
+		if err != nil {
+			return err
+		}
+		checkpointer = cp
+		checkpointer.Start()
+	}
+	if c.StreamResults > 0 {
+		checkpointer = NewResultStream(c.resultStream, c.StreamResults, c.Action, c.RunID, stats, c.clock)
+		checkpointer.Start()
+	}
+
+	var dashboard *Dashboard
+	if c.TUI {
+		dashboard = NewDashboard(stats, c.Action, c.RunID)
+		dashboard.Start()
+	}
+
+	if c.K8sFriendly {
+		stop := c.stopOnSignal()
+		defer stop()
+	}
+
+	pools, runs, err := c.poolWorkers()
+	if err != nil {
+		return err
+	}
+	var progress *Progress
+	if c.Duration == 0 && !c.TUI && stderrIsTerminal() {
+		total := 0
+		for i := 1; i <= c.Connections; i++ {
+			if len(pools) > 0 {
+				total += runs[i-1].sessionCalls(i)
+			} else {
+				total += c.sessionCalls(i)
+			}
+		}
+		progress = NewProgress(c.calls, total)
+		progress.Start()
+	}
+	var wg sync.WaitGroup
+	for i := 1; i <= c.Connections; i++ {
+		wg.Add(1)
+		w, action := c, c.Action
+		if len(pools) > 0 {
+			w, action = runs[i-1], pools[i-1].Action
+		}
+		switch action {
+		case "read":
+			if w.shards != nil {
+				go w.startShardReadWorker(i, &wg, stats.Worker(i))
+			} else {
+				go w.startReadWorker(i, &wg, stats.Worker(i))
+			}
+		case "scan":
+			go w.startScanWorker(i, &wg, stats.Worker(i))
+		case "session":
+			go w.startSessionWorker(i, &wg, stats.Worker(i))
+		case "timeseries":
+			go w.startTimeSeriesWorker(i, &wg, stats.Worker(i))
+		case "item-collection":
+			go w.startCollectionWorker(i, &wg, stats.Worker(i))
+		case "mix":
+			go w.startMixWorker(i, &wg, stats.Worker(i))
+		case "sk-query":
+			go w.startSKQueryWorker(i, &wg, stats.Worker(i))
+		case "pipeline":
+			go w.startPipelineWorker(i, &wg, stats.Worker(i))
+		default:
+			go w.startWriteWorker(i, &wg, stats.Worker(i))
+		}
+	}
+	c.health.SetReady()
+	wg.Wait()
+	stats.Stop()
+	if progress != nil {
+		progress.Stop()
+	}
+	runtimeSummary := monitor.Stop()
+	backpressureSummary := c.backpressure.Stop()
+	backupSummary := backup.Stop()
+	indexSummary := indexBuild.Stop()
+	scalingSummary := scaling.Stop()
+	if dashboard != nil {
+		dashboard.Stop()
+	}
+
+	if checkpointer != nil {
+		if err := checkpointer.Stop(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+
+	summary := stats.Summary(c.Action)
+	summary.RunID = c.RunID
+	summary.ClockSkew = c.clock.skew
+	summary.CircuitBreaker = c.breaker.Trips()
+	summary.ErrorSamples = errorSamples.Summary()
+	summary.Contention = c.contention.Summary()
+	summary.Runtime = runtimeSummary
+	summary.Backpressure = backpressureSummary
+	summary.Roles = c.roleSummaries(stats)
+	summary.Pools = c.poolSummaries(stats)
+	summary.Connections = c.conns.Summary()
+	summary.Proxy = c.proxySummary(stats)
+	summary.Phases = c.breakdown.Summary()
+	summary.Backup = backupSummary
+	summary.IndexBuild = indexSummary
+	summary.Scaling = scalingSummary
+	summary.Session = c.sessionStats.Summary()
+	summary.TimeSeries = c.series.Summary(summary.DurationSec)
+	summary.ItemCollection = c.itemCollections.Summary(summary.DurationSec)
+	summary.ItemCollectionSizes = c.collectionSizes.Summary()
+	summary.Sharding = c.shards.Summary(summary.DurationSec)
+	summary.Partitions = c.partitions.Summary(time.Now())
+	summary.Cache = c.cache.Summary(summary.Operations)
+	summary.Compression = c.compression.Summary()
+	summary.OptimisticLock = c.lock.Summary()
+	summary.Pipeline = c.pipeline.Summary()
+	summary.Isolation = c.isolationSummary(c.isolation)
+	summary.Mix = c.mixShares(summary)
+	if c.ShiftHotkey > 0 {
+		summary.HotKeyShifts = c.hotKeyShifts(c.timeline)
+	}
+	if c.Rate == 0 {
+		warnRate(calibration, "The achieved throughput of", summary.RequestsPerSecond)
+	}
+	if c.contention != nil {
+		if err := c.contention.WriteCSV(c.ContentionReport, c.RunID); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+	if c.Timeline != "" {
+		if err := c.timeline.WriteCSV(c.Timeline, c.RunID); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+	if c.BackpressureReport != "" {
+		if err := backpressureSummary.WriteCSV(c.BackpressureReport, c.RunID); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+	failed := 0
+	if len(assertions) > 0 {
+		item, err := c.readItem()
+		for _, a := range assertions {
+			var r AssertionResult
+			if err != nil {
+				r = AssertionResult{Assertion: a.Text, Actual: err.Error()}
+			} else {
+				r = a.Check(item, initial, summary)
+			}
+			if !r.Passed {
+				failed++
+			}
+			summary.Assertions = append(summary.Assertions, r)
+		}
+	}
+	if c.CheckLinearizability {
+		r := CheckLinearizability(c.history.Events(), initialAge, c.LinearizabilityTimeout)
+		summary.Linearizability = &r
+	}
+	slos, _ := ParseSLOs(c.SLO)
+	missed := 0
+	for _, slo := range slos {
+		r := slo.Check(summary)
+		if !r.Passed {
+			missed++
+		}
+		summary.SLOs = append(summary.SLOs, r)
+	}
+	if c.K8sFriendly {
+		summary.IncludeHistograms()
+	}
+	result = &summary
+	if atomic.LoadInt32(c.stopped) != 0 {
+		return fmt.Errorf("terminated by signal before the run completed")
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d assertions failed", failed, len(assertions))
+	}
+	if summary.Linearizability != nil && summary.Linearizability.Result == "illegal" {
+		return fmt.Errorf("history is not linearizable")
+	}
+	if missed > 0 {
+		return fmt.Errorf("%d of %d SLOs missed", missed, len(slos))
+	}
+	return nil
+}
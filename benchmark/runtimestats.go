@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// cpuBoundThreshold is the fraction of the available cores above which the
+// benchmark process itself is considered the bottleneck.
+const cpuBoundThreshold = 0.8
+
+// RuntimeSummary describes the load of the benchmark process during the run.
+type RuntimeSummary struct {
+	GOMAXPROCS    int     `json:"gomaxprocs"`
+	GCCount       uint32  `json:"gc_count"`
+	GCPauseMs     float64 `json:"gc_pause_total_ms"`
+	GCCPUFraction float64 `json:"gc_cpu_fraction"`
+	HeapAllocMax  uint64  `json:"heap_alloc_max_bytes"`
+	HeapSysMax    uint64  `json:"heap_sys_max_bytes"`
+	GoroutinesMax int     `json:"goroutines_max"`
+	// CPUSeconds is the user and system CPU time of the process, and
+	// CPUUtilization that time relative to GOMAXPROCS cores over the run
+	// (CPUPeak over the busiest sampling interval). Both are 0 where the
+	// platform does not report it.
+	CPUSeconds     float64 `json:"cpu_sec"`
+	CPUUtilization float64 `json:"cpu_utilization"`
+	CPUPeak        float64 `json:"cpu_peak_utilization"`
+	Warning        string  `json:"warning,omitempty"`
+}
+
+// RuntimeMonitor samples the Go runtime and the process CPU time at a fixed
+// interval while the benchmark runs. A nil *RuntimeMonitor records nothing.
+type RuntimeMonitor struct {
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+
+	mu         sync.Mutex
+	start      time.Time
+	startMem   runtime.MemStats
+	startCPU   time.Duration
+	lastSample time.Time
+	lastCPU    time.Duration
+	sum        RuntimeSummary
+}
+
+func NewRuntimeMonitor(interval time.Duration) *RuntimeMonitor {
+	return &RuntimeMonitor{
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start takes the baseline and a first sample, so that runs shorter than
+// the interval still report the heap and goroutines, and starts sampling.
+func (m *RuntimeMonitor) Start() {
+	if m == nil {
+		return
+	}
+	m.start = time.Now()
+	m.lastSample = m.start
+	runtime.ReadMemStats(&m.startMem)
+	m.startCPU, _ = processCPUTime()
+	m.lastCPU = m.startCPU
+	m.sum.GOMAXPROCS = runtime.GOMAXPROCS(0)
+	m.sample()
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.sample()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (m *RuntimeMonitor) sample() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	if mem.HeapAlloc > m.sum.HeapAllocMax {
+		m.sum.HeapAllocMax = mem.HeapAlloc
+	}
+	if mem.HeapSys > m.sum.HeapSysMax {
+		m.sum.HeapSysMax = mem.HeapSys
+	}
+	if n := runtime.NumGoroutine(); n > m.sum.GoroutinesMax {
+		m.sum.GoroutinesMax = n
+	}
+	m.sum.GCCount = mem.NumGC - m.startMem.NumGC
+	m.sum.GCPauseMs = durationMs(time.Duration(mem.PauseTotalNs - m.startMem.PauseTotalNs))
+	m.sum.GCCPUFraction = mem.GCCPUFraction
+
+	if cpu, ok := processCPUTime(); ok {
+		cores := float64(m.sum.GOMAXPROCS)
+		if elapsed := now.Sub(m.lastSample); elapsed > 0 {
+			if u := float64(cpu-m.lastCPU) / float64(elapsed) / cores; u > m.sum.CPUPeak {
+				m.sum.CPUPeak = u
+			}
+		}
+		m.sum.CPUSeconds = (cpu - m.startCPU).Seconds()
+		if elapsed := now.Sub(m.start); elapsed > 0 {
+			m.sum.CPUUtilization = float64(cpu-m.startCPU) / float64(elapsed) / cores
+		}
+		m.lastCPU = cpu
+	}
+	m.lastSample = now
+}
+
+// Stop takes a last sample and returns the summary of the run, with a
+// warning if the process was CPU-bound. Runs shorter than a few sampling
+// intervals get no warning, their utilization is mostly startup cost.
+func (m *RuntimeMonitor) Stop() *RuntimeSummary {
+	if m == nil {
+		return nil
+	}
+	close(m.stop)
+	<-m.done
+	m.sample()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sum := m.sum
+	if time.Since(m.start) < 5*m.interval {
+		return &sum
+	}
+	switch {
+	case sum.CPUUtilization >= cpuBoundThreshold:
+		sum.Warning = fmt.Sprintf("the benchmark used %.0f%% of %d cores on average; it is probably CPU-bound and the latencies include client-side queueing, use fewer sessions per process or more processes",
+			sum.CPUUtilization*100, sum.GOMAXPROCS)
+	case sum.CPUPeak >= cpuBoundThreshold:
+		sum.Warning = fmt.Sprintf("the benchmark used up to %.0f%% of %d cores; latencies measured at the peak may include client-side queueing",
+			sum.CPUPeak*100, sum.GOMAXPROCS)
+	}
+	return &sum
+}
+
+func (r *RuntimeSummary) String() string {
+	return fmt.Sprintf("CPU %.1fs (%.0f%% of %d cores, peak %.0f%%), %d GCs (pauses %.3f ms, %.2f%% CPU), max heap %.1f MiB, max goroutines %d",
+		r.CPUSeconds, r.CPUUtilization*100, r.GOMAXPROCS, r.CPUPeak*100, r.GCCount, r.GCPauseMs, r.GCCPUFraction*100,
+		float64(r.HeapAllocMax)/(1<<20), r.GoroutinesMax)
+}
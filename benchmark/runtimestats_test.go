@@ -0,0 +1,39 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Start and Stop both sample, so a run shorter than the interval is still
+// measured.
+func TestRuntimeMonitorSamplesAtStartAndStop(t *testing.T) {
+	m := NewRuntimeMonitor(time.Hour)
+	m.Start()
+	m.mu.Lock()
+	started := m.sum
+	m.mu.Unlock()
+	if started.HeapAllocMax == 0 || started.GoroutinesMax == 0 {
+		t.Errorf("no sample at the start: %+v", started)
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-done
+		}()
+	}
+	// Less the sampling goroutine of m, which has exited by the last sample.
+	running := runtime.NumGoroutine() - 1
+	sum := m.Stop()
+	close(done)
+	wg.Wait()
+	if sum.GoroutinesMax < running {
+		t.Errorf("max goroutines %d; want the %d running at the stop", sum.GoroutinesMax, running)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import "time"
+
+// processCPUTime is not implemented on this platform.
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// parseS3URI splits "s3://bucket/prefix" into the bucket and the key prefix
+// without leading or trailing slashes.
+func parseS3URI(uri string) (string, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("%q must be an S3 URI like s3://bucket/prefix", uri)
+	}
+	return u.Host, strings.Trim(u.Path, "/"), nil
+}
+
+func contentType(name string) string {
+	switch filepath.Ext(name) {
+	case ".json", ".jsonl", ".ndjson":
+		return "application/json"
+	case ".csv":
+		return "text/csv"
+	case ".edn":
+		return "application/edn"
+	}
+	return "application/octet-stream"
+}
+
+// uploadResults uploads the summary as a single line of JSON (so that Athena
+// can read it with the JSON SerDe) and the output files that were written to
+// <uri>/<run id>/, where uri is s3://bucket/prefix. Files that were not
+// written are skipped.
+func (c *DynamoDBBenchmark) uploadResults(uri string, sum Summary) error {
+	bucket, prefix, err := parseS3URI(uri)
+	if err != nil {
+		return err
+	}
+	sess, err := newSession(ClientOptions{RunID: c.RunID})
+	if err != nil {
+		return err
+	}
+	uploader := s3manager.NewUploader(sess)
+	key := func(name string) string {
+		return path.Join(prefix, c.RunID, name)
+	}
+
+	b, err := json.Marshal(sum)
+	if err != nil {
+		return err
+	}
+	uploads := []*s3manager.UploadInput{{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key("summary.json")),
+		Body:        bytes.NewReader(append(b, '\n')),
+		ContentType: aws.String("application/json"),
+	}}
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, name := range []string{c.CheckpointFile, c.RequestLog, c.HistoryFile, c.ContentionReport} {
+		if name == "" {
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %v", name, err)
+		}
+		files = append(files, f)
+		uploads = append(uploads, &s3manager.UploadInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key(filepath.Base(name))),
+			Body:        f,
+			ContentType: aws.String(contentType(name)),
+		})
+	}
+
+	for _, in := range uploads {
+		out, err := uploader.Upload(in)
+		if err != nil {
+			return fmt.Errorf("failed to upload s3://%s/%s: %v", bucket, aws.StringValue(in.Key), err)
+		}
+		if c.Verbose {
+			fmt.Printf("[Verbose] Uploaded %s\n", out.Location)
+		}
+	}
+	fmt.Printf("Results uploaded to s3://%s/%s/\n", bucket, key(""))
+	return nil
+}
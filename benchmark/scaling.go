@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// CapacityChange is a change of the provisioned capacity of the table seen
+// by DescribeTable during a -step-at run.
+type CapacityChange struct {
+	// AfterStepSec is when the change was seen, from the load step.
+	AfterStepSec float64 `json:"after_step_sec"`
+	Units        int64   `json:"units"`
+}
+
+// ScalingSummary is how auto scaling reacted to the load step of -step-at:
+// the time from the step to the first throttled attempt, to the first
+// capacity increase DescribeTable showed and to the end of throttling.
+type ScalingSummary struct {
+	StepSec  float64 `json:"step_sec"`
+	Rate     float64 `json:"rate"`
+	StepRate float64 `json:"step_rate"`
+	// Mode is "provisioned" or "on-demand", on which the capacity does not
+	// change.
+	Mode         string           `json:"mode"`
+	InitialUnits int64            `json:"initial_units"`
+	Changes      []CapacityChange `json:"capacity_changes,omitempty"`
+	// FirstThrottleSec, CapacityIncreaseSec and ThrottlingStoppedSec are
+	// from the step; not set if it did not happen before the end of the
+	// run, or for ThrottlingStoppedSec, if the last bucket was still
+	// throttled.
+	FirstThrottleSec     *float64        `json:"first_throttle_sec,omitempty"`
+	CapacityIncreaseSec  *float64        `json:"capacity_increase_sec,omitempty"`
+	ThrottlingStoppedSec *float64        `json:"throttling_stopped_sec,omitempty"`
+	Before               WindowStats     `json:"before"`
+	After                WindowStats     `json:"after"`
+	Timeline             []TimelinePoint `json:"timeline"`
+}
+
+func (s *ScalingSummary) Print() {
+	fmt.Printf("Auto scaling: load step from %.1f to %.1f requests/sec at %.1fs, %s table with %d capacity units\n",
+		s.Rate, s.StepRate, s.StepSec, s.Mode, s.InitialUnits)
+	fmt.Printf("  (a) first throttle:         %s\n", afterStep(s.FirstThrottleSec))
+	fmt.Printf("  (b) capacity increase seen: %s\n", afterStep(s.CapacityIncreaseSec))
+	fmt.Printf("  (c) throttling stopped:     %s\n", afterStep(s.ThrottlingStoppedSec))
+	for _, ch := range s.Changes {
+		fmt.Printf("  capacity %d units after %.1fs\n", ch.Units, ch.AfterStepSec)
+	}
+	fmt.Printf("  before the step: requests/sec %.2f, throttled attempts %d, p99 (ms): %.3f\n", s.Before.RequestsPerSecond, s.Before.Throttles, s.Before.P99Ms)
+	fmt.Printf("  after the step:  requests/sec %.2f, throttled attempts %d, p99 (ms): %.3f\n", s.After.RequestsPerSecond, s.After.Throttles, s.After.P99Ms)
+	for _, p := range s.Timeline {
+		events := ""
+		if len(p.Events) > 0 {
+			events = " <- " + fmt.Sprint(p.Events)
+		}
+		fmt.Printf("  [%7.1fs] requests/sec %9.2f, throttle rate %6.2f%%, p99 (ms): %8.3f%s\n", p.OffsetSec, p.RequestsPerSec, 100*p.ThrottleRate, p.P99Ms, events)
+	}
+	if s.Mode != "provisioned" {
+		fmt.Println("[WARN] the table is on-demand, whose capacity auto scaling does not manage")
+	}
+}
+
+func afterStep(sec *float64) string {
+	if sec == nil {
+		return "not before the end of the run"
+	}
+	return fmt.Sprintf("%.1fs after the step", *sec)
+}
+
+// ScalingMonitor raises the rate to -step-rate at -step-at into the run and
+// follows the provisioned capacity of the table with DescribeTable until
+// the end of the run. A nil *ScalingMonitor does nothing.
+type ScalingMonitor struct {
+	c        *DynamoDBBenchmark
+	db       *dynamodb.DynamoDB
+	timeline *Timeline
+	stop     chan struct{}
+	done     chan struct{}
+
+	mode    string
+	initial int64
+	step    time.Time
+	changes []CapacityChange
+}
+
+func (c *DynamoDBBenchmark) scalingMonitor(db *dynamodb.DynamoDB, timeline *Timeline) *ScalingMonitor {
+	return &ScalingMonitor{c: c, db: db, timeline: timeline, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// units returns the billing mode and the provisioned capacity the action
+// consumes: read units for read, write units for write.
+func (m *ScalingMonitor) units() (string, int64, error) {
+	desc, mode, _, _, err := billing(m.db, m.c.TableName)
+	if err != nil || desc.ProvisionedThroughput == nil {
+		return mode, 0, err
+	}
+	if m.c.Action == "read" {
+		return mode, aws.Int64Value(desc.ProvisionedThroughput.ReadCapacityUnits), nil
+	}
+	return mode, aws.Int64Value(desc.ProvisionedThroughput.WriteCapacityUnits), nil
+}
+
+// Start reads the capacity before the run and steps the load up in the
+// background.
+func (m *ScalingMonitor) Start() error {
+	if m == nil {
+		return nil
+	}
+	var err error
+	if m.mode, m.initial, err = m.units(); err != nil {
+		return fmt.Errorf("failed to describe table %s: %v", m.c.TableName, err)
+	}
+	go func() {
+		defer close(m.done)
+		select {
+		case <-time.After(m.c.StepAt):
+		case <-m.stop:
+			return
+		}
+		m.step = time.Now()
+		m.c.limiter.SetRate(m.c.StepRate)
+		m.timeline.Annotate(m.step, fmt.Sprintf("Load step to %.1f/s", m.c.StepRate))
+		if m.c.Verbose {
+			fmt.Printf("[Verbose] Load step to %.1f requests/sec\n", m.c.StepRate)
+		}
+		last := m.initial
+		ticker := time.NewTicker(eventPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-m.stop:
+				return
+			}
+			_, units, err := m.units()
+			if err != nil {
+				fmt.Printf("[WARN] failed to check the capacity of %s: %v\n", m.c.TableName, err)
+				continue
+			}
+			if units == last {
+				continue
+			}
+			now := time.Now()
+			m.changes = append(m.changes, CapacityChange{AfterStepSec: now.Sub(m.step).Seconds(), Units: units})
+			m.timeline.Annotate(now, fmt.Sprintf("Capacity %d -> %d", last, units))
+			if m.c.Verbose {
+				fmt.Printf("[Verbose] Capacity of %s: %d -> %d units\n", m.c.TableName, last, units)
+			}
+			last = units
+		}
+	}()
+	return nil
+}
+
+// Stop stops following the capacity and measures the reaction to the step
+// on the timeline.
+func (m *ScalingMonitor) Stop() *ScalingSummary {
+	if m == nil {
+		return nil
+	}
+	close(m.stop)
+	<-m.done
+	sum := &ScalingSummary{
+		Rate:         m.c.Rate,
+		StepRate:     m.c.StepRate,
+		Mode:         m.mode,
+		InitialUnits: m.initial,
+		Changes:      m.changes,
+		Timeline:     m.timeline.Series(),
+	}
+	if m.step.IsZero() {
+		sum.StepSec = m.c.StepAt.Seconds()
+		sum.Before = m.timeline.Window(0, -1)
+		return sum
+	}
+	step := m.timeline.Offset(m.step)
+	sum.StepSec = step.Seconds()
+	// The bucket of the step counts as after it.
+	boundary := step.Truncate(m.c.TimelineBucket)
+	sum.Before = m.timeline.Window(0, boundary)
+	sum.After = m.timeline.Window(boundary, -1)
+	for _, ch := range m.changes {
+		if ch.Units > m.initial {
+			sum.CapacityIncreaseSec = aws.Float64(ch.AfterStepSec)
+			break
+		}
+	}
+	width := m.c.TimelineBucket.Seconds()
+	for i, p := range sum.Timeline {
+		// The bucket of the step may start a little before it.
+		if p.OffsetSec+width <= sum.StepSec || p.Throttles == 0 {
+			continue
+		}
+		if sum.FirstThrottleSec == nil {
+			sum.FirstThrottleSec = aws.Float64(maxFloat(p.OffsetSec-sum.StepSec, 0))
+		}
+		sum.ThrottlingStoppedSec = nil
+		if i < len(sum.Timeline)-1 {
+			sum.ThrottlingStoppedSec = aws.Float64(p.OffsetSec + width - sum.StepSec)
+		}
+	}
+	return sum
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"benchmark/internal/cli"
+)
+
+// resultsSchemaVersion is the schema_version of the summaries this binary
+// writes. It goes up when a field of Summary is removed, renamed or changes
+// its type; new fields keep it, so a dashboard only needs to care about the
+// version it was built for and can ignore what it does not know.
+const resultsSchemaVersion = 1
+
+var resultsUsageText = `auto_increment results schema [-o <file>]
+auto_increment results validate <file>...
+
+schema prints the JSON Schema of the summaries the benchmark writes (-results-dir,
+-results-history, -sinks json/jsonl/s3, -stream-results, the summary line of -k8s-friendly),
+generated from the Go type Summary. Every summary carries the version of the schema it follows in
+"schema_version"; results.schema.json next to the sources is the schema of the current version.
+
+validate checks summaries against that schema: JSON files with one summary or newline delimited
+JSON files with one per line. It reports the missing fields, the fields of an unexpected type and
+the fields the schema does not know (written by a newer version), and fails on summaries of a
+schema version other than ` + fmt.Sprint(resultsSchemaVersion) + `.
+
+Options:
+-o <file>            Write the schema to this file instead of stdout
+-config <file>       JSON file with option values, keyed by flag name (see the benchmark)
+-h                   help message
+
+Every option can also be set with an environment variable DDB_BENCH_<OPTION> or in the -config file
+(the options of the benchmark there are ignored), as for the benchmark.
+`
+
+// jsonSchema returns the JSON Schema of values of type t as encoding/json
+// writes them: the exported fields by their json names, the fields without
+// omitempty required.
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := jsonSchema(t.Elem())
+		if name, ok := schema["type"].(string); ok {
+			schema["type"] = []string{name, "null"}
+		}
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": []string{"object", "null"}, "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, omitempty, ok := jsonField(f)
+			if !ok {
+				continue
+			}
+			properties[name] = jsonSchema(f.Type)
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]interface{}{}
+}
+
+// jsonField returns the name encoding/json writes f under and whether it
+// is omitted when empty; ok is false for the fields it does not write.
+func jsonField(f reflect.StructField) (name string, omitempty bool, ok bool) {
+	if f.PkgPath != "" {
+		return "", false, false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = f.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty, true
+}
+
+// resultsSchema returns the JSON Schema document of Summary.
+func resultsSchema() map[string]interface{} {
+	schema := jsonSchema(reflect.TypeOf(Summary{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["$id"] = fmt.Sprintf("https://github.com/yokawasa/dynamodb_benchmark/results/v%d.schema.json", resultsSchemaVersion)
+	schema["title"] = "DynamoDB benchmark summary"
+	schema["properties"].(map[string]interface{})["schema_version"] = map[string]interface{}{
+		"type":  "integer",
+		"const": resultsSchemaVersion,
+	}
+	return schema
+}
+
+// validateJSON checks v, as decoded by encoding/json, against the subset of
+// JSON Schema jsonSchema generates and returns the problems found, each
+// prefixed with the path of the value.
+func validateJSON(schema map[string]interface{}, v interface{}, path string) []string {
+	var problems []string
+	if want, ok := schema["const"]; ok {
+		if n, ok := v.(float64); !ok || n != float64(want.(int)) {
+			return []string{fmt.Sprintf("%s: want %v, got %s", path, want, jsonText(v))}
+		}
+	}
+	switch types := schema["type"].(type) {
+	case string:
+		if !jsonTypeIs(v, types) {
+			return []string{fmt.Sprintf("%s: want %s, got %s", path, types, jsonText(v))}
+		}
+	case []string:
+		matched := false
+		for _, t := range types {
+			matched = matched || jsonTypeIs(v, t)
+		}
+		if !matched {
+			return []string{fmt.Sprintf("%s: want %s, got %s", path, strings.Join(types, " or "), jsonText(v))}
+		}
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, validateJSON(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]string)
+		for _, name := range required {
+			if _, ok := v[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s: missing", path, name))
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if p, ok := properties[name].(map[string]interface{}); ok {
+				problems = append(problems, validateJSON(p, v[name], path+"."+name)...)
+			} else if extra, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+				problems = append(problems, validateJSON(extra, v[name], path+"."+name)...)
+			} else if schema["additionalProperties"] == false {
+				problems = append(problems, fmt.Sprintf("%s.%s: unknown field", path, name))
+			}
+		}
+	}
+	return problems
+}
+
+func jsonTypeIs(v interface{}, t string) bool {
+	switch v := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case float64:
+		return t == "number" || (t == "integer" && v == float64(int64(v)))
+	case string:
+		return t == "string"
+	case []interface{}:
+		return t == "array"
+	case map[string]interface{}:
+		return t == "object"
+	}
+	return false
+}
+
+func jsonText(v interface{}) string {
+	b, _ := json.Marshal(v)
+	if len(b) > 40 {
+		return string(b[:40]) + "..."
+	}
+	return string(b)
+}
+
+// validateResults validates the summaries of path, a JSON file or a newline
+// delimited JSON file, and returns the problems found.
+func validateResults(path string) ([]string, int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	schema := resultsSchema()
+	var docs [][]byte
+	var v interface{}
+	if json.Unmarshal(b, &v) == nil {
+		docs = [][]byte{b}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+		for scanner.Scan() {
+			if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+				docs = append(docs, append([]byte(nil), scanner.Bytes()...))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, 0, err
+		}
+	}
+	var problems []string
+	for i, doc := range docs {
+		where := path
+		if len(docs) > 1 {
+			where = fmt.Sprintf("%s:%d", path, i+1)
+		}
+		var v interface{}
+		if err := json.Unmarshal(doc, &v); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: not JSON: %v", where, err))
+			continue
+		}
+		for _, p := range validateJSON(schema, v, "$") {
+			problems = append(problems, where+": "+p)
+		}
+	}
+	return problems, len(docs), nil
+}
+
+// results runs the "results" subcommand.
+func results(args []string) int {
+	if len(args) == 0 || (args[0] != "schema" && args[0] != "validate") {
+		fmt.Println(resultsUsageText)
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			return exitOK
+		}
+		return exitUsage
+	}
+	fs := flag.NewFlagSet("results "+args[0], flag.ContinueOnError)
+	fs.Usage = func() { fmt.Println(resultsUsageText) }
+	out := fs.String("o", "", "File to write the schema to")
+	configFile := fs.String("config", "", "JSON file with option values, overridden by environment variables and flags")
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if _, err := cli.ApplyEnvAndConfig(fs, *configFile, true); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		return exitUsage
+	}
+
+	if args[0] == "schema" {
+		b, _ := json.MarshalIndent(resultsSchema(), "", "  ")
+		b = append(b, '\n')
+		if *out == "" {
+			os.Stdout.Write(b)
+			return exitOK
+		}
+		if err := ioutil.WriteFile(*out, b, 0644); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	if fs.NArg() == 0 {
+		fmt.Println("[ERROR] results validate needs the files to validate")
+		return exitUsage
+	}
+	code := exitOK
+	for _, path := range fs.Args() {
+		problems, n, err := validateResults(path)
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			code = exitFailure
+			continue
+		}
+		if len(problems) > 0 {
+			for _, p := range problems {
+				fmt.Printf("[INVALID] %s\n", p)
+			}
+			code = exitFailure
+			continue
+		}
+		fmt.Printf("%s: %d summaries valid against schema version %d\n", path, n, resultsSchemaVersion)
+	}
+	return code
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func (c *DynamoDBBenchmark) seedItemInput() *dynamodb.PutItemInput {
+	param := &dynamodb.PutItemInput{
+		TableName: &c.TableName,
+		Item: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(c.Id),
+			},
+			"age": {
+				N: aws.String(strconv.Itoa(c.SeedAge)),
+			},
+		},
+	}
+	for name, v := range c.seedAttributes() {
+		param.Item[name] = v
+	}
+	return param
+}
+
+// resetItem (re)creates the target item with age set to SeedAge, replacing
+// whatever a previous run left behind, so runs start from the same state.
+// With -role-arns the item is reset with every role, i.e. in every account.
+func (c *DynamoDBBenchmark) resetItem() error {
+	roles := len(c.roleChains())
+	if roles == 0 {
+		roles = 1
+	}
+	for i := 1; i <= roles; i++ {
+		opts := c.sessionClientOptions(i)
+		db, err := getDynamoDBClient(opts)
+		if err != nil {
+			return err
+		}
+		if c.ShiftHotkey > 0 {
+			c.resources.Track(Resource{Kind: resourceItems, Table: c.TableName, Name: c.Id + "-hot", Count: c.hotKeyCount(), RoleChain: opts.RoleChain})
+			for n := 1; n <= c.hotKeyCount(); n++ {
+				input := c.seedItemInput()
+				input.Item["id"] = &dynamodb.AttributeValue{S: aws.String(c.hotKey(n))}
+				if _, err := db.PutItem(input); err != nil {
+					return fmt.Errorf("failed to reset item %q: %v", c.hotKey(n), err)
+				}
+			}
+			continue
+		}
+		if c.Shards != "" {
+			levels, _ := parseShardLevels(c.Shards)
+			shards := levels[len(levels)-1]
+			c.resources.Track(Resource{Kind: resourceItems, Table: c.TableName, Name: c.Id + "-shard", Count: shards, RoleChain: opts.RoleChain})
+			err := c.putItems(db, shards, func(k int) map[string]*dynamodb.AttributeValue {
+				item := c.seedItemInput().Item
+				item["id"] = &dynamodb.AttributeValue{S: aws.String(c.shardKey(k))}
+				return item
+			})
+			if err != nil {
+				return fmt.Errorf("failed to reset shards %s-1 ... %s-%d: %v", c.Id+"-shard", c.Id+"-shard", shards, err)
+			}
+			continue
+		}
+		if c.Keys > 1 {
+			c.resources.Track(Resource{Kind: resourceItems, Table: c.TableName, Name: c.Id, Count: c.Keys, RoleChain: opts.RoleChain})
+			err := c.putItems(db, c.Keys, func(k int) map[string]*dynamodb.AttributeValue {
+				item := c.seedItemInput().Item
+				item["id"] = &dynamodb.AttributeValue{S: aws.String(c.Id + "-" + strconv.Itoa(k))}
+				return item
+			})
+			if err != nil {
+				return fmt.Errorf("failed to reset items %s-1 ... %s-%d: %v", c.Id, c.Id, c.Keys, err)
+			}
+			continue
+		}
+		c.resources.Track(Resource{Kind: resourceItem, Table: c.TableName, Name: c.Id, RoleChain: opts.RoleChain})
+		if _, err := db.PutItem(c.seedItemInput()); err != nil {
+			return fmt.Errorf("failed to reset item %q: %v", c.Id, err)
+		}
+	}
+	if c.Verbose {
+		fmt.Printf("[Verbose] Reset item id %s to age %d\n", c.Id, c.SeedAge)
+	}
+	return nil
+}
+
+// putItems writes the count items built by item(1) ... item(count) with
+// BatchWriteItem, 25 at a time, resubmitting unprocessed items with the
+// backoff of -unprocessed-backoff.
+func (c *DynamoDBBenchmark) putItems(db *dynamodb.DynamoDB, count int, item func(k int) map[string]*dynamodb.AttributeValue) error {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var requests []*dynamodb.WriteRequest
+	for k := 1; k <= count; k++ {
+		requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item(k)}})
+		if len(requests) < 25 && k < count {
+			continue
+		}
+		input := &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{c.TableName: requests}}
+		for n := 0; len(input.RequestItems[c.TableName]) > 0; n++ {
+			if n > 0 {
+				time.Sleep(c.unprocessedBackoff(n, rnd))
+			}
+			out, err := db.BatchWriteItem(input)
+			if err != nil {
+				return err
+			}
+			input = &dynamodb.BatchWriteItemInput{RequestItems: out.UnprocessedItems}
+		}
+		requests = nil
+	}
+	return nil
+}
+
+// sortKeyTableInput creates the table keyed by "id" (S) and the sort key of
+// type keyType.
+func (c *DynamoDBBenchmark) sortKeyTableInput(sortKey string, keyType string) *dynamodb.CreateTableInput {
+	return &dynamodb.CreateTableInput{
+		TableName: aws.String(c.TableName),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("id"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+			{AttributeName: aws.String(sortKey), KeyType: aws.String(dynamodb.KeyTypeRange)},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+			{AttributeName: aws.String(sortKey), AttributeType: aws.String(keyType)},
+		},
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+	}
+}
+
+// checkSortKeyTable verifies the table is keyed by "id" (S) and the sort key
+// of type keyType, as the action needs. Tables of the fake endpoint are keyed by
+// "id" only until created with another key schema, so there the table is
+// created.
+func (c *DynamoDBBenchmark) checkSortKeyTable(db *dynamodb.DynamoDB, action string, sortKey string, keyType string) error {
+	if c.EndpointUrl == fakeEndpoint {
+		_, err := db.CreateTable(c.sortKeyTableInput(sortKey, keyType))
+		return err
+	}
+	out, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(c.TableName)})
+	if err != nil {
+		return err
+	}
+	want := map[string]string{"id": dynamodb.ScalarAttributeTypeS, sortKey: keyType}
+	types := map[string]string{}
+	for _, def := range out.Table.AttributeDefinitions {
+		types[aws.StringValue(def.AttributeName)] = aws.StringValue(def.AttributeType)
+	}
+	ok := len(out.Table.KeySchema) == 2
+	for _, k := range out.Table.KeySchema {
+		name := aws.StringValue(k.AttributeName)
+		if types[name] != want[name] {
+			ok = false
+		}
+	}
+	if !ok {
+		spec := sortKey
+		if keyType != dynamodb.ScalarAttributeTypeN {
+			spec += ":" + keyType
+		}
+		return fmt.Errorf("%s needs a table with the partition key \"id\" (S) and the sort key %q (%s); create one with: go run . admin -a create-table -table %s -sort-key %s",
+			action, sortKey, keyType, c.TableName, spec)
+	}
+	return nil
+}
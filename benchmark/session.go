@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// sessionTTLAttribute holds the expiry of a session in epoch seconds. Enable
+// the time to live of the table on it to have DynamoDB delete expired
+// sessions.
+const sessionTTLAttribute = "expires_at"
+
+func (c *DynamoDBBenchmark) sessionKey(k int) string {
+	return c.Id + "-session-" + strconv.Itoa(k)
+}
+
+// sessionItem is session k with -session-size bytes of data, expiring
+// -session-ttl from now.
+func (c *DynamoDBBenchmark) sessionItem(k int, rnd *rand.Rand) map[string]*dynamodb.AttributeValue {
+	data := make([]byte, c.SessionSize)
+	rnd.Read(data)
+	now := time.Now()
+	return map[string]*dynamodb.AttributeValue{
+		"id":                {S: aws.String(c.sessionKey(k))},
+		"data":              {B: data},
+		"last_seen":         {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		sessionTTLAttribute: {N: aws.String(strconv.FormatInt(now.Add(c.SessionTTL).Unix(), 10))},
+	}
+}
+
+// seedSessions (re)creates the -sessions active sessions.
+func (c *DynamoDBBenchmark) seedSessions() error {
+	db, err := getDynamoDBClient(c.clientOptions())
+	if err != nil {
+		return err
+	}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	err = c.putItems(db, c.Sessions, func(k int) map[string]*dynamodb.AttributeValue {
+		return c.sessionItem(k, rnd)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to seed the sessions: %v", err)
+	}
+	if c.Verbose {
+		fmt.Printf("[Verbose] Seeded %d sessions of %d bytes expiring in %s\n", c.Sessions, c.SessionSize, c.SessionTTL)
+	}
+	return nil
+}
+
+// SessionSummary is the outcome of the session lookups and refreshes.
+type SessionSummary struct {
+	Sessions int    `json:"sessions"`
+	Reads    uint64 `json:"reads"`
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+	// Expired counts sessions read after their expiry, which DynamoDB had
+	// not deleted yet; they count as misses too.
+	Expired uint64  `json:"expired"`
+	HitRate float64 `json:"hit_rate"`
+	Writes  uint64  `json:"writes"`
+}
+
+func (s *SessionSummary) String() string {
+	return fmt.Sprintf("%d active, reads %d (hits %d, %.2f%%, misses %d, of which expired %d), writes %d",
+		s.Sessions, s.Reads, s.Hits, s.HitRate*100, s.Misses, s.Expired, s.Writes)
+}
+
+// SessionStats counts the outcome of the session lookups. A nil
+// *SessionStats counts nothing.
+type SessionStats struct {
+	sessions int
+	hits     uint64
+	misses   uint64
+	expired  uint64
+	writes   uint64
+}
+
+func NewSessionStats(sessions int) *SessionStats {
+	return &SessionStats{sessions: sessions}
+}
+
+// Read counts a successful lookup of item, nil if it was not found.
+func (s *SessionStats) Read(item map[string]*dynamodb.AttributeValue, now time.Time) {
+	if s == nil {
+		return
+	}
+	if item == nil {
+		atomic.AddUint64(&s.misses, 1)
+		return
+	}
+	if v, ok := item[sessionTTLAttribute]; ok && v.N != nil {
+		if expires, err := strconv.ParseInt(*v.N, 10, 64); err == nil && expires < now.Unix() {
+			atomic.AddUint64(&s.misses, 1)
+			atomic.AddUint64(&s.expired, 1)
+			return
+		}
+	}
+	atomic.AddUint64(&s.hits, 1)
+}
+
+// Write counts a successful refresh.
+func (s *SessionStats) Write() {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.writes, 1)
+}
+
+func (s *SessionStats) Summary() *SessionSummary {
+	if s == nil {
+		return nil
+	}
+	sum := &SessionSummary{
+		Sessions: s.sessions,
+		Hits:     atomic.LoadUint64(&s.hits),
+		Misses:   atomic.LoadUint64(&s.misses),
+		Expired:  atomic.LoadUint64(&s.expired),
+		Writes:   atomic.LoadUint64(&s.writes),
+	}
+	sum.Reads = sum.Hits + sum.Misses
+	sum.HitRate = ratio(sum.Hits, sum.Reads)
+	return sum
+}
+
+// startSessionWorker looks up (GetItem, eventually consistent) or, for
+// 1 - -read-ratio of the operations, refreshes (PutItem) a session picked by
+// -key-skew out of -sessions.
+func (c *DynamoDBBenchmark) startSessionWorker(id int, wg *sync.WaitGroup, stats *WorkerStats) {
+	c.runWorker(id, wg, stats, c.newSessionOperation)
+}
+
+// sessionOperation sends the lookups and refreshes of a session store
+// session.
+type sessionOperation struct {
+	c    *DynamoDBBenchmark
+	db   *dynamodb.DynamoDB
+	rnd  *rand.Rand
+	pick func() int
+	// out is the response of the last lookup.
+	out *dynamodb.GetItemOutput
+}
+
+func (c *DynamoDBBenchmark) newSessionOperation(id int, db *dynamodb.DynamoDB, stats *WorkerStats) Operation {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	skew, _ := parseKeySkew(c.KeySkew)
+	return &sessionOperation{c: c, db: db, rnd: rnd, pick: skew.picker(rnd, c.Sessions)}
+}
+
+func (o *sessionOperation) Build(i int) *Call {
+	c, k := o.c, o.pick()
+	if o.rnd.Float64() < c.ReadRatio {
+		return &Call{Op: "GetItem", Items: 1, Request: &dynamodb.GetItemInput{
+			TableName: aws.String(c.TableName),
+			Key:       map[string]*dynamodb.AttributeValue{"id": {S: aws.String(c.sessionKey(k))}},
+		}}
+	}
+	return &Call{Op: "PutItem", Items: 1, Request: &dynamodb.PutItemInput{TableName: aws.String(c.TableName), Item: c.sessionItem(k, o.rnd)}}
+}
+
+func (o *sessionOperation) Execute(call *Call) (err error) {
+	switch param := call.Request.(type) {
+	case *dynamodb.GetItemInput:
+		o.out, err = o.db.GetItemWithContext(call.Context(), param)
+	case *dynamodb.PutItemInput:
+		_, err = o.db.PutItemWithContext(call.Context(), param)
+	}
+	return err
+}
+
+func (o *sessionOperation) Observe(call *Call, err error) {
+	if err != nil {
+		return
+	}
+	if call.Op == "GetItem" {
+		o.c.sessionStats.Read(o.out.Item, time.Now())
+	} else {
+		o.c.sessionStats.Write()
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// maxShards is the most shards -shards takes, the keys of one BatchGetItem.
+const maxShards = 100
+
+// parseShardLevels parses -shards, one number of shards or a list of them
+// to sweep like -concurrency-sweep, e.g. "1..64".
+func parseShardLevels(spec string) ([]int, error) {
+	levels, err := parseLevels(spec, "shards")
+	if err != nil {
+		return nil, err
+	}
+	if last := levels[len(levels)-1]; last > maxShards {
+		return nil, fmt.Errorf("at most %d shards can be read with one BatchGetItem (got %d)", maxShards, last)
+	}
+	return levels, nil
+}
+
+func (c *DynamoDBBenchmark) shardKey(k int) string {
+	return c.Id + "-shard-" + strconv.Itoa(k)
+}
+
+// ShardSummary is the outcome of a run with -shards.
+type ShardSummary struct {
+	Shards int    `json:"shards"`
+	Suffix string `json:"suffix"`
+	// Operations counts the logical reads and writes: a write goes to one
+	// shard, a read fans out to all of them.
+	Operations       uint64  `json:"operations"`
+	OperationsPerSec float64 `json:"operations_per_sec"`
+	// The write shares are the smallest and largest share of the writes a
+	// shard got, 1/Shards each when the writes spread evenly.
+	MinShardWriteShare float64 `json:"min_shard_write_share,omitempty"`
+	MaxShardWriteShare float64 `json:"max_shard_write_share,omitempty"`
+	// Aggregate is the sum of "age" over the shards of the last read.
+	Aggregate *int64 `json:"aggregate,omitempty"`
+}
+
+func (s *ShardSummary) String() string {
+	str := fmt.Sprintf("%d shards (%s suffix), logical operations %d (%.2f/sec)", s.Shards, s.Suffix, s.Operations, s.OperationsPerSec)
+	if s.MaxShardWriteShare > 0 {
+		str += fmt.Sprintf(", share of the writes per shard %.1f%% ... %.1f%%", s.MinShardWriteShare*100, s.MaxShardWriteShare*100)
+	}
+	if s.Aggregate != nil {
+		str += fmt.Sprintf(", aggregate age of the last read %d", *s.Aggregate)
+	}
+	return str
+}
+
+// Shards spreads the item of -id over -shards items "<id>-shard-<k>": writes
+// go to one shard picked by the -shard-suffix, reads get all shards and add
+// their "age" up. A nil *Shards leaves the key alone.
+type Shards struct {
+	suffix     string
+	writes     []uint64
+	operations uint64
+	reads      uint64
+	aggregate  int64
+}
+
+func NewShards(count int, suffix string) *Shards {
+	return &Shards{suffix: suffix, writes: make([]uint64, count)}
+}
+
+// pick returns the shard of the i-th write of session id: a random one, or
+// with the calculated suffix the hash of "<session>-<call>", so whoever knows
+// the logical key of a write can find its shard again.
+func (s *Shards) pick(id int, i int, rnd *rand.Rand) int {
+	if s.suffix == "calculated" {
+		h := fnv.New32a()
+		h.Write([]byte(strconv.Itoa(id) + "-" + strconv.Itoa(i)))
+		return int(h.Sum32()%uint32(len(s.writes))) + 1
+	}
+	return rnd.Intn(len(s.writes)) + 1
+}
+
+// wrote counts a write to shard k.
+func (s *Shards) wrote(k int) {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.writes[k-1], 1)
+	atomic.AddUint64(&s.operations, 1)
+}
+
+// read counts a fanned out read whose shards added up to aggregate.
+func (s *Shards) read(aggregate int64) {
+	atomic.AddUint64(&s.operations, 1)
+	atomic.AddUint64(&s.reads, 1)
+	atomic.StoreInt64(&s.aggregate, aggregate)
+}
+
+func (s *Shards) Summary(seconds float64) *ShardSummary {
+	if s == nil {
+		return nil
+	}
+	sum := &ShardSummary{
+		Shards:     len(s.writes),
+		Suffix:     s.suffix,
+		Operations: atomic.LoadUint64(&s.operations),
+	}
+	if atomic.LoadUint64(&s.reads) > 0 {
+		aggregate := atomic.LoadInt64(&s.aggregate)
+		sum.Aggregate = &aggregate
+	}
+	sum.OperationsPerSec = perSecond(sum.Operations, seconds)
+	var total uint64
+	min, max := ^uint64(0), uint64(0)
+	for i := range s.writes {
+		n := atomic.LoadUint64(&s.writes[i])
+		total += n
+		if n < min {
+			min = n
+		}
+		if n > max {
+			max = n
+		}
+	}
+	if total > 0 {
+		sum.MinShardWriteShare, sum.MaxShardWriteShare = ratio(min, total), ratio(max, total)
+	}
+	return sum
+}
+
+// startShardReadWorker reads the item of -id spread over -shards: each call
+// is one BatchGetItem of all shards, resubmitting unprocessed keys as
+// -unprocessed-retries and -unprocessed-backoff say, which adds their "age"
+// up.
+func (c *DynamoDBBenchmark) startShardReadWorker(id int, wg *sync.WaitGroup, stats *WorkerStats) {
+	defer wg.Done()
+	defer stats.Finish()
+
+	time.Sleep(c.staggerDelay(id))
+
+	opts := c.sessionClientOptions(id)
+	opts.ConnStats = c.conns.Worker(id)
+	opts.Breakdown = c.breakdown.Worker()
+	opts.Attempts = stats.Attempts()
+	db, err := getDynamoDBClient(opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	get := c.getItemInput()
+	keys := &dynamodb.KeysAndAttributes{
+		ProjectionExpression:     get.ProjectionExpression,
+		ExpressionAttributeNames: get.ExpressionAttributeNames,
+	}
+	for k := 1; k <= len(c.shards.writes); k++ {
+		keys.Keys = append(keys.Keys, idKey(c.shardKey(k)))
+	}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	for i := 1; c.moreCalls(id, i); i++ {
+		input := &dynamodb.BatchGetItemInput{
+			RequestItems:           map[string]*dynamodb.KeysAndAttributes{c.TableName: keys},
+			ReturnConsumedCapacity: get.ReturnConsumedCapacity,
+		}
+		var aggregate int64
+		items := 0
+		start := c.clock.Now()
+		var err error
+		for n := 0; n <= c.UnprocessedRetries && err == nil && len(input.RequestItems) > 0; n++ {
+			if n > 0 {
+				time.Sleep(c.unprocessedBackoff(n, rnd))
+			}
+			var out *dynamodb.BatchGetItemOutput
+			err = retry(c.RetryNum, 2*time.Second, func() (err error) {
+				out, err = db.BatchGetItem(input)
+				return err
+			})
+			if err != nil {
+				break
+			}
+			for _, item := range out.Responses[c.TableName] {
+				items++
+				if v, ok := item["age"]; ok && v.N != nil {
+					age, _ := strconv.ParseInt(aws.StringValue(v.N), 10, 64)
+					aggregate += age
+				}
+			}
+			input = &dynamodb.BatchGetItemInput{RequestItems: out.UnprocessedKeys, ReturnConsumedCapacity: get.ReturnConsumedCapacity}
+		}
+		if err == nil && len(input.RequestItems) > 0 {
+			err = fmt.Errorf("%d shards still unprocessed after %d retries", len(input.RequestItems[c.TableName].Keys), c.UnprocessedRetries)
+		}
+		stats.Record("BatchGetItem[shards]", start, time.Since(start), items, err)
+		if err == nil {
+			c.shards.read(aggregate)
+		} else if !c.TUI {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+}
+
+// ShardLevel is the outcome of the workload with one number of shards.
+type ShardLevel struct {
+	ConcurrencyLevel
+	Shards           int     `json:"shards"`
+	OperationsPerSec float64 `json:"operations_per_sec"`
+}
+
+// RunShardSweep runs the read or write workload for -shard-step with every
+// number of shards of -shards and prints the effective throughput, i.e.
+// logical reads or writes per second, per number of shards as a table and
+// as a chart.
+func (c *DynamoDBBenchmark) RunShardSweep() error {
+	levels, err := parseShardLevels(c.Shards)
+	if err != nil {
+		return err
+	}
+	if c.Reset {
+		if err := c.resetItem(); err != nil {
+			return err
+		}
+	}
+	c.health.SetReady()
+
+	var results []ShardLevel
+	for _, n := range levels {
+		if c.Verbose {
+			fmt.Printf("[Verbose] Shard sweep: %d shards\n", n)
+		}
+		step := c.sweepStep(c.ShardStep)
+		step.shards = NewShards(n, c.ShardSuffix)
+		level, sum := step.runLevel(c.Connections)
+		results = append(results, ShardLevel{
+			ConcurrencyLevel: level,
+			Shards:           n,
+			OperationsPerSec: step.shards.Summary(sum.DurationSec).OperationsPerSec,
+		})
+		if atomic.LoadInt32(c.stopped) != 0 {
+			break
+		}
+	}
+	printShardSweep(c, results)
+	return nil
+}
+
+func printShardSweep(c *DynamoDBBenchmark, levels []ShardLevel) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Shard Sweep - %s (%s suffix, %d connections, %s per level)\n", c.Action, c.ShardSuffix, c.Connections, c.ShardStep)
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", c.RunID)
+	fmt.Printf("%8s %10s %8s %10s %12s %14s %10s %9s\n",
+		"shards", "requests", "errors", "throttles", "requests/s", "operations/s", "avg_ms", "p99_ms")
+	var maxRate float64
+	for _, l := range levels {
+		fmt.Printf("%8d %10d %8d %10d %12.1f %14.1f %10.3f %9.3f\n",
+			l.Shards, l.Requests, l.Errors, l.Throttles, l.RequestsPerSecond, l.OperationsPerSec, l.AverageMs, l.P99Ms)
+		if l.OperationsPerSec > maxRate {
+			maxRate = l.OperationsPerSec
+		}
+	}
+	fmt.Println()
+	fmt.Println("Effective throughput (logical operations/s) by shards")
+	for _, l := range levels {
+		fmt.Printf("%8d | %s %.1f\n", l.Shards, bar(l.OperationsPerSec, maxRate, concurrencyChartWidth), l.OperationsPerSec)
+	}
+}
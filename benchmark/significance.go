@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// runningMean accumulates the mean and variance of samples with Welford's
+// algorithm, so memory does not grow with the run.
+type runningMean struct {
+	n    uint64
+	mean float64
+	m2   float64
+}
+
+func (r *runningMean) add(x float64) {
+	r.n++
+	delta := x - r.mean
+	r.mean += delta / float64(r.n)
+	r.m2 += delta * (x - r.mean)
+}
+
+// merge adds the samples of o (Chan et al.'s parallel variance).
+func (r *runningMean) merge(o runningMean) {
+	if o.n == 0 {
+		return
+	}
+	n := r.n + o.n
+	delta := o.mean - r.mean
+	r.m2 += o.m2 + delta*delta*float64(r.n)*float64(o.n)/float64(n)
+	r.mean += delta * float64(o.n) / float64(n)
+	r.n = n
+}
+
+// variance is the sample variance, 0 with less than two samples.
+func (r runningMean) variance() float64 {
+	if r.n < 2 {
+		return 0
+	}
+	return r.m2 / float64(r.n-1)
+}
+
+// Difference is the difference B - A of a metric with its 95% confidence
+// interval and the two-sided p-value of the t-test behind it.
+type Difference struct {
+	Metric  string  `json:"metric"`
+	A       float64 `json:"a"`
+	B       float64 `json:"b"`
+	Diff    float64 `json:"diff"`
+	CILow   float64 `json:"ci_low"`
+	CIHigh  float64 `json:"ci_high"`
+	Samples uint64  `json:"samples"`
+	P       float64 `json:"p"`
+	// Significant is whether P is below 0.05, i.e. the interval excludes 0.
+	Significant bool `json:"significant"`
+}
+
+// difference fills in the interval and the p-value of diff from its
+// standard error and degrees of freedom.
+func difference(metric string, a, b, diff, se, df float64, samples uint64) Difference {
+	d := Difference{Metric: metric, A: a, B: b, Diff: diff, CILow: diff, CIHigh: diff, Samples: samples, P: 1}
+	if df < 1 {
+		return d
+	}
+	if se == 0 {
+		if diff != 0 {
+			d.P = 0
+		}
+	} else {
+		d.P = studentTwoSided(diff/se, df)
+		margin := studentQuantile(0.975, df) * se
+		d.CILow, d.CIHigh = diff-margin, diff+margin
+	}
+	d.Significant = d.P < 0.05
+	return d
+}
+
+// pairedTest is the paired t-test of the differences B - A in d.
+func pairedTest(metric string, a, b float64, d runningMean) Difference {
+	se := math.Sqrt(d.variance() / float64(d.n))
+	return difference(metric, a, b, d.mean, se, float64(d.n)-1, d.n)
+}
+
+// welchTest is Welch's t-test of the means of a and b, e.g. of the
+// throughput of the one-second intervals of two runs. Consecutive intervals
+// are not quite independent, so treat a p-value close to 0.05 with care.
+func welchTest(metric string, a, b runningMean) Difference {
+	va, vb := a.variance()/float64(a.n), b.variance()/float64(b.n)
+	df := 0.0
+	if a.n > 1 && b.n > 1 && va+vb > 0 {
+		df = (va + vb) * (va + vb) / (va*va/float64(a.n-1) + vb*vb/float64(b.n-1))
+	} else if a.n > 1 && b.n > 1 {
+		df = float64(a.n + b.n - 2)
+	}
+	return difference(metric, a.mean, b.mean, b.mean-a.mean, math.Sqrt(va+vb), df, a.n+b.n)
+}
+
+// String formats d for the summaries, e.g. "+3.1% (95% CI -1.2% ... +7.4%),
+// p = 0.16, not significant".
+func (d Difference) String() string {
+	verdict := "not significant"
+	if d.Significant {
+		verdict = "significant"
+	}
+	if d.A == 0 {
+		return fmt.Sprintf("%+.3f (95%% CI %+.3f ... %+.3f), p = %.3g, %s", d.Diff, d.CILow, d.CIHigh, d.P, verdict)
+	}
+	pct := 100 / d.A
+	return fmt.Sprintf("%+.3f = %+.1f%% (95%% CI %+.1f%% ... %+.1f%%), p = %.3g, %s",
+		d.Diff, d.Diff*pct, d.CILow*pct, d.CIHigh*pct, d.P, verdict)
+}
+
+// studentTwoSided is the probability of a Student's t with df degrees of
+// freedom being at least |t| away from 0.
+func studentTwoSided(t, df float64) float64 {
+	return incompleteBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// studentQuantile is the p quantile (p > 0.5) of Student's t with df degrees
+// of freedom, found by bisection.
+func studentQuantile(p, df float64) float64 {
+	low, high := 0.0, 1e3
+	for i := 0; i < 100; i++ {
+		mid := (low + high) / 2
+		if 1-studentTwoSided(mid, df)/2 < p {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2
+}
+
+// incompleteBeta is the regularized incomplete beta function I_x(a, b),
+// evaluated with its continued fraction (Numerical Recipes, 6.4).
+func incompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaFraction(a, b, x) / a
+	}
+	return 1 - front*betaFraction(b, a, 1-x)/b
+}
+
+func betaFraction(a, b, x float64) float64 {
+	const tiny = 1e-300
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1.0; m <= 300; m++ {
+		m2 := 2 * m
+		aa := m * (b - m) * x / ((a + m2 - 1) * (a + m2))
+		for i := 0; i < 2; i++ {
+			d = 1 + aa*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + aa/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+			aa = -(a + m) * (a + b + m) * x / ((a + m2) * (a + m2 + 1))
+		}
+		if math.Abs(d*c-1) < 1e-12 {
+			break
+		}
+	}
+	return h
+}
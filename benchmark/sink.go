@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// ResultSink receives the summary of a run at its end. Several sinks can be
+// active at the same time (see -sinks).
+type ResultSink interface {
+	// Name identifies the sink in errors, e.g. "csv:results.csv".
+	Name() string
+	Write(sum Summary) error
+}
+
+// sinkKinds are the kinds of -sinks entries and what their target is.
+var sinkKinds = map[string]string{
+	"console":    "",
+	"json":       "directory",
+	"jsonl":      "file",
+	"csv":        "file",
+	"prometheus": "file or Pushgateway URL",
+	"cloudwatch": "namespace",
+	"s3":         "S3 URI",
+}
+
+// parseSinks parses -sinks: comma separated "<kind>[:<target>]", e.g.
+// "console,csv:results.csv,cloudwatch:DynamoDBBenchmark".
+func parseSinks(spec string) ([][2]string, error) {
+	var sinks [][2]string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kind, target := entry, ""
+		if i := strings.Index(entry, ":"); i >= 0 {
+			kind, target = entry[:i], entry[i+1:]
+		}
+		want, ok := sinkKinds[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown sink %q; must be one of console, json, jsonl, csv, prometheus, cloudwatch, s3", kind)
+		}
+		if want == "" && target != "" {
+			return nil, fmt.Errorf("sink %s takes no target (got %q)", kind, target)
+		}
+		if want != "" && target == "" {
+			return nil, fmt.Errorf("sink %s needs a %s, e.g. %s:<%s>", kind, want, kind, want)
+		}
+		if kind == "s3" {
+			if _, _, err := parseS3URI(target); err != nil {
+				return nil, err
+			}
+		}
+		sinks = append(sinks, [2]string{kind, target})
+	}
+	return sinks, nil
+}
+
+// resultSinks returns the sinks of -sinks, followed by those of
+// -results-dir, -results-history and -results-s3-uri.
+func (c *DynamoDBBenchmark) resultSinks() []ResultSink {
+	entries, _ := parseSinks(c.Sinks)
+	if c.ResultsDir != "" {
+		entries = append(entries, [2]string{"json", c.ResultsDir})
+	}
+	if c.ResultsHistory != "" {
+		entries = append(entries, [2]string{"jsonl", c.ResultsHistory})
+	}
+	if c.ResultsS3URI != "" {
+		entries = append(entries, [2]string{"s3", c.ResultsS3URI})
+	}
+	var sinks []ResultSink
+	for _, e := range entries {
+		name := e[0]
+		if e[1] != "" {
+			name += ":" + e[1]
+		}
+		var sink ResultSink
+		switch target := e[1]; e[0] {
+		case "console":
+			sink = funcSink{name, func(sum Summary) error {
+				if logger != nil {
+					logger.Summary(sum)
+				} else {
+					sum.Print()
+				}
+				return nil
+			}}
+		case "json":
+			sink = funcSink{name, func(sum Summary) error {
+				path, err := writeResults(target, sum)
+				if err == nil && (c.Verbose || c.K8sFriendly) {
+					fmt.Printf("Results written to %s\n", path)
+				}
+				return err
+			}}
+		case "jsonl":
+			sink = funcSink{name, func(sum Summary) error { return appendResultsHistory(target, sum) }}
+		case "csv":
+			sink = funcSink{name, func(sum Summary) error { return appendResultsCSV(target, sum) }}
+		case "prometheus":
+			sink = funcSink{name, func(sum Summary) error { return writePrometheus(target, sum) }}
+		case "cloudwatch":
+			sink = funcSink{name, func(sum Summary) error { return c.putCloudWatchMetrics(target, sum) }}
+		case "s3":
+			sink = funcSink{name, func(sum Summary) error { return c.uploadResults(target, sum) }}
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks
+}
+
+// funcSink is a ResultSink calling a function.
+type funcSink struct {
+	name  string
+	write func(sum Summary) error
+}
+
+func (s funcSink) Name() string {
+	return s.name
+}
+
+func (s funcSink) Write(sum Summary) error {
+	return s.write(sum)
+}
+
+// writeSinks writes sum to every sink, also after one failed, and returns
+// the first error; the others are printed.
+func writeSinks(sinks []ResultSink, sum Summary) error {
+	var first error
+	for _, sink := range sinks {
+		err := sink.Write(sum)
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("sink %s: %v", sink.Name(), err)
+		if first == nil {
+			first = err
+		} else {
+			fmt.Printf("[ERROR] %v\n", err)
+		}
+	}
+	return first
+}
+
+var resultsCSVHeader = []string{"run_id", "time", "action", "operation", "success", "errors", "duration_sec",
+	"requests_per_sec", "average_ms", "p50_ms", "p90_ms", "p99_ms", "p999_ms", "max_ms"}
+
+// appendResultsCSV appends a row per operation of sum to path, with a header
+// if the file is new.
+func appendResultsCSV(path string, sum Summary) error {
+	info, err := os.Stat(path)
+	header := err != nil || info.Size() == 0
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open results CSV: %v", err)
+	}
+	w := csv.NewWriter(f)
+	if header {
+		w.Write(resultsCSVHeader)
+	}
+	now := formatTime(time.Now(), time.RFC3339)
+	f64 := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	for _, op := range sum.Operations {
+		w.Write([]string{
+			sum.RunID, now, sum.Action, op.Operation,
+			strconv.FormatUint(op.Success, 10),
+			strconv.FormatUint(op.Errors, 10),
+			f64(op.DurationSec), f64(op.RequestsPerSecond), f64(op.AverageMs),
+			f64(op.P50Ms), f64(op.P90Ms), f64(op.P99Ms), f64(op.P999Ms), f64(op.MaxMs),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write results CSV: %v", err)
+	}
+	return f.Close()
+}
+
+// prometheusText renders sum in the Prometheus text exposition format.
+func prometheusText(sum Summary) []byte {
+	var b bytes.Buffer
+	labels := func(op string, extra string) string {
+		l := fmt.Sprintf(`run_id=%q,action=%q,operation=%q`, sum.RunID, sum.Action, op)
+		if extra != "" {
+			l += "," + extra
+		}
+		return "{" + l + "}"
+	}
+	fmt.Fprintln(&b, "# HELP dynamodb_benchmark_requests Requests of the run by operation and outcome.")
+	fmt.Fprintln(&b, "# TYPE dynamodb_benchmark_requests gauge")
+	for _, op := range sum.Operations {
+		fmt.Fprintf(&b, "dynamodb_benchmark_requests%s %d\n", labels(op.Operation, `outcome="success"`), op.Success)
+		fmt.Fprintf(&b, "dynamodb_benchmark_requests%s %d\n", labels(op.Operation, `outcome="error"`), op.Errors)
+	}
+	fmt.Fprintln(&b, "# HELP dynamodb_benchmark_requests_per_second Throughput of the run by operation.")
+	fmt.Fprintln(&b, "# TYPE dynamodb_benchmark_requests_per_second gauge")
+	for _, op := range sum.Operations {
+		fmt.Fprintf(&b, "dynamodb_benchmark_requests_per_second%s %g\n", labels(op.Operation, ""), op.RequestsPerSecond)
+	}
+	fmt.Fprintln(&b, "# HELP dynamodb_benchmark_latency_seconds Latency of the run by operation.")
+	fmt.Fprintln(&b, "# TYPE dynamodb_benchmark_latency_seconds summary")
+	for _, op := range sum.Operations {
+		for _, q := range []struct {
+			quantile string
+			ms       float64
+		}{{"0.5", op.P50Ms}, {"0.9", op.P90Ms}, {"0.99", op.P99Ms}, {"0.999", op.P999Ms}} {
+			fmt.Fprintf(&b, "dynamodb_benchmark_latency_seconds%s %g\n", labels(op.Operation, `quantile="`+q.quantile+`"`), q.ms/1000)
+		}
+		n := op.Success + op.Errors
+		fmt.Fprintf(&b, "dynamodb_benchmark_latency_seconds_sum%s %g\n", labels(op.Operation, ""), op.AverageMs*float64(n)/1000)
+		fmt.Fprintf(&b, "dynamodb_benchmark_latency_seconds_count%s %d\n", labels(op.Operation, ""), n)
+	}
+	return b.Bytes()
+}
+
+// writePrometheus writes sum in the Prometheus text format to target: an
+// http(s) URL of a Pushgateway, pushed as the job "dynamodb_benchmark", or a
+// file, e.g. for the textfile collector of the node exporter, written
+// through a temporary file so that it is never read half written.
+func writePrometheus(target string, sum Summary) error {
+	text := prometheusText(sum)
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		u := strings.TrimRight(target, "/") + "/metrics/job/dynamodb_benchmark/run_id/" + url.PathEscape(sum.RunID)
+		req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(text))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("Pushgateway responded %s", resp.Status)
+		}
+		return nil
+	}
+	tmp := target + ".tmp"
+	if err := ioutil.WriteFile(tmp, text, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// putCloudWatchMetrics publishes the throughput, errors and latency of every
+// operation of sum to the CloudWatch namespace, with the dimensions Action
+// and Operation, using the default credentials and region.
+func (c *DynamoDBBenchmark) putCloudWatchMetrics(namespace string, sum Summary) error {
+	sess, err := newSession(ClientOptions{RunID: c.RunID})
+	if err != nil {
+		return err
+	}
+	cw := cloudwatch.New(sess)
+	now := time.Now()
+	var data []*cloudwatch.MetricDatum
+	for _, op := range sum.Operations {
+		dimensions := []*cloudwatch.Dimension{
+			{Name: aws.String("Action"), Value: aws.String(sum.Action)},
+			{Name: aws.String("Operation"), Value: aws.String(op.Operation)},
+		}
+		for _, m := range []struct {
+			name  string
+			value float64
+			unit  string
+		}{
+			{"Requests", float64(op.Success + op.Errors), cloudwatch.StandardUnitCount},
+			{"Errors", float64(op.Errors), cloudwatch.StandardUnitCount},
+			{"RequestsPerSecond", op.RequestsPerSecond, cloudwatch.StandardUnitCountSecond},
+			{"AverageLatency", op.AverageMs, cloudwatch.StandardUnitMilliseconds},
+			{"P50Latency", op.P50Ms, cloudwatch.StandardUnitMilliseconds},
+			{"P99Latency", op.P99Ms, cloudwatch.StandardUnitMilliseconds},
+		} {
+			data = append(data, &cloudwatch.MetricDatum{
+				MetricName: aws.String(m.name),
+				Dimensions: dimensions,
+				Timestamp:  aws.Time(now),
+				Value:      aws.Float64(m.value),
+				Unit:       aws.String(m.unit),
+			})
+		}
+	}
+	// PutMetricData takes up to 1000 metrics per request.
+	for len(data) > 0 {
+		n := len(data)
+		if n > 1000 {
+			n = 1000
+		}
+		if _, err := cw.PutMetricData(&cloudwatch.PutMetricDataInput{Namespace: aws.String(namespace), MetricData: data[:n]}); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	if c.Verbose {
+		fmt.Printf("[Verbose] Published the metrics of %d operations to CloudWatch namespace %s\n", len(sum.Operations), namespace)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// skQuerySortKey is the string sort key of the partitions of sk-query.
+const skQuerySortKey = "sk"
+
+// SKCondition is one template of -sk-query: a sort key condition whose
+// boundary values are drawn for every call, so that it matches Items items
+// (begins_with and between) or from 1 to all items of the partition (>=).
+type SKCondition struct {
+	Kind  string
+	Items int
+}
+
+// parseSKQuery parses -sk-query: comma separated "begins_with:<n>",
+// "between:<n>" and ">=". The n of begins_with is a power of 10, the items
+// sharing a prefix of the zero padded sort keys.
+func parseSKQuery(spec string) ([]SKCondition, error) {
+	var conds []SKCondition
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == ">=" {
+			conds = append(conds, SKCondition{Kind: ">="})
+			continue
+		}
+		i := strings.Index(entry, ":")
+		if i < 0 || (entry[:i] != "begins_with" && entry[:i] != "between") {
+			return nil, fmt.Errorf("%q is not begins_with:<n>, between:<n> or >=", entry)
+		}
+		n, err := strconv.Atoi(entry[i+1:])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%s needs a number of items more than 0, got %q", entry[:i], entry[i+1:])
+		}
+		if entry[:i] == "begins_with" && !powerOf10(n) {
+			return nil, fmt.Errorf("begins_with needs a power of 10 (1, 10, 100, ...), got %d", n)
+		}
+		conds = append(conds, SKCondition{Kind: entry[:i], Items: n})
+	}
+	if len(conds) == 0 {
+		return nil, fmt.Errorf("no conditions")
+	}
+	return conds, nil
+}
+
+func powerOf10(n int) bool {
+	p := 1
+	for p < n {
+		p *= 10
+	}
+	return p == n
+}
+
+// skQueryPartitions is the prefix of the partitions of sk-query.
+func (c *DynamoDBBenchmark) skQueryPartitions() string {
+	return c.Id + "-q"
+}
+
+// skQueryWidth is the number of digits of the sort keys of sk-query.
+func (c *DynamoDBBenchmark) skQueryWidth() int {
+	return len(strconv.Itoa(c.SKItems - 1))
+}
+
+// skQueryKey is the sort key of the n-th item (from 0) of a partition.
+func (c *DynamoDBBenchmark) skQueryKey(n int) string {
+	return fmt.Sprintf("%0*d", c.skQueryWidth(), n)
+}
+
+// seedSKQuery writes the -sk-items items of every partition of sk-query.
+func (c *DynamoDBBenchmark) seedSKQuery(db *dynamodb.DynamoDB) error {
+	err := c.putItems(db, c.Partitions*c.SKItems, func(n int) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{
+			"id":           {S: aws.String(c.skQueryPartitions() + "-" + strconv.Itoa((n-1)/c.SKItems+1))},
+			skQuerySortKey: {S: aws.String(c.skQueryKey((n - 1) % c.SKItems))},
+			"age":          {N: aws.String(strconv.Itoa(c.SeedAge))},
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to seed the partitions: %v", err)
+	}
+	if c.Verbose {
+		fmt.Printf("[Verbose] Seeded %d partitions with %d items each\n", c.Partitions, c.SKItems)
+	}
+	return nil
+}
+
+// startSKQueryWorker queries partitions picked by -key-skew out of
+// -partitions with the sort key conditions of -sk-query.
+func (c *DynamoDBBenchmark) startSKQueryWorker(id int, wg *sync.WaitGroup, stats *WorkerStats) {
+	c.runWorker(id, wg, stats, c.newSKQueryOperation)
+}
+
+// skQueryOperation sends the queries of an sk-query session. Each call
+// follows LastEvaluatedKey to the end of the result and is recorded by the
+// kind of its condition and the number of items it matched, e.g.
+// "Query[between 11-100]", along with the time to its first page.
+type skQueryOperation struct {
+	c     *DynamoDBBenchmark
+	db    *dynamodb.DynamoDB
+	stats *WorkerStats
+	rnd   *rand.Rand
+	pick  func() int
+	conds []SKCondition
+}
+
+// skQueryRequest is the Request of an sk-query call.
+type skQueryRequest struct {
+	input *dynamodb.QueryInput
+	kind  string
+}
+
+func (c *DynamoDBBenchmark) newSKQueryOperation(id int, db *dynamodb.DynamoDB, stats *WorkerStats) Operation {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	skew, _ := parseKeySkew(c.KeySkew)
+	conds, _ := parseSKQuery(c.SKQuery)
+	return &skQueryOperation{c: c, db: db, stats: stats, rnd: rnd, pick: skew.picker(rnd, c.Partitions), conds: conds}
+}
+
+func (o *skQueryOperation) Build(i int) *Call {
+	c := o.c
+	cond := o.conds[o.rnd.Intn(len(o.conds))]
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(c.TableName),
+		ExpressionAttributeNames: map[string]*string{"#id": aws.String("id"), "#sk": aws.String(skQuerySortKey)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id": {S: aws.String(c.skQueryPartitions() + "-" + strconv.Itoa(o.pick()))},
+		},
+	}
+	if c.ConsumedCapacity {
+		input.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityIndexes)
+	}
+	if c.Limit > 0 {
+		input.Limit = aws.Int64(int64(c.Limit))
+	}
+	switch cond.Kind {
+	case "begins_with":
+		// The items sharing all but the last log10(n) digits.
+		digits := len(strconv.Itoa(cond.Items)) - 1
+		prefix := c.skQueryKey(o.rnd.Intn(c.SKItems))[:c.skQueryWidth()-digits]
+		input.KeyConditionExpression = aws.String("#id = :id AND begins_with(#sk, :prefix)")
+		input.ExpressionAttributeValues[":prefix"] = &dynamodb.AttributeValue{S: aws.String(prefix)}
+	case "between":
+		from := o.rnd.Intn(c.SKItems - cond.Items + 1)
+		input.KeyConditionExpression = aws.String("#id = :id AND #sk BETWEEN :from AND :to")
+		input.ExpressionAttributeValues[":from"] = &dynamodb.AttributeValue{S: aws.String(c.skQueryKey(from))}
+		input.ExpressionAttributeValues[":to"] = &dynamodb.AttributeValue{S: aws.String(c.skQueryKey(from + cond.Items - 1))}
+	case ">=":
+		input.KeyConditionExpression = aws.String("#id = :id AND #sk >= :from")
+		input.ExpressionAttributeValues[":from"] = &dynamodb.AttributeValue{S: aws.String(c.skQueryKey(o.rnd.Intn(c.SKItems)))}
+	}
+	return &Call{Op: "Query[" + cond.Kind + "]", Request: &skQueryRequest{input, cond.Kind}}
+}
+
+func (o *skQueryOperation) Execute(call *Call) error {
+	req := call.Request.(*skQueryRequest)
+	n, pages := 0, 0
+	var first time.Duration
+	start := time.Now()
+	err := o.db.QueryPagesWithContext(call.Context(), req.input, func(out *dynamodb.QueryOutput, last bool) bool {
+		if pages == 0 {
+			first = time.Since(start)
+		}
+		pages++
+		n += len(out.Items)
+		o.stats.RecordCapacity("Query", out.ConsumedCapacity)
+		return true
+	})
+	call.Items = n
+	call.Op = strings.Replace(resultSizeOp(n), "Query[", "Query["+req.kind+" ", 1)
+	if err == nil {
+		o.stats.RecordFirstPage(call.Op, first, pages)
+	}
+	return err
+}
+
+func (o *skQueryOperation) Observe(call *Call, err error) {}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// slaThresholds are the latency thresholds of -sla-buckets, in ascending
+// order. The requests under each one are counted exactly as they are
+// recorded, since the buckets of metrics.Histogram do not line up with them.
+var slaThresholds = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+}
+
+// parseSLABuckets parses -sla-buckets: comma separated durations in
+// ascending order, e.g. "5ms,10ms,25ms,50ms,100ms". An empty list disables
+// the report.
+func parseSLABuckets(spec string) ([]time.Duration, error) {
+	var thresholds []time.Duration
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("%v is not more than 0", d)
+		}
+		if n := len(thresholds); n > 0 && d <= thresholds[n-1] {
+			return nil, fmt.Errorf("%v does not come after %v; the thresholds must be in ascending order", d, thresholds[n-1])
+		}
+		thresholds = append(thresholds, d)
+	}
+	return thresholds, nil
+}
+
+// slaStats counts the operations of one kind faster than each of
+// slaThresholds.
+type slaStats struct {
+	under []uint64
+}
+
+func newSLAStats() *slaStats {
+	return &slaStats{under: make([]uint64, len(slaThresholds))}
+}
+
+func (s *slaStats) record(latency time.Duration) {
+	for i, t := range slaThresholds {
+		if latency < t {
+			s.under[i]++
+		}
+	}
+}
+
+func (s *slaStats) merge(other *slaStats) {
+	for i, n := range other.under {
+		s.under[i] += n
+	}
+}
+
+// summary returns the buckets of operations operations, nil without
+// thresholds.
+func (s *slaStats) summary(operations uint64) []SLABucket {
+	var buckets []SLABucket
+	for i, t := range slaThresholds {
+		buckets = append(buckets, SLABucket{
+			UnderMs:  durationMs(t),
+			Requests: s.under[i],
+			Share:    ratio(s.under[i], operations),
+		})
+	}
+	return buckets
+}
+
+// SLABucket counts the requests faster than UnderMs, errors included, so
+// that "99.2% under 10ms" can be read off without deriving it from the
+// percentiles.
+type SLABucket struct {
+	UnderMs  float64 `json:"under_ms"`
+	Requests uint64  `json:"requests"`
+	Share    float64 `json:"share"`
+}
+
+// addSLABuckets merges the buckets of other into buckets, for
+// MergeSummaries; operations are the requests of both.
+func addSLABuckets(buckets []SLABucket, other []SLABucket, operations uint64) []SLABucket {
+	if buckets == nil {
+		buckets = append([]SLABucket(nil), other...)
+	} else {
+		for i := range other {
+			if i < len(buckets) && buckets[i].UnderMs == other[i].UnderMs {
+				buckets[i].Requests += other[i].Requests
+			}
+		}
+	}
+	for i := range buckets {
+		buckets[i].Share = ratio(buckets[i].Requests, operations)
+	}
+	return buckets
+}
+
+func formatSLABuckets(buckets []SLABucket) string {
+	parts := make([]string, len(buckets))
+	for i, b := range buckets {
+		parts[i] = fmt.Sprintf("%.2f%% under %gms", b.Share*100, b.UnderMs)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SLO is one success criterion of -slo on the summary of the run, e.g.
+// "p99 < 20ms", "error_rate < 0.1%" or "throughput >= 5000".
+type SLO struct {
+	Text string
+	// Operation restricts a latency metric to one operation, e.g. GetItem
+	// in "GetItem.p99 < 10ms"; without it the slowest operation counts.
+	Operation string
+	Metric    string
+	Op        string
+	Value     float64
+}
+
+type SLOResult struct {
+	Criterion string `json:"criterion"`
+	Passed    bool   `json:"passed"`
+	Actual    string `json:"actual"`
+}
+
+var (
+	sloPattern = regexp.MustCompile(`^\s*(?:([A-Za-z]+)\.)?([a-z0-9_.]+)\s*(>=|<=|==|!=|>|<)\s*(\S+)\s*$`)
+	// sloLatencies are the latency metrics in milliseconds by name.
+	sloLatencies = map[string]func(op OpSummary) float64{
+		"average": func(op OpSummary) float64 { return op.AverageMs },
+		"p50":     func(op OpSummary) float64 { return op.P50Ms },
+		"p90":     func(op OpSummary) float64 { return op.P90Ms },
+		"p99":     func(op OpSummary) float64 { return op.P99Ms },
+		"p99.9":   func(op OpSummary) float64 { return op.P999Ms },
+		"max":     func(op OpSummary) float64 { return op.MaxMs },
+	}
+)
+
+// ParseSLOs parses comma separated criteria, or a JSON array of them as a
+// config file gives it. An empty string means no criteria.
+func ParseSLOs(s string) ([]SLO, error) {
+	var texts []string
+	if strings.HasPrefix(strings.TrimSpace(s), "[") {
+		if err := json.Unmarshal([]byte(s), &texts); err != nil {
+			return nil, fmt.Errorf("must be a JSON array of strings: %v", err)
+		}
+	} else if strings.TrimSpace(s) != "" {
+		texts = strings.Split(s, ",")
+	}
+	var slos []SLO
+	for _, text := range texts {
+		m := sloPattern.FindStringSubmatch(text)
+		if m == nil {
+			return nil, fmt.Errorf("invalid criterion %q: must be <metric><op><value>", text)
+		}
+		slo := SLO{Text: strings.TrimSpace(text), Operation: m[1], Metric: m[2], Op: m[3]}
+		value := m[4]
+		var err error
+		switch {
+		case sloLatencies[slo.Metric] != nil:
+			if d, derr := time.ParseDuration(value); derr == nil {
+				slo.Value = durationMs(d)
+			} else {
+				// A plain number is in milliseconds.
+				slo.Value, err = strconv.ParseFloat(value, 64)
+			}
+		case slo.Operation != "":
+			return nil, fmt.Errorf("invalid criterion %q: only latencies can be restricted to an operation", slo.Text)
+		case slo.Metric == "error_rate":
+			if strings.HasSuffix(value, "%") {
+				slo.Value, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+				slo.Value /= 100
+			} else {
+				slo.Value, err = strconv.ParseFloat(value, 64)
+			}
+		case slo.Metric == "throughput" || slo.Metric == "errors" || slo.Metric == "success":
+			slo.Value, err = strconv.ParseFloat(value, 64)
+		default:
+			return nil, fmt.Errorf("invalid criterion %q: unknown metric %q (use average, p50, p90, p99, p99.9, max, error_rate, throughput, errors or success)", slo.Text, slo.Metric)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid criterion %q: cannot parse %q", slo.Text, value)
+		}
+		slos = append(slos, slo)
+	}
+	return slos, nil
+}
+
+// Check evaluates the criterion against the summary of the run.
+func (s SLO) Check(sum Summary) SLOResult {
+	r := SLOResult{Criterion: s.Text}
+	var actual float64
+	switch s.Metric {
+	case "error_rate":
+		actual = ratio(sum.Errors, sum.Success+sum.Errors)
+		r.Actual = fmt.Sprintf("%.4f%%", actual*100)
+	case "throughput":
+		actual = sum.RequestsPerSecond
+		r.Actual = fmt.Sprintf("%.2f requests/sec", actual)
+	case "errors":
+		actual = float64(sum.Errors)
+		r.Actual = strconv.FormatUint(sum.Errors, 10)
+	case "success":
+		actual = float64(sum.Success)
+		r.Actual = strconv.FormatUint(sum.Success, 10)
+	default:
+		metric, found := sloLatencies[s.Metric], false
+		for _, op := range sum.Operations {
+			if s.Operation != "" && op.Operation != s.Operation {
+				continue
+			}
+			if v := metric(op); !found || v > actual {
+				actual = v
+			}
+			found = true
+		}
+		if !found {
+			r.Actual = "no requests"
+			if s.Operation != "" {
+				r.Actual = "no " + s.Operation + " requests"
+			}
+			return r
+		}
+		r.Actual = fmt.Sprintf("%.3fms", actual)
+	}
+	switch s.Op {
+	case ">=":
+		r.Passed = actual >= s.Value
+	case "<=":
+		r.Passed = actual <= s.Value
+	case "==":
+		r.Passed = actual == s.Value
+	case "!=":
+		r.Passed = actual != s.Value
+	case ">":
+		r.Passed = actual > s.Value
+	case "<":
+		r.Passed = actual < s.Value
+	}
+	return r
+}
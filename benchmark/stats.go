@@ -0,0 +1,824 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"benchmark/internal/metrics"
+)
+
+// OpStats accumulates the outcome of a single kind of DynamoDB operation.
+type OpStats struct {
+	Success      uint64
+	Errors       uint64
+	Items        uint64
+	TotalLatency time.Duration
+	MinLatency   time.Duration
+	MaxLatency   time.Duration
+	FirstStart   time.Time
+	LastEnd      time.Time
+	Latency      *metrics.Histogram
+	// Payloads counts the successful attempts whose request and response
+	// sizes were added to RequestBytes and ResponseBytes.
+	Payloads      uint64
+	RequestBytes  uint64
+	ResponseBytes uint64
+	// Capacity is the ConsumedCapacity of the successful attempts, nil
+	// unless -consumed-capacity is given.
+	Capacity *capacityStats
+	// Retries is the attempts behind the operations, nil unless the worker
+	// counts them (see WorkerStats.Attempts).
+	Retries *retryStats
+	// SLA counts the operations under each of -sla-buckets.
+	SLA *slaStats
+	// FirstPage is the time to the first page of the paginated calls, nil
+	// for the operations which are not paginated.
+	FirstPage *firstPageStats
+}
+
+func newOpStats() *OpStats {
+	return &OpStats{Latency: metrics.NewHistogram(), SLA: newSLAStats()}
+}
+
+func (o *OpStats) record(start time.Time, latency time.Duration, items int, err error) {
+	if err != nil {
+		o.Errors++
+	} else {
+		o.Success++
+		o.Items += uint64(items)
+	}
+	if o.Success+o.Errors == 1 || latency < o.MinLatency {
+		o.MinLatency = latency
+	}
+	if latency > o.MaxLatency {
+		o.MaxLatency = latency
+	}
+	o.TotalLatency += latency
+	o.Latency.Record(latency)
+	o.SLA.record(latency)
+	if o.FirstStart.IsZero() || start.Before(o.FirstStart) {
+		o.FirstStart = start
+	}
+	if end := start.Add(latency); end.After(o.LastEnd) {
+		o.LastEnd = end
+	}
+}
+
+func (o *OpStats) merge(other *OpStats) {
+	if other.Success+other.Errors == 0 {
+		return
+	}
+	if o.Success+o.Errors == 0 || other.MinLatency < o.MinLatency {
+		o.MinLatency = other.MinLatency
+	}
+	if other.MaxLatency > o.MaxLatency {
+		o.MaxLatency = other.MaxLatency
+	}
+	o.Success += other.Success
+	o.Errors += other.Errors
+	o.Items += other.Items
+	o.TotalLatency += other.TotalLatency
+	o.Latency.Merge(other.Latency)
+	o.SLA.merge(other.SLA)
+	o.Payloads += other.Payloads
+	o.RequestBytes += other.RequestBytes
+	o.ResponseBytes += other.ResponseBytes
+	if other.Capacity != nil {
+		if o.Capacity == nil {
+			o.Capacity = &capacityStats{}
+		}
+		o.Capacity.merge(other.Capacity)
+	}
+	if other.Retries != nil {
+		if o.Retries == nil {
+			o.Retries = &retryStats{}
+		}
+		o.Retries.merge(other.Retries)
+	}
+	if other.FirstPage != nil {
+		if o.FirstPage == nil {
+			o.FirstPage = &firstPageStats{}
+		}
+		o.FirstPage.merge(other.FirstPage)
+	}
+	if o.FirstStart.IsZero() || other.FirstStart.Before(o.FirstStart) {
+		o.FirstStart = other.FirstStart
+	}
+	if other.LastEnd.After(o.LastEnd) {
+		o.LastEnd = other.LastEnd
+	}
+}
+
+func mergeOps(dst map[string]*OpStats, src map[string]*OpStats) {
+	for name, o := range src {
+		d, ok := dst[name]
+		if !ok {
+			d = newOpStats()
+			dst[name] = d
+		}
+		d.merge(o)
+	}
+}
+
+// WorkerStats records the results of a single worker. Latencies go into
+// fixed-size histograms, so memory does not grow with the number of
+// requests. Besides the totals it keeps a second set of counters for the
+// current interval, which are reset on every checkpoint.
+type WorkerStats struct {
+	mu          sync.Mutex
+	id          int
+	ops         map[string]*OpStats
+	intervalOps map[string]*OpStats
+	log         *RequestLog
+	timeline    *Timeline
+	isolation   *Timeline
+	partitions  *PartitionEstimator
+	errors      *ErrorSamples
+	attempts    *AttemptCounter
+	breaker     *CircuitBreaker
+	lastErr     error
+	finished    bool
+}
+
+// Record adds the outcome of one logical operation (including its retries)
+// that started at start and took latency to complete. items is the number of
+// items the operation touched, which is more than 1 for batch and
+// transactional operations.
+func (w *WorkerStats) Record(op string, start time.Time, latency time.Duration, items int, err error) {
+	w.record(op, start, latency, items, err, w.attempts)
+}
+
+// RecordCall is Record for a call which counted its own attempts (see
+// withAttempts), of which the attempts of the session know nothing.
+func (w *WorkerStats) RecordCall(op string, start time.Time, latency time.Duration, items int, err error, attempts *AttemptCounter) {
+	w.mu.Lock()
+	counting := w.attempts != nil
+	w.mu.Unlock()
+	if !counting {
+		attempts = nil
+	}
+	w.record(op, start, latency, items, err, attempts)
+}
+
+func (w *WorkerStats) record(op string, start time.Time, latency time.Duration, items int, err error, counter *AttemptCounter) {
+	attempts, polls, counted := counter.take()
+	w.mu.Lock()
+	for _, ops := range []map[string]*OpStats{w.ops, w.intervalOps} {
+		o, ok := ops[op]
+		if !ok {
+			o = newOpStats()
+			ops[op] = o
+		}
+		o.record(start, latency, items, err)
+		if counted {
+			if o.Retries == nil {
+				o.Retries = &retryStats{}
+			}
+			o.Retries.record(attempts, polls, err)
+		}
+	}
+	if err != nil {
+		w.lastErr = err
+	}
+	w.mu.Unlock()
+
+	if w.log != nil {
+		w.log.Write(w.id, op, start, latency, err)
+	}
+	w.timeline.Record(start, latency, err)
+	w.isolation.Record(start, latency, err)
+	w.partitions.Record(op, start, items, err)
+	w.errors.Record(op, start, err)
+	w.breaker.Record(err)
+}
+
+// Attempts returns the counter of the HTTP attempts of the worker, which its
+// client counts (see ClientOptions.Attempts) and Record attributes to the
+// operation it records.
+func (w *WorkerStats) Attempts() *AttemptCounter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.attempts == nil {
+		w.attempts = &AttemptCounter{}
+	}
+	return w.attempts
+}
+
+// RecordPayload adds the marshalled request and response size of one
+// successful attempt of op.
+func (w *WorkerStats) RecordPayload(op string, request int, response int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ops := range []map[string]*OpStats{w.ops, w.intervalOps} {
+		o, ok := ops[op]
+		if !ok {
+			o = newOpStats()
+			ops[op] = o
+		}
+		o.Payloads++
+		o.RequestBytes += uint64(request)
+		o.ResponseBytes += uint64(response)
+	}
+}
+
+// RecordCapacity adds the capacity consumed by one successful attempt of
+// op. A nil cc, i.e. none was requested, is ignored.
+func (w *WorkerStats) RecordCapacity(op string, cc *dynamodb.ConsumedCapacity) {
+	if cc == nil {
+		return
+	}
+	w.partitions.RecordCapacity(cc)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ops := range []map[string]*OpStats{w.ops, w.intervalOps} {
+		o, ok := ops[op]
+		if !ok {
+			o = newOpStats()
+			ops[op] = o
+		}
+		if o.Capacity == nil {
+			o.Capacity = &capacityStats{}
+		}
+		o.Capacity.record(cc)
+	}
+}
+
+// RecordFirstPage adds the time to the first page of one successful
+// paginated call of op, which read pages pages.
+func (w *WorkerStats) RecordFirstPage(op string, latency time.Duration, pages int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ops := range []map[string]*OpStats{w.ops, w.intervalOps} {
+		o, ok := ops[op]
+		if !ok {
+			o = newOpStats()
+			ops[op] = o
+		}
+		if o.FirstPage == nil {
+			o.FirstPage = &firstPageStats{}
+		}
+		o.FirstPage.record(latency, pages)
+	}
+}
+
+// Finish marks the worker as done with its calls.
+func (w *WorkerStats) Finish() {
+	w.mu.Lock()
+	w.finished = true
+	w.mu.Unlock()
+}
+
+// WorkerStatus is the progress of one worker, for live displays.
+type WorkerStatus struct {
+	ID        int
+	Requests  uint64
+	Errors    uint64
+	Finished  bool
+	LastError string
+}
+
+func (w *WorkerStats) status() WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	st := WorkerStatus{ID: w.id, Finished: w.finished}
+	for _, o := range w.ops {
+		st.Requests += o.Success + o.Errors
+		st.Errors += o.Errors
+	}
+	if w.lastErr != nil {
+		st.LastError = w.lastErr.Error()
+	}
+	return st
+}
+
+// Stats merges the per-worker statistics of a run. It is safe for concurrent
+// use.
+type Stats struct {
+	mu            sync.Mutex
+	start         time.Time
+	end           time.Time
+	intervalStart time.Time
+	workers       []*WorkerStats
+	log           *RequestLog
+	timeline      *Timeline
+	isolation     *Timeline
+	victim        func(id int) bool
+	partitions    *PartitionEstimator
+	errors        *ErrorSamples
+	breaker       *CircuitBreaker
+}
+
+func NewStats() *Stats {
+	return &Stats{}
+}
+
+// SetRequestLog makes every worker additionally write its raw samples to log.
+func (s *Stats) SetRequestLog(log *RequestLog) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = log
+}
+
+// SetTimeline makes every worker additionally add its operations to tl.
+func (s *Stats) SetTimeline(tl *Timeline) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeline = tl
+}
+
+// SetIsolation makes the workers for which victim is true additionally add
+// their operations to tl.
+func (s *Stats) SetIsolation(tl *Timeline, victim func(id int) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.isolation = tl
+	s.victim = victim
+}
+
+// SetPartitionEstimator makes every worker additionally add the units of its
+// operations to pe.
+func (s *Stats) SetPartitionEstimator(pe *PartitionEstimator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.partitions = pe
+}
+
+// SetErrorSamples makes every worker additionally add its errors to samples.
+func (s *Stats) SetErrorSamples(samples *ErrorSamples) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors = samples
+}
+
+// SetCircuitBreaker feeds the outcome of every operation to breaker.
+func (s *Stats) SetCircuitBreaker(breaker *CircuitBreaker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breaker = breaker
+}
+
+// Worker returns the recorder for the worker with the given id.
+func (s *Stats) Worker(id int) *WorkerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := &WorkerStats{
+		id:          id,
+		ops:         map[string]*OpStats{},
+		intervalOps: map[string]*OpStats{},
+		log:         s.log,
+		timeline:    s.timeline,
+		partitions:  s.partitions,
+		errors:      s.errors,
+		breaker:     s.breaker,
+	}
+	if s.victim != nil && s.victim(id) {
+		w.isolation = s.isolation
+	}
+	s.workers = append(s.workers, w)
+	return w
+}
+
+// Start marks the beginning of the measured run.
+func (s *Stats) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start = time.Now()
+	s.intervalStart = s.start
+}
+
+// Stop marks the end of the measured run.
+func (s *Stats) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.end = time.Now()
+}
+
+type OpSummary struct {
+	Operation         string  `json:"operation"`
+	Success           uint64  `json:"success"`
+	Errors            uint64  `json:"errors"`
+	Items             uint64  `json:"items"`
+	DurationSec       float64 `json:"duration_sec"`
+	RequestsPerSecond float64 `json:"requests_per_sec"`
+	ItemsPerSecond    float64 `json:"items_per_sec"`
+	AverageMs         float64 `json:"average_ms"`
+	MinMs             float64 `json:"min_ms"`
+	MaxMs             float64 `json:"max_ms"`
+	P50Ms             float64 `json:"p50_ms"`
+	P90Ms             float64 `json:"p90_ms"`
+	P99Ms             float64 `json:"p99_ms"`
+	P999Ms            float64 `json:"p999_ms"`
+	// Payloads is the number of attempts the average payload sizes are
+	// computed from; 0 unless -return-values or -projection is given.
+	Payloads         uint64  `json:"payloads,omitempty"`
+	AvgRequestBytes  float64 `json:"avg_request_bytes,omitempty"`
+	AvgResponseBytes float64 `json:"avg_response_bytes,omitempty"`
+	// Capacity is only set with -consumed-capacity.
+	Capacity *CapacitySummary `json:"consumed_capacity,omitempty"`
+	// Retries is only set for the workloads which count their attempts.
+	Retries *RetrySummary `json:"retries,omitempty"`
+	// SLABuckets counts the requests under each of -sla-buckets.
+	SLABuckets []SLABucket `json:"sla_buckets,omitempty"`
+	// FirstPage is only set for paginated operations.
+	FirstPage *FirstPageSummary `json:"first_page,omitempty"`
+	// Histogram holds the latency histogram as metrics.Histogram.Buckets so
+	// that the summaries of several processes can be merged exactly. Only
+	// set by IncludeHistograms.
+	Histogram [][2]uint64 `json:"histogram,omitempty"`
+
+	latency *metrics.Histogram
+}
+
+type Summary struct {
+	// SchemaVersion is resultsSchemaVersion (see "results schema").
+	SchemaVersion       int                     `json:"schema_version"`
+	RunID               string                  `json:"run_id,omitempty"`
+	Action              string                  `json:"action"`
+	Success             uint64                  `json:"success"`
+	Errors              uint64                  `json:"errors"`
+	Items               uint64                  `json:"items"`
+	DurationSec         float64                 `json:"duration_sec"`
+	RequestsPerSecond   float64                 `json:"requests_per_sec"`
+	ItemsPerSecond      float64                 `json:"items_per_sec"`
+	AverageMs           float64                 `json:"average_ms"`
+	SLABuckets          []SLABucket             `json:"sla_buckets,omitempty"`
+	Operations          []OpSummary             `json:"operations"`
+	ClockSkew           *SkewEstimate           `json:"clock_skew,omitempty"`
+	CircuitBreaker      []string                `json:"circuit_breaker,omitempty"`
+	ErrorSamples        *ErrorSampleSummary     `json:"error_samples,omitempty"`
+	Contention          *ContentionSummary      `json:"contention,omitempty"`
+	Assertions          []AssertionResult       `json:"assertions,omitempty"`
+	SLOs                []SLOResult             `json:"slos,omitempty"`
+	Linearizability     *LinearizabilityResult  `json:"linearizability,omitempty"`
+	Runtime             *RuntimeSummary         `json:"runtime,omitempty"`
+	Backpressure        *BackpressureSummary    `json:"backpressure,omitempty"`
+	Roles               []RoleSummary           `json:"roles,omitempty"`
+	Pools               []PoolSummary           `json:"pools,omitempty"`
+	Connections         *ConnSummary            `json:"connections,omitempty"`
+	Proxy               *ProxySummary           `json:"proxy,omitempty"`
+	Phases              []PhaseSummary          `json:"latency_breakdown,omitempty"`
+	Backup              *EventSummary           `json:"backup,omitempty"`
+	IndexBuild          *EventSummary           `json:"index_build,omitempty"`
+	Scaling             *ScalingSummary         `json:"scaling,omitempty"`
+	Session             *SessionSummary         `json:"session,omitempty"`
+	HotKeyShifts        []HotKeyShift           `json:"hot_key_shifts,omitempty"`
+	TimeSeries          *TimeSeriesSummary      `json:"timeseries,omitempty"`
+	ItemCollection      *ItemCollectionSummary  `json:"item_collection,omitempty"`
+	ItemCollectionSizes *CollectionSizesSummary `json:"item_collection_sizes,omitempty"`
+	Sharding            *ShardSummary           `json:"sharding,omitempty"`
+	Partitions          *PartitionSummary       `json:"partition_estimate,omitempty"`
+	Mix                 []MixShare              `json:"mix,omitempty"`
+	Cache               *CacheSummary           `json:"cache,omitempty"`
+	Compression         *CompressionSummary     `json:"compression,omitempty"`
+	OptimisticLock      *OptimisticLockSummary  `json:"optimistic_lock,omitempty"`
+	Pipeline            *PipelineSummary        `json:"pipeline,omitempty"`
+	Isolation           *IsolationSummary       `json:"isolation,omitempty"`
+}
+
+// RoleSummary is the outcome of the sessions of one -role-arns entry.
+type RoleSummary struct {
+	Role              string  `json:"role"`
+	Sessions          int     `json:"sessions"`
+	Success           uint64  `json:"success"`
+	Errors            uint64  `json:"errors"`
+	RequestsPerSecond float64 `json:"requests_per_sec"`
+	AverageMs         float64 `json:"average_ms"`
+	P99Ms             float64 `json:"p99_ms"`
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// averageMs returns the mean latency in milliseconds, or 0 when there are no
+// samples, so the summary never contains NaN or a division by zero.
+func averageMs(total time.Duration, samples uint64) float64 {
+	if samples == 0 {
+		return 0
+	}
+	return durationMs(total) / float64(samples)
+}
+
+// perSecond returns count/seconds, or 0 for an empty interval.
+func perSecond(count uint64, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(count) / seconds
+}
+
+// Summary computes the aggregate view of everything recorded so far.
+func (s *Stats) Summary(action string) Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := s.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	ops := map[string]*OpStats{}
+	for _, w := range s.workers {
+		w.mu.Lock()
+		mergeOps(ops, w.ops)
+		w.mu.Unlock()
+	}
+	return summarize(action, ops, s.start, end)
+}
+
+// GroupSummaries computes one summary per group of workers, e.g. per IAM
+// role, where group maps a worker id to its group.
+func (s *Stats) GroupSummaries(action string, group func(id int) string) map[string]Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := s.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	ops := map[string]map[string]*OpStats{}
+	for _, w := range s.workers {
+		g := group(w.id)
+		if ops[g] == nil {
+			ops[g] = map[string]*OpStats{}
+		}
+		w.mu.Lock()
+		mergeOps(ops[g], w.ops)
+		w.mu.Unlock()
+	}
+	sums := map[string]Summary{}
+	for g, o := range ops {
+		sums[g] = summarize(action, o, s.start, end)
+	}
+	return sums
+}
+
+// Workers returns the progress of every worker, ordered by id.
+func (s *Stats) Workers() []WorkerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]WorkerStatus, 0, len(s.workers))
+	for _, w := range s.workers {
+		statuses = append(statuses, w.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ID < statuses[j].ID })
+	return statuses
+}
+
+// IntervalSummary computes the view of what was recorded since the previous
+// call (or the start of the run) and resets the interval counters.
+func (s *Stats) IntervalSummary(action string) Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	ops := map[string]*OpStats{}
+	for _, w := range s.workers {
+		w.mu.Lock()
+		mergeOps(ops, w.intervalOps)
+		w.intervalOps = map[string]*OpStats{}
+		w.mu.Unlock()
+	}
+	sum := summarize(action, ops, s.intervalStart, now)
+	s.intervalStart = now
+	return sum
+}
+
+func summarize(action string, ops map[string]*OpStats, start time.Time, end time.Time) Summary {
+	sum := Summary{
+		SchemaVersion: resultsSchemaVersion,
+		Action:        action,
+		Operations:    []OpSummary{},
+	}
+	if !start.IsZero() {
+		sum.DurationSec = end.Sub(start).Seconds()
+	}
+
+	names := make([]string, 0, len(ops))
+	for name := range ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var totalLatency time.Duration
+	for _, name := range names {
+		o := ops[name]
+		samples := o.Success + o.Errors
+		op := OpSummary{
+			Operation: name,
+			Success:   o.Success,
+			Errors:    o.Errors,
+			Items:     o.Items,
+			AverageMs: averageMs(o.TotalLatency, samples),
+			// Per-operation throughput is relative to the whole run so that
+			// the operations of a mixed workload add up to the overall rate.
+			RequestsPerSecond: perSecond(samples, sum.DurationSec),
+			ItemsPerSecond:    perSecond(o.Items, sum.DurationSec),
+			Payloads:          o.Payloads,
+			AvgRequestBytes:   ratio(o.RequestBytes, o.Payloads),
+			AvgResponseBytes:  ratio(o.ResponseBytes, o.Payloads),
+			Capacity:          o.Capacity.summary(),
+			Retries:           o.Retries.summary(samples),
+			SLABuckets:        o.SLA.summary(samples),
+			FirstPage:         o.FirstPage.summary(),
+		}
+		if samples > 0 {
+			op.DurationSec = o.LastEnd.Sub(o.FirstStart).Seconds()
+			op.MinMs = durationMs(o.MinLatency)
+			op.MaxMs = durationMs(o.MaxLatency)
+			op.P50Ms = durationMs(o.Latency.Percentile(50))
+			op.P90Ms = durationMs(o.Latency.Percentile(90))
+			op.P99Ms = durationMs(o.Latency.Percentile(99))
+			op.P999Ms = durationMs(o.Latency.Percentile(99.9))
+			op.latency = o.Latency
+		}
+		sum.Operations = append(sum.Operations, op)
+		sum.Success += o.Success
+		sum.Errors += o.Errors
+		sum.Items += o.Items
+		sum.SLABuckets = addSLABuckets(sum.SLABuckets, op.SLABuckets, sum.Success+sum.Errors)
+		totalLatency += o.TotalLatency
+	}
+	sum.AverageMs = averageMs(totalLatency, sum.Success+sum.Errors)
+	sum.RequestsPerSecond = perSecond(sum.Success+sum.Errors, sum.DurationSec)
+	sum.ItemsPerSecond = perSecond(sum.Items, sum.DurationSec)
+	return sum
+}
+
+// IncludeHistograms adds the latency histogram of every operation to the
+// summary, e.g. for "orchestrate" to merge the results of several jobs.
+func (sum *Summary) IncludeHistograms() {
+	for i := range sum.Operations {
+		if h := sum.Operations[i].latency; h != nil {
+			sum.Operations[i].Histogram = h.Buckets()
+		}
+	}
+}
+
+func (sum Summary) Print() {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Summary - %s\n", sum.Action)
+	fmt.Println("-----------------------")
+	if sum.RunID != "" {
+		fmt.Printf("Run ID: %s\n", sum.RunID)
+	}
+	fmt.Printf("Sent messages: %v\n", sum.Success)
+	fmt.Printf("Errors: %v\n", sum.Errors)
+	fmt.Printf("Duration (sec): %.3f\n", sum.DurationSec)
+	fmt.Printf("Average (ms): %.3f\n", sum.AverageMs)
+	fmt.Printf("Throughput (requests/sec): %.2f\n", sum.RequestsPerSecond)
+	if len(sum.SLABuckets) > 0 {
+		fmt.Printf("Latency SLA buckets: %s\n", formatSLABuckets(sum.SLABuckets))
+	}
+	if sum.ErrorSamples != nil {
+		sum.ErrorSamples.Print()
+	}
+	for _, trip := range sum.CircuitBreaker {
+		fmt.Printf("Circuit breaker: %s\n", trip)
+	}
+	if ct := sum.Contention; ct != nil {
+		fmt.Printf("Contention: %s (conflicts %d (%.2f%%), throttles %d (%.2f%%), %.2f interleaved updates per update)\n",
+			ct.Diagnosis, ct.Conflicts, ct.ConflictRate*100, ct.Throttles, ct.ThrottleRate*100, ct.Interleaved)
+	}
+	if r := sum.Runtime; r != nil {
+		fmt.Printf("Client runtime: %s\n", r)
+		if r.Warning != "" {
+			fmt.Printf("[WARN] %s\n", r.Warning)
+		}
+	}
+	if b := sum.Backpressure; b != nil && b.Samples > 0 {
+		fmt.Printf("Backpressure: %s\n", b)
+		if b.Warning != "" {
+			fmt.Printf("[WARN] %s\n", b.Warning)
+		}
+	}
+	if sum.Proxy != nil {
+		sum.Proxy.Print()
+	}
+	if cs := sum.Connections; cs != nil {
+		fmt.Printf("Connections: %s\n", cs)
+		for _, w := range cs.Workers {
+			fmt.Printf("[conn session %d] attempts: %d, new: %d, reused: %d, DNS lookups: %d, time to first byte p99 (ms): %.3f\n",
+				w.Worker, w.Attempts, w.NewConns, w.ReusedConns, w.DNSLookups, w.TTFBP99Ms)
+		}
+	}
+	if sum.Backup != nil {
+		sum.Backup.Print()
+	}
+	if sum.IndexBuild != nil {
+		sum.IndexBuild.Print()
+	}
+	if sum.Scaling != nil {
+		sum.Scaling.Print()
+	}
+	if sum.Session != nil {
+		fmt.Printf("Sessions: %s\n", sum.Session)
+	}
+	if sum.TimeSeries != nil {
+		fmt.Printf("Time series: %s\n", sum.TimeSeries)
+	}
+	if sum.ItemCollection != nil {
+		fmt.Printf("Item collections: %s\n", sum.ItemCollection)
+	}
+	if sum.ItemCollectionSizes != nil {
+		sum.ItemCollectionSizes.Print()
+	}
+	if sum.Sharding != nil {
+		fmt.Printf("Sharding: %s\n", sum.Sharding)
+	}
+	if sum.Partitions != nil {
+		sum.Partitions.Print()
+	}
+	for _, s := range sum.HotKeyShifts {
+		fmt.Println(s)
+	}
+	if sum.Isolation != nil {
+		sum.Isolation.Print()
+	}
+	if sum.Pipeline != nil {
+		fmt.Printf("Pipeline: %s\n", sum.Pipeline)
+	}
+	if sum.Cache != nil {
+		fmt.Printf("Read-through cache: %s\n", sum.Cache)
+	}
+	if sum.Compression != nil {
+		sum.Compression.Print()
+	}
+	if sum.OptimisticLock != nil {
+		fmt.Printf("Optimistic lock: %s\n", sum.OptimisticLock)
+	}
+	for _, s := range sum.Mix {
+		fmt.Println(s)
+	}
+	if sum.ClockSkew != nil {
+		fmt.Printf("Estimated clock skew: %s\n", sum.ClockSkew)
+	}
+	for _, a := range sum.Assertions {
+		status := "PASS"
+		if !a.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("Assertion %s: %s (actual %s, expected %s)\n", a.Assertion, status, a.Actual, a.Expected)
+	}
+	for _, r := range sum.SLOs {
+		status := "PASS"
+		if !r.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("SLO %s: %s (actual %s)\n", r.Criterion, status, r.Actual)
+	}
+	if l := sum.Linearizability; l != nil {
+		status := map[string]string{"ok": "PASS", "illegal": "FAIL", "unknown": "UNKNOWN (timed out)"}[l.Result]
+		fmt.Printf("Linearizability: %s (%d operations)\n", status, l.Operations)
+		for _, op := range l.Counterexample {
+			fmt.Printf("  %s\n", op)
+		}
+	}
+	if sum.Items != sum.Success {
+		fmt.Printf("Throughput (items/sec): %.2f\n", sum.ItemsPerSecond)
+	}
+	for _, r := range sum.Roles {
+		fmt.Printf("[role %s] sessions: %d, success: %d, errors: %d, requests/sec: %.2f, average (ms): %.3f, p99 (ms): %.3f\n",
+			r.Role, r.Sessions, r.Success, r.Errors, r.RequestsPerSecond, r.AverageMs, r.P99Ms)
+	}
+	for _, p := range sum.Pools {
+		name := p.Pool
+		if name != p.Action {
+			name += " (" + p.Action + ")"
+		}
+		fmt.Printf("[pool %s] connections: %d, success: %d, errors: %d, requests/sec: %.2f, average (ms): %.3f, p50 (ms): %.3f, p99 (ms): %.3f\n",
+			name, p.Connections, p.Success, p.Errors, p.RequestsPerSecond, p.AverageMs, p.P50Ms, p.P99Ms)
+	}
+	for _, op := range sum.Operations {
+		fmt.Printf("[%s] success: %d, errors: %d, duration (sec): %.3f, requests/sec: %.2f, average (ms): %.3f, min (ms): %.3f, max (ms): %.3f\n",
+			op.Operation, op.Success, op.Errors, op.DurationSec, op.RequestsPerSecond, op.AverageMs, op.MinMs, op.MaxMs)
+		fmt.Printf("[%s] p50 (ms): %.3f, p90 (ms): %.3f, p99 (ms): %.3f, p99.9 (ms): %.3f\n",
+			op.Operation, op.P50Ms, op.P90Ms, op.P99Ms, op.P999Ms)
+		// Batch and transactional operations touch several items per request.
+		if op.Items != op.Success {
+			fmt.Printf("[%s] items: %d, items/sec: %.2f\n", op.Operation, op.Items, op.ItemsPerSecond)
+		}
+		if op.Payloads > 0 {
+			fmt.Printf("[%s] average request (bytes): %.1f, average response (bytes): %.1f\n",
+				op.Operation, op.AvgRequestBytes, op.AvgResponseBytes)
+		}
+		if op.Capacity != nil {
+			fmt.Printf("[%s] consumed capacity units: %s\n", op.Operation, op.Capacity)
+		}
+		if op.Retries != nil {
+			fmt.Printf("[%s] attempts: %s\n", op.Operation, op.Retries)
+		}
+		if len(op.SLABuckets) > 0 {
+			fmt.Printf("[%s] latency SLA buckets: %s\n", op.Operation, formatSLABuckets(op.SLABuckets))
+		}
+		if op.FirstPage != nil {
+			fmt.Printf("[%s] time to first page: %s\n", op.Operation, op.FirstPage)
+		}
+	}
+	for _, p := range sum.Phases {
+		fmt.Println(p)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"benchmark/internal/metrics"
+)
+
+// checkFinite fails for every float field of v, walked recursively, which is
+// NaN or infinite.
+func checkFinite(t *testing.T, path string, v reflect.Value) {
+	t.Helper()
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			t.Errorf("%s is %v", path, f)
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			checkFinite(t, path, v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				checkFinite(t, path+"."+v.Type().Field(i).Name, v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			checkFinite(t, path, v.Index(i))
+		}
+	}
+}
+
+// bucketMs is the latency in milliseconds the summary reports for samples of
+// ms milliseconds: the upper bound of their histogram bucket.
+func bucketMs(ms int) float64 {
+	return durationMs(metrics.UpperBound(time.Duration(ms) * time.Millisecond))
+}
+
+func TestSummaryWithoutSamples(t *testing.T) {
+	for name, record := range map[string]func(w *WorkerStats){
+		"nothing": func(w *WorkerStats) {},
+		// An operation of which every attempt failed has no successes.
+		"errors only": func(w *WorkerStats) {
+			w.Record("GetItem", time.Now(), 0, 0, errors.New("failed"))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := NewStats()
+			s.Start()
+			record(s.Worker(1))
+			s.Stop()
+			sum := s.Summary("read")
+			checkFinite(t, "Summary", reflect.ValueOf(sum))
+			if _, err := json.Marshal(sum); err != nil {
+				t.Errorf("JSON: %v", err)
+			}
+		})
+	}
+
+	// A summary of stats never started, e.g. of a run stopped at once.
+	sum := NewStats().Summary("read")
+	checkFinite(t, "Summary", reflect.ValueOf(sum))
+	if sum.RequestsPerSecond != 0 || sum.AverageMs != 0 || len(sum.Operations) != 0 {
+		t.Errorf("summary of no run: %+v", sum)
+	}
+}
+
+func TestSummaryOperationsSeparate(t *testing.T) {
+	s := NewStats()
+	s.Start()
+	w := s.Worker(1)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		w.Record("GetItem", start, 2*time.Millisecond, 1, nil)
+		w.Record("UpdateItem", start, 10*time.Millisecond, 1, nil)
+	}
+	w.Record("UpdateItem", start, 20*time.Millisecond, 0, errors.New("throttled"))
+	s.Stop()
+
+	sum := s.Summary("mix")
+	if len(sum.Operations) != 2 {
+		t.Fatalf("%d operations; want 2", len(sum.Operations))
+	}
+	read, write := sum.Operations[0], sum.Operations[1]
+	if read.Operation != "GetItem" || read.Success != 4 || read.Errors != 0 || read.AverageMs != 2 || read.MaxMs != 2 {
+		t.Errorf("GetItem: %+v", read)
+	}
+	if write.Operation != "UpdateItem" || write.Success != 4 || write.Errors != 1 || write.AverageMs != 12 || write.MinMs != 10 || write.MaxMs != 20 {
+		t.Errorf("UpdateItem: %+v", write)
+	}
+	if read.DurationSec != 0.002 || write.DurationSec != 0.02 {
+		t.Errorf("durations %v and %v; want 0.002 and 0.02", read.DurationSec, write.DurationSec)
+	}
+	if sum.Success != 8 || sum.Errors != 1 || sum.Items != 8 {
+		t.Errorf("totals %d success, %d errors, %d items; want 8, 1 and 8", sum.Success, sum.Errors, sum.Items)
+	}
+}
+
+func TestSummaryMergesWorkers(t *testing.T) {
+	s := NewStats()
+	s.Start()
+	start := time.Now()
+	a, b := s.Worker(1), s.Worker(2)
+	a.Record("GetItem", start, 1*time.Millisecond, 1, nil)
+	a.Record("GetItem", start.Add(time.Second), 3*time.Millisecond, 1, nil)
+	b.Record("GetItem", start.Add(-time.Second), 8*time.Millisecond, 1, nil)
+	b.Record("GetItem", start, 4*time.Millisecond, 0, errors.New("failed"))
+	s.Stop()
+
+	sum := s.Summary("read")
+	if len(sum.Operations) != 1 {
+		t.Fatalf("%d operations; want 1", len(sum.Operations))
+	}
+	op := sum.Operations[0]
+	if op.Success != 3 || op.Errors != 1 || op.Items != 3 {
+		t.Errorf("%d success, %d errors, %d items; want 3, 1 and 3", op.Success, op.Errors, op.Items)
+	}
+	if op.AverageMs != 4 || op.MinMs != 1 || op.MaxMs != 8 {
+		t.Errorf("average %v, min %v, max %v ms; want 4, 1 and 8", op.AverageMs, op.MinMs, op.MaxMs)
+	}
+	// From the first start of worker 2 to the last end of worker 1.
+	if want := (2*time.Second + 3*time.Millisecond).Seconds(); op.DurationSec != want {
+		t.Errorf("duration %v; want %v", op.DurationSec, want)
+	}
+	if op.P99Ms != bucketMs(8) {
+		t.Errorf("p99 %v ms; want the bucket of 8 ms", op.P99Ms)
+	}
+}
+
+func TestSummaryPercentiles(t *testing.T) {
+	s := NewStats()
+	s.Start()
+	start := time.Now()
+	// Spread over several workers, so that their histograms are merged.
+	for i := 1; i <= 100; i++ {
+		s.Worker(i%4).Record("GetItem", start, time.Duration(i)*time.Millisecond, 1, nil)
+	}
+	s.Stop()
+
+	op := s.Summary("read").Operations[0]
+	for _, c := range []struct {
+		name string
+		got  float64
+		ms   int
+	}{
+		{"p50", op.P50Ms, 50},
+		{"p90", op.P90Ms, 90},
+		{"p99", op.P99Ms, 99},
+		{"p99.9", op.P999Ms, 100},
+	} {
+		if want := bucketMs(c.ms); c.got != want {
+			t.Errorf("%s %v ms; want %v (the bucket of %d ms)", c.name, c.got, want, c.ms)
+		}
+	}
+	if op.MaxMs != 100 || op.MinMs != 1 {
+		t.Errorf("min %v, max %v ms; want 1 and 100", op.MinMs, op.MaxMs)
+	}
+}
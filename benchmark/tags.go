@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// ParseTags parses -tags "key=value,...". Values may be empty, keys may not.
+func ParseTags(spec string) ([]*dynamodb.Tag, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var tags []*dynamodb.Tag
+	seen := map[string]bool{}
+	for _, kv := range strings.Split(spec, ",") {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("-tags wants key=value, got %q", kv)
+		}
+		key := strings.TrimSpace(kv[:i])
+		if seen[key] {
+			return nil, fmt.Errorf("-tags has key %q more than once", key)
+		}
+		seen[key] = true
+		tags = append(tags, &dynamodb.Tag{Key: aws.String(key), Value: aws.String(strings.TrimSpace(kv[i+1:]))})
+	}
+	return tags, nil
+}
+
+// EnsureTags adds the tags that tableName is missing or has with another
+// value. Other tags of the table are kept.
+func EnsureTags(db dynamodbiface.DynamoDBAPI, tableName *string, tags []*dynamodb.Tag, verbose bool) error {
+	out, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: tableName})
+	if err != nil {
+		return err
+	}
+	arn := out.Table.TableArn
+	current := map[string]string{}
+	input := &dynamodb.ListTagsOfResourceInput{ResourceArn: arn}
+	for {
+		page, err := db.ListTagsOfResource(input)
+		if err != nil {
+			return err
+		}
+		for _, t := range page.Tags {
+			current[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+		}
+		if page.NextToken == nil {
+			break
+		}
+		input.NextToken = page.NextToken
+	}
+	var missing []*dynamodb.Tag
+	var keys []string
+	for _, t := range tags {
+		if v, ok := current[*t.Key]; ok && v == *t.Value {
+			continue
+		}
+		missing = append(missing, t)
+		keys = append(keys, *t.Key)
+	}
+	if len(missing) == 0 {
+		fmt.Printf("Table %s already has all %d tags\n", *tableName, len(tags))
+		return nil
+	}
+	if verbose {
+		fmt.Printf("[Verbose] Current tags of %s: %v\n", *tableName, current)
+	}
+	if _, err := db.TagResource(&dynamodb.TagResourceInput{ResourceArn: arn, Tags: missing}); err != nil {
+		return err
+	}
+	sort.Strings(keys)
+	fmt.Printf("Tagged table %s with %s\n", *tableName, strings.Join(keys, ", "))
+	return nil
+}
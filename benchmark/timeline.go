@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+
+	"benchmark/internal/metrics"
+)
+
+// TimelinePoint is one time bucket of the latency timeline.
+type TimelinePoint struct {
+	OffsetSec float64 `json:"offset_sec"`
+	Requests  uint64  `json:"requests"`
+	Errors    uint64  `json:"errors"`
+	// Throttles counts throttled attempts, including those the SDK retried.
+	Throttles uint64  `json:"throttles"`
+	AverageMs float64 `json:"average_ms"`
+	P50Ms     float64 `json:"p50_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+	MaxMs     float64 `json:"max_ms"`
+	// Events are the annotations of the bucket, e.g. the start of a backup.
+	Events []string `json:"events,omitempty"`
+	// RequestsPerSec is the throughput of the bucket and
+	// RequestsPerSecChange its change from the previous bucket per second.
+	RequestsPerSec       float64 `json:"requests_per_sec"`
+	RequestsPerSecChange float64 `json:"requests_per_sec_change"`
+	// ThrottleRate is the share of throttled attempts, taking the attempts
+	// as the requests plus the throttled attempts, and ThrottleRateChange
+	// its change from the previous bucket per second.
+	ThrottleRate       float64 `json:"throttle_rate"`
+	ThrottleRateChange float64 `json:"throttle_rate_change"`
+}
+
+// WindowStats sums up the timeline buckets of a time window.
+type WindowStats struct {
+	Requests          uint64  `json:"requests"`
+	Errors            uint64  `json:"errors"`
+	Throttles         uint64  `json:"throttles"`
+	RequestsPerSecond float64 `json:"requests_per_sec"`
+	AverageMs         float64 `json:"average_ms"`
+	P50Ms             float64 `json:"p50_ms"`
+	P99Ms             float64 `json:"p99_ms"`
+}
+
+type timelineBucket struct {
+	requests     uint64
+	errors       uint64
+	throttles    uint64
+	totalLatency time.Duration
+	maxLatency   time.Duration
+	latency      *metrics.Histogram
+	events       []string
+}
+
+// Timeline buckets every operation by its start time, so latency can be
+// lined up with events during the run. A nil *Timeline records nothing.
+type Timeline struct {
+	mu      sync.Mutex
+	start   time.Time
+	width   time.Duration
+	buckets []*timelineBucket
+}
+
+func NewTimeline(start time.Time, width time.Duration) *Timeline {
+	return &Timeline{start: start, width: width}
+}
+
+// bucket returns the bucket of t, growing the series as needed. The caller
+// holds the lock.
+func (tl *Timeline) bucket(t time.Time) *timelineBucket {
+	i := int(t.Sub(tl.start) / tl.width)
+	if i < 0 {
+		i = 0
+	}
+	for len(tl.buckets) <= i {
+		tl.buckets = append(tl.buckets, &timelineBucket{latency: metrics.NewHistogram()})
+	}
+	return tl.buckets[i]
+}
+
+// Record adds one operation that started at start.
+func (tl *Timeline) Record(start time.Time, latency time.Duration, err error) {
+	if tl == nil {
+		return
+	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	b := tl.bucket(start)
+	b.requests++
+	if err != nil {
+		b.errors++
+	}
+	b.totalLatency += latency
+	if latency > b.maxLatency {
+		b.maxLatency = latency
+	}
+	b.latency.Record(latency)
+}
+
+// handler returns the SDK Retry handler which counts throttled attempts.
+func (tl *Timeline) handler() request.NamedHandler {
+	return request.NamedHandler{Name: "dynamodb-benchmark.Timeline", Fn: func(r *request.Request) {
+		if !isThrottle(r.Error) {
+			return
+		}
+		tl.mu.Lock()
+		defer tl.mu.Unlock()
+		tl.bucket(time.Now()).throttles++
+	}}
+}
+
+// Annotate adds event to the bucket of t.
+func (tl *Timeline) Annotate(t time.Time, event string) {
+	if tl == nil {
+		return
+	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	b := tl.bucket(t)
+	b.events = append(b.events, event)
+}
+
+// Offset returns the time of t relative to the start of the timeline.
+func (tl *Timeline) Offset(t time.Time) time.Duration {
+	return t.Sub(tl.start)
+}
+
+// Series returns the buckets in time order.
+func (tl *Timeline) Series() []TimelinePoint {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	series := make([]TimelinePoint, 0, len(tl.buckets))
+	width := tl.width.Seconds()
+	for i, b := range tl.buckets {
+		p := TimelinePoint{
+			OffsetSec:      (time.Duration(i) * tl.width).Seconds(),
+			Requests:       b.requests,
+			Errors:         b.errors,
+			Throttles:      b.throttles,
+			AverageMs:      averageMs(b.totalLatency, b.requests),
+			P50Ms:          durationMs(b.latency.Percentile(50)),
+			P99Ms:          durationMs(b.latency.Percentile(99)),
+			MaxMs:          durationMs(b.maxLatency),
+			Events:         append([]string(nil), b.events...),
+			RequestsPerSec: perSecond(b.requests, width),
+			ThrottleRate:   ratio(b.throttles, b.requests+b.throttles),
+		}
+		if i > 0 {
+			prev := series[i-1]
+			p.RequestsPerSecChange = (p.RequestsPerSec - prev.RequestsPerSec) / width
+			p.ThrottleRateChange = (p.ThrottleRate - prev.ThrottleRate) / width
+		}
+		series = append(series, p)
+	}
+	return series
+}
+
+// Window sums up the buckets starting in [from, to). A negative to means up
+// to the end of the timeline.
+func (tl *Timeline) Window(from time.Duration, to time.Duration) WindowStats {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	var w WindowStats
+	var total time.Duration
+	var buckets int
+	hist := metrics.NewHistogram()
+	for i, b := range tl.buckets {
+		offset := time.Duration(i) * tl.width
+		if offset < from || (to >= 0 && offset >= to) {
+			continue
+		}
+		buckets++
+		w.Requests += b.requests
+		w.Errors += b.errors
+		w.Throttles += b.throttles
+		total += b.totalLatency
+		hist.Merge(b.latency)
+	}
+	w.RequestsPerSecond = perSecond(w.Requests, (time.Duration(buckets) * tl.width).Seconds())
+	w.AverageMs = averageMs(total, w.Requests)
+	w.P50Ms = durationMs(hist.Percentile(50))
+	w.P99Ms = durationMs(hist.Percentile(99))
+	return w
+}
+
+// WriteCSV writes the series to path, with the events of a bucket joined by
+// "; ".
+func (tl *Timeline) WriteCSV(path string, runID string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create timeline: %v", err)
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"offset_sec", "requests", "errors", "throttles", "average_ms", "p50_ms", "p99_ms", "max_ms", "events", "run_id",
+		"requests_per_sec", "requests_per_sec_change", "throttle_rate", "throttle_rate_change"})
+	for _, p := range tl.Series() {
+		w.Write([]string{
+			strconv.FormatFloat(p.OffsetSec, 'f', 3, 64),
+			strconv.FormatUint(p.Requests, 10),
+			strconv.FormatUint(p.Errors, 10),
+			strconv.FormatUint(p.Throttles, 10),
+			strconv.FormatFloat(p.AverageMs, 'f', 3, 64),
+			strconv.FormatFloat(p.P50Ms, 'f', 3, 64),
+			strconv.FormatFloat(p.P99Ms, 'f', 3, 64),
+			strconv.FormatFloat(p.MaxMs, 'f', 3, 64),
+			strings.Join(p.Events, "; "),
+			runID,
+			strconv.FormatFloat(p.RequestsPerSec, 'f', 3, 64),
+			strconv.FormatFloat(p.RequestsPerSecChange, 'f', 3, 64),
+			strconv.FormatFloat(p.ThrottleRate, 'f', 6, 64),
+			strconv.FormatFloat(p.ThrottleRateChange, 'f', 6, 64),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write timeline: %v", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// timeSeriesSortKey is the numeric sort key of the timeseries table, the
+// time of a point in microseconds since the epoch.
+const timeSeriesSortKey = "ts"
+
+// timeSeriesPartitions is the key prefix of the partitions of the run,
+// "<prefix>-<k>".
+func (c *DynamoDBBenchmark) timeSeriesPartitions() string {
+	return c.Id + "-ts-" + c.RunID
+}
+
+// TimeSeriesSummary is the outcome of the timeseries action.
+type TimeSeriesSummary struct {
+	Partitions int    `json:"partitions"`
+	Points     uint64 `json:"points"`
+	// Dropped counts the points of batches still unprocessed after
+	// -unprocessed-retries resubmissions.
+	Dropped uint64 `json:"dropped"`
+	// Written counts the partitions written at least once.
+	Written                  int     `json:"written_partitions"`
+	PointsPerSec             float64 `json:"points_per_sec"`
+	PointsPerPartitionPerSec float64 `json:"points_per_partition_per_sec"`
+	// MaxPartitionPoints is the number of points of the busiest partition.
+	MaxPartitionPoints uint64 `json:"max_partition_points"`
+}
+
+func (s *TimeSeriesSummary) String() string {
+	return fmt.Sprintf("%d points (%.2f/sec, %.2f/sec per written partition), dropped %d, partitions %d (%d written, busiest %d points)",
+		s.Points, s.PointsPerSec, s.PointsPerPartitionPerSec, s.Dropped, s.Partitions, s.Written, s.MaxPartitionPoints)
+}
+
+// TimeSeries hands out strictly increasing timestamps per partition and
+// counts the points written. A nil *TimeSeries counts nothing.
+type TimeSeries struct {
+	last    []int64
+	points  []uint64
+	dropped uint64
+}
+
+func NewTimeSeries(partitions int) *TimeSeries {
+	return &TimeSeries{last: make([]int64, partitions), points: make([]uint64, partitions)}
+}
+
+// next returns the timestamp of the next point of partition k: now, or
+// one microsecond after the last one if that is not earlier.
+func (ts *TimeSeries) next(k int) int64 {
+	now := time.Now().UnixNano() / 1000
+	for {
+		last := atomic.LoadInt64(&ts.last[k-1])
+		t := now
+		if t <= last {
+			t = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&ts.last[k-1], last, t) {
+			return t
+		}
+	}
+}
+
+func (ts *TimeSeries) written(k int) {
+	if ts == nil {
+		return
+	}
+	atomic.AddUint64(&ts.points[k-1], 1)
+}
+
+func (ts *TimeSeries) drop(n int) {
+	if ts == nil {
+		return
+	}
+	atomic.AddUint64(&ts.dropped, uint64(n))
+}
+
+// Summary sums up the points of a run of the given duration.
+func (ts *TimeSeries) Summary(seconds float64) *TimeSeriesSummary {
+	if ts == nil {
+		return nil
+	}
+	sum := &TimeSeriesSummary{Partitions: len(ts.points), Dropped: atomic.LoadUint64(&ts.dropped)}
+	for i := range ts.points {
+		n := atomic.LoadUint64(&ts.points[i])
+		sum.Points += n
+		if n > 0 {
+			sum.Written++
+		}
+		if n > sum.MaxPartitionPoints {
+			sum.MaxPartitionPoints = n
+		}
+	}
+	sum.PointsPerSec = perSecond(sum.Points, seconds)
+	if sum.Written > 0 {
+		sum.PointsPerPartitionPerSec = sum.PointsPerSec / float64(sum.Written)
+	}
+	return sum
+}
+
+// timeSeriesPoint is the next point of partition k.
+func (c *DynamoDBBenchmark) timeSeriesPoint(k int, rnd *rand.Rand) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"id":              {S: aws.String(c.timeSeriesPartitions() + "-" + strconv.Itoa(k))},
+		timeSeriesSortKey: {N: aws.String(strconv.FormatInt(c.series.next(k), 10))},
+		"value":           {N: aws.String(strconv.FormatFloat(rnd.Float64()*100, 'f', 3, 64))},
+		"run_id":          {S: aws.String(c.RunID)},
+	}
+}
+
+// prefillTimeSeries writes -ts-prefill points to every partition.
+func (c *DynamoDBBenchmark) prefillTimeSeries(db *dynamodb.DynamoDB) error {
+	if c.TimeSeriesPrefill == 0 {
+		return nil
+	}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	err := c.putItems(db, c.Partitions*c.TimeSeriesPrefill, func(n int) map[string]*dynamodb.AttributeValue {
+		return c.timeSeriesPoint((n-1)%c.Partitions+1, rnd)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to prefill the partitions: %v", err)
+	}
+	if c.Verbose {
+		fmt.Printf("[Verbose] Prefilled %d partitions with %d points each\n", c.Partitions, c.TimeSeriesPrefill)
+	}
+	return nil
+}
+
+// startTimeSeriesWorker writes points to partitions picked by -key-skew out
+// of -partitions, one PutItem per call or, with -ts-batch, one
+// BatchWriteItem of that many points. With -ts-query, -ts-query-ratio of the
+// calls query a partition instead.
+func (c *DynamoDBBenchmark) startTimeSeriesWorker(id int, wg *sync.WaitGroup, stats *WorkerStats) {
+	defer wg.Done()
+	defer stats.Finish()
+
+	time.Sleep(c.staggerDelay(id))
+
+	opts := c.sessionClientOptions(id)
+	opts.ConnStats = c.conns.Worker(id)
+	opts.Breakdown = c.breakdown.Worker()
+	opts.Attempts = stats.Attempts()
+	db, err := getDynamoDBClient(opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	skew, _ := parseKeySkew(c.KeySkew)
+	pick := skew.picker(rnd, c.Partitions)
+	query, _ := parseTimeSeriesQuery(c.TimeSeriesQuery)
+	for i := 1; c.moreCalls(id, i); i++ {
+		if query != nil && rnd.Float64() < c.TimeSeriesQueryRatio {
+			k := pick()
+			var n, pages int
+			var first time.Duration
+			start := c.clock.Now()
+			err := retry(c.RetryNum, 2*time.Second, func() (err error) {
+				n, pages, first, err = c.queryTimeSeries(db, query, k)
+				return err
+			})
+			op := "Query"
+			if err == nil {
+				op = resultSizeOp(n)
+				if query.Range > 0 {
+					stats.RecordFirstPage(op, first, pages)
+				}
+			} else if !c.TUI {
+				fmt.Printf("Error: %v\n", err)
+			}
+			stats.Record(op, start, time.Since(start), n, err)
+			continue
+		}
+		if c.TimeSeriesBatch == 1 {
+			k := pick()
+			item := c.timeSeriesPoint(k, rnd)
+			start := c.clock.Now()
+			in := &dynamodb.PutItemInput{TableName: aws.String(c.TableName), Item: item}
+			if c.ItemCollectionMetrics {
+				in.ReturnItemCollectionMetrics = aws.String(dynamodb.ReturnItemCollectionMetricsSize)
+			}
+			err := retry(c.RetryNum, 2*time.Second, func() error {
+				out, err := db.PutItem(in)
+				if err == nil {
+					c.collectionSizes.Record(out.ItemCollectionMetrics)
+				}
+				return err
+			})
+			stats.Record("PutItem", start, time.Since(start), 1, err)
+			if err == nil {
+				c.series.written(k)
+			} else if !c.TUI {
+				fmt.Printf("Error: %v\n", err)
+			}
+			continue
+		}
+
+		var requests []*dynamodb.WriteRequest
+		partitions := map[string]int{}
+		for n := 0; n < c.TimeSeriesBatch; n++ {
+			k := pick()
+			item := c.timeSeriesPoint(k, rnd)
+			partitions[*item["id"].S+"\x00"+*item[timeSeriesSortKey].N] = k
+			requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item}})
+		}
+		input := &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{c.TableName: requests}}
+		if c.ItemCollectionMetrics {
+			input.ReturnItemCollectionMetrics = aws.String(dynamodb.ReturnItemCollectionMetricsSize)
+		}
+		start := c.clock.Now()
+		var err error
+		for n := 0; n <= c.UnprocessedRetries && err == nil && len(input.RequestItems[c.TableName]) > 0; n++ {
+			if n > 0 {
+				time.Sleep(c.unprocessedBackoff(n, rnd))
+			}
+			var out *dynamodb.BatchWriteItemOutput
+			out, err = db.BatchWriteItem(input)
+			if err == nil {
+				c.collectionSizes.RecordBatch(out.ItemCollectionMetrics)
+				input = &dynamodb.BatchWriteItemInput{RequestItems: out.UnprocessedItems, ReturnItemCollectionMetrics: input.ReturnItemCollectionMetrics}
+			}
+		}
+		stats.Record("BatchWriteItem", start, time.Since(start), len(requests), err)
+		if err != nil {
+			c.series.drop(len(requests))
+			if !c.TUI {
+				fmt.Printf("Error: %v\n", err)
+			}
+			continue
+		}
+		unprocessed := map[string]bool{}
+		for _, r := range input.RequestItems[c.TableName] {
+			item := r.PutRequest.Item
+			unprocessed[*item["id"].S+"\x00"+*item[timeSeriesSortKey].N] = true
+		}
+		c.series.drop(len(unprocessed))
+		for key, k := range partitions {
+			if !unprocessed[key] {
+				c.series.written(k)
+			}
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"time"
+	// Embedded so -timezone works on hosts without a zoneinfo database,
+	// e.g. minimal containers.
+	_ "time/tzdata"
+)
+
+// outputLocation is the time zone of every timestamp the benchmark prints or
+// writes (-timezone), UTC unless given, so the output of hosts in different
+// regions lines up.
+var outputLocation = time.UTC
+
+// formatTime formats t in the time zone of -timezone.
+func formatTime(t time.Time, layout string) string {
+	return t.In(outputLocation).Format(layout)
+}
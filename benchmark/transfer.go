@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+const batchWriteMaxItems = 25
+
+type record = map[string]*dynamodb.AttributeValue
+
+// ExportTable scans the table with parallel segments and writes every item
+// to file, either as newline delimited DynamoDB JSON ("json") or as CSV
+// ("csv"). The JSON format is lossless; CSV keeps scalar attributes readable
+// and stores sets, lists and maps as DynamoDB JSON.
+func ExportTable(db dynamodbiface.DynamoDBAPI, tableName *string, file string, format string, parallel int, verbose bool) error {
+	items := make(chan record, 100)
+	errs := make(chan error, parallel)
+
+	var wg sync.WaitGroup
+	for segment := 0; segment < parallel; segment++ {
+		wg.Add(1)
+		go func(segment int) {
+			defer wg.Done()
+			err := db.ScanPages(&dynamodb.ScanInput{
+				TableName:     tableName,
+				Segment:       aws.Int64(int64(segment)),
+				TotalSegments: aws.Int64(int64(parallel)),
+			}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+				for _, item := range page.Items {
+					items <- item
+				}
+				return true
+			})
+			if err != nil {
+				errs <- fmt.Errorf("scan of segment %d failed: %v", segment, err)
+			}
+		}(segment)
+	}
+	go func() {
+		wg.Wait()
+		close(items)
+		close(errs)
+	}()
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var count int
+	if format == "csv" {
+		count, err = writeCSV(f, items)
+	} else {
+		count, err = writeJSONLines(f, items)
+	}
+	// Drain the scanners in case the writer gave up early.
+	for range items {
+	}
+	if err != nil {
+		return err
+	}
+	for scanErr := range errs {
+		return scanErr
+	}
+	if verbose {
+		fmt.Printf("[Verbose] Exported %d items from %s to %s\n", count, *tableName, file)
+	}
+	return f.Close()
+}
+
+func writeJSONLines(w io.Writer, items <-chan record) (int, error) {
+	bw := bufio.NewWriter(w)
+	count := 0
+	for item := range items {
+		b, err := buildWireJSON(item)
+		if err != nil {
+			return count, err
+		}
+		bw.Write(b)
+		bw.WriteByte('\n')
+		count++
+	}
+	return count, bw.Flush()
+}
+
+// csvType returns the CSV column type of an attribute value: the scalar
+// DynamoDB type, or JSON for everything else.
+func csvType(av *dynamodb.AttributeValue) string {
+	switch {
+	case av.S != nil:
+		return "S"
+	case av.N != nil:
+		return "N"
+	case av.B != nil:
+		return "B"
+	case av.BOOL != nil:
+		return "BOOL"
+	case av.NULL != nil:
+		return "NULL"
+	}
+	return "JSON"
+}
+
+func csvValue(av *dynamodb.AttributeValue) (string, error) {
+	switch csvType(av) {
+	case "S":
+		return *av.S, nil
+	case "N":
+		return *av.N, nil
+	case "B":
+		return base64.StdEncoding.EncodeToString(av.B), nil
+	case "BOOL":
+		return fmt.Sprint(*av.BOOL), nil
+	case "NULL":
+		return "", nil
+	}
+	b, err := buildWireJSON(av)
+	return string(b), err
+}
+
+// writeCSV has to know all columns before writing the header, so it buffers
+// the whole table in memory.
+func writeCSV(w io.Writer, items <-chan record) (int, error) {
+	var all []record
+	types := map[string]string{}
+	for item := range items {
+		for name, av := range item {
+			t := csvType(av)
+			if prev, ok := types[name]; ok && prev != t {
+				return 0, fmt.Errorf("attribute %q has mixed types (%s and %s); use -format json", name, prev, t)
+			}
+			types[name] = t
+		}
+		all = append(all, item)
+	}
+
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := csv.NewWriter(w)
+	header := make([]string, len(names))
+	for i, name := range names {
+		header[i] = name + ":" + types[name]
+	}
+	cw.Write(header)
+	for _, item := range all {
+		row := make([]string, len(names))
+		for i, name := range names {
+			if av, ok := item[name]; ok {
+				v, err := csvValue(av)
+				if err != nil {
+					return 0, err
+				}
+				row[i] = v
+			}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return len(all), cw.Error()
+}
+
+func readJSONLines(r io.Reader, items chan<- record) error {
+	scanner := bufio.NewScanner(r)
+	// Items can be up to 400KB.
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		item := record{}
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		items <- item
+	}
+	return scanner.Err()
+}
+
+func parseCSVValue(t string, v string) (*dynamodb.AttributeValue, error) {
+	switch t {
+	case "S":
+		return &dynamodb.AttributeValue{S: aws.String(v)}, nil
+	case "N":
+		return &dynamodb.AttributeValue{N: aws.String(v)}, nil
+	case "B":
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, err
+		}
+		return &dynamodb.AttributeValue{B: b}, nil
+	case "BOOL":
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(v == "true")}, nil
+	case "NULL":
+		return &dynamodb.AttributeValue{NULL: aws.Bool(true)}, nil
+	case "JSON":
+		av := &dynamodb.AttributeValue{}
+		err := json.Unmarshal([]byte(v), av)
+		return av, err
+	}
+	return nil, fmt.Errorf("unknown column type %q", t)
+}
+
+func readCSV(r io.Reader, items chan<- record) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %v", err)
+	}
+	names := make([]string, len(header))
+	types := make([]string, len(header))
+	for i, col := range header {
+		idx := strings.LastIndex(col, ":")
+		if idx < 0 {
+			return fmt.Errorf("CSV column %q must be <name>:<type>", col)
+		}
+		names[i], types[i] = col[:idx], col[idx+1:]
+	}
+	line := 1
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line++
+		item := record{}
+		for i, v := range row {
+			// Empty cells are attributes the item does not have.
+			if v == "" && types[i] != "S" && types[i] != "NULL" {
+				continue
+			}
+			av, err := parseCSVValue(types[i], v)
+			if err != nil {
+				return fmt.Errorf("line %d, column %s: %v", line, header[i], err)
+			}
+			item[names[i]] = av
+		}
+		items <- item
+	}
+}
+
+// batchWrite writes up to 25 items and re-submits unprocessed items with
+// exponential backoff.
+func batchWrite(db dynamodbiface.DynamoDBAPI, tableName string, batch []record) error {
+	requests := make([]*dynamodb.WriteRequest, len(batch))
+	for i, item := range batch {
+		requests[i] = &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item}}
+	}
+	backoff := 50 * time.Millisecond
+	for attempt := 1; len(requests) > 0; attempt++ {
+		out, err := db.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{tableName: requests},
+		})
+		if err != nil {
+			return err
+		}
+		requests = out.UnprocessedItems[tableName]
+		if len(requests) > 0 {
+			if attempt >= 10 {
+				return fmt.Errorf("%d items still unprocessed after %d attempts", len(requests), attempt)
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return nil
+}
+
+// ImportTable reads items exported by ExportTable from file and writes them
+// to the table with parallel BatchWriteItem calls.
+func ImportTable(db dynamodbiface.DynamoDBAPI, tableName *string, file string, format string, parallel int, verbose bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	items := make(chan record, 100)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(items)
+		if format == "csv" {
+			readErr <- readCSV(f, items)
+		} else {
+			readErr <- readJSONLines(f, items)
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		imported int
+		firstErr error
+	)
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			flush := func(batch []record) {
+				if len(batch) == 0 {
+					return
+				}
+				err := batchWrite(db, *tableName, batch)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if err == nil {
+					imported += len(batch)
+				}
+			}
+			var batch []record
+			for item := range items {
+				batch = append(batch, item)
+				if len(batch) == batchWriteMaxItems {
+					flush(batch)
+					batch = nil
+				}
+			}
+			flush(batch)
+		}()
+	}
+	wg.Wait()
+
+	if err := <-readErr; err != nil {
+		return fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	if firstErr != nil {
+		return fmt.Errorf("import failed after %d items: %v", imported, firstErr)
+	}
+	if verbose {
+		fmt.Printf("[Verbose] Imported %d items from %s into %s\n", imported, file, *tableName)
+	}
+	return nil
+}
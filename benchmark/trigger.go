@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+
+	"benchmark/internal/table"
+)
+
+// triggerTag is the tag of the functions deploy-trigger creates; remove-trigger
+// and redeploys only touch functions which carry it.
+const triggerTag = "dynamodb-benchmark"
+
+// TriggerOptions is the Lambda function deploy-trigger deploys on the stream of
+// a table.
+type TriggerOptions struct {
+	Function  string
+	Zip       string
+	Role      string
+	Runtime   string
+	Handler   string
+	BatchSize int64
+}
+
+// triggerFunction returns the function of -function, "<table>-pipeline" by
+// default.
+func triggerFunction(function string, tableName string) string {
+	if function == "" {
+		return tableName + "-pipeline"
+	}
+	return function
+}
+
+// tableStream returns the ARN of the stream of tableName, enabling the stream
+// with new and old images first if it is off.
+func tableStream(db dynamodbiface.DynamoDBAPI, tableName *string, verbose bool) (string, error) {
+	out, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: tableName})
+	if err != nil {
+		return "", err
+	}
+	if spec := out.Table.StreamSpecification; spec != nil && aws.BoolValue(spec.StreamEnabled) {
+		return aws.StringValue(out.Table.LatestStreamArn), nil
+	}
+	_, err = db.UpdateTable(&dynamodb.UpdateTableInput{
+		TableName: tableName,
+		StreamSpecification: &dynamodb.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: aws.String(dynamodb.StreamViewTypeNewAndOldImages),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to enable the stream of table %s: %v", *tableName, err)
+	}
+	if err := table.WaitActive(db, tableName, verbose); err != nil {
+		return "", err
+	}
+	out, err = db.DescribeTable(&dynamodb.DescribeTableInput{TableName: tableName})
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Enabled the stream of table %s (NEW_AND_OLD_IMAGES)\n", *tableName)
+	return aws.StringValue(out.Table.LatestStreamArn), nil
+}
+
+// benchmarkFunction returns the configuration of the function, nil if it
+// does not exist, and an error if it exists without the tag of
+// deploy-trigger, so that a function the benchmark did not create is never
+// replaced or deleted.
+func benchmarkFunction(fn lambdaiface.LambdaAPI, function string) (*lambda.FunctionConfiguration, error) {
+	out, err := fn.GetFunction(&lambda.GetFunctionInput{FunctionName: aws.String(function)})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == lambda.ErrCodeResourceNotFoundException {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := out.Tags[triggerTag]; !ok {
+		return nil, fmt.Errorf("function %s was not deployed by deploy-trigger (no %q tag); not touching it", function, triggerTag)
+	}
+	return out.Configuration, nil
+}
+
+// DeployTrigger deploys the zip of opts as a Lambda function triggered by the
+// stream of tableName, so that the write -> stream -> derived item path of
+// the pipeline action can be stood up in a sandbox account: it enables the
+// stream if needed, creates the function or updates its code, and maps the
+// stream to it from the latest record on.
+func DeployTrigger(db dynamodbiface.DynamoDBAPI, fn lambdaiface.LambdaAPI, tableName *string, opts TriggerOptions, verbose bool) error {
+	start := time.Now()
+	code, err := os.ReadFile(opts.Zip)
+	if err != nil {
+		return err
+	}
+	stream, err := tableStream(db, tableName, verbose)
+	if err != nil {
+		return err
+	}
+	existing, err := benchmarkFunction(fn, opts.Function)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		_, err = fn.CreateFunction(&lambda.CreateFunctionInput{
+			FunctionName: aws.String(opts.Function),
+			Code:         &lambda.FunctionCode{ZipFile: code},
+			Role:         aws.String(opts.Role),
+			Runtime:      aws.String(opts.Runtime),
+			Handler:      aws.String(opts.Handler),
+			Description:  aws.String("Stream trigger of " + *tableName + " deployed by dynamodb-benchmark"),
+			Tags:         map[string]*string{triggerTag: aws.String("pipeline"), "table": tableName},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create function %s: %v", opts.Function, err)
+		}
+		err = fn.WaitUntilFunctionActiveV2(&lambda.GetFunctionInput{FunctionName: aws.String(opts.Function)})
+	} else {
+		_, err = fn.UpdateFunctionCode(&lambda.UpdateFunctionCodeInput{
+			FunctionName: aws.String(opts.Function),
+			ZipFile:      code,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update function %s: %v", opts.Function, err)
+		}
+		err = fn.WaitUntilFunctionUpdatedV2(&lambda.GetFunctionInput{FunctionName: aws.String(opts.Function)})
+	}
+	if err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Printf("[Verbose] Function %s is ready after %.1f sec\n", opts.Function, time.Since(start).Seconds())
+	}
+
+	mappings, err := fn.ListEventSourceMappings(&lambda.ListEventSourceMappingsInput{
+		FunctionName:   aws.String(opts.Function),
+		EventSourceArn: aws.String(stream),
+	})
+	if err != nil {
+		return err
+	}
+	var uuid *string
+	if len(mappings.EventSourceMappings) > 0 {
+		uuid = mappings.EventSourceMappings[0].UUID
+	} else {
+		out, err := fn.CreateEventSourceMapping(&lambda.CreateEventSourceMappingInput{
+			FunctionName:     aws.String(opts.Function),
+			EventSourceArn:   aws.String(stream),
+			StartingPosition: aws.String(lambda.EventSourcePositionLatest),
+			BatchSize:        aws.Int64(opts.BatchSize),
+			Enabled:          aws.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to map the stream of table %s to function %s: %v", *tableName, opts.Function, err)
+		}
+		uuid = out.UUID
+	}
+	if err := waitMappingState(fn, uuid, "Enabled", verbose); err != nil {
+		return err
+	}
+	fmt.Printf("Deployed function %s on the stream of table %s (%s) after %.1f sec\n", opts.Function, *tableName, stream, time.Since(start).Seconds())
+	return nil
+}
+
+// RemoveTrigger deletes the event source mappings and the function deployed
+// by DeployTrigger. The stream of the table is left enabled.
+func RemoveTrigger(fn lambdaiface.LambdaAPI, tableName *string, function string, verbose bool) error {
+	existing, err := benchmarkFunction(fn, function)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		fmt.Printf("Function %s does not exist\n", function)
+		return nil
+	}
+	mappings, err := fn.ListEventSourceMappings(&lambda.ListEventSourceMappingsInput{FunctionName: aws.String(function)})
+	if err != nil {
+		return err
+	}
+	for _, m := range mappings.EventSourceMappings {
+		if _, err := fn.DeleteEventSourceMapping(&lambda.DeleteEventSourceMappingInput{UUID: m.UUID}); err != nil {
+			return fmt.Errorf("failed to delete the event source mapping %s: %v", aws.StringValue(m.UUID), err)
+		}
+		if verbose {
+			fmt.Printf("[Verbose] Deleted the event source mapping %s of %s\n", aws.StringValue(m.UUID), aws.StringValue(m.EventSourceArn))
+		}
+	}
+	if _, err := fn.DeleteFunction(&lambda.DeleteFunctionInput{FunctionName: aws.String(function)}); err != nil {
+		return fmt.Errorf("failed to delete function %s: %v", function, err)
+	}
+	fmt.Printf("Removed function %s and %d event source mappings; the stream of table %s stays enabled\n", function, len(mappings.EventSourceMappings), *tableName)
+	return nil
+}
+
+// waitMappingState polls the event source mapping until it is in state.
+func waitMappingState(fn lambdaiface.LambdaAPI, uuid *string, state string, verbose bool) error {
+	for {
+		out, err := fn.GetEventSourceMapping(&lambda.GetEventSourceMappingInput{UUID: uuid})
+		if err != nil {
+			return err
+		}
+		if aws.StringValue(out.State) == state {
+			return nil
+		}
+		if verbose {
+			fmt.Printf("[Verbose] Event source mapping %s: %s\n", aws.StringValue(uuid), aws.StringValue(out.State))
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
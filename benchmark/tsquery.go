@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// TimeSeriesQuery is the read pattern of -ts-query: the Latest points of a
+// partition, or all its points of the last Range.
+type TimeSeriesQuery struct {
+	Latest int
+	Range  time.Duration
+}
+
+// parseTimeSeriesQuery parses "latest:<n>" or "range:<duration>".
+func parseTimeSeriesQuery(spec string) (*TimeSeriesQuery, error) {
+	switch {
+	case spec == "":
+		return nil, nil
+	case strings.HasPrefix(spec, "latest:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(spec, "latest:"))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("latest needs a number of points more than 0, got %q", spec)
+		}
+		return &TimeSeriesQuery{Latest: n}, nil
+	case strings.HasPrefix(spec, "range:"):
+		d, err := time.ParseDuration(strings.TrimPrefix(spec, "range:"))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("range needs a positive duration, got %q", spec)
+		}
+		return &TimeSeriesQuery{Range: d}, nil
+	}
+	return nil, fmt.Errorf("must be latest:<n> or range:<duration>, got %q", spec)
+}
+
+// resultSizeBuckets are the upper bounds of the result set sizes the query
+// latencies are broken down by.
+var resultSizeBuckets = []int{0, 1, 10, 100, 1000}
+
+// resultSizeOp is the operation a query returning n items is recorded as,
+// e.g. "Query[11-100]".
+func resultSizeOp(n int) string {
+	low := 0
+	for _, high := range resultSizeBuckets {
+		if n <= high {
+			if low == high {
+				return fmt.Sprintf("Query[%d]", high)
+			}
+			return fmt.Sprintf("Query[%d-%d]", low, high)
+		}
+		low = high + 1
+	}
+	return fmt.Sprintf("Query[%d+]", low)
+}
+
+// queryTimeSeries reads partition k as -ts-query says, following
+// LastEvaluatedKey for ranges, and returns the number of points read, the
+// number of pages and the time to the first page (0 for latest queries,
+// which read a single page).
+func (c *DynamoDBBenchmark) queryTimeSeries(db *dynamodb.DynamoDB, q *TimeSeriesQuery, k int) (int, int, time.Duration, error) {
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(c.TableName),
+		KeyConditionExpression:    aws.String("#id = :id"),
+		ExpressionAttributeNames:  map[string]*string{"#id": aws.String("id")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":id": {S: aws.String(c.timeSeriesPartitions() + "-" + strconv.Itoa(k))}},
+	}
+	if q.Latest > 0 {
+		input.ScanIndexForward = aws.Bool(false)
+		input.Limit = aws.Int64(int64(q.Latest))
+		out, err := db.Query(input)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return len(out.Items), 1, 0, nil
+	}
+	now := time.Now().UnixNano() / 1000
+	input.KeyConditionExpression = aws.String("#id = :id AND #ts BETWEEN :from AND :to")
+	input.ExpressionAttributeNames["#ts"] = aws.String(timeSeriesSortKey)
+	input.ExpressionAttributeValues[":from"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(now-q.Range.Microseconds(), 10))}
+	input.ExpressionAttributeValues[":to"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(now, 10))}
+	if c.Limit > 0 {
+		input.Limit = aws.Int64(int64(c.Limit))
+	}
+	n, pages := 0, 0
+	var first time.Duration
+	start := time.Now()
+	err := db.QueryPages(input, func(out *dynamodb.QueryOutput, last bool) bool {
+		if pages == 0 {
+			first = time.Since(start)
+		}
+		pages++
+		n += len(out.Items)
+		return true
+	})
+	return n, pages, first, err
+}
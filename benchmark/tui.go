@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	dashboardHistory = 60
+	dashboardWorkers = 20
+)
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// Dashboard redraws a live view of the run in the terminal every second
+// using plain ANSI escape sequences.
+type Dashboard struct {
+	stats    *Stats
+	action   string
+	runID    string
+	start    time.Time
+	last     uint64
+	lastTime time.Time
+	history  []float64
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewDashboard(stats *Stats, action string, runID string) *Dashboard {
+	return &Dashboard{
+		stats:  stats,
+		action: action,
+		runID:  runID,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (d *Dashboard) Start() {
+	d.start = time.Now()
+	d.lastTime = d.start
+	// Hide the cursor while drawing.
+	fmt.Print("\033[?25l")
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.draw()
+			case <-d.stop:
+				d.draw()
+				return
+			}
+		}
+	}()
+}
+
+// Stop draws the final state and restores the cursor.
+func (d *Dashboard) Stop() {
+	close(d.stop)
+	<-d.done
+	fmt.Print("\033[?25h")
+}
+
+func sparkline(values []float64) string {
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > 0 {
+			i = int(v / max * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+func (d *Dashboard) draw() {
+	sum := d.stats.Summary(d.action)
+	now := time.Now()
+	total := sum.Success + sum.Errors
+	throughput := 0.0
+	if elapsed := now.Sub(d.lastTime).Seconds(); elapsed > 0 {
+		throughput = float64(total-d.last) / elapsed
+	}
+	d.last, d.lastTime = total, now
+	d.history = append(d.history, throughput)
+	if len(d.history) > dashboardHistory {
+		d.history = d.history[1:]
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	fmt.Fprintf(&b, "DynamoDB Benchmark - %s    run %s    elapsed %s\n\n",
+		d.action, d.runID, now.Sub(d.start).Truncate(time.Second))
+	fmt.Fprintf(&b, "Throughput  %10.1f req/s   %s\n", throughput, sparkline(d.history))
+	errorRate := 0.0
+	if total > 0 {
+		errorRate = float64(sum.Errors) / float64(total) * 100
+	}
+	fmt.Fprintf(&b, "Requests    %10d         Errors %d (%.2f%%)\n\n", total, sum.Errors, errorRate)
+	for _, op := range sum.Operations {
+		fmt.Fprintf(&b, "[%s] avg %.3f  p50 %.3f  p90 %.3f  p99 %.3f  p99.9 %.3f  max %.3f (ms)\n",
+			op.Operation, op.AverageMs, op.P50Ms, op.P90Ms, op.P99Ms, op.P999Ms, op.MaxMs)
+	}
+
+	workers := d.stats.Workers()
+	fmt.Fprintf(&b, "\n%6s %10s %8s  %-8s %s\n", "worker", "requests", "errors", "status", "last error")
+	for i, w := range workers {
+		if i == dashboardWorkers {
+			fmt.Fprintf(&b, "... and %d more workers\n", len(workers)-dashboardWorkers)
+			break
+		}
+		status := "running"
+		if w.Finished {
+			status = "done"
+		}
+		lastErr := w.LastError
+		if len(lastErr) > 60 {
+			lastErr = lastErr[:57] + "..."
+		}
+		fmt.Fprintf(&b, "%6d %10d %8d  %-8s %s\n", w.ID, w.Requests, w.Errors, status, strings.ReplaceAll(lastErr, "\n", " "))
+	}
+	os.Stdout.WriteString(b.String())
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// SweepLevel is the outcome of the transactions sent at one contention
+// level, i.e. with one number of distinct keys.
+type SweepLevel struct {
+	Keys         int     `json:"keys"`
+	Requests     uint64  `json:"requests"`
+	Success      uint64  `json:"success"`
+	Conflicts    uint64  `json:"conflicts"`
+	OtherErrors  uint64  `json:"other_errors"`
+	ConflictRate float64 `json:"conflict_rate"`
+	AverageMs    float64 `json:"average_ms"`
+	P99Ms        float64 `json:"p99_ms"`
+}
+
+// sweepLevels returns 1, 2, 4, ... up to and including max.
+func sweepLevels(max int) []int {
+	var levels []int
+	for k := 1; k < max; k *= 2 {
+		levels = append(levels, k)
+	}
+	return append(levels, max)
+}
+
+func (c *DynamoDBBenchmark) sweepKey(k int) string {
+	return c.Id + "-" + strconv.Itoa(k)
+}
+
+// txWriteInput increments "age" on TxItems distinct items (fewer if there
+// are not enough keys) picked at random from the first keys items. Missing
+// items are created.
+func (c *DynamoDBBenchmark) txWriteInput(keys int, rnd *rand.Rand) *dynamodb.TransactWriteItemsInput {
+	items := c.TxItems
+	if items > keys {
+		items = keys
+	}
+	input := &dynamodb.TransactWriteItemsInput{}
+	for _, k := range rnd.Perm(keys)[:items] {
+		input.TransactItems = append(input.TransactItems, &dynamodb.TransactWriteItem{
+			Update: &dynamodb.Update{
+				TableName: &c.TableName,
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {
+						S: aws.String(c.sweepKey(k + 1)),
+					},
+				},
+				UpdateExpression: aws.String("set age = if_not_exists(age, :zero) + :age_increment_value"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":zero": {
+						N: aws.String("0"),
+					},
+					":age_increment_value": {
+						N: aws.String("1"),
+					},
+				},
+			},
+		})
+	}
+	return input
+}
+
+// isConflict reports whether a transaction was cancelled because another
+// transaction or write touched one of its items at the same time.
+func isConflict(err error) bool {
+	if tce, ok := err.(*dynamodb.TransactionCanceledException); ok {
+		for _, r := range tce.CancellationReasons {
+			if aws.StringValue(r.Code) == "TransactionConflict" {
+				return true
+			}
+		}
+		return false
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == dynamodb.ErrCodeTransactionConflictException ||
+			aerr.Code() == dynamodb.ErrCodeTransactionInProgressException
+	}
+	return false
+}
+
+// RunTxSweep runs the transactional write workload once per contention
+// level, each for -n calls per session (or -duration), at the constant
+// -rate, and prints the conflict rate of every level in one table.
+// Transactions are not retried, every attempt is a sample.
+func (c *DynamoDBBenchmark) RunTxSweep() error {
+	c.clock = NewClock()
+	c.limiter = NewRateLimiter(c.Rate)
+	c.health.SetReady()
+
+	var levels []SweepLevel
+	for _, keys := range sweepLevels(c.SweepMaxKeys) {
+		if c.Verbose {
+			fmt.Printf("[Verbose] Sweep level: %d keys\n", keys)
+		}
+		c.trackResource(Resource{Kind: resourceItems, Table: c.TableName, Name: c.Id, Count: keys})
+		level, err := c.runSweepLevel(keys)
+		if err != nil {
+			return err
+		}
+		levels = append(levels, level)
+		if !c.breaker.Allow() {
+			break
+		}
+	}
+	printSweep(c.RunID, c.TxItems, c.Rate, levels)
+	return nil
+}
+
+func (c *DynamoDBBenchmark) runSweepLevel(keys int) (SweepLevel, error) {
+	stats := NewStats()
+	stats.Start()
+	if c.Duration > 0 {
+		c.deadline = time.Now().Add(c.Duration)
+	}
+	var conflicts uint64
+
+	var wg sync.WaitGroup
+	for i := 1; i <= c.Connections; i++ {
+		wg.Add(1)
+		go func(id int, stats *WorkerStats) {
+			defer wg.Done()
+			time.Sleep(c.staggerDelay(id))
+
+			db, err := getDynamoDBClient(c.sessionClientOptions(id))
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+			for i := 1; c.moreCalls(id, i); i++ {
+				param := c.txWriteInput(keys, rnd)
+				start := c.clock.Now()
+				_, err := db.TransactWriteItems(param)
+				stats.Record("TransactWriteItems", start, time.Since(start), len(param.TransactItems), err)
+				if isConflict(err) {
+					atomic.AddUint64(&conflicts, 1)
+				} else if err != nil && c.Verbose {
+					fmt.Printf("Error: %v\n", err)
+				}
+			}
+		}(i, stats.Worker(i))
+	}
+	wg.Wait()
+	stats.Stop()
+
+	level := SweepLevel{Keys: keys, Conflicts: conflicts}
+	for _, op := range stats.Summary(c.Action).Operations {
+		level.Requests = op.Success + op.Errors
+		level.Success = op.Success
+		level.OtherErrors = op.Errors - conflicts
+		level.AverageMs = op.AverageMs
+		level.P99Ms = op.P99Ms
+	}
+	if level.Requests > 0 {
+		level.ConflictRate = float64(level.Conflicts) / float64(level.Requests)
+	}
+	return level, nil
+}
+
+func printSweep(runID string, items int, rate float64, levels []SweepLevel) {
+	fmt.Println("-----------------------")
+	fmt.Printf("DynamoDB Benchmark Summary - tx-sweep (%d items per transaction, %.1f requests/sec)\n", items, rate)
+	fmt.Println("-----------------------")
+	fmt.Printf("Run ID: %s\n", runID)
+	fmt.Printf("%8s %10s %10s %10s %12s %14s %12s %10s\n",
+		"keys", "requests", "success", "conflicts", "other_errors", "conflict_rate", "average_ms", "p99_ms")
+	for _, l := range levels {
+		fmt.Printf("%8d %10d %10d %10d %12d %13.2f%% %12.3f %10.3f\n",
+			l.Keys, l.Requests, l.Success, l.Conflicts, l.OtherErrors, l.ConflictRate*100, l.AverageMs, l.P99Ms)
+	}
+}
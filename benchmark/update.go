@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// updateTemplates are the update expressions of the write action. All of them
+// increment "age" as well, so -condition, -assert and the operation history
+// work with every template.
+//
+//	incr          SET age = age + 1
+//	list-append   SET events = list_append(events, [<value>])
+//	map-set       SET info.ratings[0] = <n>, info.note = <value>
+//	nested-remove SET info.tags.<new> = <value> REMOVE info.tags.<old>
+//	reserve       SET stock = stock - <qty>
+//	              IF status = ACTIVE AND stock >= <qty> AND attribute_exists(owner)
+//	payload       SET payload = <-payload-file, compressed with -compress>
+var updateTemplates = []string{"incr", "list-append", "map-set", "nested-remove", "reserve", "payload"}
+
+func isValidUpdateTemplate(t string) bool {
+	for _, v := range updateTemplates {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// updateValue is the string written by the document templates.
+func (c *DynamoDBBenchmark) updateValue() *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{S: aws.String(strings.Repeat("x", c.UpdateValueSize))}
+}
+
+// reserveCondition is the invariant of the reserve template, modeled on a
+// stock reservation: the item is active, has enough stock and is owned.
+const reserveCondition = "#status = :active AND stock >= :qty AND attribute_exists(#owner)"
+
+// seedAttributes returns the attributes besides "id" and "age" the template
+// needs, written by -reset.
+func (c *DynamoDBBenchmark) seedAttributes() map[string]*dynamodb.AttributeValue {
+	switch c.UpdateTemplate {
+	case "", "incr", "payload":
+		return nil
+	case "reserve":
+		return map[string]*dynamodb.AttributeValue{
+			"status": {S: aws.String("ACTIVE")},
+			"stock":  {N: aws.String(strconv.Itoa(c.SeedStock))},
+			"owner":  {S: aws.String("dynamodb-benchmark")},
+		}
+	}
+	return seedDocument()
+}
+
+// seedDocument returns the nested attributes the map-set and nested-remove
+// templates update.
+func seedDocument() map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"info": {
+			M: map[string]*dynamodb.AttributeValue{
+				"ratings": {L: []*dynamodb.AttributeValue{{N: aws.String("0")}}},
+				"tags":    {M: map[string]*dynamodb.AttributeValue{}},
+			},
+		},
+		"events": {L: []*dynamodb.AttributeValue{}},
+	}
+}
+
+// writeInput returns the UpdateItem request of the call-th call of worker.
+// The incr template always sends the same request; the document templates
+// vary with the call.
+func (c *DynamoDBBenchmark) writeInput(worker int, call int) *dynamodb.UpdateItemInput {
+	param := c.updateItemInput()
+	values := param.ExpressionAttributeValues
+	switch c.UpdateTemplate {
+	case "list-append":
+		param.UpdateExpression = aws.String("set age = age + :age_increment_value, events = list_append(if_not_exists(events, :empty_list), :event)")
+		values[":empty_list"] = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}
+		values[":event"] = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{c.updateValue()}}
+	case "map-set":
+		param.UpdateExpression = aws.String("set age = age + :age_increment_value, info.ratings[0] = :rating, info.note = :note")
+		values[":rating"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(call))}
+		values[":note"] = c.updateValue()
+	case "nested-remove":
+		// Every worker alternates between two tags, setting one and removing
+		// the other, so the map keeps its size.
+		param.UpdateExpression = aws.String("set age = age + :age_increment_value, info.tags.#new_tag = :tag remove info.tags.#old_tag")
+		param.ExpressionAttributeNames = map[string]*string{
+			"#new_tag": aws.String("w" + strconv.Itoa(worker) + "-" + strconv.Itoa(call%2)),
+			"#old_tag": aws.String("w" + strconv.Itoa(worker) + "-" + strconv.Itoa((call+1)%2)),
+		}
+		values[":tag"] = c.updateValue()
+	case "reserve":
+		// STATUS and OWNER are reserved words.
+		param.UpdateExpression = aws.String("set age = age + :age_increment_value, stock = stock - :qty")
+		param.ExpressionAttributeNames = map[string]*string{
+			"#status": aws.String("status"),
+			"#owner":  aws.String("owner"),
+		}
+		values[":active"] = &dynamodb.AttributeValue{S: aws.String("ACTIVE")}
+		values[":qty"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(c.ReserveQty))}
+		if param.ConditionExpression != nil {
+			param.ConditionExpression = aws.String(*param.ConditionExpression + " AND " + reserveCondition)
+		} else {
+			param.ConditionExpression = aws.String(reserveCondition)
+		}
+	case "payload":
+		param.UpdateExpression = aws.String("set age = age + :age_increment_value, payload = :payload")
+		values[":payload"] = c.compression.Payload()
+	}
+	return param
+}
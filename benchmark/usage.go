@@ -0,0 +1,669 @@
+package main
+
+import "fmt"
+
+func usage() {
+	fmt.Println(usageText)
+	exit(exitOK)
+}
+
+var usageText = `auto_increment [bench] [options...]
+auto_increment results schema|validate ...
+                     Print the JSON Schema of the summaries or validate summaries against it
+                     (see "results -h")
+auto_increment admin -a <action> -table <table> [options...]
+                     Create, copy, back up and tag tables and items for the benchmark
+                     (see "admin -h")
+auto_increment orchestrate [options...] -- <options...>
+                     Run the benchmark as several Kubernetes Jobs and merge their results
+                     (see "orchestrate -h")
+auto_increment preset save|run|list|show|delete ...
+                     Store options under a name and run them with "preset run <name>"
+                     (see "preset -h")
+auto_increment cleanup -run-id <id>
+                     Delete the items, indexes, backups and tables a run created
+                     (see "cleanup -h")
+
+Options:
+-a <action>          (Required) An action to execute
+                     Defaults to "read"; Must be one of "read", "write", "session",
+                     "timeseries", "item-collection", "tx-sweep", "batch-sweep", "chunk-sweep",
+                     "checkout", "ledger", "claim", "lease", "mix", "sk-query" or "pipeline"
+                     session: model a web session store; each call looks up (GetItem, eventually
+                     consistent) or, for 1 - -read-ratio of the calls, refreshes (PutItem) one of
+                     -sessions items "<id>-session-<k>" picked by -key-skew. The summary adds
+                     the hit rate; a session past its "expires_at" counts as a miss
+                     timeseries: ingest time series points, each call a PutItem (or with
+                     -ts-batch, a BatchWriteItem) to partitions "<id>-ts-<run-id>-<k>" picked by
+                     -key-skew out of -partitions, with the sort key "ts" strictly increasing per
+                     partition (microseconds since the epoch). Needs a table keyed by "id" (S)
+                     and "ts" (N), see admin -sort-key
+                     item-collection: grow -collections item collections "<id>-ic-<run-id>-<k>"
+                     picked by -key-skew, each call a PutItem of an item of -item-size bytes with
+                     the sort key "seq" = 1, 2, ... per collection, and report the collection
+                     size estimates of DynamoDB and when the 10 GB limit of tables with local
+                     secondary indexes rejected writes. With -lsi, -lsi-read-ratio of the calls
+                     query the index instead. Needs a table keyed by "id" (S) and "seq" (N), see
+                     admin -sort-key and -lsi
+                     tx-sweep: run TransactWriteItems against 1, 2, 4, ... -sweep-max-keys
+                     distinct items "<id>-1", "<id>-2", ... at the constant -rate, -n calls per
+                     session (or -duration) per level, and report the conflict rate per level
+                     batch-sweep: run BatchWriteItem (or BatchGetItem, see -batch-op) once per
+                     batch size on items picked from "<id>-1" ... "<id>-<batch-keys>" at the
+                     constant item rate -rate, -n calls per session (or -duration) per size, and
+                     report latency, unprocessed item rate and effective throughput per size
+                     chunk-sweep: store objects larger than the 400KB item limit, once per size
+                     of -object-sizes, -n objects per session (or -duration) per size at -rate
+                     objects per second: each object is split into -chunk-size items under the
+                     partition key "<id>-chunk-<run-id>-<n>" with the sort key "seq" = 1, 2, ...
+                     written with BatchWriteItem ("PutObject"), then read back with a consistent
+                     Query and reassembled ("GetObject"). Report the write and read throughput
+                     in MB/s and the reassembly latency per size. Needs a table keyed by "id" (S)
+                     and "seq" (N), see admin -sort-key
+                     checkout: place orders, each one TransactWriteItems taking -reserve-qty from
+                     the "stock" of -checkout-items products "<id>-product-<k>" (on the condition
+                     stock >= -reserve-qty) and putting an order item "<id>-order-<run-id>-<n>",
+                     and report the order rate, conflicts, out of stock and the hottest products
+                     ledger: append immutable events, each session to its own stream (partition
+                     key "<id>-ledger-<run-id>-<session>", sort key "seq" = 1, 2, ...) with a
+                     PutItem on the condition that the event does not exist yet, retrying a
+                     failed append with the same "seq"; then read every stream back and report
+                     gaps. Needs a table keyed by "id" (S) and "seq" (N), see admin -sort-key
+                     claim: model a distributed lock or unique registration, each call a PutItem
+                     of "<id>-claim-<run-id>-<n>" on the condition attribute_not_exists(id),
+                     where n is the next key or, for -duplicate-ratio of the calls, one tried
+                     before; report the claims won vs the conditional failures and the latency
+                     of each outcome
+                     lease: model the lock client pattern; each session picks one of -leases
+                     items "<id>-lease-<k>" and acquires it with an UpdateItem writing its owner
+                     and an expiry -lease-duration ahead, on the condition that nobody holds it
+                     or the lease expired, holds it for -lease-hold and releases it on the
+                     condition that it still owns it. A session which did not get the lease
+                     tries again after -think-time. Report the acquisition latency and wait,
+                     contention failures, leases lost to expiry and the fairness across sessions
+                     sk-query: query partitions "<id>-q-<k>" picked by -key-skew out of
+                     -partitions with the sort key conditions of -sk-query (begins_with, between,
+                     >=), following LastEvaluatedKey to the end, and report the latency by the
+                     condition and the number of items matched, e.g. "Query[between 11-100]".
+                     -reset seeds -sk-items items per partition. Needs a table keyed by "id" (S)
+                     and "sk" (S), see admin -sort-key
+                     pipeline: measure the end-to-end latency of a stream pipeline, e.g. a
+                     Lambda materializing the stream records of -table into -pipeline-table:
+                     each call writes a new item "<id>-pipe-<run id>-<n>" (PutItem, with "age"
+                     n) and reads the item -derived-key expects in -pipeline-table (GetItem,
+                     strongly consistent) every -pipeline-poll until it appears. "Pipeline" is
+                     the end-to-end latency; the summary splits it into the write and the lag
+                     until the derived item was found, and counts the polls and timeouts
+                     mix: draw each call from the weighted operations of -mix, so that a single
+                     run models the API profile of a whole service, and report the share of
+                     every operation against its weight
+-table <table>       (Required) DynamoDB table name
+-id <id>             (Required) id field value in the table; the key prefix for session,
+                     timeseries, item-collection, tx-sweep, batch-sweep, checkout, ledger, claim
+                     and lease
+-sessions N          Number of active sessions of session; Defaults to 10000. With -reset, all
+                     of them are (re)created
+-read-ratio <r>      Share of the calls of session which are lookups; Defaults to 0.95
+-key-skew <dist>     How session picks sessions, timeseries partitions, item-collection collections
+                     and read and write -keys:
+                     "uniform" or "zipf:<s>" (s > 1), where key 1 is the most popular; Defaults
+                     to "uniform"
+-keys N              Spread read and write over the items "<id>-1" ... "<id>-N" picked by
+                     -key-skew instead of the single item -id (-reset seeds all of them);
+                     Defaults to 1
+-id-file <path>      Spread read and write over the keys listed in the file instead, e.g. the key
+                     population exported from production: one key per line, optionally followed
+                     by "," or a tab and a weight ("order-42,3.5"); blank lines and lines starting
+                     with "#" are skipped. With weights, keys are drawn by them (a key without
+                     one weighs 1), otherwise by -key-skew, where the first key is the most
+                     popular. The keys must exist, so -reset cannot be used
+-session-size N      Bytes of random "data" in each session item; Defaults to 512
+-partitions N        Number of partitions (devices or tenants) of timeseries and sk-query;
+                     Defaults to 100
+-ts-batch N          Points written by each call of timeseries: 1 (PutItem) or up to 25
+                     (BatchWriteItem, resubmitting unprocessed points as -unprocessed-retries and
+                     -unprocessed-backoff say); Defaults to 1
+-ts-query <pattern>  Make -ts-query-ratio of the calls of timeseries queries of a partition:
+                     "latest:<n>" (the newest n points, ScanIndexForward=false and Limit n) or
+                     "range:<d>" (all points of the last d, following LastEvaluatedKey). Query
+                     latencies are broken down by result size, e.g. "Query[11-100]"
+-ts-query-ratio <r>  Share of the calls of timeseries which are -ts-query queries; Defaults to
+                     0.5
+-ts-prefill N        Points written to each partition of timeseries before the run, so that
+                     queries find data from the start; Defaults to 0
+-sk-query <list>     Sort key conditions of sk-query, comma separated; each call uses one of them
+                     at random, with boundary values drawn for the call:
+                       begins_with:<n>  the items sharing a prefix of the sort key, n of them
+                                        (a power of 10: the prefix leaves out log10(n) digits)
+                       between:<n>      n consecutive items
+                       >=               the items from a random one to the end of the partition
+                     e.g. "begins_with:100,between:20,>="; Defaults to "begins_with:10"
+-sk-items N          Items of each partition of sk-query, with the sort keys "0" ... "N-1" zero
+                     padded to the same width; Defaults to 1000
+-pipeline-table <t>  Table pipeline waits for the derived items in
+-derived-key <list>  Key of the item pipeline expects in -pipeline-table for each write, comma
+                     separated "<attribute>=<template>[:S|N]" (1 or 2 attributes, string unless
+                     ":N"), where the template can use {id} (the id written), {n} (its
+                     sequence number) and {session}, e.g. "pk=view#{id},sk=summary" or
+                     "id={n}:N"; Defaults to "id={id}" (the same key)
+-pipeline-poll <d>   Interval between the reads waiting for a derived item; Defaults to "20ms"
+-pipeline-timeout <d>
+                     Time pipeline waits for a derived item after its write before the call
+                     fails; Defaults to "30s"
+-limit N             Page size (Limit) of the Query and Scan calls of sk-query, timeseries range
+                     queries, scan and the query and scan of -mix. The paginated queries
+                     (sk-query, "range:<d>") also report the time to their first page next to
+                     the time to the full result, e.g. "[Query[>= 101-1000]] time to first page:
+                     ..., pages per call: ..."; Defaults to 0 (no Limit, and 100 for Scan)
+-collections N       Number of item collections of item-collection; Defaults to 1
+-item-size N         Bytes of "data" in each item of item-collection; Defaults to 1024; Must
+                     be at most 390000 (items are limited to 400 KB)
+-lsi <name>:<attr>[:S|N]
+                     Local secondary index of the item-collection table, sorted by the attribute
+                     attr, which every item gets a random value of; Defaults to "" (no queries)
+-lsi-read-ratio <r>  Share of the calls of item-collection which query -lsi for up to 100 items
+                     of a collection from a random point on ("Query[LSI]"); Defaults to 0.5
+-session-ttl <d>     Sessions written expire this long after, in the epoch seconds attribute
+                     "expires_at" (enable the time to live of the table on it); Defaults to 30m
+-tx-items N          Items updated by each transaction of tx-sweep (fewer at levels with fewer
+                     keys); Defaults to 2; Must be between 1 and 100
+-sweep-max-keys N    Number of distinct keys of the last tx-sweep level; Defaults to 16
+-mix <list>          Operations of mix with their relative weights, comma separated
+                     "<operation>:<weight>", e.g. "get:70,update:20,query:5,tx-write:5" (in the
+                     config file also an object {"get": 70, "update": 20, ...}). Operations:
+                     get (GetItem, with -projection), put (PutItem of the item of -reset),
+                     update (UpdateItem, with -condition and -update), query (Query of the
+                     partition, with -projection), scan (Scan pages of 100 items), tx-get and
+                     tx-write (TransactGetItems and TransactWriteItems incrementing "age" on
+                     -tx-items distinct items, from -keys or -id-file, or else "<id>-1" ...
+                     "<id>-<tx-items>"). All but scan and the transactions go to -id or the
+                     item picked by -keys or -id-file
+-checkout-items K    Products in each order of checkout; Defaults to 3; Must be between 1 and 99
+-checkout-products N Number of distinct products of checkout; Defaults to 100; Must be at least
+                     -checkout-items. With -reset, all of them are (re)created with -seed-stock
+-product-skew <dist> How checkout picks products: "uniform" or "zipf:<s>" (s > 1), where
+                     "<id>-product-1" is the most popular; Defaults to "uniform"
+-duplicate-ratio <r> Share of the calls of claim which try a key tried before, picked uniformly
+                     from the keys handed out so far; Defaults to 0.1
+-leases N            Number of lease items sessions of lease compete for; Defaults to 1
+-lease-duration <d>  How long an acquired lease lasts unless released; Defaults to 10s
+-lease-hold <d>      How long lease holds a lease before releasing it; Defaults to 100ms
+-batch-op <op>       "write" (BatchWriteItem, putting "age" = -seed-age) or "read" (BatchGetItem)
+                     for batch-sweep; Defaults to "write". Run a write sweep first so that the
+                     items read exist
+-batch-sizes <list>  Comma separated batch sizes of batch-sweep
+                     Defaults to "1,2,5,10,15,20,25" for write and "1,5,10,25,50,75,100" for read
+-batch-keys N        Number of distinct items batch-sweep writes and reads; Defaults to 1000;
+                     Must be at least the largest batch size
+-object-sizes <list> Comma separated object sizes of chunk-sweep in bytes, KB or MB
+                     Defaults to "100KB,1MB,4MB"
+-chunk-size N        Bytes of each chunk item of chunk-sweep; Defaults to 358400 (350KB); Must be
+                     between 1 and 390000
+-storage <list>      Comma separated storages of the objects of chunk-sweep, each measured per
+                     size: "chunks" (items of -chunk-size) and/or "s3" (the object put to
+                     -overflow-bucket and a pointer item "seq" = 0 with its S3 key and size put
+                     after it; read back with a consistent GetItem of the pointer, then the
+                     object); Defaults to "chunks"
+-overflow-bucket <s3://bucket/prefix>
+                     Where -storage s3 puts the objects, with the default credentials and region;
+                     Required for -storage s3 (objects stay in memory with -endpoint-url fake://)
+-unprocessed-retries N
+                     Resubmit the UnprocessedItems/UnprocessedKeys of a batch up to N times; the
+                     batch-sweep table shows how many items needed 1, 2 or 3+ submissions and
+                     how many were never processed (chunk-sweep fails the object instead);
+                     Defaults to 5 (0 = never resubmit)
+-unprocessed-backoff <d>
+                     Base delay before a resubmission, doubled every time and randomized
+                     between half and the full delay; Defaults to "50ms"
+-condition <max-age> Conditinal check value of max age on updating "age" field in the table
+                     Defaults to 0 (No Conditional Check); Must be more than 0; write action only
+-update <template>   Update expression of the write action, all of them also incrementing "age":
+                       incr          SET age = age + 1 (default)
+                       list-append   append a -update-value-size string to the list "events"
+                       map-set       SET info.ratings[0] = <n>, info.note = <string>
+                       nested-remove SET one nested map entry info.tags.<tag> and REMOVE another
+                       reserve       SET stock = stock - -reserve-qty on the condition
+                                     status = "ACTIVE" AND stock >= -reserve-qty AND
+                                     attribute_exists(owner), ANDed with -condition if given,
+                                     like a stock reservation; the updates fail with
+                                     ConditionalCheckFailed once the stock is sold out
+                       payload       SET payload = the sample of -payload-file, compressed with
+                                     -compress
+                     map-set, nested-remove and reserve need -reset to create the attributes
+                     Note that list-append grows the item with every update (400KB item limit)
+-update-value-size N Size in bytes of the strings written by the document templates
+                     Defaults to 32
+-return-values <v>   ReturnValues of the write action: NONE, ALL_OLD, UPDATED_OLD, ALL_NEW or
+                     UPDATED_NEW; Defaults to "" (ALL_NEW)
+-projection <expr>   ProjectionExpression of the read action, e.g. "age"; Defaults to "" (the
+                     whole item). Every attribute name is sent as a placeholder "#<name>", so
+                     reserved words such as status, name or size can be used as they are
+-expression-names <list>
+                     Comma separated "#placeholder=name" for -projection, for attribute names an
+                     expression cannot spell out, e.g. "#sku=item.sku,#rev=rev-2" with the
+                     projection "#sku,#rev"
+                     When -return-values or -projection is given, the summary also shows the
+                     average request and response payload size per operation, approximated
+                     from the JSON the SDK marshals, to compare the serialization overhead
+-consumed-capacity   Request ReturnConsumedCapacity INDEXES and show the capacity units consumed per
+                     operation: total, base table and per index, the base/total ratio and the
+                     write amplification (total/base) caused by global and local secondary
+                     indexes
+-item-collection-metrics
+                     Request ReturnItemCollectionMetrics SIZE with the writes of the write and
+                     timeseries actions (always on for item-collection) and show the largest
+                     item collections, how fast they grew and when they would reach the 10 GB
+                     limit of tables with local secondary indexes; DynamoDB only returns
+                     coarse size ranges, and only for tables with LSIs
+-partition-estimate  Estimate how many partitions back the table from the throughput per 10s
+                     window and the documented 3000 RCU / 1000 WCU per partition, and show the
+                     estimate at the start and the end of the run, where it grew and what
+                     throughput the table took before the first throttle. The units are the
+                     consumed capacity with -consumed-capacity, otherwise 1 WCU per item written
+                     and 0.5 RCU per item read; a lower bound, as partitions idle during the run
+                     are not seen and a hot key throttles on one partition
+-reset               (Re)create the item with "age" set to -seed-age before starting, so every run
+                     starts from the same state
+-seed-age <age>      Initial value of "age" written by -reset
+                     Defaults to 1; Must be 0 or more, and less than -condition if given
+-seed-stock N        Initial "stock" written by -reset for -update reserve, along with status
+                     "ACTIVE" and an owner, and for the products of checkout; Defaults to 1000
+-reserve-qty N       Quantity each update of -update reserve, and each order of checkout per
+                     product, takes from the stock; Defaults to 1
+-assert <list>       Read the item back after the run and check these comma separated invariants,
+                     e.g. "age>=0,age==initial+successes". Each is <attribute><op><expression>
+                     with op one of == != < <= > >= and the expression a sum/difference of
+                     integers and the variables initial (value before the run), successes and
+                     errors (request counts of the run). PASS/FAIL is shown in the summary and
+                     the exit status is non-zero if any invariant is violated
+-slo <list>          Success criteria checked after the run, comma separated (in a config file
+                     also an array, e.g. "slo": ["p99 < 20ms", "error_rate < 0.1%"]). Each is
+                     <metric><op><value> with op one of == != < <= > >= and metric one of:
+                       average, p50, p90, p99, p99.9, max   latency of the slowest operation,
+                                    or of one with "<Operation>.p99", in a duration or ms
+                       error_rate   errors / requests, as a fraction or in percent
+                       throughput   requests/sec
+                       errors, success  request counts
+                     PASS/FAIL is shown per criterion and the exit status is non-zero if any
+                     is missed
+-run-id <id>         Identifier of the run, appended to the User-Agent of every request as
+                     "dynamodb-benchmark/<id>" (visible in CloudTrail) and included in the
+                     summary, checkpoints, request log and dry-run plan
+                     Defaults to a generated "<UTC timestamp>-<random hex>"
+-c connections       Number of parallel simultaneous DynamoDB session
+                     Defaults to 1; Must be more than 0
+-pools <list>        Connections per operation instead of -c, comma separated "<op>=<n>" with op
+                     "read" (GetItem), "write" (UpdateItem) or "scan" (Scan pages of 100 items),
+                     e.g. "read=50,write=10,scan=2"; the sessions are numbered in this order.
+                     In a config file also an object, e.g. {"pools": {"read": 50, "write": 10}}.
+                     Named pools with options of their own are a JSON array (in a config file
+                     just an array), e.g. [{"name": "api", "action": "read", "connections": 50,
+                     "table": "orders", "keys": 1000, "key-skew": "zipf:1.2", "rate": 2000}];
+                     a pool can set table, id, rate (a limit of its own), keys, key-skew,
+                     think-time, think-time-dist, retry-num, consumed-capacity, endpoint-url
+                     and role-arns, and shares all other options. -reset seeds the items of
+                     every pool. The summary breaks the results down by pool. Only with -a read
+                     or write. A named pool can also set start, a delay before its first call
+                     (e.g. "30s"), e.g. for a noisy neighbor joining later
+-victim-pool <name>  Multi-tenant isolation: the pool of -pools playing a tenant with modest
+                     traffic on a table shared with the other pools, e.g. a noisy neighbor
+                     hammering another key range. The summary reports the latency and throttled
+                     attempts of this pool per -timeline-bucket over the run, alone (before the
+                     first "start" of the other pools) and shared, with the p99 degradation
+                     relative to the time alone. Give the neighbors a start that is a multiple
+                     of -timeline-bucket
+-stagger <d>         Spread the start of the sessions evenly over this interval (e.g. "10s")
+                     instead of starting all of them at once
+                     Defaults to 0 (no stagger)
+-pipeline-depth K    Keep up to K calls of each read or write session in flight at a time,
+                     sending the next one as soon as one returns, instead of one call after the
+                     other; -n, -rate and -think-time still count and pace every call. Reaches a
+                     realistic throughput per connection without more sessions; Defaults to 1
+-backpressure-report <file>
+                     With -rate or -pipeline-depth, the summary reports every second's calls in
+                     flight, sessions waiting for a free pipeline slot and how far the sessions
+                     trail the -rate schedule, with a [WARN] when they fell more than 1s behind,
+                     i.e. the run did not send its intended load. This writes the samples to a
+                     CSV file
+-rate <r>            Limit all sessions together to this many requests per second
+                     (items per second for batch-sweep)
+                     Defaults to 0 (unlimited); Required for tx-sweep and batch-sweep
+-control-addr <addr> Serve an HTTP control API on this address (e.g. "localhost:8080") to adjust
+                     the load while the benchmark is running:
+                       GET  /status, /metrics (with the running summary)
+                       POST /rate?value=<r> (0 = unlimited), /pause, /resume
+                     Defaults to "" (disabled)
+-think-time <d>      Idle time of each session between its successive operations, to model
+                     user-driven traffic instead of a tight loop; Defaults to 0
+-think-time-dist <d> "fixed" (always -think-time) or "exp" (exponentially distributed with mean
+                     -think-time, i.e. Poisson arrivals per session); Defaults to "fixed"
+-n num-calls         Run for exactly this number of calls by each DynamoDB session, i.e.
+                     -c times as many calls in total; Defaults to 1; Must be more than 0
+-total-calls N       Run for exactly this number of calls in total, divided over the sessions
+                     (the first ones take one more for the remainder); overrides -n
+                     Defaults to 0 (use -n)
+                     With -n or -total-calls a progress bar with the share of the calls done and
+                     the estimated time remaining is drawn on stderr, if it is a terminal (not
+                     with -tui)
+-duration <d>        Run each DynamoDB session for this duration (e.g. "2h") instead of -n calls
+                     Defaults to 0 (use -n)
+-checkpoint-file <f> Soak-test option: append the statistics of every interval (and the running
+                     totals) to this file as newline delimited JSON, resetting interval counters
+-checkpoint-interval <d>
+                     Interval between checkpoints; Defaults to "5m"
+-stream-results <d>  Write the statistics of every interval of this length (and the running
+                     totals) to stdout as newline delimited JSON while the run goes on, the
+                     last line with "final": true, for piping into jq, Vector or Loki; all
+                     other output goes to stderr. Not with -checkpoint-file, -tui and
+                     -k8s-friendly. Defaults to 0 (off)
+-request-log <file>  Additionally write every raw sample (timestamp, worker, operation, latency,
+                     error) to this CSV file. Latency percentiles are computed from fixed-size
+                     histograms, so this is the only option whose memory/disk use grows with -n
+-contention-report <file>
+                     Write action: write a time series to this CSV file with, per bucket, the
+                     update attempts, ConditionalCheckFailed conflicts, throttled requests, the
+                     average number of other sessions' updates landing between two updates of a
+                     session (from the returned "age"), and the average/p99 latency. The summary
+                     tells whether hot item contention or capacity throttling dominates
+-contention-bucket <d>
+                     Width of the time buckets of the contention report; Defaults to "1s"
+-timeline <file>     Write the latency timeline to this CSV file: per bucket the requests, errors,
+                     throttled attempts (including those retried by the SDK), average/p50/p99/max
+                     latency, the events of the run (e.g. a backup), and the throughput and the
+                     share of throttled attempts with their change per second from the previous
+                     bucket
+-timeline-bucket <d> Width of the time buckets of the timeline; Defaults to "1s"
+-backup-at <d>       Create an on-demand backup of the table this long after the start of the
+                     run (e.g. "1m") and follow it until it is available, to see whether backups
+                     affect the foreground traffic. The summary compares the throughput and
+                     latency before, during and after the backup, and the timeline marks its
+                     start and finish. The backup is not deleted; Defaults to 0 (no backup)
+-add-index <name>:<attribute>[:S|N|B]
+                     Global secondary index to add with -add-index-at, keyed by the attribute
+                     (of type S unless given) and projecting all attributes. On a provisioned
+                     table the index gets the throughput of the table
+-add-index-at <d>    Add the -add-index index to the table this long after the start of the run
+                     and follow the backfill until the index is active, to see whether an index
+                     can be added online. The summary compares the throughput, latency and
+                     throttled attempts before, during and after the backfill, and the timeline
+                     marks its start and finish. The index is not deleted; Defaults to 0
+-step-at <d>         Measure the reaction time of auto scaling: send -rate requests/sec, raise the
+                     load to -step-rate this long into the run, far above the capacity of the
+                     table, and follow its capacity with DescribeTable. The summary reports the
+                     time from the step to (a) the first throttled attempt, (b) the first
+                     capacity increase DescribeTable shows and (c) the end of throttling, the
+                     capacity changes, and the timeline per -timeline-bucket with the step and
+                     capacity changes marked. Needs -duration and auto scaling enabled on the
+                     provisioned table; Defaults to 0 (no step)
+-step-rate <r>       Requests per second from -step-at on; Must be more than -rate
+-shift-hotkey <d>    Move the hot key every <d> to see how quickly adaptive capacity reacts: all
+                     sessions read or write "<id>-hot-1" first, then "<id>-hot-2", ... (-reset
+                     creates all of them). The summary reports per hot key the throttled
+                     attempts, the time to the first throttle and until throttling stopped, and
+                     the throughput right after the shift and before the next one; the timeline
+                     marks the shifts. Needs -duration; Defaults to 0 (a fixed key, -id)
+-cache-ttl <d>       Put an in-process read-through cache in front of the GetItem calls of read,
+                     shared by all sessions like the cache of one application instance: a read
+                     of an item cached less than <d> ago is served from it ("GetItem[cache
+                     hit]") instead of DynamoDB ("GetItem"), to estimate how much a cache would
+                     save before building one. The summary reports the hit rate, the expired and
+                     evicted items, the read units consumed by the misses and saved by the hits
+                     (from -consumed-capacity, or estimated from the item size) and the average
+                     latency with and without the cache. The hit rate follows from -keys,
+                     -id-file and -key-skew; Defaults to 0 (no cache)
+-cache-size N        Items the -cache-ttl cache holds before it evicts the least recently used;
+                     Defaults to 10000
+-optimistic-lock <mode>
+                     Make every UpdateItem of write (and the updates of mix) an optimistic lock:
+                     set -version-attribute to the expected version + 1 on the condition that it
+                     is the expected version. "read" expects the version of a consistent GetItem
+                     before every write; "cache" the version the last successful write left in an
+                     in-process cache shared by all sessions, reading the item only on a miss.
+                     After a conflict both read the item again and retry, up to 10 times. The
+                     summary reports conflicts, version reads per write and their read units
+-version-attribute <name>
+                     Numeric version attribute of -optimistic-lock; Defaults to "version"
+-payload-file <file> Sample payload, e.g. a representative large JSON document, which -update payload
+                     writes to "payload" and the read action reads back. Before the run, the sample
+                     is compressed and decompressed with every algorithm and the summary compares
+                     their ratio, time and capacity units per item
+-compress <alg>      Compress the payload client-side before each write with "gzip" or "zstd"
+                     (stored as binary) and decompress it after each read; the summary reports the
+                     compression ratio, the CPU time spent and the estimated write and read units
+                     saved; Defaults to "none" (stored as a string)
+-compress-level N    Level of -compress, 1-9 for gzip and 1-22 for zstd; Defaults to 0, the
+                     default level of the algorithm
+-record-history <file>
+                     Record a Jepsen-style operation history to this file: an invoke and an
+                     ok/fail/info event for every request attempt with the worker (process), the
+                     age read or written and a timestamp, e.g. to check it with a linearizability
+                     checker such as Porcupine. "info" marks requests with an unknown outcome
+-history-format <f>  Format of the history file: "json" (one object per line) or "edn"
+                     Defaults to "json"
+-check-linearizability
+                     Record the operation history in memory and check it at the end of the run
+                     against a sequential counter model with the Porcupine checker. Violations
+                     are reported in the summary with a minimal counterexample (the operations
+                     around the shortest history prefix that is not linearizable) and make the
+                     exit status non-zero. The history grows with the number of requests
+-linearizability-timeout <d>
+                     Give up the check after this long and report "unknown"; Defaults to "1m"
+-skew-reference <url>
+                     Estimate the offset of the local clock against the Date header of this HTTP
+                     server (e.g. the coordinator or the DynamoDB endpoint) with a ping exchange
+                     and report it, so timestamps of several hosts can be lined up.
+                     Timestamps are always taken from the monotonic clock during the run
+-abort-on-error-rate <rate>
+                     Circuit breaker: abort the run when more than this fraction (0-1) of the
+                     requests in the sliding window failed; the reason is shown in the summary
+                     Defaults to 0 (disabled)
+-error-rate-window <d>
+                     Sliding window of the circuit breaker; Defaults to "30s"
+-error-rate-min-samples N
+                     Requests needed in the window before the breaker can trip; Defaults to 20
+-error-rate-pause <d>
+                     Pause all sessions for this long instead of aborting when the breaker trips
+                     Defaults to 0 (abort)
+-r retry-num         Number fo Retry in each message send
+                     Default to 1; Must be more than 0
+-endpoint-url <url>  DynamoDB Endpoint URL to send the API request to.
+                     Defaults to "", which mean the AWS SDK automatically determines the URL
+                     For example, give "http://localhost:8000" if it's local dynamodb with exposed port 8000
+                     "fake://" selects an in-process, map-backed fake (GetItem, PutItem, UpdateItem,
+                     DeleteItem, TransactWriteItems, batch and table operations with conditions) to
+                     develop workloads offline; it starts empty with every run, so use -reset
+-fake-faults <list>  Inject faults into every request to the fake endpoint (including -reset),
+                     comma separated, e.g. "latency=exp:5ms,throttle=0.05,reset=0.001":
+                       latency=fixed:<d> | uniform:<min>-<max> | exp:<mean>
+                       throttle=<p>     ProvisionedThroughputExceededException (SDK retries)
+                       conditional=<p>  ConditionalCheckFailedException on conditional writes
+                       conflict=<p>     TransactionCanceledException (TransactionConflict)
+                       reset=<p>        connection reset after the request was applied
+                       ops=<op>+<op>    only fail these operations, e.g. "ops=GetItem+Query"
+                       seed=<n>         seed of the fault decisions; Defaults to 1
+-endpoint-scheme <s> Force "http" or "https" for the endpoint regardless of -endpoint-url
+                     Defaults to "", which keeps the scheme of the endpoint URL
+-role-arns <list>    Distribute the sessions round-robin over these IAM roles, comma separated, to
+                     test per-account limits or cross-account access: session i assumes entry
+                     ((i-1) mod N). An entry "<arn1>><arn2>" assumes arn2 with the credentials of
+                     arn1 (role chaining). The table must exist under the same name in every
+                     account. The summary breaks the results down by role
+-role-external-id <id>
+                     External ID passed when assuming the roles
+-insecure-skip-verify
+                     Skip TLS certificate verification (e.g. self-signed certificates)
+-ca-bundle <file>    PEM file with CA certificates to trust in addition to the system ones
+-proxy-url <url>     Send the requests through this HTTP, HTTPS or SOCKS5 proxy, e.g.
+                     "http://proxy.corp:3128" or "socks5://127.0.0.1:1080", instead of the one of
+                     HTTP_PROXY / HTTPS_PROXY / NO_PROXY, which are honored otherwise. The summary
+                     counts the requests routed through a proxy and -request-log flags them
+-proxy-split         Send only the odd sessions through the proxy and the even ones direct, and
+                     show both groups and the latency the proxy adds (proxied minus direct
+                     average, p50 and p99); Requires a proxy and -c 2 or more
+-endpoint-discovery  Let the SDK look up the endpoint with DescribeEndpoints (endpoint discovery)
+                     instead of using the regional endpoint directly
+-fips                Use the FIPS 140-2 endpoint of the region, e.g. dynamodb-fips.us-east-1.amazonaws.com
+                     (GovCloud regions are FIPS by default); Not with -endpoint-url
+-dual-stack          Use the dual-stack (IPv4 and IPv6) endpoint of the region, e.g.
+                     dynamodb.us-east-1.api.aws, to reach DynamoDB from IPv6-only networks;
+                     Not with -endpoint-url
+-signing-region <r>  Sign the requests for this region instead of the region of the endpoint,
+                     e.g. for a VPC endpoint or proxy given with -endpoint-url, which the SDK
+                     signs for AWS_REGION
+-conn-stats          Trace the HTTP requests of every session and show the connection statistics
+                     in the summary: new vs reused connections, DNS lookups, TCP connect and TLS
+                     handshake times, the distinct remote addresses and the time to first byte on
+                     new and reused connections, plus the sessions that opened more than one
+                     connection. Use it to tell connection churn apart from DynamoDB latency
+-latency-breakdown   Time the phases of every request in the SDK handlers and show their
+                     percentiles per operation in the summary: marshal (validate and build),
+                     sign, network (send and receive, including the time on the server, which
+                     DynamoDB does not report) and unmarshal (reading and decoding the response
+                     body). Sign, network and unmarshal are
+                     counted per attempt, i.e. including the retries of the SDK
+-dry-run             Print the first generated requests and the planned workload as JSON
+                     without calling DynamoDB
+-dry-run-requests N  Number of generated requests to print in dry-run mode
+                     Defaults to 10
+-compat-check        Run a battery of operations (create table, conditional update, transaction,
+                     batch ops, ...) against a scratch table "<table>-compat-<timestamp>" and
+                     report which features the endpoint supports; -id is not required
+-check               Pre-flight check: validate credentials, that the table exists and is ACTIVE,
+                     that its key schema matches the workload and that the seed item exists,
+                     then exit (non-zero if any check fails) without running the benchmark
+-calibrate           Measure the maximum request rate this host can generate for the read or write
+                     action: ramp the sessions 1, 2, 4, ... for -calibrate-step each against an
+                     in-process stub endpoint (or -endpoint-url, e.g. DynamoDB Local) until the
+                     throughput stops growing, and save the ceiling to -calibration-file. Runs
+                     on this host then warn when their -rate or achieved throughput exceeds 70%
+                     of the ceiling, where the client rather than DynamoDB may be the bottleneck
+-calibrate-step <d>  Duration of each calibration level; Defaults to "5s"
+-calibration-file <f>
+                     Defaults to "<user cache dir>/dynamodb-benchmark/calibration.json"
+-concurrency-sweep <list>
+                     Run the read or write workload for -concurrency-step with every number of
+                     sessions of this comma separated list, where "<from>..<to>" doubles, e.g.
+                     "1..256" for 1, 2, 4, ... 256, and print throughput and latency by number of
+                     sessions as a table and as charts (the latency vs concurrency curve)
+-concurrency-step <d>
+                     Duration of each level of -concurrency-sweep; Defaults to "30s"
+-burst-idle <list>   Characterize burst capacity: for every idle duration of this comma
+                     separated list (e.g. "0s,1m,2m,5m"), send nothing for that long, so that
+                     the table accumulates unused capacity (up to 300 seconds of it), then run
+                     the read or write workload with -c sessions for -burst-step, a step of load
+                     far above the provisioned capacity. Print per idle duration how long the
+                     step was sustained before the first throttled attempt, the requests/sec
+                     before and after it and, for provisioned tables, the capacity consumed
+                     beyond the provisioned one at one unit per request, as a table and a chart
+                     (the burst vs idle time curve)
+-burst-step <d>      Duration of each step of load of -burst-idle; Defaults to "1m"
+-probe-ceiling <rate>
+                     Probe the practical throughput limit of the table and account: run the read
+                     or write workload with -c sessions at -probe-start requests/sec for
+                     -probe-step, then at -probe-factor times the rate every step, never above this
+                     safety ceiling, and stop at the ceiling, at the first step with more than
+                     -probe-throttle-ratio of the attempts throttled, or when the sessions fall
+                     below 90% of the rate. Print every step, the highest rate sustained without
+                     throttling and the account and table quotas of DescribeLimits. Needs
+                     -i-understand-costs, as every step may consume (and be billed for) that much
+-probe-start <rate>  Rate of the first step of -probe-ceiling; Defaults to 100
+-probe-factor <f>    Factor the rate of -probe-ceiling grows by every step; Defaults to 1.5
+-probe-step <d>      Duration of each step of -probe-ceiling; Defaults to "30s"
+-probe-throttle-ratio <r>
+                     Share of the throttled attempts of a step at which -probe-ceiling stops;
+                     Defaults to 0.01
+-i-understand-costs  Confirm that -probe-ceiling may consume a lot of capacity
+-shards <list>       Shard the item of read and write over items "<id>-shard-1" ... "<id>-shard-N":
+                     each write updates one shard picked by -shard-suffix, each read gets all
+                     shards with one BatchGetItem and adds their "age" up (with -reset, all
+                     shards are (re)created). The summary adds the logical operations/sec, i.e.
+                     the effective throughput, and how evenly the writes spread. A list like
+                     -concurrency-sweep, e.g. "1..64", runs the workload for -shard-step with
+                     every number of shards and charts the effective throughput by shards;
+                     Must be at most 100
+-shard-suffix <s>    "random" (a random shard per write) or "calculated" (the hash of the
+                     session and call number, which a reader of the logical key can compute
+                     again); Defaults to "random"
+-shard-step <d>      Duration of each level of a -shards list; Defaults to "30s"
+-compare <phases>    Run the read or write workload once per comma separated phase and print a
+                     comparison of throttling (throttled attempts, time to the first throttle),
+                     latency, consumed capacity and estimated cost. A phase is "<table>" or
+                     "<table>@on-demand" / "<table>@provisioned:<rcu>/<wcu>", which first switches
+                     the table (and its global secondary indexes) to that billing mode and waits
+                     until it is active; an empty table name means -table, e.g.
+                     "orders-prov,orders-od" or "@provisioned:100/100,@on-demand". DynamoDB
+                     limits how often the billing mode of a table can be changed
+-compare-prices <p>  Override the prices in USD used for the cost estimate, e.g. "wru=1.25"
+                     Defaults to "rru=0.125,wru=0.625,rcu-hour=0.00013,wcu-hour=0.00065" (us-east-1,
+                     on-demand per million request units, provisioned per unit-hour)
+-compare-pause <d>   Idle time between the phases of -compare, e.g. to let capacity settle
+                     Defaults to 0
+-table-a <table>     A/B mode: send every request of the read or write workload to both -table-a
+-table-b <table>     and -table-b, back to back in random order, and test whether the latency of
+                     B differs from A over these pairs (mean difference, 95% confidence interval
+                     and p-value). -rate counts the pairs. -table is not needed
+-tui                 Show a live terminal dashboard during the run, refreshed every second:
+                     throughput sparkline, latency percentiles, errors and per-session status.
+                     Errors of single requests are not printed in this mode
+-config <file>       JSON file with option values, keyed by flag name, e.g.
+                     {"table": "yoichi-test001", "a": "write", "c": 10, "duration": "1h"}
+                     The single letter options can also be given as "action", "connections",
+                     "num-calls" and "retry-num"
+-k8s-friendly        Run as a Kubernetes Job: every line of output is written to stdout as a JSON
+                     object {"time", "level", "run_id", "msg"} and the summary as one object with
+                     "summary", /healthz and /readyz are served on -health-addr, and SIGTERM
+                     stops all sessions after their current request and still writes the results
+-results-dir <dir>   Write the summary as JSON to "<dir>/<run-id>.json", e.g. a mounted volume
+-results-history <f> Append the summary of every run to this file as one line of JSON, to trend
+                     repeated runs
+-repeat-every <d>    Canary mode: start the workload again every this long (e.g. "1h") in the
+                     same process, each run with the run ID "<run-id>-<n>" and its own summary.
+                     A failed run does not stop the schedule. Combine with -results-history.
+                     Not with -record-history, -request-log, -timeline and -contention-report,
+                     whose files each run would overwrite
+-repeat-count N      Number of runs of -repeat-every; Defaults to 0 (until stopped)
+-results-s3-uri <uri>
+                     At the end of the run, upload the summary (as one line of JSON, for Athena)
+                     and the -checkpoint-file, -request-log, -record-history and
+                     -contention-report files to "<uri>/<run-id>/", e.g. s3://my-bucket/benchmarks, with the default
+                     credentials and region
+-sinks <list>        Where the summary of the run goes, several at a time, comma separated:
+                     console (printed, or the JSON log line of -k8s-friendly), json:<dir> (as
+                     -results-dir), jsonl:<file> (as -results-history), csv:<file> (a row per
+                     operation appended), prometheus:<file> (text format, e.g. for the textfile
+                     collector) or prometheus:<url> (pushed to a Pushgateway),
+                     cloudwatch:<namespace> (PutMetricData with the dimensions Action and
+                     Operation) and s3:<uri> (as -results-s3-uri). -results-dir,
+                     -results-history and -results-s3-uri add to them; Defaults to "console"
+-health-addr <addr>  Serve the liveness (/healthz) and readiness (/readyz, ready once the sessions
+                     have started) probes on this address; Defaults to ":8081" with -k8s-friendly
+-cleanup             At the end of the run, delete what it created in DynamoDB: the item of -reset,
+                     the items of session, timeseries, tx-sweep, batch-sweep, checkout, ledger, claim and lease, the index of
+                     -add-index-at and the backup of -backup-at. Whatever a run creates is recorded in
+                     ~/.dynamodb_benchmark/runs/<run-id>.json until it is deleted, so
+                     "cleanup -run-id <run-id>" can delete it later, e.g. after a killed run
+-error-samples N     Show the first N distinct error messages of the run in the summary (and the N
+                     which occurred last, if more), each with its count and the time of its first
+                     and last occurrence, so the cause of failures is known without -verbose;
+                     0 disables it; Defaults to 5
+-sla-buckets <list>  Latency thresholds the summary counts the requests (errors included) under,
+                     overall and per operation, e.g. "99.20% under 10ms": comma separated
+                     durations in ascending order, counted exactly rather than derived from the
+                     percentiles; "" disables it; Defaults to "5ms,10ms,25ms,50ms,100ms"
+-timezone <tz>       Time zone of the timestamps of the output (request log, checkpoints, JSON log
+                     lines, circuit breaker trips, ...): "UTC", "Local" or an IANA name like
+                     "Asia/Tokyo"; Defaults to "UTC", so the logs of hosts in different regions
+                     line up
+-verbose             Verbose option
+-h                   help message
+
+Every option can also be set with an environment variable DDB_BENCH_<OPTION>, upper case with
+"-" replaced by "_", e.g. DDB_BENCH_TABLE, DDB_BENCH_ENDPOINT_URL, DDB_BENCH_CONNECTIONS (-c),
+DDB_BENCH_ACTION (-a), DDB_BENCH_NUM_CALLS (-n), DDB_BENCH_RETRY_NUM (-r), DDB_BENCH_CONFIG.
+Precedence: command line flag > environment variable > config file > default. The subcommands
+(admin, cleanup, orchestrate, results) read the variables and the config file of their own options
+the same way; bench and preset run are the benchmark itself.
+
+Exit status: 0 on success, 1 if the run failed (errors, a failed -check or -assert, a history that
+is not linearizable, or a termination signal), 2 if the options are invalid.
+`
@@ -0,0 +1,919 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"benchmark/internal/awsclient"
+)
+
+var validActions = []string{"read", "write", "session", "timeseries", "item-collection", "tx-sweep", "batch-sweep", "chunk-sweep", "checkout", "ledger", "claim", "lease", "mix", "sk-query", "pipeline"}
+
+// ValidationError lists every problem found in the command options so that
+// they can all be fixed in one go.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "Invalid Command Options!\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+var roleARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:role/.+$`)
+
+func isValidReturnValues(v string) bool {
+	for _, rv := range dynamodb.ReturnValue_Values() {
+		if rv == v {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidAction(action string) bool {
+	for _, a := range validActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks all option combinations for the configured action and
+// returns a *ValidationError describing every violation.
+func (c *DynamoDBBenchmark) Validate() error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !isValidAction(c.Action) {
+		addf("-a %q is not supported; action must be one of: %s", c.Action, strings.Join(validActions, ", "))
+	}
+	if c.TableName == "" && c.Compare == "" && c.TableA == "" {
+		addf("-table is required")
+	}
+	if c.Id == "" && !c.CompatCheck {
+		addf("-id is required")
+	}
+	if c.Connections <= 0 {
+		addf("-c must be more than 0 (got %d)", c.Connections)
+	}
+	if c.Pools != "" {
+		if _, err := parsePools(c.Pools); err != nil {
+			addf("-pools: %v", err)
+		}
+		if c.Action != "read" && c.Action != "write" {
+			addf("-pools only supports the read and write actions")
+		}
+	}
+	if c.VictimPool != "" {
+		pools, _ := parsePools(c.Pools)
+		found := false
+		for _, p := range pools {
+			found = found || p.Name == c.VictimPool
+		}
+		if !found {
+			addf("-victim-pool %q is not a pool of -pools", c.VictimPool)
+		} else if len(pools) < 2 {
+			addf("-victim-pool needs other pools in -pools to be its neighbors")
+		}
+	}
+	if c.PipelineDepth < 1 {
+		addf("-pipeline-depth must be more than 0 (got %d)", c.PipelineDepth)
+	}
+	if c.PipelineDepth > 1 {
+		if c.Action != "read" && c.Action != "write" {
+			addf("-pipeline-depth only supports the read and write actions (got -a %s)", c.Action)
+		}
+		if c.HistoryFile != "" || c.CheckLinearizability || c.ContentionReport != "" {
+			addf("-record-history, -check-linearizability and -contention-report follow the calls of a session one after the other and cannot be used with -pipeline-depth")
+		}
+	}
+	if c.Stagger < 0 {
+		addf("-stagger must not be negative (got %v)", c.Stagger)
+	}
+	if c.Duration > 0 && c.Stagger >= c.Duration {
+		addf("-stagger (%v) must be shorter than -duration (%v)", c.Stagger, c.Duration)
+	}
+	if c.NumCalls <= 0 && c.Duration == 0 && c.TotalCalls == 0 {
+		addf("-n must be more than 0 (got %d)", c.NumCalls)
+	}
+	if c.TotalCalls < 0 {
+		addf("-total-calls must not be negative (got %d)", c.TotalCalls)
+	}
+	if c.TotalCalls > 0 && c.Duration > 0 {
+		addf("-total-calls cannot be used with -duration")
+	}
+	if c.Duration < 0 {
+		addf("-duration must be positive (got %v)", c.Duration)
+	}
+	if c.CheckpointFile != "" && c.CheckpointInterval <= 0 {
+		addf("-checkpoint-interval must be positive (got %v)", c.CheckpointInterval)
+	}
+	if c.RetryNum <= 0 {
+		addf("-r must be more than 0 (got %d)", c.RetryNum)
+	}
+	if c.Condition < 0 {
+		addf("-condition must be more than 0 (got %d)", c.Condition)
+	}
+	if c.Condition > 0 && c.Action != "write" {
+		addf("-condition only applies to the write action (got -a %s)", c.Action)
+	}
+	if _, err := ParseSLOs(c.SLO); err != nil {
+		addf("-slo: %v", err)
+	} else if c.SLO != "" && c.Action != "read" && c.Action != "write" && c.Action != "session" && c.Action != "timeseries" && c.Action != "item-collection" {
+		addf("-slo only supports the read, write, session, timeseries and item-collection actions")
+	}
+	if _, err := ParseAssertions(c.Assert); err != nil {
+		addf("-assert: %v", err)
+	}
+	if c.HistoryFormat != "json" && c.HistoryFormat != "edn" {
+		addf("-history-format must be either json or edn (got %q)", c.HistoryFormat)
+	}
+	if c.CheckLinearizability && c.LinearizabilityTimeout < 0 {
+		addf("-linearizability-timeout must be 0 or more (got %v)", c.LinearizabilityTimeout)
+	}
+	if c.ThinkTime < 0 {
+		addf("-think-time must not be negative (got %v)", c.ThinkTime)
+	}
+	if c.ThinkTimeDist != "fixed" && c.ThinkTimeDist != "exp" {
+		addf("-think-time-dist must be either fixed or exp (got %q)", c.ThinkTimeDist)
+	}
+	if c.Rate < 0 {
+		addf("-rate must not be negative (got %v)", c.Rate)
+	}
+	if c.Action == "tx-sweep" {
+		if c.Rate == 0 {
+			addf("tx-sweep needs -rate to keep the request rate constant across levels")
+		}
+		if c.TxItems < 1 || c.TxItems > 100 {
+			addf("-tx-items must be between 1 and 100 (got %d)", c.TxItems)
+		}
+		if c.SweepMaxKeys < 1 {
+			addf("-sweep-max-keys must be more than 0 (got %d)", c.SweepMaxKeys)
+		}
+		if c.Reset || c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.DryRun || c.ControlAddr != "" {
+			addf("-reset, -assert, -record-history, -check-linearizability, -control-addr and -dry-run only apply to the read and write actions")
+		}
+	}
+	if c.Action == "batch-sweep" {
+		if c.UnprocessedRetries < 0 {
+			addf("-unprocessed-retries must be 0 or more (got %d)", c.UnprocessedRetries)
+		}
+		if c.UnprocessedBackoff < 0 {
+			addf("-unprocessed-backoff must not be negative (got %v)", c.UnprocessedBackoff)
+		}
+		if c.Rate == 0 {
+			addf("batch-sweep needs -rate to keep the item rate constant across batch sizes")
+		}
+		if c.BatchOp != "write" && c.BatchOp != "read" {
+			addf("-batch-op must be either write or read (got %q)", c.BatchOp)
+		} else if sizes, err := parseBatchSizes(c.BatchSizes, c.BatchOp); err != nil {
+			addf("-batch-sizes: %v", err)
+		} else {
+			largest := 0
+			for _, size := range sizes {
+				if size > largest {
+					largest = size
+				}
+			}
+			if c.BatchKeys < largest {
+				addf("-batch-keys %d must be at least the largest batch size %d", c.BatchKeys, largest)
+			}
+		}
+		if c.Reset || c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.DryRun || c.ControlAddr != "" {
+			addf("-reset, -assert, -record-history, -check-linearizability, -control-addr and -dry-run only apply to the read and write actions")
+		}
+	}
+	if c.Action == "chunk-sweep" {
+		if _, err := parseObjectSizes(c.ObjectSizes); err != nil {
+			addf("-object-sizes: %v", err)
+		}
+		if c.ChunkSize < 1 || c.ChunkSize > maxChunkSize {
+			addf("-chunk-size must be between 1 and %d (got %d)", maxChunkSize, c.ChunkSize)
+		}
+		storages, err := parseStorages(c.Storage)
+		if err != nil {
+			addf("-storage: %v", err)
+		}
+		for _, s := range storages {
+			if s == "s3" && c.OverflowBucket == "" && c.EndpointUrl != fakeEndpoint {
+				addf("-storage s3 needs -overflow-bucket")
+			}
+		}
+		if c.OverflowBucket != "" {
+			if _, _, err := parseS3URI(c.OverflowBucket); err != nil {
+				addf("-overflow-bucket: %v", err)
+			}
+		}
+		if c.UnprocessedRetries < 0 {
+			addf("-unprocessed-retries must be 0 or more (got %d)", c.UnprocessedRetries)
+		}
+		if c.UnprocessedBackoff < 0 {
+			addf("-unprocessed-backoff must not be negative (got %v)", c.UnprocessedBackoff)
+		}
+		if c.Reset || c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.DryRun || c.ControlAddr != "" {
+			addf("-reset, -assert, -record-history, -check-linearizability, -control-addr and -dry-run only apply to the read and write actions")
+		}
+	}
+	if c.Action == "checkout" {
+		if c.CheckoutItems < 1 || c.CheckoutItems > 99 {
+			addf("-checkout-items must be between 1 and 99 (got %d)", c.CheckoutItems)
+		}
+		if c.CheckoutProducts < c.CheckoutItems {
+			addf("-checkout-products %d must be at least -checkout-items %d", c.CheckoutProducts, c.CheckoutItems)
+		}
+		if _, err := parseKeySkew(c.ProductSkew); err != nil {
+			addf("-product-skew: %v", err)
+		}
+		if c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.DryRun || c.ControlAddr != "" {
+			addf("-assert, -record-history, -check-linearizability, -control-addr and -dry-run only apply to the read and write actions")
+		}
+	}
+	if c.Action == "session" {
+		if c.Sessions < 1 {
+			addf("-sessions must be more than 0 (got %d)", c.Sessions)
+		}
+		if c.ReadRatio < 0 || c.ReadRatio > 1 {
+			addf("-read-ratio must be between 0 and 1 (got %v)", c.ReadRatio)
+		}
+		if _, err := parseKeySkew(c.KeySkew); err != nil {
+			addf("-key-skew: %v", err)
+		}
+		if c.SessionSize < 1 || c.SessionSize > 350*1024 {
+			addf("-session-size must be between 1 and %d bytes (got %d)", 350*1024, c.SessionSize)
+		}
+		if c.SessionTTL <= 0 {
+			addf("-session-ttl must be more than 0 (got %v)", c.SessionTTL)
+		}
+		if c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.DryRun {
+			addf("-assert, -record-history, -check-linearizability and -dry-run only apply to the read and write actions")
+		}
+	}
+	if c.Limit < 0 {
+		addf("-limit must be 0 or more (got %d)", c.Limit)
+	}
+	if c.Action == "pipeline" {
+		if c.PipelineTable == "" {
+			addf("-a pipeline needs -pipeline-table, the table the derived items appear in")
+		}
+		if _, _, err := parseDerivedKey(c.DerivedKey); err != nil {
+			addf("-derived-key: %v", err)
+		}
+		if c.PipelinePoll <= 0 {
+			addf("-pipeline-poll must be more than 0 (got %v)", c.PipelinePoll)
+		}
+		if c.PipelineTimeout <= 0 {
+			addf("-pipeline-timeout must be more than 0 (got %v)", c.PipelineTimeout)
+		}
+		if c.Reset || c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.DryRun {
+			addf("-reset, -assert, -record-history, -check-linearizability and -dry-run only apply to the read and write actions")
+		}
+	}
+	if c.Action == "sk-query" {
+		if c.Partitions < 1 {
+			addf("-partitions must be more than 0 (got %d)", c.Partitions)
+		}
+		if c.SKItems < 1 {
+			addf("-sk-items must be more than 0 (got %d)", c.SKItems)
+		}
+		conds, err := parseSKQuery(c.SKQuery)
+		if err != nil {
+			addf("-sk-query: %v", err)
+		}
+		for _, cond := range conds {
+			if cond.Kind == "between" && cond.Items > c.SKItems {
+				addf("-sk-query: between:%d matches more than the %d items of -sk-items", cond.Items, c.SKItems)
+			}
+			if cond.Kind == "begins_with" && c.SKItems > 0 && len(fmt.Sprint(cond.Items)) > c.skQueryWidth() {
+				addf("-sk-query: begins_with:%d needs sort keys of more than %d digits (-sk-items %d)", cond.Items, c.skQueryWidth(), c.SKItems)
+			}
+		}
+		if _, err := parseKeySkew(c.KeySkew); err != nil {
+			addf("-key-skew: %v", err)
+		}
+		if c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.DryRun {
+			addf("-assert, -record-history, -check-linearizability and -dry-run only apply to the read and write actions")
+		}
+	}
+	if c.Action == "timeseries" {
+		if c.Partitions < 1 {
+			addf("-partitions must be more than 0 (got %d)", c.Partitions)
+		}
+		if c.TimeSeriesBatch < 1 || c.TimeSeriesBatch > 25 {
+			addf("-ts-batch must be between 1 and 25 (got %d)", c.TimeSeriesBatch)
+		}
+		if _, err := parseTimeSeriesQuery(c.TimeSeriesQuery); err != nil {
+			addf("-ts-query: %v", err)
+		}
+		if c.TimeSeriesQueryRatio < 0 || c.TimeSeriesQueryRatio > 1 {
+			addf("-ts-query-ratio must be between 0 and 1 (got %g)", c.TimeSeriesQueryRatio)
+		}
+		if c.TimeSeriesPrefill < 0 {
+			addf("-ts-prefill must not be negative (got %d)", c.TimeSeriesPrefill)
+		}
+		if _, err := parseKeySkew(c.KeySkew); err != nil {
+			addf("-key-skew: %v", err)
+		}
+		if c.Reset || c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.DryRun {
+			addf("-reset, -assert, -record-history, -check-linearizability and -dry-run only apply to the read and write actions")
+		}
+	}
+	if c.Action == "item-collection" {
+		if c.Collections < 1 {
+			addf("-collections must be more than 0 (got %d)", c.Collections)
+		}
+		if c.ItemSize < 1 || c.ItemSize > 390000 {
+			addf("-item-size must be between 1 and 390000 (got %d)", c.ItemSize)
+		}
+		if _, err := parseCollectionLSI(c.LSI); err != nil {
+			addf("-lsi: %v", err)
+		}
+		if c.LSIReadRatio < 0 || c.LSIReadRatio > 1 {
+			addf("-lsi-read-ratio must be between 0 and 1 (got %g)", c.LSIReadRatio)
+		}
+		if _, err := parseKeySkew(c.KeySkew); err != nil {
+			addf("-key-skew: %v", err)
+		}
+		if c.Reset || c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.DryRun {
+			addf("-reset, -assert, -record-history, -check-linearizability and -dry-run only apply to the read and write actions")
+		}
+	}
+	if c.Action == "ledger" {
+		if c.Reset || c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.DryRun || c.ControlAddr != "" {
+			addf("-reset, -assert, -record-history, -check-linearizability, -control-addr and -dry-run only apply to the read and write actions")
+		}
+	}
+	if c.Action == "claim" {
+		if c.DuplicateRatio < 0 || c.DuplicateRatio > 1 {
+			addf("-duplicate-ratio must be between 0 and 1 (got %g)", c.DuplicateRatio)
+		}
+		if c.Reset || c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.DryRun || c.ControlAddr != "" {
+			addf("-reset, -assert, -record-history, -check-linearizability, -control-addr and -dry-run only apply to the read and write actions")
+		}
+	}
+	if c.Action == "lease" {
+		if c.Leases < 1 {
+			addf("-leases must be more than 0 (got %d)", c.Leases)
+		}
+		if c.LeaseDuration < time.Millisecond {
+			addf("-lease-duration must be at least 1ms (got %v)", c.LeaseDuration)
+		}
+		if c.LeaseHold < 0 {
+			addf("-lease-hold must not be negative (got %v)", c.LeaseHold)
+		}
+		if c.Reset || c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.DryRun || c.ControlAddr != "" {
+			addf("-reset, -assert, -record-history, -check-linearizability, -control-addr and -dry-run only apply to the read and write actions")
+		}
+	}
+	if c.RepeatEvery < 0 {
+		addf("-repeat-every must not be negative (got %v)", c.RepeatEvery)
+	}
+	if c.RepeatCount < 0 {
+		addf("-repeat-count must not be negative (got %d)", c.RepeatCount)
+	}
+	if c.RepeatCount > 0 && c.RepeatEvery == 0 {
+		addf("-repeat-count needs -repeat-every")
+	}
+	if c.RepeatEvery > 0 {
+		if c.Action != "read" && c.Action != "write" && c.Action != "session" && c.Action != "timeseries" && c.Action != "item-collection" {
+			addf("-repeat-every only supports the read, write, session, timeseries and item-collection actions")
+		}
+		if c.HistoryFile != "" || c.RequestLog != "" || c.Timeline != "" || c.ContentionReport != "" {
+			addf("-repeat-every cannot be used with -record-history, -request-log, -timeline and -contention-report")
+		}
+		if c.DryRun || c.CompatCheck || c.Check || c.Calibrate || c.Compare != "" {
+			addf("-repeat-every cannot be used with -dry-run, -compat-check, -check, -calibrate and -compare")
+		}
+	}
+	if c.StreamResults < 0 {
+		addf("-stream-results must not be negative (got %v)", c.StreamResults)
+	}
+	if c.StreamResults > 0 {
+		if c.CheckpointFile != "" || c.TUI || c.K8sFriendly {
+			addf("-stream-results cannot be used with -checkpoint-file, -tui and -k8s-friendly")
+		}
+		if c.Action != "read" && c.Action != "write" && c.Action != "session" && c.Action != "timeseries" && c.Action != "item-collection" {
+			addf("-stream-results only supports the read, write, session, timeseries and item-collection actions")
+		}
+	}
+	if c.TUI && c.Verbose {
+		addf("-tui and -verbose cannot be used together")
+	}
+	if c.TUI && c.K8sFriendly {
+		addf("-tui cannot be used with -k8s-friendly")
+	}
+	if !isValidUpdateTemplate(c.UpdateTemplate) {
+		addf("-update must be one of: %s (got %q)", strings.Join(updateTemplates, ", "), c.UpdateTemplate)
+	} else if c.UpdateTemplate != "incr" {
+		if c.Action != "write" && c.Action != "mix" {
+			addf("-update %s is only supported by the write and mix actions", c.UpdateTemplate)
+		}
+		if (c.UpdateTemplate == "map-set" || c.UpdateTemplate == "nested-remove") && !c.Reset && !c.DryRun {
+			addf("-update %s needs -reset to create the nested attributes it updates", c.UpdateTemplate)
+		}
+		if c.UpdateTemplate == "reserve" && !c.Reset && !c.DryRun {
+			addf("-update reserve needs -reset to create the status, stock and owner attributes")
+		}
+	}
+	if c.SeedStock < 0 {
+		addf("-seed-stock must be 0 or more (got %d)", c.SeedStock)
+	}
+	if c.ReserveQty <= 0 {
+		addf("-reserve-qty must be more than 0 (got %d)", c.ReserveQty)
+	}
+	if c.ReturnValues != "" {
+		if !isValidReturnValues(c.ReturnValues) {
+			addf("-return-values must be one of: %s (got %q)", strings.Join(dynamodb.ReturnValue_Values(), ", "), c.ReturnValues)
+		}
+		if c.Action != "write" {
+			addf("-return-values only applies to the write action (got -a %s)", c.Action)
+		}
+		// The history and the contention report take the new "age" from
+		// the response.
+		if c.ReturnValues != dynamodb.ReturnValueAllNew && c.ReturnValues != dynamodb.ReturnValueUpdatedNew &&
+			(c.HistoryFile != "" || c.CheckLinearizability || c.ContentionReport != "") {
+			addf("-record-history, -check-linearizability and -contention-report need -return-values ALL_NEW or UPDATED_NEW")
+		}
+	}
+	if names, err := parseExpressionNames(c.ExpressionNames); err != nil {
+		addf("-expression-names %v", err)
+	} else if c.Projection != "" {
+		if _, used, err := aliasExpression(c.Projection, names); err != nil {
+			addf("-projection %v", err)
+		} else {
+			for p := range names {
+				if _, ok := used[p]; !ok {
+					addf("-expression-names %s is not used by -projection, which DynamoDB rejects", p)
+				}
+			}
+		}
+	} else if c.ExpressionNames != "" {
+		addf("-expression-names needs -projection")
+	}
+	if c.Projection != "" {
+		if c.Action != "read" {
+			addf("-projection only applies to the read action (got -a %s)", c.Action)
+		}
+		if c.HistoryFile != "" || c.CheckLinearizability {
+			addf("-projection cannot be used with -record-history or -check-linearizability, which need \"age\" in every response")
+		}
+	}
+	if c.UpdateValueSize < 1 || c.UpdateValueSize > 350*1024 {
+		addf("-update-value-size must be between 1 and %d (got %d)", 350*1024, c.UpdateValueSize)
+	}
+	if c.SeedAge < 0 {
+		addf("-seed-age must be 0 or more (got %d)", c.SeedAge)
+	}
+	if c.Reset && c.Condition > 0 && c.SeedAge >= c.Condition {
+		addf("-seed-age %d must be less than -condition %d, otherwise every update fails", c.SeedAge, c.Condition)
+	}
+	if c.EndpointUrl != "" && c.EndpointUrl != fakeEndpoint {
+		u, err := url.Parse(c.EndpointUrl)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			addf("-endpoint-url %q must be an absolute http:// or https:// URL or %q", c.EndpointUrl, fakeEndpoint)
+		}
+	}
+	if c.AbortOnErrorRate < 0 || c.AbortOnErrorRate >= 1 {
+		addf("-abort-on-error-rate must be between 0 and 1 (got %v)", c.AbortOnErrorRate)
+	}
+	if c.AbortOnErrorRate > 0 {
+		if c.ErrorRateWindow < time.Second {
+			addf("-error-rate-window must be at least 1s (got %v)", c.ErrorRateWindow)
+		}
+		if c.ErrorRateMinSamples <= 0 {
+			addf("-error-rate-min-samples must be more than 0 (got %d)", c.ErrorRateMinSamples)
+		}
+		if c.ErrorRatePause < 0 {
+			addf("-error-rate-pause must not be negative (got %v)", c.ErrorRatePause)
+		}
+	}
+	if c.SkewReference != "" {
+		u, err := url.Parse(c.SkewReference)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			addf("-skew-reference %q must be an absolute http:// or https:// URL", c.SkewReference)
+		}
+	}
+	if chains := c.roleChains(); len(chains) > 0 {
+		for _, chain := range chains {
+			for _, arn := range chain {
+				if !roleARNPattern.MatchString(arn) {
+					addf("-role-arns: %q is not an IAM role ARN (arn:aws:iam::<account>:role/<name>)", arn)
+				}
+			}
+		}
+		// Each account has its own copy of the item.
+		if len(chains) > 1 && (c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability) {
+			addf("-assert, -record-history and -check-linearizability need a single item and cannot be used with several -role-arns")
+		}
+		if c.EndpointUrl == fakeEndpoint {
+			addf("-role-arns cannot be used with the fake endpoint")
+		}
+	}
+	if c.FakeFaults != "" {
+		if c.EndpointUrl != fakeEndpoint {
+			addf("-fake-faults needs -endpoint-url %s", fakeEndpoint)
+		}
+		if _, err := ParseFakeFaults(c.FakeFaults); err != nil {
+			addf("-fake-faults: %v", err)
+		}
+	}
+	if c.EndpointScheme != "" && c.EndpointScheme != "http" && c.EndpointScheme != "https" {
+		addf("-endpoint-scheme must be either http or https (got %q)", c.EndpointScheme)
+	}
+	if c.EndpointScheme == "http" && (c.InsecureSkipVerify || c.CABundle != "") {
+		addf("-insecure-skip-verify and -ca-bundle have no effect with -endpoint-scheme http")
+	}
+	if c.CABundle != "" {
+		if _, err := c.clientOptions().aws().HTTPClient(); err != nil {
+			addf("-ca-bundle: %v", err)
+		}
+	}
+	if c.EndpointDiscovery && c.EndpointUrl == fakeEndpoint {
+		addf("-endpoint-discovery cannot be used with the fake endpoint")
+	}
+	if c.ProxyURL != "" {
+		if _, err := awsclient.ParseProxyURL(c.ProxyURL); err != nil {
+			addf("-proxy-url: %v", err)
+		}
+		if c.EndpointUrl == fakeEndpoint {
+			addf("-proxy-url cannot be used with the fake endpoint")
+		}
+	}
+	if c.ProxySplit {
+		if c.ProxyURL == "" && envProxy() == "" {
+			addf("-proxy-split needs a proxy: -proxy-url, HTTPS_PROXY or HTTP_PROXY")
+		}
+		if c.Connections < 2 {
+			addf("-proxy-split needs -c 2 or more to have proxied and direct sessions (got %d)", c.Connections)
+		}
+		if c.Action != "read" && c.Action != "write" && c.Action != "session" && c.Action != "timeseries" && c.Action != "item-collection" {
+			addf("-proxy-split only supports the read, write, session, timeseries and item-collection actions (got -a %s)", c.Action)
+		}
+	}
+	if (c.FIPS || c.DualStack) && c.EndpointUrl != "" {
+		addf("-fips and -dual-stack pick the regional endpoint and cannot be used with -endpoint-url")
+	}
+	if c.SigningRegion != "" && c.EndpointUrl == fakeEndpoint {
+		addf("-signing-region cannot be used with the fake endpoint")
+	}
+	if c.ConnStats && c.Action != "read" && c.Action != "write" && c.Action != "session" && c.Action != "timeseries" && c.Action != "item-collection" {
+		addf("-conn-stats only supports the read, write, session, timeseries and item-collection actions (got -a %s)", c.Action)
+	}
+	if c.ConsumedCapacity && c.Action != "read" && c.Action != "write" {
+		addf("-consumed-capacity only supports the read and write actions (got -a %s)", c.Action)
+	}
+	if c.ItemCollectionMetrics && c.Action != "write" && c.Action != "timeseries" && c.Action != "item-collection" {
+		addf("-item-collection-metrics only supports the write, timeseries and item-collection actions (got -a %s)", c.Action)
+	}
+	if c.ErrorSamples < 0 {
+		addf("-error-samples must be 0 or more (got %d)", c.ErrorSamples)
+	}
+	if c.PartitionEstimate {
+		if c.Action != "read" && c.Action != "write" && c.Action != "session" && c.Action != "timeseries" && c.Action != "item-collection" {
+			addf("-partition-estimate only supports the read, write, session, timeseries and item-collection actions (got -a %s)", c.Action)
+		}
+		shardLevels, _ := parseShardLevels(c.Shards)
+		if c.Compare != "" || c.TableA != "" || c.ConcurrencySweep != "" || len(shardLevels) > 1 {
+			addf("-partition-estimate follows a single run and cannot be used with -compare, -table-a/-table-b, -concurrency-sweep and a -shards list")
+		}
+	}
+	if c.LatencyBreakdown && c.Action != "read" && c.Action != "write" && c.Action != "session" && c.Action != "timeseries" && c.Action != "item-collection" {
+		addf("-latency-breakdown only supports the read, write, session, timeseries and item-collection actions (got -a %s)", c.Action)
+	}
+	if c.ContentionReport != "" {
+		if c.Action != "write" {
+			addf("-contention-report is only supported by the write action")
+		}
+		if c.ContentionBucket <= 0 {
+			addf("-contention-bucket must be more than 0 (got %v)", c.ContentionBucket)
+		}
+	}
+	if c.TimelineBucket <= 0 {
+		addf("-timeline-bucket must be more than 0 (got %v)", c.TimelineBucket)
+	}
+	if (c.Timeline != "" || c.BackupAt != 0 || c.AddIndexAt != 0) && c.Action != "read" && c.Action != "write" && c.Action != "session" && c.Action != "timeseries" && c.Action != "item-collection" {
+		addf("-timeline, -backup-at and -add-index-at only support the read, write, session, timeseries and item-collection actions (got -a %s)", c.Action)
+	}
+	if c.BackupAt < 0 {
+		addf("-backup-at must not be negative (got %v)", c.BackupAt)
+	}
+	if c.BackupAt > 0 && c.Duration > 0 && c.BackupAt >= c.Duration {
+		addf("-backup-at (%v) must be shorter than -duration (%v)", c.BackupAt, c.Duration)
+	}
+	if c.AddIndexAt < 0 {
+		addf("-add-index-at must not be negative (got %v)", c.AddIndexAt)
+	}
+	if c.AddIndexAt > 0 && c.Duration > 0 && c.AddIndexAt >= c.Duration {
+		addf("-add-index-at (%v) must be shorter than -duration (%v)", c.AddIndexAt, c.Duration)
+	}
+	if c.StepAt < 0 {
+		addf("-step-at must not be negative (got %v)", c.StepAt)
+	}
+	if c.StepAt > 0 {
+		if c.Action != "read" && c.Action != "write" {
+			addf("-step-at only supports the read and write actions (got -a %s)", c.Action)
+		}
+		if c.Duration == 0 {
+			addf("-step-at needs -duration")
+		} else if c.StepAt >= c.Duration {
+			addf("-step-at (%v) must be shorter than -duration (%v)", c.StepAt, c.Duration)
+		}
+		if c.Rate <= 0 {
+			addf("-step-at needs -rate, the load before the step")
+		} else if c.StepRate <= c.Rate {
+			addf("-step-rate (%v) must be more than -rate (%v)", c.StepRate, c.Rate)
+		}
+		if c.Pools != "" || c.ControlAddr != "" {
+			addf("-pools and -control-addr cannot be used with -step-at, which sets the rate of the run")
+		}
+	}
+	if c.ShiftHotkey < 0 {
+		addf("-shift-hotkey must not be negative (got %v)", c.ShiftHotkey)
+	}
+	if c.ShiftHotkey > 0 {
+		if c.Action != "read" && c.Action != "write" {
+			addf("-shift-hotkey only supports the read and write actions (got -a %s)", c.Action)
+		}
+		if c.Duration == 0 {
+			addf("-shift-hotkey needs -duration")
+		} else if c.ShiftHotkey >= c.Duration {
+			addf("-shift-hotkey (%v) must be shorter than -duration (%v)", c.ShiftHotkey, c.Duration)
+		}
+		if c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.ContentionReport != "" || c.Compare != "" || c.Calibrate {
+			addf("-shift-hotkey cannot be used with -assert, -record-history, -check-linearizability, -contention-report, -compare and -calibrate, which follow a single item")
+		}
+	}
+	if c.Keys < 1 {
+		addf("-keys must be more than 0 (got %d)", c.Keys)
+	}
+	if c.Keys > 1 {
+		if c.Action != "read" && c.Action != "write" && c.Action != "mix" {
+			addf("-keys only supports the read, write and mix actions (got -a %s)", c.Action)
+		}
+		if _, err := parseKeySkew(c.KeySkew); err != nil {
+			addf("-key-skew: %v", err)
+		}
+		if c.ShiftHotkey > 0 || c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.Compare != "" || c.Calibrate {
+			addf("-keys cannot be used with -shift-hotkey, -assert, -record-history, -check-linearizability, -compare and -calibrate, which follow a single item")
+		}
+	}
+	if c.Action == "mix" {
+		mix, err := parseMix(c.Mix)
+		if err != nil {
+			addf("-mix: %v", err)
+		}
+		if mixUses(mix, "tx-get", "tx-write") && (c.TxItems < 1 || c.TxItems > 100) {
+			addf("-tx-items must be between 1 and 100 (got %d)", c.TxItems)
+		}
+		if c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.ContentionReport != "" || c.Compare != "" || c.Calibrate {
+			addf("mix cannot be used with -assert, -record-history, -check-linearizability, -contention-report, -compare and -calibrate, which follow a single operation")
+		}
+	} else if c.Mix != "" {
+		addf("-mix is only supported by the mix action (got -a %s)", c.Action)
+	}
+	if c.CacheTTL < 0 {
+		addf("-cache-ttl must be 0 or more (got %s)", c.CacheTTL)
+	}
+	if c.CacheTTL > 0 {
+		if c.Action != "read" {
+			addf("-cache-ttl only applies to the read action (got -a %s)", c.Action)
+		}
+		if c.CacheSize < 1 {
+			addf("-cache-size must be more than 0 (got %d)", c.CacheSize)
+		}
+		if c.HistoryFile != "" || c.CheckLinearizability || c.Shards != "" {
+			addf("-record-history, -check-linearizability and -shards cannot be used with -cache-ttl")
+		}
+	}
+	if c.OptimisticLock != "" {
+		if c.OptimisticLock != "read" && c.OptimisticLock != "cache" {
+			addf("-optimistic-lock must be one of: %s (got %q)", strings.Join(optimisticLockModes, ", "), c.OptimisticLock)
+		}
+		if c.Action != "write" && c.Action != "mix" {
+			addf("-optimistic-lock only applies to the write and mix actions (got -a %s)", c.Action)
+		}
+		if c.VersionAttribute == "" || c.VersionAttribute == "id" || c.VersionAttribute == "age" {
+			addf("-version-attribute must be an attribute other than id and age (got %q)", c.VersionAttribute)
+		}
+	}
+	if err := checkCompressionLevel(c.Compress, c.CompressLevel); err != nil {
+		addf("%v", err)
+	}
+	if c.UpdateTemplate == "payload" && c.PayloadFile == "" {
+		addf("-update payload needs -payload-file, the sample payload it writes")
+	}
+	if c.Compress != "none" && c.PayloadFile == "" {
+		addf("-compress needs -payload-file, the sample payload it compresses")
+	}
+	if c.PayloadFile != "" {
+		if c.Action != "read" && c.UpdateTemplate != "payload" {
+			addf("-payload-file only applies to the read action and -update payload (got -a %s)", c.Action)
+		}
+		if c.Action == "read" && c.Projection != "" {
+			addf("-projection cannot be used with -payload-file, whose payload the read action decompresses")
+		}
+	}
+	if c.IdFile != "" {
+		if c.Action != "read" && c.Action != "write" && c.Action != "mix" {
+			addf("-id-file only supports the read, write and mix actions (got -a %s)", c.Action)
+		}
+		if _, err := loadKeyFile(c.IdFile); err != nil {
+			addf("-id-file: %v", err)
+		}
+		if _, err := parseKeySkew(c.KeySkew); err != nil {
+			addf("-key-skew: %v", err)
+		}
+		if c.Keys > 1 || c.Reset {
+			addf("-id-file cannot be used with -keys and -reset; its keys must exist already")
+		}
+		if c.ShiftHotkey > 0 || c.Assert != "" || c.HistoryFile != "" || c.CheckLinearizability || c.Compare != "" || c.Calibrate {
+			addf("-id-file cannot be used with -shift-hotkey, -assert, -record-history, -check-linearizability, -compare and -calibrate, which follow a single item")
+		}
+	}
+	if (c.AddIndex == "") != (c.AddIndexAt == 0) {
+		addf("-add-index and -add-index-at must be used together")
+	}
+	if c.AddIndex != "" {
+		if _, err := parseIndexSpec(c.AddIndex); err != nil {
+			addf("-add-index %v", err)
+		}
+	}
+	if _, err := parseSinks(c.Sinks); err != nil {
+		addf("-sinks: %v", err)
+	}
+	if c.ResultsS3URI != "" {
+		if _, _, err := parseS3URI(c.ResultsS3URI); err != nil {
+			addf("-results-s3-uri %v", err)
+		}
+	}
+	if c.DryRun && c.DryRunRequests <= 0 {
+		addf("-dry-run-requests must be more than 0 (got %d)", c.DryRunRequests)
+	}
+
+	if c.Calibrate {
+		if c.Action != "read" && c.Action != "write" {
+			addf("-calibrate only supports the read and write actions (got -a %s)", c.Action)
+		}
+		if c.CalibrateStep < time.Second {
+			addf("-calibrate-step must be at least 1s (got %v)", c.CalibrateStep)
+		}
+	}
+
+	if c.Compare != "" {
+		if c.Action != "read" && c.Action != "write" {
+			addf("-compare only supports the read and write actions (got -a %s)", c.Action)
+		}
+		if _, err := parseComparePhases(c.Compare, c.TableName); err != nil {
+			addf("-compare %v", err)
+		}
+		if _, err := parseComparePrices(c.ComparePrices); err != nil {
+			addf("-compare-prices: %v", err)
+		}
+		if c.ComparePause < 0 {
+			addf("-compare-pause must not be negative (got %v)", c.ComparePause)
+		}
+		if c.ControlAddr != "" || c.HistoryFile != "" || c.CheckLinearizability || c.Assert != "" {
+			addf("-control-addr, -record-history, -check-linearizability and -assert cannot be used with -compare")
+		}
+	}
+
+	if (c.TableA == "") != (c.TableB == "") {
+		addf("-table-a and -table-b must be given together")
+	}
+	if c.TableA != "" {
+		if c.Action != "read" && c.Action != "write" {
+			addf("-table-a/-table-b only support the read and write actions (got -a %s)", c.Action)
+		}
+		if c.Pools != "" || c.Keys > 1 || c.IdFile != "" || c.ShiftHotkey > 0 || c.RepeatEvery > 0 {
+			addf("-pools, -keys, -id-file, -shift-hotkey and -repeat-every cannot be used with -table-a/-table-b")
+		}
+		if c.ControlAddr != "" || c.HistoryFile != "" || c.CheckLinearizability || c.Assert != "" {
+			addf("-control-addr, -record-history, -check-linearizability and -assert cannot be used with -table-a/-table-b")
+		}
+	}
+
+	if c.ConcurrencySweep != "" {
+		if c.Action != "read" && c.Action != "write" {
+			addf("-concurrency-sweep only supports the read and write actions (got -a %s)", c.Action)
+		}
+		if _, err := parseConcurrencyLevels(c.ConcurrencySweep); err != nil {
+			addf("-concurrency-sweep: %v", err)
+		}
+		if c.ConcurrencyStep < time.Second {
+			addf("-concurrency-step must be at least 1s (got %v)", c.ConcurrencyStep)
+		}
+		if c.Pools != "" || c.RepeatEvery > 0 || c.TotalCalls > 0 {
+			addf("-pools, -repeat-every and -total-calls cannot be used with -concurrency-sweep")
+		}
+		if c.ControlAddr != "" || c.HistoryFile != "" || c.CheckLinearizability || c.Assert != "" {
+			addf("-control-addr, -record-history, -check-linearizability and -assert cannot be used with -concurrency-sweep")
+		}
+	}
+
+	if c.BurstIdle != "" {
+		if c.Action != "read" && c.Action != "write" {
+			addf("-burst-idle only supports the read and write actions (got -a %s)", c.Action)
+		}
+		if _, err := parseBurstIdle(c.BurstIdle); err != nil {
+			addf("-burst-idle: %v", err)
+		}
+		if c.BurstStep < time.Second {
+			addf("-burst-step must be at least 1s (got %v)", c.BurstStep)
+		}
+		if c.Pools != "" || c.Shards != "" || c.RepeatEvery > 0 || c.TotalCalls > 0 {
+			addf("-pools, -shards, -repeat-every and -total-calls cannot be used with -burst-idle")
+		}
+		if c.ControlAddr != "" || c.HistoryFile != "" || c.CheckLinearizability || c.Assert != "" {
+			addf("-control-addr, -record-history, -check-linearizability and -assert cannot be used with -burst-idle")
+		}
+	}
+
+	if c.ProbeCeiling < 0 {
+		addf("-probe-ceiling must be 0 or more (got %v)", c.ProbeCeiling)
+	}
+	if c.ProbeCeiling > 0 {
+		if !c.IUnderstandCosts {
+			addf("-probe-ceiling drives the table up to %.0f requests/sec, which may be billed; confirm with -i-understand-costs", c.ProbeCeiling)
+		}
+		if c.Action != "read" && c.Action != "write" {
+			addf("-probe-ceiling only supports the read and write actions (got -a %s)", c.Action)
+		}
+		if c.ProbeStart <= 0 || c.ProbeStart > c.ProbeCeiling {
+			addf("-probe-start must be more than 0 and at most -probe-ceiling (got %v)", c.ProbeStart)
+		}
+		if c.ProbeFactor <= 1 {
+			addf("-probe-factor must be more than 1 (got %v)", c.ProbeFactor)
+		}
+		if c.ProbeStep < time.Second {
+			addf("-probe-step must be at least 1s (got %v)", c.ProbeStep)
+		}
+		if c.ProbeThrottleRatio < 0 || c.ProbeThrottleRatio >= 1 {
+			addf("-probe-throttle-ratio must be at least 0 and less than 1 (got %v)", c.ProbeThrottleRatio)
+		}
+		if c.Rate > 0 {
+			addf("-rate cannot be used with -probe-ceiling, which sets the rate of every step")
+		}
+		if c.Pools != "" || c.Shards != "" || c.RepeatEvery > 0 || c.TotalCalls > 0 {
+			addf("-pools, -shards, -repeat-every and -total-calls cannot be used with -probe-ceiling")
+		}
+		if c.ControlAddr != "" || c.HistoryFile != "" || c.CheckLinearizability || c.Assert != "" {
+			addf("-control-addr, -record-history, -check-linearizability and -assert cannot be used with -probe-ceiling")
+		}
+	}
+
+	if c.Shards != "" {
+		if c.Action != "read" && c.Action != "write" {
+			addf("-shards only supports the read and write actions (got -a %s)", c.Action)
+		}
+		levels, err := parseShardLevels(c.Shards)
+		if err != nil {
+			addf("-shards: %v", err)
+		}
+		if c.ShardSuffix != "random" && c.ShardSuffix != "calculated" {
+			addf("-shard-suffix must be either random or calculated (got %q)", c.ShardSuffix)
+		}
+		if c.Keys > 1 || c.IdFile != "" || c.ShiftHotkey > 0 || c.Pools != "" {
+			addf("-keys, -id-file, -shift-hotkey and -pools cannot be used with -shards")
+		}
+		if c.HistoryFile != "" || c.CheckLinearizability || c.ContentionReport != "" {
+			addf("-record-history, -check-linearizability and -contention-report follow a single item and cannot be used with -shards")
+		}
+		if c.DryRun || c.CompatCheck || c.Check || c.Calibrate || c.Compare != "" || c.TableA != "" || c.ConcurrencySweep != "" {
+			addf("-shards cannot be used with -dry-run, -compat-check, -check, -calibrate, -compare, -table-a/-table-b and -concurrency-sweep")
+		}
+		if len(levels) > 1 {
+			if c.ShardStep < time.Second {
+				addf("-shard-step must be at least 1s (got %v)", c.ShardStep)
+			}
+			if c.RepeatEvery > 0 || c.TotalCalls > 0 || c.ControlAddr != "" || c.Assert != "" {
+				addf("-repeat-every, -total-calls, -control-addr and -assert cannot be used with a -shards list")
+			}
+		}
+	}
+
+	modes := 0
+	for _, on := range []bool{c.DryRun, c.CompatCheck, c.Check, c.Calibrate, c.Compare != "", c.TableA != "", c.ConcurrencySweep != "", c.BurstIdle != "", c.ProbeCeiling > 0} {
+		if on {
+			modes++
+		}
+	}
+	if modes > 1 {
+		addf("only one of -dry-run, -compat-check, -check, -calibrate, -compare, -table-a/-table-b, -concurrency-sweep, -burst-idle and -probe-ceiling can be used at a time")
+	}
+
+	if len(problems) == 0 && c.Pools != "" {
+		problems = c.validatePools()
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
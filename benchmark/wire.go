@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The DynamoDB API speaks JSON in which the members of the SDK types are
+// named as their fields or their locationName tags, unset members are left
+// out, blobs are base64 and timestamps are seconds since the epoch. The SDK
+// keeps its codec private, so wireJSON and decodeWire implement the same
+// encoding on the public types, for the payload sizes, the dry run, export
+// and import and the fake endpoint.
+
+var (
+	wireTimeType  = reflect.TypeOf(time.Time{})
+	wireBytesType = reflect.TypeOf([]byte(nil))
+)
+
+// wireJSON encodes v the same way the SDK serializes it on the wire, so
+// its length is the request payload size.
+func wireJSON(v interface{}) json.RawMessage {
+	b, err := buildWireJSON(v)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// buildWireJSON is wireJSON which returns the values it cannot encode, e.g.
+// NaN, as an error.
+func buildWireJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := encodeWire(&buf, reflect.ValueOf(v))
+	return buf.Bytes(), err
+}
+
+func encodeWire(buf *bytes.Buffer, v reflect.Value) error {
+	v = reflect.Indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	switch {
+	case v.Type() == wireTimeType:
+		ms := v.Interface().(time.Time).UnixNano() / int64(time.Millisecond)
+		buf.WriteString(strconv.FormatFloat(float64(ms)/1e3, 'f', -1, 64))
+		return nil
+	case v.Type() == wireBytesType:
+		if v.IsNil() {
+			return nil
+		}
+		buf.WriteByte('"')
+		buf.WriteString(base64.StdEncoding.EncodeToString(v.Bytes()))
+		buf.WriteByte('"')
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		buf.WriteByte('{')
+		first := true
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field, member := t.Field(i), v.Field(i)
+			if field.PkgPath != "" || field.Tag.Get("location") != "" || field.Tag.Get("ignore") != "" || field.Tag.Get("json") == "-" {
+				continue
+			}
+			if (member.Kind() == reflect.Ptr || member.Kind() == reflect.Slice || member.Kind() == reflect.Map) && member.IsNil() {
+				continue
+			}
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			writeWireString(buf, wireName(field))
+			buf.WriteByte(':')
+			if err := encodeWire(buf, member); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case reflect.Slice:
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeWire(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeWireString(buf, k.String())
+			buf.WriteByte(':')
+			if err := encodeWire(buf, v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case reflect.String:
+		writeWireString(buf, v.String())
+	case reflect.Bool:
+		buf.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int64:
+		buf.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Float64:
+		f := v.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return fmt.Errorf("unsupported number %v", f)
+		}
+		buf.WriteString(strconv.FormatFloat(f, 'f', -1, 64))
+	default:
+		return fmt.Errorf("unsupported JSON value of type %s", v.Type())
+	}
+	return nil
+}
+
+// wireName is the name of the member of field on the wire.
+func wireName(field reflect.StructField) string {
+	if name := field.Tag.Get("locationName"); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// writeWireString writes s quoted, escaping only what JSON requires, like
+// the SDK.
+func writeWireString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			buf.WriteString(`\"`)
+		case c == '\\':
+			buf.WriteString(`\\`)
+		case c == '\b':
+			buf.WriteString(`\b`)
+		case c == '\f':
+			buf.WriteString(`\f`)
+		case c == '\r':
+			buf.WriteString(`\r`)
+		case c == '\t':
+			buf.WriteString(`\t`)
+		case c == '\n':
+			buf.WriteString(`\n`)
+		case c < 32:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&0xF])
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// decodeWire decodes the JSON of the wire in body into v, a pointer to an
+// SDK type; an empty body leaves v as it is.
+func decodeWire(body []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var data interface{}
+	if err := d.Decode(&data); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return assignWire(reflect.ValueOf(v).Elem(), data)
+}
+
+// assignWire sets v, a field, element or pointer of an SDK type, to data
+// decoded with json.Number.
+func assignWire(v reflect.Value, data interface{}) error {
+	if data == nil {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assignWire(v.Elem(), data)
+	}
+	switch {
+	case v.Type() == wireTimeType:
+		n, ok := data.(json.Number)
+		if !ok {
+			return fmt.Errorf("JSON value is not a timestamp (%#v)", data)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(time.Unix(0, int64(f*1e3)*int64(time.Millisecond)).UTC()))
+		return nil
+	case v.Type() == wireBytesType:
+		s, ok := data.(string)
+		if !ok {
+			return fmt.Errorf("JSON value is not a blob (%#v)", data)
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(b)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		members, ok := data.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("JSON value is not a structure (%#v)", data)
+		}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if err := assignWire(v.Field(i), members[wireName(field)]); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		list, ok := data.([]interface{})
+		if !ok {
+			return fmt.Errorf("JSON value is not a list (%#v)", data)
+		}
+		v.Set(reflect.MakeSlice(v.Type(), len(list), len(list)))
+		for i, e := range list {
+			if err := assignWire(v.Index(i), e); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		members, ok := data.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("JSON value is not a map (%#v)", data)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for k, e := range members {
+			ev := reflect.New(v.Type().Elem()).Elem()
+			if err := assignWire(ev, e); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(k), ev)
+		}
+	case reflect.String:
+		s, ok := data.(string)
+		if !ok {
+			return fmt.Errorf("JSON value is not a string (%#v)", data)
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		b, ok := data.(bool)
+		if !ok {
+			return fmt.Errorf("JSON value is not a boolean (%#v)", data)
+		}
+		v.SetBool(b)
+	case reflect.Int64, reflect.Float64:
+		n, ok := data.(json.Number)
+		if !ok {
+			return fmt.Errorf("JSON value is not a number (%#v)", data)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return err
+		}
+		if v.Kind() == reflect.Int64 {
+			v.SetInt(int64(f))
+		} else {
+			v.SetFloat(f)
+		}
+	default:
+		return fmt.Errorf("unsupported JSON value of type %s", v.Type())
+	}
+	return nil
+}
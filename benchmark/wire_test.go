@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// sdkBody is the body the SDK builds for the request of input.
+func sdkBody(t *testing.T, build func(db *dynamodb.DynamoDB) *request.Request) []byte {
+	t.Helper()
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+	req := build(dynamodb.New(sess))
+	if err := req.Build(); err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(req.GetBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestWireJSON(t *testing.T) {
+	update := &dynamodb.UpdateItemInput{
+		TableName: aws.String("tbl"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String("x\"\n\x01<é>")},
+			"sk": {N: aws.String("1.5")},
+		},
+		UpdateExpression:          aws.String("SET #a = :a, #b = :b"),
+		ExpressionAttributeNames:  map[string]*string{"#b": aws.String("blob"), "#a": aws.String("list")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":a": {L: []*dynamodb.AttributeValue{{BOOL: aws.Bool(true)}, {NULL: aws.Bool(true)}}}, ":b": {B: []byte{0, 1, 0xff}}},
+		ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+	}
+	if got, want := wireJSON(update), sdkBody(t, func(db *dynamodb.DynamoDB) *request.Request {
+		req, _ := db.UpdateItemRequest(update)
+		return req
+	}); string(got) != string(want) {
+		t.Errorf("UpdateItem\n got %s\nwant %s", got, want)
+	}
+
+	query := &dynamodb.QueryInput{
+		TableName:              aws.String("tbl"),
+		KeyConditionExpression: aws.String("id = :id"),
+		Limit:                  aws.Int64(25),
+		ConsistentRead:         aws.Bool(false),
+	}
+	if got, want := wireJSON(query), sdkBody(t, func(db *dynamodb.DynamoDB) *request.Request {
+		req, _ := db.QueryRequest(query)
+		return req
+	}); string(got) != string(want) {
+		t.Errorf("Query\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestDecodeWire(t *testing.T) {
+	in := &dynamodb.TableDescription{
+		TableName:        aws.String("tbl"),
+		ItemCount:        aws.Int64(42),
+		CreationDateTime: aws.Time(time.Unix(1600000000, 123e6).UTC()),
+		KeySchema:        []*dynamodb.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: aws.String("HASH")}},
+	}
+	body, err := buildWireJSON(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &dynamodb.TableDescription{}
+	if err := decodeWire(body, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("decoded %s as %v", body, out)
+	}
+	if err := decodeWire(nil, out); err != nil {
+		t.Errorf("empty body: %v", err)
+	}
+}
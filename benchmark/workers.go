@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+
+	"benchmark/internal/table"
+)
+
+func (c *DynamoDBBenchmark) updateItemInput() *dynamodb.UpdateItemInput {
+	param := &dynamodb.UpdateItemInput{
+		TableName: &c.TableName,
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(c.Id),
+			},
+		},
+		UpdateExpression: aws.String("set age = age + :age_increment_value"),
+		ReturnValues:     aws.String("ALL_NEW"),
+	}
+	if c.ReturnValues != "" {
+		param.ReturnValues = aws.String(c.ReturnValues)
+	}
+	if c.ConsumedCapacity {
+		param.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityIndexes)
+	}
+	if c.ItemCollectionMetrics {
+		param.ReturnItemCollectionMetrics = aws.String(dynamodb.ReturnItemCollectionMetricsSize)
+	}
+	if c.Condition > 0 {
+		param.ConditionExpression = aws.String("age < :age_max_value")
+		param.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":age_increment_value": {
+				N: aws.String("1"),
+			},
+			":age_max_value": {
+				N: aws.String(strconv.Itoa(c.Condition)),
+			},
+		}
+	} else {
+		param.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":age_increment_value": {
+				N: aws.String("1"),
+			},
+		}
+	}
+	return param
+}
+
+func (c *DynamoDBBenchmark) getItemInput() *dynamodb.GetItemInput {
+	param := &dynamodb.GetItemInput{
+		TableName: &c.TableName,
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(c.Id),
+			},
+		},
+	}
+	if c.Projection != "" {
+		// Validate has checked the expression and names.
+		defined, _ := parseExpressionNames(c.ExpressionNames)
+		expr, names, _ := aliasExpression(c.Projection, defined)
+		param.ProjectionExpression = aws.String(expr)
+		param.ExpressionAttributeNames = aws.StringMap(names)
+	}
+	if c.ConsumedCapacity {
+		param.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityIndexes)
+	}
+	return param
+}
+
+// measurePayloads tells whether the request and response payload sizes are
+// recorded, i.e. whether -return-values or -projection is given.
+func (c *DynamoDBBenchmark) measurePayloads() bool {
+	return c.ReturnValues != "" || c.Projection != ""
+}
+
+// startWriteWorker runs session id of the write action: UpdateItem calls on
+// -id (or the item of -keys, -id-file or -shards), one after the other or
+// -pipeline-depth at a time.
+func (c *DynamoDBBenchmark) startWriteWorker(id int, wg *sync.WaitGroup, stats *WorkerStats) {
+	c.runWorker(id, wg, stats, c.newWriteOperation)
+}
+
+// writeOperation sends the UpdateItem calls of a write session.
+type writeOperation struct {
+	c     *DynamoDBBenchmark
+	id    int
+	db    *dynamodb.DynamoDB
+	stats *WorkerStats
+	rnd   *rand.Rand
+	next  func() map[string]*dynamodb.AttributeValue
+	// param and requestBytes are those of -update-template incr, which
+	// are the same for every call.
+	param        *dynamodb.UpdateItemInput
+	requestBytes int
+	// process is the process of -record-history, which cannot be used
+	// with -pipeline-depth.
+	process int
+}
+
+// writeRequest is the Request of a write call.
+type writeRequest struct {
+	param        *dynamodb.UpdateItemInput
+	requestBytes int
+	shard        int
+}
+
+func (c *DynamoDBBenchmark) newWriteOperation(id int, db *dynamodb.DynamoDB, stats *WorkerStats) Operation {
+	param := c.updateItemInput()
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	return &writeOperation{
+		c:            c,
+		id:           id,
+		db:           db,
+		stats:        stats,
+		rnd:          rnd,
+		next:         c.keyPicker(rnd),
+		param:        param,
+		requestBytes: len(wireJSON(param)),
+		process:      id,
+	}
+}
+
+func (o *writeOperation) Build(i int) *Call {
+	c := o.c
+	param, requestBytes := o.param, o.requestBytes
+	if c.UpdateTemplate != "incr" {
+		param = c.writeInput(o.id, i)
+		if c.measurePayloads() {
+			requestBytes = len(wireJSON(param))
+		}
+	}
+	// A copy, since the calls in flight still use the previous key.
+	call := *param
+	if o.next != nil {
+		call.Key = o.next()
+	}
+	shard := 0
+	if c.shards != nil {
+		shard = c.shards.pick(o.id, i, o.rnd)
+		call.Key = idKey(c.shardKey(shard))
+	}
+	return &Call{Op: "UpdateItem", Request: &writeRequest{&call, requestBytes, shard}, Items: 1}
+}
+
+func (o *writeOperation) Execute(call *Call) error {
+	c, req := o.c, call.Request.(*writeRequest)
+	c.history.Invoke(o.process, "incr")
+	attempt := c.clock.Now()
+	dresp, derr := c.lock.UpdateItem(call.Context(), o.db, req.param)
+	if derr == nil && c.measurePayloads() {
+		o.stats.RecordPayload("UpdateItem", req.requestBytes, len(wireJSON(dresp)))
+	}
+	if derr == nil {
+		o.stats.RecordCapacity("UpdateItem", dresp.ConsumedCapacity)
+		c.collectionSizes.Record(dresp.ItemCollectionMetrics)
+	}
+	c.contention.Record(o.id, attempt, time.Since(attempt), ageValue(dresp.Attributes), derr)
+	if c.history != nil {
+		o.process = c.history.Complete(o.process, "incr", ageValue(dresp.Attributes), derr, c.Connections)
+	}
+	if c.Verbose {
+		item := table.Item{}
+		derr := dynamodbattribute.UnmarshalMap(dresp.Attributes, &item)
+		if derr != nil {
+			fmt.Printf("Got error unmarshalling: %s", derr)
+			return derr
+		}
+		fmt.Printf("[Verbose] DynamoDB UpdateImte Response: id %s age %d\n", item.Id, item.Age)
+	}
+	return derr
+}
+
+func (o *writeOperation) Observe(call *Call, err error) {
+	if err == nil {
+		o.c.shards.wrote(call.Request.(*writeRequest).shard)
+	}
+}
+
+// startReadWorker runs session id of the read action: GetItem calls on -id
+// (or the item of -keys or -id-file), one after the other or
+// -pipeline-depth at a time.
+func (c *DynamoDBBenchmark) startReadWorker(id int, wg *sync.WaitGroup, stats *WorkerStats) {
+	c.runWorker(id, wg, stats, c.newReadOperation)
+}
+
+// readOperation sends the GetItem calls of a read session.
+type readOperation struct {
+	c            *DynamoDBBenchmark
+	db           *dynamodb.DynamoDB
+	stats        *WorkerStats
+	next         func() map[string]*dynamodb.AttributeValue
+	param        *dynamodb.GetItemInput
+	requestBytes int
+	// process is the process of -record-history, which cannot be used
+	// with -pipeline-depth.
+	process int
+}
+
+func (c *DynamoDBBenchmark) newReadOperation(id int, db *dynamodb.DynamoDB, stats *WorkerStats) Operation {
+	param := c.getItemInput()
+	return &readOperation{
+		c:            c,
+		db:           db,
+		stats:        stats,
+		next:         c.keyPicker(rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))),
+		param:        param,
+		requestBytes: len(wireJSON(param)),
+		process:      id,
+	}
+}
+
+func (o *readOperation) Build(i int) *Call {
+	call := *o.param
+	if o.next != nil {
+		call.Key = o.next()
+	}
+	return &Call{Op: "GetItem", Request: &call, Items: 1}
+}
+
+func (o *readOperation) Execute(call *Call) error {
+	c := o.c
+	param := call.Request.(*dynamodb.GetItemInput)
+	var key string
+	if c.cache != nil {
+		key = cacheKey(param.Key)
+		if _, ok := c.cache.Get(key); ok {
+			call.Op = cacheHitOp
+			return nil
+		}
+		call.Op = "GetItem"
+	}
+	c.history.Invoke(o.process, "read")
+	dresp, derr := o.db.GetItemWithContext(call.Context(), param)
+	if derr == nil && c.cache != nil {
+		c.cache.Put(key, dresp)
+	}
+	if derr == nil {
+		derr = c.compression.Read(dresp.Item)
+	}
+	if derr == nil && c.measurePayloads() {
+		o.stats.RecordPayload("GetItem", o.requestBytes, len(wireJSON(dresp)))
+	}
+	if derr == nil {
+		o.stats.RecordCapacity("GetItem", dresp.ConsumedCapacity)
+	}
+	if c.history != nil {
+		o.process = c.history.Complete(o.process, "read", ageValue(dresp.Item), derr, c.Connections)
+	}
+	if c.Verbose {
+		item := table.Item{}
+		derr := dynamodbattribute.UnmarshalMap(dresp.Item, &item)
+		if derr != nil {
+			fmt.Printf("Got error unmarshalling: %s", derr)
+			return derr
+		}
+		fmt.Printf("[Verbose] DynamoDB GetImte Response: id %s age %d\n", item.Id, item.Age)
+	}
+	return derr
+}
+
+func (o *readOperation) Observe(call *Call, err error) {}
@@ -1,7 +0,0 @@
-module helper
-
-go 1.17
-
-require github.com/aws/aws-sdk-go v1.43.5
-
-require github.com/jmespath/go-jmespath v0.4.0 // indirect